@@ -0,0 +1,339 @@
+// Package commands provides caddy CLI subcommands for operating the AI router.
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "ai-bench",
+		Usage: "[--url <url>] [--model <models>] [--concurrency <n>] [--requests <n>] [--stream-ratio <0..1>] [--prompt-sizes <sizes>]",
+		Short: "Drives synthetic chat completions load against a running router",
+		Long: `
+Sends synthetic chat completions requests to a running router and reports
+time-to-first-token, total latency and output token throughput percentiles,
+grouped by the provider that served each request (X-Real-Provider-Id).
+
+Models are picked round-robin from --model (comma-separated). Prompt sizes
+are approximate token counts picked at random from --prompt-sizes. The
+fraction of streaming requests is controlled by --stream-ratio.`,
+		CobraFunc: func(cmd *cobra.Command) {
+			cmd.Flags().StringP("url", "u", "http://localhost:9111/v1/chat/completions", "Chat completions endpoint of the router")
+			cmd.Flags().StringP("model", "m", "gpt-4o-mini", "Comma-separated models to request (round-robin)")
+			cmd.Flags().StringP("api-key", "k", "", "Bearer token sent with every request")
+			cmd.Flags().IntP("concurrency", "c", 4, "Number of concurrent workers")
+			cmd.Flags().IntP("requests", "n", 100, "Total number of requests to send")
+			cmd.Flags().Float64P("stream-ratio", "s", 0.5, "Fraction of requests sent with stream=true")
+			cmd.Flags().StringP("prompt-sizes", "p", "50,500", "Comma-separated approximate prompt sizes in tokens")
+			cmd.Flags().Int("max-tokens", 128, "max_tokens for every request")
+			cmd.Flags().Duration("timeout", 2*time.Minute, "Per-request timeout")
+			cmd.Flags().Bool("json", false, "Print the report as JSON")
+			cmd.RunE = caddycmd.WrapCommandFuncForCobra(cmdAIBench)
+		},
+	})
+}
+
+// benchSample is the measurement of a single request
+type benchSample struct {
+	provider     string
+	stream       bool
+	err          error
+	ttft         time.Duration
+	latency      time.Duration
+	outputTokens int
+}
+
+// BenchStats summarizes samples of one provider
+type BenchStats struct {
+	Provider     string  `json:"provider"`
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	Streamed     int     `json:"streamed"`
+	TTFTP50      float64 `json:"ttft_p50_ms"`
+	TTFTP95      float64 `json:"ttft_p95_ms"`
+	TTFTP99      float64 `json:"ttft_p99_ms"`
+	LatencyP50   float64 `json:"latency_p50_ms"`
+	LatencyP95   float64 `json:"latency_p95_ms"`
+	LatencyP99   float64 `json:"latency_p99_ms"`
+	TokensPerSec float64 `json:"output_tokens_per_sec_p50"`
+}
+
+func cmdAIBench(fl caddycmd.Flags) (int, error) {
+	url := fl.String("url")
+	apiKey := fl.String("api-key")
+	concurrency := fl.Int("concurrency")
+	total := fl.Int("requests")
+	streamRatio := fl.Float64("stream-ratio")
+	maxTokens := fl.Int("max-tokens")
+	timeout := fl.Duration("timeout")
+
+	var models []string
+	for _, m := range strings.Split(fl.String("model"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	if len(models) == 0 {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("at least one model is required")
+	}
+
+	var promptSizes []int
+	for _, s := range strings.Split(fl.String("prompt-sizes"), ",") {
+		var n int
+		if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d", &n); err != nil || n <= 0 {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("invalid prompt size '%s'", s)
+		}
+		promptSizes = append(promptSizes, n)
+	}
+
+	if concurrency <= 0 || total <= 0 {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("concurrency and requests must be positive")
+	}
+
+	client := &http.Client{Timeout: timeout}
+	jobs := make(chan int)
+	samples := make(chan benchSample, total)
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				body := map[string]any{
+					"model":      models[i%len(models)],
+					"max_tokens": maxTokens,
+					"stream":     rand.Float64() < streamRatio,
+					"messages": []map[string]string{{
+						"role":    "user",
+						"content": syntheticPrompt(promptSizes[rand.IntN(len(promptSizes))]),
+					}},
+				}
+				samples <- runBenchRequest(client, url, apiKey, body)
+			}
+		}()
+	}
+
+	started := time.Now()
+	for i := range total {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	close(samples)
+	elapsed := time.Since(started)
+
+	byProvider := map[string][]benchSample{}
+	for s := range samples {
+		byProvider[s.provider] = append(byProvider[s.provider], s)
+	}
+
+	var report []BenchStats
+	for provider, ss := range byProvider {
+		report = append(report, summarizeBench(provider, ss))
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Provider < report[j].Provider })
+
+	if fl.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return caddy.ExitCodeSuccess, enc.Encode(map[string]any{
+			"elapsed_ms": elapsed.Milliseconds(),
+			"requests":   total,
+			"providers":  report,
+		})
+	}
+
+	fmt.Printf("%d requests in %s (%.1f req/s)\n\n", total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tREQS\tERRS\tSTREAM\tTTFT p50/p95/p99 (ms)\tLATENCY p50/p95/p99 (ms)\tTOK/S p50")
+	for _, st := range report {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.0f/%.0f/%.0f\t%.0f/%.0f/%.0f\t%.1f\n",
+			st.Provider, st.Requests, st.Errors, st.Streamed,
+			st.TTFTP50, st.TTFTP95, st.TTFTP99,
+			st.LatencyP50, st.LatencyP95, st.LatencyP99,
+			st.TokensPerSec)
+	}
+	_ = tw.Flush()
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+// syntheticPrompt builds a prompt of roughly n tokens
+func syntheticPrompt(n int) string {
+	words := []string{"router", "latency", "token", "stream", "provider", "model", "fallback", "plugin"}
+	var b strings.Builder
+	b.WriteString("Summarize the following text in one sentence: ")
+	for i := range n {
+		b.WriteString(words[i%len(words)])
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// runBenchRequest sends a single request and measures it
+func runBenchRequest(client *http.Client, url, apiKey string, body map[string]any) benchSample {
+	stream, _ := body["stream"].(bool)
+	sample := benchSample{stream: stream, provider: "(none)"}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		sample.err = err
+		return sample
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewReader(data))
+	if err != nil {
+		sample.err = err
+		return sample
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		sample.err = err
+		sample.latency = time.Since(start)
+		return sample
+	}
+	defer res.Body.Close()
+
+	if p := res.Header.Get("X-Real-Provider-Id"); p != "" {
+		sample.provider = p
+	}
+
+	if res.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, res.Body)
+		sample.err = fmt.Errorf("status %d", res.StatusCode)
+		sample.latency = time.Since(start)
+		return sample
+	}
+
+	if !stream {
+		respData, err := io.ReadAll(res.Body)
+		sample.latency = time.Since(start)
+		sample.ttft = sample.latency
+		if err != nil {
+			sample.err = err
+			return sample
+		}
+		resJson, err := styles.ParsePartialJSON(respData)
+		if err != nil {
+			sample.err = err
+			return sample
+		}
+		sample.outputTokens = outputTokens(resJson, "")
+		return sample
+	}
+
+	var content strings.Builder
+	var last styles.PartialJSON
+	for event := range sse.NewDefaultReader(res.Body).ReadEvents() {
+		if event.Error != nil {
+			sample.err = event.Error
+			break
+		}
+		if event.Done {
+			break
+		}
+		chunk, err := styles.ParsePartialJSON(event.Data)
+		if err != nil {
+			continue
+		}
+		if _, ok := chunk["error"]; ok {
+			sample.err = fmt.Errorf("stream error: %s", string(chunk["error"]))
+			break
+		}
+		choices := styles.TryGetFromPartialJSON[[]styles.ChatCompletionsChoice](chunk, "choices")
+		for _, c := range choices {
+			if c.Delta == nil {
+				continue
+			}
+			if s, ok := c.Delta.Content.(string); ok && s != "" {
+				if sample.ttft == 0 {
+					sample.ttft = time.Since(start)
+				}
+				content.WriteString(s)
+			}
+		}
+		last = chunk
+	}
+	sample.latency = time.Since(start)
+	sample.outputTokens = outputTokens(last, content.String())
+	return sample
+}
+
+// outputTokens reads completion tokens from usage, estimating from content when absent
+func outputTokens(resJson styles.PartialJSON, content string) int {
+	if usage := styles.TryGetFromPartialJSON[*styles.ChatCompletionsUsage](resJson, "usage"); usage != nil && usage.CompletionTokens > 0 {
+		return usage.CompletionTokens
+	}
+	return (len(content) + 3) / 4
+}
+
+func summarizeBench(provider string, samples []benchSample) BenchStats {
+	st := BenchStats{Provider: provider, Requests: len(samples)}
+
+	var ttfts, latencies, tps []float64
+	for _, s := range samples {
+		if s.stream {
+			st.Streamed++
+		}
+		if s.err != nil {
+			st.Errors++
+			continue
+		}
+		// Streams that never delivered content, e.g. only tool calls, have
+		// no first token to time
+		if s.ttft > 0 {
+			ttfts = append(ttfts, float64(s.ttft.Microseconds())/1000)
+		}
+		latencies = append(latencies, float64(s.latency.Microseconds())/1000)
+		if gen := s.latency - s.ttft; s.stream && gen > 0 {
+			tps = append(tps, float64(s.outputTokens)/gen.Seconds())
+		} else if s.latency > 0 {
+			tps = append(tps, float64(s.outputTokens)/s.latency.Seconds())
+		}
+	}
+
+	st.TTFTP50, st.TTFTP95, st.TTFTP99 = percentile(ttfts, 50), percentile(ttfts, 95), percentile(ttfts, 99)
+	st.LatencyP50, st.LatencyP95, st.LatencyP99 = percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99)
+	st.TokensPerSec = percentile(tps, 50)
+	return st
+}
+
+// percentile returns the nearest-rank percentile of values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	idx := int(math.Ceil(float64(len(sorted))*p/100)) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return sorted[idx]
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	values := []float64{40, 10, 30, 20}
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 10},
+		{10, 10},
+		{25, 10},
+		{50, 20},
+		{60, 30},
+		{95, 40},
+		{100, 40},
+	}
+	for _, tt := range tests {
+		if got := percentile(values, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("expected 0 without values, got %v", got)
+	}
+	if values[0] != 40 {
+		t.Error("expected the values left unsorted")
+	}
+}
+
+func TestSummarizeBench(t *testing.T) {
+	samples := []benchSample{
+		{stream: true, ttft: 100 * time.Millisecond, latency: 1100 * time.Millisecond, outputTokens: 50},
+		{stream: true, ttft: 300 * time.Millisecond, latency: 2300 * time.Millisecond, outputTokens: 100},
+		// A stream of tool calls only: no first token
+		{stream: true, latency: 500 * time.Millisecond, outputTokens: 10},
+		{ttft: 200 * time.Millisecond, latency: 200 * time.Millisecond, outputTokens: 20},
+		{stream: true, err: errors.New("status 502"), latency: 50 * time.Millisecond},
+	}
+	st := summarizeBench("openai", samples)
+
+	if st.Provider != "openai" || st.Requests != 5 || st.Errors != 1 || st.Streamed != 4 {
+		t.Errorf("unexpected counts %+v", st)
+	}
+	// TTFTs of 100, 200 and 300ms; the stream without content is left out
+	if st.TTFTP50 != 200 || st.TTFTP95 != 300 || st.TTFTP99 != 300 {
+		t.Errorf("expected TTFT p50/p95/p99 of 200/300/300ms, got %v/%v/%v", st.TTFTP50, st.TTFTP95, st.TTFTP99)
+	}
+	// Latencies of 200, 500, 1100 and 2300ms; the failed request is left out
+	if st.LatencyP50 != 500 || st.LatencyP95 != 2300 {
+		t.Errorf("expected latency p50/p95 of 500/2300ms, got %v/%v", st.LatencyP50, st.LatencyP95)
+	}
+	// 50 tok/s after the first token for both streams, 20 and 100 tok/s over
+	// the whole request for the others
+	if st.TokensPerSec != 50 {
+		t.Errorf("expected 50 tok/s at p50, got %v", st.TokensPerSec)
+	}
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "ai-decrypt",
+		Usage: "[--config <path>] [--adapter <name>] [<file>...]",
+		Short: "Decrypts objects stored with storage_encryption",
+		Long: `
+Decrypts objects, such as tee captures, sealed with the storage_encryption
+keys of the ai global options in the configuration, and writes them to
+stdout. Reads stdin when no file is given. Objects that aren't encrypted
+are written as they are.`,
+		CobraFunc: func(cmd *cobra.Command) {
+			cmd.Flags().StringP("config", "c", "Caddyfile", "Configuration file")
+			cmd.Flags().StringP("adapter", "a", "", "Name of config adapter to apply")
+			cmd.RunE = caddycmd.WrapCommandFuncForCobra(cmdDecrypt)
+		},
+	})
+}
+
+func cmdDecrypt(fl caddycmd.Flags) (int, error) {
+	input, _, err := caddycmd.LoadConfig(fl.String("config"), fl.String("adapter"))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	var cfg struct {
+		Apps struct {
+			AI *modules.AIApp `json:"ai"`
+		} `json:"apps"`
+	}
+	if err := json.Unmarshal(caddy.RemoveMetaFields(input), &cfg); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding config: %v", err)
+	}
+	if cfg.Apps.AI == nil || cfg.Apps.AI.StorageEncryption == nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("storage_encryption is not configured")
+	}
+	encryptor, err := cfg.Apps.AI.StorageEncryptor()
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	files := fl.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, file := range files {
+		var data []byte
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, err
+		}
+		var envelope struct {
+			Object string `json:"object"`
+		}
+		if json.Unmarshal(data, &envelope) == nil && envelope.Object == "encrypted" {
+			if data, err = encryptor.Open(context.Background(), data); err != nil {
+				return caddy.ExitCodeFailedStartup, fmt.Errorf("%s: %v", file, err)
+			}
+		}
+		os.Stdout.Write(data)
+		fmt.Println()
+	}
+	return caddy.ExitCodeSuccess, nil
+}
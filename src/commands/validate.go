@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "validate-ai",
+		Usage: "[--config <path>] [--adapter <name>]",
+		Short: "Validates AI router configuration",
+		Long: `
+Loads and provisions the configuration like 'caddy validate', then lints
+every ai_router: provider styles, virtual model mappings (target providers
+and plugin names), default_provider_for_model entries and auth managers.
+Exits non-zero with one line per problem when anything cannot be resolved.`,
+		CobraFunc: func(cmd *cobra.Command) {
+			cmd.Flags().StringP("config", "c", "Caddyfile", "Configuration file")
+			cmd.Flags().StringP("adapter", "a", "", "Name of config adapter to apply")
+			cmd.RunE = caddycmd.WrapCommandFuncForCobra(cmdValidateAI)
+		},
+	})
+}
+
+func cmdValidateAI(fl caddycmd.Flags) (int, error) {
+	input, _, err := caddycmd.LoadConfig(fl.String("config"), fl.String("adapter"))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	input = caddy.RemoveMetaFields(input)
+
+	var cfg *caddy.Config
+	if err := caddy.StrictUnmarshalJSON(input, &cfg); err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding config: %v", err)
+	}
+
+	// Provisioning runs the per-router startup lint and registers routers and auth managers
+	if err := caddy.Validate(cfg); err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	routers := modules.ListRouters()
+	names := make([]string, 0, len(routers))
+	for name := range routers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	failed := false
+	for _, name := range names {
+		errs := routers[name].Lint(true)
+		if len(errs) == 0 {
+			fmt.Printf("ai_router %s: OK (%d providers)\n", name, len(routers[name].ProvidersOrder))
+			continue
+		}
+		failed = true
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ai_router %s: %v\n", name, err)
+		}
+	}
+
+	if len(names) == 0 {
+		fmt.Println("No ai_router configured")
+	}
+	if failed {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("AI configuration is invalid")
+	}
+
+	fmt.Println("Valid AI configuration")
+	return caddy.ExitCodeSuccess, nil
+}
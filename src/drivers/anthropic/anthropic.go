@@ -0,0 +1,351 @@
+// Package anthropic implements the commands of providers speaking the
+// Anthropic Messages API (/v1/messages).
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Logger for debug output (set by module during Provision)
+var Logger *zap.Logger = zap.NewNop()
+
+// DefaultVersion is the anthropic-version sent when neither the client nor
+// the provider's headers set one
+const DefaultVersion = "2023-06-01"
+
+// logURL returns an upstream URL for logs, without its query
+func logURL(u *url.URL) string {
+	redacted := *u
+	redacted.RawQuery = ""
+	return redacted.Redacted()
+}
+
+// authorize sets the provider's API key and the API version on an upstream
+// request. The client's credentials are for the router and never forwarded.
+func authorize(p *services.ProviderService, scope string, r, httpReq *http.Request) error {
+	httpReq.Header.Del("Authorization")
+	httpReq.Header.Del("x-api-key")
+	authVal, err := p.CollectTargetAuth(scope, r, httpReq)
+	if err != nil {
+		return errs.Wrap(errs.ErrAuth, err)
+	}
+	if authVal != "" {
+		httpReq.Header.Set("x-api-key", authVal)
+	}
+	if httpReq.Header.Get("anthropic-version") == "" {
+		httpReq.Header.Set("anthropic-version", DefaultVersion)
+	}
+	p.ApplyRequestHeaders(r, httpReq)
+	return nil
+}
+
+// Inference implements InferenceCommand for the Messages API
+type Inference struct{}
+
+func (c *Inference) createRequest(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request, stream bool) (*http.Request, context.CancelFunc, error) {
+	targetUrl, err := p.EndpointURL("inference", "/messages")
+	if err != nil {
+		return nil, nil, err
+	}
+	p.ApplyQuery(r, &targetUrl)
+
+	reqJson, err = p.WithUpstreamModel(reqJson)
+	if err != nil {
+		return nil, nil, err
+	}
+	body := reqJson.Clone()
+	if stream {
+		body["stream"] = json.RawMessage("true")
+	} else {
+		delete(body, "stream")
+	}
+	reqBody, err := body.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetHeader := r.Header.Clone()
+	targetHeader.Del("Accept-Encoding")
+	targetHeader.Set("Content-Type", "application/json")
+
+	httpReq := &http.Request{
+		Method:        "POST",
+		URL:           &targetUrl,
+		Header:        targetHeader,
+		Body:          io.NopCloser(bytes.NewReader(reqBody)),
+		ContentLength: int64(len(reqBody)),
+	}
+	ctx, cancel := p.WithUpstreamTimeout(r.Context())
+	httpReq = httpReq.WithContext(ctx)
+
+	if err := authorize(p, "inference", r, httpReq); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return httpReq, cancel, nil
+}
+
+// DoInference implements InferenceCommand
+func (c *Inference) DoInference(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	httpReq, cancel, err := c.createRequest(p, reqJson, r, false)
+	if err != nil {
+		Logger.Error("DoInference (anthropic) createRequest failed", zap.Error(err))
+		return nil, nil, err
+	}
+	ctx := httpReq.Context()
+	defer cancel()
+
+	Logger.Debug("DoInference (anthropic) sending request",
+		zap.String("provider", p.Name),
+		zap.String("url", logURL(httpReq.URL)))
+
+	res, err := p.HTTPClient().Do(httpReq)
+	if err != nil {
+		Logger.Error("DoInference (anthropic) HTTP request failed", zap.Error(err))
+		return nil, nil, services.UpstreamError(ctx, err)
+	}
+	defer res.Body.Close()
+
+	p.ObserveRateLimit(httpReq.Header.Get("x-api-key"), res)
+
+	respData, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		Logger.Error("DoInference (anthropic) non-200 response",
+			zap.Int("status", res.StatusCode),
+			zap.String("body", string(respData)))
+		return res, nil, &errs.StatusError{Status: res.StatusCode, Body: string(respData), Header: res.Header}
+	}
+
+	respJson, err := styles.ParsePartialJSON(respData)
+	if err != nil {
+		Logger.Error("DoInference (anthropic) response JSON parse failed", zap.Error(err))
+		return res, nil, errs.Wrap(errs.ErrUpstream, err)
+	}
+	return res, respJson, nil
+}
+
+// DoInferenceStream implements InferenceCommand. Events are passed on with
+// the message's id and model, which only message_start carries, and the
+// final message_delta gets the input usage of message_start, so that each
+// event converts on its own.
+func (c *Inference) DoInferenceStream(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, chan drivers.InferenceStreamChunk, error) {
+	httpReq, cancel, err := c.createRequest(p, reqJson, r, true)
+	if err != nil {
+		Logger.Error("DoInferenceStream (anthropic) createRequest failed", zap.Error(err))
+		return nil, nil, err
+	}
+	ctx := httpReq.Context()
+	received := p.AwaitFirstToken(ctx)
+
+	Logger.Debug("DoInferenceStream (anthropic) sending request",
+		zap.String("provider", p.Name),
+		zap.String("url", logURL(httpReq.URL)))
+
+	res, err := p.HTTPClient().Do(httpReq)
+	if err != nil {
+		cancel()
+		Logger.Error("DoInferenceStream (anthropic) HTTP request failed", zap.Error(err))
+		return nil, nil, services.UpstreamError(ctx, err)
+	}
+
+	p.ObserveRateLimit(httpReq.Header.Get("x-api-key"), res)
+
+	// Fail before the stream starts so the router can fall back to another provider
+	if res.StatusCode != http.StatusOK {
+		respData, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		cancel()
+		Logger.Error("DoInferenceStream (anthropic) non-200 response",
+			zap.Int("status", res.StatusCode),
+			zap.String("body", string(respData)))
+		return res, nil, &errs.StatusError{Status: res.StatusCode, Body: string(respData), Header: res.Header}
+	}
+
+	services.TrackUpstreamStream(res)
+	chunks := make(chan drivers.InferenceStreamChunk)
+
+	go func() {
+		defer close(chunks)
+		defer services.TrackStreamGoroutine()()
+		defer cancel()
+		defer res.Body.Close()
+
+		var decoder drivers.ChunkDecoder
+		defer func() {
+			if decoder.Split > 0 || decoder.Skipped > 0 {
+				Logger.Warn("DoInferenceStream (anthropic) repaired malformed stream chunks",
+					zap.String("provider", p.Name),
+					zap.Int("split", decoder.Split),
+					zap.Int("skipped", decoder.Skipped))
+			}
+		}()
+
+		var message struct {
+			id, model string
+			usage     styles.AnthropicUsage
+		}
+		reader := sse.NewDefaultReader(res.Body)
+		for event := range reader.ReadEvents() {
+			received()
+			if event.Error != nil {
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: services.UpstreamError(ctx, event.Error)})
+				return
+			}
+			if event.Done {
+				return
+			}
+			if event.Data == nil {
+				continue
+			}
+			decoded, err := decoder.Decode(event.Data)
+			for _, data := range decoded {
+				switch styles.TryGetFromPartialJSON[string](data, "type") {
+				case "ping", "content_block_stop", "message_stop":
+					continue
+				case "error":
+					drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: streamError(data)})
+					return
+				case "message_start":
+					var start struct {
+						Message styles.AnthropicResponse `json:"message"`
+					}
+					if raw, err := data.Marshal(); err == nil && json.Unmarshal(raw, &start) == nil {
+						message.id, message.model = start.Message.ID, start.Message.Model
+						if start.Message.Usage != nil {
+							message.usage = *start.Message.Usage
+						}
+					}
+				case "message_delta":
+					data = withInputUsage(data, message.usage)
+				}
+				data = data.Clone()
+				_ = data.Set("id", message.id)
+				_ = data.Set("model", message.model)
+				if !drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{Data: data}) {
+					return
+				}
+			}
+			if err != nil {
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: err})
+				return
+			}
+		}
+	}()
+
+	return res, chunks, nil
+}
+
+// withInputUsage completes the usage of a message_delta event with the input
+// tokens reported by message_start
+func withInputUsage(event styles.PartialJSON, start styles.AnthropicUsage) styles.PartialJSON {
+	var usage styles.AnthropicUsage
+	if json.Unmarshal(event["usage"], &usage) != nil {
+		return event
+	}
+	if usage.InputTokens == 0 {
+		usage.InputTokens = start.InputTokens
+	}
+	if usage.CacheCreationInputTokens == 0 {
+		usage.CacheCreationInputTokens = start.CacheCreationInputTokens
+	}
+	if usage.CacheReadInputTokens == 0 {
+		usage.CacheReadInputTokens = start.CacheReadInputTokens
+	}
+	res := event.Clone()
+	if err := res.Set("usage", usage); err != nil {
+		return event
+	}
+	return res
+}
+
+// streamError returns the upstream error of an error event
+func streamError(event styles.PartialJSON) error {
+	var payload struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(event["error"], &payload) == nil && payload.Message != "" {
+		return errs.Errorf(errs.ErrUpstream, "upstream stream error: %s: %s", payload.Type, payload.Message)
+	}
+	return errs.Errorf(errs.ErrUpstream, "upstream stream error: %s", string(event["error"]))
+}
+
+// ListModels lists the models of a Messages API provider
+type ListModels struct{}
+
+func (c *ListModels) DoListModels(p *services.ProviderService, r *http.Request) ([]drivers.ListModelsModel, error) {
+	targetUrl, err := p.EndpointURL("list_models", "/models")
+	if err != nil {
+		return nil, err
+	}
+	query := targetUrl.Query()
+	query.Set("limit", "1000")
+	targetUrl.RawQuery = query.Encode()
+	p.ApplyQuery(r, &targetUrl)
+
+	targetHeader := r.Header.Clone()
+	targetHeader.Del("Accept-Encoding")
+	req := &http.Request{
+		Method: "GET",
+		URL:    &targetUrl,
+		Header: targetHeader,
+	}
+	ctx := r.Context()
+	req = req.WithContext(ctx)
+	if err := authorize(p, "list_models", r, req); err != nil {
+		return nil, err
+	}
+
+	resp, err := p.HTTPClient().Do(req)
+	if err != nil {
+		return nil, services.UpstreamError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, services.UpstreamError(ctx, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &errs.StatusError{Status: resp.StatusCode, Body: string(data), Header: resp.Header}
+	}
+
+	var result struct {
+		Data []struct {
+			ID          string `json:"id"`
+			DisplayName string `json:"display_name"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("%s; data: %s", err, string(data))
+	}
+
+	models := make([]drivers.ListModelsModel, 0, len(result.Data))
+	for _, m := range result.Data {
+		models = append(models, drivers.ListModelsModel{
+			Object:  "model",
+			ID:      m.ID,
+			Name:    m.DisplayName,
+			OwnedBy: "anthropic",
+		})
+	}
+	return models, nil
+}
+
+var (
+	_ drivers.InferenceCommand  = (*Inference)(nil)
+	_ drivers.ListModelsCommand = (*ListModels)(nil)
+)
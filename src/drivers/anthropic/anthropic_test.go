@@ -0,0 +1,71 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestInference_Stream(t *testing.T) {
+	var path, key, auth, version string
+	var body map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		key, auth, version = r.Header.Get("x-api-key"), r.Header.Get("Authorization"), r.Header.Get("anthropic-version")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"type": "message_start", "message": {"id": "msg_1", "model": "claude-sonnet-4-5", "usage": {"input_tokens": 12, "output_tokens": 1}}}`,
+			`{"type": "ping"}`,
+			`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hi"}}`,
+			`{"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 3}}`,
+			`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/v1")
+	p := &services.ProviderService{Name: "anthropic", ParsedURL: *u, Style: styles.StyleAnthropic, APIKey: "secret"}
+
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "claude-sonnet-4-5", "max_tokens": 100, "messages": [{"role": "user", "content": [{"type": "text", "text": "Hi"}]}]}`))
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "Bearer router-key")
+	_, chunks, err := (&Inference{}).DoInferenceStream(p, req, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []styles.PartialJSON
+	var streamErr error
+	for chunk := range chunks {
+		if chunk.RuntimeError != nil {
+			streamErr = chunk.RuntimeError
+			continue
+		}
+		events = append(events, chunk.Data)
+	}
+
+	if path != "/v1/messages" || string(body["stream"]) != "true" {
+		t.Errorf("upstream path = %s, stream = %s", path, body["stream"])
+	}
+	if key != "secret" || auth != "" || version != DefaultVersion {
+		t.Errorf("expected only the provider key and the default version upstream, got key %q, Authorization %q, version %q", key, auth, version)
+	}
+	if len(events) != 3 || streamErr == nil {
+		t.Fatalf("got %d events and error %v, want 3 events and the upstream error", len(events), streamErr)
+	}
+	if id := styles.TryGetFromPartialJSON[string](events[1], "id"); id != "msg_1" {
+		t.Errorf("expected events to carry the message id, got %q", id)
+	}
+	var usage styles.AnthropicUsage
+	_ = json.Unmarshal(events[2]["usage"], &usage)
+	if usage.InputTokens != 12 || usage.OutputTokens != 3 {
+		t.Errorf("expected message_delta usage completed with the input tokens, got %+v", usage)
+	}
+}
@@ -0,0 +1,93 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// maxConsecutiveSkips is the number of malformed frames in a row after which
+// a stream is considered broken rather than noisy
+const maxConsecutiveSkips = 16
+
+// Process-wide totals of repaired stream data, see ChunkRepairStats
+var (
+	totalSplitChunks   atomic.Int64
+	totalSkippedFrames atomic.Int64
+)
+
+// ChunkRepairStats returns how many concatenated chunks were split apart and
+// how many malformed frames were skipped by all ChunkDecoders so far
+func ChunkRepairStats() (split, skipped int64) {
+	return totalSplitChunks.Load(), totalSkippedFrames.Load()
+}
+
+// ChunkDecoder parses the data of upstream stream events tolerantly: an event
+// holding several concatenated JSON objects yields each of them, and
+// malformed frames are skipped instead of failing the stream. Use one decoder
+// per stream.
+type ChunkDecoder struct {
+	// Split counts chunks recovered from events holding more than one object
+	Split int
+	// Skipped counts malformed frames that were dropped
+	Skipped int
+
+	consecutiveSkips int
+}
+
+// Decode returns the JSON objects found in an event's data. It fails only
+// once too many malformed frames were seen in a row.
+func (d *ChunkDecoder) Decode(data []byte) ([]styles.PartialJSON, error) {
+	var chunks []styles.PartialJSON
+	rest := bytes.TrimSpace(data)
+	for len(rest) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(rest))
+		var chunk styles.PartialJSON
+		if err := dec.Decode(&chunk); err == nil && chunk != nil {
+			chunks = append(chunks, chunk)
+			d.consecutiveSkips = 0
+			rest = bytes.TrimSpace(rest[dec.InputOffset():])
+			continue
+		}
+
+		d.Skipped++
+		totalSkippedFrames.Add(1)
+		d.consecutiveSkips++
+		if d.consecutiveSkips > maxConsecutiveSkips {
+			return chunks, errs.Errorf(errs.ErrUpstream, "stream: %d malformed chunks in a row", d.consecutiveSkips)
+		}
+		next := nextFrameStart(rest)
+		if next < 0 {
+			break
+		}
+		rest = rest[next:]
+	}
+	if len(chunks) > 1 {
+		d.Split += len(chunks) - 1
+		totalSplitChunks.Add(int64(len(chunks) - 1))
+	}
+	return chunks, nil
+}
+
+// nextFrameStart returns the offset of the next '{' that can start a new
+// object: one following a '}' or a line break, as between concatenated
+// chunks. Braces nested in a broken object follow ':' or ',' and are skipped.
+func nextFrameStart(data []byte) int {
+	for i := 1; i < len(data); i++ {
+		if data[i] != '{' {
+			continue
+		}
+		prev := bytes.TrimRight(data[:i], " \t")
+		if len(prev) == 0 {
+			continue
+		}
+		switch prev[len(prev)-1] {
+		case '}', '\n', '\r':
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,71 @@
+package drivers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func chunkIDs(chunks []styles.PartialJSON) string {
+	var ids []string
+	for _, c := range chunks {
+		ids = append(ids, styles.TryGetFromPartialJSON[string](c, "id"))
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestChunkDecoder_Repairs(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		split   int
+		skipped int
+	}{
+		{"single", `{"id":"a"}`, "a", 0, 0},
+		{"concatenated", `{"id":"a"}{"id":"b"} {"id":"c"}`, "a,b,c", 2, 0},
+		{"newline separated", "{\"id\":\"a\"}\n{\"id\":\"b\"}", "a,b", 1, 0},
+		{"truncated then valid", "{\"id\":\"a\",\"x\":{\"id\":\"nested\"}\n{\"id\":\"b\"}", "b", 0, 1},
+		{"garbage", `not json`, "", 0, 1},
+		{"broken between valid", `{"id":"a"}{"id":}{"id":"b"}`, "a,b", 1, 1},
+	}
+	for _, tt := range tests {
+		var d ChunkDecoder
+		chunks, err := d.Decode([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if got := chunkIDs(chunks); got != tt.want {
+			t.Errorf("%s: chunks = %q, want %q", tt.name, got, tt.want)
+		}
+		if d.Split != tt.split || d.Skipped != tt.skipped {
+			t.Errorf("%s: split=%d skipped=%d, want %d and %d", tt.name, d.Split, d.Skipped, tt.split, tt.skipped)
+		}
+	}
+}
+
+func TestChunkDecoder_GivesUpOnBrokenStreams(t *testing.T) {
+	var d ChunkDecoder
+	var err error
+	for i := 0; i <= maxConsecutiveSkips && err == nil; i++ {
+		_, err = d.Decode([]byte("<html>"))
+	}
+	if !errors.Is(err, errs.ErrUpstream) {
+		t.Errorf("expected ErrUpstream after %d malformed frames, got %v", maxConsecutiveSkips+1, err)
+	}
+
+	// A valid frame resets the run
+	d = ChunkDecoder{}
+	for range maxConsecutiveSkips {
+		_, _ = d.Decode([]byte("<html>"))
+	}
+	if _, err := d.Decode([]byte(`{"id":"a"}`)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := d.Decode([]byte("<html>")); err != nil {
+		t.Errorf("expected the run of malformed frames to restart, got %v", err)
+	}
+}
@@ -0,0 +1,311 @@
+// Package gemini implements the commands of providers speaking Google's
+// Gemini API (generateContent and streamGenerateContent).
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Logger for debug output (set by module during Provision)
+var Logger *zap.Logger = zap.NewNop()
+
+// logURL returns an upstream URL for logs, without its query
+func logURL(u *url.URL) string {
+	redacted := *u
+	redacted.RawQuery = ""
+	return redacted.Redacted()
+}
+
+// modelPath returns the path of a model's method, e.g.
+// /models/gemini-1.5-pro:generateContent
+func modelPath(model, method string) string {
+	return "/models/" + url.PathEscape(strings.TrimPrefix(model, "models/")) + ":" + method
+}
+
+// authorize sets the provider's API key on an upstream request. The client's
+// credentials are for the router and never forwarded.
+func authorize(p *services.ProviderService, scope string, r, httpReq *http.Request) error {
+	httpReq.Header.Del("Authorization")
+	authVal, err := p.CollectTargetAuth(scope, r, httpReq)
+	if err != nil {
+		return errs.Wrap(errs.ErrAuth, err)
+	}
+	if authVal != "" {
+		httpReq.Header.Set("x-goog-api-key", authVal)
+	}
+	p.ApplyRequestHeaders(r, httpReq)
+	return nil
+}
+
+// Inference implements InferenceCommand for the Gemini API. Requests arrive
+// converted to a generateContent body that still carries the model.
+type Inference struct{}
+
+func (c *Inference) createRequest(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request, method string) (*http.Request, context.CancelFunc, error) {
+	model := p.UpstreamModel(styles.TryGetFromPartialJSON[string](reqJson, "model"))
+	if model == "" {
+		return nil, nil, errs.Errorf(errs.ErrInvalidRequest, "gemini: request without a model")
+	}
+	targetUrl, err := p.EndpointURL("inference", modelPath(model, method))
+	if err != nil {
+		return nil, nil, err
+	}
+	p.ApplyQuery(r, &targetUrl)
+
+	body := reqJson.Clone()
+	delete(body, "model")
+	reqBody, err := body.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetHeader := r.Header.Clone()
+	targetHeader.Del("Accept-Encoding")
+	targetHeader.Set("Content-Type", "application/json")
+
+	httpReq := &http.Request{
+		Method:        "POST",
+		URL:           &targetUrl,
+		Header:        targetHeader,
+		Body:          io.NopCloser(bytes.NewReader(reqBody)),
+		ContentLength: int64(len(reqBody)),
+	}
+	ctx, cancel := p.WithUpstreamTimeout(r.Context())
+	httpReq = httpReq.WithContext(ctx)
+
+	if err := authorize(p, "inference", r, httpReq); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return httpReq, cancel, nil
+}
+
+// DoInference implements InferenceCommand with generateContent
+func (c *Inference) DoInference(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	httpReq, cancel, err := c.createRequest(p, reqJson, r, "generateContent")
+	if err != nil {
+		Logger.Error("DoInference (gemini) createRequest failed", zap.Error(err))
+		return nil, nil, err
+	}
+	ctx := httpReq.Context()
+	defer cancel()
+
+	Logger.Debug("DoInference (gemini) sending request",
+		zap.String("provider", p.Name),
+		zap.String("url", logURL(httpReq.URL)))
+
+	res, err := p.HTTPClient().Do(httpReq)
+	if err != nil {
+		Logger.Error("DoInference (gemini) HTTP request failed", zap.Error(err))
+		return nil, nil, services.UpstreamError(ctx, err)
+	}
+	defer res.Body.Close()
+
+	p.ObserveRateLimit(httpReq.Header.Get("x-goog-api-key"), res)
+
+	respData, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		Logger.Error("DoInference (gemini) non-200 response",
+			zap.Int("status", res.StatusCode),
+			zap.String("body", string(respData)))
+		return res, nil, &errs.StatusError{Status: res.StatusCode, Body: string(respData), Header: res.Header}
+	}
+
+	respJson, err := styles.ParsePartialJSON(respData)
+	if err != nil {
+		Logger.Error("DoInference (gemini) response JSON parse failed", zap.Error(err))
+		return res, nil, errs.Wrap(errs.ErrUpstream, err)
+	}
+	return res, respJson, nil
+}
+
+// DoInferenceStream implements InferenceCommand with streamGenerateContent,
+// whose chunks are generateContent responses sent as SSE
+func (c *Inference) DoInferenceStream(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, chan drivers.InferenceStreamChunk, error) {
+	httpReq, cancel, err := c.createRequest(p, reqJson, r, "streamGenerateContent")
+	if err != nil {
+		Logger.Error("DoInferenceStream (gemini) createRequest failed", zap.Error(err))
+		return nil, nil, err
+	}
+	ctx := httpReq.Context()
+	received := p.AwaitFirstToken(ctx)
+	query := httpReq.URL.Query()
+	query.Set("alt", "sse")
+	httpReq.URL.RawQuery = query.Encode()
+
+	Logger.Debug("DoInferenceStream (gemini) sending request",
+		zap.String("provider", p.Name),
+		zap.String("url", logURL(httpReq.URL)))
+
+	res, err := p.HTTPClient().Do(httpReq)
+	if err != nil {
+		cancel()
+		Logger.Error("DoInferenceStream (gemini) HTTP request failed", zap.Error(err))
+		return nil, nil, services.UpstreamError(ctx, err)
+	}
+
+	p.ObserveRateLimit(httpReq.Header.Get("x-goog-api-key"), res)
+
+	// Fail before the stream starts so the router can fall back to another provider
+	if res.StatusCode != http.StatusOK {
+		respData, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		cancel()
+		Logger.Error("DoInferenceStream (gemini) non-200 response",
+			zap.Int("status", res.StatusCode),
+			zap.String("body", string(respData)))
+		return res, nil, &errs.StatusError{Status: res.StatusCode, Body: string(respData), Header: res.Header}
+	}
+
+	services.TrackUpstreamStream(res)
+	chunks := make(chan drivers.InferenceStreamChunk)
+
+	go func() {
+		defer close(chunks)
+		defer services.TrackStreamGoroutine()()
+		defer cancel()
+		defer res.Body.Close()
+
+		var decoder drivers.ChunkDecoder
+		defer func() {
+			if decoder.Split > 0 || decoder.Skipped > 0 {
+				Logger.Warn("DoInferenceStream (gemini) repaired malformed stream chunks",
+					zap.String("provider", p.Name),
+					zap.Int("split", decoder.Split),
+					zap.Int("skipped", decoder.Skipped))
+			}
+		}()
+
+		reader := sse.NewDefaultReader(res.Body)
+		for event := range reader.ReadEvents() {
+			received()
+			if event.Error != nil {
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: services.UpstreamError(ctx, event.Error)})
+				return
+			}
+			if event.Done {
+				return
+			}
+			if event.Data == nil {
+				continue
+			}
+			decoded, err := decoder.Decode(event.Data)
+			for _, jsonData := range decoded {
+				if err := streamError(jsonData); err != nil {
+					drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: err})
+					return
+				}
+				if !drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{Data: jsonData}) {
+					return
+				}
+			}
+			if err != nil {
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: err})
+				return
+			}
+		}
+	}()
+
+	return res, chunks, nil
+}
+
+// streamError returns the upstream error a stream chunk carries, if any
+func streamError(chunk styles.PartialJSON) error {
+	raw, ok := chunk["error"]
+	if !ok {
+		return nil
+	}
+	var payload struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(raw, &payload) == nil && payload.Message != "" {
+		return errs.Errorf(errs.ErrUpstream, "upstream stream error: %s", payload.Message)
+	}
+	return errs.Errorf(errs.ErrUpstream, "upstream stream error: %s", string(raw))
+}
+
+// ListModels lists the models of a Gemini API provider that generate content
+type ListModels struct{}
+
+func (c *ListModels) DoListModels(p *services.ProviderService, r *http.Request) ([]drivers.ListModelsModel, error) {
+	targetUrl, err := p.EndpointURL("list_models", "/models")
+	if err != nil {
+		return nil, err
+	}
+	p.ApplyQuery(r, &targetUrl)
+
+	targetHeader := r.Header.Clone()
+	targetHeader.Del("Accept-Encoding")
+	req := &http.Request{
+		Method: "GET",
+		URL:    &targetUrl,
+		Header: targetHeader,
+	}
+	ctx := r.Context()
+	req = req.WithContext(ctx)
+	if err := authorize(p, "list_models", r, req); err != nil {
+		return nil, err
+	}
+
+	resp, err := p.HTTPClient().Do(req)
+	if err != nil {
+		return nil, services.UpstreamError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, services.UpstreamError(ctx, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &errs.StatusError{Status: resp.StatusCode, Body: string(data), Header: resp.Header}
+	}
+
+	var result struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			DisplayName                string   `json:"displayName"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("%s; data: %s", err, string(data))
+	}
+
+	var models []drivers.ListModelsModel
+	for _, m := range result.Models {
+		generates := len(m.SupportedGenerationMethods) == 0
+		for _, method := range m.SupportedGenerationMethods {
+			generates = generates || method == "generateContent"
+		}
+		if !generates {
+			continue
+		}
+		models = append(models, drivers.ListModelsModel{
+			Object:  "model",
+			ID:      strings.TrimPrefix(m.Name, "models/"),
+			Name:    m.DisplayName,
+			OwnedBy: "google",
+		})
+	}
+	return models, nil
+}
+
+var (
+	_ drivers.InferenceCommand  = (*Inference)(nil)
+	_ drivers.ListModelsCommand = (*ListModels)(nil)
+)
@@ -0,0 +1,137 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestInference_Stream(t *testing.T) {
+	var path, query, key, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.RawQuery
+		key, auth = r.Header.Get("x-goog-api-key"), r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, text := range []string{"Hel", "lo"} {
+			fmt.Fprintf(w, "data: {\"candidates\": [{\"content\": {\"role\": \"model\", \"parts\": [{\"text\": %q}]}}]}\n\n", text)
+		}
+		fmt.Fprint(w, "data: {\"error\": {\"code\": 500, \"message\": \"overloaded\"}}\n\n")
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/v1beta")
+	p := &services.ProviderService{Name: "gemini", ParsedURL: *u, Style: styles.StyleGoogleGenAI, APIKey: "secret"}
+
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "gemini-1.5-pro", "contents": [{"role": "user", "parts": [{"text": "Hi"}]}]}`))
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "Bearer router-key")
+	_, chunks, err := (&Inference{}).DoInferenceStream(p, req, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts int
+	var streamErr error
+	for chunk := range chunks {
+		if chunk.RuntimeError != nil {
+			streamErr = chunk.RuntimeError
+			continue
+		}
+		texts++
+	}
+
+	if path != "/v1beta/models/gemini-1.5-pro:streamGenerateContent" || query != "alt=sse" {
+		t.Errorf("upstream URL = %s?%s", path, query)
+	}
+	if key != "secret" || auth != "" {
+		t.Errorf("expected only the provider key upstream, got key %q and Authorization %q", key, auth)
+	}
+	if texts != 2 || streamErr == nil {
+		t.Errorf("got %d chunks and error %v, want 2 chunks and the upstream error", texts, streamErr)
+	}
+}
+
+func TestInference_StreamFirstTokenTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/v1beta")
+	p := &services.ProviderService{
+		Name:      "gemini",
+		ParsedURL: *u,
+		Style:     styles.StyleGoogleGenAI,
+		Timeouts:  &services.ProviderTimeouts{FirstToken: caddy.Duration(50 * time.Millisecond)},
+	}
+
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "gemini-1.5-pro", "contents": [{"role": "user", "parts": [{"text": "Hi"}]}]}`))
+	_, chunks, err := (&Inference{}).DoInferenceStream(p, req, httptest.NewRequest(http.MethodPost, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamErr error
+	for chunk := range chunks {
+		streamErr = chunk.RuntimeError
+	}
+	if !errors.Is(streamErr, services.ErrFirstTokenTimeout) || !errors.Is(streamErr, errs.ErrTimeout) {
+		t.Errorf("expected the stream to end with a first token timeout, got %v", streamErr)
+	}
+}
+
+func TestInference_StreamAbandonedDoesNotLeak(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for {
+			fmt.Fprint(w, "data: {\"candidates\": [{\"content\": {\"role\": \"model\", \"parts\": [{\"text\": \"la\"}]}}]}\n\n")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/v1beta")
+	p := &services.ProviderService{Name: "gemini", ParsedURL: *u, Style: styles.StyleGoogleGenAI}
+
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "gemini-1.5-pro", "contents": [{"role": "user", "parts": [{"text": "Hi"}]}]}`))
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+	_, chunks, err := (&Inference{}).DoInferenceStream(p, req, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-chunks
+	if g := services.ReadStreamGauges(); g.UpstreamStreams != 1 || g.StreamGoroutines != 1 {
+		t.Fatalf("expected the stream counted while open, got %+v", g)
+	}
+
+	// The client goes away and nobody reads the stream anymore
+	cancel()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		g := services.ReadStreamGauges()
+		if g.UpstreamStreams == 0 && g.StreamGoroutines == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("abandoned stream leaked: %+v", g)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
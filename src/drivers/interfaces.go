@@ -2,7 +2,9 @@
 package drivers
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/neutrome-labs/open-ai-router/src/services"
 	"github.com/neutrome-labs/open-ai-router/src/styles"
@@ -22,6 +24,11 @@ type ListModelsCommand interface {
 	DoListModels(p *services.ProviderService, r *http.Request) ([]ListModelsModel, error)
 }
 
+// EmbeddingsCommand creates embeddings with a provider
+type EmbeddingsCommand interface {
+	DoEmbeddings(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error)
+}
+
 // InferenceStreamChunk represents a streaming response chunk
 type InferenceStreamChunk struct {
 	Data         styles.PartialJSON
@@ -38,3 +45,39 @@ type InferenceCommand interface {
 	// DoInferenceStream sends a streaming inference request
 	DoInferenceStream(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, chan InferenceStreamChunk, error)
 }
+
+// AbandonStream stops consuming a stream early: the upstream body is closed so the
+// driver stops reading, and remaining chunks are drained so its goroutine can exit.
+func AbandonStream(res *http.Response, stream chan InferenceStreamChunk) {
+	if res != nil && res.Body != nil {
+		_ = res.Body.Close()
+	}
+	go func() {
+		for range stream {
+		}
+	}()
+}
+
+// abandonedStreamGrace is how long a chunk still waits for the consumer once
+// the stream's context is done, e.g. to deliver the timeout that ended it
+const abandonedStreamGrace = time.Second
+
+// SendChunk sends a chunk to the consumer of a stream. Once ctx is done it
+// gives up after a short grace, so drivers don't block forever on consumers
+// that stopped reading; it reports whether the chunk was sent, and drivers
+// stop streaming when it wasn't.
+func SendChunk(ctx context.Context, chunks chan<- InferenceStreamChunk, chunk InferenceStreamChunk) bool {
+	select {
+	case chunks <- chunk:
+		return true
+	case <-ctx.Done():
+	}
+	grace := time.NewTimer(abandonedStreamGrace)
+	defer grace.Stop()
+	select {
+	case chunks <- chunk:
+		return true
+	case <-grace.C:
+		return false
+	}
+}
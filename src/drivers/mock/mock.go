@@ -0,0 +1,312 @@
+// Package mock provides a built-in provider driver that returns canned or
+// scripted responses without calling any upstream API. It is intended for
+// integration-testing routing, fallback and plugins in CI and staging.
+package mock
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/google/uuid"
+	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Logger for mock driver - can be set by modules
+var Logger *zap.Logger = zap.NewNop()
+
+// DefaultResponse is returned when no responses are configured
+const DefaultResponse = "This is a mock response."
+
+// Config describes how a mock provider behaves.
+type Config struct {
+	// Responses are returned in order, cycling when exhausted
+	Responses []string `json:"responses,omitempty"`
+	// Models are reported by list_models (defaults to "mock")
+	Models []string `json:"models,omitempty"`
+	// Latency is applied before the first byte of every response
+	Latency caddy.Duration `json:"latency,omitempty"`
+	// FailureRate is the probability (0..1) that a request fails
+	FailureRate float64 `json:"failure_rate,omitempty"`
+	// FailureStatus is the HTTP status reported for injected failures (defaults to 500)
+	FailureStatus int `json:"failure_status,omitempty"`
+	// ChunkSize is the number of characters per streamed chunk (0 streams word by word)
+	ChunkSize int `json:"chunk_size,omitempty"`
+	// ChunkDelay is the pause between streamed chunks
+	ChunkDelay caddy.Duration `json:"chunk_delay,omitempty"`
+}
+
+// Inference implements InferenceCommand with canned responses in Chat Completions format
+type Inference struct {
+	Config *Config
+	served atomic.Uint64
+}
+
+// nextResponse returns the next scripted response
+func (c *Inference) nextResponse() string {
+	if c.Config == nil || len(c.Config.Responses) == 0 {
+		return DefaultResponse
+	}
+	n := c.served.Add(1) - 1
+	return c.Config.Responses[n%uint64(len(c.Config.Responses))]
+}
+
+// wait sleeps for d unless the request context is cancelled first
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// injectFailure rolls the configured failure rate and returns a synthetic error response
+func (c *Inference) injectFailure() (*http.Response, error) {
+	if c.Config == nil || c.Config.FailureRate <= 0 || rand.Float64() >= c.Config.FailureRate {
+		return nil, nil
+	}
+	status := c.Config.FailureStatus
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	res := &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     make(http.Header),
+	}
+	return res, &errs.StatusError{
+		Status: status,
+		Body:   fmt.Sprintf(`{"error":{"message":"mock failure injected","type":"mock_error","code":%d}}`, status),
+		Header: res.Header,
+	}
+}
+
+// okResponse builds the synthetic HTTP response returned alongside successful results
+func okResponse(contentType string) *http.Response {
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     make(http.Header),
+	}
+	res.Header.Set("Content-Type", contentType)
+	return res
+}
+
+// estimateTokens approximates token counts (~4 chars per token)
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+func promptTokens(reqJson styles.PartialJSON) int {
+	raw, ok := reqJson["messages"]
+	if !ok {
+		return 0
+	}
+	return estimateTokens(string(raw))
+}
+
+// splitChunks splits content according to the configured chunk schedule
+func (c *Inference) splitChunks(content string) []string {
+	size := 0
+	if c.Config != nil {
+		size = c.Config.ChunkSize
+	}
+
+	var parts []string
+	if size <= 0 {
+		words := strings.SplitAfter(content, " ")
+		for _, w := range words {
+			if w != "" {
+				parts = append(parts, w)
+			}
+		}
+		return parts
+	}
+
+	runes := []rune(content)
+	for len(runes) > 0 {
+		n := min(size, len(runes))
+		parts = append(parts, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return parts
+}
+
+// DoInference implements InferenceCommand for the mock provider
+func (c *Inference) DoInference(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	model := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	Logger.Debug("DoInference (mock) starting",
+		zap.String("provider", p.Name),
+		zap.String("model", model))
+
+	if c.Config != nil {
+		if err := wait(r.Context(), time.Duration(c.Config.Latency)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if res, err := c.injectFailure(); err != nil {
+		Logger.Debug("DoInference (mock) injected failure", zap.Int("status", res.StatusCode))
+		return res, nil, err
+	}
+
+	content := c.nextResponse()
+	pt := promptTokens(reqJson)
+	ct := estimateTokens(content)
+
+	resJson, err := styles.PartiallyMarshalJSON(styles.ChatCompletionsResponse{
+		ID:      "chatcmpl-mock-" + uuid.New().String(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []styles.ChatCompletionsChoice{{
+			Index: 0,
+			Message: &styles.ChatCompletionsMessage{
+				Role:    "assistant",
+				Content: content,
+			},
+			FinishReason: "stop",
+		}},
+		Usage: &styles.ChatCompletionsUsage{
+			PromptTokens:     pt,
+			CompletionTokens: ct,
+			TotalTokens:      pt + ct,
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return okResponse("application/json"), resJson, nil
+}
+
+// DoInferenceStream implements InferenceCommand for streaming mock responses
+func (c *Inference) DoInferenceStream(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, chan drivers.InferenceStreamChunk, error) {
+	model := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	Logger.Debug("DoInferenceStream (mock) starting",
+		zap.String("provider", p.Name),
+		zap.String("model", model))
+
+	ctx := r.Context()
+	if c.Config != nil {
+		if err := wait(ctx, time.Duration(c.Config.Latency)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if res, err := c.injectFailure(); err != nil {
+		Logger.Debug("DoInferenceStream (mock) injected failure", zap.Int("status", res.StatusCode))
+		return res, nil, err
+	}
+
+	content := c.nextResponse()
+	id := "chatcmpl-mock-" + uuid.New().String()
+	created := time.Now().Unix()
+	pt := promptTokens(reqJson)
+	ct := estimateTokens(content)
+
+	var delay time.Duration
+	if c.Config != nil {
+		delay = time.Duration(c.Config.ChunkDelay)
+	}
+
+	build := func(delta *styles.ChatCompletionsMessage, finishReason string, usage *styles.ChatCompletionsUsage) (styles.PartialJSON, error) {
+		return styles.PartiallyMarshalJSON(styles.ChatCompletionsResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []styles.ChatCompletionsChoice{{
+				Index:        0,
+				Delta:        delta,
+				FinishReason: finishReason,
+			}},
+			Usage: usage,
+		})
+	}
+
+	chunks := make(chan drivers.InferenceStreamChunk)
+
+	go func() {
+		defer close(chunks)
+		defer services.TrackStreamGoroutine()()
+
+		send := func(chunk styles.PartialJSON, err error) bool {
+			if err != nil {
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: err})
+				return false
+			}
+			select {
+			case chunks <- drivers.InferenceStreamChunk{Data: chunk}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if !send(build(&styles.ChatCompletionsMessage{Role: "assistant"}, "", nil)) {
+			return
+		}
+
+		for _, part := range c.splitChunks(content) {
+			if err := wait(ctx, delay); err != nil {
+				return
+			}
+			if !send(build(&styles.ChatCompletionsMessage{Content: part}, "", nil)) {
+				return
+			}
+		}
+
+		send(build(&styles.ChatCompletionsMessage{}, "stop", &styles.ChatCompletionsUsage{
+			PromptTokens:     pt,
+			CompletionTokens: ct,
+			TotalTokens:      pt + ct,
+		}))
+	}()
+
+	return okResponse("text/event-stream"), chunks, nil
+}
+
+// ListModels implements ListModelsCommand for mock providers
+type ListModels struct {
+	Config *Config
+}
+
+// DoListModels returns the configured mock models
+func (c *ListModels) DoListModels(p *services.ProviderService, r *http.Request) ([]drivers.ListModelsModel, error) {
+	names := []string{"mock"}
+	if c.Config != nil && len(c.Config.Models) > 0 {
+		names = c.Config.Models
+	}
+
+	models := make([]drivers.ListModelsModel, 0, len(names))
+	for _, name := range names {
+		models = append(models, drivers.ListModelsModel{
+			Object:  "model",
+			ID:      name,
+			Name:    name,
+			OwnedBy: p.Name,
+		})
+	}
+	return models, nil
+}
+
+var (
+	_ drivers.InferenceCommand  = (*Inference)(nil)
+	_ drivers.ListModelsCommand = (*ListModels)(nil)
+)
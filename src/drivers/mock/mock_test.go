@@ -0,0 +1,90 @@
+package mock
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestMockInference_ScriptedResponses(t *testing.T) {
+	cmd := &Inference{Config: &Config{Responses: []string{"first", "second"}}}
+	provider := &services.ProviderService{Name: "mock"}
+	reqJson, _ := styles.ParsePartialJSON([]byte(`{"model":"mock","messages":[{"role":"user","content":"hi"}]}`))
+
+	for _, want := range []string{"first", "second", "first"} {
+		res, resJson, err := cmd.DoInference(provider, reqJson, httptest.NewRequest("POST", "/", nil))
+		if err != nil {
+			t.Fatalf("DoInference failed: %v", err)
+		}
+		if res.StatusCode != 200 {
+			t.Fatalf("Expected status 200, got %d", res.StatusCode)
+		}
+		resp, err := styles.ParseChatCompletionsResponse(resJson)
+		if err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if got := resp.Choices[0].Message.Content; got != want {
+			t.Errorf("Content = %v, want %q", got, want)
+		}
+		if resp.Model != "mock" {
+			t.Errorf("Model = %q, want %q", resp.Model, "mock")
+		}
+	}
+}
+
+func TestMockInference_FailureInjection(t *testing.T) {
+	cmd := &Inference{Config: &Config{FailureRate: 1, FailureStatus: 429}}
+	provider := &services.ProviderService{Name: "mock"}
+	reqJson, _ := styles.ParsePartialJSON([]byte(`{"model":"mock"}`))
+
+	res, resJson, err := cmd.DoInference(provider, reqJson, httptest.NewRequest("POST", "/", nil))
+	if err == nil {
+		t.Fatal("Expected injected failure")
+	}
+	if res == nil || res.StatusCode != 429 {
+		t.Errorf("Expected status 429, got %v", res)
+	}
+	if resJson != nil {
+		t.Errorf("Expected no response body, got %v", resJson)
+	}
+}
+
+func TestMockInference_StreamChunkSchedule(t *testing.T) {
+	cmd := &Inference{Config: &Config{Responses: []string{"abcdefg"}, ChunkSize: 3}}
+	provider := &services.ProviderService{Name: "mock"}
+	reqJson, _ := styles.ParsePartialJSON([]byte(`{"model":"mock","stream":true}`))
+
+	_, stream, err := cmd.DoInferenceStream(provider, reqJson, httptest.NewRequest("POST", "/", nil))
+	if err != nil {
+		t.Fatalf("DoInferenceStream failed: %v", err)
+	}
+
+	var parts []string
+	var finishReason string
+	for chunk := range stream {
+		if chunk.RuntimeError != nil {
+			t.Fatalf("Unexpected runtime error: %v", chunk.RuntimeError)
+		}
+		resp, err := styles.ParseChatCompletionsResponse(chunk.Data)
+		if err != nil {
+			t.Fatalf("Failed to parse chunk: %v", err)
+		}
+		choice := resp.Choices[0]
+		if s, ok := choice.Delta.Content.(string); ok && s != "" {
+			parts = append(parts, s)
+		}
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+	}
+
+	if strings.Join(parts, "|") != "abc|def|g" {
+		t.Errorf("Chunks = %v, want [abc def g]", parts)
+	}
+	if finishReason != "stop" {
+		t.Errorf("Finish reason = %q, want stop", finishReason)
+	}
+}
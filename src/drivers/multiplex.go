@@ -0,0 +1,194 @@
+package drivers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// StreamSource is one of the Chat Completions streams joined by
+// MultiplexStreams
+type StreamSource struct {
+	Res    *http.Response
+	Stream chan InferenceStreamChunk
+	// Offset is added to the index of the source's choices, so that the
+	// choices of all sources are distinct
+	Offset int
+}
+
+// MultiplexStreams joins Chat Completions streams answering parts of one
+// request into a single stream, interleaving chunks as they arrive. Choices
+// are reindexed by their source's offset, so each keeps its own deltas and
+// finish event, and every chunk takes the completion ID of the first one.
+// Usage is held back and summed into a final chunk without choices. A
+// failing source fails the joined stream and abandons the others.
+//
+// The returned response carries the first source's status and headers;
+// closing its body closes every source.
+func MultiplexStreams(sources []StreamSource) (*http.Response, chan InferenceStreamChunk) {
+	res := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	if len(sources) > 0 && sources[0].Res != nil {
+		first := *sources[0].Res
+		res = &first
+	}
+	bodies := make(multiCloser, 0, len(sources))
+	for _, s := range sources {
+		if s.Res != nil && s.Res.Body != nil {
+			bodies = append(bodies, s.Res.Body)
+		}
+	}
+	res.Body = &bodies
+
+	out := make(chan InferenceStreamChunk)
+	m := &multiplexer{out: out, done: make(chan struct{})}
+	var wg sync.WaitGroup
+	for _, s := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer services.TrackStreamGoroutine()()
+			m.forward(s)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		if m.failed {
+			_ = bodies.Close()
+		} else if final := m.usageChunk(); final != nil {
+			out <- InferenceStreamChunk{Data: final}
+		}
+		close(out)
+	}()
+	return res, out
+}
+
+// multiplexer holds the state shared by the sources of a joined stream
+type multiplexer struct {
+	out chan InferenceStreamChunk
+	// done is closed once a source failed, so the others stop sending
+	done chan struct{}
+
+	mu       sync.Mutex
+	failed   bool
+	id       json.RawMessage
+	last     styles.PartialJSON
+	usage    styles.ChatCompletionsUsage
+	hasUsage bool
+}
+
+// forward sends the chunks of a source to the joined stream
+func (m *multiplexer) forward(s StreamSource) {
+	for chunk := range s.Stream {
+		if chunk.RuntimeError != nil {
+			m.fail(chunk.RuntimeError)
+			continue
+		}
+		data := m.rewrite(chunk.Data, s.Offset)
+		if data == nil {
+			continue
+		}
+		select {
+		case m.out <- InferenceStreamChunk{Data: data}:
+		case <-m.done:
+		}
+	}
+}
+
+// fail ends the joined stream with the first error of a source
+func (m *multiplexer) fail(err error) {
+	m.mu.Lock()
+	first := !m.failed
+	m.failed = true
+	m.mu.Unlock()
+	if !first {
+		return
+	}
+	m.out <- InferenceStreamChunk{RuntimeError: err}
+	close(m.done)
+}
+
+// rewrite reindexes a chunk's choices and takes its usage, returning nil
+// for chunks left with nothing to send
+func (m *multiplexer) rewrite(chunk styles.PartialJSON, offset int) styles.PartialJSON {
+	if chunk == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failed {
+		return nil
+	}
+	out := chunk.Clone()
+	if m.id == nil {
+		m.id = chunk["id"]
+	} else {
+		out["id"] = m.id
+	}
+	m.last = out
+
+	if raw, ok := out["usage"]; ok && string(raw) != "null" {
+		var usage styles.ChatCompletionsUsage
+		if json.Unmarshal(raw, &usage) == nil {
+			m.usage.Add(usage)
+			m.hasUsage = true
+		}
+		delete(out, "usage")
+	}
+
+	var choices []map[string]json.RawMessage
+	if json.Unmarshal(out["choices"], &choices) != nil || len(choices) == 0 {
+		// Usage-only chunks are folded into the final one
+		if _, ok := chunk["usage"]; ok {
+			return nil
+		}
+		return out
+	}
+	if offset != 0 {
+		for _, choice := range choices {
+			var index int
+			_ = json.Unmarshal(choice["index"], &index)
+			choice["index"], _ = json.Marshal(index + offset)
+		}
+		if err := out.Set("choices", choices); err != nil {
+			return nil
+		}
+	}
+	return out
+}
+
+// usageChunk returns the final chunk carrying the summed usage, nil when no
+// source reported any
+func (m *multiplexer) usageChunk() styles.PartialJSON {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.hasUsage {
+		return nil
+	}
+	final := styles.PartialJSON{}
+	for _, key := range []string{"id", "object", "created", "model", "system_fingerprint"} {
+		if v, ok := m.last[key]; ok {
+			final[key] = v
+		}
+	}
+	_ = final.Set("choices", []any{})
+	_ = final.Set("usage", m.usage)
+	return final
+}
+
+// multiCloser closes several bodies as one
+type multiCloser []io.ReadCloser
+
+func (c *multiCloser) Read([]byte) (int, error) { return 0, io.EOF }
+
+func (c *multiCloser) Close() error {
+	var errs []error
+	for _, body := range *c {
+		errs = append(errs, body.Close())
+	}
+	return errors.Join(errs...)
+}
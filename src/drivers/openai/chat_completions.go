@@ -2,12 +2,14 @@ package openai
 
 import (
 	"bytes"
-	"fmt"
+	"context"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
 	"github.com/neutrome-labs/open-ai-router/src/services"
 	"github.com/neutrome-labs/open-ai-router/src/sse"
 	"github.com/neutrome-labs/open-ai-router/src/styles"
@@ -17,20 +19,40 @@ import (
 // Logger for OpenAI driver - can be set by modules
 var Logger *zap.Logger = zap.NewNop()
 
+// logURL renders an upstream URL for logs, without the query since configured
+// query parameters may hold credentials
+func logURL(u *url.URL) string {
+	redacted := *u
+	redacted.RawQuery = ""
+	return redacted.Redacted()
+}
+
 // ChatCompletions implements chat completions for OpenAI-compatible APIs
 type ChatCompletions struct{}
 
-func (c *ChatCompletions) createRequest(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request, endpoint string) (*http.Request, error) {
-	targetUrl := p.ParsedURL
-	targetUrl.Path += endpoint
+func (c *ChatCompletions) createRequest(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request, endpoint string) (*http.Request, context.CancelFunc, error) {
+	targetUrl, err := p.EndpointURL("inference", endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.ApplyQuery(r, &targetUrl)
+
+	reqJson, err = p.WithUpstreamModel(reqJson)
+	if err != nil {
+		return nil, nil, err
+	}
+	reqJson, err = compatRequest(p.Style, reqJson)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	targetHeader := r.Header.Clone()
 	targetHeader.Del("Accept-Encoding")
 	targetHeader.Set("Content-Type", "application/json")
 
-	reqBody, err := reqJson.Marshal()
+	reqBody, err := p.NormalizeRequest(reqJson).Marshal()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	httpReq := &http.Request{
@@ -40,17 +62,20 @@ func (c *ChatCompletions) createRequest(p *services.ProviderService, reqJson sty
 		Body:          io.NopCloser(bytes.NewReader(reqBody)),
 		ContentLength: int64(len(reqBody)),
 	}
-	httpReq = httpReq.WithContext(r.Context())
+	ctx, cancel := p.WithUpstreamTimeout(r.Context())
+	httpReq = httpReq.WithContext(ctx)
 
-	authVal, err := p.Router.Auth.CollectTargetAuth("chat_completions", p, r, httpReq)
+	authVal, err := p.CollectTargetAuth("chat_completions", r, httpReq)
 	if err != nil {
-		return nil, err
+		cancel()
+		return nil, nil, errs.Wrap(errs.ErrAuth, err)
 	}
 	if authVal != "" {
 		httpReq.Header.Set("Authorization", "Bearer "+authVal)
 	}
+	p.ApplyRequestHeaders(r, httpReq)
 
-	return httpReq, nil
+	return httpReq, cancel, nil
 }
 
 // DoInference implements InferenceCommand for OpenAI Chat Completions API
@@ -60,21 +85,25 @@ func (c *ChatCompletions) DoInference(p *services.ProviderService, reqJson style
 		zap.String("model", styles.TryGetFromPartialJSON[string](reqJson, "model")),
 		zap.String("base_url", p.ParsedURL.String()))
 
-	httpReq, err := c.createRequest(p, reqJson, r, "/chat/completions")
+	httpReq, cancel, err := c.createRequest(p, reqJson, r, "/chat/completions")
 	if err != nil {
 		Logger.Error("DoInference (chat_completions) createRequest failed", zap.Error(err))
 		return nil, nil, err
 	}
+	ctx := httpReq.Context()
+	defer cancel()
 
-	Logger.Debug("DoInference (chat_completions) sending request", zap.String("url", httpReq.URL.String()))
+	Logger.Debug("DoInference (chat_completions) sending request", zap.String("url", logURL(httpReq.URL)))
 
-	res, err := http.DefaultClient.Do(httpReq)
+	res, err := p.HTTPClient().Do(httpReq)
 	if err != nil {
 		Logger.Error("DoInference (chat_completions) HTTP request failed", zap.Error(err))
-		return nil, nil, err
+		return nil, nil, services.UpstreamError(ctx, err)
 	}
 	defer res.Body.Close()
 
+	p.ObserveRateLimit(httpReq.Header.Get("Authorization"), res)
+
 	Logger.Debug("DoInference (chat_completions) response received", zap.Int("status", res.StatusCode))
 
 	respData, _ := io.ReadAll(res.Body)
@@ -83,14 +112,18 @@ func (c *ChatCompletions) DoInference(p *services.ProviderService, reqJson style
 		Logger.Error("DoInference (chat_completions) non-200 response",
 			zap.Int("status", res.StatusCode),
 			zap.String("body", string(respData)))
-		return res, nil, fmt.Errorf("%s", string(respData))
+		return res, nil, &errs.StatusError{Status: res.StatusCode, Body: string(respData), Header: res.Header}
 	}
 
 	respJson, err := styles.ParsePartialJSON(respData)
 	if err != nil {
 		Logger.Error("DoInference (chat_completions) response JSON parse failed", zap.Error(err))
+		return res, nil, errs.Wrap(errs.ErrUpstream, err)
+	}
+	if err := chunkError(respJson); err != nil {
 		return res, nil, err
 	}
+	respJson = compatChunk(p.Style, respJson)
 
 	Logger.Debug("DoInference (chat_completions) completed successfully")
 
@@ -103,77 +136,115 @@ func (c *ChatCompletions) DoInferenceStream(p *services.ProviderService, reqJson
 		zap.String("provider", p.Name))
 	// zap.String("model", req.GetModel())) todo
 
-	httpReq, err := c.createRequest(p, reqJson, r, "/chat/completions")
+	httpReq, cancel, err := c.createRequest(p, reqJson, r, "/chat/completions")
 	if err != nil {
 		Logger.Error("DoInferenceStream (chat_completions) createRequest failed", zap.Error(err))
 		return nil, nil, err
 	}
+	ctx := httpReq.Context()
+	received := p.AwaitFirstToken(ctx)
 
-	Logger.Debug("DoInferenceStream (chat_completions) sending request", zap.String("url", httpReq.URL.String()))
+	Logger.Debug("DoInferenceStream (chat_completions) sending request", zap.String("url", logURL(httpReq.URL)))
 
-	res, err := http.DefaultClient.Do(httpReq)
+	res, err := p.HTTPClient().Do(httpReq)
 	if err != nil {
+		cancel()
 		Logger.Error("DoInferenceStream (chat_completions) HTTP request failed", zap.Error(err))
-		return nil, nil, err
+		return nil, nil, services.UpstreamError(ctx, err)
 	}
 
+	p.ObserveRateLimit(httpReq.Header.Get("Authorization"), res)
+
 	Logger.Debug("DoInferenceStream (chat_completions) response received",
 		zap.Int("status", res.StatusCode),
 		zap.String("content_type", res.Header.Get("Content-Type")))
 
+	// Fail before the stream starts so the router can fall back to another provider
+	if res.StatusCode != http.StatusOK {
+		respData, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		cancel()
+		Logger.Error("DoInferenceStream (chat_completions) non-200 response",
+			zap.Int("status", res.StatusCode),
+			zap.String("body", string(respData)))
+		return res, nil, &errs.StatusError{Status: res.StatusCode, Body: string(respData), Header: res.Header}
+	}
+
+	services.TrackUpstreamStream(res)
 	chunks := make(chan drivers.InferenceStreamChunk)
 
 	go func() {
 		defer close(chunks)
+		defer services.TrackStreamGoroutine()()
+		defer cancel()
 		defer res.Body.Close()
 
-		if res.StatusCode != http.StatusOK {
-			respData, _ := io.ReadAll(res.Body)
-			Logger.Error("DoInferenceStream (chat_completions) non-200 response",
-				zap.Int("status", res.StatusCode),
-				zap.String("body", string(respData)))
-			chunks <- drivers.InferenceStreamChunk{
-				RuntimeError: fmt.Errorf("%s - %s", res.Status, string(respData)),
-			}
-			return
-		}
-
 		ct := res.Header.Get("Content-Type")
 		isSSE := strings.HasPrefix(strings.ToLower(ct), "text/event-stream")
 
 		if !isSSE {
 			respData, err := io.ReadAll(res.Body)
+			received()
 			if err != nil {
-				chunks <- drivers.InferenceStreamChunk{RuntimeError: err}
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: services.UpstreamError(ctx, err)})
 				return
 			}
 
 			respJson, err := styles.ParsePartialJSON(respData)
 			if err != nil {
-				chunks <- drivers.InferenceStreamChunk{RuntimeError: err}
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: errs.Wrap(errs.ErrUpstream, err)})
+				return
+			}
+			// Some servers answer a stream with a plain JSON error body
+			if err := chunkError(respJson); err != nil {
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: err})
 				return
 			}
 
-			chunks <- drivers.InferenceStreamChunk{Data: respJson}
+			drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{Data: compatChunk(p.Style, respJson)})
 			return
 		}
 
+		var decoder drivers.ChunkDecoder
+		defer func() {
+			if decoder.Split > 0 || decoder.Skipped > 0 {
+				Logger.Warn("DoInferenceStream (chat_completions) repaired malformed stream chunks",
+					zap.String("provider", p.Name),
+					zap.Int("split", decoder.Split),
+					zap.Int("skipped", decoder.Skipped))
+			}
+		}()
+
 		reader := sse.NewDefaultReader(res.Body)
 		for event := range reader.ReadEvents() {
+			received()
 			if event.Error != nil {
-				chunks <- drivers.InferenceStreamChunk{RuntimeError: event.Error}
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: services.UpstreamError(ctx, event.Error)})
 				return
 			}
 			if event.Done {
 				return
 			}
+			if err := streamEventError(event); err != nil {
+				drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: err})
+				return
+			}
 			if event.Data != nil {
-				jsonData, err := styles.ParsePartialJSON(event.Data)
+				decoded, err := decoder.Decode(event.Data)
+				for _, jsonData := range decoded {
+					// vLLM and TGI report failures midway as data events
+					if chunkErr := chunkError(jsonData); chunkErr != nil {
+						drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: chunkErr})
+						return
+					}
+					if !drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{Data: compatChunk(p.Style, jsonData)}) {
+						return
+					}
+				}
 				if err != nil {
-					chunks <- drivers.InferenceStreamChunk{RuntimeError: err}
+					drivers.SendChunk(ctx, chunks, drivers.InferenceStreamChunk{RuntimeError: err})
 					return
 				}
-				chunks <- drivers.InferenceStreamChunk{Data: jsonData}
 			}
 		}
 	}()
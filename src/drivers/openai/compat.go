@@ -0,0 +1,160 @@
+package openai
+
+import (
+	"encoding/json"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// vllmExtraFields are vLLM sampling and guided decoding parameters, which
+// OpenAI clients pass in the request's extras object
+var vllmExtraFields = []string{
+	"stop_token_ids", "guided_json", "guided_regex", "guided_choice", "guided_grammar",
+	"guided_decoding_backend", "structured_outputs", "top_k", "min_p", "repetition_penalty",
+}
+
+// compatRequest adapts a Chat Completions request to the deviations of vLLM
+// and TGI servers; other styles' requests are returned as is
+func compatRequest(style styles.Style, reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	switch style {
+	case styles.StyleVLLM:
+		return liftExtras(reqJson, vllmExtraFields)
+	case styles.StyleTGI:
+		return tgiRequest(reqJson)
+	}
+	return reqJson, nil
+}
+
+// liftExtras moves fields of the request's extras object to the top level
+func liftExtras(reqJson styles.PartialJSON, fields []string) (styles.PartialJSON, error) {
+	raw, ok := reqJson["extras"]
+	if !ok {
+		return reqJson, nil
+	}
+	var extras map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &extras); err != nil {
+		return nil, errs.Wrap(errs.ErrInvalidRequest, err)
+	}
+	res := reqJson.Clone()
+	for _, field := range fields {
+		if value, ok := extras[field]; ok {
+			res[field] = value
+			delete(extras, field)
+		}
+	}
+	if len(extras) == 0 {
+		delete(res, "extras")
+	} else if err := res.Set("extras", extras); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// tgiResponseFormat is TGI's guided decoding setting: a JSON schema or a regex
+type tgiResponseFormat struct {
+	Type  string          `json:"type"` // "json" or "regex"
+	Value json.RawMessage `json:"value"`
+}
+
+// tgiRequest rewrites guided decoding for TGI, which takes it as
+// response_format {"type": "json"|"regex", "value": ...} instead of OpenAI
+// json_schema formats or vLLM guided_* fields, and drops stop_token_ids,
+// which TGI rejects
+func tgiRequest(reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	res, err := liftExtras(reqJson, []string{"stop_token_ids", "guided_json", "guided_regex"})
+	if err != nil {
+		return nil, err
+	}
+	res = res.Clone()
+
+	if _, ok := res["stop_token_ids"]; ok {
+		Logger.Debug("TGI does not support stop_token_ids; dropping them")
+		delete(res, "stop_token_ids")
+	}
+
+	var format *tgiResponseFormat
+	if schema, ok := res["guided_json"]; ok {
+		format = &tgiResponseFormat{Type: "json", Value: schema}
+	} else if regex, ok := res["guided_regex"]; ok {
+		format = &tgiResponseFormat{Type: "regex", Value: regex}
+	} else if raw, ok := res["response_format"]; ok {
+		var rf struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Schema json.RawMessage `json:"schema"`
+			} `json:"json_schema"`
+		}
+		if err := json.Unmarshal(raw, &rf); err != nil {
+			return nil, errs.Wrap(errs.ErrInvalidRequest, err)
+		}
+		if rf.Type == "json_schema" && rf.JSONSchema.Schema != nil {
+			format = &tgiResponseFormat{Type: "json", Value: rf.JSONSchema.Schema}
+		}
+	}
+	delete(res, "guided_json")
+	delete(res, "guided_regex")
+	if format != nil {
+		if err := res.Set("response_format", format); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// compatChunk cleans up a response or stream chunk of vLLM and TGI servers:
+// usage: null is removed, as is vLLM's non-standard stop_reason
+func compatChunk(style styles.Style, doc styles.PartialJSON) styles.PartialJSON {
+	if style != styles.StyleVLLM && style != styles.StyleTGI {
+		return doc
+	}
+	if raw, ok := doc["usage"]; ok && string(raw) == "null" {
+		delete(doc, "usage")
+	}
+	raw, ok := doc["choices"]
+	if !ok {
+		return doc
+	}
+	var choices []map[string]json.RawMessage
+	if json.Unmarshal(raw, &choices) != nil {
+		return doc
+	}
+	changed := false
+	for _, choice := range choices {
+		if _, ok := choice["stop_reason"]; ok {
+			delete(choice, "stop_reason")
+			changed = true
+		}
+	}
+	if changed {
+		_ = doc.Set("choices", choices)
+	}
+	return doc
+}
+
+// chunkError returns the upstream error carried by a stream chunk or a
+// response body in place of a completion: OpenAI-style {"error": {...}},
+// TGI's {"error": "...", "error_type": "..."} or vLLM's {"object": "error"}
+func chunkError(doc styles.PartialJSON) error {
+	if _, ok := doc["choices"]; ok {
+		return nil
+	}
+	if raw, ok := doc["error"]; ok && string(raw) != "null" {
+		var message string
+		if json.Unmarshal(raw, &message) != nil {
+			var nested struct {
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(raw, &nested)
+			message = nested.Message
+		}
+		if message == "" {
+			message = string(raw)
+		}
+		return errs.Errorf(errs.ErrUpstream, "upstream error: %s", message)
+	}
+	if styles.TryGetFromPartialJSON[string](doc, "object") == "error" {
+		return errs.Errorf(errs.ErrUpstream, "upstream error: %s", styles.TryGetFromPartialJSON[string](doc, "message"))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// replayProvider serves a recorded upstream response and captures the request body
+func replayProvider(t *testing.T, style styles.Style, contentType, recording string, body *styles.PartialJSON) *services.ProviderService {
+	t.Helper()
+	data, err := os.ReadFile(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		*body, _ = styles.ParsePartialJSON(raw)
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return &services.ProviderService{Name: string(style), ParsedURL: *u, Style: style}
+}
+
+func TestChatCompletions_VLLMStream(t *testing.T) {
+	var sent styles.PartialJSON
+	p := replayProvider(t, styles.StyleVLLM, "text/event-stream", "testdata/vllm_stream.txt", &sent)
+
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "Qwen/Qwen2.5-7B-Instruct", "stream": true,
+		"extras": {"stop_token_ids": [151645], "guided_choice": ["yes", "no"], "trace": "t-1"}}`))
+	_, chunks, err := (&ChatCompletions{}).DoInferenceStream(p, req, httptest.NewRequest(http.MethodPost, "/", nil))
+	if err != nil {
+		t.Fatalf("DoInferenceStream returned error: %v", err)
+	}
+	var content string
+	for chunk := range chunks {
+		if chunk.RuntimeError != nil {
+			t.Fatalf("unexpected stream error: %v", chunk.RuntimeError)
+		}
+		if _, ok := chunk.Data["usage"]; ok {
+			t.Errorf("expected usage: null to be removed, got %s", chunk.Data["usage"])
+		}
+		var choices []map[string]json.RawMessage
+		_ = json.Unmarshal(chunk.Data["choices"], &choices)
+		for _, choice := range choices {
+			if _, ok := choice["stop_reason"]; ok {
+				t.Error("expected vLLM's stop_reason to be removed")
+			}
+			var delta struct{ Content string }
+			_ = json.Unmarshal(choice["delta"], &delta)
+			content += delta.Content
+		}
+	}
+	if content != "Hello!" {
+		t.Errorf("content = %q, want Hello!", content)
+	}
+
+	if string(sent["stop_token_ids"]) != "[151645]" || sent["guided_choice"] == nil {
+		t.Errorf("expected vLLM parameters lifted from extras, sent %v", sent)
+	}
+	if extras := styles.TryGetFromPartialJSON[map[string]any](sent, "extras"); len(extras) != 1 {
+		t.Errorf("extras = %v, want only the unknown field left", extras)
+	}
+}
+
+func TestChatCompletions_TGIStreamError(t *testing.T) {
+	var sent styles.PartialJSON
+	p := replayProvider(t, styles.StyleTGI, "text/event-stream", "testdata/tgi_stream_error.txt", &sent)
+
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "tgi", "stream": true, "stop_token_ids": [128009],
+		"response_format": {"type": "json_schema", "json_schema": {"name": "r", "schema": {"type": "object"}}}}`))
+	_, chunks, err := (&ChatCompletions{}).DoInferenceStream(p, req, httptest.NewRequest(http.MethodPost, "/", nil))
+	if err != nil {
+		t.Fatalf("DoInferenceStream returned error: %v", err)
+	}
+	var received int
+	var streamErr error
+	for chunk := range chunks {
+		if chunk.RuntimeError != nil {
+			streamErr = chunk.RuntimeError
+			continue
+		}
+		received++
+	}
+	if received != 1 || !errors.Is(streamErr, errs.ErrUpstream) {
+		t.Errorf("got %d chunks and error %v, want 1 chunk then an upstream error", received, streamErr)
+	}
+
+	if _, ok := sent["stop_token_ids"]; ok {
+		t.Error("expected stop_token_ids to be dropped for TGI")
+	}
+	format := styles.TryGetFromPartialJSON[map[string]any](sent, "response_format")
+	if format["type"] != "json" || format["value"] == nil {
+		t.Errorf("response_format = %v, want TGI's json form", format)
+	}
+
+	// A plain JSON error body in place of a stream fails it too
+	p = replayProvider(t, styles.StyleTGI, "application/json", "testdata/tgi_error_body.json", &sent)
+	_, chunks, err = (&ChatCompletions{}).DoInferenceStream(p, req, httptest.NewRequest(http.MethodPost, "/", nil))
+	if err != nil {
+		t.Fatalf("DoInferenceStream returned error: %v", err)
+	}
+	chunk := <-chunks
+	if chunk.RuntimeError == nil {
+		t.Errorf("expected the error body to fail the stream, got %v", chunk.Data)
+	}
+}
@@ -0,0 +1,80 @@
+package openai
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Embeddings implements embeddings for OpenAI-compatible APIs
+type Embeddings struct{}
+
+// DoEmbeddings implements EmbeddingsCommand for the OpenAI Embeddings API
+func (c *Embeddings) DoEmbeddings(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	targetUrl, err := p.EndpointURL("embeddings", "/embeddings")
+	if err != nil {
+		return nil, nil, err
+	}
+	p.ApplyQuery(r, &targetUrl)
+
+	reqJson, err = p.WithUpstreamModel(reqJson)
+	if err != nil {
+		return nil, nil, err
+	}
+	reqBody, err := reqJson.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	targetHeader := r.Header.Clone()
+	targetHeader.Del("Accept-Encoding")
+	targetHeader.Set("Content-Type", "application/json")
+
+	httpReq := &http.Request{
+		Method:        "POST",
+		URL:           &targetUrl,
+		Header:        targetHeader,
+		Body:          io.NopCloser(bytes.NewReader(reqBody)),
+		ContentLength: int64(len(reqBody)),
+	}
+	ctx, cancel := p.WithUpstreamTimeout(r.Context())
+	defer cancel()
+	httpReq = httpReq.WithContext(ctx)
+
+	authVal, err := p.CollectTargetAuth("embeddings", r, httpReq)
+	if err != nil {
+		return nil, nil, errs.Wrap(errs.ErrAuth, err)
+	}
+	if authVal != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+authVal)
+	}
+	p.ApplyRequestHeaders(r, httpReq)
+
+	Logger.Debug("DoEmbeddings sending request", zap.String("provider", p.Name), zap.String("url", logURL(httpReq.URL)))
+
+	res, err := p.HTTPClient().Do(httpReq)
+	if err != nil {
+		return nil, nil, services.UpstreamError(ctx, err)
+	}
+	defer res.Body.Close()
+
+	p.ObserveRateLimit(httpReq.Header.Get("Authorization"), res)
+
+	respData, _ := io.ReadAll(res.Body)
+	if res.StatusCode != 200 {
+		Logger.Error("DoEmbeddings non-200 response",
+			zap.Int("status", res.StatusCode),
+			zap.String("body", string(respData)))
+		return res, nil, &errs.StatusError{Status: res.StatusCode, Body: string(respData), Header: res.Header}
+	}
+
+	respJson, err := styles.ParsePartialJSON(respData)
+	if err != nil {
+		return res, nil, errs.Wrap(errs.ErrUpstream, err)
+	}
+	return res, respJson, nil
+}
@@ -14,8 +14,11 @@ import (
 type ListModels struct{}
 
 func (c *ListModels) DoListModels(p *services.ProviderService, r *http.Request) ([]drivers.ListModelsModel, error) {
-	targetUrl := p.ParsedURL
-	targetUrl.Path += "/models"
+	targetUrl, err := p.EndpointURL("list_models", "/models")
+	if err != nil {
+		return nil, err
+	}
+	p.ApplyQuery(r, &targetUrl)
 
 	targetHeader := r.Header.Clone()
 	targetHeader.Del("Accept-Encoding")
@@ -27,20 +30,21 @@ func (c *ListModels) DoListModels(p *services.ProviderService, r *http.Request)
 	}
 	req = req.WithContext(r.Context())
 
-	authVal, err := p.Router.Auth.CollectTargetAuth("list_models", p, r, req)
+	authVal, err := p.CollectTargetAuth("list_models", r, req)
 	if err != nil {
 		return nil, err
 	}
 	if authVal != "" {
 		req.Header.Set("Authorization", "Bearer "+authVal)
 	}
+	p.ApplyRequestHeaders(r, req)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.HTTPClient().Do(req)
 	if err != nil {
 		// Retry without Bearer prefix
 		if authVal != "" {
 			req.Header.Set("Authorization", authVal)
-			resp, err = http.DefaultClient.Do(req)
+			resp, err = p.HTTPClient().Do(req)
 		}
 		if err != nil {
 			return nil, err
@@ -0,0 +1,184 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// StyleProbe is what probing an unknown provider found out
+type StyleProbe struct {
+	Style styles.Style
+	// Capabilities has an entry per model whose listing described its features
+	Capabilities services.Capabilities
+}
+
+// ErrUnsupportedStyle is reported by ProbeStyle for providers serving an API
+// the router has no driver for
+var ErrUnsupportedStyle = errors.New("unsupported API style")
+
+// probeCache holds successful probes by base URL, so reloading a config
+// doesn't probe its providers again
+var probeCache sync.Map // string -> *StyleProbe
+
+// ProbeStyle detects the API style of a provider from the endpoints it
+// serves: a vLLM or TGI server, Chat Completions, or the Responses API. The
+// model listing also yields capability entries when it describes models the
+// way OpenRouter does. Results are cached per base URL.
+func ProbeStyle(ctx context.Context, p *services.ProviderService) (*StyleProbe, error) {
+	cacheKey := p.ParsedURL.String()
+	if cached, ok := probeCache.Load(cacheKey); ok {
+		return cached.(*StyleProbe), nil
+	}
+
+	probe := &StyleProbe{}
+	models, vllm := probeModels(ctx, p)
+	probe.Capabilities = models
+
+	switch {
+	case vllm:
+		probe.Style = styles.StyleVLLM
+	case probeTGI(ctx, p):
+		probe.Style = styles.StyleTGI
+	case probeEndpoint(ctx, p, "inference", "/chat/completions"):
+		probe.Style = styles.StyleChatCompletions
+	case probeEndpoint(ctx, p, "inference", "/responses"):
+		probe.Style = styles.StyleResponses
+	case probeEndpoint(ctx, p, "inference", "/messages"):
+		return nil, fmt.Errorf("provider %s serves the Anthropic Messages API: %w", p.Name, ErrUnsupportedStyle)
+	default:
+		return nil, fmt.Errorf("provider %s: no supported API found at %s", p.Name, logURL(&p.ParsedURL))
+	}
+
+	Logger.Info("Detected provider style",
+		zap.String("provider", p.Name),
+		zap.String("style", string(probe.Style)),
+		zap.Int("capability_entries", len(probe.Capabilities)))
+	probeCache.Store(cacheKey, probe)
+	return probe, nil
+}
+
+// probeRequest sends a probe request with the provider's static credential
+func probeRequest(ctx context.Context, p *services.ProviderService, method string, target url.URL, body []byte) (*http.Response, error) {
+	p.ApplyQuery(&http.Request{URL: &url.URL{}}, &target)
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	p.ApplyRequestHeaders(req, req)
+	return http.DefaultClient.Do(req)
+}
+
+// probeEndpoint reports whether the provider serves an endpoint, posting an
+// empty request that any implementation rejects without generating anything
+func probeEndpoint(ctx context.Context, p *services.ProviderService, command, path string) bool {
+	target, err := p.EndpointURL(command, path)
+	if err != nil {
+		return false
+	}
+	res, err := probeRequest(ctx, p, http.MethodPost, target, []byte(`{}`))
+	if err != nil {
+		return false
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	return res.StatusCode != http.StatusNotFound && res.StatusCode != http.StatusMethodNotAllowed
+}
+
+// probeModel is a model listing entry, with the fields servers add beyond
+// the OpenAI API
+type probeModel struct {
+	ID                  string   `json:"id"`
+	OwnedBy             string   `json:"owned_by"`
+	MaxModelLen         int      `json:"max_model_len"` // vLLM
+	SupportedParameters []string `json:"supported_parameters"`
+	Architecture        struct {
+		InputModalities []string `json:"input_modalities"`
+	} `json:"architecture"`
+}
+
+// probeModels lists the provider's models, returning capability entries for
+// the models described in enough detail and whether a vLLM server listed them
+func probeModels(ctx context.Context, p *services.ProviderService) (services.Capabilities, bool) {
+	target, err := p.EndpointURL("list_models", "/models")
+	if err != nil {
+		return nil, false
+	}
+	res, err := probeRequest(ctx, p, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, false
+	}
+	defer res.Body.Close()
+	var listing struct {
+		Data []probeModel `json:"data"`
+	}
+	if res.StatusCode != http.StatusOK || json.NewDecoder(res.Body).Decode(&listing) != nil {
+		return nil, false
+	}
+
+	var capabilities services.Capabilities
+	vllm := false
+	for _, m := range listing.Data {
+		if m.OwnedBy == "vllm" || m.MaxModelLen > 0 {
+			vllm = true
+		}
+		if m.ID == "" || (m.SupportedParameters == nil && m.Architecture.InputModalities == nil) {
+			continue
+		}
+		entry := services.CapabilityEntry{Model: m.ID}
+		mark := func(capability string, supported bool) {
+			if supported {
+				entry.Supports = append(entry.Supports, capability)
+			} else {
+				entry.Lacks = append(entry.Lacks, capability)
+			}
+		}
+		if m.SupportedParameters != nil {
+			mark(services.CapabilityTools, slices.Contains(m.SupportedParameters, "tools"))
+			mark(services.CapabilityJSONSchema, slices.Contains(m.SupportedParameters, "structured_outputs"))
+			mark(services.CapabilityJSONMode, slices.Contains(m.SupportedParameters, "response_format"))
+			mark(services.CapabilityReasoning, slices.Contains(m.SupportedParameters, "reasoning"))
+		}
+		if m.Architecture.InputModalities != nil {
+			mark(services.CapabilityVision, slices.Contains(m.Architecture.InputModalities, "image"))
+		}
+		capabilities = append(capabilities, entry)
+	}
+	return capabilities, vllm
+}
+
+// probeTGI reports whether the provider is a Text Generation Inference
+// server, which describes itself at /info next to its /v1 API
+func probeTGI(ctx context.Context, p *services.ProviderService) bool {
+	target := p.ParsedURL
+	target.Path = strings.TrimSuffix(strings.TrimSuffix(target.Path, "/"), "/v1") + "/info"
+	res, err := probeRequest(ctx, p, http.MethodGet, target, nil)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+	var info struct {
+		Router string `json:"router"`
+	}
+	return res.StatusCode == http.StatusOK &&
+		json.NewDecoder(res.Body).Decode(&info) == nil &&
+		info.Router == "text-generation-router"
+}
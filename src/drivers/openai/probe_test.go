@@ -0,0 +1,98 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestProbeStyle(t *testing.T) {
+	servers := map[string]http.HandlerFunc{
+		"vllm": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/models" {
+				_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"Qwen/Qwen2.5-7B-Instruct","object":"model","owned_by":"vllm","max_model_len":32768}]}`))
+				return
+			}
+			http.NotFound(w, r)
+		},
+		"tgi": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/info" {
+				_, _ = w.Write([]byte(`{"model_id":"meta-llama/Llama-3.1-8B-Instruct","router":"text-generation-router","version":"3.0.1"}`))
+				return
+			}
+			http.NotFound(w, r)
+		},
+		"gateway": func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/models":
+				_, _ = w.Write([]byte(`{"data":[
+					{"id":"openai/gpt-4.1","supported_parameters":["tools","response_format","structured_outputs"],"architecture":{"input_modalities":["text","image"]}},
+					{"id":"plain-model"}]}`))
+			case "/v1/chat/completions":
+				http.Error(w, `{"error":{"message":"messages is required"}}`, http.StatusBadRequest)
+			default:
+				http.NotFound(w, r)
+			}
+		},
+		"responses": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/responses" {
+				http.Error(w, `{"error":{"message":"input is required"}}`, http.StatusBadRequest)
+				return
+			}
+			http.NotFound(w, r)
+		},
+		"anthropic": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/messages" {
+				http.Error(w, `{"type":"error"}`, http.StatusBadRequest)
+				return
+			}
+			http.NotFound(w, r)
+		},
+	}
+	probes := map[string]*StyleProbe{}
+	for name, handler := range servers {
+		srv := httptest.NewServer(handler)
+		t.Cleanup(srv.Close)
+		u, _ := url.Parse(srv.URL + "/v1")
+		probe, err := ProbeStyle(context.Background(), &services.ProviderService{Name: name, ParsedURL: *u})
+		if name == "anthropic" {
+			if !errors.Is(err, ErrUnsupportedStyle) {
+				t.Errorf("expected an unsupported style error for anthropic, got %+v", probe)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: ProbeStyle returned error: %v", name, err)
+		}
+		probes[name] = probe
+	}
+
+	want := map[string]styles.Style{
+		"vllm":      styles.StyleVLLM,
+		"tgi":       styles.StyleTGI,
+		"gateway":   styles.StyleChatCompletions,
+		"responses": styles.StyleResponses,
+	}
+	for name, style := range want {
+		if probes[name].Style != style {
+			t.Errorf("%s: style = %s, want %s", name, probes[name].Style, style)
+		}
+	}
+
+	caps := probes["gateway"].Capabilities
+	if len(caps) != 1 {
+		t.Fatalf("capabilities = %+v, want one entry for the described model", caps)
+	}
+	if ok, _ := caps.Supports("openai/gpt-4.1", services.CapabilityVision); !ok {
+		t.Error("expected vision from the image input modality")
+	}
+	if ok, known := caps.Supports("openai/gpt-4.1", services.CapabilityReasoning); ok || !known {
+		t.Error("expected reasoning to be known unsupported")
+	}
+}
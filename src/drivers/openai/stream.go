@@ -0,0 +1,31 @@
+package openai
+
+import (
+	"encoding/json"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+)
+
+// streamEventError returns the upstream error carried by an `event: error`
+// SSE event, or nil for any other event
+func streamEventError(event sse.Event) error {
+	if event.Name != "error" {
+		return nil
+	}
+	var payload struct {
+		Message string `json:"message"`
+		Error   struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(event.Data, &payload) == nil {
+		if payload.Error.Message != "" {
+			return errs.Errorf(errs.ErrUpstream, "upstream stream error: %s", payload.Error.Message)
+		}
+		if payload.Message != "" {
+			return errs.Errorf(errs.ErrUpstream, "upstream stream error: %s", payload.Message)
+		}
+	}
+	return errs.Errorf(errs.ErrUpstream, "upstream stream error: %s", string(event.Data))
+}
@@ -0,0 +1,220 @@
+package drivers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// SplitSamples returns cmd sending Chat Completions requests asking for more
+// than limit completions (n) as concurrent requests of at most limit each,
+// joining their choices and usage into one response. Streams of the parts
+// are multiplexed into one (see MultiplexStreams).
+func SplitSamples(cmd InferenceCommand, limit int) InferenceCommand {
+	return &sampleSplitter{cmd: cmd, limit: limit}
+}
+
+type sampleSplitter struct {
+	cmd   InferenceCommand
+	limit int
+}
+
+func (s *sampleSplitter) DoInference(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	n := styles.TryGetFromPartialJSON[int](reqJson, "n")
+	if n <= s.limit {
+		return s.cmd.DoInference(p, reqJson, r)
+	}
+
+	parts := (n + s.limit - 1) / s.limit
+	type result struct {
+		res     *http.Response
+		resJson styles.PartialJSON
+		err     error
+	}
+	results := make([]result, parts)
+	var wg sync.WaitGroup
+	for i := range parts {
+		partReq := s.part(reqJson, n, i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, resJson, err := s.cmd.DoInference(p, partReq, r)
+			results[i] = result{res, resJson, err}
+		}()
+	}
+	wg.Wait()
+
+	var choices []map[string]json.RawMessage
+	var usage styles.ChatCompletionsUsage
+	for _, part := range results {
+		if part.err != nil {
+			return part.res, nil, part.err
+		}
+		var partChoices []map[string]json.RawMessage
+		if err := json.Unmarshal(part.resJson["choices"], &partChoices); err != nil {
+			return part.res, nil, errs.Wrap(errs.ErrUpstream, err)
+		}
+		for _, choice := range partChoices {
+			index, _ := json.Marshal(len(choices))
+			choice["index"] = index
+			choices = append(choices, choice)
+		}
+		var partUsage styles.ChatCompletionsUsage
+		if json.Unmarshal(part.resJson["usage"], &partUsage) == nil {
+			usage.Add(partUsage)
+		}
+	}
+
+	merged := results[0].resJson.Clone()
+	if err := merged.Set("choices", choices); err != nil {
+		return results[0].res, nil, err
+	}
+	if _, ok := merged["usage"]; ok {
+		if err := merged.Set("usage", usage); err != nil {
+			return results[0].res, nil, err
+		}
+	}
+	return results[0].res, merged, nil
+}
+
+func (s *sampleSplitter) DoInferenceStream(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, chan InferenceStreamChunk, error) {
+	n := styles.TryGetFromPartialJSON[int](reqJson, "n")
+	if n <= s.limit {
+		return s.cmd.DoInferenceStream(p, reqJson, r)
+	}
+
+	parts := (n + s.limit - 1) / s.limit
+	type result struct {
+		res    *http.Response
+		stream chan InferenceStreamChunk
+		err    error
+	}
+	results := make([]result, parts)
+	var wg sync.WaitGroup
+	for i := range parts {
+		partReq := s.part(reqJson, n, i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, stream, err := s.cmd.DoInferenceStream(p, partReq, r)
+			results[i] = result{res, stream, err}
+		}()
+	}
+	wg.Wait()
+
+	// Every part must start: nothing was sent yet, so a failing one can
+	// still fall back to the next provider
+	sources := make([]StreamSource, 0, parts)
+	for i, part := range results {
+		if part.err != nil {
+			for _, other := range results {
+				if other.err == nil {
+					AbandonStream(other.res, other.stream)
+				}
+			}
+			return part.res, nil, part.err
+		}
+		sources = append(sources, StreamSource{Res: part.res, Stream: part.stream, Offset: i * s.limit})
+	}
+	res, stream := MultiplexStreams(sources)
+	return res, stream, nil
+}
+
+// part returns the request of the i-th part of a split request
+func (s *sampleSplitter) part(reqJson styles.PartialJSON, n, i int) styles.PartialJSON {
+	partReq := reqJson.Clone()
+	_ = partReq.Set("n", min(s.limit, n-i*s.limit))
+	if seed, ok := reqJson["seed"]; ok {
+		// The same seed would give every part the same samples
+		var value int64
+		if json.Unmarshal(seed, &value) == nil {
+			_ = partReq.Set("seed", value+int64(i))
+		}
+	}
+	return partReq
+}
+
+// SplitBatches returns cmd sending embeddings requests with more than limit
+// inputs as concurrent requests of at most limit inputs each, joining their
+// embeddings, reindexed in input order, and usage into one response
+func SplitBatches(cmd EmbeddingsCommand, limit int) EmbeddingsCommand {
+	return &batchSplitter{cmd: cmd, limit: limit}
+}
+
+type batchSplitter struct {
+	cmd   EmbeddingsCommand
+	limit int
+}
+
+// embeddingsUsage is the usage of an embeddings response
+type embeddingsUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+func (s *batchSplitter) DoEmbeddings(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	var inputs []json.RawMessage
+	if json.Unmarshal(reqJson["input"], &inputs) != nil || len(inputs) <= s.limit ||
+		(inputs[0][0] != '"' && inputs[0][0] != '[') {
+		// A single input, a single token array, or a batch within the limit
+		return s.cmd.DoEmbeddings(p, reqJson, r)
+	}
+
+	type result struct {
+		res     *http.Response
+		resJson styles.PartialJSON
+		err     error
+	}
+	parts := (len(inputs) + s.limit - 1) / s.limit
+	results := make([]result, parts)
+	var wg sync.WaitGroup
+	for i := range parts {
+		partReq := reqJson.Clone()
+		_ = partReq.Set("input", inputs[i*s.limit:min((i+1)*s.limit, len(inputs))])
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, resJson, err := s.cmd.DoEmbeddings(p, partReq, r)
+			results[i] = result{res, resJson, err}
+		}()
+	}
+	wg.Wait()
+
+	var data []map[string]json.RawMessage
+	var usage embeddingsUsage
+	for i, part := range results {
+		if part.err != nil {
+			return part.res, nil, part.err
+		}
+		var partData []map[string]json.RawMessage
+		if err := json.Unmarshal(part.resJson["data"], &partData); err != nil {
+			return part.res, nil, errs.Wrap(errs.ErrUpstream, err)
+		}
+		for _, d := range partData {
+			var index int
+			if err := json.Unmarshal(d["index"], &index); err != nil {
+				return part.res, nil, errs.Errorf(errs.ErrUpstream, "embedding without index")
+			}
+			d["index"], _ = json.Marshal(i*s.limit + index)
+			data = append(data, d)
+		}
+		var partUsage embeddingsUsage
+		if json.Unmarshal(part.resJson["usage"], &partUsage) == nil {
+			usage.PromptTokens += partUsage.PromptTokens
+			usage.TotalTokens += partUsage.TotalTokens
+		}
+	}
+
+	merged := results[0].resJson.Clone()
+	if err := merged.Set("data", data); err != nil {
+		return results[0].res, nil, err
+	}
+	if err := merged.Set("usage", usage); err != nil {
+		return results[0].res, nil, err
+	}
+	return results[0].res, merged, nil
+}
@@ -0,0 +1,177 @@
+package drivers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// fakeSamples answers n choices named after the request's seed
+type fakeSamples struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeSamples) DoInference(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	n := styles.TryGetFromPartialJSON[int](reqJson, "n")
+	seed := styles.TryGetFromPartialJSON[int](reqJson, "seed")
+	f.mu.Lock()
+	f.calls = append(f.calls, fmt.Sprintf("n=%d seed=%d", n, seed))
+	f.mu.Unlock()
+	var choices []string
+	for i := range n {
+		choices = append(choices, fmt.Sprintf(`{"index": %d, "message": {"role": "assistant", "content": "seed %d"}}`, i, seed))
+	}
+	res, _ := styles.ParsePartialJSON(fmt.Appendf(nil, `{"id": "x", "choices": [%s], "usage": {"prompt_tokens": 10, "completion_tokens": %d, "total_tokens": %d}}`,
+		strings.Join(choices, ","), n, 10+n))
+	return nil, res, nil
+}
+
+func (f *fakeSamples) DoInferenceStream(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, chan InferenceStreamChunk, error) {
+	n := styles.TryGetFromPartialJSON[int](reqJson, "n")
+	seed := styles.TryGetFromPartialJSON[int](reqJson, "seed")
+	stream := make(chan InferenceStreamChunk)
+	go func() {
+		defer close(stream)
+		for i := range n {
+			for _, choice := range []string{
+				fmt.Sprintf(`{"index": %d, "delta": {"content": "seed %d"}}`, i, seed),
+				fmt.Sprintf(`{"index": %d, "delta": {}, "finish_reason": "stop"}`, i),
+			} {
+				chunk, _ := styles.ParsePartialJSON(fmt.Appendf(nil, `{"id": "x%d", "choices": [%s]}`, seed, choice))
+				stream <- InferenceStreamChunk{Data: chunk}
+			}
+		}
+		usage, _ := styles.ParsePartialJSON(fmt.Appendf(nil, `{"id": "x%d", "choices": [], "usage": {"prompt_tokens": 10, "completion_tokens": %d, "total_tokens": %d}}`, seed, n, 10+n))
+		stream <- InferenceStreamChunk{Data: usage}
+	}()
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, stream, nil
+}
+
+func TestSplitSamples(t *testing.T) {
+	fake := &fakeSamples{}
+	cmd := SplitSamples(fake, 2)
+	p := &services.ProviderService{Name: "p"}
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "n": 5, "seed": 7}`))
+
+	_, res, err := cmd.DoInference(p, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.calls) != 3 {
+		t.Errorf("calls = %v, want 3", fake.calls)
+	}
+	parsed, _ := styles.ParseChatCompletionsResponse(res)
+	seeds := map[string]int{}
+	for i, choice := range parsed.Choices {
+		if choice.Index != i {
+			t.Errorf("choice %d has index %d", i, choice.Index)
+		}
+		seeds[choice.Message.Content.(string)]++
+	}
+	// Each part gets its own seed: 2, 2 and 1 samples
+	if len(parsed.Choices) != 5 || seeds["seed 7"] != 2 || seeds["seed 8"] != 2 || seeds["seed 9"] != 1 {
+		t.Errorf("choices by seed = %v", seeds)
+	}
+	if parsed.Usage == nil || parsed.Usage.CompletionTokens != 5 || parsed.Usage.PromptTokens != 30 {
+		t.Errorf("usage = %+v, want the parts' sum", parsed.Usage)
+	}
+
+}
+
+func TestSplitSamples_Stream(t *testing.T) {
+	cmd := SplitSamples(&fakeSamples{}, 2)
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "n": 3, "seed": 1, "stream": true}`))
+	_, stream, err := cmd.DoInferenceStream(&services.ProviderService{Name: "p"}, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks []styles.PartialJSON
+	ids := map[string]bool{}
+	for chunk := range stream {
+		if chunk.RuntimeError != nil {
+			t.Fatal(chunk.RuntimeError)
+		}
+		chunks = append(chunks, chunk.Data)
+		ids[styles.TryGetFromPartialJSON[string](chunk.Data, "id")] = true
+	}
+	if len(ids) != 1 {
+		t.Errorf("chunks carry the ids %v, want one", ids)
+	}
+	res, err := styles.AssembleChatCompletionsStream(chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := styles.ParseChatCompletionsResponse(res)
+	want := []string{"seed 1", "seed 1", "seed 2"}
+	if len(parsed.Choices) != len(want) {
+		t.Fatalf("choices = %s", res["choices"])
+	}
+	for i, choice := range parsed.Choices {
+		if choice.Index != i || choice.Message.Content != want[i] || choice.FinishReason != "stop" {
+			t.Errorf("choice %d = %+v, want %q finished", i, choice, want[i])
+		}
+	}
+	// One usage chunk, the sum of the parts'
+	if parsed.Usage == nil || parsed.Usage.CompletionTokens != 3 || parsed.Usage.PromptTokens != 20 {
+		t.Errorf("usage = %+v, want the parts' sum", parsed.Usage)
+	}
+}
+
+// fakeEmbeddings embeds each input as its position in the request
+type fakeEmbeddings struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (f *fakeEmbeddings) DoEmbeddings(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	var inputs []string
+	if err := json.Unmarshal(reqJson["input"], &inputs); err != nil {
+		return nil, nil, err
+	}
+	f.mu.Lock()
+	f.batches = append(f.batches, len(inputs))
+	f.mu.Unlock()
+	var data []string
+	for i, input := range inputs {
+		data = append(data, fmt.Sprintf(`{"object": "embedding", "index": %d, "embedding": [%s]}`, i, input))
+	}
+	res, _ := styles.ParsePartialJSON(fmt.Appendf(nil, `{"object": "list", "data": [%s], "usage": {"prompt_tokens": %d, "total_tokens": %d}}`,
+		strings.Join(data, ","), len(inputs), len(inputs)))
+	return nil, res, nil
+}
+
+func TestSplitBatches(t *testing.T) {
+	fake := &fakeEmbeddings{}
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "input": ["0", "1", "2", "3", "4"]}`))
+	_, res, err := SplitBatches(fake, 2).DoEmbeddings(&services.ProviderService{}, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.batches) != 3 {
+		t.Errorf("batches = %v, want 3", fake.batches)
+	}
+	var data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	}
+	_ = json.Unmarshal(res["data"], &data)
+	if len(data) != 5 {
+		t.Fatalf("data = %s", res["data"])
+	}
+	for _, d := range data {
+		if int(d.Embedding[0]) != d.Index {
+			t.Errorf("input %v got index %d", d.Embedding, d.Index)
+		}
+	}
+	if string(res["usage"]) != `{"prompt_tokens":5,"total_tokens":5}` {
+		t.Errorf("usage = %s", res["usage"])
+	}
+}
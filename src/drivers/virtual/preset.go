@@ -0,0 +1,115 @@
+package virtual
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Preset holds generation settings applied when a virtual model is used.
+// Values act as defaults: fields already set by the client are kept, except
+// the tool allowlist, which always filters the client's tools.
+type Preset struct {
+	Temperature  *float64                   `json:"temperature,omitempty"`
+	TopP         *float64                   `json:"top_p,omitempty"`
+	MaxTokens    *int                       `json:"max_tokens,omitempty"`
+	SystemPrompt string                     `json:"system_prompt,omitempty"` // Prepended as a system message
+	Tools        []string                   `json:"tools"`                   // Allowed tool names (function name or tool type); null allows all, [] strips all
+	Params       map[string]json.RawMessage `json:"params,omitempty"`        // Any other request field, set verbatim when absent
+}
+
+// Apply applies the preset to a Chat Completions request in place.
+func (p *Preset) Apply(reqJson styles.PartialJSON) error {
+	if p == nil {
+		return nil
+	}
+
+	setDefault := func(key string, value any) error {
+		if _, ok := reqJson[key]; ok {
+			return nil
+		}
+		return reqJson.Set(key, value)
+	}
+
+	if p.Temperature != nil {
+		if err := setDefault("temperature", *p.Temperature); err != nil {
+			return err
+		}
+	}
+	if p.TopP != nil {
+		if err := setDefault("top_p", *p.TopP); err != nil {
+			return err
+		}
+	}
+	if p.MaxTokens != nil {
+		_, hasCompletionLimit := reqJson["max_completion_tokens"]
+		if !hasCompletionLimit {
+			if err := setDefault("max_tokens", *p.MaxTokens); err != nil {
+				return err
+			}
+		}
+	}
+	for key, value := range p.Params {
+		if _, ok := reqJson[key]; !ok {
+			reqJson[key] = value
+		}
+	}
+
+	if p.SystemPrompt != "" {
+		var messages []json.RawMessage
+		if raw, ok := reqJson["messages"]; ok {
+			if err := json.Unmarshal(raw, &messages); err != nil {
+				return errs.Errorf(errs.ErrInvalidRequest, "preset: failed to unmarshal messages: %w", err)
+			}
+		}
+		system, err := json.Marshal(styles.ChatCompletionsMessage{Role: "system", Content: p.SystemPrompt})
+		if err != nil {
+			return err
+		}
+		if err := reqJson.Set("messages", append([]json.RawMessage{system}, messages...)); err != nil {
+			return err
+		}
+	}
+
+	if p.Tools != nil {
+		if err := p.filterTools(reqJson); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// filterTools drops tools that are not in the allowlist
+func (p *Preset) filterTools(reqJson styles.PartialJSON) error {
+	raw, ok := reqJson["tools"]
+	if !ok {
+		return nil
+	}
+
+	var tools []json.RawMessage
+	if err := json.Unmarshal(raw, &tools); err != nil {
+		return errs.Errorf(errs.ErrInvalidRequest, "preset: failed to unmarshal tools: %w", err)
+	}
+
+	allowed := tools[:0]
+	for _, rawTool := range tools {
+		var tool styles.ChatCompletionsTool
+		if err := json.Unmarshal(rawTool, &tool); err != nil {
+			return errs.Errorf(errs.ErrInvalidRequest, "preset: failed to unmarshal tool: %w", err)
+		}
+		if slices.Contains(p.Tools, tool.Name()) {
+			allowed = append(allowed, rawTool)
+		}
+	}
+
+	if len(allowed) == 0 {
+		delete(reqJson, "tools")
+		delete(reqJson, "tool_choice")
+		delete(reqJson, "parallel_tool_calls")
+		return nil
+	}
+	return reqJson.Set("tools", allowed)
+}
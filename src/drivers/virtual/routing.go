@@ -0,0 +1,183 @@
+package virtual
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Rule switches a virtual model to another target while its condition holds.
+// A rule sets either Schedule or Provider/MaxInFlight.
+type Rule struct {
+	// Schedule is an optional day range plus a time window, e.g. "Mon-Fri 09:00-18:00",
+	// "Sat,Sun" or "22:00-06:00" (windows may wrap past midnight)
+	Schedule string `json:"schedule,omitempty"`
+	// Provider is the provider whose load is checked
+	Provider string `json:"provider,omitempty"`
+	// MaxInFlight matches once Provider has at least this many requests in flight
+	MaxInFlight int64 `json:"max_in_flight,omitempty"`
+	// Target is the model spec used when the rule matches
+	Target string `json:"target"`
+
+	days       [7]bool
+	start, end int // minutes since midnight; start == end means all day
+}
+
+// Routing holds the ordered rules of a virtual model; the first match wins
+// and the mapped target is used when none match.
+type Routing struct {
+	// Timezone is the IANA zone schedules are evaluated in (default: local time)
+	Timezone string  `json:"timezone,omitempty"`
+	Rules    []*Rule `json:"rules,omitempty"`
+
+	location *time.Location
+}
+
+// LoadFunc reports the number of requests currently in flight for a provider
+type LoadFunc func(provider string) int64
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Provision parses the timezone and schedules.
+func (rt *Routing) Provision() error {
+	rt.location = time.Local
+	if rt.Timezone != "" {
+		loc, err := time.LoadLocation(rt.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone '%s': %w", rt.Timezone, err)
+		}
+		rt.location = loc
+	}
+
+	for i, rule := range rt.Rules {
+		if rule.Target == "" {
+			return fmt.Errorf("rule %d: target is required", i+1)
+		}
+		hasSchedule := rule.Schedule != ""
+		hasLoad := rule.Provider != "" || rule.MaxInFlight > 0
+		if hasSchedule == hasLoad {
+			return fmt.Errorf("rule %d: set either schedule or provider and max_in_flight", i+1)
+		}
+		if hasLoad {
+			if rule.Provider == "" || rule.MaxInFlight <= 0 {
+				return fmt.Errorf("rule %d: load rules need a provider and a positive max_in_flight", i+1)
+			}
+			rule.Provider = strings.ToLower(rule.Provider)
+			continue
+		}
+		if err := rule.parseSchedule(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// parseSchedule parses "[days] [HH:MM-HH:MM]"
+func (r *Rule) parseSchedule() error {
+	fields := strings.Fields(r.Schedule)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("invalid schedule '%s'", r.Schedule)
+	}
+
+	dayPart, timePart := "", ""
+	for _, f := range fields {
+		if strings.Contains(f, ":") {
+			timePart = f
+		} else {
+			dayPart = f
+		}
+	}
+
+	if dayPart == "" {
+		r.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, span := range strings.Split(dayPart, ",") {
+		if span == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(strings.ToLower(span), "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return fmt.Errorf("invalid day '%s' in schedule '%s'", from, r.Schedule)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return fmt.Errorf("invalid day '%s' in schedule '%s'", to, r.Schedule)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			r.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+
+	if timePart != "" {
+		from, to, ok := strings.Cut(timePart, "-")
+		if !ok {
+			return fmt.Errorf("invalid time window '%s' in schedule '%s'", timePart, r.Schedule)
+		}
+		var err error
+		if r.start, err = parseClock(from); err != nil {
+			return err
+		}
+		if r.end, err = parseClock(to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s' (expected HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// matchesTime reports whether t falls within the rule's schedule. For windows
+// wrapping past midnight the day refers to the day the window starts.
+func (r *Rule) matchesTime(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	switch {
+	case r.start == r.end:
+		return r.days[day]
+	case r.start < r.end:
+		return r.days[day] && minute >= r.start && minute < r.end
+	case minute >= r.start:
+		return r.days[day]
+	default:
+		return minute < r.end && r.days[(day+6)%7]
+	}
+}
+
+// Select returns the target of the first matching rule, or fallback when none match.
+func (rt *Routing) Select(now time.Time, load LoadFunc, fallback string) string {
+	if rt == nil {
+		return fallback
+	}
+	if rt.location != nil {
+		now = now.In(rt.location)
+	}
+
+	for _, rule := range rt.Rules {
+		if rule.Schedule != "" {
+			if rule.matchesTime(now) {
+				return rule.Target
+			}
+			continue
+		}
+		if load != nil && load(rule.Provider) >= rule.MaxInFlight {
+			return rule.Target
+		}
+	}
+	return fallback
+}
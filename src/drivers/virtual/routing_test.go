@@ -0,0 +1,67 @@
+package virtual
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoutingSelect(t *testing.T) {
+	rt := &Routing{
+		Timezone: "UTC",
+		Rules: []*Rule{
+			{Provider: "openai", MaxInFlight: 10, Target: "groq/llama-70b"},
+			{Schedule: "Mon-Fri 09:00-18:00", Target: "openai/gpt-4.1"},
+			{Schedule: "Sat,Sun 22:00-06:00", Target: "openai/batch"},
+		},
+	}
+	if err := rt.Provision(); err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+
+	idle := func(string) int64 { return 0 }
+	busy := func(p string) int64 {
+		if p == "openai" {
+			return 10
+		}
+		return 0
+	}
+
+	tests := []struct {
+		name string
+		now  string
+		load LoadFunc
+		want string
+	}{
+		{"business hours", "2026-10-14T10:30:00Z", idle, "openai/gpt-4.1"},
+		{"busy provider wins", "2026-10-14T10:30:00Z", busy, "groq/llama-70b"},
+		{"weekday evening", "2026-10-14T19:00:00Z", idle, "default/model"},
+		{"saturday night", "2026-10-17T23:00:00Z", idle, "openai/batch"},
+		{"after midnight into sunday", "2026-10-18T05:59:00Z", idle, "openai/batch"},
+		{"after midnight into monday", "2026-10-19T05:00:00Z", idle, "openai/batch"},
+		{"tuesday early", "2026-10-20T05:00:00Z", idle, "default/model"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, _ := time.Parse(time.RFC3339, tt.now)
+			if got := rt.Select(now, tt.load, "default/model"); got != tt.want {
+				t.Errorf("Select(%s) = %s, want %s", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutingProvisionErrors(t *testing.T) {
+	bad := []*Routing{
+		{Rules: []*Rule{{Schedule: "Funday", Target: "a/b"}}},
+		{Rules: []*Rule{{Schedule: "09:00", Target: "a/b"}}},
+		{Rules: []*Rule{{Schedule: "Mon", Provider: "x", MaxInFlight: 1, Target: "a/b"}}},
+		{Rules: []*Rule{{Provider: "x", Target: "a/b"}}},
+		{Timezone: "Nowhere/City", Rules: []*Rule{{Schedule: "Mon", Target: "a/b"}}},
+	}
+	for i, rt := range bad {
+		if err := rt.Provision(); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
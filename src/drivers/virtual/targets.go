@@ -0,0 +1,96 @@
+package virtual
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// Target is a single model target of a virtual mapping
+type Target struct {
+	// Model is the target model spec without weight (e.g., "openai/gpt-4o-mini")
+	Model string
+	// Weight is the relative selection weight; targets without one count as 1
+	Weight int
+}
+
+// ParseTargets splits a mapping like "openai/gpt-4o-mini=70,groq/llama-70b=30+logger"
+// into its targets and the shared plugin suffix (including the leading '+').
+// weighted reports whether any target carried an explicit "=weight".
+func ParseTargets(spec string) (targets []Target, pluginSuffix string, weighted bool, err error) {
+	modelPart, suffix, ok := services.CutModelSuffix(spec)
+	if ok {
+		pluginSuffix = "+" + suffix
+	}
+
+	for _, part := range services.SplitModelList(modelPart, ',') {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		t := Target{Model: part, Weight: 1}
+		if model, weightStr, ok := strings.Cut(part, "="); ok {
+			weight, convErr := strconv.Atoi(strings.TrimSpace(weightStr))
+			if convErr != nil || weight < 0 {
+				return nil, "", false, fmt.Errorf("invalid weight '%s' for target '%s'", weightStr, model)
+			}
+			t.Model = strings.TrimSpace(model)
+			t.Weight = weight
+			weighted = true
+		}
+		targets = append(targets, t)
+	}
+
+	if weighted {
+		total := 0
+		for _, t := range targets {
+			total += t.Weight
+		}
+		if total == 0 {
+			return nil, "", false, fmt.Errorf("weights of '%s' sum to zero", modelPart)
+		}
+	}
+
+	return targets, pluginSuffix, weighted, nil
+}
+
+// orderByWeight returns the targets in a weighted random order: the first entry is
+// picked according to weight, the rest follow the same way as fallbacks.
+// Zero-weight targets are only ever used as fallbacks, in their configured order.
+func orderByWeight(targets []Target, intN func(n int) int) []Target {
+	if intN == nil {
+		intN = rand.IntN
+	}
+
+	remaining := make([]Target, 0, len(targets))
+	var zero []Target
+	total := 0
+	for _, t := range targets {
+		if t.Weight == 0 {
+			zero = append(zero, t)
+			continue
+		}
+		remaining = append(remaining, t)
+		total += t.Weight
+	}
+
+	ordered := make([]Target, 0, len(targets))
+	for len(remaining) > 0 {
+		n := intN(total)
+		for i, t := range remaining {
+			if n < t.Weight {
+				ordered = append(ordered, t)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				total -= t.Weight
+				break
+			}
+			n -= t.Weight
+		}
+	}
+
+	return append(ordered, zero...)
+}
@@ -0,0 +1,70 @@
+package virtual
+
+import (
+	"testing"
+)
+
+func TestParseTargets(t *testing.T) {
+	targets, suffix, weighted, err := ParseTargets("openai/gpt-4o-mini=70, groq/llama-70b=30+logger")
+	if err != nil {
+		t.Fatalf("ParseTargets: %v", err)
+	}
+	if !weighted {
+		t.Error("expected weighted targets")
+	}
+	if suffix != "+logger" {
+		t.Errorf("suffix = %q, want %q", suffix, "+logger")
+	}
+	want := []Target{{"openai/gpt-4o-mini", 70}, {"groq/llama-70b", 30}}
+	if len(targets) != len(want) {
+		t.Fatalf("targets = %v, want %v", targets, want)
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Errorf("targets[%d] = %v, want %v", i, targets[i], want[i])
+		}
+	}
+
+	if _, _, weighted, _ := ParseTargets("openai/gpt-4,groq/llama"); weighted {
+		t.Error("plain fallback list should not be weighted")
+	}
+
+	for _, bad := range []string{"openai/gpt-4=x", "openai/gpt-4=-1", "a/b=0,c/d=0"} {
+		if _, _, _, err := ParseTargets(bad); err == nil {
+			t.Errorf("ParseTargets(%q) expected error", bad)
+		}
+	}
+}
+
+func TestOrderByWeight(t *testing.T) {
+	targets := []Target{{"a/x", 70}, {"b/y", 30}, {"c/z", 0}}
+
+	tests := []struct {
+		name  string
+		draws []int
+		want  []string
+	}{
+		{"first target", []int{0, 0}, []string{"a/x", "b/y", "c/z"}},
+		{"upper bound of first", []int{69, 0}, []string{"a/x", "b/y", "c/z"}},
+		{"second target", []int{70, 0}, []string{"b/y", "a/x", "c/z"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draws := tt.draws
+			got := orderByWeight(targets, func(n int) int {
+				d := draws[0]
+				draws = draws[1:]
+				return d
+			})
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i].Model != tt.want[i] {
+					t.Errorf("got[%d] = %s, want %s", i, got[i].Model, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -5,9 +5,11 @@ package virtual
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/neutrome-labs/open-ai-router/src/drivers"
 	"github.com/neutrome-labs/open-ai-router/src/plugin"
@@ -24,8 +26,18 @@ var Logger *zap.Logger = zap.NewNop()
 type VirtualPlugin struct {
 	// ProviderName is the name of this virtual provider
 	ProviderName string
-	// ModelMappings maps virtual model names to target model specs (e.g., "provider/model+plugins")
+	// ModelMappings maps virtual model names to target model specs (e.g., "provider/model+plugins").
+	// A spec may list weighted targets ("openai/gpt-4o-mini=70,groq/llama-70b=30").
 	ModelMappings map[string]string
+	// Presets holds per-model generation settings applied after the rewrite
+	Presets map[string]*Preset
+	// Routing holds per-model schedule and load rules that switch the target
+	Routing map[string]*Routing
+	// Load reports provider in-flight requests for load-based rules
+	Load LoadFunc
+
+	// intN overrides the random source used for weighted selection (tests only)
+	intN func(n int) int
 }
 
 // Name returns the plugin name
@@ -58,12 +70,8 @@ func (v *VirtualPlugin) RecursiveHandler(
 	}
 
 	// Extract plugin suffix from the model name (e.g., "model+plugin1:arg+plugin2" -> "model", "+plugin1:arg+plugin2")
-	baseModel := actualModel
-	pluginSuffix := ""
-	if plusIdx := strings.IndexByte(actualModel, '+'); plusIdx >= 0 {
-		baseModel = actualModel[:plusIdx]
-		pluginSuffix = actualModel[plusIdx:] // includes the leading '+'
-	}
+	spec := plugin.ParseModelSpec(actualModel)
+	baseModel, pluginSuffix := spec.Model, spec.Suffix
 
 	// Look up the target model for this virtual model (using base model without plugins)
 	targetModel, ok := v.ModelMappings[baseModel]
@@ -71,6 +79,30 @@ func (v *VirtualPlugin) RecursiveHandler(
 		return false, nil // Model not in our mappings, let normal flow handle it
 	}
 
+	// Schedule and load rules may switch to another target spec
+	targetModel = v.Routing[baseModel].Select(time.Now(), v.Load, targetModel)
+
+	// Weighted targets: pick one per request, keep the others as fallbacks
+	// Example: target="openai/gpt-4o-mini=70,groq/llama-70b=30+logger"
+	// Result (70% of requests): "openai/gpt-4o-mini,groq/llama-70b+logger"
+	targets, targetSuffix, weighted, err := ParseTargets(targetModel)
+	if err != nil {
+		return true, fmt.Errorf("virtual model %s: %w", baseModel, err)
+	}
+	if weighted {
+		targets = orderByWeight(targets, v.intN)
+		models := make([]string, len(targets))
+		for i, t := range targets {
+			models[i] = t.Model
+		}
+		targetModel = strings.Join(models, ",") + targetSuffix
+	}
+	chosenTarget := ""
+	if len(targets) > 0 {
+		chosenTarget = targets[0].Model
+		w.Header().Set("X-Virtual-Target", chosenTarget)
+	}
+
 	// Merge plugins: target plugins come first, then user plugins
 	// Example: target="openai/gpt-4+logger", user suffix="+skill:kitty"
 	// Result: "openai/gpt-4+logger+skill:kitty"
@@ -81,6 +113,7 @@ func (v *VirtualPlugin) RecursiveHandler(
 		zap.String("virtual_model", baseModel),
 		zap.String("user_plugins", pluginSuffix),
 		zap.String("target_model", targetModel),
+		zap.String("chosen_target", chosenTarget),
 		zap.String("final_model", finalModel))
 
 	// Rewrite model in request to the target with merged plugins
@@ -89,14 +122,24 @@ func (v *VirtualPlugin) RecursiveHandler(
 		return true, err
 	}
 
+	if err := v.Presets[baseModel].Apply(reqJson); err != nil {
+		return true, fmt.Errorf("virtual model %s: %w", baseModel, err)
+	}
+
 	// Marshal the modified request back to JSON
 	newReqBody, err := reqJson.Marshal()
 	if err != nil {
 		return true, err
 	}
 
+	// A mapping that leads back to this virtual model would recurse forever
+	ctx, err := plugin.EnterHop(r.Context(), v.ProviderName+"/"+baseModel)
+	if err != nil {
+		return true, err
+	}
+
 	// Create a new request with the rewritten body
-	newReq := r.Clone(r.Context())
+	newReq := r.Clone(ctx)
 	newReq.Body = io.NopCloser(bytes.NewReader(newReqBody))
 	newReq.ContentLength = int64(len(newReqBody))
 
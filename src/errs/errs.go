@@ -0,0 +1,121 @@
+// Package errs defines the kinds of errors raised while serving a request.
+// Drivers and plugins mark their errors with a kind so that fallback
+// decisions, metrics and client responses can key off errors.Is instead of
+// matching message strings.
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error kinds
+var (
+	// ErrUpstreamStatus marks a provider answering with an error status (see StatusError)
+	ErrUpstreamStatus = errors.New("upstream error status")
+	// ErrUpstream marks other provider failures: malformed responses, errors reported mid-stream
+	ErrUpstream = errors.New("upstream failure")
+	// ErrTimeout marks an upstream call or a request running out of time
+	ErrTimeout = errors.New("timeout")
+	// ErrConversion marks a failed conversion between API styles
+	ErrConversion = errors.New("format conversion failed")
+	// ErrAuth marks failures to authenticate the client or to obtain upstream credentials
+	ErrAuth = errors.New("authentication failed")
+	// ErrPolicy marks requests rejected by the router's policy
+	ErrPolicy = errors.New("rejected by policy")
+	// ErrInvalidRequest marks requests the router cannot process as sent
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrLoop marks requests that recursed too deeply or looped through the same virtual model
+	ErrLoop = errors.New("recursion loop")
+	// ErrStageLimit marks a plugin or conversion exceeding the router's stage limits
+	ErrStageLimit = errors.New("stage limit exceeded")
+	// ErrCapability marks requests needing a capability the provider's model lacks
+	ErrCapability = errors.New("capability not supported")
+	// ErrClientWrite marks failures writing a response to the client, whether the
+	// client went away or the router failed; the provider isn't at fault
+	ErrClientWrite = errors.New("client write failed")
+)
+
+// kinds lists the error kinds with their names, most specific first
+var kinds = []struct {
+	err  error
+	name string
+}{
+	{ErrUpstreamStatus, "upstream_status"},
+	{ErrTimeout, "timeout"},
+	{ErrAuth, "auth"},
+	{ErrPolicy, "policy"},
+	{ErrInvalidRequest, "invalid_request"},
+	{ErrLoop, "loop"},
+	{ErrStageLimit, "stage_limit"},
+	{ErrCapability, "capability"},
+	{ErrClientWrite, "client_write"},
+	{ErrConversion, "conversion"},
+	{ErrUpstream, "upstream"},
+}
+
+// kindError attaches a kind to an error without changing its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// Errorf formats an error like fmt.Errorf and marks it with kind
+func Errorf(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// Wrap marks err with kind; a nil err stays nil
+func Wrap(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// StatusError is returned when a provider answers with a non-200 status.
+// Error returns the upstream body, usually a JSON error object.
+type StatusError struct {
+	Status int
+	Body   string
+	Header http.Header
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return http.StatusText(e.Status)
+	}
+	return e.Body
+}
+
+// Is matches ErrUpstreamStatus
+func (e *StatusError) Is(target error) bool {
+	return target == ErrUpstreamStatus
+}
+
+// Kind names the kind of err for metrics and logs: "upstream_status",
+// "timeout", "auth", "policy", "invalid_request", "loop", "stage_limit",
+// "capability", "conversion", "upstream", "canceled" or "internal" for errors
+// of no known kind
+func Kind(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, k := range kinds {
+		if errors.Is(err, k.err) {
+			return k.name
+		}
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	return "internal"
+}
@@ -0,0 +1,43 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKind(t *testing.T) {
+	tests := map[error]string{
+		&StatusError{Status: 429, Body: "slow down"}:                       "upstream_status",
+		fmt.Errorf("call: %w", &StatusError{Status: 500}):                  "upstream_status",
+		Errorf(ErrInvalidRequest, "tools: invalid messages: %w", errEOF()): "invalid_request",
+		Wrap(ErrTimeout, context.DeadlineExceeded):                         "timeout",
+		fmt.Errorf("read: %w", context.DeadlineExceeded):                   "timeout",
+		Wrap(ErrUpstream, errors.New("bad chunk")):                         "upstream",
+		Errorf(ErrLoop, "loop detected: v/a -> v/a"):                       "loop",
+		context.Canceled:   "canceled",
+		errors.New("boom"): "internal",
+	}
+	for err, want := range tests {
+		if got := Kind(err); got != want {
+			t.Errorf("Kind(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
+
+func TestErrorf_KeepsMessageAndCause(t *testing.T) {
+	cause := errEOF()
+	err := Errorf(ErrConversion, "convert: %w", cause)
+	if err.Error() != "convert: unexpected EOF" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	if !errors.Is(err, ErrConversion) || !errors.Is(err, cause) {
+		t.Error("expected both the kind and the cause to match")
+	}
+	if Wrap(ErrAuth, nil) != nil {
+		t.Error("expected Wrap(nil) to be nil")
+	}
+}
+
+func errEOF() error { return errors.New("unexpected EOF") }
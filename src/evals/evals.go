@@ -0,0 +1,330 @@
+// Package evals runs datasets of prompts with assertions against models and
+// scores the answers, so model and provider changes can be checked in place.
+// Assertions test for a substring, a regular expression, a JSON Schema or the
+// verdict of a judge model.
+package evals
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/neutrome-labs/open-ai-router/src/validate"
+)
+
+// Assertion types
+const (
+	AssertContains    = "contains"
+	AssertNotContains = "not_contains"
+	AssertRegex       = "regex"
+	AssertJSONSchema  = "json_schema"
+	AssertLLMJudge    = "llm_judge"
+)
+
+// DefaultJudgeThreshold is the judge score an answer needs to pass
+const DefaultJudgeThreshold = 0.7
+
+// Dataset is a named set of eval cases
+type Dataset struct {
+	Name  string `json:"name"`
+	Cases []Case `json:"cases"`
+	// JudgeModel grades llm_judge assertions unless the run names another
+	JudgeModel string `json:"judge_model,omitempty"`
+}
+
+// Case is one prompt with the assertions its answer must pass
+type Case struct {
+	Name       string            `json:"name,omitempty"`
+	Messages   []json.RawMessage `json:"messages"`
+	Assertions []Assertion       `json:"assertions"`
+}
+
+// Assertion checks one property of an answer
+type Assertion struct {
+	Type string `json:"type"`
+	// Value is the text of contains and not_contains, the pattern of regex
+	// and the grading criteria of llm_judge
+	Value string `json:"value,omitempty"`
+	// Schema is the JSON Schema of json_schema
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// IgnoreCase makes contains and not_contains case-insensitive
+	IgnoreCase bool `json:"ignore_case,omitempty"`
+	// Threshold is the judge score, 0 to 1, llm_judge needs to pass (default 0.7)
+	Threshold float64 `json:"threshold,omitempty"`
+	// Weight is the assertion's share of the case score (default 1)
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// Validate checks a dataset for missing fields and invalid assertions
+func (d *Dataset) Validate() error {
+	if len(d.Cases) == 0 {
+		return fmt.Errorf("dataset %s: no cases", d.Name)
+	}
+	for i, c := range d.Cases {
+		if len(c.Messages) == 0 {
+			return fmt.Errorf("dataset %s: case %d: messages are required", d.Name, i+1)
+		}
+		for _, a := range c.Assertions {
+			if err := a.validate(); err != nil {
+				return fmt.Errorf("dataset %s: case %d: %w", d.Name, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Assertion) validate() error {
+	switch a.Type {
+	case AssertContains, AssertNotContains, AssertLLMJudge:
+		if a.Value == "" {
+			return fmt.Errorf("%s assertion needs a value", a.Type)
+		}
+	case AssertRegex:
+		if _, err := regexp.Compile(a.Value); err != nil {
+			return fmt.Errorf("regex assertion: %w", err)
+		}
+	case AssertJSONSchema:
+		if len(a.Schema) == 0 {
+			return fmt.Errorf("json_schema assertion needs a schema")
+		}
+	default:
+		return fmt.Errorf("unknown assertion type '%s' (supported: contains, not_contains, regex, json_schema, llm_judge)", a.Type)
+	}
+	if a.Threshold < 0 || a.Threshold > 1 || a.Weight < 0 {
+		return fmt.Errorf("%s assertion: threshold must be between 0 and 1 and weight not negative", a.Type)
+	}
+	return nil
+}
+
+// CompleteFunc sends messages to a model through the router and returns the
+// answer's text
+type CompleteFunc func(ctx context.Context, model string, messages []json.RawMessage) (string, error)
+
+// Report is the scored result of running a dataset
+type Report struct {
+	Dataset string        `json:"dataset"`
+	Models  []ModelReport `json:"models"`
+}
+
+// ModelReport scores one model; Score is the mean of its case scores
+type ModelReport struct {
+	Model  string       `json:"model"`
+	Score  float64      `json:"score"`
+	Passed int          `json:"passed"`
+	Failed int          `json:"failed"`
+	Cases  []CaseResult `json:"cases"`
+}
+
+// CaseResult scores one answer; a case passes when all its assertions do
+type CaseResult struct {
+	Case       string            `json:"case"`
+	Output     string            `json:"output"`
+	Score      float64           `json:"score"`
+	Passed     bool              `json:"passed"`
+	Error      string            `json:"error,omitempty"`
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+}
+
+// AssertionResult is the outcome of one assertion
+type AssertionResult struct {
+	Type   string  `json:"type"`
+	Passed bool    `json:"passed"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+// Run runs every case of a dataset against each model, the models
+// concurrently and the cases of a model one after another
+func Run(ctx context.Context, d *Dataset, models []string, judgeModel string, complete CompleteFunc) *Report {
+	if judgeModel == "" {
+		judgeModel = d.JudgeModel
+	}
+	report := &Report{Dataset: d.Name, Models: make([]ModelReport, len(models))}
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Models[i] = runModel(ctx, d, model, judgeModel, complete)
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func runModel(ctx context.Context, d *Dataset, model, judgeModel string, complete CompleteFunc) ModelReport {
+	mr := ModelReport{Model: model, Cases: make([]CaseResult, 0, len(d.Cases))}
+	total := 0.0
+	for i, c := range d.Cases {
+		name := c.Name
+		if name == "" {
+			name = "case " + strconv.Itoa(i+1)
+		}
+		result := CaseResult{Case: name}
+		output, err := complete(ctx, model, c.Messages)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Output = output
+			result.Score, result.Passed, result.Assertions = scoreCase(ctx, c, output, judgeModel, complete)
+		}
+		if result.Passed {
+			mr.Passed++
+		} else {
+			mr.Failed++
+		}
+		total += result.Score
+		mr.Cases = append(mr.Cases, result)
+	}
+	if len(d.Cases) > 0 {
+		mr.Score = total / float64(len(d.Cases))
+	}
+	return mr
+}
+
+// scoreCase runs a case's assertions on an answer, returning the weighted
+// mean of their scores and whether all passed
+func scoreCase(ctx context.Context, c Case, output, judgeModel string, complete CompleteFunc) (float64, bool, []AssertionResult) {
+	if len(c.Assertions) == 0 {
+		return 1, true, nil
+	}
+	results := make([]AssertionResult, 0, len(c.Assertions))
+	passed := true
+	sum, weights := 0.0, 0.0
+	for _, a := range c.Assertions {
+		r := check(ctx, a, c.Messages, output, judgeModel, complete)
+		weight := a.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		sum += r.Score * weight
+		weights += weight
+		passed = passed && r.Passed
+		results = append(results, r)
+	}
+	return sum / weights, passed, results
+}
+
+// check runs one assertion on an answer
+func check(ctx context.Context, a Assertion, messages []json.RawMessage, output, judgeModel string, complete CompleteFunc) AssertionResult {
+	r := AssertionResult{Type: a.Type}
+	switch a.Type {
+	case AssertContains, AssertNotContains:
+		haystack, needle := output, a.Value
+		if a.IgnoreCase {
+			haystack, needle = strings.ToLower(haystack), strings.ToLower(needle)
+		}
+		r.Passed = strings.Contains(haystack, needle) == (a.Type == AssertContains)
+	case AssertRegex:
+		re, err := regexp.Compile(a.Value)
+		if err != nil {
+			r.Reason = err.Error()
+			break
+		}
+		r.Passed = re.MatchString(output)
+	case AssertJSONSchema:
+		violations, err := validate.ValidateSchema(a.Schema, []byte(stripCodeFence(output)))
+		switch {
+		case err != nil:
+			r.Reason = err.Error()
+		case len(violations) > 0:
+			r.Reason = violations[0].String()
+		default:
+			r.Passed = true
+		}
+	case AssertLLMJudge:
+		return judge(ctx, a, messages, output, judgeModel, complete)
+	default:
+		r.Reason = "unknown assertion type"
+	}
+	if r.Passed {
+		r.Score = 1
+	}
+	return r
+}
+
+// judgeInstructions asks the judge model for a grade it can be parsed from
+const judgeInstructions = "You grade answers. Judge the answer to the conversation below against the criteria. " +
+	"Reply with a score from 0 to 10 on the first line, then one sentence explaining it."
+
+// judgeScorePattern finds the score on the judge's first line
+var judgeScorePattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// judge has the judge model grade an answer against the assertion's criteria
+func judge(ctx context.Context, a Assertion, messages []json.RawMessage, output, judgeModel string, complete CompleteFunc) AssertionResult {
+	r := AssertionResult{Type: a.Type}
+	if judgeModel == "" {
+		r.Reason = "no judge model configured"
+		return r
+	}
+	var conversation strings.Builder
+	for _, raw := range messages {
+		var m struct {
+			Role    string `json:"role"`
+			Content any    `json:"content"`
+		}
+		if json.Unmarshal(raw, &m) == nil {
+			fmt.Fprintf(&conversation, "%s: %s\n", m.Role, contentText(m.Content))
+		}
+	}
+	prompt, _ := json.Marshal(map[string]string{
+		"role":    "user",
+		"content": "Criteria: " + a.Value + "\n\nConversation:\n" + conversation.String() + "\nAnswer:\n" + output,
+	})
+	system, _ := json.Marshal(map[string]string{"role": "system", "content": judgeInstructions})
+
+	verdict, err := complete(ctx, judgeModel, []json.RawMessage{system, prompt})
+	if err != nil {
+		r.Reason = "judge failed: " + err.Error()
+		return r
+	}
+	first, rest, _ := strings.Cut(strings.TrimSpace(verdict), "\n")
+	match := judgeScorePattern.FindString(first)
+	score, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		r.Reason = "unparsable verdict: " + first
+		return r
+	}
+	r.Score = min(max(score/10, 0), 1)
+	threshold := a.Threshold
+	if threshold == 0 {
+		threshold = DefaultJudgeThreshold
+	}
+	r.Passed = r.Score >= threshold
+	r.Reason = strings.TrimSpace(rest)
+	return r
+}
+
+// contentText returns the text of string or multi-part message content
+func contentText(content any) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []any:
+		var parts []string
+		for _, part := range c {
+			if m, ok := part.(map[string]any); ok {
+				if text, ok := m["text"].(string); ok && text != "" {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// stripCodeFence returns the content of a Markdown code block wrapping a
+// whole answer, as models often return JSON in one
+func stripCodeFence(output string) string {
+	trimmed := strings.TrimSpace(output)
+	if !strings.HasPrefix(trimmed, "```") {
+		return output
+	}
+	_, body, _ := strings.Cut(trimmed, "\n")
+	return strings.TrimSuffix(strings.TrimSpace(body), "```")
+}
@@ -0,0 +1,102 @@
+package evals
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+func TestRun(t *testing.T) {
+	dataset := &Dataset{
+		Name:       "smoke",
+		JudgeModel: "judge",
+		Cases: []Case{
+			{
+				Name:     "capital",
+				Messages: []json.RawMessage{json.RawMessage(`{"role": "user", "content": "Capital of France?"}`)},
+				Assertions: []Assertion{
+					{Type: AssertContains, Value: "paris", IgnoreCase: true},
+					{Type: AssertRegex, Value: `^\w+`},
+					{Type: AssertLLMJudge, Value: "names the capital"},
+				},
+			},
+			{
+				Name:     "json",
+				Messages: []json.RawMessage{json.RawMessage(`{"role": "user", "content": "Reply with JSON"}`)},
+				Assertions: []Assertion{
+					{Type: AssertJSONSchema, Schema: json.RawMessage(`{"type": "object", "required": ["ok"], "properties": {"ok": {"type": "boolean"}}}`)},
+				},
+			},
+		},
+	}
+	if err := dataset.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	answers := map[string]string{
+		"good/Capital of France?": "Paris is the capital.",
+		"good/Reply with JSON":    "```json\n{\"ok\": true}\n```",
+		"bad/Capital of France?":  "Lyon, probably.",
+		"bad/Reply with JSON":     `{"ok": "yes"}`,
+	}
+	complete := func(ctx context.Context, model string, messages []json.RawMessage) (string, error) {
+		if model == "judge" {
+			if strings.Contains(string(messages[1]), "Paris") {
+				return "9\nCorrect capital.", nil
+			}
+			return "2\nWrong city.", nil
+		}
+		var m struct {
+			Content string `json:"content"`
+		}
+		_ = json.Unmarshal(messages[0], &m)
+		if answer, ok := answers[model+"/"+m.Content]; ok {
+			return answer, nil
+		}
+		return "", errors.New("unavailable")
+	}
+
+	report := Run(context.Background(), dataset, []string{"good", "bad", "down"}, "", complete)
+	good, bad, down := report.Models[0], report.Models[1], report.Models[2]
+	if good.Passed != 2 || good.Score < 0.9 {
+		t.Errorf("good = %+v, want both cases passed", good)
+	}
+	if bad.Passed != 0 || bad.Cases[1].Assertions[0].Reason == "" {
+		t.Errorf("bad = %+v, want both cases failed with reasons", bad)
+	}
+	if judged := bad.Cases[0].Assertions[2]; judged.Passed || judged.Score != 0.2 || judged.Reason != "Wrong city." {
+		t.Errorf("judge result = %+v", judged)
+	}
+	if down.Failed != 2 || down.Score != 0 || down.Cases[0].Error == "" {
+		t.Errorf("down = %+v, want failed cases with errors", down)
+	}
+
+	invalid := &Dataset{Name: "x", Cases: []Case{{Messages: dataset.Cases[0].Messages, Assertions: []Assertion{{Type: "equals"}}}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected an unknown assertion type to be rejected")
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := &Store{State: services.NewMemoryStateStore(), Prefix: "test:"}
+	dataset := &Dataset{Name: "smoke", Cases: []Case{{Messages: []json.RawMessage{json.RawMessage(`{"role": "user", "content": "hi"}`)}}}}
+	if err := store.Put(dataset); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got, err := store.Get("smoke"); err != nil || len(got.Cases) != 1 {
+		t.Errorf("Get = %+v, %v", got, err)
+	}
+	if err := store.Delete("smoke"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("smoke"); !errors.Is(err, ErrDatasetNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrDatasetNotFound", err)
+	}
+	if names, _ := store.List(); len(names) != 0 {
+		t.Errorf("List = %v", names)
+	}
+}
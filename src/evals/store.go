@@ -0,0 +1,116 @@
+package evals
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// ErrDatasetNotFound is returned for dataset names the store doesn't hold
+var ErrDatasetNotFound = errors.New("dataset not found")
+
+// datasetTTL keeps datasets in the state store, whose entries all expire,
+// for as long as the store itself lives
+const datasetTTL = 100 * 365 * 24 * time.Hour
+
+// datasetNamePattern restricts dataset names to characters safe in URL paths and store keys
+var datasetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// Store keeps datasets in a state store, so instances sharing a store share them
+type Store struct {
+	State  services.StateStore
+	Prefix string // Prepended to the store's keys
+}
+
+// Put stores a dataset, replacing any dataset of the same name
+func (s *Store) Put(d *Dataset) error {
+	if !datasetNamePattern.MatchString(d.Name) {
+		return fmt.Errorf("invalid dataset name '%s'", d.Name)
+	}
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return s.State.Update([]string{s.Prefix + "index", s.datasetKey(d.Name)}, datasetTTL, func(values [][]byte) ([][]byte, error) {
+		var index []string
+		if len(values[0]) > 0 {
+			if err := json.Unmarshal(values[0], &index); err != nil {
+				return nil, err
+			}
+		}
+		if !slices.Contains(index, d.Name) {
+			index = append(index, d.Name)
+		}
+		indexData, err := json.Marshal(index)
+		return [][]byte{indexData, data}, err
+	})
+}
+
+// Get returns a stored dataset
+func (s *Store) Get(name string) (*Dataset, error) {
+	values, err := services.ReadState(s.State, []string{s.datasetKey(name)})
+	if err != nil {
+		return nil, err
+	}
+	var d *Dataset
+	if len(values[0]) > 0 {
+		if err := json.Unmarshal(values[0], &d); err != nil {
+			return nil, err
+		}
+	}
+	if d == nil {
+		return nil, fmt.Errorf("dataset %s: %w", name, ErrDatasetNotFound)
+	}
+	return d, nil
+}
+
+// List returns the names of the stored datasets
+func (s *Store) List() ([]string, error) {
+	values, err := services.ReadState(s.State, []string{s.Prefix + "index"})
+	if err != nil || len(values[0]) == 0 {
+		return nil, err
+	}
+	var index []string
+	return index, json.Unmarshal(values[0], &index)
+}
+
+// Delete removes a stored dataset
+func (s *Store) Delete(name string) error {
+	found := false
+	err := s.State.Update([]string{s.Prefix + "index", s.datasetKey(name)}, datasetTTL, func(values [][]byte) ([][]byte, error) {
+		var index []string
+		if len(values[0]) > 0 {
+			if err := json.Unmarshal(values[0], &index); err != nil {
+				return nil, err
+			}
+		}
+		i := slices.Index(index, name)
+		if i < 0 {
+			return nil, nil
+		}
+		found = true
+		indexData, err := json.Marshal(slices.Delete(index, i, i+1))
+		// State stores can't remove keys; null reads as deleted
+		return [][]byte{indexData, []byte("null")}, err
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("dataset %s: %w", name, ErrDatasetNotFound)
+	}
+	return nil
+}
+
+// datasetKey is the store key of a dataset
+func (s *Store) datasetKey(name string) string {
+	return s.Prefix + "dataset:" + name
+}
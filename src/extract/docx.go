@@ -0,0 +1,75 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDocxXMLSize bounds the uncompressed size of word/document.xml
+const maxDocxXMLSize = 64 << 20
+
+// DOCX extracts the text of a Word (OOXML) document, one paragraph per line.
+func DOCX(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("docx: %w", err)
+	}
+
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("docx: %w", err)
+		}
+		defer rc.Close()
+		return docxText(io.LimitReader(rc, maxDocxXMLSize))
+	}
+	return "", fmt.Errorf("docx: word/document.xml not found")
+}
+
+// docxText walks the document XML: w:t holds text, w:tab and w:br are
+// whitespace and w:p ends a paragraph
+func docxText(r io.Reader) (string, error) {
+	dec := xml.NewDecoder(r)
+	var b strings.Builder
+	inText := false
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return collapseBlankLines(b.String()), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("docx: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteString("\t")
+			case "br", "cr":
+				b.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package extract provides plain text extraction from documents (PDF, DOCX, HTML).
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Document kinds
+const (
+	KindPDF  = "pdf"
+	KindDOCX = "docx"
+	KindHTML = "html"
+	KindText = "text"
+)
+
+// ErrUnsupported is returned for documents of an unknown kind
+var ErrUnsupported = errors.New("unsupported document type")
+
+// Detect returns the document kind from the media type, the file name
+// extension or, as a last resort, the content itself.
+func Detect(mediaType, filename string, data []byte) string {
+	if mediaType != "" {
+		if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+			mediaType = parsed
+		}
+	}
+	switch mediaType {
+	case "application/pdf":
+		return KindPDF
+	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return KindDOCX
+	case "text/html", "application/xhtml+xml":
+		return KindHTML
+	}
+
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".pdf":
+		return KindPDF
+	case ".docx":
+		return KindDOCX
+	case ".html", ".htm", ".xhtml":
+		return KindHTML
+	case ".txt", ".md", ".csv", ".json", ".xml", ".yaml", ".yml":
+		return KindText
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return KindPDF
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) && bytes.Contains(data, []byte("word/document.xml")):
+		return KindDOCX
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return KindText
+	}
+	switch sniffed, _, _ := strings.Cut(http.DetectContentType(data), ";"); sniffed {
+	case "text/html":
+		return KindHTML
+	case "text/plain":
+		return KindText
+	}
+	return ""
+}
+
+// Text extracts the plain text of a document
+func Text(data []byte, mediaType, filename string) (string, error) {
+	switch kind := Detect(mediaType, filename, data); kind {
+	case KindPDF:
+		return PDF(data)
+	case KindDOCX:
+		return DOCX(data)
+	case KindHTML:
+		return HTML(bytes.NewReader(data))
+	case KindText:
+		return string(data), nil
+	default:
+		if mediaType == "" {
+			mediaType = http.DetectContentType(data)
+		}
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, mediaType)
+	}
+}
+
+// collapseBlankLines trims trailing spaces and collapses runs of blank lines
+func collapseBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
@@ -0,0 +1,109 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	doc := `<html><head><title>T</title><style>p{}</style></head>
+<body><h1>Title</h1><p>Hello   <b>world</b>!</p><script>alert(1)</script>
+<ul><li>one</li><li>two</li></ul></body></html>`
+
+	got, err := HTML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("HTML returned error: %v", err)
+	}
+	want := "Title\n\nHello world!\n\n- one\n\n- two"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDOCX(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, _ := zw.Create("word/document.xml")
+	_, _ = f.Write([]byte(`<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>First</w:t></w:r><w:r><w:t xml:space="preserve"> paragraph</w:t></w:r></w:p>
+<w:p><w:r><w:t>Second</w:t><w:tab/><w:t>tabbed</w:t></w:r></w:p>
+</w:body></w:document>`))
+	_ = zw.Close()
+
+	got, err := Text(buf.Bytes(), "", "report.docx")
+	if err != nil {
+		t.Fatalf("Text returned error: %v", err)
+	}
+	want := "First paragraph\nSecond\ttabbed"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// buildPDF assembles a minimal PDF around one content stream
+func buildPDF(content string, flate bool) []byte {
+	data := []byte(content)
+	filter := ""
+	if flate {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+		data = buf.Bytes()
+		filter = " /Filter /FlateDecode"
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	fmt.Fprintf(&b, "4 0 obj\n<< /Length %d%s >>\nstream\n", len(data), filter)
+	b.Write(data)
+	b.WriteString("\nendstream\nendobj\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestPDF(t *testing.T) {
+	content := `BT /F1 12 Tf 72 712 Td (Hello \(PDF\) world) Tj 0 -14 Td [(Sec) -20 (ond) -400 (line)] TJ ET`
+
+	for _, flate := range []bool{false, true} {
+		got, err := Text(buildPDF(content, flate), "application/pdf", "")
+		if err != nil {
+			t.Fatalf("flate=%v: Text returned error: %v", flate, err)
+		}
+		want := "Hello (PDF) world\nSecond line"
+		if got != want {
+			t.Errorf("flate=%v: got %q, want %q", flate, got, want)
+		}
+	}
+}
+
+func TestPDFWithoutText(t *testing.T) {
+	_, err := PDF(buildPDF("q 100 0 0 100 0 0 cm /Im1 Do Q", true))
+	if !errors.Is(err, ErrNoText) {
+		t.Errorf("expected ErrNoText, got %v", err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		mediaType, filename string
+		data                string
+		want                string
+	}{
+		{"application/pdf", "", "", KindPDF},
+		{"", "notes.HTML", "", KindHTML},
+		{"", "", "%PDF-1.7 ...", KindPDF},
+		{"", "", "<!DOCTYPE html><html></html>", KindHTML},
+		{"text/markdown; charset=utf-8", "", "# hi", KindText},
+		{"", "", "\x00\x01\x02", ""},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.mediaType, tt.filename, []byte(tt.data)); got != tt.want {
+			t.Errorf("Detect(%q, %q) = %q, want %q", tt.mediaType, tt.filename, got, tt.want)
+		}
+	}
+}
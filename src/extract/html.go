@@ -0,0 +1,111 @@
+package extract
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skippedElements hold no readable text
+var skippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Head:     true,
+	atom.Iframe:   true,
+}
+
+// blockElements start on a new line
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Tr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Section: true, atom.Article: true, atom.Header: true, atom.Footer: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Table: true, atom.Ul: true, atom.Ol: true,
+	atom.Hr: true, atom.Main: true, atom.Nav: true, atom.Aside: true, atom.Dt: true, atom.Dd: true,
+}
+
+// HTML extracts the readable text of an HTML document: scripts, styles and
+// the head are dropped, block elements become lines and whitespace is collapsed.
+func HTML(r io.Reader) (string, error) {
+	z := html.NewTokenizer(r)
+	var b strings.Builder
+	skip := 0
+	pre := 0
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return "", err
+			}
+			return collapseBlankLines(b.String()), nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if skippedElements[a] && z.Token().Type == html.StartTagToken {
+				skip++
+			}
+			if a == atom.Pre {
+				pre++
+			}
+			if blockElements[a] {
+				b.WriteString("\n")
+			}
+			if a == atom.Li {
+				b.WriteString("- ")
+			}
+			if a == atom.Td || a == atom.Th {
+				b.WriteString("\t")
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if skippedElements[a] && skip > 0 {
+				skip--
+			}
+			if a == atom.Pre && pre > 0 {
+				pre--
+			}
+			if blockElements[a] {
+				b.WriteString("\n")
+			}
+
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			text := string(z.Text())
+			if pre == 0 {
+				text = collapseSpaces(text)
+			}
+			b.WriteString(text)
+		}
+	}
+}
+
+// collapseSpaces replaces runs of whitespace by a single space
+func collapseSpaces(s string) string {
+	if strings.TrimSpace(s) == "" {
+		if s == "" {
+			return ""
+		}
+		return " "
+	}
+	lead := s[0] == ' ' || s[0] == '\n' || s[0] == '\t' || s[0] == '\r'
+	last := s[len(s)-1]
+	trail := last == ' ' || last == '\n' || last == '\t' || last == '\r'
+	out := strings.Join(strings.Fields(s), " ")
+	if lead {
+		out = " " + out
+	}
+	if trail {
+		out += " "
+	}
+	return out
+}
@@ -0,0 +1,409 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// maxPDFStreamSize bounds the decompressed size of a single PDF stream
+const maxPDFStreamSize = 32 << 20
+
+// ErrNoText is returned for documents without extractable text, e.g. scanned PDFs
+var ErrNoText = errors.New("no extractable text")
+
+var pdfStreamRe = regexp.MustCompile(`(?s)obj\s*(<<.*?>>)\s*stream\r?\n`)
+
+// PDF extracts the text shown by the content streams of a PDF document.
+//
+// This is a lightweight extractor: it decodes uncompressed and FlateDecode
+// streams and reads the text operators, which covers most generated PDFs.
+// Encrypted documents, scanned pages and fonts with custom encodings (e.g.
+// Identity-H) yield ErrNoText or an error.
+func PDF(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", fmt.Errorf("pdf: not a PDF document")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", fmt.Errorf("pdf: encrypted documents are not supported")
+	}
+
+	var b strings.Builder
+	for _, loc := range pdfStreamRe.FindAllSubmatchIndex(data, -1) {
+		dict := data[loc[2]:loc[3]]
+		if i := bytes.LastIndex(dict, []byte("obj")); i >= 0 {
+			dict = dict[i+len("obj"):] // the match started at an earlier object
+		}
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		raw := streamData(dict, data[start:start+end])
+
+		if !isContentStream(dict) {
+			continue
+		}
+		content, err := decodePDFStream(dict, raw)
+		if err != nil {
+			continue
+		}
+		b.WriteString(pdfContentText(content))
+		b.WriteString("\n")
+	}
+
+	text := collapseBlankLines(b.String())
+	if text == "" || !mostlyPrintable(text) {
+		return "", fmt.Errorf("pdf: %w", ErrNoText)
+	}
+	return text, nil
+}
+
+var pdfLengthRe = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+
+// streamData cuts the stream data at its direct /Length, or else before the
+// end-of-line marker preceding "endstream"
+func streamData(dict, data []byte) []byte {
+	if m := pdfLengthRe.FindSubmatch(dict); m != nil && len(m[2]) == 0 {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && n <= len(data) {
+			return data[:n]
+		}
+	}
+	if trimmed, ok := bytes.CutSuffix(data, []byte("\r\n")); ok {
+		return trimmed
+	}
+	if trimmed, ok := bytes.CutSuffix(data, []byte("\n")); ok {
+		return trimmed
+	}
+	return bytes.TrimSuffix(data, []byte("\r"))
+}
+
+// isContentStream skips streams that never hold page text
+func isContentStream(dict []byte) bool {
+	if pdfFontFileRe.Match(dict) {
+		return false
+	}
+	compact := bytes.ReplaceAll(dict, []byte(" "), nil)
+	for _, marker := range []string{"/Subtype/Image", "/Type/XRef", "/Type/ObjStm", "/Type/Metadata", "/Subtype/Type1C", "/Subtype/CIDFontType0C", "/Subtype/OpenType"} {
+		if bytes.Contains(compact, []byte(marker)) {
+			return false
+		}
+	}
+	return true
+}
+
+// pdfFontFileRe matches the length keys of embedded font programs
+var pdfFontFileRe = regexp.MustCompile(`/Length[123]\b`)
+
+// decodePDFStream applies the stream's filter; only FlateDecode is supported
+func decodePDFStream(dict, raw []byte) ([]byte, error) {
+	if !bytes.Contains(dict, []byte("/Filter")) {
+		return raw, nil
+	}
+	compact := bytes.ReplaceAll(dict, []byte(" "), nil)
+	if !bytes.Contains(compact, []byte("/Filter/FlateDecode")) && !bytes.Contains(compact, []byte("/Filter[/FlateDecode]")) {
+		return nil, fmt.Errorf("pdf: unsupported stream filter")
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, maxPDFStreamSize))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// pdfContentText interprets the text operators of a content stream
+func pdfContentText(content []byte) string {
+	var b strings.Builder
+	var operands []any
+	lex := &pdfLexer{data: content}
+
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			break
+		}
+		op, isOp := tok.(pdfOperator)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch op {
+		case "ET", "T*":
+			b.WriteString("\n")
+		case "Td", "TD":
+			if len(operands) == 2 {
+				if ty, ok := operands[1].(float64); ok && ty != 0 {
+					b.WriteString("\n")
+				} else if tx, ok := operands[0].(float64); ok && tx > 0 {
+					b.WriteString(" ")
+				}
+			}
+		case "Tm":
+			b.WriteString("\n")
+		case "Tj", "'", "\"":
+			if op != "Tj" {
+				b.WriteString("\n")
+			}
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					b.WriteString(decodePDFString(s))
+				}
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				if arr, ok := operands[len(operands)-1].([]any); ok {
+					for _, item := range arr {
+						switch v := item.(type) {
+						case pdfString:
+							b.WriteString(decodePDFString(v))
+						case float64:
+							if v < -250 {
+								b.WriteString(" ")
+							}
+						}
+					}
+				}
+			}
+		case "ID":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	return b.String()
+}
+
+// decodePDFString decodes UTF-16BE strings (with BOM) and treats other strings as Latin-1
+func decodePDFString(s pdfString) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	runes := make([]rune, 0, len(s))
+	for _, c := range s {
+		runes = append(runes, rune(c))
+	}
+	return string(runes)
+}
+
+// mostlyPrintable rejects text decoded with the wrong encoding
+func mostlyPrintable(s string) bool {
+	total, bad := 0, 0
+	for _, r := range s {
+		total++
+		if r == unicode.ReplacementChar || (!unicode.IsPrint(r) && !unicode.IsSpace(r)) {
+			bad++
+		}
+	}
+	return total > 0 && bad*10 < total
+}
+
+type (
+	pdfOperator string
+	pdfString   []byte
+	pdfName     string
+)
+
+// pdfLexer tokenizes PDF content streams into numbers, strings, names,
+// arrays and operators
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *pdfLexer) next() (any, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '(':
+		return l.literalString(), true
+	case c == '<' && l.peek(1) == '<':
+		l.pos += 2
+		return pdfOperator("<<"), true
+	case c == '>' && l.peek(1) == '>':
+		l.pos += 2
+		return pdfOperator(">>"), true
+	case c == '<':
+		return l.hexString(), true
+	case c == '[':
+		l.pos++
+		var arr []any
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return arr, true
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, true
+			}
+			tok, ok := l.next()
+			if !ok {
+				return arr, true
+			}
+			arr = append(arr, tok)
+		}
+	case c == ']' || c == '{' || c == '}' || c == ')' || c == '>':
+		l.pos++
+		return pdfOperator(string(c)), true
+	case c == '/':
+		start := l.pos
+		l.pos++
+		for l.pos < len(l.data) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(l.data[start+1 : l.pos]), true
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return n, true
+	}
+	return pdfOperator(word), true
+}
+
+func (l *pdfLexer) peek(offset int) byte {
+	if l.pos+offset < len(l.data) {
+		return l.data[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.peek(0) == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++ // <
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++ // >
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i+1 < len(digits); i += 2 {
+		v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			return out
+		}
+		out = append(out, byte(v))
+	}
+	return out
+}
+
+// skipInlineImage skips inline image data up to the EI operator
+func (l *pdfLexer) skipInlineImage() {
+	if idx := bytes.Index(l.data[l.pos:], []byte("EI")); idx >= 0 {
+		l.pos += idx + 2
+	} else {
+		l.pos = len(l.data)
+	}
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return isPDFSpace(c) || strings.IndexByte("()<>[]{}/%", c) >= 0
+}
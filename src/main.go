@@ -4,6 +4,7 @@ import (
 	caddycmd "github.com/caddyserver/caddy/v2/cmd"
 
 	_ "github.com/caddyserver/caddy/v2/modules/standard"
+	_ "github.com/neutrome-labs/open-ai-router/src/commands"
 	_ "github.com/neutrome-labs/open-ai-router/src/modules"
 	_ "github.com/neutrome-labs/open-ai-router/src/modules/server"
 )
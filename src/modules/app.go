@@ -0,0 +1,767 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+	"github.com/neutrome-labs/open-ai-router/src/tools"
+	"go.uber.org/zap"
+)
+
+// AIApp holds process-wide defaults for the AI modules, configured through the
+// global `ai` options block. Values set here take precedence over the
+// POSTHOG_* environment variables.
+type AIApp struct {
+	// PosthogAPIKey enables PostHog observability (may be a secret reference)
+	PosthogAPIKey string `json:"posthog_api_key,omitempty"`
+	// PosthogBaseURL overrides the PostHog endpoint
+	PosthogBaseURL string `json:"posthog_base_url,omitempty"`
+	// PosthogProjects are additional PostHog projects by name, selected per
+	// key or per router
+	PosthogProjects map[string]*services.PosthogProject `json:"posthog_projects,omitempty"`
+	// PosthogBatchSize is the number of events sent to PostHog per request
+	PosthogBatchSize int `json:"posthog_batch_size,omitempty"`
+	// PosthogFlushInterval is the longest an event waits before being sent
+	PosthogFlushInterval caddy.Duration `json:"posthog_flush_interval,omitempty"`
+	// ContentLogging controls whether message content is sent to observability sinks: "none" or "full"
+	ContentLogging string `json:"content_logging,omitempty"`
+	// PricingFile is a JSON file with per-model prices used for cost reporting
+	PricingFile string `json:"pricing_file,omitempty"`
+	// Timeout is the default deadline for upstream provider requests
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+	// MaxEventSize caps the size of one upstream SSE event in bytes (default: 1MB)
+	MaxEventSize int `json:"max_event_size,omitempty"`
+	// ValidateResponses checks every response against the bundled API schemas:
+	// "log" logs violations, "flag" also reports them in extras.validation
+	ValidateResponses string `json:"validate_responses,omitempty"`
+	// WebTool configures the built-in web tool used by the tools plugin
+	WebTool *tools.WebConfig `json:"web_tool,omitempty"`
+	// CodeTool enables the built-in code execution tool used by the tools plugin
+	CodeTool *tools.CodeConfig `json:"code_tool,omitempty"`
+	// TeeStorage is the S3-compatible object store receiving responses copied
+	// by the tee plugin (credentials may be secret references)
+	TeeStorage *services.ObjectStoreConfig `json:"tee_storage,omitempty"`
+	// StorageEncryption encrypts the conversation data the router stores,
+	// such as tee captures, with per-tenant keys
+	StorageEncryption *services.EncryptionConfig `json:"storage_encryption,omitempty"`
+	// Retention is how long stored data is kept
+	Retention *RetentionConfig `json:"retention,omitempty"`
+	// StateStores opens state stores by name from a DSN, "memory" or
+	// "bolt:<path>", for modules to select with their store option
+	StateStores map[string]string `json:"state_stores,omitempty"`
+
+	logger      *zap.Logger
+	stateStores map[string]services.StateStore
+	closeStores []func() error
+	teeStore    *services.ObjectStore
+	retention   *services.Retention
+	stopPurging context.CancelFunc
+}
+
+// RetentionConfig sets how long the router keeps the data it stores
+type RetentionConfig struct {
+	// Captures is how long tee captures are kept (default: forever)
+	Captures caddy.Duration `json:"captures,omitempty"`
+	// Usage is how long usage ledger hours are kept (default: 35 days)
+	Usage caddy.Duration `json:"usage,omitempty"`
+	// PurgeInterval is how often expired captures are removed (default: 1h)
+	PurgeInterval caddy.Duration `json:"purge_interval,omitempty"`
+}
+
+func (*AIApp) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "ai",
+		New: func() caddy.Module { return new(AIApp) },
+	}
+}
+
+func (a *AIApp) Provision(ctx caddy.Context) error {
+	a.logger = ctx.Logger(a)
+
+	batching := services.EventBatching{BatchSize: a.PosthogBatchSize, FlushInterval: time.Duration(a.PosthogFlushInterval)}
+	services.SetPosthogBatching(batching)
+	if a.PosthogAPIKey != "" {
+		key, err := services.ResolveSecret(a.PosthogAPIKey)
+		if err != nil {
+			return fmt.Errorf("ai: posthog_api_key: %v", err)
+		}
+		if err := services.ConfigureObservability(key, a.PosthogBaseURL); err != nil {
+			return fmt.Errorf("ai: configuring posthog: %v", err)
+		}
+	} else if batching != (services.EventBatching{}) {
+		// Re-create the client configured from the environment with the batching
+		services.TryInstrumentAppObservability()
+	}
+	for name, project := range a.PosthogProjects {
+		key, err := services.ResolveSecret(project.APIKey)
+		if err != nil {
+			return fmt.Errorf("ai: posthog_project %s: api_key: %v", name, err)
+		}
+		resolved := *project
+		resolved.APIKey = key
+		if err := services.ConfigurePosthogProject(name, resolved); err != nil {
+			return fmt.Errorf("ai: %v", err)
+		}
+	}
+
+	switch a.ContentLogging {
+	case "":
+	case "none":
+		services.PosthogIncludeContent = false
+	case "full":
+		services.PosthogIncludeContent = true
+	default:
+		return fmt.Errorf("ai: content_logging must be 'none' or 'full', got '%s'", a.ContentLogging)
+	}
+
+	if a.PricingFile != "" {
+		if err := services.LoadPricingFile(a.PricingFile); err != nil {
+			return fmt.Errorf("ai: %v", err)
+		}
+	}
+
+	a.stateStores = make(map[string]services.StateStore)
+	for name, dsn := range a.StateStores {
+		if name == "" || strings.EqualFold(name, "memory") {
+			return fmt.Errorf("ai: state_store: invalid name '%s'", name)
+		}
+		store, closeStore, err := services.OpenStateStore(dsn)
+		if err != nil {
+			return fmt.Errorf("ai: state_store %s: %v", name, err)
+		}
+		a.closeStores = append(a.closeStores, closeStore)
+		a.stateStores[name] = store
+		services.RegisterStateStore(name, store)
+	}
+
+	services.SetDefaultUpstreamTimeout(time.Duration(a.Timeout))
+	sse.SetDefaultMaxEventSize(a.MaxEventSize)
+
+	switch a.ValidateResponses {
+	case "":
+	case "log", "flag":
+		enableTailPlugin("validate", a.ValidateResponses)
+	default:
+		return fmt.Errorf("ai: validate_responses must be 'log' or 'flag', got '%s'", a.ValidateResponses)
+	}
+
+	if a.WebTool != nil {
+		tools.RegisterTool(tools.NewWeb(*a.WebTool))
+	}
+	if a.CodeTool != nil {
+		code, err := tools.NewCode(*a.CodeTool)
+		if err != nil {
+			return fmt.Errorf("ai: %v", err)
+		}
+		tools.RegisterTool(code)
+	}
+
+	if a.TeeStorage != nil {
+		cfg := *a.TeeStorage
+		for _, field := range []*string{&cfg.Endpoint, &cfg.AccessKey, &cfg.SecretKey} {
+			resolved, err := services.ResolveSecret(*field)
+			if err != nil {
+				return fmt.Errorf("ai: tee_storage: %v", err)
+			}
+			*field = resolved
+		}
+		store, err := services.NewObjectStore(cfg, a.logger.Named("tee"))
+		if err != nil {
+			return fmt.Errorf("ai: tee_storage: %v", err)
+		}
+		if store.Encryptor, err = a.StorageEncryptor(); err != nil {
+			store.Close()
+			return fmt.Errorf("ai: storage_encryption: %v", err)
+		}
+		a.teeStore = store
+		services.SetTeeStore(store)
+	}
+
+	if a.Retention != nil {
+		if a.Retention.Captures > 0 && a.teeStore == nil {
+			return fmt.Errorf("ai: retention: captures requires tee_storage")
+		}
+		a.retention = &services.Retention{
+			Captures: time.Duration(a.Retention.Captures),
+			Usage:    time.Duration(a.Retention.Usage),
+		}
+		services.SetRetention(a.retention)
+	}
+
+	a.logger.Info("Provisioned AI defaults",
+		zap.Bool("posthog", a.PosthogAPIKey != ""),
+		zap.Int("posthog_projects", len(a.PosthogProjects)),
+		zap.Bool("include_content", services.PosthogIncludeContent),
+		zap.String("pricing_file", a.PricingFile),
+		zap.Duration("timeout", time.Duration(a.Timeout)),
+		zap.Int("max_event_size", a.MaxEventSize),
+		zap.String("validate_responses", a.ValidateResponses),
+		zap.Bool("web_tool_configured", a.WebTool != nil),
+		zap.Bool("code_tool", a.CodeTool != nil),
+		zap.Bool("tee_storage", a.TeeStorage != nil),
+		zap.Bool("storage_encryption", a.StorageEncryption != nil),
+		zap.Bool("retention", a.Retention != nil),
+		zap.Int("state_stores", len(a.StateStores)))
+	return nil
+}
+
+// StorageEncryptor returns the encryptor of stored data, or nil when
+// storage_encryption isn't configured
+func (a *AIApp) StorageEncryptor() (*services.Encryptor, error) {
+	if a.StorageEncryption == nil {
+		return nil, nil
+	}
+	cfg := *a.StorageEncryption
+	if cfg.KMS != nil {
+		kms := *cfg.KMS
+		for _, field := range []*string{&kms.AccessKey, &kms.SecretKey} {
+			resolved, err := services.ResolveSecret(*field)
+			if err != nil {
+				return nil, err
+			}
+			*field = resolved
+		}
+		cfg.KMS = &kms
+	}
+	return services.NewEncryptor(cfg)
+}
+
+// Start runs the purge of expired captures
+func (a *AIApp) Start() error {
+	if a.retention == nil || a.retention.Captures <= 0 {
+		return nil
+	}
+	interval := time.Duration(a.Retention.PurgeInterval)
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopPurging = cancel
+	go services.RunCapturePurge(ctx, a.teeStore, a.retention.Captures, interval, a.logger.Named("retention"))
+	return nil
+}
+
+// Stop ends the capture purge and flushes the responses still queued for
+// tee storage
+func (a *AIApp) Stop() error {
+	if a.stopPurging != nil {
+		a.stopPurging()
+	}
+	if a.retention != nil {
+		services.ClearRetention(a.retention)
+	}
+	if a.teeStore != nil {
+		services.ClearTeeStore(a.teeStore)
+		a.teeStore.Close()
+	}
+	return nil
+}
+
+// Cleanup closes the state stores opened by the config, once the modules
+// using them are stopped
+func (a *AIApp) Cleanup() error {
+	for name, store := range a.stateStores {
+		services.UnregisterStateStore(name, store)
+	}
+	for _, closeStore := range a.closeStores {
+		if err := closeStore(); err != nil {
+			a.logger.Error("closing state store failed", zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// enableTailPlugin runs a plugin after all others on every request, replacing
+// its params if it is already enabled
+func enableTailPlugin(name, params string) {
+	for i, mp := range plugin.TailPlugins {
+		if mp[0] == name {
+			plugin.TailPlugins[i][1] = params
+			return
+		}
+	}
+	plugin.TailPlugins = append(plugin.TailPlugins, [2]string{name, params})
+}
+
+// EnsureAIApp provisions the global `ai` app (if configured) before a handler
+// relies on the defaults it installs, such as its state stores
+func EnsureAIApp(ctx caddy.Context) error {
+	_, err := ctx.AppIfConfigured("ai")
+	if errors.Is(err, caddy.ErrNotConfigured) {
+		return nil
+	}
+	return err
+}
+
+// parseAIGlobalOption parses the global `ai` options block:
+//
+//	{
+//		ai {
+//			posthog_api_key {env.POSTHOG_API_KEY}
+//			posthog_base_url https://eu.posthog.com
+//			posthog_project team-a {
+//				api_key {env.TEAM_A_POSTHOG_KEY}
+//				base_url https://eu.posthog.com
+//				keys team-a:*
+//			}
+//			posthog_batch_size 100
+//			posthog_flush_interval 2s
+//			content_logging none|full
+//			pricing_file /etc/ai/pricing.json
+//			timeout 2m
+//			max_event_size 1048576
+//			validate_responses log|flag
+//			web_tool {
+//				allow_domains example.com docs.example.org
+//				deny_domains internal.example.com
+//				max_bytes 2097152
+//				max_chars 20000
+//				cache_ttl 5m
+//				timeout 15s
+//			}
+//			code_tool {
+//				backend docker|process
+//				allow_unsafe_process
+//				keys team-a:* admin
+//				languages python bash
+//				timeout 10s
+//				memory_mb 256
+//				max_output_bytes 65536
+//				max_concurrent 4
+//				image python:3.12-slim
+//			}
+//			tee_storage {
+//				endpoint https://s3.eu-west-1.amazonaws.com
+//				bucket ai-traces
+//				region eu-west-1
+//				access_key {env.AWS_ACCESS_KEY_ID}
+//				secret_key {env.AWS_SECRET_ACCESS_KEY}
+//				prefix router/
+//				queue_size 1000
+//			}
+//			storage_encryption {
+//				key_file /etc/ai/storage.keys
+//				kms_region eu-west-1
+//				kms_endpoint https://kms.eu-west-1.amazonaws.com
+//				access_key {env.AWS_ACCESS_KEY_ID}
+//				secret_key {env.AWS_SECRET_ACCESS_KEY}
+//				default_key alias/ai-router
+//				tenant_key team-a arn:aws:kms:eu-west-1:111122223333:key/...
+//			}
+//			retention {
+//				captures 30d
+//				usage 90d
+//				purge_interval 1h
+//			}
+//			state_store durable bolt:/var/lib/ai-router/state.db
+//		}
+//	}
+func parseAIGlobalOption(d *caddyfile.Dispenser, _ any) (any, error) {
+	app := new(AIApp)
+	for d.Next() {
+		for d.NextBlock(0) {
+			opt := d.Val()
+			if opt == "web_tool" {
+				webTool, err := parseWebToolBlock(d)
+				if err != nil {
+					return nil, err
+				}
+				app.WebTool = webTool
+				continue
+			}
+			if opt == "posthog_project" {
+				name, project, err := parsePosthogProjectBlock(d)
+				if err != nil {
+					return nil, err
+				}
+				if app.PosthogProjects == nil {
+					app.PosthogProjects = make(map[string]*services.PosthogProject)
+				}
+				app.PosthogProjects[name] = project
+				continue
+			}
+			if opt == "tee_storage" {
+				teeStorage, err := parseTeeStorageBlock(d)
+				if err != nil {
+					return nil, err
+				}
+				app.TeeStorage = teeStorage
+				continue
+			}
+			if opt == "storage_encryption" {
+				encryption, err := parseStorageEncryptionBlock(d)
+				if err != nil {
+					return nil, err
+				}
+				app.StorageEncryption = encryption
+				continue
+			}
+			if opt == "retention" {
+				retention, err := parseRetentionBlock(d)
+				if err != nil {
+					return nil, err
+				}
+				app.Retention = retention
+				continue
+			}
+			if opt == "code_tool" {
+				codeTool, err := parseCodeToolBlock(d)
+				if err != nil {
+					return nil, err
+				}
+				app.CodeTool = codeTool
+				continue
+			}
+			if opt == "state_store" {
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return nil, d.ArgErr()
+				}
+				if app.StateStores == nil {
+					app.StateStores = make(map[string]string)
+				}
+				app.StateStores[args[0]] = args[1]
+				continue
+			}
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			switch opt {
+			case "posthog_api_key":
+				app.PosthogAPIKey = d.Val()
+			case "posthog_base_url":
+				app.PosthogBaseURL = d.Val()
+			case "posthog_batch_size":
+				n, err := strconv.Atoi(d.Val())
+				if err != nil || n <= 0 {
+					return nil, d.Errf("invalid posthog_batch_size '%s'", d.Val())
+				}
+				app.PosthogBatchSize = n
+			case "posthog_flush_interval":
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil || dur <= 0 {
+					return nil, d.Errf("invalid posthog_flush_interval '%s'", d.Val())
+				}
+				app.PosthogFlushInterval = caddy.Duration(dur)
+			case "content_logging":
+				app.ContentLogging = d.Val()
+			case "pricing_file":
+				app.PricingFile = d.Val()
+			case "timeout":
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return nil, d.Errf("invalid timeout '%s': %v", d.Val(), err)
+				}
+				app.Timeout = caddy.Duration(dur)
+			case "validate_responses":
+				app.ValidateResponses = d.Val()
+			case "max_event_size":
+				n, err := strconv.Atoi(d.Val())
+				if err != nil || n <= 0 {
+					return nil, d.Errf("invalid max_event_size '%s'", d.Val())
+				}
+				app.MaxEventSize = n
+			default:
+				return nil, d.Errf("unrecognized ai option '%s'", opt)
+			}
+			if d.NextArg() {
+				return nil, d.ArgErr()
+			}
+		}
+	}
+
+	return httpcaddyfile.App{
+		Name:  "ai",
+		Value: caddyconfig.JSON(app, nil),
+	}, nil
+}
+
+// parsePosthogProjectBlock parses a `posthog_project <name> { ... }` block of
+// the `ai` options
+func parsePosthogProjectBlock(d *caddyfile.Dispenser) (string, *services.PosthogProject, error) {
+	if !d.NextArg() {
+		return "", nil, d.ArgErr()
+	}
+	name := d.Val()
+	if d.NextArg() {
+		return "", nil, d.ArgErr()
+	}
+	project := &services.PosthogProject{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return "", nil, d.ArgErr()
+		}
+		switch opt {
+		case "api_key":
+			project.APIKey = args[0]
+		case "base_url":
+			project.BaseURL = args[0]
+		case "keys":
+			project.Keys = append(project.Keys, args...)
+		default:
+			return "", nil, d.Errf("unrecognized posthog_project option '%s'", opt)
+		}
+	}
+	if project.APIKey == "" {
+		return "", nil, d.Errf("posthog_project %s: api_key is required", name)
+	}
+	return name, project, nil
+}
+
+// parseWebToolBlock parses the `web_tool { ... }` block of the `ai` options
+func parseWebToolBlock(d *caddyfile.Dispenser) (*tools.WebConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	cfg := &tools.WebConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "allow_domains":
+			cfg.AllowDomains = append(cfg.AllowDomains, args...)
+		case "deny_domains":
+			cfg.DenyDomains = append(cfg.DenyDomains, args...)
+		case "max_bytes", "max_chars":
+			if len(args) != 1 {
+				return nil, d.ArgErr()
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return nil, d.Errf("invalid %s '%s'", opt, args[0])
+			}
+			if opt == "max_bytes" {
+				cfg.MaxBytes = n
+			} else {
+				cfg.MaxChars = n
+			}
+		case "cache_ttl", "timeout":
+			if len(args) != 1 {
+				return nil, d.ArgErr()
+			}
+			dur, err := caddy.ParseDuration(args[0])
+			if err != nil {
+				return nil, d.Errf("invalid %s '%s': %v", opt, args[0], err)
+			}
+			if opt == "cache_ttl" {
+				cfg.CacheTTL = caddy.Duration(dur)
+			} else {
+				cfg.Timeout = caddy.Duration(dur)
+			}
+		default:
+			return nil, d.Errf("unrecognized web_tool option '%s'", opt)
+		}
+	}
+	return cfg, nil
+}
+
+// parseTeeStorageBlock parses the `tee_storage { ... }` block of the `ai` options
+func parseTeeStorageBlock(d *caddyfile.Dispenser) (*services.ObjectStoreConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	cfg := &services.ObjectStoreConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if len(args) != 1 {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "endpoint":
+			cfg.Endpoint = args[0]
+		case "bucket":
+			cfg.Bucket = args[0]
+		case "region":
+			cfg.Region = args[0]
+		case "access_key":
+			cfg.AccessKey = args[0]
+		case "secret_key":
+			cfg.SecretKey = args[0]
+		case "prefix":
+			cfg.Prefix = args[0]
+		case "queue_size":
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return nil, d.Errf("invalid queue_size '%s'", args[0])
+			}
+			cfg.QueueSize = n
+		default:
+			return nil, d.Errf("unrecognized tee_storage option '%s'", opt)
+		}
+	}
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, d.Err("tee_storage: endpoint and bucket are required")
+	}
+	return cfg, nil
+}
+
+// parseStorageEncryptionBlock parses the `storage_encryption { ... }` block
+// of the `ai` options; any kms_* or credential option selects AWS KMS
+func parseStorageEncryptionBlock(d *caddyfile.Dispenser) (*services.EncryptionConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	cfg := &services.EncryptionConfig{}
+	kms := &services.KMSConfig{}
+	useKMS := false
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if opt == "tenant_key" {
+			if len(args) != 2 {
+				return nil, d.ArgErr()
+			}
+			if cfg.TenantKeys == nil {
+				cfg.TenantKeys = make(map[string]string)
+			}
+			cfg.TenantKeys[args[0]] = args[1]
+			continue
+		}
+		if len(args) != 1 {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "key_file":
+			cfg.KeyFile = args[0]
+		case "default_key":
+			cfg.DefaultKey = args[0]
+		case "kms_region":
+			kms.Region, useKMS = args[0], true
+		case "kms_endpoint":
+			kms.Endpoint, useKMS = args[0], true
+		case "access_key":
+			kms.AccessKey, useKMS = args[0], true
+		case "secret_key":
+			kms.SecretKey, useKMS = args[0], true
+		default:
+			return nil, d.Errf("unrecognized storage_encryption option '%s'", opt)
+		}
+	}
+	if useKMS {
+		cfg.KMS = kms
+	}
+	if (cfg.KeyFile == "") == (cfg.KMS == nil) {
+		return nil, d.Err("storage_encryption: either key_file or kms_region is required")
+	}
+	return cfg, nil
+}
+
+// parseRetentionBlock parses the `retention { ... }` block of the `ai` options
+func parseRetentionBlock(d *caddyfile.Dispenser) (*RetentionConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	cfg := &RetentionConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		if !d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		dur, err := caddy.ParseDuration(d.Val())
+		if err != nil || dur <= 0 {
+			return nil, d.Errf("invalid %s '%s'", opt, d.Val())
+		}
+		switch opt {
+		case "captures":
+			cfg.Captures = caddy.Duration(dur)
+		case "usage":
+			cfg.Usage = caddy.Duration(dur)
+		case "purge_interval":
+			cfg.PurgeInterval = caddy.Duration(dur)
+		default:
+			return nil, d.Errf("unrecognized retention option '%s'", opt)
+		}
+		if d.NextArg() {
+			return nil, d.ArgErr()
+		}
+	}
+	return cfg, nil
+}
+
+// parseCodeToolBlock parses the `code_tool { ... }` block of the `ai` options
+func parseCodeToolBlock(d *caddyfile.Dispenser) (*tools.CodeConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	cfg := &tools.CodeConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if opt == "allow_unsafe_process" {
+			if len(args) != 0 {
+				return nil, d.ArgErr()
+			}
+			cfg.AllowUnsafeProcess = true
+			continue
+		}
+		if len(args) == 0 {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "keys":
+			cfg.Keys = append(cfg.Keys, args...)
+		case "languages":
+			cfg.Languages = append(cfg.Languages, args...)
+		case "backend", "image":
+			if len(args) != 1 {
+				return nil, d.ArgErr()
+			}
+			if opt == "backend" {
+				cfg.Backend = args[0]
+			} else {
+				cfg.Image = args[0]
+			}
+		case "memory_mb", "max_output_bytes", "max_concurrent":
+			if len(args) != 1 {
+				return nil, d.ArgErr()
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return nil, d.Errf("invalid %s '%s'", opt, args[0])
+			}
+			switch opt {
+			case "memory_mb":
+				cfg.MemoryMB = n
+			case "max_output_bytes":
+				cfg.MaxOutputBytes = n
+			default:
+				cfg.MaxConcurrent = n
+			}
+		case "timeout":
+			if len(args) != 1 {
+				return nil, d.ArgErr()
+			}
+			dur, err := caddy.ParseDuration(args[0])
+			if err != nil {
+				return nil, d.Errf("invalid timeout '%s': %v", args[0], err)
+			}
+			cfg.Timeout = caddy.Duration(dur)
+		default:
+			return nil, d.Errf("unrecognized code_tool option '%s'", opt)
+		}
+	}
+	return cfg, nil
+}
+
+var (
+	_ caddy.App          = (*AIApp)(nil)
+	_ caddy.Provisioner  = (*AIApp)(nil)
+	_ caddy.CleanerUpper = (*AIApp)(nil)
+)
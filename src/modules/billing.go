@@ -0,0 +1,135 @@
+package modules
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// BillingConfig configures the router's billing exporter, which reports the
+// usage of tenants to Stripe (see services.StripeExporter)
+type BillingConfig struct {
+	// Type is the billing system; only "stripe" is supported
+	Type string `json:"type"`
+	// APIKey is the Stripe secret key (may be a secret reference)
+	APIKey  string `json:"api_key,omitempty"`
+	BaseURL string `json:"base_url,omitempty"`
+	// Metric is what is reported: tokens (default) or cost
+	Metric   string            `json:"metric,omitempty"`
+	CostUnit float64           `json:"cost_unit,omitempty"`
+	Items    map[string]string `json:"items,omitempty"`
+	Interval caddy.Duration    `json:"interval,omitempty"`
+	Lookback caddy.Duration    `json:"lookback,omitempty"`
+	// Store names the state store holding the usage ledger and the reports
+	// (default: memory)
+	Store string `json:"store,omitempty"`
+}
+
+// impl returns the router's usage ledger and its exporter, not yet started;
+// both are nil when billing is not configured
+func (c *BillingConfig) impl(router string, logger *zap.Logger) (*services.UsageLedger, *services.StripeExporter, error) {
+	if c == nil {
+		return nil, nil, nil
+	}
+	if c.Type != "stripe" {
+		return nil, nil, fmt.Errorf("billing: unknown type '%s' (supported: stripe)", c.Type)
+	}
+	store, ok := services.LookupStateStore(c.Store)
+	if !ok {
+		return nil, nil, fmt.Errorf("billing: unknown state store '%s'", c.Store)
+	}
+	apiKey, err := services.ResolveSecret(c.APIKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("billing: api_key: %v", err)
+	}
+	ledger := &services.UsageLedger{Store: store, Prefix: router + ":"}
+	exporter := &services.StripeExporter{
+		APIKey:   apiKey,
+		BaseURL:  c.BaseURL,
+		Metric:   c.Metric,
+		CostUnit: c.CostUnit,
+		Items:    c.Items,
+		Interval: time.Duration(c.Interval),
+		Lookback: time.Duration(c.Lookback),
+		Ledger:   ledger,
+		State:    store,
+		Prefix:   router + ":",
+		Logger:   logger.Named("billing"),
+	}
+	if err := exporter.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return ledger, exporter, nil
+}
+
+// parseBillingBlock parses the `billing <type> { ... }` block of `ai_router`:
+//
+//	billing stripe {
+//		api_key {env.STRIPE_SECRET_KEY}
+//		metric tokens
+//		cost_unit 100
+//		interval 1h
+//		lookback 24h
+//		store memory
+//		item acme si_0123
+//	}
+func parseBillingBlock(d *caddyfile.Dispenser) (*BillingConfig, error) {
+	if !d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	c := &BillingConfig{Type: d.Val()}
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if opt == "item" {
+			if len(args) != 2 {
+				return nil, d.ArgErr()
+			}
+			if c.Items == nil {
+				c.Items = make(map[string]string)
+			}
+			c.Items[args[0]] = args[1]
+			continue
+		}
+		if len(args) != 1 {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "api_key":
+			c.APIKey = args[0]
+		case "base_url":
+			c.BaseURL = args[0]
+		case "metric":
+			c.Metric = args[0]
+		case "store":
+			c.Store = args[0]
+		case "cost_unit":
+			unit, err := strconv.ParseFloat(args[0], 64)
+			if err != nil || unit <= 0 {
+				return nil, d.Errf("invalid cost_unit '%s'", args[0])
+			}
+			c.CostUnit = unit
+		case "interval", "lookback":
+			dur, err := caddy.ParseDuration(args[0])
+			if err != nil || dur <= 0 {
+				return nil, d.Errf("invalid %s '%s'", opt, args[0])
+			}
+			if opt == "interval" {
+				c.Interval = caddy.Duration(dur)
+			} else {
+				c.Lookback = caddy.Duration(dur)
+			}
+		default:
+			return nil, d.Errf("unrecognized billing option '%s'", opt)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,59 @@
+package modules
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// parseCompareBlock parses the `compare { ... }` block of `ai_router`:
+//
+//	compare {
+//		reference openai/gpt-4.1
+//		rate 5%
+//		models gpt-4o* claude-*
+//	}
+func parseCompareBlock(d *caddyfile.Dispenser) (*services.ReferenceCompare, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	c := &services.ReferenceCompare{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "reference":
+			if len(args) != 1 {
+				return nil, d.ArgErr()
+			}
+			c.Model = args[0]
+		case "rate":
+			if len(args) != 1 {
+				return nil, d.ArgErr()
+			}
+			// A fraction, or a percentage with a % suffix
+			value, percent := strings.CutSuffix(args[0], "%")
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, d.Errf("invalid compare rate '%s'", args[0])
+			}
+			if percent {
+				rate /= 100
+			}
+			c.Rate = rate
+		case "models":
+			c.Models = append(c.Models, args...)
+		default:
+			return nil, d.Errf("unrecognized compare option '%s'", opt)
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, d.Err(err.Error())
+	}
+	return c, nil
+}
@@ -0,0 +1,58 @@
+package modules
+
+import (
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// GeoIPConfig configures how the router finds the country of clients for
+// policy rules scoped to countries (see services.GeoIP)
+type GeoIPConfig struct {
+	// Header carries the client's country, e.g. CF-IPCountry
+	Header string `json:"header,omitempty"`
+	// Database is the path of a CSV database of address ranges
+	Database string `json:"database,omitempty"`
+}
+
+// impl returns the router's lookup, nil when none is configured
+func (c *GeoIPConfig) impl() (*services.GeoIP, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return services.LoadGeoIP(c.Header, c.Database)
+}
+
+// parseGeoIPBlock parses the `geoip { ... }` block of `ai_router`:
+//
+//	geoip {
+//		header CF-IPCountry
+//		database /etc/caddy/dbip-country-lite.csv
+//	}
+func parseGeoIPBlock(d *caddyfile.Dispenser) (*GeoIPConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	c := &GeoIPConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		if !d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		value := d.Val()
+		if d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "header":
+			c.Header = value
+		case "database":
+			c.Database = value
+		default:
+			return nil, d.Errf("unrecognized geoip option '%s'", opt)
+		}
+	}
+	if *c == (GeoIPConfig{}) {
+		return nil, d.Err("geoip: header or database is required")
+	}
+	return c, nil
+}
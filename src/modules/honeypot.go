@@ -0,0 +1,58 @@
+package modules
+
+import (
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// DefaultHoneypotResponse answers requests for honeypot models without a
+// response of their own
+const DefaultHoneypotResponse = "I'm sorry, but I can't help with that right now."
+
+// HoneypotConfig is a decoy model: listed with the router's models but served
+// by no provider. Legitimate clients have no reason to request it, while
+// someone probing a leaked key against the model list may, so requests for
+// it get a canned answer and raise a security alert.
+type HoneypotConfig struct {
+	// Response is the canned assistant message (default: DefaultHoneypotResponse)
+	Response string `json:"response,omitempty"`
+}
+
+// Honeypot returns the honeypot a requested model names, if any. Plugins
+// after '+' are ignored and names are case-insensitive.
+func (m *RouterModule) Honeypot(model string) (*HoneypotConfig, bool) {
+	if len(m.Honeypots) == 0 {
+		return nil, false
+	}
+	name := services.UnescapeModel(plugin.ParseModelSpec(model).Model)
+	hp, ok := m.Honeypots[strings.ToLower(strings.TrimSpace(name))]
+	if ok && hp == nil {
+		hp = &HoneypotConfig{}
+	}
+	return hp, ok
+}
+
+// ResponseText returns the canned message of a honeypot
+func (c *HoneypotConfig) ResponseText() string {
+	if c == nil || c.Response == "" {
+		return DefaultHoneypotResponse
+	}
+	return c.Response
+}
+
+// parseHoneypot parses the `honeypot <model> [<response>]` option of
+// `ai_router`
+func parseHoneypot(d *caddyfile.Dispenser) (string, *HoneypotConfig, error) {
+	args := d.RemainingArgs()
+	if len(args) < 1 || len(args) > 2 {
+		return "", nil, d.ArgErr()
+	}
+	hp := &HoneypotConfig{}
+	if len(args) == 2 {
+		hp.Response = args[1]
+	}
+	return strings.ToLower(args[0]), hp, nil
+}
@@ -0,0 +1,102 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+)
+
+// ClientCommonNamePlaceholder is set to the common name of a verified mTLS
+// client certificate, which Caddy's placeholders only offer as part of the
+// full subject
+const ClientCommonNamePlaceholder = "ai.tls.client.common_name"
+
+// IdentityConfig takes the identity established by earlier Caddy middleware
+// (forward_auth, mTLS, a trusted gateway's headers) into the router's context
+// keys, so budgets and observability see it. Values are placeholder templates
+// such as {http.request.header.X-User-Id}; those expanding to nothing leave
+// the context as the auth manager set it.
+type IdentityConfig struct {
+	UserID string `json:"user_id,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	KeyID  string `json:"key_id,omitempty"`
+}
+
+// Validate reports a mapping without any value
+func (c *IdentityConfig) Validate() error {
+	if c != nil && *c == (IdentityConfig{}) {
+		return errors.New("identity: at least one of user_id, tenant or key_id is required")
+	}
+	return nil
+}
+
+// Apply returns r with the mapped identity in its context, overriding what
+// the auth manager set; a nil mapping returns r unchanged
+func (c *IdentityConfig) Apply(r *http.Request) *http.Request {
+	if c == nil {
+		return r
+	}
+	repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		repl = caddy.NewReplacer()
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		repl.Set(ClientCommonNamePlaceholder, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+	}
+	ctx := r.Context()
+	for _, v := range []struct {
+		key      any
+		template string
+	}{
+		{plugin.ContextUserID(), c.UserID},
+		{plugin.ContextTenantID(), c.Tenant},
+		{plugin.ContextKeyID(), c.KeyID},
+	} {
+		if v.template == "" {
+			continue
+		}
+		if value := repl.ReplaceAll(v.template, ""); value != "" {
+			ctx = context.WithValue(ctx, v.key, value)
+		}
+	}
+	return r.WithContext(ctx)
+}
+
+// parseIdentityBlock parses the `identity { ... }` block of `ai_router`:
+//
+//	identity {
+//		user_id {http.request.header.X-User-Id}
+//		tenant {ai.tls.client.common_name}
+//		key_id {http.request.header.X-Key-Id}
+//	}
+func parseIdentityBlock(d *caddyfile.Dispenser) (*IdentityConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	c := &IdentityConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		if !d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		value := d.Val()
+		if d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "user_id":
+			c.UserID = value
+		case "tenant":
+			c.Tenant = value
+		case "key_id":
+			c.KeyID = value
+		default:
+			return nil, d.Errf("unrecognized identity option '%s'", opt)
+		}
+	}
+	return c, nil
+}
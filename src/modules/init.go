@@ -8,19 +8,41 @@ import (
 	"github.com/neutrome-labs/open-ai-router/src/plugins"
 	"github.com/neutrome-labs/open-ai-router/src/plugins/flow"
 	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/tools"
 )
 
-var APP_VERSION = "4.0.0"
+// APP_VERSION is the router's version as reported by /version: the release
+// version set at link time in services.Version, else the module's version
+var APP_VERSION = services.ReadBuildInfo().Version
 
 func init() {
 	services.TryInstrumentAppObservability()
+	plugins.RouterVersion = APP_VERSION
 
 	plugin.RegisterPlugin("posthog", &plugins.Posthog{})
 	plugin.RegisterPlugin("models", &flow.Models{})
 	plugin.RegisterPlugin("parallel", &flow.Parallel{})
 	plugin.RegisterPlugin("fuzz", &flow.Fuzz{})
+	plugin.RegisterPlugin("preview", &flow.Preview{})
+	plugin.RegisterPlugin("consensus", &flow.Consensus{})
+	plugin.RegisterPlugin("critique", &flow.Critique{})
+	plugin.RegisterPlugin("consistency", &flow.SelfConsistency{})
+	plugin.RegisterPlugin("mapreduce", &flow.MapReduce{})
+	plugin.RegisterPlugin("tools", &flow.ToolLoop{})
 	plugin.RegisterPlugin("stools", &plugins.StripTools{})
 	plugin.RegisterPlugin("zip", &plugins.Zip{})
+	plugin.RegisterPlugin("compress", &plugins.Compress{})
+	plugin.RegisterPlugin("attachments", &plugins.Attachments{})
+	plugin.RegisterPlugin("images", &plugins.Images{})
+	plugin.RegisterPlugin("usage", &plugins.Usage{})
+	plugin.RegisterPlugin("validate", &plugins.Validate{})
+	plugin.RegisterPlugin("repair", &plugins.Repair{})
+	plugin.RegisterPlugin("mask", &plugins.Mask{})
+	plugin.RegisterPlugin("attribution", &plugins.Attribution{})
+	plugin.RegisterPlugin("tee", &plugins.Tee{})
+	plugin.RegisterPlugin("fingerprint", &plugins.Fingerprint{})
+
+	tools.RegisterTool(tools.NewWeb(tools.WebConfig{}))
 
 	defer func() {
 		_ = services.FireObservabilityEvent("app", "", "init", map[string]any{
@@ -28,10 +50,17 @@ func init() {
 		})
 	}()
 
+	caddy.RegisterModule(&AIApp{})
+	httpcaddyfile.RegisterGlobalOption("ai", parseAIGlobalOption)
+
 	caddy.RegisterModule(&EnvAuthModule{})
 	httpcaddyfile.RegisterHandlerDirective("ai_auth_env", ParseEnvAuthModule)
 	httpcaddyfile.RegisterDirectiveOrder("ai_auth_env", httpcaddyfile.Before, "header")
 
+	caddy.RegisterModule(&KeyAuthModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_auth_keys", ParseKeyAuthModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_auth_keys", httpcaddyfile.Before, "header")
+
 	caddy.RegisterModule(&RouterModule{})
 	httpcaddyfile.RegisterHandlerDirective("ai_router", ParseRouterModule)
 	httpcaddyfile.RegisterDirectiveOrder("ai_router", httpcaddyfile.Before, "header")
@@ -0,0 +1,220 @@
+package modules
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// KeyAuthModule authenticates clients with API keys the router issues. Keys
+// belong to a tenant and are managed through the ai_api_keys endpoints by the
+// tenant's admin keys; the first admin key of each tenant is configured.
+// Provider requests use the providers' own api_key.
+type KeyAuthModule struct {
+	Name string `json:"name,omitempty"`
+	// Store names the state store holding the keys; it must be persistent,
+	// such as a bolt store opened with the ai app's state_store option
+	Store string `json:"store,omitempty"`
+	// AdminKeys maps tenants to configured admin key secrets, which may be
+	// secret references
+	AdminKeys map[string][]string `json:"admin_keys,omitempty"`
+
+	// Keys manages the issued keys
+	Keys *services.APIKeyManager `json:"-"`
+	// adminHashes maps the hashes of configured admin keys to their tenant
+	adminHashes map[string]string
+	logger      *zap.Logger
+}
+
+func ParseKeyAuthModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m KeyAuthModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "name":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.Name = h.Val()
+			case "store":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.Store = h.Val()
+			case "admin_key":
+				// admin_key <tenant> <secret>
+				args := h.RemainingArgs()
+				if len(args) != 2 {
+					return nil, h.ArgErr()
+				}
+				if m.AdminKeys == nil {
+					m.AdminKeys = make(map[string][]string)
+				}
+				m.AdminKeys[args[0]] = append(m.AdminKeys[args[0]], args[1])
+			default:
+				return nil, h.Errf("unrecognized ai_auth_keys option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*KeyAuthModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_auth_keys",
+		New: func() caddy.Module { return new(KeyAuthModule) },
+	}
+}
+
+func (m *KeyAuthModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	if m.Name == "" {
+		m.Name = "default"
+	}
+	if err := EnsureAIApp(ctx); err != nil {
+		return err
+	}
+	store, ok := services.LookupStateStore(m.Store)
+	if !ok {
+		return fmt.Errorf("ai_auth_keys: unknown state store '%s'", m.Store)
+	}
+	if !services.IsPersistentStateStore(store) {
+		return fmt.Errorf("ai_auth_keys: issued keys would be lost on restart; select a persistent store with 'store <name>' (see the ai state_store option)")
+	}
+	m.Keys = &services.APIKeyManager{Store: store, Prefix: "api_keys:" + m.Name + ":"}
+
+	m.adminHashes = make(map[string]string)
+	for tenant, secrets := range m.AdminKeys {
+		for _, secret := range secrets {
+			resolved, err := services.ResolveSecret(secret)
+			if err != nil {
+				return fmt.Errorf("ai_auth_keys: admin key of tenant %s: %w", tenant, err)
+			}
+			if resolved == "" {
+				return fmt.Errorf("ai_auth_keys: empty admin key for tenant %s", tenant)
+			}
+			m.adminHashes[services.HashAPIKeySecret(resolved)] = tenant
+		}
+	}
+
+	services.RegisterAuthService(m.Name, m)
+	m.logger.Info("Registered key auth manager", zap.String("name", m.Name), zap.Int("admin_keys", len(m.adminHashes)))
+	return nil
+}
+
+func (m *KeyAuthModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	return next.ServeHTTP(w, r)
+}
+
+// Authenticate returns the key a request carries, as a bearer token or in
+// x-api-key. Configured admin keys have the ID "config".
+func (m *KeyAuthModule) Authenticate(r *http.Request) (*services.APIKey, error) {
+	secret := r.Header.Get("x-api-key")
+	if auth := r.Header.Get("Authorization"); secret == "" && len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		secret = strings.TrimSpace(auth[7:])
+	}
+	if secret == "" {
+		return nil, errors.New("missing api key")
+	}
+
+	hash := services.HashAPIKeySecret(secret)
+	for adminHash, tenant := range m.adminHashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(adminHash)) == 1 {
+			return &services.APIKey{ID: "config", Object: "api_key", Tenant: tenant, Role: services.APIKeyRoleAdmin}, nil
+		}
+	}
+	return m.Keys.Authenticate(secret)
+}
+
+// CreateKey issues a key of the caller's tenant. A caller limited to
+// residency regions may only issue keys limited to some of them.
+func (m *KeyAuthModule) CreateKey(caller *services.APIKey, name, role string, residency []string) (*services.APIKey, string, error) {
+	if err := checkResidencyScope(caller, residency); err != nil {
+		return nil, "", err
+	}
+	return m.Keys.Create(caller.Tenant, name, role, residency)
+}
+
+// RotateKey replaces the secret of a key of the caller's tenant. A caller
+// limited to residency regions may only rotate keys limited to some of them.
+func (m *KeyAuthModule) RotateKey(caller *services.APIKey, id string) (*services.APIKey, string, error) {
+	if err := m.checkKeyScope(caller, id); err != nil {
+		return nil, "", err
+	}
+	return m.Keys.Rotate(caller.Tenant, id)
+}
+
+// RevokeKey revokes a key of the caller's tenant. A caller limited to
+// residency regions may only revoke keys limited to some of them.
+func (m *KeyAuthModule) RevokeKey(caller *services.APIKey, id string) (*services.APIKey, error) {
+	if err := m.checkKeyScope(caller, id); err != nil {
+		return nil, err
+	}
+	return m.Keys.Revoke(caller.Tenant, id)
+}
+
+// checkKeyScope checks that the caller reaches an existing key of its tenant
+func (m *KeyAuthModule) checkKeyScope(caller *services.APIKey, id string) error {
+	if len(caller.Residency) == 0 {
+		return nil
+	}
+	key, err := m.Keys.Get(caller.Tenant, id)
+	if err != nil {
+		return err
+	}
+	return checkResidencyScope(caller, key.Residency)
+}
+
+// checkResidencyScope checks that keys limited to residency are limited to
+// some of the caller's regions, if it has any
+func checkResidencyScope(caller *services.APIKey, residency []string) error {
+	if len(caller.Residency) == 0 {
+		return nil
+	}
+	if len(residency) == 0 {
+		return fmt.Errorf("%w: residency must be some of %s", services.ErrAPIKeyScope, strings.Join(caller.Residency, ", "))
+	}
+	for _, region := range residency {
+		if !slices.Contains(caller.Residency, strings.ToLower(region)) {
+			return fmt.Errorf("%w: region '%s' is outside %s", services.ErrAPIKeyScope, region, strings.Join(caller.Residency, ", "))
+		}
+	}
+	return nil
+}
+
+// CollectIncomingAuth rejects requests without a valid key and identifies the
+// others by key and tenant, for policies, rate limits and usage tracking
+func (m *KeyAuthModule) CollectIncomingAuth(r *http.Request) (*http.Request, error) {
+	key, err := m.Authenticate(r)
+	if err != nil {
+		return r, err
+	}
+	ctx := context.WithValue(r.Context(), plugin.ContextKeyID(), key.Tenant+":"+key.ID)
+	ctx = context.WithValue(ctx, plugin.ContextTenantID(), key.Tenant)
+	if len(key.Residency) > 0 {
+		ctx = context.WithValue(ctx, plugin.ContextResidency(), key.Residency)
+	}
+	return r.WithContext(ctx), nil
+}
+
+// CollectTargetAuth leaves provider credentials to the providers' api_key
+func (m *KeyAuthModule) CollectTargetAuth(scope string, p *services.ProviderService, rIn, rOut *http.Request) (string, error) {
+	return "", nil
+}
+
+var (
+	_ caddy.Provisioner           = (*KeyAuthModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*KeyAuthModule)(nil)
+	_ services.AuthService        = (*KeyAuthModule)(nil)
+)
@@ -0,0 +1,68 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+func TestKeyAuthModule_RequiresPersistentStore(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+
+	if err := (&KeyAuthModule{}).Provision(ctx); err == nil {
+		t.Error("expected the in-memory store to be refused")
+	}
+
+	store, closeStore, err := services.OpenStateStore("bolt:" + filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeStore()
+	services.RegisterStateStore("test-keys", store)
+	defer services.UnregisterStateStore("test-keys", store)
+	if err := (&KeyAuthModule{Store: "test-keys"}).Provision(ctx); err != nil {
+		t.Errorf("expected a persistent store to be accepted, got %v", err)
+	}
+}
+
+func TestKeyAuthModule_CreateKeyResidency(t *testing.T) {
+	m := &KeyAuthModule{Keys: &services.APIKeyManager{Store: services.NewMemoryStateStore()}}
+	unrestricted := &services.APIKey{ID: "config", Tenant: "acme", Role: services.APIKeyRoleAdmin}
+	restricted := &services.APIKey{ID: "key_1", Tenant: "acme", Role: services.APIKeyRoleAdmin, Residency: []string{"eu", "eu-west"}}
+
+	tests := []struct {
+		name      string
+		caller    *services.APIKey
+		residency []string
+		allowed   bool
+	}{
+		{"unrestricted caller, any regions", unrestricted, []string{"us"}, true},
+		{"unrestricted caller, no regions", unrestricted, nil, true},
+		{"restricted caller, subset", restricted, []string{"EU"}, true},
+		{"restricted caller, same regions", restricted, []string{"eu", "eu-west"}, true},
+		{"restricted caller, other region", restricted, []string{"eu", "us"}, false},
+		{"restricted caller, no regions", restricted, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, _, err := m.CreateKey(tt.caller, "ci", "", tt.residency)
+			if !tt.allowed {
+				if !errors.Is(err, services.ErrAPIKeyScope) {
+					t.Errorf("expected a scope error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateKey returned error: %v", err)
+			}
+			if key.Tenant != "acme" {
+				t.Errorf("expected a key of the caller's tenant, got %s", key.Tenant)
+			}
+		})
+	}
+}
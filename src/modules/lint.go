@@ -0,0 +1,167 @@
+package modules
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/drivers/virtual"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// splitModelSpec splits a model spec like "openai/gpt-4,groq/llama+models:x+zip"
+// into its model targets and the names of the plugins in its suffix.
+func splitModelSpec(spec string) (targets []string, pluginNames []string) {
+	parsed := plugin.ParseModelSpec(spec)
+	for _, ref := range parsed.Plugins {
+		pluginNames = append(pluginNames, ref[0])
+	}
+	return parsed.Targets(), pluginNames
+}
+
+// knownProviders returns the sorted provider names for error messages
+func (m *RouterModule) knownProviders() string {
+	names := make([]string, 0, len(m.ProviderConfigs))
+	for name := range m.ProviderConfigs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// Lint checks the router configuration for references that cannot be resolved:
+// unknown styles, virtual mappings pointing at unknown providers or plugins,
+// and default_provider_for_model entries and policy rules naming unknown
+// providers.
+// When checkAuth is set, the configured auth manager must also be registered;
+// this is only reliable once every module has been provisioned.
+func (m *RouterModule) Lint(checkAuth bool) []error {
+	var errs []error
+
+	for _, name := range m.ProvidersOrder {
+		p, ok := m.ProviderConfigs[name]
+		if !ok || p == nil {
+			errs = append(errs, fmt.Errorf("provider %s: listed in providers_order but not configured", name))
+			continue
+		}
+
+		style, err := styles.ParseStyle(p.Style)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("provider %s: unknown style '%s' (supported: %s)",
+				name, p.Style, strings.Join(styles.SupportedStyleNames(), ", ")))
+			continue
+		}
+
+		if style != styles.StyleVirtual && len(p.ModelMappings) > 0 {
+			errs = append(errs, fmt.Errorf("provider %s: model mappings are only supported for style virtual", name))
+		}
+
+		presetAliases := make([]string, 0, len(p.ModelPresets))
+		for alias := range p.ModelPresets {
+			presetAliases = append(presetAliases, alias)
+		}
+		slices.Sort(presetAliases)
+		for _, alias := range presetAliases {
+			if _, ok := p.ModelMappings[alias]; !ok {
+				errs = append(errs, fmt.Errorf("provider %s: preset for unknown model '%s'", name, alias))
+			}
+		}
+
+		routedAliases := make([]string, 0, len(p.ModelRouting))
+		for alias := range p.ModelRouting {
+			routedAliases = append(routedAliases, alias)
+		}
+		slices.Sort(routedAliases)
+		for _, alias := range routedAliases {
+			if _, ok := p.ModelMappings[alias]; !ok {
+				errs = append(errs, fmt.Errorf("provider %s: routing rules for unknown model '%s'", name, alias))
+			}
+			for _, rule := range p.ModelRouting[alias].Rules {
+				if rule.Provider != "" {
+					if _, ok := m.ProviderConfigs[strings.ToLower(rule.Provider)]; !ok {
+						errs = append(errs, fmt.Errorf("provider %s: model '%s' checks load of unknown provider '%s' (known: %s)",
+							name, alias, rule.Provider, m.knownProviders()))
+					}
+				}
+				targets, _ := splitModelSpec(rule.Target)
+				for _, target := range targets {
+					prefix, _, hasPrefix := strings.Cut(target, "/")
+					if hasPrefix {
+						if _, ok := m.ProviderConfigs[strings.ToLower(prefix)]; !ok {
+							errs = append(errs, fmt.Errorf("provider %s: model '%s' routes to unknown provider '%s' (known: %s)",
+								name, alias, prefix, m.knownProviders()))
+						}
+					}
+				}
+			}
+		}
+
+		aliases := make([]string, 0, len(p.ModelMappings))
+		for alias := range p.ModelMappings {
+			aliases = append(aliases, alias)
+		}
+		slices.Sort(aliases)
+
+		for _, alias := range aliases {
+			targets, pluginNames := splitModelSpec(p.ModelMappings[alias])
+			if len(targets) == 0 {
+				errs = append(errs, fmt.Errorf("provider %s: model '%s' has an empty target", name, alias))
+			}
+			if _, _, _, err := virtual.ParseTargets(p.ModelMappings[alias]); err != nil {
+				errs = append(errs, fmt.Errorf("provider %s: model '%s': %w", name, alias, err))
+			}
+			for _, target := range targets {
+				prefix, _, hasPrefix := strings.Cut(target, "/")
+				if !hasPrefix {
+					continue
+				}
+				if _, ok := m.ProviderConfigs[strings.ToLower(prefix)]; !ok {
+					errs = append(errs, fmt.Errorf("provider %s: model '%s' targets unknown provider '%s' (known: %s)",
+						name, alias, prefix, m.knownProviders()))
+				}
+			}
+			for _, pluginName := range pluginNames {
+				if _, ok := plugin.GetPlugin(pluginName); !ok {
+					errs = append(errs, fmt.Errorf("provider %s: model '%s' uses unregistered plugin '%s'",
+						name, alias, pluginName))
+				}
+			}
+		}
+	}
+
+	models := make([]string, 0, len(m.DefaultProviderForModel))
+	for model := range m.DefaultProviderForModel {
+		models = append(models, model)
+	}
+	slices.Sort(models)
+
+	for _, model := range models {
+		for _, pName := range m.DefaultProviderForModel[model] {
+			if _, ok := m.ProviderConfigs[pName]; !ok {
+				errs = append(errs, fmt.Errorf("default_provider_for_model %s: unknown provider '%s' (known: %s)",
+					model, pName, m.knownProviders()))
+			}
+		}
+	}
+
+	if m.Policy != nil {
+		for i, rule := range m.Policy.Rules {
+			for _, pName := range rule.Providers {
+				if _, ok := m.ProviderConfigs[strings.ToLower(pName)]; !ok {
+					errs = append(errs, fmt.Errorf("policy rule %d: unknown provider '%s' (known: %s)",
+						i+1, pName, m.knownProviders()))
+				}
+			}
+		}
+	}
+
+	if checkAuth && m.AuthManagerName != "" {
+		if _, ok := services.LookupAuthService(m.AuthManagerName); !ok {
+			errs = append(errs, fmt.Errorf("auth manager '%s' is not registered; add a matching ai_auth_* handler", m.AuthManagerName))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,179 @@
+package modules
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// ObservabilitySinkConfig configures one observability sink of a router
+type ObservabilitySinkConfig struct {
+	// Type is posthog, langfuse, otlp or webhook
+	Type string `json:"type"`
+	// URL is the Langfuse host, OTLP/HTTP collector or webhook URL (may be a secret reference)
+	URL string `json:"url,omitempty"`
+	// Headers are sent with every request (values may be secret references)
+	Headers map[string]string `json:"headers,omitempty"`
+	// PublicKey and SecretKey authenticate to Langfuse (may be secret references)
+	PublicKey     string         `json:"public_key,omitempty"`
+	SecretKey     string         `json:"secret_key,omitempty"`
+	BatchSize     int            `json:"batch_size,omitempty"`
+	FlushInterval caddy.Duration `json:"flush_interval,omitempty"`
+}
+
+// newSink builds the sink, resolving secret references
+func (c *ObservabilitySinkConfig) newSink(logger *zap.Logger) (services.ObservabilitySink, error) {
+	if c.Type == "posthog" {
+		return services.PosthogSink{}, nil
+	}
+
+	cfg := services.SinkConfig{
+		Headers: make(map[string]string, len(c.Headers)),
+		Batching: services.EventBatching{
+			BatchSize:     c.BatchSize,
+			FlushInterval: time.Duration(c.FlushInterval),
+		},
+		Logger: logger,
+	}
+	var err error
+	if cfg.URL, err = services.ResolveSecret(c.URL); err != nil {
+		return nil, fmt.Errorf("url: %v", err)
+	}
+	for name, value := range c.Headers {
+		if cfg.Headers[name], err = services.ResolveSecret(value); err != nil {
+			return nil, fmt.Errorf("header %s: %v", name, err)
+		}
+	}
+
+	switch c.Type {
+	case "webhook", "otlp":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("%s sink requires a url", c.Type)
+		}
+		if c.Type == "webhook" {
+			return services.NewWebhookSink(cfg), nil
+		}
+		return services.NewOTLPLogsSink(cfg), nil
+	case "langfuse":
+		if cfg.PublicKey, err = services.ResolveSecret(c.PublicKey); err != nil {
+			return nil, fmt.Errorf("public_key: %v", err)
+		}
+		if cfg.SecretKey, err = services.ResolveSecret(c.SecretKey); err != nil {
+			return nil, fmt.Errorf("secret_key: %v", err)
+		}
+		if cfg.PublicKey == "" || cfg.SecretKey == "" {
+			return nil, fmt.Errorf("langfuse sink requires public_key and secret_key")
+		}
+		return services.NewLangfuseSink(cfg), nil
+	}
+	return nil, fmt.Errorf("unknown sink type '%s'", c.Type)
+}
+
+// provisionSinks builds the router's observability sinks; without sinks
+// configured the router uses the default ones
+func (m *RouterModule) provisionSinks() error {
+	if m.Observability == nil {
+		m.Impl.Sinks = nil
+		return nil
+	}
+	sinks := make([]services.ObservabilitySink, 0, len(m.Observability))
+	for i, c := range m.Observability {
+		sink, err := c.newSink(m.Impl.Logger)
+		if err != nil {
+			for _, built := range sinks {
+				_ = built.Close()
+			}
+			return fmt.Errorf("observability sink %d (%s): %w", i+1, c.Type, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	m.Impl.Sinks = sinks
+	return nil
+}
+
+// Cleanup flushes and closes the router's observability sinks and stops its
+// billing exporter
+func (m *RouterModule) Cleanup() error {
+	if m.exporter != nil {
+		_ = m.exporter.Close()
+	}
+	for _, sink := range m.Impl.Sinks {
+		_ = sink.Close()
+	}
+	return nil
+}
+
+// parseObservabilityBlock parses the `observability { ... }` block of
+// `ai_router`:
+//
+//	observability {
+//		posthog
+//		langfuse [<host>] {
+//			public_key {env.LANGFUSE_PUBLIC_KEY}
+//			secret_key {env.LANGFUSE_SECRET_KEY}
+//		}
+//		otlp http://collector:4318
+//		webhook https://example.com/ai-events {
+//			header Authorization "Bearer {env.HOOK_TOKEN}"
+//			batch_size 50
+//			flush_interval 10s
+//		}
+//	}
+func parseObservabilityBlock(d *caddyfile.Dispenser) ([]*ObservabilitySinkConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	sinks := []*ObservabilitySinkConfig{}
+	for d.NextBlock(1) {
+		sink := &ObservabilitySinkConfig{Type: d.Val()}
+		switch sink.Type {
+		case "posthog", "langfuse", "otlp", "webhook":
+		default:
+			return nil, d.Errf("unrecognized observability sink '%s'", sink.Type)
+		}
+		if d.NextArg() {
+			sink.URL = d.Val()
+		}
+		if d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		for d.NextBlock(2) {
+			opt := d.Val()
+			args := d.RemainingArgs()
+			switch {
+			case opt == "header" && len(args) == 2:
+				if sink.Headers == nil {
+					sink.Headers = make(map[string]string)
+				}
+				sink.Headers[args[0]] = args[1]
+			case opt == "header", len(args) != 1:
+				return nil, d.ArgErr()
+			case opt == "public_key":
+				sink.PublicKey = args[0]
+			case opt == "secret_key":
+				sink.SecretKey = args[0]
+			case opt == "batch_size":
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return nil, d.Errf("invalid batch_size '%s'", args[0])
+				}
+				sink.BatchSize = n
+			case opt == "flush_interval":
+				dur, err := caddy.ParseDuration(args[0])
+				if err != nil || dur <= 0 {
+					return nil, d.Errf("invalid flush_interval '%s'", args[0])
+				}
+				sink.FlushInterval = caddy.Duration(dur)
+			default:
+				return nil, d.Errf("unrecognized %s sink option '%s'", sink.Type, opt)
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
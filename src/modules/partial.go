@@ -0,0 +1,69 @@
+package modules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// PartialResponsesConfig keeps the partial responses of streams whose
+// clients disconnected (see services.PartialResponses)
+type PartialResponsesConfig struct {
+	// Store names the state store keeping the responses (default: memory)
+	Store string `json:"store,omitempty"`
+	// TTL is how long responses are kept (default: 1h)
+	TTL caddy.Duration `json:"ttl,omitempty"`
+}
+
+// impl returns the router's partial responses, nil when not configured
+func (c *PartialResponsesConfig) impl(router string) (*services.PartialResponses, error) {
+	if c == nil {
+		return nil, nil
+	}
+	store, ok := services.LookupStateStore(c.Store)
+	if !ok {
+		return nil, fmt.Errorf("partial_responses: unknown state store '%s'", c.Store)
+	}
+	return &services.PartialResponses{
+		Store:  store,
+		Prefix: router + ":",
+		TTL:    time.Duration(c.TTL),
+	}, nil
+}
+
+// parsePartialResponsesBlock parses the `partial_responses [{ ... }]` option
+// of `ai_router`:
+//
+//	partial_responses {
+//		store redis
+//		ttl 1h
+//	}
+func parsePartialResponsesBlock(d *caddyfile.Dispenser) (*PartialResponsesConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	c := &PartialResponsesConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if len(args) != 1 {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "store":
+			c.Store = args[0]
+		case "ttl":
+			dur, err := caddy.ParseDuration(args[0])
+			if err != nil {
+				return nil, d.Errf("invalid partial_responses ttl '%s': %v", args[0], err)
+			}
+			c.TTL = caddy.Duration(dur)
+		default:
+			return nil, d.Errf("unrecognized partial_responses option '%s'", opt)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,158 @@
+package modules
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// providerPreset holds the settings a `preset` fills in for a well-known
+// OpenAI-compatible upstream
+type providerPreset struct {
+	APIBaseURL   string
+	Style        styles.Style
+	Quirks       services.ProviderQuirks
+	Capabilities services.Capabilities
+	// Safety is the provider's safety dialect
+	Safety string
+}
+
+// mistralOnlyFields are request fields only Mistral understands
+var mistralOnlyFields = []string{"safe_prompt"}
+
+var providerPresets = map[string]providerPreset{
+	"groq": {
+		APIBaseURL: "https://api.groq.com/openai/v1",
+		Style:      styles.StyleChatCompletions,
+		Quirks: services.ProviderQuirks{
+			DropFields:   append([]string{"logprobs", "top_logprobs", "logit_bias"}, mistralOnlyFields...),
+			JSONModeHint: true,
+		},
+		Capabilities: services.Capabilities{
+			// Groq only takes n=1
+			{Model: "*", Supports: []string{services.CapabilityTools, services.CapabilityJSONMode, services.LimitMaxN + ":1"},
+				Lacks: []string{services.CapabilityVision, services.CapabilityDeveloperRole, services.CapabilityComputerUse}},
+			{Model: "meta-llama/llama-4-*", Supports: []string{services.CapabilityVision, services.CapabilityJSONSchema}},
+			{Model: "openai/gpt-oss-*", Supports: []string{services.CapabilityReasoning, services.CapabilityJSONSchema}},
+			{Model: "qwen/qwen3-*", Supports: []string{services.CapabilityReasoning}},
+		},
+	},
+	"mistral": {
+		APIBaseURL: "https://api.mistral.ai/v1",
+		Style:      styles.StyleChatCompletions,
+		Safety:     services.SafetyDialectMistral,
+		Quirks: services.ProviderQuirks{
+			// Mistral rejects fields it doesn't know
+			DropFields: []string{"user", "logit_bias", "logprobs", "top_logprobs", "store", "metadata", "service_tier"},
+			RenameFields: map[string]string{
+				"seed":                  "random_seed",
+				"max_completion_tokens": "max_tokens",
+				"safe_mode":             "safe_prompt",
+			},
+		},
+		Capabilities: services.Capabilities{
+			{Model: "*", Supports: []string{services.CapabilityTools, services.CapabilityJSONMode, services.CapabilityJSONSchema},
+				Lacks: []string{services.CapabilityReasoning, services.CapabilityDeveloperRole, services.CapabilityComputerUse}},
+			{Model: "pixtral-*", Supports: []string{services.CapabilityVision}},
+			{Model: "mistral-medium*", Supports: []string{services.CapabilityVision}},
+			{Model: "mistral-small*", Supports: []string{services.CapabilityVision}},
+			{Model: "magistral-*", Supports: []string{services.CapabilityReasoning}},
+		},
+	},
+	"openai": {
+		APIBaseURL: "https://api.openai.com/v1",
+		Style:      styles.StyleChatCompletions,
+		Safety:     services.SafetyDialectOpenAI,
+		Capabilities: services.Capabilities{
+			{Model: "*", Supports: []string{services.CapabilityTools, services.CapabilityJSONMode, services.CapabilityJSONSchema, services.CapabilityVision,
+				services.LimitMaxN + ":128"},
+				Lacks: []string{services.CapabilityComputerUse}},
+			{Model: "text-embedding-*", Supports: []string{services.LimitMaxBatch + ":2048"}},
+			// Reasoning models reject max_tokens and take developer messages
+			{Model: "o[1-9]*", Supports: []string{services.CapabilityReasoning, services.CapabilityDeveloperRole, services.CapabilityMaxCompletionTokens}},
+			{Model: "gpt-5*", Supports: []string{services.CapabilityReasoning, services.CapabilityDeveloperRole, services.CapabilityMaxCompletionTokens}},
+			{Model: "computer-use-preview*", Supports: []string{services.CapabilityComputerUse}},
+			// Search models take web_search_options
+			{Model: "gpt-4o*-search-preview*", Supports: []string{services.CapabilityWebSearch}},
+			{Model: "gpt-5-search-api*", Supports: []string{services.CapabilityWebSearch}},
+		},
+	},
+	"openrouter": {
+		APIBaseURL: "https://openrouter.ai/api/v1",
+		Style:      styles.StyleChatCompletions,
+		Quirks: services.ProviderQuirks{
+			// Routing preferences travel in extras through clients that only
+			// know the OpenAI API
+			LiftExtras: []string{"provider", "transforms", "route", "models"},
+		},
+		Capabilities: services.Capabilities{
+			// OpenRouter searches for any model given web_search_options
+			{Model: "*", Supports: []string{services.CapabilityWebSearch}},
+		},
+	},
+	"xai": {
+		APIBaseURL: "https://api.x.ai/v1",
+		Style:      styles.StyleChatCompletions,
+		Quirks: services.ProviderQuirks{
+			DropFields: mistralOnlyFields,
+		},
+		Capabilities: services.Capabilities{
+			{Model: "*", Supports: []string{services.CapabilityTools, services.CapabilityJSONMode, services.CapabilityJSONSchema},
+				Lacks: []string{services.CapabilityDeveloperRole, services.CapabilityComputerUse}},
+			{Model: "grok-3-mini*", Supports: []string{services.CapabilityReasoning}},
+			{Model: "grok-4*", Supports: []string{services.CapabilityReasoning, services.CapabilityVision}},
+			{Model: "grok-2-vision*", Supports: []string{services.CapabilityVision}},
+		},
+	},
+}
+
+// applyPreset fills in the settings of the provider's preset that aren't
+// configured explicitly, and returns the capability registry: the preset's
+// entries refined by the configured ones
+func (p *ProviderConfig) applyPreset() (services.Capabilities, error) {
+	name := strings.ToLower(p.Preset)
+	if name == "" && p.Quirks == nil {
+		name = presetForURL(p.APIBaseURL)
+	}
+	if name == "" {
+		return p.Capabilities, nil
+	}
+	preset, ok := providerPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset '%s' (known: groq, mistral, openai, openrouter, xai)", p.Preset)
+	}
+	if p.APIBaseURL == "" {
+		p.APIBaseURL = preset.APIBaseURL
+	}
+	if p.Style == "" {
+		p.Style = string(preset.Style)
+	}
+	if p.Quirks == nil {
+		quirks := preset.Quirks
+		p.Quirks = &quirks
+	}
+	if p.Safety == "" {
+		p.Safety = preset.Safety
+	}
+	return append(slices.Clone(preset.Capabilities), p.Capabilities...), nil
+}
+
+// presetHosts maps the hosts of upstreams whose preset applies without being
+// named to the preset
+var presetHosts = map[string]string{
+	"api.openai.com": "openai",
+	"openrouter.ai":  "openrouter",
+}
+
+// presetForURL returns the preset applying to a base URL without being named
+func presetForURL(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return presetHosts[u.Hostname()]
+}
@@ -0,0 +1,145 @@
+package modules
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// QuotaConfig configures the router's plans and their monthly quotas (see
+// services.Quotas)
+type QuotaConfig struct {
+	// Store names the state store holding the counters (default: memory)
+	Store   string                    `json:"store,omitempty"`
+	Plans   map[string]*services.Plan `json:"plans,omitempty"`
+	Tiers   map[string][]string       `json:"tiers,omitempty"`
+	Keys    map[string]string         `json:"keys,omitempty"`
+	Tenants map[string]string         `json:"tenants,omitempty"`
+	Default string                    `json:"default,omitempty"`
+}
+
+// impl returns the router's quotas, nil when no plan is configured
+func (c *QuotaConfig) impl(router string) (*services.Quotas, error) {
+	if c == nil || len(c.Plans) == 0 {
+		return nil, nil
+	}
+	store, ok := services.LookupStateStore(c.Store)
+	if !ok {
+		return nil, fmt.Errorf("quota: unknown state store '%s'", c.Store)
+	}
+	quotas := &services.Quotas{
+		Store:   store,
+		Prefix:  router + ":",
+		Plans:   c.Plans,
+		Tiers:   c.Tiers,
+		Keys:    c.Keys,
+		Tenants: c.Tenants,
+		Default: c.Default,
+	}
+	if err := quotas.Validate(); err != nil {
+		return nil, err
+	}
+	return quotas, nil
+}
+
+// parseQuotaBlock parses the `quota { ... }` block of `ai_router`:
+//
+//	quota {
+//		store memory
+//		tier small openai/gpt-4o-mini groq/*
+//		tier large openai/gpt-4o anthropic/*
+//		plan free requests 1000 tokens 1000000 tiers small
+//		plan pro requests 100000 tokens 50000000
+//		tenant acme pro
+//		key acme:key_0123 free
+//		default free
+//	}
+func parseQuotaBlock(d *caddyfile.Dispenser) (*QuotaConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	c := &QuotaConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		switch opt {
+		case "store", "default":
+			if len(args) != 1 {
+				return nil, d.ArgErr()
+			}
+			if opt == "store" {
+				c.Store = args[0]
+			} else {
+				c.Default = args[0]
+			}
+		case "tier":
+			if len(args) < 2 {
+				return nil, d.ArgErr()
+			}
+			if c.Tiers == nil {
+				c.Tiers = make(map[string][]string)
+			}
+			c.Tiers[args[0]] = append(c.Tiers[args[0]], args[1:]...)
+		case "plan":
+			if len(args) == 0 {
+				return nil, d.ArgErr()
+			}
+			plan, err := parsePlan(args[1:])
+			if err != nil {
+				return nil, d.Errf("quota plan %s: %v", args[0], err)
+			}
+			if c.Plans == nil {
+				c.Plans = make(map[string]*services.Plan)
+			}
+			c.Plans[args[0]] = plan
+		case "tenant", "key":
+			if len(args) != 2 {
+				return nil, d.ArgErr()
+			}
+			assignments := &c.Tenants
+			if opt == "key" {
+				assignments = &c.Keys
+			}
+			if *assignments == nil {
+				*assignments = make(map[string]string)
+			}
+			(*assignments)[args[0]] = args[1]
+		default:
+			return nil, d.Errf("unrecognized quota option '%s'", opt)
+		}
+	}
+	return c, nil
+}
+
+// parsePlan parses `[requests <n>] [tokens <n>] [tiers <tier>...]`
+func parsePlan(args []string) (*services.Plan, error) {
+	plan := &services.Plan{}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "tiers" {
+			if i == len(args)-1 {
+				return nil, fmt.Errorf("tiers expects at least one tier")
+			}
+			plan.Tiers = append(plan.Tiers, args[i+1:]...)
+			break
+		}
+		if i == len(args)-1 {
+			return nil, fmt.Errorf("%s expects a value", args[i])
+		}
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s '%s'", args[i], args[i+1])
+		}
+		switch args[i] {
+		case "requests":
+			plan.Requests = n
+		case "tokens":
+			plan.Tokens = n
+		default:
+			return nil, fmt.Errorf("unrecognized option '%s'", args[i])
+		}
+		i++
+	}
+	return plan, nil
+}
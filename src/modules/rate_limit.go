@@ -0,0 +1,124 @@
+package modules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// RateLimitConfig configures the router's request rate limits as
+// hierarchical token buckets (see services.TokenBuckets)
+type RateLimitConfig struct {
+	// Store names the state store holding the buckets (default: memory)
+	Store        string                           `json:"store,omitempty"`
+	Limits       map[string]*services.BucketLimit `json:"limits,omitempty"`
+	PriorityKeys []string                         `json:"priority_keys,omitempty"`
+}
+
+// impl returns the router's buckets, nil when no limit is configured;
+// policyLimits reports policy rules limiting the rate of clients, which keep
+// their buckets in the same store
+func (c *RateLimitConfig) impl(router string, policyLimits bool) (*services.TokenBuckets, error) {
+	if (c == nil || len(c.Limits) == 0) && !policyLimits {
+		return nil, nil
+	}
+	if c == nil {
+		c = &RateLimitConfig{}
+	}
+	store, ok := services.LookupStateStore(c.Store)
+	if !ok {
+		return nil, fmt.Errorf("rate_limit: unknown state store '%s'", c.Store)
+	}
+	buckets := &services.TokenBuckets{
+		Store:        store,
+		Prefix:       router + ":",
+		Limits:       c.Limits,
+		PriorityKeys: c.PriorityKeys,
+	}
+	if err := buckets.Validate(); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// parseRateLimitBlock parses the `rate_limit { ... }` block of `ai_router`:
+//
+//	rate_limit {
+//		store memory
+//		global 100/s burst 200 reserve 0.2
+//		tenant 600/m
+//		key 5/s burst 10
+//		priority_keys admin-*
+//	}
+func parseRateLimitBlock(d *caddyfile.Dispenser) (*RateLimitConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	c := &RateLimitConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "store":
+			if len(args) != 1 {
+				return nil, d.ArgErr()
+			}
+			c.Store = args[0]
+		case "priority_keys":
+			c.PriorityKeys = append(c.PriorityKeys, args...)
+		case services.BucketGlobal, services.BucketTenant, services.BucketKey:
+			limit, err := parseBucketLimit(args)
+			if err != nil {
+				return nil, d.Errf("rate_limit %s: %v", opt, err)
+			}
+			if c.Limits == nil {
+				c.Limits = make(map[string]*services.BucketLimit)
+			}
+			c.Limits[opt] = limit
+		default:
+			return nil, d.Errf("unrecognized rate_limit option '%s'", opt)
+		}
+	}
+	return c, nil
+}
+
+// parseBucketLimit parses `<n>/<s|m|h> [burst <n>] [reserve <fraction>]`
+func parseBucketLimit(args []string) (*services.BucketLimit, error) {
+	count, unit, ok := strings.Cut(args[0], "/")
+	n, err := strconv.ParseFloat(count, 64)
+	if !ok || err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid rate '%s', expected <n>/s, <n>/m or <n>/h", args[0])
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if per == 0 {
+		return nil, fmt.Errorf("invalid rate unit '%s' (supported: s, m, h)", unit)
+	}
+	limit := &services.BucketLimit{Rate: n / per.Seconds()}
+
+	rest := args[1:]
+	if len(rest)%2 != 0 {
+		return nil, fmt.Errorf("expected burst <n> and reserve <fraction> pairs, got %v", rest)
+	}
+	for i := 0; i < len(rest); i += 2 {
+		value, err := strconv.ParseFloat(rest[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s'", rest[i], rest[i+1])
+		}
+		switch rest[i] {
+		case "burst":
+			limit.Burst = value
+		case "reserve":
+			limit.Reserve = value
+		default:
+			return nil, fmt.Errorf("unrecognized option '%s'", rest[i])
+		}
+	}
+	return limit, nil
+}
@@ -1,16 +1,25 @@
 package modules
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/drivers/anthropic"
+	"github.com/neutrome-labs/open-ai-router/src/drivers/gemini"
+	"github.com/neutrome-labs/open-ai-router/src/drivers/mock"
 	"github.com/neutrome-labs/open-ai-router/src/drivers/openai"
 	"github.com/neutrome-labs/open-ai-router/src/drivers/virtual"
 	"github.com/neutrome-labs/open-ai-router/src/plugin"
@@ -39,6 +48,18 @@ func GetRouter(name string) (*RouterModule, bool) {
 	return nil, false
 }
 
+// ListRouters returns all registered routers keyed by name
+func ListRouters() map[string]*RouterModule {
+	routers := make(map[string]*RouterModule)
+	routerRegistry.Range(func(k, v any) bool {
+		if m, ok := v.(*RouterModule); ok {
+			routers[k.(string)] = m
+		}
+		return true
+	})
+	return routers
+}
+
 // RouterModule configures providers and routing rules for AI models.
 type RouterModule struct {
 	Name                    string                     `json:"name,omitempty"`
@@ -46,16 +67,199 @@ type RouterModule struct {
 	ProviderConfigs         map[string]*ProviderConfig `json:"providers,omitempty"`
 	DefaultProviderForModel map[string][]string        `json:"default_provider_for_model,omitempty"`
 	ProvidersOrder          []string                   `json:"providers_order,omitempty"`
-	Impl                    services.RouterService
+	Policy                  *services.Policy           `json:"policy,omitempty"`
+	RequestTimeout          caddy.Duration             `json:"request_timeout,omitempty"`   // Total deadline per request, including fallbacks
+	MaxDepth                int                        `json:"max_depth,omitempty"`         // Nested handler invocations allowed per request (default 8)
+	UpstreamHeaders         *services.HeaderPolicy     `json:"upstream_headers,omitempty"`  // Upstream response headers passed on to clients
+	PosthogProject          string                     `json:"posthog_project,omitempty"`   // PostHog project of the global ai options receiving this router's events
+	Observability           []*ObservabilitySinkConfig `json:"observability,omitempty"`     // Sinks receiving this router's events (default: posthog)
+	StageLimits             *StageLimitsConfig         `json:"stage_limits,omitempty"`      // Size and time caps on plugin and conversion stages
+	SelfTests               []*SelfTest                `json:"selftest,omitempty"`          // Routing expectations checked at startup
+	RateLimit               *RateLimitConfig           `json:"rate_limit,omitempty"`        // Global, tenant and key request rate limits
+	Quota                   *QuotaConfig               `json:"quota,omitempty"`             // Plans with monthly request and token quotas
+	Billing                 *BillingConfig             `json:"billing,omitempty"`           // Exports tenant usage to a billing system
+	Identity                *IdentityConfig            `json:"identity,omitempty"`          // Maps placeholders set by earlier middleware to the user, tenant and key
+	GeoIP                   *GeoIPConfig               `json:"geoip,omitempty"`             // Finds the country of clients for policy rules
+	PromptStore             string                     `json:"prompt_store,omitempty"`      // State store holding the prompt library (default: memory)
+	Compare                 *services.ReferenceCompare `json:"compare,omitempty"`           // Replays sampled requests against a reference model
+	Honeypots               map[string]*HoneypotConfig `json:"honeypots,omitempty"`         // Decoy models answering with a canned response and a security alert
+	StreamResume            *StreamResumeConfig        `json:"stream_resume,omitempty"`     // Resume tokens in the error events of streams failing midway
+	PartialResponses        *PartialResponsesConfig    `json:"partial_responses,omitempty"` // Keeps what streams generated for clients that disconnected
+	Impl                    services.RouterService     `json:"-"`
+
+	exporter *services.StripeExporter
 }
 
 // ProviderConfig defines a provider's configuration.
 type ProviderConfig struct {
-	Name          string            `json:"name,omitempty"`
-	APIBaseURL    string            `json:"api_base_url,omitempty"`
-	Style         string            `json:"style,omitempty"`
-	ModelMappings map[string]string `json:"model_mappings,omitempty"` // For virtual providers: maps model name to target model spec
-	Impl          services.ProviderService
+	Name           string                         `json:"name,omitempty"`
+	APIBaseURL     string                         `json:"api_base_url,omitempty"`
+	APIKey         string                         `json:"api_key,omitempty"` // Static credential, may be a secret reference
+	Style          string                         `json:"style,omitempty"`
+	ModelMappings  map[string]string              `json:"model_mappings,omitempty"`   // For virtual providers: maps model name to target model spec
+	ModelPresets   map[string]*virtual.Preset     `json:"model_presets,omitempty"`    // For virtual providers: generation settings per model name
+	ModelRouting   map[string]*virtual.Routing    `json:"model_routing,omitempty"`    // For virtual providers: schedule and load rules per model name
+	Mock           *mock.Config                   `json:"mock,omitempty"`             // For mock providers: canned responses and fault injection
+	Headers        map[string]string              `json:"headers,omitempty"`          // Added to upstream requests; values may hold request placeholders, "-Name" deletes
+	RespHeaders    map[string]string              `json:"response_headers,omitempty"` // Added to the responses this provider serves
+	Paths          map[string]string              `json:"paths,omitempty"`            // Endpoint path per command ("inference", "list_models", "embeddings") replacing the standard one
+	Query          map[string]string              `json:"query,omitempty"`            // Query parameters added to upstream URLs, e.g. api-version
+	ForwardQuery   []string                       `json:"forward_query,omitempty"`    // Client query parameters passed on to the upstream
+	NativeThinking bool                           `json:"native_thinking,omitempty"`  // Pass Anthropic extended thinking through instead of mapping it to reasoning_effort
+	Preset         string                         `json:"preset,omitempty"`           // Built-in settings for a well-known upstream: groq, mistral or xai
+	Quirks         *services.ProviderQuirks       `json:"quirks,omitempty"`           // Request rewrites for upstreams deviating from the OpenAI API
+	Safety         string                         `json:"safety,omitempty"`           // How the policy's safety level is passed on: system, openai, gemini, mistral or none
+	Capabilities   services.Capabilities          `json:"capabilities,omitempty"`     // What the provider's models support, refining the preset's entries
+	Normalize      *services.RequestNormalization `json:"normalize,omitempty"`        // Tweaks to the removal of nulls and empty fields from upstream requests
+	Regions        []string                       `json:"regions,omitempty"`          // Where the provider processes data, e.g. eu-west, for data residency
+	Endpoints      *services.EndpointPolicy       `json:"endpoints,omitempty"`        // Upstream endpoints the provider may be called on
+	ModelRewrite   *services.ModelRewrite         `json:"model_rewrite,omitempty"`    // Rules rewriting the model as requests are dispatched
+	Timeouts       *services.ProviderTimeouts     `json:"timeouts,omitempty"`         // Connect, total and first token timeouts of upstream calls
+	Impl           services.ProviderService       `json:"-"`
+}
+
+// styleProbeTimeout bounds detecting the style of a provider configured with style auto
+const styleProbeTimeout = 10 * time.Second
+
+// headerTemplates turns configured headers into templates sorted by name,
+// resolving secret references in their values
+func headerTemplates(headers map[string]string) ([]services.HeaderTemplate, error) {
+	templates := make([]services.HeaderTemplate, 0, len(headers))
+	for name, value := range headers {
+		if deleted, ok := strings.CutPrefix(name, "-"); ok {
+			templates = append(templates, services.HeaderTemplate{Name: deleted, Delete: true})
+			continue
+		}
+		resolved, err := services.ResolveSecret(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %v", name, err)
+		}
+		templates = append(templates, services.HeaderTemplate{Name: name, Value: resolved})
+	}
+	slices.SortFunc(templates, func(a, b services.HeaderTemplate) int { return strings.Compare(a.Name, b.Name) })
+	return templates, nil
+}
+
+// providerLoad returns the in-flight request count of a provider
+func (m *RouterModule) providerLoad(name string) int64 {
+	p, ok := m.ProviderConfigs[name]
+	if !ok {
+		return 0
+	}
+	return p.Impl.InFlight()
+}
+
+// mockConfig returns the mock configuration, creating it on first use
+func (p *ProviderConfig) mockConfig() *mock.Config {
+	if p.Mock == nil {
+		p.Mock = &mock.Config{}
+	}
+	return p.Mock
+}
+
+// parseModelBlock parses the block of a virtual `model` directive into its
+// parameter preset and routing rules; either is nil when not configured.
+// The dispenser must be positioned on the first option of the block.
+func parseModelBlock(d *caddyfile.Dispenser) (*virtual.Preset, *virtual.Routing, error) {
+	preset := &virtual.Preset{}
+	routing := &virtual.Routing{}
+	hasPreset := false
+	for {
+		option := d.Val()
+		switch option {
+		case "timezone":
+			if !d.NextArg() {
+				return nil, nil, d.ArgErr()
+			}
+			routing.Timezone = d.Val()
+		case "schedule":
+			// schedule <window> <target>, e.g. schedule "Mon-Fri 09:00-18:00" openai/gpt-4.1
+			args := d.RemainingArgs()
+			if len(args) != 2 {
+				return nil, nil, d.Errf("schedule expects <window> <target>, got %d args", len(args))
+			}
+			routing.Rules = append(routing.Rules, &virtual.Rule{Schedule: args[0], Target: args[1]})
+		case "when_busy":
+			// when_busy <provider> <max_in_flight> <target>
+			args := d.RemainingArgs()
+			if len(args) != 3 {
+				return nil, nil, d.Errf("when_busy expects <provider> <max_in_flight> <target>, got %d args", len(args))
+			}
+			n, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil || n <= 0 {
+				return nil, nil, d.Errf("when_busy: invalid max_in_flight '%s'", args[1])
+			}
+			routing.Rules = append(routing.Rules, &virtual.Rule{
+				Provider:    strings.ToLower(args[0]),
+				MaxInFlight: n,
+				Target:      args[2],
+			})
+		case "temperature", "top_p":
+			hasPreset = true
+			if !d.NextArg() {
+				return nil, nil, d.ArgErr()
+			}
+			v, err := strconv.ParseFloat(d.Val(), 64)
+			if err != nil {
+				return nil, nil, d.Errf("invalid %s '%s'", option, d.Val())
+			}
+			if option == "temperature" {
+				preset.Temperature = &v
+			} else {
+				preset.TopP = &v
+			}
+		case "max_tokens":
+			hasPreset = true
+			if !d.NextArg() {
+				return nil, nil, d.ArgErr()
+			}
+			v, err := strconv.Atoi(d.Val())
+			if err != nil || v <= 0 {
+				return nil, nil, d.Errf("invalid max_tokens '%s'", d.Val())
+			}
+			preset.MaxTokens = &v
+		case "system_prompt":
+			hasPreset = true
+			if !d.NextArg() {
+				return nil, nil, d.ArgErr()
+			}
+			preset.SystemPrompt = d.Val()
+		case "tools":
+			hasPreset = true
+			// tools <name...> - an empty list strips all tools
+			preset.Tools = append([]string{}, d.RemainingArgs()...)
+		case "param":
+			hasPreset = true
+			// param <key> <json_value>
+			args := d.RemainingArgs()
+			if len(args) != 2 {
+				return nil, nil, d.Errf("param expects <key> <json_value>, got %d args", len(args))
+			}
+			if !json.Valid([]byte(args[1])) {
+				return nil, nil, d.Errf("param %s: value must be valid JSON, got '%s'", args[0], args[1])
+			}
+			if preset.Params == nil {
+				preset.Params = make(map[string]json.RawMessage)
+			}
+			preset.Params[args[0]] = json.RawMessage(args[1])
+		default:
+			return nil, nil, d.Errf("unrecognized model preset option '%s'", option)
+		}
+		if !d.NextBlock(2) {
+			break
+		}
+	}
+
+	if !hasPreset {
+		preset = nil
+	}
+	if len(routing.Rules) == 0 {
+		if routing.Timezone != "" {
+			return nil, nil, d.Err("timezone requires at least one schedule rule")
+		}
+		routing = nil
+	}
+	return preset, routing, nil
 }
 
 func ParseRouterModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
@@ -123,6 +327,11 @@ func (m *RouterModule) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 							return d.ArgErr()
 						}
 						p.APIBaseURL = d.Val()
+					case "api_key":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						p.APIKey = d.Val()
 					case "style":
 						if !d.NextArg() {
 							return d.ArgErr()
@@ -139,16 +348,483 @@ func (m *RouterModule) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 						virtualName := args[0]
 						targetModel := args[1]
 						p.ModelMappings[virtualName] = targetModel
+
+						// Optional block with parameter presets and routing rules for this model
+						if d.NextBlock(2) {
+							preset, routing, err := parseModelBlock(d)
+							if err != nil {
+								return err
+							}
+							if preset != nil {
+								if p.ModelPresets == nil {
+									p.ModelPresets = make(map[string]*virtual.Preset)
+								}
+								p.ModelPresets[virtualName] = preset
+							}
+							if routing != nil {
+								if p.ModelRouting == nil {
+									p.ModelRouting = make(map[string]*virtual.Routing)
+								}
+								p.ModelRouting[virtualName] = routing
+							}
+						}
+					case "path":
+						// path <command> <path>
+						args := d.RemainingArgs()
+						if len(args) != 2 {
+							return d.Errf("path expects <command> <path>, got %d args", len(args))
+						}
+						if p.Paths == nil {
+							p.Paths = make(map[string]string)
+						}
+						p.Paths[args[0]] = args[1]
+					case "query":
+						// query <name> <value>
+						args := d.RemainingArgs()
+						if len(args) != 2 {
+							return d.Errf("query expects <name> <value>, got %d args", len(args))
+						}
+						if p.Query == nil {
+							p.Query = make(map[string]string)
+						}
+						p.Query[args[0]] = args[1]
+					case "preset":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						p.Preset = strings.ToLower(d.Val())
+						if _, ok := providerPresets[p.Preset]; !ok {
+							return d.Errf("unknown preset '%s' for provider '%s'", d.Val(), providerName)
+						}
+					case "capability":
+						// capability <model_pattern> <capability>... - "-<capability>" marks it unsupported
+						args := d.RemainingArgs()
+						if len(args) < 2 {
+							return d.Errf("capability expects <model_pattern> <capability>..., got %d args", len(args))
+						}
+						entry := services.CapabilityEntry{Model: args[0]}
+						for _, c := range args[1:] {
+							if lacked, ok := strings.CutPrefix(c, "-"); ok {
+								entry.Lacks = append(entry.Lacks, lacked)
+							} else {
+								entry.Supports = append(entry.Supports, c)
+							}
+						}
+						p.Capabilities = append(p.Capabilities, entry)
+					case "normalize":
+						// normalize off | keep_nulls | keep_empty | drop_zero <field>...
+						args := d.RemainingArgs()
+						if len(args) == 0 {
+							return d.ArgErr()
+						}
+						if p.Normalize == nil {
+							p.Normalize = &services.RequestNormalization{}
+						}
+						switch args[0] {
+						case "off":
+							p.Normalize.Disabled = true
+						case "keep_nulls":
+							p.Normalize.KeepNulls = true
+						case "keep_empty":
+							p.Normalize.KeepEmpty = true
+						case "drop_zero":
+							if len(args) < 2 {
+								return d.Errf("normalize drop_zero expects at least one field")
+							}
+							p.Normalize.DropZero = append(p.Normalize.DropZero, args[1:]...)
+							args = args[:1]
+						default:
+							return d.Errf("unknown normalize option '%s' (off, keep_nulls, keep_empty, drop_zero)", args[0])
+						}
+						if len(args) > 1 {
+							return d.ArgErr()
+						}
+					case "safety":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						p.Safety = strings.ToLower(d.Val())
+						if !services.ValidSafetyDialect(p.Safety) {
+							return d.Errf("unknown safety dialect '%s' (system, openai, gemini, mistral, none)", d.Val())
+						}
+					case "native_thinking":
+						if d.NextArg() {
+							return d.ArgErr()
+						}
+						p.NativeThinking = true
+					case "region":
+						// region <name>...
+						args := d.RemainingArgs()
+						if len(args) == 0 {
+							return d.ArgErr()
+						}
+						for _, region := range args {
+							p.Regions = append(p.Regions, strings.ToLower(region))
+						}
+					case "allow_endpoints", "deny_endpoints":
+						// allow_endpoints <pattern>... | deny_endpoints <pattern>...
+						directive := d.Val()
+						args := d.RemainingArgs()
+						if len(args) == 0 {
+							return d.ArgErr()
+						}
+						if p.Endpoints == nil {
+							p.Endpoints = &services.EndpointPolicy{}
+						}
+						if directive == "allow_endpoints" {
+							p.Endpoints.Allow = append(p.Endpoints.Allow, args...)
+						} else {
+							p.Endpoints.Deny = append(p.Endpoints.Deny, args...)
+						}
+					case "model_rewrite":
+						// model_rewrite strip_prefix|add_suffix <value>
+						// model_rewrite map|regex <match> <replacement>
+						args := d.RemainingArgs()
+						if len(args) < 2 {
+							return d.ArgErr()
+						}
+						rule := services.ModelRewriteRule{Kind: strings.ToLower(args[0]), Match: args[1]}
+						switch rule.Kind {
+						case services.ModelRewriteStripPrefix, services.ModelRewriteAddSuffix:
+							if len(args) != 2 {
+								return d.Errf("model_rewrite %s expects one value, got %d", rule.Kind, len(args)-1)
+							}
+						case services.ModelRewriteMap, services.ModelRewriteRegex:
+							if len(args) != 3 {
+								return d.Errf("model_rewrite %s expects <match> <replacement>, got %d args", rule.Kind, len(args)-1)
+							}
+							rule.Replace = args[2]
+						default:
+							return d.Errf("unknown model_rewrite rule '%s' (strip_prefix, add_suffix, map, regex)", args[0])
+						}
+						if p.ModelRewrite == nil {
+							p.ModelRewrite = &services.ModelRewrite{}
+						}
+						p.ModelRewrite.Rules = append(p.ModelRewrite.Rules, rule)
+					case "timeout":
+						// timeout connect|total|first_token <duration>
+						args := d.RemainingArgs()
+						if len(args) != 2 {
+							return d.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(args[1])
+						if err != nil {
+							return d.Errf("invalid timeout duration '%s': %v", args[1], err)
+						}
+						if p.Timeouts == nil {
+							p.Timeouts = &services.ProviderTimeouts{}
+						}
+						if err := p.Timeouts.Set(strings.ToLower(args[0]), dur); err != nil {
+							return d.Err(err.Error())
+						}
+					case "forward_query":
+						// forward_query <name>...
+						args := d.RemainingArgs()
+						if len(args) == 0 {
+							return d.ArgErr()
+						}
+						p.ForwardQuery = append(p.ForwardQuery, args...)
+					case "header", "response_header":
+						// header <name> <value> | header -<name>
+						directive := d.Val()
+						args := d.RemainingArgs()
+						deleting := len(args) == 1 && strings.HasPrefix(args[0], "-")
+						if len(args) != 2 && !deleting {
+							return d.Errf("%s expects <name> <value> or -<name>, got %d args", directive, len(args))
+						}
+						value := ""
+						if !deleting {
+							value = args[1]
+						}
+						if directive == "header" {
+							if p.Headers == nil {
+								p.Headers = make(map[string]string)
+							}
+							p.Headers[args[0]] = value
+						} else {
+							if p.RespHeaders == nil {
+								p.RespHeaders = make(map[string]string)
+							}
+							p.RespHeaders[args[0]] = value
+						}
+					case "mock_response":
+						// mock_response <text> - may be repeated to script a sequence
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						p.mockConfig().Responses = append(p.mockConfig().Responses, d.Val())
+					case "mock_model":
+						args := d.RemainingArgs()
+						if len(args) == 0 {
+							return d.ArgErr()
+						}
+						p.mockConfig().Models = append(p.mockConfig().Models, args...)
+					case "mock_latency":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(d.Val())
+						if err != nil {
+							return d.Errf("invalid mock_latency '%s': %v", d.Val(), err)
+						}
+						p.mockConfig().Latency = caddy.Duration(dur)
+					case "mock_failure_rate":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						rate, err := strconv.ParseFloat(d.Val(), 64)
+						if err != nil || rate < 0 || rate > 1 {
+							return d.Errf("mock_failure_rate must be a number between 0 and 1, got '%s'", d.Val())
+						}
+						p.mockConfig().FailureRate = rate
+					case "mock_failure_status":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						status, err := strconv.Atoi(d.Val())
+						if err != nil || status < 400 || status > 599 {
+							return d.Errf("mock_failure_status must be an HTTP error status, got '%s'", d.Val())
+						}
+						p.mockConfig().FailureStatus = status
+					case "mock_chunk_size":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						size, err := strconv.Atoi(d.Val())
+						if err != nil || size < 0 {
+							return d.Errf("invalid mock_chunk_size '%s'", d.Val())
+						}
+						p.mockConfig().ChunkSize = size
+					case "mock_chunk_delay":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(d.Val())
+						if err != nil {
+							return d.Errf("invalid mock_chunk_delay '%s': %v", d.Val(), err)
+						}
+						p.mockConfig().ChunkDelay = caddy.Duration(dur)
 					default:
 						return d.Errf("unrecognized provider option '%s' for provider '%s'", d.Val(), providerName)
 					}
 				}
-				// Virtual providers don't need api_base_url
-				if p.Style != "virtual" && p.APIBaseURL == "" {
+				// Virtual and mock providers don't need api_base_url, presets provide one
+				if p.Style != "virtual" && p.Style != "mock" && p.Preset == "" && p.APIBaseURL == "" {
 					return d.Errf("provider %s: api_base_url is required", providerName)
 				}
 				m.ProviderConfigs[providerName] = &p
 				m.ProvidersOrder = append(m.ProvidersOrder, providerName)
+			case "policy":
+				// policy [key=<key_id>...] [model=<pattern>...] [ip=<cidr>...] [country=<code>...] { ... }
+				rule := &services.PolicyRule{}
+				for _, arg := range d.RemainingArgs() {
+					scope, value, ok := strings.Cut(arg, "=")
+					switch {
+					case ok && scope == "key":
+						rule.Keys = append(rule.Keys, value)
+					case ok && scope == "model":
+						rule.Models = append(rule.Models, value)
+					case ok && scope == "ip":
+						rule.IPs = append(rule.IPs, value)
+					case ok && scope == "country":
+						rule.Countries = append(rule.Countries, strings.ToUpper(value))
+					default:
+						return d.Errf("policy scope must be key=<key_id>, model=<pattern>, ip=<cidr> or country=<code>, got '%s'", arg)
+					}
+				}
+				for d.NextBlock(1) {
+					switch d.Val() {
+					case "allow_tools":
+						rule.AllowTools = append(rule.AllowTools, d.RemainingArgs()...)
+					case "deny_tools":
+						rule.DenyTools = append(rule.DenyTools, d.RemainingArgs()...)
+					case "deny_computer_use":
+						rule.DenyComputerUse = true
+					case "deny":
+						rule.Deny = true
+					case "providers":
+						args := d.RemainingArgs()
+						if len(args) == 0 {
+							return d.ArgErr()
+						}
+						for _, name := range args {
+							rule.Providers = append(rule.Providers, strings.ToLower(name))
+						}
+					case "rate_limit":
+						args := d.RemainingArgs()
+						if len(args) == 0 {
+							return d.ArgErr()
+						}
+						limit, err := parseBucketLimit(args)
+						if err != nil {
+							return d.Errf("policy rate_limit: %v", err)
+						}
+						rule.RateLimit = limit
+					case "tool_action":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						rule.ToolAction = strings.ToLower(d.Val())
+					case "max_output_tokens_limit":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						limit, err := strconv.Atoi(d.Val())
+						if err != nil || limit <= 0 {
+							return d.Errf("invalid max_output_tokens_limit '%s'", d.Val())
+						}
+						rule.MaxOutputTokensLimit = limit
+					case "safety":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						rule.Safety = strings.ToLower(d.Val())
+					case "residency":
+						args := d.RemainingArgs()
+						if len(args) == 0 {
+							return d.ArgErr()
+						}
+						for _, region := range args {
+							rule.Residency = append(rule.Residency, strings.ToLower(region))
+						}
+					case "stream_tokens_per_second":
+						if !d.NextArg() {
+							return d.ArgErr()
+						}
+						rate, err := strconv.ParseFloat(d.Val(), 64)
+						if err != nil || rate <= 0 {
+							return d.Errf("invalid stream_tokens_per_second '%s'", d.Val())
+						}
+						rule.StreamTokensPerSecond = rate
+					default:
+						return d.Errf("unrecognized policy option '%s'", d.Val())
+					}
+				}
+				if m.Policy == nil {
+					m.Policy = &services.Policy{}
+				}
+				m.Policy.Rules = append(m.Policy.Rules, rule)
+			case "request_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid request_timeout '%s': %v", d.Val(), err)
+				}
+				m.RequestTimeout = caddy.Duration(dur)
+			case "max_depth":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				depth, err := strconv.Atoi(d.Val())
+				if err != nil || depth <= 0 {
+					return d.Errf("invalid max_depth '%s'", d.Val())
+				}
+				m.MaxDepth = depth
+			case "selftest":
+				tests, err := parseSelfTestBlock(d)
+				if err != nil {
+					return err
+				}
+				m.SelfTests = append(m.SelfTests, tests...)
+			case "prompt_store":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.PromptStore = d.Val()
+			case "compare":
+				compare, err := parseCompareBlock(d)
+				if err != nil {
+					return err
+				}
+				m.Compare = compare
+			case "rate_limit":
+				rateLimit, err := parseRateLimitBlock(d)
+				if err != nil {
+					return err
+				}
+				m.RateLimit = rateLimit
+			case "stream_resume":
+				resume, err := parseStreamResumeBlock(d)
+				if err != nil {
+					return err
+				}
+				m.StreamResume = resume
+			case "partial_responses":
+				partials, err := parsePartialResponsesBlock(d)
+				if err != nil {
+					return err
+				}
+				m.PartialResponses = partials
+			case "quota":
+				quota, err := parseQuotaBlock(d)
+				if err != nil {
+					return err
+				}
+				m.Quota = quota
+			case "billing":
+				billing, err := parseBillingBlock(d)
+				if err != nil {
+					return err
+				}
+				m.Billing = billing
+			case "identity":
+				identity, err := parseIdentityBlock(d)
+				if err != nil {
+					return err
+				}
+				m.Identity = identity
+			case "honeypot":
+				name, honeypot, err := parseHoneypot(d)
+				if err != nil {
+					return err
+				}
+				if m.Honeypots == nil {
+					m.Honeypots = make(map[string]*HoneypotConfig)
+				}
+				m.Honeypots[name] = honeypot
+			case "geoip":
+				geoIP, err := parseGeoIPBlock(d)
+				if err != nil {
+					return err
+				}
+				m.GeoIP = geoIP
+			case "stage_limits":
+				limits, err := parseStageLimitsBlock(d)
+				if err != nil {
+					return err
+				}
+				m.StageLimits = limits
+			case "observability":
+				sinks, err := parseObservabilityBlock(d)
+				if err != nil {
+					return err
+				}
+				m.Observability = append(m.Observability, sinks...)
+			case "posthog_project":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.PosthogProject = d.Val()
+			case "upstream_headers":
+				// upstream_headers { propagate <pattern>...; strip <pattern>... }
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				if m.UpstreamHeaders == nil {
+					m.UpstreamHeaders = &services.HeaderPolicy{}
+				}
+				for d.NextBlock(1) {
+					switch d.Val() {
+					case "propagate":
+						m.UpstreamHeaders.Propagate = append(m.UpstreamHeaders.Propagate, d.RemainingArgs()...)
+					case "strip":
+						m.UpstreamHeaders.Strip = append(m.UpstreamHeaders.Strip, d.RemainingArgs()...)
+					default:
+						return d.Errf("unrecognized upstream_headers option '%s'", d.Val())
+					}
+				}
 			case "default_provider_for_model":
 				args := d.RemainingArgs()
 				if len(args) < 2 {
@@ -171,6 +847,9 @@ func (m *RouterModule) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 
 func (m *RouterModule) Provision(ctx caddy.Context) error {
 	m.Impl.Logger = ctx.Logger(m)
+	if err := EnsureAIApp(ctx); err != nil {
+		return err
+	}
 	m.Impl.Mu.Lock()
 	defer m.Impl.Mu.Unlock()
 
@@ -178,84 +857,357 @@ func (m *RouterModule) Provision(ctx caddy.Context) error {
 		m.Name = "default"
 	}
 
+	m.normalize()
+
+	if errs := m.Lint(false); len(errs) > 0 {
+		return fmt.Errorf("ai_router %s: invalid configuration:\n%w", m.Name, errors.Join(errs...))
+	}
+
+	if err := m.Policy.Validate(); err != nil {
+		return fmt.Errorf("ai_router %s: %w", m.Name, err)
+	}
+	m.Impl.Policy = m.Policy
+
+	if err := m.Identity.Validate(); err != nil {
+		return fmt.Errorf("ai_router %s: %w", m.Name, err)
+	}
+	// Model names are case-insensitive
+	for name, honeypot := range m.Honeypots {
+		if lower := strings.ToLower(name); lower != name {
+			delete(m.Honeypots, name)
+			m.Honeypots[lower] = honeypot
+		}
+	}
+
+	if err := m.UpstreamHeaders.Validate(); err != nil {
+		return fmt.Errorf("ai_router %s: %w", m.Name, err)
+	}
+	m.Impl.Headers = m.UpstreamHeaders
+
+	if m.PosthogProject != "" && !services.HasPosthogProject(m.PosthogProject) {
+		return fmt.Errorf("ai_router %s: posthog_project '%s' is not configured in the global ai options", m.Name, m.PosthogProject)
+	}
+	m.Impl.PosthogProject = m.PosthogProject
+	m.Impl.StageLimits = m.StageLimits.impl()
+	geoIP, err := m.GeoIP.impl()
+	if err != nil {
+		return fmt.Errorf("ai_router %s: %v", m.Name, err)
+	}
+	m.Impl.GeoIP = geoIP
+	rateLimits, err := m.RateLimit.impl(m.Name, m.Policy.HasClientRateLimits())
+	if err != nil {
+		return fmt.Errorf("ai_router %s: %v", m.Name, err)
+	}
+	m.Impl.RateLimits = rateLimits
+	quotas, err := m.Quota.impl(m.Name)
+	if err != nil {
+		return fmt.Errorf("ai_router %s: %v", m.Name, err)
+	}
+	m.Impl.Quotas = quotas
+	resume, err := m.StreamResume.impl(m.Name)
+	if err != nil {
+		return fmt.Errorf("ai_router %s: %v", m.Name, err)
+	}
+	m.Impl.Resume = resume
+	partials, err := m.PartialResponses.impl(m.Name)
+	if err != nil {
+		return fmt.Errorf("ai_router %s: %v", m.Name, err)
+	}
+	m.Impl.Partials = partials
+	ledger, exporter, err := m.Billing.impl(m.Name, m.Impl.Logger)
+	if err != nil {
+		return fmt.Errorf("ai_router %s: %v", m.Name, err)
+	}
+	m.Impl.Usage = ledger
+	promptStore, ok := services.LookupStateStore(m.PromptStore)
+	if !ok {
+		return fmt.Errorf("ai_router %s: prompt_store: unknown state store '%s'", m.Name, m.PromptStore)
+	}
+	m.Impl.Prompts = &services.PromptLibrary{Store: promptStore, Prefix: "prompts:" + m.Name + ":"}
+	if err := m.Compare.Validate(); err != nil {
+		return fmt.Errorf("ai_router %s: %w", m.Name, err)
+	}
+	m.Impl.Compare = m.Compare
+	m.Impl.Metrics = services.NewMetrics()
+	m.Impl.Fingerprints = services.NewFingerprintTracker()
+
+	if err := m.provisionSinks(); err != nil {
+		return fmt.Errorf("ai_router %s: %w", m.Name, err)
+	}
+
 	if m.Impl.Auth == nil {
+		if _, ok := services.LookupAuthService(m.AuthManagerName); !ok && m.AuthManagerName != "" {
+			m.Impl.Logger.Warn("Auth manager not registered yet; requests will be sent without target auth unless it is provisioned later",
+				zap.String("auth_manager", m.AuthManagerName))
+		}
 		m.Impl.Auth = services.GetAuthService(m.AuthManagerName)
 	}
 
 	for _, name := range m.ProvidersOrder {
 		p := m.ProviderConfigs[name]
 
+		capabilities, err := p.applyPreset()
+		if err != nil {
+			return fmt.Errorf("provider %s: %v", name, err)
+		}
+		if !services.ValidSafetyDialect(p.Safety) {
+			return fmt.Errorf("provider %s: unknown safety dialect '%s'", name, p.Safety)
+		}
+		for _, region := range p.Regions {
+			if err := services.ValidateResidencyRegion(region); err != nil {
+				return fmt.Errorf("provider %s: %v", name, err)
+			}
+		}
+		if err := p.Endpoints.Validate(); err != nil {
+			return fmt.Errorf("provider %s: %v", name, err)
+		}
+		if err := p.ModelRewrite.Compile(); err != nil {
+			return fmt.Errorf("provider %s: %v", name, err)
+		}
+
 		providerStyle, err := styles.ParseStyle(p.Style)
 		if err != nil {
 			return fmt.Errorf("provider %s: invalid style '%s': %v", name, p.Style, err)
 		}
 
-		// Virtual providers don't need api_base_url
+		// Virtual and mock providers don't need api_base_url
 		var parsedURL url.URL
-		if providerStyle != styles.StyleVirtual {
+		if providerStyle != styles.StyleVirtual && providerStyle != styles.StyleMock {
 			if p.APIBaseURL == "" {
 				return fmt.Errorf("provider %s: api_base_url is required", name)
 			}
-			parsed, err := url.Parse(p.APIBaseURL)
+			baseURL, err := services.ResolveSecret(p.APIBaseURL)
+			if err != nil {
+				return fmt.Errorf("provider %s: api_base_url: %v", name, err)
+			}
+			parsed, err := url.Parse(baseURL)
 			if err != nil {
 				return fmt.Errorf("provider %s: invalid api_base_url '%s': %v", name, p.APIBaseURL, err)
 			}
 			parsedURL = *parsed
 		}
 
+		apiKey, err := services.ResolveSecret(p.APIKey)
+		if err != nil {
+			return fmt.Errorf("provider %s: api_key: %v", name, err)
+		}
+
+		// Plugin parameters in model mappings may reference secrets too
+		modelMappings := make(map[string]string, len(p.ModelMappings))
+		for alias, target := range p.ModelMappings {
+			resolved, err := services.ResolveSecret(target)
+			if err != nil {
+				return fmt.Errorf("provider %s: model %s: %v", name, alias, err)
+			}
+			modelMappings[alias] = resolved
+		}
+
+		requestHeaders, err := headerTemplates(p.Headers)
+		if err != nil {
+			return fmt.Errorf("provider %s: %v", name, err)
+		}
+		responseHeaders, err := headerTemplates(p.RespHeaders)
+		if err != nil {
+			return fmt.Errorf("provider %s: response %v", name, err)
+		}
+
+		// Query values may be credentials, e.g. key=... for some gateways
+		var query url.Values
+		if len(p.Query) > 0 {
+			query = make(url.Values, len(p.Query))
+			for param, value := range p.Query {
+				resolved, err := services.ResolveSecret(value)
+				if err != nil {
+					return fmt.Errorf("provider %s: query %s: %v", name, param, err)
+				}
+				query.Set(param, resolved)
+			}
+		}
+
 		p.Impl = services.ProviderService{
-			Name:      name,
-			ParsedURL: parsedURL,
-			Style:     providerStyle,
-			Router:    &m.Impl,
+			Name:            name,
+			ParsedURL:       parsedURL,
+			Style:           providerStyle,
+			Router:          &m.Impl,
+			APIKey:          apiKey,
+			RequestHeaders:  requestHeaders,
+			ResponseHeaders: responseHeaders,
+			Query:           query,
+			ForwardQuery:    p.ForwardQuery,
+			NativeThinking:  p.NativeThinking || providerStyle == styles.StyleAnthropic,
+			Quirks:          p.Quirks,
+			SafetyDialect:   p.Safety,
+			Capabilities:    capabilities,
+			Normalize:       p.Normalize,
+			Regions:         p.Regions,
+			Endpoints:       p.Endpoints,
+			Timeouts:        p.Timeouts,
+		}
+		if p.ModelRewrite != nil {
+			p.Impl.ModelRewriter = p.ModelRewrite
+		}
+
+		if providerStyle == styles.StyleAuto {
+			probeCtx, cancel := context.WithTimeout(ctx, styleProbeTimeout)
+			probe, err := openai.ProbeStyle(probeCtx, &p.Impl)
+			cancel()
+			if errors.Is(err, openai.ErrUnsupportedStyle) {
+				return fmt.Errorf("provider %s: %v", name, err)
+			}
+			if err != nil {
+				// Unreachable upstreams are probed again on the next reload
+				m.Impl.Logger.Warn("Style detection failed; using openai-chat-completions",
+					zap.String("provider", name), zap.Error(err))
+				providerStyle = styles.StyleChatCompletions
+			} else {
+				providerStyle = probe.Style
+				// Configured and preset entries win over detected ones
+				p.Impl.Capabilities = append(slices.Clone(probe.Capabilities), capabilities...)
+			}
+			p.Impl.Style = providerStyle
 		}
 
 		// Initialize commands based on style
 		var providerCommands map[string]any
 		switch providerStyle {
-		case styles.StyleChatCompletions: // OpenAI-compatible (chat completions)
+		case styles.StyleChatCompletions, styles.StyleVLLM, styles.StyleTGI: // OpenAI-compatible (chat completions)
 			providerCommands = map[string]any{
 				"list_models": &openai.ListModels{},
 				"inference":   &openai.ChatCompletions{},
+				"embeddings":  &openai.Embeddings{},
 			}
 		case styles.StyleResponses: // OpenAI Responses API
 			providerCommands = map[string]any{
 				"list_models": &openai.ListModels{},
 				"inference":   &openai.Responses{},
+				"embeddings":  &openai.Embeddings{},
+			}
+		case styles.StyleGoogleGenAI: // Google Gemini API
+			providerCommands = map[string]any{
+				"list_models": &gemini.ListModels{},
+				"inference":   &gemini.Inference{},
+			}
+		case styles.StyleAnthropic: // Anthropic Messages API
+			providerCommands = map[string]any{
+				"list_models": &anthropic.ListModels{},
+				"inference":   &anthropic.Inference{},
 			}
 		case styles.StyleVirtual: // Virtual provider (model aliasing)
-			if len(p.ModelMappings) == 0 {
+			if len(modelMappings) == 0 {
 				return fmt.Errorf("provider %s: virtual provider requires at least one model mapping", name)
 			}
+			for alias, routing := range p.ModelRouting {
+				if err := routing.Provision(); err != nil {
+					return fmt.Errorf("provider %s: model %s: %v", name, alias, err)
+				}
+			}
 			// Register the virtual plugin so it can intercept requests
 			virtualPlugin := &virtual.VirtualPlugin{
 				ProviderName:  name,
-				ModelMappings: p.ModelMappings,
+				ModelMappings: modelMappings,
+				Presets:       p.ModelPresets,
+				Routing:       p.ModelRouting,
+				Load:          m.providerLoad,
 			}
 			plugin.RegisterPlugin("virtual:"+name, virtualPlugin)
 
 			providerCommands = map[string]any{
 				"list_models": &virtual.VirtualListModels{
 					ProviderName:  name,
-					ModelMappings: p.ModelMappings,
+					ModelMappings: modelMappings,
 				},
 				// No inference command - virtual providers work via plugin interception
 			}
+		case styles.StyleMock: // Mock provider (canned responses for testing)
+			providerCommands = map[string]any{
+				"list_models": &mock.ListModels{Config: p.Mock},
+				"inference":   &mock.Inference{Config: p.Mock},
+			}
 		default:
 			return fmt.Errorf("provider %s: no driver for style '%s'", name, providerStyle)
 		}
 		p.Impl.Commands = providerCommands
 
+		if len(p.Paths) > 0 {
+			p.Impl.Paths = make(map[string]string, len(p.Paths))
+			for command, path := range p.Paths {
+				if _, ok := providerCommands[command]; !ok || providerStyle == styles.StyleVirtual || providerStyle == styles.StyleMock {
+					return fmt.Errorf("provider %s: path: style '%s' has no %s endpoint", name, providerStyle, command)
+				}
+				resolved, err := services.ResolveSecret(path)
+				if err != nil {
+					return fmt.Errorf("provider %s: path %s: %v", name, command, err)
+				}
+				if _, err := url.Parse(resolved); err != nil {
+					return fmt.Errorf("provider %s: invalid %s path '%s': %v", name, command, path, err)
+				}
+				p.Impl.Paths[command] = resolved
+			}
+		}
+
+		// Log the configured (unresolved) base URL so resolved secrets never reach the logs
 		m.Impl.Logger.Info("Provisioned provider",
 			zap.String("name", name),
 			zap.String("base_url", p.APIBaseURL),
+			zap.String("api_key", services.RedactSecret(apiKey)),
 			zap.String("style", string(providerStyle)))
 	}
 
+	if errs := m.SelfTest(); len(errs) > 0 {
+		return fmt.Errorf("ai_router %s: selftest failed:\n%w", m.Name, errors.Join(errs...))
+	}
+
+	if exporter != nil {
+		m.exporter = exporter
+		m.exporter.Start()
+	}
 	RegisterRouter(m.Name, m)
 	return nil
 }
 
+// normalize fills in fields that the Caddyfile parser sets implicitly, so that
+// routers configured through native JSON (or the admin API) behave identically.
+func (m *RouterModule) normalize() {
+	m.Name = strings.ToLower(strings.TrimSpace(m.Name))
+	m.AuthManagerName = strings.ToLower(strings.TrimSpace(m.AuthManagerName))
+
+	providers := make(map[string]*ProviderConfig, len(m.ProviderConfigs))
+	for key, p := range m.ProviderConfigs {
+		if p == nil {
+			continue
+		}
+		name := strings.ToLower(key)
+		p.Name = name
+		p.Style = strings.ToLower(p.Style)
+		if p.ModelMappings == nil {
+			p.ModelMappings = make(map[string]string)
+		}
+		providers[name] = p
+	}
+	m.ProviderConfigs = providers
+
+	// JSON maps are unordered: without an explicit order, fall back to sorted names
+	if len(m.ProvidersOrder) == 0 {
+		for name := range m.ProviderConfigs {
+			m.ProvidersOrder = append(m.ProvidersOrder, name)
+		}
+		slices.Sort(m.ProvidersOrder)
+	}
+	for i, name := range m.ProvidersOrder {
+		m.ProvidersOrder[i] = strings.ToLower(name)
+	}
+
+	if m.DefaultProviderForModel == nil {
+		m.DefaultProviderForModel = make(map[string][]string)
+	}
+	for model, names := range m.DefaultProviderForModel {
+		for i, name := range names {
+			names[i] = strings.ToLower(name)
+		}
+		m.DefaultProviderForModel[model] = names
+	}
+}
+
 func (m *RouterModule) Validate() error {
 	m.Impl.Mu.RLock()
 	defer m.Impl.Mu.RUnlock()
@@ -286,9 +1238,13 @@ func uniqueProviders(priority string, order []string) []string {
 func (m *RouterModule) ResolveProvidersOrderAndModel(model string) (providerNames []string, actualModelName string) {
 	m.Impl.Mu.RLock()
 	defer m.Impl.Mu.RUnlock()
+	return m.resolveProvidersOrderAndModel(model)
+}
 
+// resolveProvidersOrderAndModel is ResolveProvidersOrderAndModel for callers holding m.Impl.Mu
+func (m *RouterModule) resolveProvidersOrderAndModel(model string) (providerNames []string, actualModelName string) {
 	// Strip plugin suffixes: model="gpt-4+plugin1:arg"
-	actualModelName = strings.SplitN(model, "+", 2)[0]
+	actualModelName = services.UnescapeModel(plugin.ParseModelSpec(model).Model)
 
 	// Check for explicit provider prefix: "providerName/modelName"
 	parts := strings.SplitN(actualModelName, "/", 2)
@@ -313,7 +1269,7 @@ func (m *RouterModule) ResolveProvidersOrderAndModel(model string) (providerName
 				m.Impl.Logger.Debug("Found default provider for model",
 					zap.String("model", actualModelName),
 					zap.String("provider", pName))
-				return uniqueProviders(pName, m.ProvidersOrder), actualModelName
+				return m.avoidRateLimited(uniqueProviders(pName, m.ProvidersOrder)), actualModelName
 			}
 			m.Impl.Logger.Warn("Default provider for model configured but provider itself not found",
 				zap.String("model", actualModelName),
@@ -321,12 +1277,32 @@ func (m *RouterModule) ResolveProvidersOrderAndModel(model string) (providerName
 		}
 	}
 
-	return m.ProvidersOrder, actualModelName
+	return m.avoidRateLimited(m.ProvidersOrder), actualModelName
+}
+
+// avoidRateLimited moves providers whose upstream quota is known to be
+// exhausted to the end of the order, keeping them as a last resort
+func (m *RouterModule) avoidRateLimited(order []string) []string {
+	now := time.Now()
+	var ready, limited []string
+	for _, name := range order {
+		if p, ok := m.ProviderConfigs[name]; ok && p.Impl.RateLimited(now) {
+			limited = append(limited, name)
+			continue
+		}
+		ready = append(ready, name)
+	}
+	if len(limited) == 0 {
+		return order
+	}
+	m.Impl.Logger.Debug("Deprioritizing rate-limited providers", zap.Strings("providers", limited))
+	return append(ready, limited...)
 }
 
 var (
 	_ caddy.Provisioner           = (*RouterModule)(nil)
 	_ caddy.Validator             = (*RouterModule)(nil)
+	_ caddy.CleanerUpper          = (*RouterModule)(nil)
 	_ caddyhttp.MiddlewareHandler = (*RouterModule)(nil)
 	_ caddyfile.Unmarshaler       = (*RouterModule)(nil)
 )
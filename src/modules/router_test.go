@@ -0,0 +1,388 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+)
+
+func provisionRouter(t *testing.T, m *RouterModule) error {
+	t.Helper()
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	return m.Provision(ctx)
+}
+
+func TestRouterModule_JSONConfig(t *testing.T) {
+	cfg := `{
+		"name": "JSONTest",
+		"providers": {
+			"Fake": {"style": "MOCK", "mock": {"responses": ["hi"], "latency": "10ms"}},
+			"alias": {"style": "virtual", "model_mappings": {"fast": "fake/mock+fuzz"}}
+		},
+		"default_provider_for_model": {"mock": ["FAKE"]}
+	}`
+
+	var m RouterModule
+	if err := caddy.StrictUnmarshalJSON([]byte(cfg), &m); err != nil {
+		t.Fatalf("Failed to unmarshal router JSON: %v", err)
+	}
+	if err := provisionRouter(t, &m); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	if strings.Join(m.ProvidersOrder, ",") != "alias,fake" {
+		t.Errorf("ProvidersOrder = %v, want [alias fake]", m.ProvidersOrder)
+	}
+
+	fake := m.ProviderConfigs["fake"]
+	if fake == nil || fake.Name != "fake" {
+		t.Fatalf("Provider fake not normalized: %+v", fake)
+	}
+	if _, ok := fake.Impl.Commands["inference"]; !ok {
+		t.Errorf("Provider fake has no inference command")
+	}
+	if time.Duration(fake.Mock.Latency) != 10*time.Millisecond {
+		t.Errorf("Mock latency = %v, want 10ms", time.Duration(fake.Mock.Latency))
+	}
+
+	if _, ok := GetRouter("jsontest"); !ok {
+		t.Errorf("Router not registered under normalized name")
+	}
+
+	providers, model := m.ResolveProvidersOrderAndModel("mock")
+	if model != "mock" || len(providers) == 0 || providers[0] != "fake" {
+		t.Errorf("ResolveProvidersOrderAndModel = %v, %q", providers, model)
+	}
+}
+
+func TestRouterModule_CaddyfileJSONRoundTrip(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	ai_router {
+		name roundtrip
+		provider fake {
+			style mock
+			mock_response "hello"
+			mock_chunk_delay 5ms
+		}
+		provider alias {
+			style virtual
+			model fast fake/mock
+			model writer fake/mock {
+				temperature 0.9
+				system_prompt "Write vividly."
+				tools
+			}
+		}
+	}`)
+
+	var m RouterModule
+	if err := m.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+
+	data, err := json.Marshal(&m)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), "Impl") {
+		t.Errorf("Runtime state leaked into JSON config: %s", data)
+	}
+
+	var restored RouterModule
+	if err := caddy.StrictUnmarshalJSON(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal adapted JSON: %v", err)
+	}
+	if err := provisionRouter(t, &restored); err != nil {
+		t.Fatalf("Provision of adapted JSON failed: %v", err)
+	}
+	if strings.Join(restored.ProvidersOrder, ",") != "fake,alias" {
+		t.Errorf("ProvidersOrder = %v, want [fake alias]", restored.ProvidersOrder)
+	}
+	if got := restored.ProviderConfigs["fake"].Mock.Responses; len(got) != 1 || got[0] != "hello" {
+		t.Errorf("Mock responses = %v", got)
+	}
+	preset := restored.ProviderConfigs["alias"].ModelPresets["writer"]
+	if preset == nil || preset.Temperature == nil || *preset.Temperature != 0.9 ||
+		preset.SystemPrompt != "Write vividly." || preset.Tools == nil {
+		t.Errorf("Model preset = %+v", preset)
+	}
+}
+
+func TestRouterModule_LintUnknownReferences(t *testing.T) {
+	cfg := `{
+		"name": "linttest",
+		"providers": {
+			"alias": {"style": "virtual", "model_mappings": {"fast": "missing/gpt-4+nosuchplugin"}}
+		},
+		"default_provider_for_model": {"gpt-4": ["ghost"]}
+	}`
+
+	var m RouterModule
+	if err := json.Unmarshal([]byte(cfg), &m); err != nil {
+		t.Fatalf("Failed to unmarshal router JSON: %v", err)
+	}
+
+	err := provisionRouter(t, &m)
+	if err == nil {
+		t.Fatal("Expected provision to fail")
+	}
+	for _, want := range []string{"unknown provider 'missing'", "unregistered plugin 'nosuchplugin'", "unknown provider 'ghost'"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error %q does not mention %q", err.Error(), want)
+		}
+	}
+}
+
+func TestRouterModule_ObservabilitySinks(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	ai_router {
+		name sinks
+		provider fake {
+			style mock
+		}
+		observability {
+			posthog
+			webhook http://127.0.0.1:1/events {
+				header Authorization "Bearer token"
+				batch_size 10
+				flush_interval 1s
+			}
+			otlp http://127.0.0.1:1
+			langfuse {
+				public_key pk
+				secret_key sk
+			}
+		}
+	}`)
+
+	var m RouterModule
+	if err := m.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if len(m.Observability) != 4 {
+		t.Fatalf("Observability = %+v", m.Observability)
+	}
+	webhook := m.Observability[1]
+	if webhook.Type != "webhook" || webhook.URL != "http://127.0.0.1:1/events" ||
+		webhook.Headers["Authorization"] != "Bearer token" || webhook.BatchSize != 10 {
+		t.Errorf("webhook sink = %+v", webhook)
+	}
+	if lf := m.Observability[3]; lf.URL != "" || lf.PublicKey != "pk" || lf.SecretKey != "sk" {
+		t.Errorf("langfuse sink = %+v", lf)
+	}
+
+	if err := provisionRouter(t, &m); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Cleanup() })
+	if len(m.Impl.Sinks) != 4 {
+		t.Errorf("provisioned %d sinks, want 4", len(m.Impl.Sinks))
+	}
+
+	bad := RouterModule{
+		ProviderConfigs: map[string]*ProviderConfig{"fake": {Style: "mock"}},
+		Observability:   []*ObservabilitySinkConfig{{Type: "langfuse"}},
+	}
+	if err := provisionRouter(t, &bad); err == nil || !strings.Contains(err.Error(), "public_key") {
+		t.Errorf("expected missing langfuse keys to be rejected, got %v", err)
+	}
+}
+
+func TestRouterModule_SelfTest(t *testing.T) {
+	config := func(selftest string) string {
+		return `
+	ai_router {
+		name selftest
+		provider a {
+			style mock
+		}
+		provider b {
+			style mock
+		}
+		provider team {
+			style virtual
+			model fast a/m1
+		}
+		default_provider_for_model gpt-4o b
+		selftest {
+			` + selftest + `
+		}
+	}`
+	}
+
+	var ok RouterModule
+	if err := ok.UnmarshalCaddyfile(caddyfile.NewTestDispenser(config(`
+			resolves gpt-4o b a team
+			resolves a/gpt-4o a
+			alias fast a/m1
+			alias team/fast a/m1`))); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if len(ok.SelfTests) != 4 || ok.SelfTests[0].Model != "gpt-4o" || len(ok.SelfTests[0].Providers) != 3 {
+		t.Fatalf("SelfTests = %+v", ok.SelfTests)
+	}
+	if err := provisionRouter(t, &ok); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	var bad RouterModule
+	if err := bad.UnmarshalCaddyfile(caddyfile.NewTestDispenser(config(`
+			resolves gpt-4o a b
+			alias fast b/m1
+			alias slow a/m1`))); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	err := provisionRouter(t, &bad)
+	if err == nil {
+		t.Fatal("Expected provision to fail")
+	}
+	for _, want := range []string{
+		"'gpt-4o' resolves to providers [b a team], expected [a b]",
+		"'fast' maps to 'a/m1', expected 'b/m1'",
+		"'slow' is not mapped",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error %q does not mention %q", err.Error(), want)
+		}
+	}
+}
+
+func TestRouterModule_ProviderPreset(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	ai_router {
+		name presets
+		provider groq {
+			preset groq
+			api_key test
+			capability meta-llama/llama-4-scout* -tools
+		}
+		provider eu {
+			preset mistral
+			api_base_url https://eu.mistral.example/v1
+		}
+	}`)
+
+	var m RouterModule
+	if err := m.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if err := provisionRouter(t, &m); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	groq := &m.ProviderConfigs["groq"].Impl
+	if groq.ParsedURL.String() != "https://api.groq.com/openai/v1" {
+		t.Errorf("groq base URL = %s", groq.ParsedURL.String())
+	}
+	if groq.Quirks == nil || !groq.Quirks.JSONModeHint {
+		t.Errorf("groq quirks = %+v, want JSON mode hint", groq.Quirks)
+	}
+	if ok, known := groq.Capabilities.Supports("meta-llama/llama-4-scout-17b", "vision"); !ok || !known {
+		t.Error("expected llama 4 on groq to support vision")
+	}
+	if ok, known := groq.Capabilities.Supports("meta-llama/llama-4-scout-17b", "tools"); ok || !known {
+		t.Error("expected the configured capability to override the preset")
+	}
+	if ok, _ := groq.Capabilities.Supports("llama-3.3-70b-versatile", "tools"); !ok {
+		t.Error("expected groq models to support tools")
+	}
+
+	eu := &m.ProviderConfigs["eu"].Impl
+	if eu.ParsedURL.Host != "eu.mistral.example" {
+		t.Errorf("configured api_base_url should win over the preset, got %s", eu.ParsedURL.String())
+	}
+	if eu.Quirks == nil || eu.Quirks.RenameFields["seed"] != "random_seed" {
+		t.Errorf("mistral quirks = %+v", eu.Quirks)
+	}
+
+	bad := caddyfile.NewTestDispenser(`
+	ai_router {
+		provider x {
+			preset nope
+		}
+	}`)
+	if err := (&RouterModule{}).UnmarshalCaddyfile(bad); err == nil {
+		t.Error("expected an unknown preset to be rejected")
+	}
+}
+
+func TestRouterModule_Identity(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	ai_router {
+		identity {
+			user_id {http.request.header.X-User-Id}
+			tenant {http.request.header.X-Org}
+		}
+	}`)
+	var m RouterModule
+	if err := m.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	r.Header.Set("X-User-Id", "u-42")
+	repl := caddy.NewReplacer()
+	repl.Map(func(key string) (any, bool) {
+		name, ok := strings.CutPrefix(key, "http.request.header.")
+		return r.Header.Get(name), ok
+	})
+	ctx := context.WithValue(r.Context(), caddy.ReplacerCtxKey, repl)
+	ctx = context.WithValue(ctx, plugin.ContextTenantID(), "from-key")
+	r = m.Identity.Apply(r.WithContext(ctx))
+
+	if got, _ := r.Context().Value(plugin.ContextUserID()).(string); got != "u-42" {
+		t.Errorf("user ID = %q, want u-42", got)
+	}
+	// A header that is not sent leaves the auth manager's tenant alone
+	if got, _ := r.Context().Value(plugin.ContextTenantID()).(string); got != "from-key" {
+		t.Errorf("tenant = %q, want from-key", got)
+	}
+
+	empty := caddyfile.NewTestDispenser(`
+	ai_router {
+		identity {
+		}
+	}`)
+	var e RouterModule
+	if err := e.UnmarshalCaddyfile(empty); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+	if err := provisionRouter(t, &e); err == nil {
+		t.Error("expected an empty identity block to be rejected")
+	}
+}
+
+func TestRouterModule_Honeypot(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	ai_router {
+		honeypot openai/GPT-5-Internal "Service temporarily unavailable."
+		honeypot internal/admin-model
+	}`)
+	var m RouterModule
+	if err := m.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+
+	hp, ok := m.Honeypot("OpenAI/gpt-5-internal+tee")
+	if !ok || hp.ResponseText() != "Service temporarily unavailable." {
+		t.Errorf("Honeypot = %+v, %v; want the configured response whatever the case and plugins", hp, ok)
+	}
+	if hp, ok := m.Honeypot("internal/admin-model"); !ok || hp.ResponseText() != DefaultHoneypotResponse {
+		t.Errorf("expected the default response, got %+v, %v", hp, ok)
+	}
+	if _, ok := m.Honeypot("openai/gpt-4o"); ok {
+		t.Error("expected a regular model not to be a honeypot")
+	}
+}
@@ -0,0 +1,111 @@
+package modules
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// SelfTest is an expectation about the router's routing, checked when the
+// router is provisioned. It sets either Providers or Target.
+type SelfTest struct {
+	// Model is the requested model, e.g. "gpt-4o" or the alias "team/fast"
+	Model string `json:"model"`
+	// Providers is the expected provider order for Model
+	Providers []string `json:"providers,omitempty"`
+	// Target is the expected mapping of the virtual model Model
+	Target string `json:"target,omitempty"`
+}
+
+// SelfTest evaluates the router's selftest expectations, returning one error
+// per expectation that does not hold. The caller holds m.Impl.Mu.
+func (m *RouterModule) SelfTest() []error {
+	var errs []error
+	for _, t := range m.SelfTests {
+		var err error
+		switch {
+		case t.Target != "":
+			err = m.checkAlias(t.Model, t.Target)
+		case len(t.Providers) > 0:
+			providers, _ := m.resolveProvidersOrderAndModel(t.Model)
+			want := make([]string, len(t.Providers))
+			for i, name := range t.Providers {
+				want[i] = strings.ToLower(name)
+			}
+			if !slices.Equal(providers, want) {
+				err = fmt.Errorf("model '%s' resolves to providers [%s], expected [%s]",
+					t.Model, strings.Join(providers, " "), strings.Join(want, " "))
+			}
+		default:
+			err = fmt.Errorf("expectation for model '%s' sets neither providers nor target", t.Model)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("selftest: %w", err))
+		}
+	}
+	return errs
+}
+
+// checkAlias checks that a virtual model maps to target. Without a provider
+// prefix the alias is looked up in every virtual provider, in provider order.
+func (m *RouterModule) checkAlias(alias, target string) error {
+	prefix, name, hasPrefix := strings.Cut(alias, "/")
+	for _, providerName := range m.ProvidersOrder {
+		if hasPrefix && providerName != strings.ToLower(prefix) {
+			continue
+		}
+		p := m.ProviderConfigs[providerName]
+		if style, _ := styles.ParseStyle(p.Style); style != styles.StyleVirtual {
+			continue
+		}
+		lookup := alias
+		if hasPrefix {
+			lookup = name
+		}
+		mapped, ok := p.ModelMappings[lookup]
+		if !ok {
+			continue
+		}
+		if mapped != target {
+			return fmt.Errorf("alias '%s' maps to '%s', expected '%s'", alias, mapped, target)
+		}
+		return nil
+	}
+	return fmt.Errorf("alias '%s' is not mapped by any virtual provider", alias)
+}
+
+// parseSelfTestBlock parses the `selftest { ... }` block of `ai_router`:
+//
+//	selftest {
+//		resolves gpt-4o azure openai
+//		alias fast openai/gpt-4o-mini
+//		alias team/smart "openai/gpt-4.1,openrouter/gpt-4.1+stools"
+//	}
+func parseSelfTestBlock(d *caddyfile.Dispenser) ([]*SelfTest, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	var tests []*SelfTest
+	for d.NextBlock(1) {
+		kind := d.Val()
+		args := d.RemainingArgs()
+		switch kind {
+		case "resolves":
+			if len(args) < 2 {
+				return nil, d.Errf("resolves expects <model> <provider>..., got %d args", len(args))
+			}
+			tests = append(tests, &SelfTest{Model: args[0], Providers: args[1:]})
+		case "alias":
+			if len(args) != 2 {
+				return nil, d.Errf("alias expects <virtual_model> <target>, got %d args", len(args))
+			}
+			tests = append(tests, &SelfTest{Model: args[0], Target: args[1]})
+		default:
+			return nil, d.Errf("unrecognized selftest expectation '%s'", kind)
+		}
+	}
+	return tests, nil
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// APIKeysModule serves the self-service endpoints of the keys an
+// ai_auth_keys manager issues. Callers authenticate with an admin key and
+// only see the keys of their own tenant:
+//
+//	GET    /v1/api_keys               the tenant's keys
+//	POST   /v1/api_keys               create a key ({"name"?, "role"?, "residency"?}); returns its secret
+//	GET    /v1/api_keys/{id}          one key
+//	DELETE /v1/api_keys/{id}          revoke a key
+//	POST   /v1/api_keys/{id}/rotate   replace a key's secret; returns the new one
+type APIKeysModule struct {
+	// Auth names the ai_auth_keys manager (default: "default")
+	Auth   string `json:"auth,omitempty"`
+	logger *zap.Logger
+}
+
+// apiKeyBody is the body of the create endpoint
+type apiKeyBody struct {
+	Name      string   `json:"name"`
+	Role      string   `json:"role"`
+	Residency []string `json:"residency"`
+}
+
+// apiKeyWithSecret is a key as returned on creation and rotation, the only
+// times its secret is shown
+type apiKeyWithSecret struct {
+	*services.APIKey
+	Secret string `json:"secret"`
+}
+
+func ParseAPIKeysModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m APIKeysModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "auth":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.Auth = h.Val()
+			default:
+				return nil, h.Errf("unrecognized ai_api_keys option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*APIKeysModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_api_keys",
+		New: func() caddy.Module { return new(APIKeysModule) },
+	}
+}
+
+func (m *APIKeysModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	if m.Auth == "" {
+		m.Auth = "default"
+	}
+	return nil
+}
+
+func (m *APIKeysModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	// The manager may be provisioned after this handler, so it is looked up per request
+	service, _ := services.LookupAuthService(m.Auth)
+	auth, ok := service.(*modules.KeyAuthModule)
+	if !ok {
+		m.logger.Error("Key auth manager not found", zap.String("name", m.Auth))
+		http.Error(w, "key auth manager not found", http.StatusInternalServerError)
+		return nil
+	}
+	caller, err := auth.Authenticate(r)
+	if err != nil {
+		http.Error(w, "authentication error", http.StatusUnauthorized)
+		return nil
+	}
+	if caller.Role != services.APIKeyRoleAdmin {
+		http.Error(w, "an admin key is required", http.StatusForbidden)
+		return nil
+	}
+	keys, tenant := auth.Keys, caller.Tenant
+
+	// The path below .../api_keys names the key and, optionally, an action;
+	// handle_path may already have stripped the prefix
+	rest := r.URL.Path
+	if _, after, found := strings.Cut(rest, "/api_keys"); found && (after == "" || after[0] == '/') {
+		rest = after
+	}
+	id, sub, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		list, err := keys.List(tenant)
+		data := make([]*services.APIKey, len(list))
+		for i, key := range list {
+			data[i] = key.Public()
+		}
+		m.writeResult(w, http.StatusOK, map[string]any{"object": "list", "data": data}, err)
+	case id == "" && r.Method == http.MethodPost:
+		var body apiKeyBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return nil
+		}
+		key, secret, err := auth.CreateKey(caller, body.Name, body.Role, body.Residency)
+		if err == nil {
+			m.logger.Info("api key created", zap.String("tenant", tenant), zap.String("id", key.ID), zap.String("by", caller.ID))
+			m.writeResult(w, http.StatusCreated, apiKeyWithSecret{key.Public(), secret}, nil)
+		} else {
+			m.writeResult(w, 0, nil, err)
+		}
+	case sub == "rotate" && r.Method == http.MethodPost:
+		key, secret, err := auth.RotateKey(caller, id)
+		if err == nil {
+			m.logger.Info("api key rotated", zap.String("tenant", tenant), zap.String("id", id), zap.String("by", caller.ID))
+			m.writeResult(w, http.StatusOK, apiKeyWithSecret{key.Public(), secret}, nil)
+		} else {
+			m.writeResult(w, 0, nil, err)
+		}
+	case sub != "":
+		http.Error(w, "not found", http.StatusNotFound)
+	case r.Method == http.MethodGet:
+		key, err := keys.Get(tenant, id)
+		if err == nil {
+			key = key.Public()
+		}
+		m.writeResult(w, http.StatusOK, key, err)
+	case r.Method == http.MethodDelete:
+		key, err := auth.RevokeKey(caller, id)
+		if err == nil {
+			m.logger.Info("api key revoked", zap.String("tenant", tenant), zap.String("id", id), zap.String("by", caller.ID))
+			key = key.Public()
+		}
+		m.writeResult(w, http.StatusOK, key, err)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+	return nil
+}
+
+// writeResult writes a key manager result as JSON, or the error of a failed
+// call: 404 for keys of other tenants or none, 403 for keys beyond the
+// caller's scope, 400 for rejected input
+func (m *APIKeysModule) writeResult(w http.ResponseWriter, status int, result any, err error) {
+	switch {
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrAPIKeyScope):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		m.logger.Debug("api key request failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+var (
+	_ caddy.Provisioner           = (*APIKeysModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*APIKeysModule)(nil)
+)
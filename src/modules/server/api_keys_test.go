@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+func TestAPIKeysModule_ResidencyScope(t *testing.T) {
+	auth := &modules.KeyAuthModule{Keys: &services.APIKeyManager{Store: services.NewMemoryStateStore()}}
+	services.RegisterAuthService("test-api-keys", auth)
+	m := &APIKeysModule{Auth: "test-api-keys", logger: zap.NewNop()}
+
+	_, euAdmin, err := auth.Keys.Create("acme", "eu admin", services.APIKeyRoleAdmin, []string{"eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrestricted, _, err := auth.Keys.Create("acme", "admin", services.APIKeyRoleAdmin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usMember, _, err := auth.Keys.Create("acme", "us", "", []string{"us"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	euMember, _, err := auth.Keys.Create("acme", "eu", "", []string{"eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"rotate an unrestricted key", http.MethodPost, "/v1/api_keys/" + unrestricted.ID + "/rotate", http.StatusForbidden},
+		{"rotate a key of another region", http.MethodPost, "/v1/api_keys/" + usMember.ID + "/rotate", http.StatusForbidden},
+		{"revoke an unrestricted key", http.MethodDelete, "/v1/api_keys/" + unrestricted.ID, http.StatusForbidden},
+		{"revoke a key of another region", http.MethodDelete, "/v1/api_keys/" + usMember.ID, http.StatusForbidden},
+		{"rotate a key of the caller's region", http.MethodPost, "/v1/api_keys/" + euMember.ID + "/rotate", http.StatusOK},
+		{"revoke a key of the caller's region", http.MethodDelete, "/v1/api_keys/" + euMember.ID, http.StatusOK},
+		{"rotate an unknown key", http.MethodPost, "/v1/api_keys/key_unknown/rotate", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+euAdmin)
+			rec := httptest.NewRecorder()
+			if err := m.ServeHTTP(rec, req, caddyhttp.HandlerFunc(func(http.ResponseWriter, *http.Request) error { return nil })); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	for _, key := range []*services.APIKey{unrestricted, usMember} {
+		stored, err := auth.Keys.Get("acme", key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Revoked() || stored.SecretHash != key.SecretHash {
+			t.Errorf("expected key %s left unchanged", key.Name)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Defaults of a bare `backpressure` option
+const (
+	defaultBackpressureBuffer = 256 * 1024
+	backpressureCoalesce      = "coalesce"
+	backpressureAbort         = "abort"
+)
+
+// errSlowClient fails streams whose client fell too far behind
+var errSlowClient = errors.New("client too slow, stream aborted")
+
+// BackpressureConfig keeps slow clients from holding upstream streams: chunks
+// are queued for the client while the upstream is read at its own pace, and
+// once the queue is full the overflow policy applies
+type BackpressureConfig struct {
+	// Buffer is how many bytes may be queued for a client (default: 256KiB)
+	Buffer int `json:"buffer,omitempty"`
+	// OnOverflow is "coalesce" (default), which merges text deltas queued
+	// beyond the buffer so the upstream can finish, or "abort", which ends
+	// the upstream stream
+	OnOverflow string `json:"on_overflow,omitempty"`
+}
+
+// clientQueue writes the chunks of a stream to its client from a goroutine
+// of its own, so a blocked write doesn't stop reading from the upstream.
+// Without backpressure handling it writes them synchronously.
+type clientQueue struct {
+	async    bool
+	limit    int
+	coalesce bool
+	write    func(...styles.PartialJSON) error
+	logger   *zap.Logger
+
+	mu         sync.Mutex
+	items      []queuedChunk
+	bytes      int
+	closed     bool
+	err        error
+	overflowed bool
+	wake       chan struct{}
+	done       chan struct{}
+}
+
+// queuedChunk is a chunk waiting for the client, with its approximate size
+type queuedChunk struct {
+	chunk styles.PartialJSON
+	size  int
+}
+
+// newClientQueue starts the queue of a stream; with a nil config it writes
+// synchronously
+func newClientQueue(c *BackpressureConfig, logger *zap.Logger, write func(...styles.PartialJSON) error) *clientQueue {
+	if c == nil {
+		return &clientQueue{write: write}
+	}
+	q := &clientQueue{
+		async:    true,
+		limit:    c.Buffer,
+		coalesce: c.OnOverflow != backpressureAbort,
+		write:    write,
+		logger:   logger,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if q.limit <= 0 {
+		q.limit = defaultBackpressureBuffer
+	}
+	go q.run()
+	return q
+}
+
+// push queues chunks for the client. It fails with the error of an earlier
+// write, or with errSlowClient once the queue is full under the abort
+// policy.
+func (q *clientQueue) push(chunks ...styles.PartialJSON) error {
+	if !q.async {
+		return q.write(chunks...)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		return q.err
+	}
+	for _, chunk := range chunks {
+		if chunk == nil {
+			continue
+		}
+		size := chunkSize(chunk)
+		if q.bytes+size > q.limit {
+			if !q.coalesce {
+				return errSlowClient
+			}
+			if !q.overflowed {
+				q.overflowed = true
+				q.logger.Warn("slow client, merging queued text deltas", zap.Int("queued_bytes", q.bytes))
+			}
+			if q.merge(chunk) {
+				continue
+			}
+		}
+		q.items = append(q.items, queuedChunk{chunk: chunk, size: size})
+		q.bytes += size
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// merge appends the text of a text delta chunk to the last queued chunk
+// when it is one too
+func (q *clientQueue) merge(chunk styles.PartialJSON) bool {
+	if len(q.items) == 0 {
+		return false
+	}
+	last := &q.items[len(q.items)-1]
+	text, ok := textDelta(chunk)
+	if !ok {
+		return false
+	}
+	lastText, ok := textDelta(last.chunk)
+	if !ok {
+		return false
+	}
+	last.chunk = withTextDelta(last.chunk, lastText+text)
+	last.size += len(text)
+	q.bytes += len(text)
+	return true
+}
+
+// run writes queued chunks until the queue is closed and empty, or a write
+// fails
+func (q *clientQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.items) == 0 && !q.closed {
+			q.mu.Unlock()
+			<-q.wake
+			q.mu.Lock()
+		}
+		if len(q.items) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		item := q.items[0]
+		q.items = q.items[1:]
+		q.bytes -= item.size
+		q.mu.Unlock()
+
+		if err := q.write(item.chunk); err != nil {
+			q.mu.Lock()
+			q.err = err
+			q.items, q.bytes = nil, 0
+			q.mu.Unlock()
+			return
+		}
+	}
+}
+
+// wait closes the queue and waits until the client has been written every
+// queued chunk, returning the error of a failed write. Writes bypassing the
+// queue, like the end of the stream, come after it.
+func (q *clientQueue) wait() error {
+	if !q.async {
+		return nil
+	}
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	<-q.done
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+// chunkSize approximates the size of a chunk's SSE event
+func chunkSize(chunk styles.PartialJSON) int {
+	size := 8
+	for key, value := range chunk {
+		size += len(key) + len(value) + 4
+	}
+	return size
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// blockedClient is a client write that blocks until released, recording
+// what it was written
+type blockedClient struct {
+	started chan struct{}
+	release chan struct{}
+	err     error
+
+	mu      sync.Mutex
+	written []styles.PartialJSON
+}
+
+func newBlockedClient() *blockedClient {
+	return &blockedClient{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (c *blockedClient) write(chunks ...styles.PartialJSON) error {
+	select {
+	case c.started <- struct{}{}:
+	default:
+	}
+	<-c.release
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, chunks...)
+	return c.err
+}
+
+// pushNow pushes a chunk, failing the test if the reader would block
+func pushNow(t *testing.T, q *clientQueue, chunk styles.PartialJSON) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- q.push(chunk) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("push blocked on the slow client")
+		return nil
+	}
+}
+
+func TestClientQueue_AbortsAtDepth(t *testing.T) {
+	client := newBlockedClient()
+	depth := 3 * chunkSize(contentDelta(t, "x"))
+	q := newClientQueue(&BackpressureConfig{Buffer: depth, OnOverflow: backpressureAbort}, zap.NewNop(), client.write)
+
+	// The first chunk is being written; three more fill the queue
+	if err := pushNow(t, q, contentDelta(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	<-client.started
+	for _, text := range []string{"b", "c", "d"} {
+		if err := pushNow(t, q, contentDelta(t, text)); err != nil {
+			t.Fatalf("expected %q to be queued, got %v", text, err)
+		}
+	}
+	if err := pushNow(t, q, contentDelta(t, "e")); !errors.Is(err, errSlowClient) {
+		t.Fatalf("expected the stream aborted beyond the queue depth, got %v", err)
+	}
+
+	close(client.release)
+	if err := q.wait(); err != nil {
+		t.Fatalf("wait returned error: %v", err)
+	}
+	var got strings.Builder
+	for _, chunk := range client.written {
+		got.WriteString(chunkContent(t, chunk))
+	}
+	if got.String() != "abcd" {
+		t.Errorf("expected the queued chunks written in order, got %q", got.String())
+	}
+}
+
+func TestClientQueue_CoalescesBeyondDepth(t *testing.T) {
+	client := newBlockedClient()
+	depth := 2 * chunkSize(contentDelta(t, "x"))
+	q := newClientQueue(&BackpressureConfig{Buffer: depth}, zap.NewNop(), client.write)
+
+	if err := pushNow(t, q, contentDelta(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	<-client.started
+	for _, text := range []string{"b", "c", "d", "e", "f"} {
+		if err := pushNow(t, q, contentDelta(t, text)); err != nil {
+			t.Fatalf("expected %q to be accepted, got %v", text, err)
+		}
+	}
+	finish := deltaChunk(t, `{"choices": [{"index": 0, "delta": {}, "finish_reason": "stop"}]}`)
+	if err := pushNow(t, q, finish); err != nil {
+		t.Fatal(err)
+	}
+
+	close(client.release)
+	if err := q.wait(); err != nil {
+		t.Fatalf("wait returned error: %v", err)
+	}
+	// a, b, then c to f merged into the last queued delta, then the finish
+	if len(client.written) != 4 {
+		t.Fatalf("expected the overflow merged into 4 writes, got %d", len(client.written))
+	}
+	var got strings.Builder
+	for _, chunk := range client.written[:3] {
+		got.WriteString(chunkContent(t, chunk))
+	}
+	if got.String() != "abcdef" {
+		t.Errorf("expected every delta written in order, got %q", got.String())
+	}
+	if string(client.written[3]["choices"]) != string(finish["choices"]) {
+		t.Errorf("expected the finish chunk last, got %s", client.written[3]["choices"])
+	}
+}
+
+func TestClientQueue_WriteError(t *testing.T) {
+	client := newBlockedClient()
+	client.err = errors.New("broken pipe")
+	q := newClientQueue(&BackpressureConfig{}, zap.NewNop(), client.write)
+
+	if err := pushNow(t, q, contentDelta(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	close(client.release)
+	if err := q.wait(); !errors.Is(err, client.err) {
+		t.Errorf("expected the write error from wait, got %v", err)
+	}
+	if err := q.push(contentDelta(t, "b")); !errors.Is(err, client.err) {
+		t.Errorf("expected later pushes to fail with the write error, got %v", err)
+	}
+
+	// Without backpressure, writes happen in push
+	q = newClientQueue(nil, zap.NewNop(), func(...styles.PartialJSON) error { return client.err })
+	if err := q.push(contentDelta(t, "a")); !errors.Is(err, client.err) {
+		t.Errorf("expected a synchronous write error, got %v", err)
+	}
+	if err := q.wait(); err != nil {
+		t.Errorf("expected nothing left to wait for, got %v", err)
+	}
+}
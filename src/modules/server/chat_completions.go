@@ -2,31 +2,52 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
-	"github.com/google/uuid"
 	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/drivers/anthropic"
+	"github.com/neutrome-labs/open-ai-router/src/drivers/gemini"
+	"github.com/neutrome-labs/open-ai-router/src/drivers/mock"
 	"github.com/neutrome-labs/open-ai-router/src/drivers/openai"
 	"github.com/neutrome-labs/open-ai-router/src/drivers/virtual"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
 	"github.com/neutrome-labs/open-ai-router/src/modules"
 	"github.com/neutrome-labs/open-ai-router/src/plugin"
 	"github.com/neutrome-labs/open-ai-router/src/plugins"
 	"github.com/neutrome-labs/open-ai-router/src/services"
 	"github.com/neutrome-labs/open-ai-router/src/sse"
 	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"github.com/neutrome-labs/open-ai-router/src/tools"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
+// WarningHeader reports the parts of a request the router removed because
+// the provider serving it doesn't support them, one value per change
+const WarningHeader = "X-Router-Warning"
+
 // ChatCompletionsModule handles OpenAI-style chat completions requests.
 // V3 upgrade: Supports passthrough when input/output styles match, minimizes serialization.
 type ChatCompletionsModule struct {
-	RouterName string `json:"router,omitempty"`
-	logger     *zap.Logger
+	RouterName   string              `json:"router,omitempty"`
+	Coalesce     *CoalesceConfig     `json:"coalesce,omitempty"`     // Merges tiny text deltas of streams (default: off)
+	Backpressure *BackpressureConfig `json:"backpressure,omitempty"` // Queues streams for slow clients instead of blocking upstreams (default: off)
+	BrokenPipes  string              `json:"broken_pipes,omitempty"` // Level logging clients going away mid-stream: debug (default), info, warn, error or off
+	logger       *zap.Logger
+
+	// brokenPipeLevel is BrokenPipes parsed; nil when off
+	brokenPipeLevel *zapcore.Level
 }
 
 func ParseChatCompletionsModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
@@ -39,6 +60,50 @@ func ParseChatCompletionsModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHan
 					return nil, h.ArgErr()
 				}
 				m.RouterName = h.Val()
+			case "coalesce":
+				// coalesce [<interval>] [<bytes>]
+				args := h.RemainingArgs()
+				if len(args) > 2 {
+					return nil, h.ArgErr()
+				}
+				m.Coalesce = &CoalesceConfig{}
+				if len(args) > 0 {
+					interval, err := caddy.ParseDuration(args[0])
+					if err != nil {
+						return nil, h.Errf("invalid coalesce interval '%s': %v", args[0], err)
+					}
+					m.Coalesce.Interval = caddy.Duration(interval)
+				}
+				if len(args) > 1 {
+					bytes, err := strconv.Atoi(args[1])
+					if err != nil || bytes <= 0 {
+						return nil, h.Errf("invalid coalesce bytes '%s'", args[1])
+					}
+					m.Coalesce.Bytes = bytes
+				}
+			case "backpressure":
+				// backpressure [<buffer_bytes>] [coalesce|abort]
+				args := h.RemainingArgs()
+				if len(args) > 2 {
+					return nil, h.ArgErr()
+				}
+				m.Backpressure = &BackpressureConfig{}
+				for _, arg := range args {
+					if arg == backpressureCoalesce || arg == backpressureAbort {
+						m.Backpressure.OnOverflow = arg
+						continue
+					}
+					buffer, err := strconv.Atoi(arg)
+					if err != nil || buffer <= 0 {
+						return nil, h.Errf("invalid backpressure option '%s'", arg)
+					}
+					m.Backpressure.Buffer = buffer
+				}
+			case "broken_pipes":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.BrokenPipes = h.Val()
 			default:
 				return nil, h.Errf("unrecognized ai_openai_chat_completions option '%s'", h.Val())
 			}
@@ -63,7 +128,29 @@ func (m *ChatCompletionsModule) Provision(ctx caddy.Context) error {
 	styles.Logger = m.logger.Named("styles")
 	openai.Logger = m.logger.Named("openai")
 	virtual.Logger = m.logger.Named("virtual")
+	mock.Logger = m.logger.Named("mock")
+	gemini.Logger = m.logger.Named("gemini")
+	anthropic.Logger = m.logger.Named("anthropic")
+	tools.Logger = m.logger.Named("tools")
+
+	switch m.BrokenPipes {
+	case "off":
+	case "":
+		level := zapcore.DebugLevel
+		m.brokenPipeLevel = &level
+	default:
+		level, err := zapcore.ParseLevel(m.BrokenPipes)
+		if err != nil || level > zapcore.ErrorLevel {
+			return fmt.Errorf("broken_pipes must be debug, info, warn, error or off, got '%s'", m.BrokenPipes)
+		}
+		m.brokenPipeLevel = &level
+	}
 
+	if reg := ctx.GetMetricsRegistry(); reg != nil {
+		if err := services.RegisterStreamGauges(reg); err != nil {
+			m.logger.Warn("stream gauges not exposed as metrics", zap.Error(err))
+		}
+	}
 	return nil
 }
 
@@ -74,20 +161,26 @@ func (m *ChatCompletionsModule) serveChatCompletions(
 	reqJson styles.PartialJSON,
 	w http.ResponseWriter,
 	r *http.Request,
+	outcome *plugin.AttemptOutcome,
 ) error {
 	inputStyle := styles.StyleChatCompletions
 	outputStyle := p.Impl.Style
 
 	// Convert request format (passthrough if same style)
 	converter := &services.DefaultConverter{}
+	start := time.Now()
 	providerReq, err := converter.ConvertRequest(reqJson, inputStyle, outputStyle)
 	if err != nil {
 		m.logger.Error("Failed to convert request format", zap.Error(err))
 		http.Error(w, "Format conversion error", http.StatusInternalServerError)
 		return nil
 	}
+	if err := p.Impl.Router.CheckStage(services.StageConversion, "request", time.Since(start), nil); err != nil {
+		return err
+	}
 
 	res, resJson, err := cmd.DoInference(&p.Impl, providerReq, r)
+	outcome.Res = res
 	if err != nil {
 		m.logger.Error("inference error", zap.String("provider", p.Name), zap.Error(err))
 		// Run error plugins to notify about the failure
@@ -97,20 +190,27 @@ func (m *ChatCompletionsModule) serveChatCompletions(
 
 	// Convert response back to input style (passthrough if same style)
 	if resJson != nil {
+		start := time.Now()
 		resJson, err = converter.ConvertResponse(resJson, outputStyle, inputStyle)
 		if err != nil {
 			m.logger.Error("Failed to convert response format", zap.Error(err))
 		}
+		if err := p.Impl.Router.CheckStage(services.StageConversion, "response", time.Since(start), nil); err != nil {
+			return err
+		}
 	}
+	recordUsage(m.logger, p.Impl.Router, r, p.Name, styles.TryGetFromPartialJSON[string](reqJson, "model"), responseUsage(resJson))
 
 	// Run after plugins
 	resJson, err = chain.RunAfter(&p.Impl, r, reqJson, res, resJson)
 	if err != nil {
 		m.logger.Error("plugin after hook error", zap.Error(err))
 		http.Error(w, "Plugin error", http.StatusInternalServerError)
+		outcome.Err = err
 		return nil
 	}
 
+	outcome.Response = resJson
 	resData, err := resJson.Marshal()
 	if err != nil {
 		m.logger.Error("Failed to serialize response JSON", zap.Error(err))
@@ -118,6 +218,7 @@ func (m *ChatCompletionsModule) serveChatCompletions(
 		return nil
 	}
 
+	p.Impl.Router.Headers.Copy(w.Header(), res)
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(resData)
 	return err
@@ -130,42 +231,143 @@ func (m *ChatCompletionsModule) serveChatCompletionsStream(
 	reqJson styles.PartialJSON,
 	w http.ResponseWriter,
 	r *http.Request,
+	outcome *plugin.AttemptOutcome,
 ) error {
-	sseWriter := sse.NewWriter(w)
-
-	if err := sseWriter.WriteHeartbeat("ok"); err != nil {
-		return err
-	}
-
 	inputStyle := styles.StyleChatCompletions
 	outputStyle := p.Impl.Style
 
 	// Convert request format (passthrough if same style)
 	converter := &services.DefaultConverter{}
+	start := time.Now()
 	providerReq, err := converter.ConvertRequest(reqJson, inputStyle, outputStyle)
 	if err != nil {
 		m.logger.Error("Failed to convert request format", zap.Error(err))
+		sseWriter := sse.NewWriter(w)
 		_ = sseWriter.WriteError("Format conversion error")
 		_ = sseWriter.WriteDone()
 		return nil
 	}
+	if err := p.Impl.Router.CheckStage(services.StageConversion, "request", time.Since(start), nil); err != nil {
+		return err
+	}
 
 	hres, stream, err := cmd.DoInferenceStream(&p.Impl, providerReq, r)
+	outcome.Res = hres
 	if err != nil {
 		m.logger.Error("inference stream error (start)", zap.String("provider", p.Name), zap.Error(err))
 		// Run error plugins to notify about the failure
 		_ = chain.RunError(&p.Impl, r, reqJson, hres, err)
-		_ = sseWriter.WriteError("start failed")
-		_ = sseWriter.WriteDone()
+		// Nothing was written yet: the caller may fall back or report the error
+		return err
+	}
+
+	// Headers are sent with the first write, once the upstream has answered
+	sseWriter := sse.NewWriter(w)
+	defer services.TrackSSEWriter()()
+	p.Impl.Router.Headers.Copy(w.Header(), hres)
+	if err := sseWriter.WriteHeartbeat("ok"); err != nil {
+		drivers.AbandonStream(hres, stream)
 		return err
 	}
 
+	// Usage is recorded however the stream ends: as the upstream reports
+	// it, or else estimated from the prompt and deltas
+	metered := p.Impl.Router.Quotas != nil || p.Impl.Router.Usage != nil
+	var usage styles.ChatCompletionsUsage
+	estimatedTokens := 0
+	if metered {
+		defer func() {
+			if usage.PromptTokens+usage.CompletionTokens+usage.TotalTokens == 0 && estimatedTokens > 0 {
+				usage.PromptTokens = services.EstimateTokens(string(reqJson["messages"]))
+				usage.CompletionTokens = estimatedTokens
+			}
+			recordUsage(m.logger, p.Impl.Router, r, p.Name, styles.TryGetFromPartialJSON[string](reqJson, "model"), usage)
+		}()
+	}
+
 	var lastChunk styles.PartialJSON
+	limitTokens, _ := r.Context().Value(outputLimitKey{}).(int)
+	limiter := newOutputLimiter(limitTokens, styles.TryGetFromPartialJSON[int](reqJson, "n"))
+	unfinished := newOpenChoices()
+	backpressure := m.Backpressure
+	if rate, _ := r.Context().Value(streamRateKey{}).(float64); rate > 0 {
+		sseWriter.SetPace(r.Context(), rate)
+		// Paced streams are held back on purpose
+		backpressure = nil
+	}
+
+	timeout, _ := r.Context().Value(requestTimeoutKey{}).(time.Duration)
+	toolCalls := styles.NewToolCallDeltaNormalizer()
+	jsonCheck := newJSONStreamCheck(reqJson)
+	content := newStreamContent(r)
+	coalesce := newCoalescer(m.Coalesce)
+	out := newClientQueue(backpressure, m.logger, func(chunks ...styles.PartialJSON) error {
+		return m.writeStreamChunks(sseWriter, chunks...)
+	})
+	var accum *services.StreamAccumulator
+	if p.Impl.Router.Partials != nil || chain.FollowsAttempts() {
+		accum = services.NewStreamAccumulator()
+		defer func() { outcome.Response = streamedResponse(accum, lastChunk) }()
+	}
+
+streamLoop:
+	for {
+		var chunk drivers.InferenceStreamChunk
+		select {
+		case c, ok := <-stream:
+			if !ok {
+				break streamLoop
+			}
+			chunk = c
+		case <-r.Context().Done():
+			chunk.RuntimeError = r.Context().Err()
+		case <-coalesce.due():
+			if err := out.push(coalesce.flush()); err != nil && r.Context().Err() == nil {
+				_ = out.wait()
+				m.streamWriteFailed(p, chain, reqJson, r, hres, stream, accum, outcome, err)
+				return nil
+			}
+			continue
+		}
+
+		// Deadline exceeded: close the stream cleanly with what was generated so far
+		if chunk.RuntimeError != nil && timeout > 0 && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			m.logger.Warn("request deadline exceeded mid-stream, returning partial result",
+				zap.String("provider", p.Name),
+				zap.Duration("timeout", timeout))
+			drivers.AbandonStream(hres, stream)
+			_ = out.push(coalesce.flush())
+			_ = out.wait()
+			final := timeoutChunk(lastChunk, timeout, unfinished.list())
+			if data, err := final.Marshal(); err == nil {
+				_ = sseWriter.WriteRaw(data)
+			}
+			lastChunk = final
+			break streamLoop
+		}
+
+		// The client went away: nobody is left to tell about the error, but
+		// plugins still learn how the stream ended
+		if chunk.RuntimeError != nil && errors.Is(r.Context().Err(), context.Canceled) {
+			_ = out.wait()
+			m.streamWriteFailed(p, chain, reqJson, r, hres, stream, accum, outcome, chunk.RuntimeError)
+			return nil
+		}
 
-	for chunk := range stream {
 		if chunk.RuntimeError != nil {
-			_ = sseWriter.WriteError(chunk.RuntimeError.Error())
+			if r.Context().Err() != nil {
+				drivers.AbandonStream(hres, stream)
+			}
+			_ = out.push(coalesce.flush())
+			_ = out.wait()
+			// A resume token lets the client continue instead of starting over
+			if token := content.token(p.Impl.Router, r); token != "" {
+				_ = sseWriter.WriteData(map[string]string{"error": chunk.RuntimeError.Error(), services.ResumeTokenField: token})
+			} else {
+				_ = sseWriter.WriteError(chunk.RuntimeError.Error())
+			}
 			// Run error plugins for runtime stream errors
+			outcome.Err = chunk.RuntimeError
 			_ = chain.RunError(&p.Impl, r, reqJson, hres, chunk.RuntimeError)
 			return nil
 		}
@@ -178,6 +380,19 @@ func (m *ChatCompletionsModule) serveChatCompletionsStream(
 			if err == nil {
 				chunkJson = converted
 			}
+			// Tool call deltas in OpenAI's form, whatever the upstream's quirks
+			if normalized, err := toolCalls.Normalize(chunkJson); err == nil {
+				chunkJson = normalized
+			} else {
+				m.logger.Warn("unreadable tool call deltas", zap.String("provider", p.Name), zap.Error(err))
+			}
+			if metered {
+				if u := responseUsage(chunkJson); u.PromptTokens+u.CompletionTokens+u.TotalTokens > 0 {
+					usage = u
+				} else {
+					estimatedTokens += chunkTokens(chunkJson)
+				}
+			}
 		}
 
 		// Run after-chunk plugins
@@ -187,20 +402,74 @@ func (m *ChatCompletionsModule) serveChatCompletionsStream(
 			continue
 		}
 
-		if chunkJson != nil {
-			lastChunk = chunkJson
+		chunkJson, truncated := limiter.apply(chunkJson)
+		retried := false
 
-			chankData, err := chunkJson.Marshal()
+		// Broken JSON output: the rest comes from one non-streaming retry
+		if err := jsonCheck.check(chunkJson); err != nil {
+			m.logger.Warn("streamed JSON output broke, retrying without streaming",
+				zap.String("provider", p.Name), zap.Error(err))
+			drivers.AbandonStream(hres, stream)
+			final, err := m.retryJSON(p, cmd, reqJson, r, jsonCheck, chunkJson)
+			if err == nil {
+				final, err = chain.RunAfterChunk(&p.Impl, r, reqJson, hres, final)
+			}
 			if err != nil {
-				m.logger.Error("chat completions stream chunk marshal error", zap.Error(err))
-				continue
+				m.logger.Error("JSON output retry failed", zap.String("provider", p.Name), zap.Error(err))
+				_ = out.wait()
+				_ = sseWriter.WriteError(err.Error())
+				outcome.Err = err
+				_ = chain.RunError(&p.Impl, r, reqJson, hres, err)
+				return nil
+			}
+			chunkJson, retried = final, true
+		}
+
+		if chunkJson != nil {
+			lastChunk = chunkJson
+			unfinished.add(chunkJson)
+			content.add(chunkJson)
+			if accum != nil {
+				accum.Accumulate(chunkJson)
 			}
 
-			if err := sseWriter.WriteRaw(chankData); err != nil {
-				m.logger.Error("chat completions stream write error", zap.Error(err))
-				return err
+			if err := out.push(coalesce.add(chunkJson)...); err != nil {
+				if errors.Is(err, errSlowClient) {
+					// Rather than holding the upstream for a client that can't keep up
+					m.logger.Warn("client too slow, aborting upstream stream", zap.String("provider", p.Name))
+					drivers.AbandonStream(hres, stream)
+					_ = out.wait()
+					_ = sseWriter.WriteError(err.Error())
+					outcome.Err = err
+					_ = chain.RunError(&p.Impl, r, reqJson, hres, err)
+					return nil
+				}
+				if r.Context().Err() != nil {
+					// Pacing was cut short; the deadline or disconnect is handled at the top of the loop
+					continue
+				}
+				_ = out.wait()
+				m.streamWriteFailed(p, chain, reqJson, r, hres, stream, accum, outcome, err)
+				return nil
 			}
 		}
+
+		if retried {
+			break streamLoop
+		}
+		if truncated {
+			m.logger.Debug("stream truncated at output token limit",
+				zap.String("provider", p.Name),
+				zap.Int("limit", limitTokens))
+			drivers.AbandonStream(hres, stream)
+			break streamLoop
+		}
+	}
+
+	_ = out.push(coalesce.flush())
+	if err := out.wait(); err != nil && r.Context().Err() == nil {
+		m.streamWriteFailed(p, chain, reqJson, r, hres, stream, accum, outcome, err)
+		return nil
 	}
 
 	// Run stream end plugins
@@ -210,6 +479,55 @@ func (m *ChatCompletionsModule) serveChatCompletionsStream(
 	return nil
 }
 
+// streamWriteFailed ends a started stream that can't be written to the
+// client anymore. A client that went away is logged at the broken_pipes
+// level; other failures are the router's, logged as errors. Either way error
+// plugins get an ErrClientWrite, so they release what they hold for the
+// stream, and the attempt fails on the client's side, without a fallback to
+// another provider.
+func (m *ChatCompletionsModule) streamWriteFailed(
+	p *modules.ProviderConfig,
+	chain *plugin.PluginChain,
+	reqJson styles.PartialJSON,
+	r *http.Request,
+	hres *http.Response,
+	stream chan drivers.InferenceStreamChunk,
+	accum *services.StreamAccumulator,
+	outcome *plugin.AttemptOutcome,
+	err error,
+) {
+	drivers.AbandonStream(hres, stream)
+	savePartial(m.logger, p.Impl.Router, r, accum)
+	outcome.Err = errs.Wrap(errs.ErrClientWrite, err)
+	if sse.IsClientGone(err) || r.Context().Err() != nil {
+		if m.brokenPipeLevel != nil {
+			m.logger.Log(*m.brokenPipeLevel, "client went away mid-stream", zap.String("provider", p.Name), zap.Error(err))
+		}
+	} else {
+		m.logger.Error("chat completions stream write error", zap.String("provider", p.Name), zap.Error(err))
+	}
+	_ = chain.RunError(&p.Impl, r, reqJson, hres, outcome.Err)
+}
+
+// writeStreamChunks writes chunks as paced data events; chunks that fail to
+// marshal are skipped
+func (m *ChatCompletionsModule) writeStreamChunks(sseWriter *sse.Writer, chunks ...styles.PartialJSON) error {
+	for _, chunk := range chunks {
+		if chunk == nil {
+			continue
+		}
+		data, err := chunk.Marshal()
+		if err != nil {
+			m.logger.Error("chat completions stream chunk marshal error", zap.Error(err))
+			continue
+		}
+		if err := sseWriter.WritePaced(data, chunkTokens(chunk)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *ChatCompletionsModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
 	m.logger.Debug("Chat completions request received", zap.String("path", r.URL.Path), zap.String("method", r.Method))
 
@@ -240,20 +558,130 @@ func (m *ChatCompletionsModule) ServeHTTP(w http.ResponseWriter, r *http.Request
 		return nil
 	}
 
+	// Recursive plugins re-enter the handler: nested invocations join the
+	// client request's trace and reuse its auth and timeout
+	trace := plugin.StartTrace(r.Context())
+	maxDepth := router.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = plugin.DefaultMaxDepth
+	}
+	if trace.Depth > maxDepth {
+		err := errs.Errorf(errs.ErrLoop, "recursion depth limit of %d exceeded for model %s", maxDepth,
+			styles.TryGetFromPartialJSON[string](reqJson, "model"))
+		m.logger.Error("recursive handler depth exceeded", zap.String("trace_id", trace.ID), zap.Error(err))
+		writeProviderError(w, err)
+		return nil
+	}
+	r = r.WithContext(plugin.WithTrace(r.Context(), trace))
+	if trace.Depth == 0 {
+		w.Header().Set("X-Trace-Id", trace.ID)
+	}
+
 	// Collect incoming auth early so plugins can rely on context values
-	r, err = router.Impl.Auth.CollectIncomingAuth(r)
+	if trace.Depth == 0 {
+		r, err = router.Impl.Auth.CollectIncomingAuth(r)
+		if err != nil {
+			m.logger.Error("failed to collect incoming auth", zap.Error(err))
+			http.Error(w, "authentication error", http.StatusUnauthorized)
+			return nil
+		}
+		r = router.Identity.Apply(r)
+		r = withClientPolicy(router, r)
+		// Decoys are answered before anything could reveal them, e.g. a
+		// policy rejection or a spent budget
+		if honeypot, ok := router.Honeypot(styles.TryGetFromPartialJSON[string](reqJson, "model")); ok {
+			serveHoneypot(m.logger, router, honeypot, w, r, reqJson)
+			return nil
+		}
+		r, reqJson, err = withStreamResume(router, r, reqJson)
+		if err != nil {
+			m.logger.Warn("failed to resume stream", zap.Error(err))
+			writeProviderError(w, err)
+			return nil
+		}
+	}
+	policy := requestPolicy(router, r)
+
+	// Prompts referenced from the library become messages the policy sees
+	reqJson, err = router.Impl.Prompts.Materialize(reqJson)
 	if err != nil {
-		m.logger.Error("failed to collect incoming auth", zap.Error(err))
-		http.Error(w, "authentication error", http.StatusUnauthorized)
+		m.logger.Warn("failed to materialize prompt", zap.Error(err))
+		writeProviderError(w, err)
 		return nil
 	}
 
-	chain := plugin.TryResolvePlugins(*r.URL, styles.TryGetFromPartialJSON[string](reqJson, "model"))
-
-	m.logger.Debug("Resolved plugins", zap.Int("plugin_count", len(chain.GetPlugins())))
+	// Policy stage: enforced before any plugin or provider sees the request
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	if err := policy.Apply(keyID, reqJson); err != nil {
+		m.logger.Warn("request rejected by policy", zap.String("key_id", keyID), zap.Error(err))
+		status := http.StatusForbidden
+		var perr *services.PolicyError
+		if errors.As(err, &perr) {
+			status = perr.Status
+		}
+		http.Error(w, err.Error(), status)
+		return nil
+	}
+	if trace.Depth == 0 {
+		r, err = withResidency(router, r, keyID, reqJson)
+		if err != nil {
+			writeProviderError(w, err)
+			return nil
+		}
+		tenant, ok := r.Context().Value(plugin.ContextTenantID()).(string)
+		if !ok {
+			tenant, _, _ = strings.Cut(keyID, ":")
+		}
+		allowed, wait, err := router.Impl.RateLimits.Take(tenant, keyID, time.Now())
+		if err != nil {
+			// A failing state store must not take the router down with it
+			m.logger.Error("rate limit state store error", zap.Error(err))
+		} else if !allowed {
+			m.logger.Debug("request rate limited", zap.String("key_id", keyID), zap.String("tenant", tenant), zap.Duration("retry_after", wait))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return nil
+		}
+		if !takeClientRateLimits(m.logger, router, policy, w, keyID, reqJson) {
+			return nil
+		}
+		if !takeQuota(m.logger, router.Impl.Quotas, w, tenant, keyID, reqJson) {
+			return nil
+		}
+	}
+	if timeout := time.Duration(router.RequestTimeout); timeout > 0 && trace.Depth == 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(context.WithValue(ctx, requestTimeoutKey{}, timeout))
+	}
+	if limit := policy.OutputTokenLimit(keyID, reqJson); limit > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), outputLimitKey{}, limit))
+	}
+	if rate := policy.StreamRate(keyID, reqJson); rate > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), streamRateKey{}, rate))
+	}
+	if level, err := safetyLevel(router, keyID, reqJson, r); err != nil {
+		writeProviderError(w, err)
+		return nil
+	} else if level != "" {
+		r = r.WithContext(context.WithValue(r.Context(), safetyLevelKey{}, level))
+	}
 
-	traceId := uuid.New().String()
-	r = r.WithContext(context.WithValue(r.Context(), plugin.ContextTraceID(), traceId))
+	chain := plugin.TryResolvePlugins(*r.URL, styles.TryGetFromPartialJSON[string](reqJson, "model"))
+	m.addWebSearchFallback(router, chain, reqJson)
+
+	m.logger.Debug("Resolved plugins",
+		zap.Int("plugin_count", len(chain.GetPlugins())),
+		zap.String("trace_id", trace.ID),
+		zap.Int("depth", trace.Depth))
+
+	// A sample of client requests is replayed against the reference model
+	// once answered; nested invocations, the replays among them, never are
+	var tee *referenceTee
+	if trace.Depth == 0 && router.Impl.Compare.Sample(reqJson) {
+		tee = &referenceTee{ResponseWriter: w}
+		w = tee
+	}
 
 	// Create invoker for recursive handler plugins
 	invoker := plugin.NewCaddyModuleInvoker(m)
@@ -262,8 +690,10 @@ func (m *ChatCompletionsModule) ServeHTTP(w http.ResponseWriter, r *http.Request
 	handled, err := chain.RunRecursiveHandlers(invoker, reqJson, w, r)
 	if handled {
 		if err != nil {
-			m.logger.Error("recursive handler plugin failed", zap.Error(err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			m.logger.Error("recursive handler plugin failed", zap.Error(err), zap.String("error_kind", errs.Kind(err)))
+			writeProviderError(w, err)
+		} else if tee != nil {
+			m.compareWithReference(router, r, reqJson, tee)
 		}
 		return nil
 	}
@@ -271,14 +701,45 @@ func (m *ChatCompletionsModule) ServeHTTP(w http.ResponseWriter, r *http.Request
 	// Normal flow - handle request directly
 	err = m.handleRequest(router, chain, reqJson, w, r)
 	if err != nil {
-		m.logger.Error("request handling failed", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		m.logger.Error("request handling failed", zap.Error(err), zap.String("error_kind", errs.Kind(err)))
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			http.Error(w, "request deadline exceeded", http.StatusGatewayTimeout)
+			return nil
+		}
+		writeProviderError(w, err)
 		return nil
 	}
+	if tee != nil {
+		m.compareWithReference(router, r, reqJson, tee)
+	}
 
 	return nil
 }
 
+// addWebSearchFallback has the tools plugin run the router's web tool for
+// requests asking for web search when the first provider to try doesn't
+// search natively
+func (m *ChatCompletionsModule) addWebSearchFallback(router *modules.RouterModule, chain *plugin.PluginChain, reqJson styles.PartialJSON) {
+	if chain.Has("tools") || !services.HasWebSearch(reqJson) {
+		return
+	}
+	toolLoop, ok := plugin.GetPlugin("tools")
+	if !ok {
+		return
+	}
+	if _, ok := tools.GetTool("web"); !ok {
+		return
+	}
+	providers, model := router.ResolveProvidersOrderAndModel(styles.TryGetFromPartialJSON[string](reqJson, "model"))
+	if len(providers) == 0 {
+		return
+	}
+	if p, ok := router.ProviderConfigs[providers[0]]; ok && !p.Impl.SupportsWebSearch(model) {
+		m.logger.Debug("Falling back to the web tool for web search", zap.String("provider", providers[0]))
+		chain.Add(toolLoop, "web")
+	}
+}
+
 // handleRequest handles a single request to providers (used both directly and by recursive plugins).
 func (m *ChatCompletionsModule) handleRequest(
 	router *modules.RouterModule,
@@ -289,13 +750,32 @@ func (m *ChatCompletionsModule) handleRequest(
 ) error {
 	providers, model := router.ResolveProvidersOrderAndModel(styles.TryGetFromPartialJSON[string](reqJson, "model"))
 
+	providers, err := filterAllowedProviders(router, r, reqJson, providers, model)
+	if err != nil {
+		return err
+	}
+	providers, err = filterResidency(router, r, providers, model)
+	if err != nil {
+		return err
+	}
+
 	m.logger.Debug("Resolved providers",
 		zap.String("model", model),
 		zap.Strings("providers", providers),
 		zap.Int("plugin_count", len(chain.GetPlugins())))
 
+	required := services.RequiredCapabilities(reqJson)
+
 	var displayErr error
+	attempts := 0
 	for _, name := range providers {
+		if err := r.Context().Err(); err != nil {
+			m.logger.Debug("Request context done, not trying further providers", zap.Error(err))
+			if displayErr == nil {
+				displayErr = err
+			}
+			break
+		}
 		m.logger.Debug("Trying provider", zap.String("provider", name))
 
 		p, ok := router.ProviderConfigs[name]
@@ -310,23 +790,91 @@ func (m *ChatCompletionsModule) handleRequest(
 			continue
 		}
 
+		// Skip providers whose model lacks what the request needs before
+		// spending anything on them
+		if err := p.Impl.Capabilities.CheckRequired(model, required); err != nil {
+			m.logger.Debug("Provider lacks a required capability", zap.String("provider", name), zap.Error(err))
+			displayErr = services.MoreRelevantError(displayErr, fmt.Errorf("provider %s: %w", name, err))
+			continue
+		}
+		// Requests for more completions than the model serves at once are
+		// split into several upstream calls
+		if limit := p.Impl.Capabilities.Limit(model, services.LimitMaxN); limit > 0 && styles.WireStyle(p.Impl.Style) == styles.StyleChatCompletions {
+			cmd = drivers.SplitSamples(cmd, limit)
+		}
+
 		providerReq, err := reqJson.CloneWith("model", model)
 		if err != nil {
 			m.logger.Error("failed to clone request JSON with new model", zap.Error(err))
 			continue
 		}
 
+		// Plugins see which attempt this is, e.g. to adapt the request for a
+		// fallback model. The attempt lives in a copy of the request, which
+		// the caller and further attempts don't see.
+		attempts++
+		attemptReq := r.WithContext(plugin.WithAttempt(r.Context(), plugin.Attempt{
+			Number:   attempts,
+			Total:    len(providers),
+			Fallback: attempts > 1,
+		}))
+
 		// Run before plugins with provider context
-		processedReq, err := chain.RunBefore(&p.Impl, r, providerReq)
+		processedReq, err := chain.RunBefore(&p.Impl, attemptReq, providerReq)
 		if err != nil {
 			m.logger.Error("plugin before hook error", zap.String("provider", name), zap.Error(err))
-			if displayErr == nil {
-				displayErr = err
-			}
+			displayErr = services.MoreRelevantError(displayErr, err)
 			continue
 		}
 		providerReq = processedReq
 
+		// Reasoning settings in the form the provider understands
+		providerReq, err = styles.MapThinking(providerReq, p.Impl.NativeThinking)
+		if err != nil {
+			displayErr = services.MoreRelevantError(displayErr, errs.Wrap(errs.ErrInvalidRequest, err))
+			break
+		}
+		providerReq, err = p.Impl.Quirks.Apply(providerReq)
+		if err != nil {
+			displayErr = services.MoreRelevantError(displayErr, errs.Wrap(errs.ErrInvalidRequest, err))
+			break
+		}
+		if level, _ := attemptReq.Context().Value(safetyLevelKey{}).(string); level != "" {
+			providerReq, err = p.Impl.ApplySafety(providerReq, level, safetyCaller(attemptReq))
+			if err != nil {
+				displayErr = services.MoreRelevantError(displayErr, errs.Wrap(errs.ErrInvalidRequest, err))
+				break
+			}
+		}
+		providerReq = p.Impl.Capabilities.MapTokenLimit(providerReq)
+		providerReq, err = p.Impl.Capabilities.MapRoles(providerReq)
+		if err != nil {
+			displayErr = services.MoreRelevantError(displayErr, errs.Wrap(errs.ErrInvalidRequest, err))
+			break
+		}
+		w.Header().Del(WarningHeader)
+		var droppedIncludes []string
+		providerReq, droppedIncludes, err = p.Impl.FilterIncludes(providerReq)
+		if err != nil {
+			displayErr = services.MoreRelevantError(displayErr, errs.Wrap(errs.ErrInvalidRequest, err))
+			break
+		}
+		if len(droppedIncludes) > 0 {
+			m.logger.Warn("provider does not support include values; removed them",
+				zap.String("provider", name), zap.Strings("include", droppedIncludes))
+			w.Header().Add(WarningHeader, "unsupported include removed: "+strings.Join(droppedIncludes, ", "))
+		}
+		var droppedSearch bool
+		providerReq, droppedSearch, err = p.Impl.TranslateWebSearch(providerReq)
+		if err != nil {
+			displayErr = services.MoreRelevantError(displayErr, errs.Wrap(errs.ErrInvalidRequest, err))
+			break
+		}
+		if droppedSearch {
+			m.logger.Warn("provider does not search the web; removed the search tool", zap.String("provider", name))
+			w.Header().Add(WarningHeader, "unsupported web search removed")
+		}
+
 		m.logger.Debug("Executing inference",
 			zap.String("provider", name),
 			zap.String("style", string(p.Impl.Style)),
@@ -335,6 +883,7 @@ func (m *ChatCompletionsModule) handleRequest(
 		// Success - set response headers
 		w.Header().Set("X-Real-Provider-Id", name)
 		w.Header().Set("X-Real-Model-Id", model)
+		p.Impl.ApplyResponseHeaders(w.Header(), attemptReq)
 
 		// Build plugin list for header
 		var pluginNames []string
@@ -347,15 +896,34 @@ func (m *ChatCompletionsModule) handleRequest(
 		}
 		w.Header().Set("X-Plugins-Executed", strings.Join(pluginNames, ","))
 
+		chain.RunAttemptStart(&p.Impl, attemptReq, providerReq)
+		outcome := &plugin.AttemptOutcome{}
+		began := time.Now()
+		done := p.Impl.BeginRequest()
 		if styles.TryGetFromPartialJSON[bool](providerReq, "stream") {
-			err = m.serveChatCompletionsStream(p, cmd, chain, providerReq, w, r)
+			err = m.serveChatCompletionsStream(p, cmd, chain, providerReq, w, attemptReq, outcome)
 		} else {
-			err = m.serveChatCompletions(p, cmd, chain, providerReq, w, r)
+			err = m.serveChatCompletions(p, cmd, chain, providerReq, w, attemptReq, outcome)
+		}
+		done()
+		if outcome.Err == nil {
+			outcome.Err = err
+		}
+		outcome.Duration = time.Since(began)
+		chain.RunAttemptEnd(&p.Impl, attemptReq, providerReq, outcome)
+
+		if err == nil && chain.Has("attribution") {
+			// Trailers reach the client after the body, streamed or not
+			w.Header().Set(http.TrailerPrefix+plugins.AttributionTrailer, plugins.NewAttributionRecord(&p.Impl, attemptReq, providerReq).String())
 		}
 
 		if err != nil {
-			if displayErr == nil {
-				displayErr = err
+			displayErr = services.MoreRelevantError(displayErr, err)
+			if class := services.ClassifyError(err); !class.FailOver() {
+				m.logger.Debug("Provider rejected the request, not trying further providers",
+					zap.String("provider", name),
+					zap.String("error_class", string(class)))
+				break
 			}
 			continue
 		}
@@ -370,6 +938,42 @@ func (m *ChatCompletionsModule) handleRequest(
 	return nil
 }
 
+// streamedResponse assembles the response of a stream from its accumulated
+// chunks, with the usage of the last one
+func streamedResponse(accum *services.StreamAccumulator, lastChunk styles.PartialJSON) styles.PartialJSON {
+	res := styles.PartialJSON{}
+	_ = res.Set("object", "chat.completion")
+	_ = res.Set("model", accum.Model())
+	_ = res.Set("choices", accum.Choices())
+	if usage, ok := lastChunk["usage"]; ok && !isNullJSON(usage) {
+		res["usage"] = usage
+	}
+	return res
+}
+
+// writeProviderError reports a failed request with a status matching the
+// error's class. Upstream JSON error bodies are passed through so clients can
+// read the provider's error object.
+func writeProviderError(w http.ResponseWriter, err error) {
+	var perr *services.PolicyError
+	if errors.As(err, &perr) {
+		http.Error(w, err.Error(), perr.Status)
+		return
+	}
+	class := services.ClassifyError(err)
+	var statusErr *errs.StatusError
+	if !errors.As(err, &statusErr) || !json.Valid([]byte(statusErr.Body)) {
+		http.Error(w, err.Error(), class.Status())
+		return
+	}
+	if retryAfter := statusErr.Header.Get("Retry-After"); retryAfter != "" && class == services.ErrorClassRateLimit {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(class.Status())
+	_, _ = w.Write([]byte(statusErr.Body))
+}
+
 var (
 	_ caddy.Provisioner           = (*ChatCompletionsModule)(nil)
 	_ caddyhttp.MiddlewareHandler = (*ChatCompletionsModule)(nil)
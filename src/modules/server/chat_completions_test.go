@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// streamCommand streams the chunks sent on its channel
+type streamCommand struct {
+	chunks chan drivers.InferenceStreamChunk
+}
+
+func (c *streamCommand) DoInference(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	return nil, nil, errors.New("not supported")
+}
+
+func (c *streamCommand) DoInferenceStream(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, chan drivers.InferenceStreamChunk, error) {
+	return nil, c.chunks, nil
+}
+
+// endRecorder records how streams ended
+type endRecorder struct {
+	mu     sync.Mutex
+	ended  int
+	errors []error
+}
+
+func (e *endRecorder) Name() string { return "end_recorder" }
+
+func (e *endRecorder) StreamEnd(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, lastChunk styles.PartialJSON) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ended++
+	return nil
+}
+
+func (e *endRecorder) OnError(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, providerErr error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errors = append(e.errors, providerErr)
+	return nil
+}
+
+func testProvider() *modules.ProviderConfig {
+	return &modules.ProviderConfig{
+		Name: "test",
+		Impl: services.ProviderService{
+			Name:   "test",
+			Style:  styles.StyleChatCompletions,
+			Router: &services.RouterService{},
+		},
+	}
+}
+
+func textChunk(text string) drivers.InferenceStreamChunk {
+	chunk := styles.PartialJSON{}
+	_ = chunk.Set("object", "chat.completion.chunk")
+	_ = chunk.Set("choices", []map[string]any{{"index": 0, "delta": map[string]any{"content": text}}})
+	return drivers.InferenceStreamChunk{Data: chunk}
+}
+
+func TestServeChatCompletionsStream_ClientGone(t *testing.T) {
+	m := &ChatCompletionsModule{logger: zap.NewNop()}
+	recorder := &endRecorder{}
+	chain := plugin.NewPluginChain()
+	chain.Add(recorder, "")
+	cmd := &streamCommand{chunks: make(chan drivers.InferenceStreamChunk)}
+
+	reqJson := styles.PartialJSON{}
+	_ = reqJson.Set("model", "test")
+	_ = reqJson.Set("stream", true)
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(ctx)
+
+	done := make(chan error, 1)
+	var outcome plugin.AttemptOutcome
+	go func() {
+		done <- m.serveChatCompletionsStream(testProvider(), cmd, chain, reqJson, httptest.NewRecorder(), r, &outcome)
+	}()
+	cmd.chunks <- textChunk("Hello")
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("serveChatCompletionsStream returned error: %v", err)
+	}
+
+	if len(recorder.errors) != 1 || !errors.Is(recorder.errors[0], errs.ErrClientWrite) {
+		t.Errorf("expected error plugins to get a client write error, got %v", recorder.errors)
+	}
+	if recorder.ended != 0 {
+		t.Errorf("expected no stream end for a cancelled stream, got %d", recorder.ended)
+	}
+	if !errors.Is(outcome.Err, errs.ErrClientWrite) {
+		t.Errorf("expected the attempt to fail with a client write error, got %v", outcome.Err)
+	}
+}
+
+// failingCommand fails every request, recording the attempt it was made in
+type failingCommand struct {
+	attempts *[]plugin.Attempt
+}
+
+func (c *failingCommand) DoInference(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	attempt, _ := plugin.AttemptFromContext(r.Context())
+	*c.attempts = append(*c.attempts, attempt)
+	return nil, nil, errs.Errorf(errs.ErrUpstream, "provider down")
+}
+
+func (c *failingCommand) DoInferenceStream(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, chan drivers.InferenceStreamChunk, error) {
+	return nil, nil, errors.New("not supported")
+}
+
+func TestHandleRequest_AttemptContext(t *testing.T) {
+	var attempts []plugin.Attempt
+	router := &modules.RouterModule{
+		ProviderConfigs: map[string]*modules.ProviderConfig{},
+		ProvidersOrder:  []string{"first", "second"},
+		Impl:            services.RouterService{Logger: zap.NewNop()},
+	}
+	for _, name := range router.ProvidersOrder {
+		p := testProvider()
+		p.Name, p.Impl.Name = name, name
+		p.Impl.Commands = map[string]any{"inference": &failingCommand{attempts: &attempts}}
+		router.ProviderConfigs[name] = p
+	}
+	m := &ChatCompletionsModule{logger: zap.NewNop()}
+	reqJson := styles.PartialJSON{}
+	_ = reqJson.Set("model", "test")
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	if err := m.handleRequest(router, plugin.NewPluginChain(), reqJson, httptest.NewRecorder(), r); err == nil {
+		t.Fatal("expected the failing providers to fail the request")
+	}
+	want := []plugin.Attempt{{Number: 1, Total: 2}, {Number: 2, Total: 2, Fallback: true}}
+	if len(attempts) != len(want) || attempts[0] != want[0] || attempts[1] != want[1] {
+		t.Errorf("expected attempts %+v, got %+v", want, attempts)
+	}
+	if attempt, ok := plugin.AttemptFromContext(r.Context()); ok {
+		t.Errorf("expected the caller's request left without an attempt, got %+v", attempt)
+	}
+}
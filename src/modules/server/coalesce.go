@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Defaults of a bare `coalesce` option
+const (
+	defaultCoalesceInterval = 30 * time.Millisecond
+	defaultCoalesceBytes    = 24
+)
+
+// CoalesceConfig merges tiny consecutive text deltas of streams into fewer
+// SSE events, for high-throughput models sending a token per event
+type CoalesceConfig struct {
+	// Interval is the longest a delta is held back (default: 30ms)
+	Interval caddy.Duration `json:"interval,omitempty"`
+	// Bytes flushes merged text once it reaches this size (default: 24)
+	Bytes int `json:"bytes,omitempty"`
+}
+
+// coalescer holds back plain text deltas of a stream and merges them. Chunks
+// carrying anything else (a role, tool calls, a finish reason, usage, several
+// choices) flush the held text and pass through as they are.
+type coalescer struct {
+	interval time.Duration
+	bytes    int
+
+	pending styles.PartialJSON
+	text    strings.Builder
+	timer   *time.Timer
+}
+
+// newCoalescer returns the coalescer of a stream, nil when disabled
+func newCoalescer(c *CoalesceConfig) *coalescer {
+	if c == nil {
+		return nil
+	}
+	co := &coalescer{interval: time.Duration(c.Interval), bytes: c.Bytes}
+	if co.interval <= 0 {
+		co.interval = defaultCoalesceInterval
+	}
+	if co.bytes <= 0 {
+		co.bytes = defaultCoalesceBytes
+	}
+	return co
+}
+
+// add returns the chunks to write now, in order
+func (co *coalescer) add(chunk styles.PartialJSON) []styles.PartialJSON {
+	if co == nil {
+		return []styles.PartialJSON{chunk}
+	}
+	text, ok := textDelta(chunk)
+	if !ok {
+		if held := co.flush(); held != nil {
+			return []styles.PartialJSON{held, chunk}
+		}
+		return []styles.PartialJSON{chunk}
+	}
+	if co.pending == nil {
+		co.pending = chunk
+		co.timer = time.NewTimer(co.interval)
+	}
+	co.text.WriteString(text)
+	if co.text.Len() >= co.bytes {
+		return []styles.PartialJSON{co.flush()}
+	}
+	return nil
+}
+
+// due fires once held text has waited for the interval; nil while nothing is
+// held
+func (co *coalescer) due() <-chan time.Time {
+	if co == nil || co.timer == nil {
+		return nil
+	}
+	return co.timer.C
+}
+
+// flush returns the held text as one chunk, nil when nothing is held
+func (co *coalescer) flush() styles.PartialJSON {
+	if co == nil || co.pending == nil {
+		return nil
+	}
+	co.timer.Stop()
+	merged := withTextDelta(co.pending, co.text.String())
+	co.pending, co.timer = nil, nil
+	co.text.Reset()
+	return merged
+}
+
+// withTextDelta returns a copy of a text delta chunk carrying another text
+func withTextDelta(chunk styles.PartialJSON, text string) styles.PartialJSON {
+	merged := chunk.Clone()
+	_ = merged.Set("choices", []any{map[string]any{
+		"index":         0,
+		"delta":         map[string]string{"content": text},
+		"finish_reason": nil,
+	}})
+	return merged
+}
+
+// textDelta returns the text of a chunk that only carries a text delta of
+// its single choice
+func textDelta(chunk styles.PartialJSON) (string, bool) {
+	if chunk == nil || !isNullJSON(chunk["usage"]) {
+		return "", false
+	}
+	var choices []map[string]json.RawMessage
+	if json.Unmarshal(chunk["choices"], &choices) != nil || len(choices) != 1 {
+		return "", false
+	}
+	var delta map[string]json.RawMessage
+	if json.Unmarshal(choices[0]["delta"], &delta) != nil {
+		return "", false
+	}
+	for key, value := range choices[0] {
+		if key != "index" && key != "delta" && !isNullJSON(value) {
+			return "", false
+		}
+	}
+	if string(choices[0]["index"]) != "0" {
+		return "", false
+	}
+	var text string
+	for key, value := range delta {
+		if key == "content" {
+			if json.Unmarshal(value, &text) != nil {
+				return "", false
+			}
+		} else if !isNullJSON(value) {
+			return "", false
+		}
+	}
+	return text, text != ""
+}
+
+// isNullJSON reports whether a field is absent or null
+func isNullJSON(value json.RawMessage) bool {
+	return len(value) == 0 || string(value) == "null"
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func deltaChunk(t *testing.T, data string) styles.PartialJSON {
+	t.Helper()
+	chunk, err := styles.ParsePartialJSON([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chunk
+}
+
+func contentDelta(t *testing.T, text string) styles.PartialJSON {
+	t.Helper()
+	chunk := styles.PartialJSON{}
+	_ = chunk.Set("id", "c1")
+	_ = chunk.Set("choices", []map[string]any{{"index": 0, "delta": map[string]any{"content": text}}})
+	return chunk
+}
+
+// chunkContent returns the text delta of a written chunk
+func chunkContent(t *testing.T, chunk styles.PartialJSON) string {
+	t.Helper()
+	text, ok := textDelta(chunk)
+	if !ok {
+		t.Fatalf("expected a text delta, got %s", chunk["choices"])
+	}
+	return text
+}
+
+func TestCoalescer_MergesWithinWindow(t *testing.T) {
+	co := newCoalescer(&CoalesceConfig{Interval: caddy.Duration(time.Hour), Bytes: 100})
+	for _, text := range []string{"He", "llo", " wor", "ld"} {
+		if out := co.add(contentDelta(t, text)); out != nil {
+			t.Fatalf("expected %q to be held, got %d chunks", text, len(out))
+		}
+	}
+	if co.due() == nil {
+		t.Fatal("expected a flush to be due while text is held")
+	}
+	merged := co.flush()
+	if got := chunkContent(t, merged); got != "Hello world" {
+		t.Errorf("expected the deltas merged, got %q", got)
+	}
+	if styles.TryGetFromPartialJSON[string](merged, "id") != "c1" {
+		t.Error("expected the merged chunk to keep the first chunk's fields")
+	}
+	if co.flush() != nil || co.due() != nil {
+		t.Error("expected nothing held after a flush")
+	}
+
+	// The size limit flushes without waiting
+	co = newCoalescer(&CoalesceConfig{Interval: caddy.Duration(time.Hour), Bytes: 5})
+	_ = co.add(contentDelta(t, "He"))
+	if out := co.add(contentDelta(t, "llo")); len(out) != 1 || chunkContent(t, out[0]) != "Hello" {
+		t.Errorf("expected the held text flushed at 5 bytes, got %v", out)
+	}
+
+	// So does the interval
+	co = newCoalescer(&CoalesceConfig{Interval: caddy.Duration(10 * time.Millisecond)})
+	_ = co.add(contentDelta(t, "Hi"))
+	select {
+	case <-co.due():
+	case <-time.After(time.Second):
+		t.Fatal("expected the flush to be due after the interval")
+	}
+	if got := chunkContent(t, co.flush()); got != "Hi" {
+		t.Errorf("expected the held text, got %q", got)
+	}
+
+	// Disabled coalescing passes chunks through
+	var disabled *coalescer
+	if out := disabled.add(contentDelta(t, "Hi")); len(out) != 1 || disabled.due() != nil || disabled.flush() != nil {
+		t.Error("expected a nil coalescer to pass chunks through")
+	}
+}
+
+func TestCoalescer_FlushesAndPassesThrough(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk string
+	}{
+		{"finish reason", `{"choices": [{"index": 0, "delta": {}, "finish_reason": "stop"}]}`},
+		{"finish reason with text", `{"choices": [{"index": 0, "delta": {"content": "!"}, "finish_reason": "stop"}]}`},
+		{"usage", `{"choices": [], "usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}}`},
+		{"text with usage", `{"choices": [{"index": 0, "delta": {"content": "!"}}], "usage": {"total_tokens": 5}}`},
+		{"role", `{"choices": [{"index": 0, "delta": {"role": "assistant", "content": ""}}]}`},
+		{"role with text", `{"choices": [{"index": 0, "delta": {"role": "assistant", "content": "Hi"}}]}`},
+		{"tool call", `{"choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "id": "call_1", "function": {"name": "f", "arguments": ""}}]}}]}`},
+		{"text of another choice", `{"choices": [{"index": 1, "delta": {"content": "Hi"}}]}`},
+		{"several choices", `{"choices": [{"index": 0, "delta": {"content": "a"}}, {"index": 1, "delta": {"content": "b"}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			co := newCoalescer(&CoalesceConfig{Interval: caddy.Duration(time.Hour), Bytes: 100})
+			_ = co.add(contentDelta(t, "Hel"))
+			_ = co.add(contentDelta(t, "lo"))
+
+			chunk := deltaChunk(t, tt.chunk)
+			out := co.add(chunk)
+			if len(out) != 2 {
+				t.Fatalf("expected the held text and the chunk, got %d chunks", len(out))
+			}
+			if got := chunkContent(t, out[0]); got != "Hello" {
+				t.Errorf("expected the held text first, got %q", got)
+			}
+			if string(out[1]["choices"]) != string(chunk["choices"]) {
+				t.Errorf("expected the chunk unchanged, got %s", out[1]["choices"])
+			}
+			if co.due() != nil {
+				t.Error("expected nothing held after the chunk")
+			}
+
+			// With nothing held, the chunk passes alone
+			if out := co.add(chunk); len(out) != 1 {
+				t.Errorf("expected the chunk alone, got %d chunks", len(out))
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// referenceCompareTimeout bounds a reference replay when the router has no
+// request_timeout
+const referenceCompareTimeout = 2 * time.Minute
+
+// referenceTee passes a response on to the client while keeping a copy for
+// the comparison with the reference model
+type referenceTee struct {
+	http.ResponseWriter
+	capture services.ResponseCaptureWriter
+}
+
+func (t *referenceTee) Write(b []byte) (int, error) {
+	_, _ = t.capture.Write(b)
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *referenceTee) WriteHeader(status int) {
+	t.capture.WriteHeader(status)
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *referenceTee) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *referenceTee) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// compareWithReference replays a request answered through tee against the
+// router's reference model in the background and records how the answers
+// differ as an ai_reference_comparison event
+func (m *ChatCompletionsModule) compareWithReference(router *modules.RouterModule, r *http.Request, reqJson styles.PartialJSON, tee *referenceTee) {
+	if tee.capture.Status >= http.StatusBadRequest {
+		return
+	}
+	tee.capture.Headers = tee.Header().Clone()
+	production, err := tee.capture.JSON()
+	if err != nil || production == nil {
+		m.logger.Debug("reference comparison skipped: no production response", zap.Error(err))
+		return
+	}
+
+	reference := router.Impl.Compare.Model
+	refJson := reqJson.Clone()
+	delete(refJson, "stream")
+	delete(refJson, "stream_options")
+	if err := refJson.Set("model", reference); err != nil {
+		return
+	}
+	body, err := refJson.Marshal()
+	if err != nil {
+		return
+	}
+
+	ctx := r.Context()
+	props := map[string]any{
+		"model":           styles.TryGetFromPartialJSON[string](reqJson, "model"),
+		"reference_model": reference,
+		"provider":        tee.Header().Get("X-Real-Provider-Id"),
+		"stream":          tee.capture.Streamed(),
+	}
+	if traceID, _ := ctx.Value(plugin.ContextTraceID()).(string); traceID != "" {
+		props["$ai_trace_id"] = traceID
+	}
+	userID, _ := ctx.Value(plugin.ContextUserID()).(string)
+	project := eventProject(&router.Impl, r)
+
+	timeout := time.Duration(router.RequestTimeout)
+	if timeout <= 0 {
+		timeout = referenceCompareTimeout
+	}
+	// The replay outlives the client request; it keeps the request's
+	// values, so it runs nested in its trace with its credentials
+	req := r.Clone(context.WithoutCancel(ctx))
+	req.Method = http.MethodPost
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	go func() {
+		replayCtx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		res, err := plugin.NewCaddyModuleInvoker(m).InvokeHandlerCapture(req.WithContext(replayCtx))
+		if err == nil {
+			var diff *services.ResponseDiff
+			if diff, err = services.CompareResponses(production, res); err == nil {
+				for k, v := range diff.Properties() {
+					props[k] = v
+				}
+			}
+		}
+		if err != nil {
+			m.logger.Debug("reference comparison failed", zap.String("reference_model", reference), zap.Error(err))
+			props["reference_error"] = err.Error()
+		}
+		_ = services.EmitObservabilityEvent(&router.Impl, services.ObservabilityEvent{
+			Name:       "ai_reference_comparison",
+			DistinctID: userID,
+			Project:    project,
+			Properties: props,
+		})
+	}()
+}
+
+// eventProject selects the PostHog project of an event sent outside the
+// plugin chain the way the posthog plugin does for the request's own events
+func eventProject(router *services.RouterService, r *http.Request) string {
+	if project, _ := r.Context().Value(plugin.ContextPosthogProject()).(string); project != "" {
+		return project
+	}
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	if project, ok := services.PosthogProjectForKey(keyID); ok {
+		return project
+	}
+	return router.PosthogProject
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// defaultCORSHeaders are the request headers browser clients of the OpenAI
+// and Anthropic SDKs send, allowed without being configured
+var defaultCORSHeaders = []string{
+	"authorization", "content-type", "accept",
+	"openai-beta", "openai-organization", "openai-project", "x-stainless-*",
+	"x-api-key", "anthropic-version", "anthropic-beta", "anthropic-dangerous-direct-browser-access",
+	"x-safety-level",
+}
+
+// defaultCORSExposeHeaders are the response headers scripts may read by default
+var defaultCORSExposeHeaders = []string{
+	"X-Real-Provider-Id", "X-Real-Model-Id", "X-Plugins-Executed", WarningHeader, "Retry-After",
+	EmbeddingCacheHeader, "X-Critique-Rounds", "X-Consensus-Agreement", "X-Self-Consistency-Confidence",
+	"X-MapReduce-Chunks", "X-Preview-Model", services.QuotaRemainingHeader, services.QuotaResetHeader,
+}
+
+// CORSModule lets browser apps call the router directly: it answers CORS
+// preflight requests itself and adds the CORS headers to the responses of
+// the handlers after it, without buffering them, so streams keep flowing.
+type CORSModule struct {
+	// Origins lists the allowed origins; "*" wildcards are accepted, e.g.
+	// https://*.example.com (default: any origin)
+	Origins []string `json:"origins,omitempty"`
+	// Headers are request headers allowed besides the SDK headers
+	Headers []string `json:"headers,omitempty"`
+	// ExposeHeaders are response headers readable by scripts besides the router's own
+	ExposeHeaders []string `json:"expose_headers,omitempty"`
+	// Credentials allows cookies and HTTP auth on cross-origin requests
+	Credentials bool `json:"credentials,omitempty"`
+	// MaxAge is how long browsers may cache a preflight answer (default: 10m)
+	MaxAge caddy.Duration `json:"max_age,omitempty"`
+}
+
+func ParseCORSModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m CORSModule
+	for h.Next() {
+		// ai_cors [<origin>...]
+		m.Origins = append(m.Origins, h.RemainingArgs()...)
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "origins":
+				m.Origins = append(m.Origins, h.RemainingArgs()...)
+			case "headers":
+				m.Headers = append(m.Headers, h.RemainingArgs()...)
+			case "expose_headers":
+				m.ExposeHeaders = append(m.ExposeHeaders, h.RemainingArgs()...)
+			case "credentials":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.Credentials = true
+			case "max_age":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil || dur < 0 {
+					return nil, h.Errf("invalid max_age '%s'", h.Val())
+				}
+				m.MaxAge = caddy.Duration(dur)
+			default:
+				return nil, h.Errf("unrecognized ai_cors option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*CORSModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_cors",
+		New: func() caddy.Module { return new(CORSModule) },
+	}
+}
+
+func (m *CORSModule) Provision(ctx caddy.Context) error {
+	if m.MaxAge == 0 {
+		m.MaxAge = caddy.Duration(10 * time.Minute)
+	}
+	return nil
+}
+
+func (m *CORSModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	origin := r.Header.Get("Origin")
+	w.Header().Add("Vary", "Origin")
+	if origin == "" || !m.allowsOrigin(origin) {
+		// Not a CORS request, or one the browser will block without our headers
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		return next.ServeHTTP(w, r)
+	}
+
+	if len(m.Origins) == 0 && !m.Credentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		// Credentials can't be combined with "*"
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if m.Credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		if allowed := m.allowedHeaders(r.Header.Get("Access-Control-Request-Headers")); len(allowed) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(allowed, ", "))
+		}
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(time.Duration(m.MaxAge).Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	w.Header().Set("Access-Control-Expose-Headers", strings.Join(append(append([]string{}, defaultCORSExposeHeaders...), m.ExposeHeaders...), ", "))
+	return next.ServeHTTP(w, r)
+}
+
+// allowsOrigin reports whether an origin may call the router
+func (m *CORSModule) allowsOrigin(origin string) bool {
+	if len(m.Origins) == 0 {
+		return true
+	}
+	for _, pattern := range m.Origins {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(origin)); ok || pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedHeaders returns the headers of a preflight's
+// Access-Control-Request-Headers the module allows
+func (m *CORSModule) allowedHeaders(requested string) []string {
+	var allowed []string
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+		for _, pattern := range append(append([]string{}, defaultCORSHeaders...), m.Headers...) {
+			if ok, _ := path.Match(strings.ToLower(pattern), header); ok {
+				allowed = append(allowed, header)
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+var (
+	_ caddy.Provisioner           = (*CORSModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*CORSModule)(nil)
+)
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestCORSModule(t *testing.T) {
+	m := &CORSModule{
+		Origins: []string{"https://app.example.com", "https://*.example.org"},
+		Headers: []string{"x-team"},
+		MaxAge:  caddy.Duration(time.Hour),
+	}
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		headers     map[string]string
+		wantStatus  int
+		wantOrigin  string
+		wantAllowed string
+		wantNext    bool
+	}{
+		{
+			name:   "preflight of an allowed origin",
+			method: http.MethodOptions, origin: "https://app.example.com",
+			headers:    map[string]string{"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "Authorization, X-Stainless-Lang, X-Team, X-Other"},
+			wantStatus: http.StatusNoContent, wantOrigin: "https://app.example.com",
+			wantAllowed: "authorization, x-stainless-lang, x-team",
+		},
+		{
+			name:   "preflight of a rejected origin",
+			method: http.MethodOptions, origin: "https://evil.example.net",
+			headers:    map[string]string{"Access-Control-Request-Method": "POST"},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   "request of a wildcard origin",
+			method: http.MethodPost, origin: "https://eu.example.org",
+			wantStatus: http.StatusOK, wantOrigin: "https://eu.example.org", wantNext: true,
+		},
+		{
+			name:   "request of a rejected origin",
+			method: http.MethodPost, origin: "https://evil.example.net",
+			wantStatus: http.StatusOK, wantNext: true,
+		},
+		{
+			name:       "request without origin",
+			method:     http.MethodPost,
+			wantStatus: http.StatusOK, wantNext: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/v1/chat/completions", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			called := false
+			next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				called = true
+				w.WriteHeader(http.StatusOK)
+				return nil
+			})
+
+			if err := m.ServeHTTP(w, r, next); err != nil {
+				t.Fatalf("ServeHTTP returned error: %v", err)
+			}
+			if w.Code != tt.wantStatus || called != tt.wantNext {
+				t.Errorf("got status %d and next called %v, want %d and %v", w.Code, called, tt.wantStatus, tt.wantNext)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Headers"); got != tt.wantAllowed {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.wantAllowed)
+			}
+			// Caches must keep answers per origin, whatever the answer was
+			if !slices.Contains(w.Header().Values("Vary"), "Origin") {
+				t.Errorf("expected Vary: Origin, got %q", w.Header().Values("Vary"))
+			}
+			if tt.wantOrigin != "" && tt.method == http.MethodOptions {
+				if got := w.Header().Get("Access-Control-Max-Age"); got != "3600" {
+					t.Errorf("Access-Control-Max-Age = %q, want 3600", got)
+				}
+			}
+			if tt.wantOrigin != "" && tt.method != http.MethodOptions && w.Header().Get("Access-Control-Expose-Headers") == "" {
+				t.Error("expected the router's headers to be exposed")
+			}
+		})
+	}
+}
+
+func TestCORSModule_AnyOrigin(t *testing.T) {
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error { return nil })
+	r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	r.Header.Set("Origin", "https://anywhere.example")
+
+	w := httptest.NewRecorder()
+	_ = (&CORSModule{}).ServeHTTP(w, r, next)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expected any origin to be allowed with *, got %q", got)
+	}
+
+	// Credentials can't be combined with "*"
+	w = httptest.NewRecorder()
+	_ = (&CORSModule{Credentials: true}).ServeHTTP(w, r, next)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://anywhere.example" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("expected the origin echoed with credentials, got %q", got)
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// DataModule erases what the router stores about a tenant, for GDPR-style
+// erasure requests: its tee captures and the usage ledgers of every router.
+//
+//	DELETE /admin/data?tenant=acme
+//
+// Like the other admin endpoints it checks no credentials itself.
+type DataModule struct {
+	logger *zap.Logger
+}
+
+// dataErasure is the response of an erasure
+type dataErasure struct {
+	Object   string `json:"object"` // always "data.erasure"
+	Tenant   string `json:"tenant"`
+	Captures int    `json:"captures"`
+	// UsageHours counts the usage ledger hours erased over all routers
+	UsageHours int `json:"usage_hours"`
+}
+
+func ParseDataModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m DataModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			return nil, h.Errf("unrecognized ai_data option '%s'", h.Val())
+		}
+	}
+	return &m, nil
+}
+
+func (*DataModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_data",
+		New: func() caddy.Module { return new(DataModule) },
+	}
+}
+
+func (m *DataModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	return nil
+}
+
+func (m *DataModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return nil
+	}
+
+	erasure := dataErasure{Object: "data.erasure", Tenant: tenant}
+	if store := services.TeeStore(); store != nil {
+		deleted, err := store.DeleteMatching(r.Context(), services.TenantObjectPrefix(tenant), nil)
+		erasure.Captures = deleted
+		if err != nil {
+			m.logger.Error("erasing captures failed", zap.String("tenant", tenant), zap.Int("deleted", deleted), zap.Error(err))
+			http.Error(w, "erasing captures failed", http.StatusBadGateway)
+			return nil
+		}
+	}
+	now := time.Now()
+	for name, router := range modules.ListRouters() {
+		erased, err := router.Impl.Usage.Erase(tenant, now)
+		if err != nil {
+			m.logger.Error("erasing usage failed", zap.String("tenant", tenant), zap.String("router", name), zap.Error(err))
+			http.Error(w, "erasing usage failed", http.StatusInternalServerError)
+			return nil
+		}
+		erasure.UsageHours += erased
+	}
+
+	m.logger.Info("tenant data erased", zap.String("tenant", tenant),
+		zap.Int("captures", erasure.Captures), zap.Int("usage_hours", erasure.UsageHours))
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(erasure)
+}
+
+var (
+	_ caddy.Provisioner           = (*DataModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*DataModule)(nil)
+)
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// requestTimeoutKey carries the router's request_timeout in the request context
+type requestTimeoutKey struct{}
+
+// timeoutChunk builds the final chunk sent when the request deadline is exceeded
+// mid-stream: an empty delta with finish_reason=length for each unfinished
+// choice (the first one when none was seen) and a notice in extras.
+func timeoutChunk(lastChunk styles.PartialJSON, timeout time.Duration, unfinished []int) styles.PartialJSON {
+	chunk := make(styles.PartialJSON)
+	for _, key := range []string{"id", "created", "model"} {
+		if v, ok := lastChunk[key]; ok {
+			chunk[key] = v
+		}
+	}
+	if len(unfinished) == 0 {
+		unfinished = []int{0}
+	}
+	choices := make([]styles.ChatCompletionsChoice, len(unfinished))
+	for i, index := range unfinished {
+		choices[i] = styles.ChatCompletionsChoice{
+			Index:        index,
+			Delta:        &styles.ChatCompletionsMessage{},
+			FinishReason: "length",
+		}
+	}
+	_ = chunk.Set("object", "chat.completion.chunk")
+	_ = chunk.Set("choices", choices)
+	_ = chunk.Set("extras", map[string]any{
+		"timed_out": true,
+		"notice":    fmt.Sprintf("request deadline of %s exceeded; the response is partial", timeout),
+	})
+	return chunk
+}
+
+// openChoices tracks the choices of a stream that have not finished yet
+type openChoices struct {
+	open map[int]bool
+}
+
+func newOpenChoices() *openChoices {
+	return &openChoices{open: map[int]bool{}}
+}
+
+// add records the choices of a chunk and their finish events
+func (c *openChoices) add(chunk styles.PartialJSON) {
+	var choices []struct {
+		Index        int     `json:"index"`
+		FinishReason *string `json:"finish_reason"`
+	}
+	if raw, ok := chunk["choices"]; !ok || json.Unmarshal(raw, &choices) != nil {
+		return
+	}
+	for _, choice := range choices {
+		c.open[choice.Index] = choice.FinishReason == nil || *choice.FinishReason == ""
+	}
+}
+
+// list returns the indexes of the unfinished choices in order
+func (c *openChoices) list() []int {
+	var indexes []int
+	for index, open := range c.open {
+		if open {
+			indexes = append(indexes, index)
+		}
+	}
+	slices.Sort(indexes)
+	return indexes
+}
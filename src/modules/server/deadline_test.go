@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// slowCommand answers streams with the chunks sent on its channel and
+// blocks non-streaming requests until they are cancelled
+type slowCommand struct {
+	streamCommand
+}
+
+func (c *slowCommand) DoInference(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	<-r.Context().Done()
+	return nil, nil, r.Context().Err()
+}
+
+// deadlineRouter registers a router with a request_timeout whose provider
+// is cmd
+func deadlineRouter(t *testing.T, name string, cmd drivers.InferenceCommand) {
+	t.Helper()
+	provider := testProvider()
+	provider.Impl.Commands = map[string]any{"inference": cmd}
+	router := &modules.RouterModule{
+		ProviderConfigs: map[string]*modules.ProviderConfig{"test": provider},
+		ProvidersOrder:  []string{"test"},
+		RequestTimeout:  caddy.Duration(50 * time.Millisecond),
+		Impl: services.RouterService{
+			Auth:   services.NopAuthService{},
+			Logger: zap.NewNop(),
+			Sinks:  []services.ObservabilitySink{},
+		},
+	}
+	provider.Impl.Router = &router.Impl
+	modules.RegisterRouter(name, router)
+}
+
+func serveChat(t *testing.T, m *ChatCompletionsModule, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	if err := m.ServeHTTP(rec, req, caddyhttp.HandlerFunc(func(http.ResponseWriter, *http.Request) error { return nil })); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestChatCompletions_DeadlineMidStream(t *testing.T) {
+	cmd := &slowCommand{streamCommand{chunks: make(chan drivers.InferenceStreamChunk)}}
+	deadlineRouter(t, "test-deadline-stream", cmd)
+	m := &ChatCompletionsModule{RouterName: "test-deadline-stream", logger: zap.NewNop()}
+
+	// Three choices start, the second finishes, then the upstream stalls
+	chunks := []styles.PartialJSON{
+		deltaChunk(t, `{"id": "c1", "model": "m", "choices": [{"index": 0, "delta": {"content": "Hel"}}, {"index": 1, "delta": {"content": "Hi"}}, {"index": 2, "delta": {"content": "Hey"}}]}`),
+		deltaChunk(t, `{"id": "c1", "model": "m", "choices": [{"index": 1, "delta": {}, "finish_reason": "stop"}]}`),
+	}
+	go func() {
+		for _, chunk := range chunks {
+			cmd.chunks <- drivers.InferenceStreamChunk{Data: chunk}
+		}
+	}()
+	rec := serveChat(t, m, `{"model": "test", "stream": true, "n": 3, "messages": [{"role": "user", "content": "hi"}]}`)
+
+	var events []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	if len(events) < 2 || events[len(events)-1] != "[DONE]" {
+		t.Fatalf("expected the stream to end with [DONE], got %q", events)
+	}
+	var final struct {
+		ID      string `json:"id"`
+		Choices []struct {
+			Index        int    `json:"index"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Extras struct {
+			TimedOut bool `json:"timed_out"`
+		} `json:"extras"`
+	}
+	if err := json.Unmarshal([]byte(events[len(events)-2]), &final); err != nil {
+		t.Fatalf("unreadable final chunk %q: %v", events[len(events)-2], err)
+	}
+	if !final.Extras.TimedOut || final.ID != "c1" {
+		t.Errorf("expected a timed out chunk of the stream, got %s", events[len(events)-2])
+	}
+	var closed []int
+	for _, choice := range final.Choices {
+		if choice.FinishReason != "length" {
+			t.Errorf("expected choice %d finished by length, got %q", choice.Index, choice.FinishReason)
+		}
+		closed = append(closed, choice.Index)
+	}
+	if !slices.Equal(closed, []int{0, 2}) {
+		t.Errorf("expected the open choices 0 and 2 closed, got %v", closed)
+	}
+}
+
+func TestChatCompletions_DeadlineNonStream(t *testing.T) {
+	deadlineRouter(t, "test-deadline", &slowCommand{})
+	m := &ChatCompletionsModule{RouterName: "test-deadline", logger: zap.NewNop()}
+
+	rec := serveChat(t, m, `{"model": "test", "messages": [{"role": "user", "content": "hi"}]}`)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 once the deadline passed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestTimeoutChunk(t *testing.T) {
+	last := deltaChunk(t, `{"id": "c1", "created": 1, "model": "m", "object": "chat.completion.chunk", "choices": [], "usage": {"total_tokens": 3}}`)
+	tests := []struct {
+		name       string
+		unfinished []int
+		want       []int
+	}{
+		{"open choices", []int{1, 3}, []int{1, 3}},
+		{"no choice seen", nil, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk := timeoutChunk(last, 30*time.Second, tt.unfinished)
+			for _, key := range []string{"id", "created", "model"} {
+				if string(chunk[key]) != string(last[key]) {
+					t.Errorf("expected %s copied from the last chunk, got %s", key, chunk[key])
+				}
+			}
+			if _, ok := chunk["usage"]; ok {
+				t.Error("expected no usage in the timeout chunk")
+			}
+			choices := styles.TryGetFromPartialJSON[[]styles.ChatCompletionsChoice](chunk, "choices")
+			var got []int
+			for _, choice := range choices {
+				if choice.FinishReason != "length" {
+					t.Errorf("expected finish_reason length, got %q", choice.FinishReason)
+				}
+				got = append(got, choice.Index)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected choices %v, got %v", tt.want, got)
+			}
+			extras := styles.TryGetFromPartialJSON[map[string]any](chunk, "extras")
+			if extras["timed_out"] != true || !strings.Contains(extras["notice"].(string), "30s") {
+				t.Errorf("expected a timeout notice, got %v", extras)
+			}
+		})
+	}
+}
+
+func TestOpenChoices(t *testing.T) {
+	c := newOpenChoices()
+	for _, chunk := range []string{
+		`{"choices": [{"index": 0, "delta": {"content": "a"}}, {"index": 2, "delta": {"content": "b"}}]}`,
+		`{"choices": [{"index": 1, "delta": {"content": "c"}}]}`,
+		`{"choices": [{"index": 2, "delta": {}, "finish_reason": "stop"}]}`,
+		`{"choices": [{"index": 0, "delta": {"content": "d"}, "finish_reason": null}]}`,
+		`{"usage": {"total_tokens": 3}}`,
+		`{"choices": "unreadable"}`,
+	} {
+		c.add(deltaChunk(t, chunk))
+	}
+	if got := c.list(); !slices.Equal(got, []int{0, 1}) {
+		t.Errorf("expected choices 0 and 1 open, got %v", got)
+	}
+}
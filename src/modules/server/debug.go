@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/pprof"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// DebugModule serves the streams in flight in the process, for tracking down
+// leaked upstream connections and stream goroutines:
+//
+//	GET /admin/debug/streams[?stacks=1]
+//
+// With stacks=1 it answers the stacks of all goroutines as text instead.
+// The same gauges are exposed as metrics by the chat completions handler.
+type DebugModule struct {
+	logger *zap.Logger
+}
+
+func ParseDebugModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m DebugModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			return nil, h.Errf("unrecognized ai_debug option '%s'", h.Val())
+		}
+	}
+	return &m, nil
+}
+
+func (*DebugModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_debug",
+		New: func() caddy.Module { return new(DebugModule) },
+	}
+}
+
+func (m *DebugModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	return nil
+}
+
+func (m *DebugModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	if r.URL.Query().Get("stacks") == "1" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := pprof.Lookup("goroutine").WriteTo(w, 1); err != nil {
+			m.logger.Error("writing goroutine stacks failed", zap.Error(err))
+		}
+		return nil
+	}
+
+	split, skipped := drivers.ChunkRepairStats()
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]any{
+		"object":  "debug.streams",
+		"streams": services.ReadStreamGauges(),
+		"chunk_repairs": map[string]int64{
+			"split":   split,
+			"skipped": skipped,
+		},
+	})
+}
+
+var (
+	_ caddy.Provisioner           = (*DebugModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*DebugModule)(nil)
+)
@@ -0,0 +1,353 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// EmbeddingCacheHeader reports how many inputs of an embeddings request were
+// served from the cache
+const EmbeddingCacheHeader = "X-Embedding-Cache-Hits"
+
+// EmbeddingsModule serves the OpenAI Embeddings API, trying the providers
+// of the requested model in order. With a cache, inputs embedded before are
+// answered from it and only the others are sent upstream.
+type EmbeddingsModule struct {
+	RouterName string `json:"router,omitempty"`
+	// CacheTTL enables the embedding cache, keeping vectors this long
+	CacheTTL caddy.Duration `json:"cache_ttl,omitempty"`
+	// CacheStore names the state store holding the cache (default: memory)
+	CacheStore string `json:"cache_store,omitempty"`
+
+	cache  *services.EmbeddingCache
+	logger *zap.Logger
+}
+
+// embeddingData is an entry of an embeddings response
+type embeddingData struct {
+	Object    string          `json:"object"`
+	Index     int             `json:"index"`
+	Embedding json.RawMessage `json:"embedding"`
+}
+
+func ParseEmbeddingsModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m EmbeddingsModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "router":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.RouterName = h.Val()
+			case "cache":
+				// cache <ttl> [<store>]
+				args := h.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, h.ArgErr()
+				}
+				ttl, err := caddy.ParseDuration(args[0])
+				if err != nil || ttl <= 0 {
+					return nil, h.Errf("invalid cache ttl '%s'", args[0])
+				}
+				m.CacheTTL = caddy.Duration(ttl)
+				if len(args) == 2 {
+					m.CacheStore = args[1]
+				}
+			default:
+				return nil, h.Errf("unrecognized ai_embeddings option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*EmbeddingsModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_embeddings",
+		New: func() caddy.Module { return new(EmbeddingsModule) },
+	}
+}
+
+func (m *EmbeddingsModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	if err := modules.EnsureAIApp(ctx); err != nil {
+		return err
+	}
+	if m.CacheTTL > 0 {
+		store, ok := services.LookupStateStore(m.CacheStore)
+		if !ok {
+			return fmt.Errorf("ai_embeddings: unknown state store '%s'", m.CacheStore)
+		}
+		router := m.RouterName
+		if router == "" {
+			router = "default"
+		}
+		m.cache = &services.EmbeddingCache{Store: store, Prefix: "embeddings:" + router + ":", TTL: time.Duration(m.CacheTTL)}
+	}
+	return nil
+}
+
+func (m *EmbeddingsModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	reqBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return nil
+	}
+	reqJson, err := styles.ParsePartialJSON(reqBody)
+	if err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return nil
+	}
+	inputs, err := services.EmbeddingInputs(reqJson)
+	if err != nil {
+		writeProviderError(w, errs.Wrap(errs.ErrInvalidRequest, err))
+		return nil
+	}
+
+	router, ok := modules.GetRouter(m.RouterName)
+	if !ok {
+		m.logger.Error("Router not found", zap.String("name", m.RouterName))
+		http.Error(w, "Router not found", http.StatusInternalServerError)
+		return nil
+	}
+	r, err = router.Impl.Auth.CollectIncomingAuth(r)
+	if err != nil {
+		m.logger.Error("failed to collect incoming auth", zap.Error(err))
+		http.Error(w, "authentication error", http.StatusUnauthorized)
+		return nil
+	}
+	r = withClientPolicy(router, router.Identity.Apply(r))
+	policy := requestPolicy(router, r)
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	if err := policy.Deny(keyID, reqJson); err != nil {
+		m.logger.Warn("request rejected by policy", zap.String("key_id", keyID), zap.Error(err))
+		writeProviderError(w, err)
+		return nil
+	}
+	r, err = withResidency(router, r, keyID, reqJson)
+	if err != nil {
+		writeProviderError(w, err)
+		return nil
+	}
+	tenant, ok := r.Context().Value(plugin.ContextTenantID()).(string)
+	if !ok {
+		tenant, _, _ = strings.Cut(keyID, ":")
+	}
+	allowed, wait, err := router.Impl.RateLimits.Take(tenant, keyID, time.Now())
+	if err != nil {
+		m.logger.Error("rate limit state store error", zap.Error(err))
+	} else if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return nil
+	}
+	if !takeClientRateLimits(m.logger, router, policy, w, keyID, reqJson) {
+		return nil
+	}
+	if !takeQuota(m.logger, router.Impl.Quotas, w, tenant, keyID, reqJson) {
+		return nil
+	}
+
+	start := time.Now()
+	vectors := make([]json.RawMessage, len(inputs))
+	if m.cache != nil {
+		if cached, err := m.cache.Lookup(reqJson, inputs); err != nil {
+			m.logger.Error("embedding cache lookup failed", zap.Error(err))
+		} else {
+			vectors = cached
+		}
+	}
+	var missing []int
+	for i, v := range vectors {
+		if v == nil {
+			missing = append(missing, i)
+		}
+	}
+
+	res := styles.PartialJSON{}
+	provider := ""
+	if len(missing) > 0 {
+		misses := make([]json.RawMessage, len(missing))
+		for i, idx := range missing {
+			misses[i] = inputs[idx]
+		}
+		var fetched []json.RawMessage
+		res, fetched, provider, err = m.embed(router, reqJson, misses, w, r)
+		if err != nil {
+			m.logger.Error("embeddings request failed", zap.Error(err), zap.String("error_kind", errs.Kind(err)))
+			writeProviderError(w, err)
+			return nil
+		}
+		for i, idx := range missing {
+			vectors[idx] = fetched[i]
+		}
+		if m.cache != nil {
+			if err := m.cache.Put(reqJson, misses, fetched); err != nil {
+				m.logger.Error("embedding cache update failed", zap.Error(err))
+			}
+		}
+	}
+
+	data := make([]embeddingData, len(vectors))
+	for i, v := range vectors {
+		data[i] = embeddingData{Object: "embedding", Index: i, Embedding: v}
+	}
+	if err := res.Set("object", "list"); err != nil {
+		return err
+	}
+	if err := res.Set("data", data); err != nil {
+		return err
+	}
+	if _, ok := res["model"]; !ok {
+		_ = res.Set("model", styles.TryGetFromPartialJSON[string](reqJson, "model"))
+	}
+	if _, ok := res["usage"]; !ok {
+		_ = res.Set("usage", map[string]int{"prompt_tokens": 0, "total_tokens": 0})
+	}
+	if provider != "" {
+		_, model := router.ResolveProvidersOrderAndModel(styles.TryGetFromPartialJSON[string](reqJson, "model"))
+		recordUsage(m.logger, &router.Impl, r, provider, model, responseUsage(res))
+	}
+	hits := len(inputs) - len(missing)
+	m.emitEvent(router, r, reqJson, res, provider, hits, time.Since(start))
+
+	out, err := res.Marshal()
+	if err != nil {
+		return err
+	}
+	w.Header().Set(EmbeddingCacheHeader, strconv.Itoa(hits))
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(out)
+	return nil
+}
+
+// embed sends inputs to the first provider of the requested model able to
+// embed them, failing over like chat completions. It returns the upstream
+// response, the inputs' vectors in order and the provider's name.
+func (m *EmbeddingsModule) embed(router *modules.RouterModule, reqJson styles.PartialJSON, inputs []json.RawMessage, w http.ResponseWriter, r *http.Request) (styles.PartialJSON, []json.RawMessage, string, error) {
+	requested := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	providers, model := router.ResolveProvidersOrderAndModel(requested)
+	providers, err := filterAllowedProviders(router, r, reqJson, providers, model)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	providers, err = filterResidency(router, r, providers, model)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var displayErr error
+	for _, name := range providers {
+		p, ok := router.ProviderConfigs[name]
+		if !ok {
+			continue
+		}
+		cmd, ok := p.Impl.Commands["embeddings"].(drivers.EmbeddingsCommand)
+		if !ok {
+			m.logger.Debug("Provider does not support embeddings", zap.String("provider", name))
+			continue
+		}
+		providerReq := reqJson.Clone()
+		if err := providerReq.Set("model", model); err != nil {
+			return nil, nil, "", err
+		}
+		if err := providerReq.Set("input", inputs); err != nil {
+			return nil, nil, "", err
+		}
+
+		// Batches above the model's limit are split into several upstream calls
+		if limit := p.Impl.Capabilities.Limit(model, services.LimitMaxBatch); limit > 0 {
+			cmd = drivers.SplitBatches(cmd, limit)
+		}
+
+		done := p.Impl.BeginRequest()
+		_, res, err := cmd.DoEmbeddings(&p.Impl, providerReq, r)
+		done()
+		if err == nil {
+			var vectors []json.RawMessage
+			if vectors, err = embeddingVectors(res, len(inputs)); err == nil {
+				w.Header().Set("X-Real-Provider-Id", name)
+				w.Header().Set("X-Real-Model-Id", model)
+				p.Impl.ApplyResponseHeaders(w.Header(), r)
+				return res, vectors, name, nil
+			}
+		}
+
+		m.logger.Debug("Provider failed to embed", zap.String("provider", name), zap.Error(err))
+		displayErr = services.MoreRelevantError(displayErr, fmt.Errorf("provider %s: %w", name, err))
+		if !services.ClassifyError(err).FailOver() || r.Context().Err() != nil {
+			break
+		}
+	}
+	if displayErr == nil {
+		displayErr = errs.Errorf(errs.ErrCapability, "no provider serves embeddings for model %s", requested)
+	}
+	return nil, nil, "", displayErr
+}
+
+// embeddingVectors returns the vectors of an embeddings response in input
+// order, checking there is one for each of n inputs
+func embeddingVectors(res styles.PartialJSON, n int) ([]json.RawMessage, error) {
+	var data []embeddingData
+	if err := json.Unmarshal(res["data"], &data); err != nil {
+		return nil, errs.Wrap(errs.ErrUpstream, err)
+	}
+	vectors := make([]json.RawMessage, n)
+	for _, d := range data {
+		if d.Index < 0 || d.Index >= n || len(d.Embedding) == 0 {
+			return nil, errs.Errorf(errs.ErrUpstream, "embedding with invalid index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, errs.Errorf(errs.ErrUpstream, "no embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// emitEvent sends an $ai_embedding event to the router's observability sinks
+func (m *EmbeddingsModule) emitEvent(router *modules.RouterModule, r *http.Request, reqJson, res styles.PartialJSON, provider string, hits int, latency time.Duration) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(plugin.ContextUserID()).(string)
+	props := map[string]any{
+		"$ai_model":        styles.TryGetFromPartialJSON[string](reqJson, "model"),
+		"$ai_provider":     provider,
+		"$ai_latency":      latency.Seconds(),
+		"$ai_input_tokens": styles.TryGetFromPartialJSON[map[string]any](res, "usage")["prompt_tokens"],
+		"cache_hits":       hits,
+	}
+	if traceID, _ := ctx.Value(plugin.ContextTraceID()).(string); traceID != "" {
+		props["$ai_trace_id"] = traceID
+	}
+	_ = services.EmitObservabilityEvent(&router.Impl, services.ObservabilityEvent{
+		Name:       "$ai_embedding",
+		DistinctID: userID,
+		Project:    eventProject(&router.Impl, r),
+		Properties: props,
+	})
+}
+
+var (
+	_ caddy.Provisioner           = (*EmbeddingsModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*EmbeddingsModule)(nil)
+)
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// embeddingsCommand answers embeddings requests with one vector per input
+type embeddingsCommand struct {
+	calls int
+}
+
+func (c *embeddingsCommand) DoEmbeddings(p *services.ProviderService, reqJson styles.PartialJSON, r *http.Request) (*http.Response, styles.PartialJSON, error) {
+	c.calls++
+	res := styles.PartialJSON{}
+	err := res.Set("data", []map[string]any{{"object": "embedding", "index": 0, "embedding": []float64{0.1, 0.2}}})
+	return nil, res, err
+}
+
+func TestEmbeddingsModule_ClientPolicy(t *testing.T) {
+	cmd := &embeddingsCommand{}
+	provider := testProvider()
+	provider.Impl.Commands = map[string]any{"embeddings": cmd}
+	policy := &services.Policy{Rules: []*services.PolicyRule{
+		{IPs: []string{"203.0.113.0/24"}, Deny: true},
+		{IPs: []string{"198.51.100.0/24"}, Providers: []string{"other"}},
+		{IPs: []string{"192.0.2.0/24"}, RateLimit: &services.BucketLimit{Rate: 1, Burst: 1}},
+	}}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	router := &modules.RouterModule{
+		ProviderConfigs: map[string]*modules.ProviderConfig{"test": provider},
+		ProvidersOrder:  []string{"test"},
+		Impl: services.RouterService{
+			Auth:       services.NopAuthService{},
+			Logger:     zap.NewNop(),
+			Policy:     policy,
+			RateLimits: &services.TokenBuckets{Store: services.NewMemoryStateStore()},
+			Sinks:      []services.ObservabilitySink{},
+		},
+	}
+	modules.RegisterRouter("test-embeddings-policy", router)
+	m := &EmbeddingsModule{RouterName: "test-embeddings-policy", logger: zap.NewNop()}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		wantStatus int
+		wantCalls  int
+	}{
+		{"denied client", "203.0.113.7:1234", http.StatusForbidden, 0},
+		{"client limited to other providers", "198.51.100.7:1234", http.StatusForbidden, 0},
+		{"rate limited client, first request", "192.0.2.7:1234", http.StatusOK, 1},
+		{"rate limited client, second request", "192.0.2.7:1234", http.StatusTooManyRequests, 1},
+		{"other client", "192.0.2.8:1234", http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(`{"model": "embed", "input": "hello"}`))
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			if err := m.ServeHTTP(rec, req, caddyhttp.HandlerFunc(func(http.ResponseWriter, *http.Request) error { return nil })); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if cmd.calls != tt.wantCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.wantCalls, cmd.calls)
+			}
+		})
+	}
+}
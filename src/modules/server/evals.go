@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/evals"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// EvalsModule runs eval datasets against models through a router:
+//
+//	POST   /admin/evals                   run a dataset ({"dataset" or "cases", "models", "judge_model"?})
+//	GET    /admin/evals/datasets          names of the stored datasets
+//	PUT    /admin/evals/datasets/{name}   store a dataset ({"cases", "judge_model"?})
+//	GET    /admin/evals/datasets/{name}   a stored dataset
+//	DELETE /admin/evals/datasets/{name}   delete a stored dataset
+type EvalsModule struct {
+	RouterName string `json:"router,omitempty"`
+	// Store names the state store holding datasets (default: memory)
+	Store string `json:"store,omitempty"`
+
+	datasets *evals.Store
+	chat     *ChatCompletionsModule
+	logger   *zap.Logger
+}
+
+// evalRunBody is the body of the run endpoint
+type evalRunBody struct {
+	Dataset    string       `json:"dataset"`
+	Cases      []evals.Case `json:"cases"`
+	Models     []string     `json:"models"`
+	JudgeModel string       `json:"judge_model"`
+}
+
+func ParseEvalsModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m EvalsModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "router":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.RouterName = h.Val()
+			case "store":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.Store = h.Val()
+			default:
+				return nil, h.Errf("unrecognized ai_evals option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*EvalsModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_evals",
+		New: func() caddy.Module { return new(EvalsModule) },
+	}
+}
+
+func (m *EvalsModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	if err := modules.EnsureAIApp(ctx); err != nil {
+		return err
+	}
+	store, ok := services.LookupStateStore(m.Store)
+	if !ok {
+		return fmt.Errorf("ai_evals: unknown state store '%s'", m.Store)
+	}
+	router := m.RouterName
+	if router == "" {
+		router = "default"
+	}
+	m.datasets = &evals.Store{State: store, Prefix: "evals:" + router + ":"}
+	// Eval requests go through the chat completions handler, with its
+	// plugins, policy and fallback
+	m.chat = &ChatCompletionsModule{RouterName: m.RouterName, logger: m.logger.Named("chat")}
+	return nil
+}
+
+func (m *EvalsModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	rest := r.URL.Path
+	if _, after, found := strings.Cut(rest, "/evals"); found && (after == "" || after[0] == '/') {
+		rest = after
+	}
+	section, name, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+
+	switch {
+	case section == "" && r.Method == http.MethodPost:
+		m.run(w, r)
+	case section != "datasets":
+		http.Error(w, "not found", http.StatusNotFound)
+	case name == "" && r.Method == http.MethodGet:
+		names, err := m.datasets.List()
+		m.writeResult(w, map[string]any{"object": "list", "data": names}, err)
+	case name == "":
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	case r.Method == http.MethodGet:
+		dataset, err := m.datasets.Get(name)
+		m.writeResult(w, dataset, err)
+	case r.Method == http.MethodPut:
+		var dataset evals.Dataset
+		if err := json.NewDecoder(r.Body).Decode(&dataset); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return nil
+		}
+		dataset.Name = name
+		m.writeResult(w, &dataset, m.datasets.Put(&dataset))
+	case r.Method == http.MethodDelete:
+		m.writeResult(w, map[string]any{"name": name, "deleted": true}, m.datasets.Delete(name))
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+	return nil
+}
+
+// run runs a stored or inline dataset and writes the report
+func (m *EvalsModule) run(w http.ResponseWriter, r *http.Request) {
+	var body evalRunBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(body.Models) == 0 {
+		http.Error(w, "models are required", http.StatusBadRequest)
+		return
+	}
+	dataset := &evals.Dataset{Name: "inline", Cases: body.Cases}
+	if body.Dataset != "" {
+		var err error
+		if dataset, err = m.datasets.Get(body.Dataset); err != nil {
+			m.writeResult(w, nil, err)
+			return
+		}
+	} else if err := dataset.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.logger.Info("Running eval",
+		zap.String("dataset", dataset.Name),
+		zap.Int("cases", len(dataset.Cases)),
+		zap.Strings("models", body.Models))
+	report := evals.Run(r.Context(), dataset, body.Models, body.JudgeModel, m.complete(r))
+	m.writeResult(w, report, nil)
+}
+
+// complete returns a CompleteFunc sending requests through the chat
+// completions handler with the credentials of the eval request
+func (m *EvalsModule) complete(r *http.Request) evals.CompleteFunc {
+	invoker := plugin.NewCaddyModuleInvoker(m.chat)
+	return func(ctx context.Context, model string, messages []json.RawMessage) (string, error) {
+		data, err := json.Marshal(map[string]any{"model": model, "messages": messages})
+		if err != nil {
+			return "", err
+		}
+		req := r.Clone(ctx)
+		req.Method = http.MethodPost
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+		res, err := invoker.InvokeHandlerCapture(req)
+		if err != nil {
+			return "", err
+		}
+		parsed, err := styles.ParseChatCompletionsResponse(res)
+		if err != nil || len(parsed.Choices) == 0 || parsed.Choices[0].Message == nil {
+			return "", fmt.Errorf("no answer from %s", model)
+		}
+		text, _ := parsed.Choices[0].Message.Content.(string)
+		return text, nil
+	}
+}
+
+// writeResult writes a result as JSON, or the error of a failed call: 404
+// for unknown datasets, 400 for rejected input
+func (m *EvalsModule) writeResult(w http.ResponseWriter, result any, err error) {
+	switch {
+	case errors.Is(err, evals.ErrDatasetNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		m.logger.Debug("eval request failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+var (
+	_ caddy.Provisioner           = (*EvalsModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*EvalsModule)(nil)
+)
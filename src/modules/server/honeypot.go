@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// securityAlertEvent is emitted for requests that suggest a leaked key
+const securityAlertEvent = "$ai_security_alert"
+
+// serveHoneypot answers a request for a honeypot model like a provider
+// would, with the honeypot's canned message, after raising a security alert
+func serveHoneypot(logger *zap.Logger, router *modules.RouterModule, honeypot *modules.HoneypotConfig, w http.ResponseWriter, r *http.Request, reqJson styles.PartialJSON) {
+	model := services.UnescapeModel(plugin.ParseModelSpec(styles.TryGetFromPartialJSON[string](reqJson, "model")).Model)
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	userID, _ := r.Context().Value(plugin.ContextUserID()).(string)
+	tenant, ok := r.Context().Value(plugin.ContextTenantID()).(string)
+	if !ok {
+		tenant, _, _ = strings.Cut(keyID, ":")
+	}
+	client := requestClient(router, r)
+	traceID := ""
+	if trace, ok := plugin.TraceFromContext(r.Context()); ok {
+		traceID = trace.ID
+	}
+
+	logger.Warn("honeypot model requested, the key may have leaked",
+		zap.String("model", model), zap.String("key_id", keyID), zap.String("tenant", tenant),
+		zap.String("client_ip", client.IP.String()), zap.String("user_agent", r.UserAgent()))
+	props := map[string]any{
+		"alert":        "honeypot_model",
+		"$ai_trace_id": traceID,
+		"$ai_model":    model,
+		"key_id":       keyID,
+		"tenant":       tenant,
+		"client_ip":    client.IP.String(),
+		"user_agent":   r.UserAgent(),
+	}
+	if client.Country != "" {
+		props["country"] = client.Country
+	}
+	_ = services.EmitObservabilityEvent(&router.Impl, services.ObservabilityEvent{
+		Name:       securityAlertEvent,
+		DistinctID: userID,
+		URL:        r.URL.String(),
+		Properties: props,
+	})
+
+	// Nothing tells the response apart from a provider's
+	content := honeypot.ResponseText()
+	id := "chatcmpl-" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	created := time.Now().Unix()
+	if provider, name, found := strings.Cut(model, "/"); found {
+		w.Header().Set("X-Real-Provider-Id", provider)
+		w.Header().Set("X-Real-Model-Id", name)
+	}
+	promptTokens := 0
+	if messages, err := json.Marshal(reqJson["messages"]); err == nil {
+		promptTokens = services.EstimateTokens(string(messages))
+	}
+	completionTokens := services.EstimateTokens(content)
+	usage := map[string]any{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      promptTokens + completionTokens,
+	}
+
+	if styles.TryGetFromPartialJSON[bool](reqJson, "stream") {
+		sseWriter := sse.NewWriter(w)
+		_ = sseWriter.WriteData(map[string]any{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []any{map[string]any{
+				"index":         0,
+				"delta":         map[string]any{"role": "assistant", "content": content},
+				"finish_reason": "stop",
+			}},
+			"usage": usage,
+		})
+		_ = sseWriter.WriteDone()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   model,
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": content},
+			"finish_reason": "stop",
+		}},
+		"usage": usage,
+	})
+}
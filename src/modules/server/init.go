@@ -7,10 +7,59 @@ import (
 )
 
 func init() {
+	// ai_cors comes first so preflights never reach the other handlers
+	caddy.RegisterModule(&CORSModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_cors", ParseCORSModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_cors", httpcaddyfile.Before, "header")
+
 	caddy.RegisterModule(&ListModelsModule{})
 	httpcaddyfile.RegisterHandlerDirective("ai_list_models", ParseListModelsModule)
 	httpcaddyfile.RegisterDirectiveOrder("ai_list_models", httpcaddyfile.Before, "header")
 
+	caddy.RegisterModule(&PromptsModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_prompts", ParsePromptsModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_prompts", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&APIKeysModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_api_keys", ParseAPIKeysModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_api_keys", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&EvalsModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_evals", ParseEvalsModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_evals", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&LeaderboardModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_leaderboard", ParseLeaderboardModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_leaderboard", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&StatsModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_stats", ParseStatsModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_stats", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&PartialResponsesModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_partial_responses", ParsePartialResponsesModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_partial_responses", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&DataModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_data", ParseDataModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_data", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&DebugModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_debug", ParseDebugModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_debug", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&VersionModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_version", ParseVersionModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_version", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&EmbeddingsModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_embeddings", ParseEmbeddingsModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_embeddings", httpcaddyfile.Before, "header")
+
+	caddy.RegisterModule(&OpenAPIModule{})
+	httpcaddyfile.RegisterHandlerDirective("ai_openapi", ParseOpenAPIModule)
+	httpcaddyfile.RegisterDirectiveOrder("ai_openapi", httpcaddyfile.Before, "header")
+
 	caddy.RegisterModule(&ChatCompletionsModule{})
 	httpcaddyfile.RegisterHandlerDirective("ai_chat_completions", ParseChatCompletionsModule)
 	httpcaddyfile.RegisterDirectiveOrder("ai_chat_completions", httpcaddyfile.Before, "header")
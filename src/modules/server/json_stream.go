@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/drivers"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// jsonStreamCheck validates the content of a Chat Completions stream whose
+// request asks for JSON output as it is generated, so broken output is
+// caught before it reaches the client.
+type jsonStreamCheck struct {
+	validator services.JSONStreamValidator
+	// sent is the content already streamed to the client
+	sent strings.Builder
+}
+
+// newJSONStreamCheck returns nil for requests not asking for JSON output or
+// asking for several choices
+func newJSONStreamCheck(reqJson styles.PartialJSON) *jsonStreamCheck {
+	format := styles.TryGetFromPartialJSON[map[string]any](reqJson, "response_format")
+	if format["type"] != "json_object" && format["type"] != "json_schema" {
+		return nil
+	}
+	if styles.TryGetFromPartialJSON[int](reqJson, "n") > 1 {
+		return nil
+	}
+	return &jsonStreamCheck{}
+}
+
+// check validates the content the chunk adds, failing when no JSON document
+// can continue it or when the chunk stops generation on an incomplete one
+func (c *jsonStreamCheck) check(chunk styles.PartialJSON) error {
+	if c == nil || chunk == nil {
+		return nil
+	}
+	var choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	}
+	if raw, ok := chunk["choices"]; !ok || json.Unmarshal(raw, &choices) != nil || len(choices) == 0 {
+		return nil
+	}
+	if err := c.validator.Feed(choices[0].Delta.Content); err != nil {
+		return err
+	}
+	if choices[0].FinishReason == "stop" && !c.validator.Complete() {
+		return errs.Errorf(errs.ErrUpstream, "generation stopped before the end of the JSON document")
+	}
+	c.sent.WriteString(choices[0].Delta.Content)
+	return nil
+}
+
+// retryJSON sends a request whose streamed JSON output broke again without
+// streaming and with strict schema enforcement. The new answer must start
+// with the content already streamed; it returns the chunk finishing the
+// stream with the rest of it, modeled on the broken chunk.
+func (m *ChatCompletionsModule) retryJSON(
+	p *modules.ProviderConfig,
+	cmd drivers.InferenceCommand,
+	reqJson styles.PartialJSON,
+	r *http.Request,
+	check *jsonStreamCheck,
+	broken styles.PartialJSON,
+) (styles.PartialJSON, error) {
+	retryReq := reqJson.Clone()
+	_ = retryReq.Set("stream", false)
+	delete(retryReq, "stream_options")
+	if format, err := styles.GetFromPartialJSON[styles.ChatCompletionsResponseFormat](reqJson, "response_format"); err == nil && format.JSONSchema != nil {
+		strict := true
+		format.JSONSchema.Strict = &strict
+		if err := retryReq.Set("response_format", format); err != nil {
+			return nil, err
+		}
+	}
+
+	converter := &services.DefaultConverter{}
+	providerReq, err := converter.ConvertRequest(retryReq, styles.StyleChatCompletions, p.Impl.Style)
+	if err != nil {
+		return nil, err
+	}
+	_, resJson, err := cmd.DoInference(&p.Impl, providerReq, r)
+	if err != nil {
+		return nil, err
+	}
+	if resJson, err = converter.ConvertResponse(resJson, p.Impl.Style, styles.StyleChatCompletions); err != nil {
+		return nil, err
+	}
+	recordUsage(m.logger, p.Impl.Router, r, p.Name, styles.TryGetFromPartialJSON[string](retryReq, "model"), responseUsage(resJson))
+	res, err := styles.ParseChatCompletionsResponse(resJson)
+	if err != nil || len(res.Choices) == 0 || res.Choices[0].Message == nil {
+		return nil, errs.Errorf(errs.ErrUpstream, "JSON retry returned no choice")
+	}
+	content, _ := res.Choices[0].Message.Content.(string)
+	if !json.Valid([]byte(content)) {
+		return nil, errs.Errorf(errs.ErrUpstream, "JSON retry returned invalid JSON")
+	}
+	sent := check.sent.String()
+	if !strings.HasPrefix(content, sent) {
+		return nil, errs.Errorf(errs.ErrUpstream, "JSON retry diverges from the %d characters already streamed", len(sent))
+	}
+
+	finishReason := res.Choices[0].FinishReason
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+	final := broken.Clone()
+	delete(final, "usage")
+	if err := final.Set("choices", []map[string]any{{
+		"index":         0,
+		"delta":         map[string]any{"content": content[len(sent):]},
+		"finish_reason": finishReason,
+	}}); err != nil {
+		return nil, err
+	}
+	if usage, ok := resJson["usage"]; ok && styles.TryGetFromPartialJSON[map[string]any](reqJson, "stream_options")["include_usage"] == true {
+		final["usage"] = usage
+	}
+	return final, nil
+}
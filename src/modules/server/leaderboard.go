@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// defaultLeaderboardWindow is the window of requests without ?window=
+const defaultLeaderboardWindow = 15 * time.Minute
+
+// LeaderboardModule serves a router's providers and models ranked by recent
+// performance: GET /admin/leaderboard[?window=15m] returns the time to first
+// token, throughput, error rate and cost of each, from the router's metrics
+type LeaderboardModule struct {
+	RouterName string `json:"router,omitempty"`
+	logger     *zap.Logger
+}
+
+func ParseLeaderboardModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m LeaderboardModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "router":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.RouterName = h.Val()
+			default:
+				return nil, h.Errf("unrecognized ai_leaderboard option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*LeaderboardModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_leaderboard",
+		New: func() caddy.Module { return new(LeaderboardModule) },
+	}
+}
+
+func (m *LeaderboardModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	return nil
+}
+
+func (m *LeaderboardModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	router, ok := modules.GetRouter(m.RouterName)
+	if !ok {
+		m.logger.Error("Router not found", zap.String("name", m.RouterName))
+		http.Error(w, "Router not found", http.StatusInternalServerError)
+		return nil
+	}
+
+	window := defaultLeaderboardWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		var err error
+		if window, err = time.ParseDuration(v); err != nil || window <= 0 || window > services.MetricsRetention {
+			http.Error(w, "invalid window, expected a duration up to "+services.MetricsRetention.String(), http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"object": "list",
+		"window": window.String(),
+		"data":   router.Impl.Metrics.Leaderboard(window, time.Now()),
+	})
+	return nil
+}
+
+var (
+	_ caddy.Provisioner           = (*LeaderboardModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*LeaderboardModule)(nil)
+)
@@ -2,7 +2,9 @@ package server
 
 import (
 	"encoding/json"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/caddyserver/caddy/v2"
@@ -71,7 +73,7 @@ func (m *ListModelsModule) ServeHTTP(w http.ResponseWriter, r *http.Request, nex
 		}
 
 		listCmd, ok := p.Impl.Commands["list_models"]
-		if !ok {
+		if !ok || !p.Impl.Endpoints.Allows("/models") {
 			continue
 		}
 
@@ -96,6 +98,12 @@ func (m *ListModelsModule) ServeHTTP(w http.ResponseWriter, r *http.Request, nex
 		}
 	}
 
+	// Honeypots are listed like any other model, so probes find them
+	for _, name := range slices.Sorted(maps.Keys(router.Honeypots)) {
+		owner, _, _ := strings.Cut(name, "/")
+		models = append(models, drivers.ListModelsModel{Object: "model", ID: name, Name: name, OwnedBy: owner})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(map[string]any{
 		"object": "list",
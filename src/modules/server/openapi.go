@@ -0,0 +1,233 @@
+package server
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/rewrite"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// OpenAPIModule serves an OpenAPI 3.1 description of the router's handlers
+// as configured on this instance, for generating clients and gateway
+// configurations:
+//
+//	GET /openapi.json
+//
+// Handlers are found in the running HTTP routes, at the paths their routes
+// match; handlers without a path matcher are listed at their usual path.
+type OpenAPIModule struct {
+	// Title of the document (default: Open AI Router)
+	Title string `json:"title,omitempty"`
+	// Version of the described API (default: 1.0.0)
+	Version string `json:"version,omitempty"`
+
+	ctx    caddy.Context
+	logger *zap.Logger
+}
+
+// openAPIDefaultPaths are the paths of handlers whose routes match none
+var openAPIDefaultPaths = map[string]string{
+	services.OpenAPIChatCompletions:  "/v1/chat/completions",
+	services.OpenAPIEmbeddings:       "/v1/embeddings",
+	services.OpenAPIListModels:       "/v1/models",
+	services.OpenAPIPartialResponses: "/v1/responses/partial",
+	services.OpenAPIPrompts:          "/v1/prompts",
+	services.OpenAPIAPIKeys:          "/v1/api_keys",
+	services.OpenAPIEvals:            "/admin/evals",
+	services.OpenAPILeaderboard:      "/admin/leaderboard",
+	services.OpenAPIStats:            "/admin/stats.json",
+	services.OpenAPIData:             "/admin/data",
+	services.OpenAPIDebug:            "/admin/debug/streams",
+	services.OpenAPIVersion:          "/version",
+}
+
+func ParseOpenAPIModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m OpenAPIModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "title":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.Title = h.Val()
+			case "version":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.Version = h.Val()
+			default:
+				return nil, h.Errf("unrecognized ai_openapi option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*OpenAPIModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_openapi",
+		New: func() caddy.Module { return new(OpenAPIModule) },
+	}
+}
+
+func (m *OpenAPIModule) Provision(ctx caddy.Context) error {
+	m.ctx = ctx
+	m.logger = ctx.Logger(m)
+	return nil
+}
+
+func (m *OpenAPIModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	// The HTTP app is only complete once provisioned, so routes are read
+	// per request
+	app, err := m.ctx.AppIfConfigured("http")
+	if err != nil {
+		m.logger.Error("HTTP app not available", zap.Error(err))
+		http.Error(w, "HTTP app not available", http.StatusInternalServerError)
+		return nil
+	}
+	var endpoints []services.OpenAPIEndpoint
+	if httpApp, ok := app.(*caddyhttp.App); ok {
+		for _, name := range slices.Sorted(maps.Keys(httpApp.Servers)) {
+			endpoints = appendOpenAPIEndpoints(endpoints, httpApp.Servers[name].Routes, nil, "")
+		}
+	}
+
+	doc := services.BuildOpenAPI(services.OpenAPIInfo{
+		Title:   m.Title,
+		Version: m.Version,
+		Plugins: slices.Collect(maps.Keys(plugin.Registry)),
+	}, endpoints)
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// appendOpenAPIEndpoints appends the router's handlers found in routes.
+// paths are the patterns matched by the enclosing routes, and prefix the
+// path a handle_path stripped before them.
+func appendOpenAPIEndpoints(endpoints []services.OpenAPIEndpoint, routes caddyhttp.RouteList, paths []string, prefix string) []services.OpenAPIEndpoint {
+	for _, route := range routes {
+		routePaths := paths
+		if matched := matchedPaths(route.MatcherSets); len(matched) > 0 {
+			routePaths = make([]string, len(matched))
+			for i, p := range matched {
+				routePaths[i] = prefix + p
+			}
+		}
+		for _, h := range route.Handlers {
+			switch h := h.(type) {
+			case *caddyhttp.Subroute:
+				endpoints = appendOpenAPIEndpoints(endpoints, h.Routes, routePaths, prefix)
+			case *rewrite.Rewrite:
+				// The routes after it see paths without the prefix
+				if h.StripPathPrefix != "" {
+					prefix += strings.TrimSuffix(h.StripPathPrefix, "/")
+				}
+			default:
+				kind := openAPIKind(h)
+				if kind == "" {
+					continue
+				}
+				if len(routePaths) == 0 {
+					endpoints = append(endpoints, services.OpenAPIEndpoint{Kind: kind, Path: openAPIDefaultPaths[kind]})
+				}
+				for _, p := range routePaths {
+					endpoints = append(endpoints, services.OpenAPIEndpoint{Kind: kind, Path: openAPIPath(p, kind)})
+				}
+			}
+		}
+	}
+	return endpoints
+}
+
+// openAPIPath returns the path of a handler on a route matching pattern. A
+// wildcard pattern covering the handler's usual path, like /v1/*, stands
+// for that path.
+func openAPIPath(pattern, kind string) string {
+	base, wildcard := strings.CutSuffix(pattern, "*")
+	base = strings.TrimSuffix(base, "/")
+	if !wildcard {
+		return pattern
+	}
+	if usual := openAPIDefaultPaths[kind]; usual == base || strings.HasPrefix(usual, base+"/") {
+		return usual
+	}
+	if base == "" {
+		return "/"
+	}
+	return base
+}
+
+// matchedPaths returns the patterns of a route's path matchers, leaving out
+// those with wildcards other than a trailing one
+func matchedPaths(sets caddyhttp.MatcherSets) []string {
+	var paths []string
+	for _, set := range sets {
+		for _, matcher := range set {
+			var patterns []string
+			switch m := matcher.(type) {
+			case caddyhttp.MatchPath:
+				patterns = m
+			case *caddyhttp.MatchPath:
+				patterns = *m
+			}
+			for _, pattern := range patterns {
+				if strings.ContainsAny(strings.TrimSuffix(pattern, "*"), "*?[") {
+					continue
+				}
+				paths = append(paths, pattern)
+			}
+		}
+	}
+	return paths
+}
+
+// openAPIKind returns the kind of a router handler, empty for other handlers
+func openAPIKind(h caddyhttp.MiddlewareHandler) string {
+	switch h.(type) {
+	case *ChatCompletionsModule:
+		return services.OpenAPIChatCompletions
+	case *EmbeddingsModule:
+		return services.OpenAPIEmbeddings
+	case *ListModelsModule:
+		return services.OpenAPIListModels
+	case *PartialResponsesModule:
+		return services.OpenAPIPartialResponses
+	case *PromptsModule:
+		return services.OpenAPIPrompts
+	case *APIKeysModule:
+		return services.OpenAPIAPIKeys
+	case *EvalsModule:
+		return services.OpenAPIEvals
+	case *LeaderboardModule:
+		return services.OpenAPILeaderboard
+	case *StatsModule:
+		return services.OpenAPIStats
+	case *DataModule:
+		return services.OpenAPIData
+	case *DebugModule:
+		return services.OpenAPIDebug
+	case *VersionModule:
+		return services.OpenAPIVersion
+	}
+	return ""
+}
+
+var (
+	_ caddy.Provisioner           = (*OpenAPIModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*OpenAPIModule)(nil)
+)
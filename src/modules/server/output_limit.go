@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// outputLimitKey carries the policy output token limit in the request context
+type outputLimitKey struct{}
+
+// outputLimiter truncates a Chat Completions stream once the estimated output
+// reaches the policy's max_output_tokens_limit, whatever the provider does.
+// Each choice of a stream with n > 1 has its own count, like max_tokens.
+type outputLimiter struct {
+	limit    int
+	choices  int
+	used     map[int]int
+	finished map[int]bool
+}
+
+// newOutputLimiter returns nil when no limit applies
+func newOutputLimiter(limit, choices int) *outputLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &outputLimiter{limit: limit, choices: max(choices, 1), used: map[int]int{}, finished: map[int]bool{}}
+}
+
+// apply counts the chunk's generated text per choice and, once a choice
+// reaches the limit, cuts it at the limit and marks it finish_reason=length;
+// later deltas of the choice are dropped. done reports that the stream must
+// end after this chunk, every choice being finished.
+func (l *outputLimiter) apply(chunk styles.PartialJSON) (styles.PartialJSON, bool) {
+	if l == nil || chunk == nil {
+		return chunk, false
+	}
+
+	var choices []map[string]json.RawMessage
+	if raw, ok := chunk["choices"]; !ok || json.Unmarshal(raw, &choices) != nil || len(choices) == 0 {
+		return chunk, false
+	}
+
+	changed := false
+	kept := choices[:0]
+	for _, choice := range choices {
+		var index int
+		_ = json.Unmarshal(choice["index"], &index)
+		if l.finished[index] {
+			changed = true
+			continue
+		}
+		if l.cut(index, choice) {
+			l.finished[index] = true
+			changed = true
+		}
+		kept = append(kept, choice)
+	}
+
+	if !changed {
+		return chunk, false
+	}
+	done := len(l.finished) >= l.choices
+	if len(kept) == 0 {
+		return nil, done
+	}
+	out := chunk.Clone()
+	if err := out.Set("choices", kept); err != nil {
+		return chunk, false
+	}
+	return out, done
+}
+
+// cut counts the delta of a choice and, once the choice reaches the limit,
+// truncates the delta and sets the finish reason, reporting whether it did
+func (l *outputLimiter) cut(index int, choice map[string]json.RawMessage) bool {
+	var delta map[string]json.RawMessage
+	if raw, ok := choice["delta"]; !ok || json.Unmarshal(raw, &delta) != nil {
+		return false
+	}
+
+	done := false
+	for _, field := range []string{"reasoning_content", "content"} {
+		var text string
+		if raw, ok := delta[field]; !ok || json.Unmarshal(raw, &text) != nil || text == "" {
+			continue
+		}
+		if done {
+			delete(delta, field)
+			continue
+		}
+		tokens := services.EstimateTokens(text)
+		if l.used[index]+tokens < l.limit {
+			l.used[index] += tokens
+			continue
+		}
+		text = services.TruncateToTokens(text, l.limit-l.used[index])
+		l.used[index] = l.limit
+		done = true
+		delta[field], _ = json.Marshal(text)
+	}
+
+	if toolCalls, ok := delta["tool_calls"]; ok && !done {
+		var calls []styles.ChatCompletionsToolCall
+		if json.Unmarshal(toolCalls, &calls) == nil {
+			for _, call := range calls {
+				if call.Function != nil {
+					l.used[index] += services.EstimateTokens(call.Function.Arguments)
+				}
+			}
+			done = l.used[index] >= l.limit
+		}
+	}
+
+	if !done {
+		return false
+	}
+	choice["delta"], _ = json.Marshal(delta)
+	choice["finish_reason"], _ = json.Marshal("length")
+	return true
+}
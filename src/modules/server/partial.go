@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// PartialResponsesModule serves what streams generated before their clients
+// disconnected, under the trace ID the stream's X-Trace-Id header named:
+//
+//	GET /v1/responses/partial/{trace_id}
+//
+// Requests authenticate like chat completions; a response kept for a key is
+// only served to that key.
+type PartialResponsesModule struct {
+	RouterName string `json:"router,omitempty"`
+	logger     *zap.Logger
+}
+
+func ParsePartialResponsesModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m PartialResponsesModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "router":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.RouterName = h.Val()
+			default:
+				return nil, h.Errf("unrecognized ai_partial_responses option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*PartialResponsesModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_partial_responses",
+		New: func() caddy.Module { return new(PartialResponsesModule) },
+	}
+}
+
+func (m *PartialResponsesModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	return nil
+}
+
+func (m *PartialResponsesModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	router, ok := modules.GetRouter(m.RouterName)
+	if !ok {
+		m.logger.Error("Router not found", zap.String("name", m.RouterName))
+		http.Error(w, "Router not found", http.StatusInternalServerError)
+		return nil
+	}
+	if router.Impl.Partials == nil {
+		http.Error(w, "partial responses are not enabled", http.StatusNotFound)
+		return nil
+	}
+
+	// The last path segment names the trace; handle_path may already have
+	// stripped the prefix
+	traceID := strings.Trim(r.URL.Path, "/")
+	if i := strings.LastIndex(traceID, "/"); i >= 0 {
+		traceID = traceID[i+1:]
+	}
+	if traceID == "" || traceID == "partial" {
+		http.Error(w, "trace ID is required", http.StatusBadRequest)
+		return nil
+	}
+
+	r, err := router.Impl.Auth.CollectIncomingAuth(r)
+	if err != nil {
+		m.logger.Error("failed to collect incoming auth", zap.Error(err))
+		http.Error(w, "authentication error", http.StatusUnauthorized)
+		return nil
+	}
+	r = router.Identity.Apply(r)
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+
+	res, err := router.Impl.Partials.Get(traceID, keyID)
+	switch {
+	case errors.Is(err, services.ErrPartialNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil
+	case err != nil:
+		m.logger.Error("partial responses state store error", zap.Error(err))
+		http.Error(w, "failed to load partial response", http.StatusInternalServerError)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res)
+}
+
+// savePartial keeps what a stream generated before its client disconnected
+func savePartial(logger *zap.Logger, router *services.RouterService, r *http.Request, accum *services.StreamAccumulator) {
+	if router == nil || router.Partials == nil || accum == nil {
+		return
+	}
+	trace, ok := plugin.TraceFromContext(r.Context())
+	if !ok {
+		return
+	}
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	now := time.Now()
+	created := accum.FirstChunk()
+	if created.IsZero() {
+		created = now
+	}
+	err := router.Partials.Save(keyID, &services.PartialResponse{
+		ID:        trace.ID,
+		Created:   created.Unix(),
+		Model:     accum.Model(),
+		Choices:   accum.Choices(),
+		AbortedAt: now.Unix(),
+	})
+	if err != nil {
+		logger.Error("partial responses state store error", zap.Error(err))
+		return
+	}
+	logger.Debug("kept partial response of disconnected client", zap.String("trace_id", trace.ID))
+}
+
+var (
+	_ caddy.Provisioner           = (*PartialResponsesModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*PartialResponsesModule)(nil)
+)
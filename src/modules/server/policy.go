@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// clientPolicyKey carries the router's policy resolved for the request's
+// client in the request context, so nested invocations use it as well
+type clientPolicyKey struct{}
+
+// requestClient returns the address and country of a request's client. The
+// address is Caddy's client IP, which honors the server's trusted_proxies.
+func requestClient(router *modules.RouterModule, r *http.Request) services.PolicyClient {
+	address, _ := caddyhttp.GetVar(r.Context(), caddyhttp.ClientIPVarKey).(string)
+	if address == "" {
+		address, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	ip, _ := netip.ParseAddr(address)
+	return services.PolicyClient{IP: ip, Country: router.Impl.GeoIP.Country(r, ip)}
+}
+
+// withClientPolicy returns the request carrying the router's policy resolved
+// for its client
+func withClientPolicy(router *modules.RouterModule, r *http.Request) *http.Request {
+	policy := router.Impl.Policy.ForClient(requestClient(router, r))
+	return r.WithContext(context.WithValue(r.Context(), clientPolicyKey{}, policy))
+}
+
+// requestPolicy returns the policy of a request: the router's, resolved for
+// the client once withClientPolicy ran
+func requestPolicy(router *modules.RouterModule, r *http.Request) *services.Policy {
+	if policy, ok := r.Context().Value(clientPolicyKey{}).(*services.Policy); ok {
+		return policy
+	}
+	return router.Impl.Policy
+}
+
+// takeClientRateLimits counts a client request against the policy's
+// per-client rate limits, reporting false when it answered the request
+// itself with 429
+func takeClientRateLimits(logger *zap.Logger, router *modules.RouterModule, policy *services.Policy, w http.ResponseWriter, keyID string, reqJson styles.PartialJSON) bool {
+	limits := policy.ClientRateLimits(keyID, reqJson)
+	if len(limits) == 0 {
+		return true
+	}
+	allowed, wait, err := router.Impl.RateLimits.TakeLimits(limits, time.Now())
+	if err != nil {
+		// A failing state store must not take the router down with it
+		logger.Error("rate limit state store error", zap.Error(err))
+		return true
+	}
+	if !allowed {
+		logger.Debug("client rate limited by policy", zap.String("key_id", keyID), zap.Duration("retry_after", wait))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// filterAllowedProviders returns the providers the request's policy allows,
+// failing when none is. Providers outside the policy's choice are never sent
+// the request; virtual providers only pass it on to others.
+func filterAllowedProviders(router *modules.RouterModule, r *http.Request, reqJson styles.PartialJSON, providers []string, model string) ([]string, error) {
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	allowed := requestPolicy(router, r).AllowedProviders(keyID, reqJson)
+	if allowed == nil || len(providers) == 0 {
+		return providers, nil
+	}
+	// The order may be the router's own, so it is filtered in a copy
+	providers = slices.DeleteFunc(slices.Clone(providers), func(name string) bool {
+		p, ok := router.ProviderConfigs[name]
+		return !slices.Contains(allowed, name) && !(ok && p.Impl.Style == styles.StyleVirtual)
+	})
+	if len(providers) == 0 {
+		return nil, &services.PolicyError{Status: http.StatusForbidden, Message: fmt.Sprintf("no provider of model %s is allowed by policy", model)}
+	}
+	return providers, nil
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// PromptsModule serves the CRUD endpoints of a router's prompt library:
+//
+//	GET    /v1/prompts                 latest version of every prompt
+//	POST   /v1/prompts                 create a prompt ({"id"?, "description"?, "messages"})
+//	GET    /v1/prompts/{id}            latest version, or ?version=N
+//	GET    /v1/prompts/{id}/versions   every version
+//	POST   /v1/prompts/{id}            save a new version
+//	DELETE /v1/prompts/{id}            delete the prompt with its versions
+type PromptsModule struct {
+	RouterName string `json:"router,omitempty"`
+	logger     *zap.Logger
+}
+
+// promptBody is the body of the create and update endpoints
+type promptBody struct {
+	ID          string            `json:"id"`
+	Description string            `json:"description"`
+	Messages    []json.RawMessage `json:"messages"`
+}
+
+func ParsePromptsModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m PromptsModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "router":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.RouterName = h.Val()
+			default:
+				return nil, h.Errf("unrecognized ai_prompts option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*PromptsModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_prompts",
+		New: func() caddy.Module { return new(PromptsModule) },
+	}
+}
+
+func (m *PromptsModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	return nil
+}
+
+func (m *PromptsModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	router, ok := modules.GetRouter(m.RouterName)
+	if !ok {
+		m.logger.Error("Router not found", zap.String("name", m.RouterName))
+		http.Error(w, "Router not found", http.StatusInternalServerError)
+		return nil
+	}
+	library := router.Impl.Prompts
+
+	// The path below .../prompts names the prompt and, optionally, its
+	// versions; handle_path may already have stripped the prefix
+	rest := r.URL.Path
+	if _, after, found := strings.Cut(rest, "/prompts"); found && (after == "" || after[0] == '/') {
+		rest = after
+	}
+	id, sub, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		prompts, err := library.List()
+		m.writeResult(w, http.StatusOK, map[string]any{"object": "list", "data": prompts}, err)
+	case id == "" && r.Method == http.MethodPost:
+		body, ok := m.readBody(w, r)
+		if ok {
+			prompt, err := library.Save(body.ID, body.Description, body.Messages)
+			m.writeResult(w, http.StatusCreated, prompt, err)
+		}
+	case sub == "versions" && r.Method == http.MethodGet:
+		versions, err := library.Versions(id)
+		m.writeResult(w, http.StatusOK, map[string]any{"object": "list", "data": versions}, err)
+	case sub != "":
+		http.Error(w, "not found", http.StatusNotFound)
+	case r.Method == http.MethodGet:
+		version := 0
+		if v := r.URL.Query().Get("version"); v != "" {
+			var err error
+			if version, err = strconv.Atoi(v); err != nil || version <= 0 {
+				http.Error(w, "invalid version", http.StatusBadRequest)
+				return nil
+			}
+		}
+		prompt, err := library.Get(id, version)
+		m.writeResult(w, http.StatusOK, prompt, err)
+	case r.Method == http.MethodPost:
+		body, ok := m.readBody(w, r)
+		if ok {
+			prompt, err := library.Save(id, body.Description, body.Messages)
+			m.writeResult(w, http.StatusOK, prompt, err)
+		}
+	case r.Method == http.MethodDelete:
+		err := library.Delete(id)
+		m.writeResult(w, http.StatusOK, map[string]any{"id": id, "object": "prompt.deleted", "deleted": true}, err)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+	return nil
+}
+
+// readBody decodes a prompt body, answering 400 when it is invalid
+func (m *PromptsModule) readBody(w http.ResponseWriter, r *http.Request) (*promptBody, bool) {
+	var body promptBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return nil, false
+	}
+	return &body, true
+}
+
+// writeResult writes a library result as JSON, or the error of a failed call:
+// 404 for unknown prompts, 400 for rejected input
+func (m *PromptsModule) writeResult(w http.ResponseWriter, status int, result any, err error) {
+	switch {
+	case errors.Is(err, services.ErrPromptNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		m.logger.Debug("prompt library request failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+var (
+	_ caddy.Provisioner           = (*PromptsModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*PromptsModule)(nil)
+)
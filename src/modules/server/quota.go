@@ -0,0 +1,40 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// takeQuota counts a client request against its plan and sets the quota
+// headers, reporting false when it answered the request itself: 403 for
+// models outside the plan's tiers, 429 once the plan is used up.
+func takeQuota(logger *zap.Logger, quotas *services.Quotas, w http.ResponseWriter, tenant, keyID string, reqJson styles.PartialJSON) bool {
+	now := time.Now()
+	status, err := quotas.Take(tenant, keyID, reqJson, now)
+	var perr *services.PolicyError
+	switch {
+	case errors.As(err, &perr):
+		logger.Debug("model not in plan", zap.String("key_id", keyID), zap.String("tenant", tenant), zap.Error(err))
+		http.Error(w, err.Error(), perr.Status)
+		return false
+	case err != nil:
+		// A failing state store must not take the router down with it
+		logger.Error("quota state store error", zap.Error(err))
+		return true
+	}
+	status.SetHeaders(w.Header())
+	if status != nil && status.Exceeded != "" {
+		logger.Debug("quota exceeded", zap.String("key_id", keyID), zap.String("tenant", tenant),
+			zap.String("plan", status.Plan), zap.String("exceeded", status.Exceeded))
+		w.Header().Set("Retry-After", strconv.Itoa(int(status.Reset.Sub(now).Seconds())+1))
+		http.Error(w, "monthly "+status.Exceeded+" quota of plan "+status.Plan+" exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
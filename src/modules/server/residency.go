@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// residencyKey carries a request's residency requirements ([][]string) in
+// the request context, so nested invocations keep them
+type residencyKey struct{}
+
+// withResidency returns the request carrying its residency requirements:
+// the policy's, the key's as set by the auth manager, and the client's
+// services.ResidencyHeader
+func withResidency(router *modules.RouterModule, r *http.Request, keyID string, reqJson styles.PartialJSON) (*http.Request, error) {
+	requirements := requestPolicy(router, r).Residency(keyID, reqJson)
+	if regions, _ := r.Context().Value(plugin.ContextResidency()).([]string); len(regions) > 0 {
+		requirements = append(requirements, regions)
+	}
+	if header := r.Header.Get(services.ResidencyHeader); header != "" {
+		regions, err := services.ParseResidency(header)
+		if err != nil {
+			return r, errs.Wrap(errs.ErrInvalidRequest, err)
+		}
+		if len(regions) > 0 {
+			requirements = append(requirements, regions)
+		}
+	}
+	if len(requirements) == 0 {
+		return r, nil
+	}
+	return r.WithContext(context.WithValue(r.Context(), residencyKey{}, requirements)), nil
+}
+
+// filterResidency returns the providers meeting the request's residency
+// requirements, failing when none does. Virtual providers are kept: they
+// only pass requests on to providers that are checked in turn.
+func filterResidency(router *modules.RouterModule, r *http.Request, providers []string, model string) ([]string, error) {
+	requirements, _ := r.Context().Value(residencyKey{}).([][]string)
+	if len(requirements) == 0 || len(providers) == 0 {
+		return providers, nil
+	}
+	var excluded []string
+	// The order may be the router's own, so it is filtered in a copy
+	kept := slices.DeleteFunc(slices.Clone(providers), func(name string) bool {
+		p, ok := router.ProviderConfigs[name]
+		if !ok || p.Impl.Style == styles.StyleVirtual || p.Impl.MeetsResidency(requirements) {
+			return false
+		}
+		regions := "untagged"
+		if len(p.Impl.Regions) > 0 {
+			regions = strings.Join(p.Impl.Regions, ", ")
+		}
+		excluded = append(excluded, fmt.Sprintf("%s (%s)", name, regions))
+		return true
+	})
+	if len(kept) == 0 {
+		required := make([]string, len(requirements))
+		for i, regions := range requirements {
+			required[i] = strings.Join(regions, " or ")
+		}
+		return nil, &services.PolicyError{
+			Status: http.StatusForbidden,
+			Message: fmt.Sprintf("no provider of model %s meets the data residency requirement %s; excluded: %s",
+				model, strings.Join(required, " and "), strings.Join(excluded, ", ")),
+		}
+	}
+	return kept, nil
+}
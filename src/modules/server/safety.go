@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// safetyLevelKey carries the request's safety level in the request context
+type safetyLevelKey struct{}
+
+// safetyLevel returns the safety level of a request: the strictest of the
+// policy's level and the one the client asks for with SafetyHeader, which
+// can tighten the policy but never relax it
+func safetyLevel(router *modules.RouterModule, keyID string, reqJson styles.PartialJSON, r *http.Request) (string, error) {
+	level := requestPolicy(router, r).SafetyLevel(keyID, reqJson)
+	if requested := strings.ToLower(strings.TrimSpace(r.Header.Get(services.SafetyHeader))); requested != "" {
+		if !services.ValidSafetyLevel(requested) {
+			return "", errs.Errorf(errs.ErrInvalidRequest, "unknown %s '%s' (supported: off, relaxed, standard, strict)", services.SafetyHeader, requested)
+		}
+		level = services.StricterSafety(level, requested)
+	}
+	return level, nil
+}
+
+// safetyCaller identifies the caller to providers tracking abuse per user:
+// the end user when known, else the key
+func safetyCaller(r *http.Request) string {
+	if userID, _ := r.Context().Value(plugin.ContextUserID()).(string); userID != "" {
+		return userID
+	}
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	return keyID
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"go.uber.org/zap"
+)
+
+// defaultStatsRange is the time range of requests without ?from=
+const defaultStatsRange = time.Hour
+
+// statsFingerprints is the number of prompt fingerprints in stats responses
+const statsFingerprints = 20
+
+// StatsModule serves a router's request, error, token and cost time series
+// per provider and model, for dashboards reading JSON such as Grafana's JSON
+// API datasource:
+//
+//	GET /admin/stats.json[?from=&to=&step=&provider=&model=]
+//
+// from and to are Unix milliseconds, as Grafana's ${__from} and ${__to}, or
+// RFC 3339 times; step is a duration or milliseconds (default: 1m).
+type StatsModule struct {
+	RouterName string `json:"router,omitempty"`
+	logger     *zap.Logger
+}
+
+// statsTotals sums the rows of a stats response, for single-value panels
+type statsTotals struct {
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Tokens       int     `json:"tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+func ParseStatsModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m StatsModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "router":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				m.RouterName = h.Val()
+			default:
+				return nil, h.Errf("unrecognized ai_stats option '%s'", h.Val())
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (*StatsModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_stats",
+		New: func() caddy.Module { return new(StatsModule) },
+	}
+}
+
+func (m *StatsModule) Provision(ctx caddy.Context) error {
+	m.logger = ctx.Logger(m)
+	return nil
+}
+
+func (m *StatsModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	router, ok := modules.GetRouter(m.RouterName)
+	if !ok {
+		m.logger.Error("Router not found", zap.String("name", m.RouterName))
+		http.Error(w, "Router not found", http.StatusInternalServerError)
+		return nil
+	}
+
+	query := r.URL.Query()
+	to, ok := parseStatsTime(query.Get("to"), time.Now())
+	if !ok {
+		http.Error(w, "invalid to, expected Unix milliseconds or an RFC 3339 time", http.StatusBadRequest)
+		return nil
+	}
+	from, ok := parseStatsTime(query.Get("from"), to.Add(-defaultStatsRange))
+	if !ok || !from.Before(to) {
+		http.Error(w, "invalid from, expected Unix milliseconds or an RFC 3339 time before to", http.StatusBadRequest)
+		return nil
+	}
+	step := time.Minute
+	if v := query.Get("step"); v != "" {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			step = time.Duration(ms) * time.Millisecond
+		} else if step, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "invalid step, expected a duration or milliseconds", http.StatusBadRequest)
+			return nil
+		}
+	}
+	// Steps are whole minutes, the resolution of the aggregates
+	step = max(step.Truncate(time.Minute), time.Minute)
+
+	provider, model := query.Get("provider"), query.Get("model")
+	rows := []services.StatsRow{}
+	var totals statsTotals
+	for _, row := range router.Impl.Metrics.Stats(from, to, step) {
+		if (provider != "" && row.Provider != provider) || (model != "" && row.Model != model) {
+			continue
+		}
+		rows = append(rows, row)
+		totals.Requests += row.Requests
+		totals.Errors += row.Errors
+		totals.InputTokens += row.InputTokens
+		totals.OutputTokens += row.OutputTokens
+		totals.Tokens += row.Tokens
+		totals.Cost += row.Cost
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"object": "stats",
+		"from":   from.UnixMilli(),
+		"to":     to.UnixMilli(),
+		"step":   step.String(),
+		"rows":   rows,
+		"totals": totals,
+		// The prompts sent most often in the last hour, from the fingerprint plugin
+		"fingerprints": router.Impl.Fingerprints.Top(statsFingerprints, services.FingerprintRetention, time.Now()),
+	})
+	return nil
+}
+
+// parseStatsTime parses Unix milliseconds or an RFC 3339 time, returning
+// fallback for an empty value
+func parseStatsTime(value string, fallback time.Time) (time.Time, bool) {
+	if value == "" {
+		return fallback, true
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, err == nil
+}
+
+var (
+	_ caddy.Provisioner           = (*StatsModule)(nil)
+	_ caddyhttp.MiddlewareHandler = (*StatsModule)(nil)
+)
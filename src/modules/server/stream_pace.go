@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// streamRateKey carries the policy stream pace, in tokens per second, in the
+// request context
+type streamRateKey struct{}
+
+// chunkTokens estimates the tokens a Chat Completions stream chunk delivers:
+// generated text, reasoning and tool call arguments of every choice
+func chunkTokens(chunk styles.PartialJSON) int {
+	var choices []struct {
+		Delta struct {
+			Content          string                           `json:"content"`
+			ReasoningContent string                           `json:"reasoning_content"`
+			Refusal          string                           `json:"refusal"`
+			ToolCalls        []styles.ChatCompletionsToolCall `json:"tool_calls"`
+		} `json:"delta"`
+	}
+	raw, ok := chunk["choices"]
+	if !ok || json.Unmarshal(raw, &choices) != nil {
+		return 0
+	}
+	tokens := 0
+	for _, c := range choices {
+		tokens += services.EstimateTokens(c.Delta.Content) +
+			services.EstimateTokens(c.Delta.ReasoningContent) +
+			services.EstimateTokens(c.Delta.Refusal)
+		for _, call := range c.Delta.ToolCalls {
+			if call.Function != nil {
+				tokens += services.EstimateTokens(call.Function.Arguments)
+			}
+		}
+	}
+	return tokens
+}
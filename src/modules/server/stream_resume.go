@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/modules"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// resumeKey carries the *streamResume of a client request in the request
+// context
+type resumeKey struct{}
+
+// streamResume pins the streams serving a request to it: tokens are issued
+// for the request's hash, with the content it resumed from, if any, ahead of
+// what the failed stream added
+type streamResume struct {
+	requestHash string
+	prefix      string
+}
+
+// withStreamResume prepares a client request for stream resumption. A
+// request carrying a resume token continues the answer the token names.
+func withStreamResume(router *modules.RouterModule, r *http.Request, reqJson styles.PartialJSON) (*http.Request, styles.PartialJSON, error) {
+	token := styles.TryGetFromPartialJSON[string](reqJson, services.ResumeTokenField)
+	resume := router.Impl.Resume
+	if resume == nil {
+		if _, ok := reqJson[services.ResumeTokenField]; ok {
+			return r, nil, errs.Errorf(errs.ErrInvalidRequest, "stream resumption is not enabled")
+		}
+		return r, reqJson, nil
+	}
+	state := &streamResume{requestHash: services.ResumeRequestHash(reqJson)}
+	if token != "" {
+		content, err := resume.Redeem(token, state.requestHash, time.Now())
+		if errors.Is(err, services.ErrResumeExpired) {
+			return r, nil, &services.PolicyError{Status: http.StatusGone, Message: err.Error()}
+		}
+		if err != nil {
+			return r, nil, err
+		}
+		if reqJson, err = services.ResumeRequest(reqJson, content); err != nil {
+			return r, nil, err
+		}
+		state.prefix = content
+	} else {
+		delete(reqJson, services.ResumeTokenField)
+	}
+	return r.WithContext(context.WithValue(r.Context(), resumeKey{}, state)), reqJson, nil
+}
+
+// streamContent collects the text a stream delivered, for its resume token.
+// Only single-choice text answers can be resumed: tool calls or several
+// choices make the stream unresumable.
+type streamContent struct {
+	state  *streamResume
+	text   strings.Builder
+	broken bool
+}
+
+// newStreamContent returns the collector of a stream, nil when the request
+// cannot be resumed
+func newStreamContent(r *http.Request) *streamContent {
+	state, _ := r.Context().Value(resumeKey{}).(*streamResume)
+	if state == nil {
+		return nil
+	}
+	c := &streamContent{state: state}
+	c.text.WriteString(state.prefix)
+	return c
+}
+
+// add collects the content of a Chat Completions stream chunk
+func (c *streamContent) add(chunk styles.PartialJSON) {
+	if c == nil || c.broken || chunk == nil {
+		return
+	}
+	var choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Content   string          `json:"content"`
+			ToolCalls json.RawMessage `json:"tool_calls"`
+		} `json:"delta"`
+	}
+	raw, ok := chunk["choices"]
+	if !ok || json.Unmarshal(raw, &choices) != nil {
+		return
+	}
+	for _, choice := range choices {
+		if choice.Index != 0 || (len(choice.Delta.ToolCalls) > 0 && string(choice.Delta.ToolCalls) != "null") {
+			c.broken = true
+			return
+		}
+		c.text.WriteString(choice.Delta.Content)
+	}
+}
+
+// token returns the resume token of the stream's failure, "" when it cannot
+// be resumed
+func (c *streamContent) token(router *services.RouterService, r *http.Request) string {
+	if c == nil || c.broken || c.text.Len() == 0 || router.Resume == nil {
+		return ""
+	}
+	trace, ok := plugin.TraceFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	token, err := router.Resume.Issue(trace.ID, c.state.requestHash, c.text.String(), time.Now())
+	if err != nil {
+		return ""
+	}
+	return token
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// recordUsage counts the usage of an upstream call against the plan of the
+// request's key and adds it to the router's usage ledger. Nested plugin
+// calls are counted for the client request's key too.
+func recordUsage(logger *zap.Logger, router *services.RouterService, r *http.Request, provider, model string, usage styles.ChatCompletionsUsage) {
+	if router == nil || (router.Quotas == nil && router.Usage == nil) {
+		return
+	}
+	tokens := usage.TotalTokens
+	if tokens == 0 {
+		tokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	tenant, ok := r.Context().Value(plugin.ContextTenantID()).(string)
+	if !ok {
+		tenant, _, _ = strings.Cut(keyID, ":")
+	}
+	now := time.Now()
+
+	if err := router.Quotas.AddTokens(tenant, keyID, tokens, now); err != nil {
+		logger.Error("quota state store error", zap.Error(err))
+	}
+	totals := services.UsageTotals{
+		Requests:     1,
+		InputTokens:  int64(usage.PromptTokens),
+		OutputTokens: int64(tokens - usage.PromptTokens),
+	}
+	if price, ok := services.LookupModelPrice(provider, model); ok {
+		input, output := price.UsageCost(usage)
+		totals.Cost = input + output
+	}
+	if err := router.Usage.Record(tenant, totals, now); err != nil {
+		logger.Error("usage ledger state store error", zap.Error(err))
+	}
+}
+
+// responseUsage returns the usage of a response or stream chunk, zero when
+// it has none
+func responseUsage(resJson styles.PartialJSON) styles.ChatCompletionsUsage {
+	usage := styles.TryGetFromPartialJSON[*styles.ChatCompletionsUsage](resJson, "usage")
+	if usage == nil {
+		return styles.ChatCompletionsUsage{}
+	}
+	return *usage
+}
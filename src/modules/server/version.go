@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// VersionModule serves the build of the running router, for checking what
+// a deployment runs:
+//
+//	GET /version
+//
+// It reports the router's version and commit, the Caddy and Go versions,
+// the platform, and the router's Caddy modules and plugins compiled in.
+type VersionModule struct{}
+
+func ParseVersionModule(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m VersionModule
+	for h.Next() {
+		for h.NextBlock(0) {
+			return nil, h.Errf("unrecognized ai_version option '%s'", h.Val())
+		}
+	}
+	return &m, nil
+}
+
+func (*VersionModule) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ai_version",
+		New: func() caddy.Module { return new(VersionModule) },
+	}
+}
+
+func (m *VersionModule) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	var routerModules []string
+	for _, id := range caddy.Modules() {
+		if id == "ai" || strings.HasPrefix(id, "http.handlers.ai_") {
+			routerModules = append(routerModules, id)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(struct {
+		services.BuildInfo
+		Object  string   `json:"object"`
+		Modules []string `json:"modules"`
+		Plugins []string `json:"plugins"`
+	}{
+		BuildInfo: services.ReadBuildInfo(),
+		Object:    "version",
+		Modules:   routerModules,
+		Plugins:   slices.Sorted(maps.Keys(plugin.Registry)),
+	})
+}
+
+var _ caddyhttp.MiddlewareHandler = (*VersionModule)(nil)
@@ -0,0 +1,82 @@
+package modules
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// StageLimitsConfig configures the router's guards on plugin and conversion
+// stages (see services.StageLimits); zero values disable a limit
+type StageLimitsConfig struct {
+	MaxRequestBytes   int            `json:"max_request_bytes,omitempty"`
+	MaxResponseBytes  int            `json:"max_response_bytes,omitempty"`
+	MaxPluginTime     caddy.Duration `json:"max_plugin_time,omitempty"`
+	MaxConversionTime caddy.Duration `json:"max_conversion_time,omitempty"`
+}
+
+// impl returns the runtime limits, nil when none are configured
+func (c *StageLimitsConfig) impl() *services.StageLimits {
+	if c == nil || *c == (StageLimitsConfig{}) {
+		return nil
+	}
+	return &services.StageLimits{
+		MaxRequestBytes:   c.MaxRequestBytes,
+		MaxResponseBytes:  c.MaxResponseBytes,
+		MaxPluginTime:     time.Duration(c.MaxPluginTime),
+		MaxConversionTime: time.Duration(c.MaxConversionTime),
+	}
+}
+
+// parseStageLimitsBlock parses the `stage_limits { ... }` block of `ai_router`:
+//
+//	stage_limits {
+//		max_request_bytes 2000000
+//		max_response_bytes 4000000
+//		max_plugin_time 5s
+//		max_conversion_time 100ms
+//	}
+func parseStageLimitsBlock(d *caddyfile.Dispenser) (*StageLimitsConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	c := &StageLimitsConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		if !d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		value := d.Val()
+		if d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "max_request_bytes", "max_response_bytes":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, d.Errf("invalid %s '%s'", opt, value)
+			}
+			if opt == "max_request_bytes" {
+				c.MaxRequestBytes = n
+			} else {
+				c.MaxResponseBytes = n
+			}
+		case "max_plugin_time", "max_conversion_time":
+			dur, err := caddy.ParseDuration(value)
+			if err != nil || dur <= 0 {
+				return nil, d.Errf("invalid %s '%s'", opt, value)
+			}
+			if opt == "max_plugin_time" {
+				c.MaxPluginTime = caddy.Duration(dur)
+			} else {
+				c.MaxConversionTime = caddy.Duration(dur)
+			}
+		default:
+			return nil, d.Errf("unrecognized stage_limits option '%s'", opt)
+		}
+	}
+	return c, nil
+}
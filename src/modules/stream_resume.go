@@ -0,0 +1,84 @@
+package modules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// StreamResumeConfig enables resume tokens in the error events of streams
+// failing midway (see services.StreamResume)
+type StreamResumeConfig struct {
+	// Store names the state store keeping streamed content (default: memory)
+	Store string `json:"store,omitempty"`
+	// Secret signs tokens, may be a secret reference (default: random per
+	// instance)
+	Secret string `json:"secret,omitempty"`
+	// TTL is how long a failed stream can be resumed (default: 10m)
+	TTL caddy.Duration `json:"ttl,omitempty"`
+}
+
+// impl returns the router's stream resumption, nil when not configured
+func (c *StreamResumeConfig) impl(router string) (*services.StreamResume, error) {
+	if c == nil {
+		return nil, nil
+	}
+	store, ok := services.LookupStateStore(c.Store)
+	if !ok {
+		return nil, fmt.Errorf("stream_resume: unknown state store '%s'", c.Store)
+	}
+	secret := services.NewResumeSecret()
+	if c.Secret != "" {
+		resolved, err := services.ResolveSecret(c.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("stream_resume: secret: %v", err)
+		}
+		secret = []byte(resolved)
+	}
+	return &services.StreamResume{
+		Store:  store,
+		Prefix: router + ":",
+		Secret: secret,
+		TTL:    time.Duration(c.TTL),
+	}, nil
+}
+
+// parseStreamResumeBlock parses the `stream_resume [{ ... }]` option of
+// `ai_router`:
+//
+//	stream_resume {
+//		store redis
+//		secret {env.RESUME_SECRET}
+//		ttl 10m
+//	}
+func parseStreamResumeBlock(d *caddyfile.Dispenser) (*StreamResumeConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	c := &StreamResumeConfig{}
+	for d.NextBlock(1) {
+		opt := d.Val()
+		args := d.RemainingArgs()
+		if len(args) != 1 {
+			return nil, d.ArgErr()
+		}
+		switch opt {
+		case "store":
+			c.Store = args[0]
+		case "secret":
+			c.Secret = args[0]
+		case "ttl":
+			dur, err := caddy.ParseDuration(args[0])
+			if err != nil {
+				return nil, d.Errf("invalid stream_resume ttl '%s': %v", args[0], err)
+			}
+			c.TTL = caddy.Duration(dur)
+		default:
+			return nil, d.Errf("unrecognized stream_resume option '%s'", opt)
+		}
+	}
+	return c, nil
+}
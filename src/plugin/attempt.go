@@ -0,0 +1,51 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Attempt tells plugins which of the providers resolved for a request is
+// being tried, so observability can label retries and Before hooks can adapt
+// the request on fallback, e.g. asking a smaller fallback model to be concise
+type Attempt struct {
+	// Number is 1 for the first provider tried and grows by one per fallback
+	Number int
+	// Total is how many providers were resolved for the request; providers
+	// skipped before being called, e.g. lacking a capability, aren't attempts
+	Total int
+	// Fallback is set once an earlier provider failed
+	Fallback bool
+}
+
+type attemptKey struct{}
+
+// WithAttempt returns a context carrying the provider attempt
+func WithAttempt(ctx context.Context, a Attempt) context.Context {
+	return context.WithValue(ctx, attemptKey{}, a)
+}
+
+// AttemptFromContext returns the provider attempt of the current handler
+// invocation; false outside the provider loop
+func AttemptFromContext(ctx context.Context) (Attempt, bool) {
+	a, ok := ctx.Value(attemptKey{}).(Attempt)
+	return a, ok
+}
+
+// AttemptOutcome is how a provider attempt ended
+type AttemptOutcome struct {
+	// Err is why the attempt failed, nil when it succeeded. Streams failing
+	// after they started count as failed, though no fallback follows.
+	Err error
+	// Res is the upstream response; nil when none was received
+	Res *http.Response
+	// Response is what the attempt produced: the complete response, or for
+	// streams the choices assembled from the chunks received so far, partial
+	// when the stream failed. Nil when nothing was received.
+	Response styles.PartialJSON
+	// Duration is how long the attempt took
+	Duration time.Duration
+}
@@ -2,8 +2,10 @@ package plugin
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
 	"github.com/neutrome-labs/open-ai-router/src/services"
 	"github.com/neutrome-labs/open-ai-router/src/styles"
 )
@@ -25,15 +27,24 @@ func (inv *CaddyModuleInvoker) InvokeHandler(w http.ResponseWriter, r *http.Requ
 }
 
 // InvokeHandlerCapture invokes the handler and captures the response instead of writing to w.
+// An error status written by the handler is returned as an *errs.StatusError;
+// a streamed response is reassembled into a complete one.
 func (inv *CaddyModuleInvoker) InvokeHandlerCapture(r *http.Request) (styles.PartialJSON, error) {
+	res, _, err := inv.InvokeHandlerCaptureHeaders(r)
+	return res, err
+}
+
+// InvokeHandlerCaptureHeaders invokes the handler and captures the response and its headers.
+func (inv *CaddyModuleInvoker) InvokeHandlerCaptureHeaders(r *http.Request) (styles.PartialJSON, http.Header, error) {
 	// Create a response capture writer
 	capture := &services.ResponseCaptureWriter{}
 	err := inv.module.ServeHTTP(capture, r, nil)
 	if err != nil {
-		return nil, err
+		return nil, capture.Headers, err
 	}
-	if capture.Response == nil {
-		return nil, nil
+	if capture.Status >= http.StatusBadRequest {
+		return nil, capture.Headers, &errs.StatusError{Status: capture.Status, Body: strings.TrimSpace(string(capture.Response)), Header: capture.Headers}
 	}
-	return styles.ParsePartialJSON(capture.Response)
+	res, err := capture.JSON()
+	return res, capture.Headers, err
 }
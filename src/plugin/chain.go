@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/neutrome-labs/open-ai-router/src/services"
 	"github.com/neutrome-labs/open-ai-router/src/styles"
@@ -32,11 +33,15 @@ func (c *PluginChain) RunBefore(p *services.ProviderService, r *http.Request, re
 	for _, pi := range c.plugins {
 		if bp, ok := pi.Plugin.(BeforePlugin); ok {
 			Logger.Debug("Running Before plugin", zap.String("plugin", pi.Plugin.Name()), zap.String("params", pi.Params))
+			start := time.Now()
 			next, err := bp.Before(pi.Params, p, r, current)
 			if err != nil {
 				Logger.Error("Before plugin failed", zap.String("plugin", pi.Plugin.Name()), zap.Error(err))
 				return nil, err
 			}
+			if err := routerOf(p).CheckStage(services.StageBefore, pi.Plugin.Name(), time.Since(start), next); err != nil {
+				return nil, err
+			}
 			current = next
 		}
 	}
@@ -51,11 +56,15 @@ func (c *PluginChain) RunAfter(p *services.ProviderService, r *http.Request, req
 	for _, pi := range c.plugins {
 		if ap, ok := pi.Plugin.(AfterPlugin); ok {
 			Logger.Debug("Running After plugin", zap.String("plugin", pi.Plugin.Name()), zap.String("params", pi.Params))
+			start := time.Now()
 			next, err := ap.After(pi.Params, p, r, reqJson, res, current)
 			if err != nil {
 				Logger.Error("After plugin failed", zap.String("plugin", pi.Plugin.Name()), zap.Error(err))
 				return nil, err
 			}
+			if err := routerOf(p).CheckStage(services.StageAfter, pi.Plugin.Name(), time.Since(start), next); err != nil {
+				return nil, err
+			}
 			current = next
 		}
 	}
@@ -68,11 +77,15 @@ func (c *PluginChain) RunAfterChunk(p *services.ProviderService, r *http.Request
 	current := chunk
 	for _, pi := range c.plugins {
 		if sp, ok := pi.Plugin.(StreamChunkPlugin); ok {
+			start := time.Now()
 			next, err := sp.AfterChunk(pi.Params, p, r, reqJson, res, current)
 			if err != nil {
 				Logger.Error("AfterChunk plugin failed", zap.String("plugin", pi.Plugin.Name()), zap.Error(err))
 				return nil, err
 			}
+			if err := routerOf(p).CheckStage(services.StageChunk, pi.Plugin.Name(), time.Since(start), next); err != nil {
+				return nil, err
+			}
 			current = next
 		}
 	}
@@ -111,6 +124,41 @@ func (c *PluginChain) RunError(p *services.ProviderService, r *http.Request, req
 	return nil
 }
 
+// RunAttemptStart executes the AttemptStart of all AttemptPlugin
+// implementations; failures are logged, they don't stop the attempt
+func (c *PluginChain) RunAttemptStart(p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON) {
+	for _, pi := range c.plugins {
+		if ap, ok := pi.Plugin.(AttemptPlugin); ok {
+			if err := ap.AttemptStart(pi.Params, p, r, reqJson); err != nil {
+				Logger.Error("AttemptStart plugin failed", zap.String("plugin", pi.Plugin.Name()), zap.Error(err))
+			}
+		}
+	}
+}
+
+// RunAttemptEnd executes the AttemptEnd of all AttemptPlugin
+// implementations; failures are logged
+func (c *PluginChain) RunAttemptEnd(p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, outcome *AttemptOutcome) {
+	for _, pi := range c.plugins {
+		if ap, ok := pi.Plugin.(AttemptPlugin); ok {
+			if err := ap.AttemptEnd(pi.Params, p, r, reqJson, outcome); err != nil {
+				Logger.Error("AttemptEnd plugin failed", zap.String("plugin", pi.Plugin.Name()), zap.Error(err))
+			}
+		}
+	}
+}
+
+// FollowsAttempts reports whether a plugin of the chain implements
+// AttemptPlugin, so attempt outcomes are worth collecting
+func (c *PluginChain) FollowsAttempts() bool {
+	for _, pi := range c.plugins {
+		if _, ok := pi.Plugin.(AttemptPlugin); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // RunRecursiveHandlers executes all RecursiveHandlerPlugin implementations.
 // Returns (true, nil) if a plugin handled the request successfully.
 // Returns (true, err) if a plugin handled the request but failed.
@@ -139,3 +187,21 @@ func (c *PluginChain) RunRecursiveHandlers(invoker HandlerInvoker, reqJson style
 func (c *PluginChain) GetPlugins() []PluginInstance {
 	return c.plugins
 }
+
+// Has reports whether a plugin with the given name is in the chain
+func (c *PluginChain) Has(name string) bool {
+	for _, pi := range c.plugins {
+		if pi.Plugin.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// routerOf returns the router of a provider, guarding against a nil provider
+func routerOf(p *services.ProviderService) *services.RouterService {
+	if p == nil {
+		return nil
+	}
+	return p.Router
+}
@@ -21,6 +21,10 @@ const (
 	traceIDKey contextKey = "trace_id"
 	userIDKey  contextKey = "user_id"
 	keyIDKey   contextKey = "key_id"
+	tenantKey  contextKey = "tenant_id"
+
+	posthogProjectKey contextKey = "posthog_project"
+	residencyKey      contextKey = "residency"
 )
 
 // ContextTraceID returns the trace ID context key
@@ -32,6 +36,18 @@ func ContextUserID() contextKey { return userIDKey }
 // ContextKeyID returns the key ID context key
 func ContextKeyID() contextKey { return keyIDKey }
 
+// ContextTenantID returns the tenant ID context key; auth managers may set it,
+// otherwise the tenant is the part of the key ID before the first ':'
+func ContextTenantID() contextKey { return tenantKey }
+
+// ContextPosthogProject returns the context key of the PostHog project a
+// request's events are sent to; auth managers may set it from key metadata
+func ContextPosthogProject() contextKey { return posthogProjectKey }
+
+// ContextResidency returns the context key of the regions ([]string) a
+// request may be processed in; auth managers may set it from key metadata
+func ContextResidency() contextKey { return residencyKey }
+
 // Plugin is the base interface for all chat completion plugins
 type Plugin interface {
 	// Name returns the plugin's identifier
@@ -50,6 +66,10 @@ type HandlerInvoker interface {
 	// Used by parallel plugin to capture multiple responses for merging.
 	// Returns the captured response on success, or error on failure.
 	InvokeHandlerCapture(r *http.Request) (styles.PartialJSON, error)
+
+	// InvokeHandlerCaptureHeaders is InvokeHandlerCapture also returning the
+	// response headers, e.g. X-Real-Provider-Id naming the provider that answered.
+	InvokeHandlerCaptureHeaders(r *http.Request) (styles.PartialJSON, http.Header, error)
 }
 
 // BeforePlugin processes requests before sending to provider
@@ -88,10 +108,24 @@ type ErrorPlugin interface {
 	Plugin
 	// OnError is called when a provider call fails
 	// res may be nil if the error occurred before receiving a response
-	// providerErr is the error returned by the provider
+	// providerErr is the error returned by the provider; a stream whose
+	// client went away or couldn't be written ends with an errs.ErrClientWrite
 	OnError(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, providerErr error) error
 }
 
+// AttemptPlugin follows every provider attempt of a request, including
+// those that failed and were followed by a fallback, e.g. for accounting
+// that must see every upstream call and not just the one that answered
+type AttemptPlugin interface {
+	Plugin
+	// AttemptStart is called once the request for a provider is ready, just
+	// before it is sent; the attempt is in the context (AttemptFromContext)
+	AttemptStart(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON) error
+	// AttemptEnd is called when the provider's answer was served or the
+	// attempt failed, with whatever it produced
+	AttemptEnd(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, outcome *AttemptOutcome) error
+}
+
 // RecursiveHandlerPlugin can intercept the request flow and invoke the handler recursively.
 // This is used for plugins that need to make multiple calls (fallback, parallel, etc.).
 // When RecursiveHandler returns handled=true, the module should not proceed with normal flow.
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"net/url"
+	"slices"
 	"strings"
 )
 
@@ -17,82 +18,83 @@ var TailPlugins = [][2]string{
 	{"posthog", ""},
 }
 
+// TryResolvePlugins builds the plugin chain of a request. Plugins run in the
+// order of their sources: virtual providers, head plugins, plugins of the URL
+// path, plugins of the model suffix, then tail plugins.
+//
+// Each plugin runs once. Head and tail plugins are set up by the router, so
+// they keep their place and params when the request names them too. A plugin
+// the request names several times keeps its first place and takes the params
+// of its last mention, the model suffix coming after the path.
 func TryResolvePlugins(url url.URL, model string) *PluginChain {
 	chain := NewPluginChain()
 
 	// Add all virtual provider plugins first (they implement RecursiveHandlerPlugin)
-	// These intercept requests targeting virtual providers
+	// These intercept requests targeting virtual providers. Sorted, as the
+	// registry is a map.
+	var virtual []string
 	for name, p := range Registry {
 		if strings.HasPrefix(name, "virtual:") {
 			if _, ok := p.(RecursiveHandlerPlugin); ok {
-				chain.Add(p, "")
+				virtual = append(virtual, name)
 			}
 		}
 	}
+	slices.Sort(virtual)
+	for _, name := range virtual {
+		chain.Add(Registry[name], "")
+	}
 
 	// Add mandatory plugins
 	for _, mp := range HeadPlugins {
-		if p, ok := GetPlugin(mp[0]); ok {
+		if p, ok := GetPlugin(mp[0]); ok && !chain.Has(mp[0]) {
 			chain.Add(p, mp[1])
 		}
 	}
 
 	// Plugins from path: /plugin1:arg1/plugin2:arg2
-	path := strings.TrimPrefix(url.Path, "/")
-	if path != "" {
-		pathParts := strings.Split(path, "/")
-		for _, part := range pathParts {
-			if part == "" {
-				continue
-			}
-			if idx := strings.IndexByte(part, ':'); idx > 0 {
-				if p, ok := GetPlugin(part[:idx]); ok {
-					chain.Add(p, part[idx+1:])
-				}
-			} else if part != "" {
-				if p, ok := GetPlugin(part); ok {
-					chain.Add(p, "")
-				}
-			}
-		}
+	var requested [][2]string
+	for _, part := range strings.Split(strings.TrimPrefix(url.Path, "/"), "/") {
+		requested = append(requested, parsePluginRef(part))
 	}
 
 	// Plugins from model suffix: model="gpt-4+plugin1:arg1+plugin2"
-	if idx := strings.IndexByte(model, '+'); idx >= 0 {
-		pluginPart := model[idx+1:]
-		for len(pluginPart) > 0 {
-			var part string
-			if nextIdx := strings.IndexByte(pluginPart, '+'); nextIdx >= 0 {
-				part = pluginPart[:nextIdx]
-				pluginPart = pluginPart[nextIdx+1:]
-			} else {
-				part = pluginPart
-				pluginPart = ""
-			}
-			if part == "" {
-				continue
-			}
-			if colonIdx := strings.IndexByte(part, ':'); colonIdx >= 0 {
-				name := part[:colonIdx]
-				if name != "" {
-					if p, ok := GetPlugin(name); ok {
-						chain.Add(p, part[colonIdx+1:])
-					}
-				}
-			} else {
-				if p, ok := GetPlugin(part); ok {
-					chain.Add(p, "")
-				}
-			}
+	requested = append(requested, ParseModelSpec(model).Plugins...)
+
+	var fromRequest []PluginInstance
+	for _, ref := range requested {
+		p, ok := GetPlugin(ref[0])
+		if !ok || chain.Has(ref[0]) || isTailPlugin(ref[0]) {
+			continue
+		}
+		if i := slices.IndexFunc(fromRequest, func(pi PluginInstance) bool { return pi.Plugin.Name() == p.Name() }); i >= 0 {
+			fromRequest[i].Params = ref[1]
+			continue
 		}
+		fromRequest = append(fromRequest, PluginInstance{Plugin: p, Params: ref[1]})
+	}
+	for _, pi := range fromRequest {
+		chain.Add(pi.Plugin, pi.Params)
 	}
 
 	// Add tail plugins
 	for _, mp := range TailPlugins {
-		if p, ok := GetPlugin(mp[0]); ok {
+		if p, ok := GetPlugin(mp[0]); ok && !chain.Has(mp[0]) {
 			chain.Add(p, mp[1])
 		}
 	}
 
 	return chain
 }
+
+// parsePluginRef splits a plugin reference "name:params" of the path or the
+// model suffix; the name is empty for empty references
+func parsePluginRef(part string) [2]string {
+	name, params, _ := strings.Cut(part, ":")
+	return [2]string{strings.TrimSpace(name), params}
+}
+
+// isTailPlugin reports whether a plugin runs among the tail plugins
+func isTailPlugin(name string) bool {
+	return slices.ContainsFunc(TailPlugins, func(mp [2]string) bool { return mp[0] == name })
+}
@@ -1,8 +1,11 @@
 package plugin_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
 	"testing"
 
 	_ "github.com/neutrome-labs/open-ai-router/src/modules"
@@ -99,6 +102,54 @@ func TestPluginChain_RunAfter(t *testing.T) {
 	}
 }
 
+// attemptRecorder records the attempts it follows
+type attemptRecorder struct {
+	started []int
+	ended   []error
+}
+
+func (a *attemptRecorder) Name() string { return "attempts" }
+
+func (a *attemptRecorder) AttemptStart(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON) error {
+	attempt, _ := plugin.AttemptFromContext(r.Context())
+	a.started = append(a.started, attempt.Number)
+	return nil
+}
+
+func (a *attemptRecorder) AttemptEnd(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, outcome *plugin.AttemptOutcome) error {
+	a.ended = append(a.ended, outcome.Err)
+	return nil
+}
+
+func TestPluginChain_RunAttempt(t *testing.T) {
+	chain := plugin.NewPluginChain()
+	p, _ := plugin.GetPlugin("models")
+	chain.Add(p, "")
+	if chain.FollowsAttempts() {
+		t.Error("expected a chain without attempt plugins not to follow attempts")
+	}
+	recorder := &attemptRecorder{}
+	chain.Add(recorder, "")
+	if !chain.FollowsAttempts() {
+		t.Error("expected the chain to follow attempts")
+	}
+
+	provider := &services.ProviderService{Name: "test"}
+	failure := errors.New("upstream down")
+	for i, err := range []error{failure, nil} {
+		httpReq := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		httpReq = httpReq.WithContext(plugin.WithAttempt(httpReq.Context(), plugin.Attempt{Number: i + 1, Total: 2, Fallback: i > 0}))
+		chain.RunAttemptStart(provider, httpReq, styles.PartialJSON{})
+		chain.RunAttemptEnd(provider, httpReq, styles.PartialJSON{}, &plugin.AttemptOutcome{Err: err})
+	}
+	if len(recorder.started) != 2 || recorder.started[1] != 2 {
+		t.Errorf("started = %v", recorder.started)
+	}
+	if len(recorder.ended) != 2 || recorder.ended[0] != failure || recorder.ended[1] != nil {
+		t.Errorf("ended = %v", recorder.ended)
+	}
+}
+
 func TestMandatoryPlugins(t *testing.T) {
 	// Verify mandatory plugins exist and are valid
 	for _, mp := range plugin.HeadPlugins {
@@ -125,3 +176,17 @@ func TestMandatoryPlugins(t *testing.T) {
 		}
 	}
 }
+
+func TestTryResolvePlugins_OrderAndDedup(t *testing.T) {
+	u, _ := url.Parse("/fuzz/stools:a/models:x")
+	chain := plugin.TryResolvePlugins(*u, "gpt-4+stools:b+posthog:leak+fuzz")
+
+	var got []string
+	for _, pi := range chain.GetPlugins() {
+		got = append(got, pi.Plugin.Name()+":"+pi.Params)
+	}
+	want := []string{"models:", "fuzz:", "stools:b", "posthog:"}
+	if !slices.Equal(got, want) {
+		t.Errorf("chain = %v, want %v", got, want)
+	}
+}
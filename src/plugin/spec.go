@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+)
+
+// ModelSpec is a request's model field taken apart: the model, or models
+// separated by ',' (fallback) or '|' (parallel), and the plugin suffix, e.g.
+// "gpt-5,gpt-4.1+zip:arg" or "gpt-4.1|claude-sonnet+fuzz". Every handler
+// module reads plugins and model lists through it. Model names escape these
+// separators with a backslash (see services.CutModelSuffix).
+type ModelSpec struct {
+	// Model is the model part, without the plugin suffix and with its escapes;
+	// services.UnescapeModel gives the model name
+	Model string
+	// Suffix is the plugin suffix with its leading '+'; empty without plugins
+	Suffix string
+	// Plugins are the plugin references of the suffix in order, as
+	// {name, params}; empty references are left out
+	Plugins [][2]string
+}
+
+// ParseModelSpec parses a request's model field. Model names may contain ':'
+// (e.g. "llama3:8b"); only an unescaped '+' starts the plugin suffix.
+func ParseModelSpec(model string) ModelSpec {
+	spec := ModelSpec{Model: model}
+	base, suffix, ok := services.CutModelSuffix(model)
+	if !ok {
+		return spec
+	}
+	spec.Model, spec.Suffix = base, "+"+suffix
+	for _, part := range services.SplitModelList(suffix, '+') {
+		if ref := parsePluginRef(services.UnescapeModel(part)); ref[0] != "" {
+			spec.Plugins = append(spec.Plugins, ref)
+		}
+	}
+	return spec
+}
+
+// Fallback returns the ','-separated models to try in turn, nil when the
+// spec names a single model. The models keep their escapes.
+func (s ModelSpec) Fallback() []string {
+	return listModels(s.Model, ',')
+}
+
+// Parallel returns the '|'-separated models to ask at once, nil when the
+// spec names a single model. The models keep their escapes.
+func (s ModelSpec) Parallel() []string {
+	return listModels(s.Model, '|')
+}
+
+// Targets returns every model the spec names, whichever the separator, as
+// model names
+func (s ModelSpec) Targets() []string {
+	var targets []string
+	for _, m := range services.SplitModelList(s.Model, ',') {
+		for _, t := range services.SplitModelList(m, '|') {
+			if t = strings.TrimSpace(t); t != "" {
+				targets = append(targets, services.UnescapeModel(t))
+			}
+		}
+	}
+	return targets
+}
+
+// listModels splits a model part at sep, dropping empty entries; nil when
+// there is no separator
+func listModels(model string, sep byte) []string {
+	parts := services.SplitModelList(model, sep)
+	if len(parts) < 2 {
+		return nil
+	}
+	var models []string
+	for _, m := range parts {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
@@ -0,0 +1,32 @@
+package plugin_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+)
+
+func TestParseModelSpec(t *testing.T) {
+	spec := plugin.ParseModelSpec("ollama/llama3:8b|gpt-4.1+zip:arg++fuzz")
+	if spec.Model != "ollama/llama3:8b|gpt-4.1" || spec.Suffix != "+zip:arg++fuzz" {
+		t.Errorf("spec = %+v", spec)
+	}
+	if want := [][2]string{{"zip", "arg"}, {"fuzz", ""}}; !slices.Equal(spec.Plugins, want) {
+		t.Errorf("Plugins = %v, want %v", spec.Plugins, want)
+	}
+	if want := []string{"ollama/llama3:8b", "gpt-4.1"}; !slices.Equal(spec.Parallel(), want) {
+		t.Errorf("Parallel = %v, want %v", spec.Parallel(), want)
+	}
+	if spec.Fallback() != nil {
+		t.Errorf("Fallback = %v, want none", spec.Fallback())
+	}
+
+	spec = plugin.ParseModelSpec("gpt-5, gpt-4.1|claude")
+	if want := []string{"gpt-5", "gpt-4.1", "claude"}; !slices.Equal(spec.Targets(), want) {
+		t.Errorf("Targets = %v, want %v", spec.Targets(), want)
+	}
+	if spec.Suffix != "" || spec.Plugins != nil {
+		t.Errorf("expected no plugins, got %+v", spec)
+	}
+}
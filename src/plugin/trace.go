@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+)
+
+// DefaultMaxDepth limits how deeply recursive plugins may re-invoke the
+// handler for one client request, unless the router sets max_depth
+const DefaultMaxDepth = 8
+
+// Trace identifies one handler invocation within a client request. Recursive
+// handler plugins re-invoke the handler with a derived request; the nested
+// invocations keep the trace ID and record their parent span, so
+// observability shows one tree per client request.
+type Trace struct {
+	// ID is shared by every invocation of the client request
+	ID string
+	// SpanID identifies this invocation
+	SpanID string
+	// ParentSpanID is the span of the invoking handler; empty for the root
+	ParentSpanID string
+	// Depth is 0 for the client request and grows by one per recursion
+	Depth int
+}
+
+type (
+	traceKey struct{}
+	hopsKey  struct{}
+)
+
+// StartTrace returns the trace of a new handler invocation: a new trace for a
+// client request, or a child span of the trace in ctx when the handler is
+// invoked by a recursive plugin
+func StartTrace(ctx context.Context) *Trace {
+	parent, ok := TraceFromContext(ctx)
+	if !ok {
+		return &Trace{ID: uuid.New().String(), SpanID: uuid.New().String()}
+	}
+	return &Trace{
+		ID:           parent.ID,
+		SpanID:       uuid.New().String(),
+		ParentSpanID: parent.SpanID,
+		Depth:        parent.Depth + 1,
+	}
+}
+
+// WithTrace returns a context carrying the trace, and its ID under
+// ContextTraceID for plugins that only need the ID
+func WithTrace(ctx context.Context, t *Trace) context.Context {
+	ctx = context.WithValue(ctx, traceKey{}, t)
+	return context.WithValue(ctx, traceIDKey, t.ID)
+}
+
+// TraceFromContext returns the trace of the current handler invocation
+func TraceFromContext(ctx context.Context) (*Trace, bool) {
+	t, ok := ctx.Value(traceKey{}).(*Trace)
+	return t, ok
+}
+
+// EnterHop records that the request passes through hop, e.g. a virtual model,
+// and returns the context for the handler invocations it makes. It fails with
+// errs.ErrLoop when an invoking handler already passed through hop.
+func EnterHop(ctx context.Context, hop string) (context.Context, error) {
+	hops, _ := ctx.Value(hopsKey{}).([]string)
+	if slices.Contains(hops, hop) {
+		return ctx, errs.Errorf(errs.ErrLoop, "loop detected: %s -> %s", strings.Join(hops, " -> "), hop)
+	}
+	return context.WithValue(ctx, hopsKey{}, append(slices.Clip(hops), hop)), nil
+}
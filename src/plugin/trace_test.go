@@ -0,0 +1,76 @@
+package plugin_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+)
+
+func TestStartTrace(t *testing.T) {
+	root := plugin.StartTrace(context.Background())
+	if root.ID == "" || root.SpanID == "" || root.ParentSpanID != "" || root.Depth != 0 {
+		t.Fatalf("unexpected root trace %+v", root)
+	}
+
+	ctx := plugin.WithTrace(context.Background(), root)
+	if id, _ := ctx.Value(plugin.ContextTraceID()).(string); id != root.ID {
+		t.Errorf("expected trace ID %s in context, got %q", root.ID, id)
+	}
+
+	child := plugin.StartTrace(ctx)
+	if child.ID != root.ID {
+		t.Errorf("expected child to keep trace ID %s, got %s", root.ID, child.ID)
+	}
+	if child.ParentSpanID != root.SpanID || child.SpanID == root.SpanID {
+		t.Errorf("expected child span under %s, got %+v", root.SpanID, child)
+	}
+	if child.Depth != 1 {
+		t.Errorf("expected depth 1, got %d", child.Depth)
+	}
+
+	grandchild := plugin.StartTrace(plugin.WithTrace(ctx, child))
+	if grandchild.Depth != 2 || grandchild.ParentSpanID != child.SpanID {
+		t.Errorf("unexpected grandchild %+v", grandchild)
+	}
+
+	if _, ok := plugin.TraceFromContext(context.Background()); ok {
+		t.Error("expected no trace in empty context")
+	}
+}
+
+func TestEnterHop(t *testing.T) {
+	ctx, err := plugin.EnterHop(context.Background(), "v/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err = plugin.EnterHop(ctx, "v/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Siblings only see the hops of their own ancestors
+	if _, err := plugin.EnterHop(context.Background(), "v/b"); err != nil {
+		t.Errorf("unexpected error for a fresh request: %v", err)
+	}
+
+	_, err = plugin.EnterHop(ctx, "v/a")
+	if !errors.Is(err, errs.ErrLoop) {
+		t.Fatalf("expected loop error, got %v", err)
+	}
+	if want := "loop detected: v/a -> v/b -> v/a"; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
+
+func TestAttemptFromContext(t *testing.T) {
+	if _, ok := plugin.AttemptFromContext(context.Background()); ok {
+		t.Error("expected no attempt in empty context")
+	}
+	ctx := plugin.WithAttempt(context.Background(), plugin.Attempt{Number: 2, Total: 3, Fallback: true})
+	if a, ok := plugin.AttemptFromContext(ctx); !ok || a.Number != 2 || a.Total != 3 || !a.Fallback {
+		t.Errorf("AttemptFromContext = %+v, %v", a, ok)
+	}
+}
@@ -0,0 +1,257 @@
+package plugins
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/extract"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"github.com/neutrome-labs/open-ai-router/src/tools"
+	"go.uber.org/zap"
+)
+
+// Attachments replaces document attachments in messages by their extracted text
+// (PDF, DOCX, HTML and plain text), for providers that don't accept file inputs.
+// Example: model="groq/llama-70b+attachments" or
+// "groq/llama-70b+attachments:fetch=true,max_chars=50000"
+//
+// Both "file" content parts ({"type":"file","file":{"filename","file_data"}})
+// and "input_file" parts are handled; file_data may be a data URL or raw base64.
+//
+// Params:
+//   - fetch: "true" to download attachments given by http(s) file_url (default: false)
+//   - max_bytes: maximum attachment size in bytes (default: 20 MiB)
+//   - max_chars: maximum extracted characters per attachment (default: 100000)
+//
+// Attachments that cannot be read are replaced by a short note.
+type Attachments struct {
+	// Client downloads file URLs; when nil, a client with a 30s timeout that
+	// only connects to public addresses is used
+	Client *http.Client
+}
+
+func (f *Attachments) Name() string { return "attachments" }
+
+// attachment is a document found in a content part
+type attachment struct {
+	filename  string
+	mediaType string
+	data      string // data URL or base64
+	url       string
+	fileID    string
+}
+
+func (f *Attachments) Before(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	opts := ParseParams(params)
+	fetch := opts["fetch"] == "true"
+	maxBytes := 20 << 20
+	if v, err := strconv.Atoi(opts["max_bytes"]); err == nil && v > 0 {
+		maxBytes = v
+	}
+	maxChars := 100000
+	if v, err := strconv.Atoi(opts["max_chars"]); err == nil && v > 0 {
+		maxChars = v
+	}
+
+	messages, err := styles.GetFromPartialJSON[[]styles.ChatCompletionsMessage](reqJson, "messages")
+	if err != nil {
+		return reqJson, err
+	}
+
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+	}
+
+	changed := false
+	for i, msg := range messages {
+		parts, ok := msg.Content.([]any)
+		if !ok {
+			continue
+		}
+		for j, part := range parts {
+			att, ok := findAttachment(part)
+			if !ok {
+				continue
+			}
+			text, err := f.extractAttachment(ctx, att, fetch, maxBytes)
+			if err != nil {
+				Logger.Warn("attachments plugin: extraction failed", zap.String("filename", att.filename), zap.Error(err))
+				text = fmt.Sprintf("[Attached file %s could not be read: %s]", att.displayName(), err)
+			} else {
+				if runes := []rune(text); len(runes) > maxChars {
+					text = string(runes[:maxChars]) + "\n[truncated]"
+				}
+				text = fmt.Sprintf("Attached file %s:\n\n%s", att.displayName(), text)
+			}
+			parts[j] = map[string]any{"type": "text", "text": text}
+			changed = true
+		}
+		messages[i].Content = parts
+	}
+
+	if !changed {
+		return reqJson, nil
+	}
+	return reqJson.CloneWith("messages", messages)
+}
+
+// findAttachment recognizes "file" and "input_file" content parts
+func findAttachment(part any) (attachment, bool) {
+	m, ok := part.(map[string]any)
+	if !ok {
+		return attachment{}, false
+	}
+	var fields map[string]any
+	switch m["type"] {
+	case "file":
+		fields, _ = m["file"].(map[string]any)
+	case "input_file":
+		fields = m
+	}
+	if fields == nil {
+		return attachment{}, false
+	}
+
+	str := func(key string) string {
+		s, _ := fields[key].(string)
+		return s
+	}
+	att := attachment{
+		filename:  str("filename"),
+		mediaType: str("mime_type"),
+		data:      str("file_data"),
+		url:       str("file_url"),
+		fileID:    str("file_id"),
+	}
+	if att.url == "" {
+		att.url = str("url")
+	}
+	return att, true
+}
+
+func (a attachment) displayName() string {
+	if a.filename != "" {
+		return a.filename
+	}
+	if a.url != "" {
+		return a.url
+	}
+	if a.fileID != "" {
+		return a.fileID
+	}
+	return "(unnamed)"
+}
+
+// extractAttachment loads the attachment's bytes and extracts their text
+func (f *Attachments) extractAttachment(ctx context.Context, att attachment, fetch bool, maxBytes int) (string, error) {
+	var data []byte
+	mediaType := att.mediaType
+	filename := att.filename
+
+	switch {
+	case att.data != "":
+		payload := att.data
+		if rest, ok := strings.CutPrefix(payload, "data:"); ok {
+			meta, encoded, found := strings.Cut(rest, ",")
+			if !found || !strings.HasSuffix(meta, ";base64") {
+				return "", fmt.Errorf("unsupported data URL")
+			}
+			if mediaType == "" {
+				mediaType = strings.TrimSuffix(meta, ";base64")
+			}
+			payload = encoded
+		}
+		if base64.StdEncoding.DecodedLen(len(payload)) > maxBytes {
+			return "", fmt.Errorf("file exceeds %d bytes", maxBytes)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return "", fmt.Errorf("invalid base64 file data")
+		}
+		data = decoded
+
+	case att.url != "":
+		if !fetch {
+			return "", fmt.Errorf("fetching file URLs is disabled")
+		}
+		fetched, contentType, err := fetchURL(ctx, f.Client, att.url, maxBytes)
+		if err != nil {
+			return "", err
+		}
+		data = fetched
+		if mediaType == "" {
+			mediaType = contentType
+		}
+		if filename == "" {
+			if u, err := url.Parse(att.url); err == nil {
+				filename = path.Base(u.Path)
+			}
+		}
+
+	case att.fileID != "":
+		return "", fmt.Errorf("uploaded file references are not supported")
+
+	default:
+		return "", fmt.Errorf("empty attachment")
+	}
+
+	return extract.Text(data, mediaType, filename)
+}
+
+// publicClient fetches URLs given by clients; it refuses to connect to
+// loopback, private and other non-public addresses, also after redirects
+var publicClient = tools.NewPublicClient(30 * time.Second)
+
+// fetchURL downloads an http(s) URL, refusing bodies larger than maxBytes.
+// It returns the body and its media type.
+func fetchURL(ctx context.Context, client *http.Client, rawURL string, maxBytes int) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, "", fmt.Errorf("unsupported URL")
+	}
+
+	if client == nil {
+		client = publicClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("download failed with status %d", res.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxBytes {
+		return nil, "", fmt.Errorf("body exceeds %d bytes", maxBytes)
+	}
+	contentType := res.Header.Get("Content-Type")
+	if parsed, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = parsed
+	}
+	return data, contentType, nil
+}
+
+var (
+	_ plugin.BeforePlugin = (*Attachments)(nil)
+)
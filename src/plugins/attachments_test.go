@@ -0,0 +1,80 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func attachmentRequest(t *testing.T, fileURL string) styles.PartialJSON {
+	t.Helper()
+	reqJson := styles.PartialJSON{}
+	_ = reqJson.Set("model", "test")
+	_ = reqJson.Set("messages", []styles.ChatCompletionsMessage{
+		{Role: "user", Content: []any{
+			map[string]any{"type": "text", "text": "Summarize this"},
+			map[string]any{"type": "input_file", "filename": "notes.txt", "file_url": fileURL},
+		}},
+	})
+	return reqJson
+}
+
+func attachmentText(t *testing.T, out styles.PartialJSON) string {
+	t.Helper()
+	messages, err := styles.GetFromPartialJSON[[]styles.ChatCompletionsMessage](out, "messages")
+	if err != nil {
+		t.Fatalf("failed to read messages: %v", err)
+	}
+	parts := messages[0].Content.([]any)
+	return parts[1].(map[string]any)["text"].(string)
+}
+
+func TestAttachments_FetchRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("internal secret"))
+	}))
+	defer server.Close()
+
+	out, err := (&Attachments{}).Before("fetch=true", nil, nil, attachmentRequest(t, server.URL+"/notes.txt"))
+	if err != nil {
+		t.Fatalf("Before returned error: %v", err)
+	}
+	text := attachmentText(t, out)
+	if strings.Contains(text, "internal secret") || !strings.Contains(text, "not public") {
+		t.Errorf("expected the loopback URL to be refused, got %q", text)
+	}
+
+	// Redirects are dialed through the same guard; other schemes are refused
+	if err := publicClient.CheckRedirect(httptest.NewRequest(http.MethodGet, "file:///etc/passwd", nil), nil); err == nil {
+		t.Error("expected redirects to non-http schemes to be refused")
+	}
+}
+
+func TestAttachments_Fetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("meeting at noon"))
+	}))
+	defer server.Close()
+
+	f := &Attachments{Client: server.Client()}
+	out, err := f.Before("", nil, nil, attachmentRequest(t, server.URL+"/notes.txt"))
+	if err != nil {
+		t.Fatalf("Before returned error: %v", err)
+	}
+	if text := attachmentText(t, out); !strings.Contains(text, "fetching file URLs is disabled") {
+		t.Errorf("expected fetching to be off by default, got %q", text)
+	}
+
+	out, err = f.Before("fetch=true", nil, nil, attachmentRequest(t, server.URL+"/notes.txt"))
+	if err != nil {
+		t.Fatalf("Before returned error: %v", err)
+	}
+	if text := attachmentText(t, out); !strings.Contains(text, "meeting at noon") {
+		t.Errorf("expected the fetched file's text, got %q", text)
+	}
+}
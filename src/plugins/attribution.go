@@ -0,0 +1,93 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// RouterVersion is the router version reported in attribution records; set by modules
+var RouterVersion = "dev"
+
+// AttributionTrailer is the HTTP trailer carrying the attribution record
+const AttributionTrailer = "X-Router-Attribution"
+
+// Attribution records the provenance of responses for compliance
+// environments: responses, and the stream chunks finishing a choice, get an
+// extras.attribution object with the provider, model, router version and trace
+// ID, and the router sends the same record in the X-Router-Attribution trailer.
+//
+// Example: model="openai/gpt-4.1+attribution"
+type Attribution struct{}
+
+// AttributionRecord is the provenance of a response
+type AttributionRecord struct {
+	Provider      string `json:"provider"`
+	Model         string `json:"model"`
+	RouterVersion string `json:"router_version"`
+	TraceID       string `json:"trace_id,omitempty"`
+}
+
+// NewAttributionRecord describes the response of provider p to reqJson
+func NewAttributionRecord(p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON) AttributionRecord {
+	record := AttributionRecord{
+		Model:         styles.TryGetFromPartialJSON[string](reqJson, "model"),
+		RouterVersion: RouterVersion,
+	}
+	if p != nil {
+		record.Provider = p.Name
+	}
+	if r != nil {
+		if trace, ok := plugin.TraceFromContext(r.Context()); ok {
+			record.TraceID = trace.ID
+		}
+	}
+	return record
+}
+
+// String formats the record as the value of the attribution trailer
+func (a AttributionRecord) String() string {
+	s := fmt.Sprintf("provider=%s; model=%s; router_version=%s", a.Provider, a.Model, a.RouterVersion)
+	if a.TraceID != "" {
+		s += "; trace_id=" + a.TraceID
+	}
+	return s
+}
+
+func (a *Attribution) Name() string { return "attribution" }
+
+func (a *Attribution) After(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, resJson styles.PartialJSON) (styles.PartialJSON, error) {
+	return withExtra(resJson, "attribution", NewAttributionRecord(p, r, reqJson)), nil
+}
+
+func (a *Attribution) AfterChunk(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, chunk styles.PartialJSON) (styles.PartialJSON, error) {
+	if !finishesChoice(chunk) {
+		return chunk, nil
+	}
+	return withExtra(chunk, "attribution", NewAttributionRecord(p, r, reqJson)), nil
+}
+
+// finishesChoice reports whether a stream chunk carries a finish reason
+func finishesChoice(chunk styles.PartialJSON) bool {
+	var choices []struct {
+		FinishReason *string `json:"finish_reason"`
+	}
+	if raw, ok := chunk["choices"]; !ok || json.Unmarshal(raw, &choices) != nil {
+		return false
+	}
+	for _, c := range choices {
+		if c.FinishReason != nil && *c.FinishReason != "" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	_ plugin.AfterPlugin       = (*Attribution)(nil)
+	_ plugin.StreamChunkPlugin = (*Attribution)(nil)
+)
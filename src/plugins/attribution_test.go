@@ -0,0 +1,51 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestAttributionRecordsProvenance(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	r = r.WithContext(plugin.WithTrace(r.Context(), &plugin.Trace{ID: "trace-1", SpanID: "span-1"}))
+	p := &services.ProviderService{Name: "openai"}
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "gpt-4.1"}`))
+	res, _ := styles.ParsePartialJSON([]byte(`{"id": "chatcmpl-1", "extras": {"timed_out": false}}`))
+
+	out, err := (&Attribution{}).After("", p, r, req, nil, res)
+	if err != nil {
+		t.Fatalf("After returned error: %v", err)
+	}
+	extras := styles.TryGetFromPartialJSON[map[string]any](out, "extras")
+	record, ok := extras["attribution"].(map[string]any)
+	if !ok {
+		t.Fatalf("extras.attribution missing: %s", out["extras"])
+	}
+	want := map[string]any{"provider": "openai", "model": "gpt-4.1", "router_version": RouterVersion, "trace_id": "trace-1"}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("attribution %s = %v, want %v", key, record[key], value)
+		}
+	}
+	if _, ok := extras["timed_out"]; !ok {
+		t.Error("expected existing extras to be kept")
+	}
+	if got := NewAttributionRecord(p, r, req).String(); got != "provider=openai; model=gpt-4.1; router_version="+RouterVersion+"; trace_id=trace-1" {
+		t.Errorf("trailer = %q", got)
+	}
+
+	// Only the chunk finishing a choice is annotated
+	delta, _ := styles.ParsePartialJSON([]byte(`{"choices": [{"index": 0, "delta": {"content": "hi"}, "finish_reason": null}]}`))
+	if out, _ := (&Attribution{}).AfterChunk("", p, r, req, nil, delta); out["extras"] != nil {
+		t.Error("expected content chunks not to be annotated")
+	}
+	final, _ := styles.ParsePartialJSON([]byte(`{"choices": [{"index": 0, "delta": {}, "finish_reason": "stop"}]}`))
+	if out, _ := (&Attribution{}).AfterChunk("", p, r, req, nil, final); out["extras"] == nil {
+		t.Error("expected the finishing chunk to be annotated")
+	}
+}
@@ -0,0 +1,259 @@
+package plugins
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Compress prunes low-information sentences from long contexts before they are
+// sent upstream, in the spirit of LLMLingua but without a model: every sentence
+// is scored by the mean self-information of its words under a unigram model of
+// the conversation, repeated sentences score zero, and the lowest scoring
+// sentences are dropped until the target ratio is reached.
+// Example: model="openai/gpt-4.1+compress:ratio=0.4,min_tokens=2000"
+//
+// Params:
+//   - ratio: share of the compressible tokens to keep (default: 0.5)
+//   - min_tokens: only compress conversations estimated above this size (default: 1000)
+//   - keep_last: number of trailing messages left untouched (default: 2)
+//
+// System messages, tool calls, JSON contents and fenced code blocks are never
+// pruned; a message pruned entirely is replaced by "…".
+type Compress struct {
+}
+
+func (f *Compress) Name() string { return "compress" }
+
+// compressSegment is one sentence (or code block) of a compressible message
+type compressSegment struct {
+	msg, part int
+	text      string
+	tokens    int
+	score     float64
+	keep      bool
+}
+
+var (
+	codeFenceRe     = regexp.MustCompile("(?s)```.*?(```|$)")
+	sentenceBoundRe = regexp.MustCompile(`[.!?]+["')\]]*\s+|\n+`)
+)
+
+func (f *Compress) Before(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	opts := ParseParams(params)
+	ratio := 0.5
+	if v, err := strconv.ParseFloat(opts["ratio"], 64); err == nil && v > 0 && v <= 1 {
+		ratio = v
+	}
+	minTokens := 1000
+	if v, err := strconv.Atoi(opts["min_tokens"]); err == nil && v >= 0 {
+		minTokens = v
+	}
+	keepLast := 2
+	if v, err := strconv.Atoi(opts["keep_last"]); err == nil && v >= 0 {
+		keepLast = v
+	}
+	if ratio == 1 {
+		return reqJson, nil
+	}
+
+	messages, err := styles.GetFromPartialJSON[[]styles.ChatCompletionsMessage](reqJson, "messages")
+	if err != nil {
+		return reqJson, err
+	}
+
+	total := 0
+	for _, msg := range messages {
+		for _, text := range messageTexts(msg.Content) {
+			total += services.EstimateTokens(text)
+		}
+	}
+	if total < minTokens {
+		return reqJson, nil
+	}
+
+	// Collect the segments of the messages that may be pruned
+	var segments []*compressSegment
+	for i := 0; i < len(messages)-keepLast; i++ {
+		if messages[i].Role == "system" || messages[i].Role == "developer" {
+			continue
+		}
+		for part, text := range messageTexts(messages[i].Content) {
+			if json.Valid([]byte(text)) {
+				continue
+			}
+			for _, seg := range splitSegments(text) {
+				segments = append(segments, &compressSegment{msg: i, part: part, text: seg, tokens: services.EstimateTokens(seg)})
+			}
+		}
+	}
+	compressible := 0
+	for _, seg := range segments {
+		compressible += seg.tokens
+	}
+	if compressible == 0 {
+		return reqJson, nil
+	}
+
+	scoreSegments(segments)
+
+	// Keep the most informative segments within the budget
+	ranked := make([]*compressSegment, len(segments))
+	copy(ranked, segments)
+	sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].score > ranked[b].score })
+	budget := int(math.Ceil(float64(compressible) * ratio))
+	kept := 0
+	for _, seg := range ranked {
+		if kept+seg.tokens <= budget || math.IsInf(seg.score, 1) {
+			seg.keep = true
+			kept += seg.tokens
+		}
+	}
+
+	// Rebuild the pruned messages in their original order
+	rebuilt := make(map[int]map[int][]string)
+	for _, seg := range segments {
+		if rebuilt[seg.msg] == nil {
+			rebuilt[seg.msg] = make(map[int][]string)
+		}
+		if seg.keep {
+			rebuilt[seg.msg][seg.part] = append(rebuilt[seg.msg][seg.part], seg.text)
+		} else if _, ok := rebuilt[seg.msg][seg.part]; !ok {
+			rebuilt[seg.msg][seg.part] = []string{}
+		}
+	}
+	for i, parts := range rebuilt {
+		messages[i].Content = replaceMessageTexts(messages[i].Content, parts)
+	}
+
+	Logger.Debug("compress plugin pruned context",
+		zap.Int("tokens_before", total),
+		zap.Int("compressible_tokens", compressible),
+		zap.Int("kept_tokens", kept),
+		zap.Float64("ratio", ratio))
+
+	return reqJson.CloneWith("messages", messages)
+}
+
+// messageTexts returns the text of string content or of the text parts of
+// multi-part content, indexed by part
+func messageTexts(content any) map[int]string {
+	texts := make(map[int]string)
+	switch c := content.(type) {
+	case string:
+		texts[0] = c
+	case []any:
+		for i, part := range c {
+			if m, ok := part.(map[string]any); ok && m["type"] == "text" {
+				if text, ok := m["text"].(string); ok {
+					texts[i] = text
+				}
+			}
+		}
+	}
+	return texts
+}
+
+// replaceMessageTexts writes pruned texts back into string or multi-part content
+func replaceMessageTexts(content any, parts map[int][]string) any {
+	switch c := content.(type) {
+	case string:
+		if kept, ok := parts[0]; ok {
+			return joinKept(kept)
+		}
+	case []any:
+		for i, kept := range parts {
+			if m, ok := c[i].(map[string]any); ok {
+				m["text"] = joinKept(kept)
+			}
+		}
+	}
+	return content
+}
+
+func joinKept(kept []string) string {
+	if len(kept) == 0 {
+		return "…"
+	}
+	return strings.Join(kept, " ")
+}
+
+// splitSegments splits text into sentences, keeping fenced code blocks whole
+func splitSegments(text string) []string {
+	var out []string
+	addSentences := func(s string) {
+		last := 0
+		for _, loc := range sentenceBoundRe.FindAllStringIndex(s, -1) {
+			if seg := strings.TrimSpace(s[last:loc[1]]); seg != "" {
+				out = append(out, seg)
+			}
+			last = loc[1]
+		}
+		if seg := strings.TrimSpace(s[last:]); seg != "" {
+			out = append(out, seg)
+		}
+	}
+
+	last := 0
+	for _, loc := range codeFenceRe.FindAllStringIndex(text, -1) {
+		addSentences(text[last:loc[0]])
+		out = append(out, text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	addSentences(text[last:])
+	return out
+}
+
+// scoreSegments sets each segment's score to the mean self-information of its
+// words, -log p(word), under a unigram model of all segments. Code blocks score
+// +Inf (always kept) and repeated sentences score 0.
+func scoreSegments(segments []*compressSegment) {
+	words := func(s string) []string {
+		return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+	}
+
+	counts := make(map[string]float64)
+	total := 0.0
+	for _, seg := range segments {
+		for _, w := range words(seg.text) {
+			counts[w]++
+			total++
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, seg := range segments {
+		if strings.HasPrefix(seg.text, "```") {
+			seg.score = math.Inf(1)
+			continue
+		}
+		ws := words(seg.text)
+		key := strings.Join(ws, " ")
+		if len(ws) == 0 || seen[key] {
+			seg.score = 0
+			continue
+		}
+		seen[key] = true
+		sum := 0.0
+		for _, w := range ws {
+			sum += -math.Log(counts[w] / total)
+		}
+		seg.score = sum / float64(len(ws))
+	}
+}
+
+var (
+	_ plugin.BeforePlugin = (*Compress)(nil)
+)
@@ -0,0 +1,79 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestSplitSegments(t *testing.T) {
+	text := "First sentence. Second one? Third!\nCode:\n```go\nfmt.Println(\"a. b\")\n```\nLast line"
+	got := splitSegments(text)
+	want := []string{"First sentence.", "Second one?", "Third!", "Code:", "```go\nfmt.Println(\"a. b\")\n```", "Last line"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("segment %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	filler := strings.Repeat("The thing is the thing. ", 40)
+	facts := "The invoice number is 88213 and payment is due on March 3rd. "
+	reqJson := styles.PartialJSON{}
+	_ = reqJson.Set("model", "test")
+	_ = reqJson.Set("messages", []styles.ChatCompletionsMessage{
+		{Role: "system", Content: filler},
+		{Role: "user", Content: filler + facts + filler},
+		{Role: "tool", Content: `{"status": "ok. really"}`},
+		{Role: "user", Content: "What is the invoice number?"},
+	})
+
+	compress := &Compress{}
+	out, err := compress.Before("ratio=0.3,min_tokens=10,keep_last=1", nil, nil, reqJson)
+	if err != nil {
+		t.Fatalf("Before returned error: %v", err)
+	}
+	messages, err := styles.GetFromPartialJSON[[]styles.ChatCompletionsMessage](out, "messages")
+	if err != nil {
+		t.Fatalf("failed to read messages: %v", err)
+	}
+
+	if messages[0].Content != filler {
+		t.Error("system message should not be compressed")
+	}
+	user := messages[1].Content.(string)
+	if len(user) >= len(filler)*2 {
+		t.Errorf("user message was not compressed: %d chars", len(user))
+	}
+	if !strings.Contains(user, "88213") {
+		t.Errorf("informative sentence was pruned: %q", user)
+	}
+	if messages[2].Content != `{"status": "ok. really"}` {
+		t.Errorf("JSON content should not be compressed, got %q", messages[2].Content)
+	}
+	if messages[3].Content != "What is the invoice number?" {
+		t.Error("trailing message should not be compressed")
+	}
+}
+
+func TestCompressSkipsShortContexts(t *testing.T) {
+	reqJson := styles.PartialJSON{}
+	_ = reqJson.Set("messages", []styles.ChatCompletionsMessage{
+		{Role: "user", Content: "Short. Context. Here."},
+		{Role: "user", Content: "Question?"},
+	})
+
+	compress := &Compress{}
+	out, err := compress.Before("", nil, nil, reqJson)
+	if err != nil {
+		t.Fatalf("Before returned error: %v", err)
+	}
+	if string(out["messages"]) != string(reqJson["messages"]) {
+		t.Errorf("short context should be unchanged, got %s", out["messages"])
+	}
+}
@@ -0,0 +1,22 @@
+package plugins
+
+import (
+	"encoding/json"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// withExtra returns a copy of a response or chunk with key set in its extras
+// object, keeping the extras other plugins already added
+func withExtra(doc styles.PartialJSON, key string, value any) styles.PartialJSON {
+	extras := map[string]any{}
+	if raw, ok := doc["extras"]; ok {
+		_ = json.Unmarshal(raw, &extras)
+	}
+	extras[key] = value
+	updated, err := doc.CloneWith("extras", extras)
+	if err != nil {
+		return doc
+	}
+	return updated
+}
@@ -0,0 +1,149 @@
+package plugins
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// fingerprintAlertEvent is emitted when a prompt fingerprint goes over the
+// threshold, at most once per window
+const fingerprintAlertEvent = "$ai_fingerprint_alert"
+
+// Fingerprint detects abuse by volume: it computes a fuzzy hash (SimHash) of
+// the user messages of every request and counts requests per fingerprint in
+// the router's tracker, so identical and near-identical prompts sent at high
+// volume, even across keys, stand out.
+//   - threshold: requests within the window that flag a fingerprint (default 50)
+//   - window: counting window, at most 1h (default 1m)
+//   - min_keys: distinct keys needed to flag a fingerprint (default 1)
+//   - distance: differing bits for two prompts to count as one (default 3)
+//   - min_chars: shorter prompts are not counted (default 32)
+//   - throttle: reject flagged requests with 429 (default: only report)
+//
+// Flagged fingerprints emit $ai_fingerprint_alert to the router's sinks and
+// show in ai_stats.
+//
+// Example: model="openai/gpt-4o-mini+fingerprint:threshold=100,min_keys=3,throttle=true"
+type Fingerprint struct{}
+
+// fingerprintOptions are the parsed parameters of the plugin
+type fingerprintOptions struct {
+	threshold int
+	window    time.Duration
+	minKeys   int
+	distance  int
+	minChars  int
+	throttle  bool
+}
+
+func parseFingerprintOptions(params string) fingerprintOptions {
+	opts := ParseParams(params)
+	o := fingerprintOptions{threshold: 50, window: time.Minute, minKeys: 1, distance: 3, minChars: 32}
+	if v, err := strconv.Atoi(opts["threshold"]); err == nil && v > 0 {
+		o.threshold = v
+	}
+	if v, err := time.ParseDuration(opts["window"]); err == nil && v > 0 {
+		o.window = min(v, services.FingerprintRetention)
+	}
+	if v, err := strconv.Atoi(opts["min_keys"]); err == nil && v > 0 {
+		o.minKeys = v
+	}
+	if v, err := strconv.Atoi(opts["distance"]); err == nil && v >= 0 && v < 32 {
+		o.distance = v
+	}
+	if v, err := strconv.Atoi(opts["min_chars"]); err == nil && v >= 0 {
+		o.minChars = v
+	}
+	o.throttle, _ = strconv.ParseBool(opts["throttle"])
+	return o
+}
+
+func (f *Fingerprint) Name() string { return "fingerprint" }
+
+func (f *Fingerprint) Before(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	if p == nil || p.Router == nil || p.Router.Fingerprints == nil {
+		return reqJson, nil
+	}
+	opts := parseFingerprintOptions(params)
+	text := promptText(reqJson)
+	if len(text) < opts.minChars {
+		return reqJson, nil
+	}
+
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	traceID := ""
+	if trace, ok := plugin.TraceFromContext(r.Context()); ok {
+		traceID = trace.ID
+	}
+	now := time.Now()
+	tracker := p.Router.Fingerprints
+	count := tracker.Observe(services.SimHash(text), opts.distance, keyID, traceID, opts.window, now)
+	if count.Requests < opts.threshold || count.Keys < opts.minKeys {
+		return reqJson, nil
+	}
+
+	fingerprint := services.FormatFingerprint(count.Fingerprint)
+	if tracker.Flag(count.Fingerprint, opts.throttle, opts.window, now) {
+		Logger.Warn("fingerprint plugin: repeated prompt over threshold",
+			zap.String("fingerprint", fingerprint), zap.Int("requests", count.Requests),
+			zap.Int("keys", count.Keys), zap.Bool("throttled", opts.throttle))
+		userID, _ := r.Context().Value(plugin.ContextUserID()).(string)
+		_ = services.EmitObservabilityEvent(p.Router, services.ObservabilityEvent{
+			Name:       fingerprintAlertEvent,
+			DistinctID: userID,
+			Properties: map[string]any{
+				"$ai_trace_id":   traceID,
+				"$ai_provider":   p.Name,
+				"$ai_model":      styles.TryGetFromPartialJSON[string](reqJson, "model"),
+				"fingerprint":    fingerprint,
+				"requests":       count.Requests,
+				"keys":           count.Keys,
+				"window_seconds": opts.window.Seconds(),
+				"throttled":      opts.throttle,
+				"key_id":         keyID,
+			},
+		})
+	}
+	if opts.throttle {
+		return nil, &services.PolicyError{
+			Status:  http.StatusTooManyRequests,
+			Message: fmt.Sprintf("request throttled: prompt fingerprint %s was sent %d times in %s", fingerprint, count.Requests, opts.window),
+		}
+	}
+	return reqJson, nil
+}
+
+// promptText returns the text of a request's user messages, in order. System
+// prompts are left out: every request of an application shares them.
+func promptText(reqJson styles.PartialJSON) string {
+	messages, err := styles.GetFromPartialJSON[[]styles.ChatCompletionsMessage](reqJson, "messages")
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		texts := messageTexts(msg.Content)
+		for _, i := range slices.Sorted(maps.Keys(texts)) {
+			b.WriteString(texts[i])
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+var (
+	_ plugin.BeforePlugin = (*Fingerprint)(nil)
+)
@@ -0,0 +1,50 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestFingerprintThrottlesRepeatedPrompts(t *testing.T) {
+	router := &services.RouterService{Fingerprints: services.NewFingerprintTracker(), Sinks: []services.ObservabilitySink{}}
+	p := &services.ProviderService{Name: "openai", Router: router}
+	f := &Fingerprint{}
+	params := "threshold=3,min_keys=2,throttle=true"
+
+	send := func(i int, key, prompt string) error {
+		req, _ := styles.ParsePartialJSON([]byte(fmt.Sprintf(`{"model": "gpt-4o-mini", "messages": [
+			{"role": "system", "content": "You are a helpful assistant."},
+			{"role": "user", "content": %q}]}`, prompt)))
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		ctx := context.WithValue(r.Context(), plugin.ContextKeyID(), key)
+		ctx = plugin.WithTrace(ctx, &plugin.Trace{ID: fmt.Sprintf("trace-%d", i), SpanID: "span"})
+		_, err := f.Before(params, p, r.WithContext(ctx), req)
+		return err
+	}
+
+	spam := "Generate ten five-star reviews for the Acme 3000 blender with different names."
+	for i, key := range []string{"acme:1", "acme:1"} {
+		if err := send(i, key, spam); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+	// Over the threshold, but from a single key
+	if err := send(2, "acme:1", spam); err != nil {
+		t.Fatalf("expected requests of one key to pass with min_keys=2, got %v", err)
+	}
+	var perr *services.PolicyError
+	if err := send(3, "globex:1", "GENERATE ten five-star reviews for the ACME 3000 blender -- with different names!"); !errors.As(err, &perr) || perr.Status != http.StatusTooManyRequests {
+		t.Fatalf("expected the same prompt, differently punctuated, from a second key to be throttled, got %v", err)
+	}
+	if err := send(4, "globex:1", "Translate the following paragraph into French and keep the formatting intact."); err != nil {
+		t.Errorf("expected an unrelated prompt to pass, got %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package flow
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/plugins"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Consensus queries several models (or the same model several times), groups
+// equivalent answers and returns the majority answer. The vote is reported in
+// "extras.consensus" and the X-Consensus-Agreement header.
+// Example: model="openai/gpt-4.1+consensus:models=openai/gpt-4.1|groq/llama-70b|mistral/large,mode=json"
+//
+// Params:
+//   - models: "|"-separated models to ask (default: the requested model n times)
+//   - n: number of requests when models is not set (default: 3)
+//   - mode: how answers are compared: exact (default), json or similar
+//   - threshold: minimum similarity in mode=similar (default: 0.8)
+//
+// Streaming is not supported; streaming requests are served normally.
+type Consensus struct{}
+
+func (c *Consensus) Name() string { return "consensus" }
+
+// consensusGroup is a set of equivalent answers
+type consensusGroup struct {
+	Models  []string `json:"models"`
+	Votes   int      `json:"votes"`
+	members []int
+}
+
+// RecursiveHandler fans the request out and answers with the majority.
+func (c *Consensus) RecursiveHandler(
+	params string,
+	invoker plugin.HandlerInvoker,
+	reqJson styles.PartialJSON,
+	w http.ResponseWriter,
+	r *http.Request,
+) (handled bool, err error) {
+	if styles.TryGetFromPartialJSON[bool](reqJson, "stream") {
+		plugins.Logger.Warn("consensus plugin: streaming not supported, serving the requested model only")
+		return false, nil
+	}
+
+	opts := plugins.ParseParams(params)
+	baseModel := withoutPlugin(styles.TryGetFromPartialJSON[string](reqJson, "model"), c.Name())
+
+	models := splitModels(opts["models"])
+	if len(models) == 0 {
+		n := 3
+		if v, err := strconv.Atoi(opts["n"]); err == nil && v > 0 {
+			n = v
+		}
+		for range n {
+			models = append(models, baseModel)
+		}
+	}
+
+	mode := opts["mode"]
+	if mode == "" {
+		mode = "exact"
+	}
+	threshold := 0.8
+	if v, err := strconv.ParseFloat(opts["threshold"], 64); err == nil {
+		threshold = v
+	}
+	same, err := answerComparator(mode, threshold)
+	if err != nil {
+		return true, err
+	}
+
+	overrides := make([]map[string]any, len(models))
+	for i, model := range models {
+		overrides[i] = map[string]any{"model": model}
+	}
+	results := fanOut(invoker, r, reqJson, overrides)
+
+	var answers []string
+	var answered []int
+	var lastErr error
+	for i, res := range results {
+		if res.err != nil || res.response == nil {
+			lastErr = res.err
+			plugins.Logger.Debug("consensus plugin: model call failed", zap.String("model", res.model), zap.Error(res.err))
+			continue
+		}
+		answers = append(answers, responseText(res.response))
+		answered = append(answered, i)
+	}
+	if len(answered) == 0 {
+		if lastErr == nil {
+			lastErr = errs.Errorf(errs.ErrUpstream, "consensus: no model answered")
+		}
+		return true, lastErr
+	}
+
+	groups := groupAnswers(answers, same)
+	for _, g := range groups {
+		for k, m := range g.members {
+			g.members[k] = answered[m]
+			g.Models = append(g.Models, results[answered[m]].model)
+		}
+	}
+	majority := groups[0]
+
+	resp := results[majority.members[0]].response.Clone()
+	if usage := sumUsage(results); usage != nil {
+		_ = resp.Set("usage", usage)
+	}
+	agreement := float64(majority.Votes) / float64(len(results))
+	_ = resp.Set("extras", map[string]any{
+		"consensus": map[string]any{
+			"mode":         mode,
+			"votes":        majority.Votes,
+			"total":        len(results),
+			"failed":       len(results) - len(answered),
+			"agreement":    math.Round(agreement*1000) / 1000,
+			"disagreement": len(groups) > 1,
+			"groups":       groups,
+		},
+	})
+
+	plugins.Logger.Debug("consensus plugin completed",
+		zap.String("mode", mode),
+		zap.Int("votes", majority.Votes),
+		zap.Int("total", len(results)),
+		zap.Int("groups", len(groups)))
+
+	data, err := resp.Marshal()
+	if err != nil {
+		return true, err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Consensus-Agreement", strconv.FormatFloat(agreement, 'f', 3, 64))
+	_, _ = w.Write(data)
+	return true, nil
+}
+
+// groupAnswers clusters equivalent answers, largest group first (ties keep
+// the order in which groups were formed). Each group is compared through its
+// first member.
+func groupAnswers(answers []string, same func(a, b string) bool) []*consensusGroup {
+	var groups []*consensusGroup
+	for i, answer := range answers {
+		var target *consensusGroup
+		for _, g := range groups {
+			if same(answers[g.members[0]], answer) {
+				target = g
+				break
+			}
+		}
+		if target == nil {
+			target = &consensusGroup{}
+			groups = append(groups, target)
+		}
+		target.members = append(target.members, i)
+		target.Votes++
+	}
+
+	slices.SortStableFunc(groups, func(a, b *consensusGroup) int { return b.Votes - a.Votes })
+	return groups
+}
+
+// answerComparator returns the equivalence test for a comparison mode
+func answerComparator(mode string, threshold float64) (func(a, b string) bool, error) {
+	switch mode {
+	case "exact":
+		return func(a, b string) bool { return normalizeAnswer(a) == normalizeAnswer(b) }, nil
+	case "json":
+		return func(a, b string) bool {
+			ca, okA := canonicalJSON(a)
+			cb, okB := canonicalJSON(b)
+			if okA && okB {
+				return ca == cb
+			}
+			return normalizeAnswer(a) == normalizeAnswer(b)
+		}, nil
+	case "similar":
+		return func(a, b string) bool { return textSimilarity(a, b) >= threshold }, nil
+	default:
+		return nil, errs.Errorf(errs.ErrInvalidRequest, "consensus: unknown mode '%s' (supported: exact, json, similar)", mode)
+	}
+}
+
+// normalizeAnswer lowercases, collapses whitespace and trims surrounding punctuation
+func normalizeAnswer(s string) string {
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	return strings.TrimFunc(s, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSpace(r) })
+}
+
+// canonicalJSON parses a JSON answer (optionally inside a ``` fence) and
+// re-encodes it with sorted keys
+func canonicalJSON(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```")
+		s = strings.TrimPrefix(s, "json")
+		s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+	}
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return "", false
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(out), true
+}
+
+// textSimilarity is the cosine similarity of the answers' word counts, a local
+// stand-in for embedding similarity that needs no extra model call
+func textSimilarity(a, b string) float64 {
+	count := func(s string) map[string]float64 {
+		words := make(map[string]float64)
+		for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}) {
+			words[w]++
+		}
+		return words
+	}
+	wa, wb := count(a), count(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		if len(wa) == len(wb) {
+			return 1
+		}
+		return 0
+	}
+
+	var dot, na, nb float64
+	for w, x := range wa {
+		dot += x * wb[w]
+		na += x * x
+	}
+	for _, y := range wb {
+		nb += y * y
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+var (
+	_ plugin.RecursiveHandlerPlugin = (*Consensus)(nil)
+)
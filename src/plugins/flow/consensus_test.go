@@ -0,0 +1,44 @@
+package flow
+
+import (
+	"testing"
+)
+
+func TestGroupAnswers(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		answers   []string
+		wantVotes []int
+	}{
+		{"exact ignores case and punctuation", "exact", []string{"Positive.", "negative", "positive"}, []int{2, 1}},
+		{"json ignores key order", "json", []string{`{"a":1,"b":2}`, "```json\n{\"b\":2,\"a\":1}\n```", `{"a":2}`}, []int{2, 1}},
+		{"similar groups paraphrases", "similar", []string{"the cat sat on the mat", "on the mat the cat sat", "dogs bark"}, []int{2, 1}},
+		{"tie keeps first group first", "exact", []string{"a", "b"}, []int{1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same, err := answerComparator(tt.mode, 0.8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			groups := groupAnswers(tt.answers, same)
+			if len(groups) != len(tt.wantVotes) {
+				t.Fatalf("got %d groups, want %d", len(groups), len(tt.wantVotes))
+			}
+			for i, g := range groups {
+				if g.Votes != tt.wantVotes[i] {
+					t.Errorf("group %d votes = %d, want %d", i, g.Votes, tt.wantVotes[i])
+				}
+			}
+			if groups[0].members[0] != 0 {
+				t.Errorf("majority group should start with the first answer, got %v", groups[0].members)
+			}
+		})
+	}
+
+	if _, err := answerComparator("embedding", 0.8); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
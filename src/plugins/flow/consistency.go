@@ -0,0 +1,214 @@
+package flow
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/plugins"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// SelfConsistency samples the requested model k times at a higher temperature,
+// extracts the final answer of each sample and returns a sample carrying the
+// majority answer. The vote and its confidence are reported in
+// "extras.self_consistency" and the X-Self-Consistency-Confidence header.
+// Example: model="openai/o4-mini+consistency:k=7,temperature=0.9" or
+// "openai/gpt-4.1+consistency:extract=json,field=result.answer"
+//
+// Params:
+//   - k: number of samples (default: 5)
+//   - temperature: sampling temperature (default: 0.8)
+//   - extract: how the answer is taken from a sample: answer (default), json or full
+//   - field: dotted path of the answer in mode extract=json (default: the whole JSON)
+//
+// With extract=answer the answer is the last "Answer: ..." line, else the last
+// \boxed{...}, else the last non-empty line of the sample.
+// Streaming is not supported; streaming requests are served normally.
+type SelfConsistency struct{}
+
+func (s *SelfConsistency) Name() string { return "consistency" }
+
+var (
+	answerLineRe = regexp.MustCompile(`(?im)^\W*(?:final\s+)?answer\s*(?:is)?\s*[:=]\s*(.+)$`)
+	boxedRe      = regexp.MustCompile(`\\boxed\{([^{}]*)\}`)
+)
+
+// RecursiveHandler samples the model and answers with the majority.
+func (s *SelfConsistency) RecursiveHandler(
+	params string,
+	invoker plugin.HandlerInvoker,
+	reqJson styles.PartialJSON,
+	w http.ResponseWriter,
+	r *http.Request,
+) (handled bool, err error) {
+	if styles.TryGetFromPartialJSON[bool](reqJson, "stream") {
+		plugins.Logger.Warn("consistency plugin: streaming not supported, serving a single sample")
+		return false, nil
+	}
+
+	opts := plugins.ParseParams(params)
+	model := withoutPlugin(styles.TryGetFromPartialJSON[string](reqJson, "model"), s.Name())
+
+	k := 5
+	if v, err := strconv.Atoi(opts["k"]); err == nil && v > 0 {
+		k = v
+	}
+	temperature := 0.8
+	if v, err := strconv.ParseFloat(opts["temperature"], 64); err == nil && v >= 0 {
+		temperature = v
+	}
+	mode := opts["extract"]
+	if mode == "" {
+		mode = "answer"
+	}
+	extract, err := answerExtractor(mode, opts["field"])
+	if err != nil {
+		return true, err
+	}
+
+	overrides := make([]map[string]any, k)
+	for i := range overrides {
+		overrides[i] = map[string]any{"model": model, "temperature": temperature}
+	}
+	results := fanOut(invoker, r, reqJson, overrides)
+
+	var answers []string
+	var answered []int
+	var lastErr error
+	for i, res := range results {
+		if res.err != nil || res.response == nil {
+			lastErr = res.err
+			plugins.Logger.Debug("consistency plugin: sample failed", zap.Int("sample", i), zap.Error(res.err))
+			continue
+		}
+		answer, ok := extract(responseText(res.response))
+		if !ok {
+			plugins.Logger.Debug("consistency plugin: no answer in sample", zap.Int("sample", i))
+			continue
+		}
+		answers = append(answers, answer)
+		answered = append(answered, i)
+	}
+	if len(answered) == 0 {
+		if lastErr == nil {
+			lastErr = errs.Errorf(errs.ErrUpstream, "consistency: no sample produced an answer")
+		}
+		return true, lastErr
+	}
+
+	groups := groupAnswers(answers, func(a, b string) bool { return normalizeAnswer(a) == normalizeAnswer(b) })
+	majority := groups[0]
+	answer := answers[majority.members[0]]
+	confidence := float64(majority.Votes) / float64(len(results))
+
+	distribution := make([]map[string]any, len(groups))
+	for i, g := range groups {
+		distribution[i] = map[string]any{"answer": answers[g.members[0]], "votes": g.Votes}
+	}
+
+	resp := results[answered[majority.members[0]]].response.Clone()
+	if usage := sumUsage(results); usage != nil {
+		_ = resp.Set("usage", usage)
+	}
+	_ = resp.Set("extras", map[string]any{
+		"self_consistency": map[string]any{
+			"answer":       answer,
+			"confidence":   math.Round(confidence*1000) / 1000,
+			"votes":        majority.Votes,
+			"samples":      len(results),
+			"unanswered":   len(results) - len(answered),
+			"temperature":  temperature,
+			"distribution": distribution,
+		},
+	})
+
+	plugins.Logger.Debug("consistency plugin completed",
+		zap.String("model", model),
+		zap.Int("votes", majority.Votes),
+		zap.Int("samples", len(results)),
+		zap.Int("answers", len(groups)))
+
+	data, err := resp.Marshal()
+	if err != nil {
+		return true, err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Self-Consistency-Confidence", strconv.FormatFloat(confidence, 'f', 3, 64))
+	_, _ = w.Write(data)
+	return true, nil
+}
+
+// answerExtractor returns the function taking the final answer out of a sample
+func answerExtractor(mode, field string) (func(text string) (string, bool), error) {
+	switch mode {
+	case "full":
+		return func(text string) (string, bool) {
+			text = strings.TrimSpace(text)
+			return text, text != ""
+		}, nil
+	case "answer":
+		return extractAnswerSpan, nil
+	case "json":
+		return func(text string) (string, bool) {
+			return extractJSONField(text, field)
+		}, nil
+	default:
+		return nil, errs.Errorf(errs.ErrInvalidRequest, "consistency: unknown extract mode '%s' (supported: answer, json, full)", mode)
+	}
+}
+
+// extractAnswerSpan finds the final answer of a reasoning sample
+func extractAnswerSpan(text string) (string, bool) {
+	if m := answerLineRe.FindAllStringSubmatch(text, -1); len(m) > 0 {
+		return strings.Trim(m[len(m)-1][1], " \t*_`"), true
+	}
+	if m := boxedRe.FindAllStringSubmatch(text, -1); len(m) > 0 {
+		return strings.TrimSpace(m[len(m)-1][1]), true
+	}
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	return last, last != ""
+}
+
+// extractJSONField parses a JSON sample and returns the canonical encoding of
+// the value at the dotted path (the whole document when path is empty)
+func extractJSONField(text, path string) (string, bool) {
+	doc, ok := canonicalJSON(text)
+	if !ok {
+		return "", false
+	}
+	var v any
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		return "", false
+	}
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return "", false
+			}
+			if v, ok = obj[key]; !ok {
+				return "", false
+			}
+		}
+	}
+	if str, ok := v.(string); ok {
+		return str, true
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(out), true
+}
+
+var (
+	_ plugin.RecursiveHandlerPlugin = (*SelfConsistency)(nil)
+)
@@ -0,0 +1,114 @@
+package flow
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestSelfConsistency(t *testing.T) {
+	failed := errors.New("upstream unavailable")
+	tests := []struct {
+		name string
+		// samples are answered in call order; "" fails the call
+		samples        []string
+		wantAnswer     string
+		wantVotes      int
+		wantUnanswered int
+		wantErr        bool
+	}{
+		{"majority wins", []string{"Answer: 7", "The answer is 8\nAnswer: 7", "Answer: 8", "Answer: 7", "\\boxed{7}"}, "7", 4, 0, false},
+		{"tie", []string{"Answer: 7", "Answer: 8"}, "", 1, 0, false},
+		{"some samples fail", []string{"", "Answer: 7", "", "Answer: 7", "Answer: 8"}, "7", 2, 2, false},
+		{"all samples fail", []string{"", ""}, "", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := 0
+			invoker := &scriptedInvoker{answer: func(req styles.PartialJSON) (string, error) {
+				sample := tt.samples[next]
+				next++
+				if sample == "" {
+					return "", failed
+				}
+				return sample, nil
+			}}
+
+			reqJson := styles.PartialJSON{}
+			_ = reqJson.Set("model", "solver+consistency")
+			_ = reqJson.Set("messages", []styles.ChatCompletionsMessage{{Role: "user", Content: "What is 3+4?"}})
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			w := httptest.NewRecorder()
+
+			params := "k=" + strconv.Itoa(len(tt.samples))
+			handled, err := (&SelfConsistency{}).RecursiveHandler(params, invoker, reqJson, w, r)
+			if !handled {
+				t.Fatal("expected the request to be handled")
+			}
+			if tt.wantErr {
+				if !errors.Is(err, failed) {
+					t.Errorf("expected the samples' error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RecursiveHandler returned error: %v", err)
+			}
+			if len(invoker.calls) != len(tt.samples) {
+				t.Errorf("expected %d samples, got %d", len(tt.samples), len(invoker.calls))
+			}
+			for _, call := range invoker.calls {
+				if model := styles.TryGetFromPartialJSON[string](call, "model"); model != "solver" {
+					t.Errorf("expected samples of the model without the plugin, got %s", model)
+				}
+			}
+
+			resp, err := styles.ParsePartialJSON(w.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var extras struct {
+				SelfConsistency struct {
+					Answer       string  `json:"answer"`
+					Votes        int     `json:"votes"`
+					Samples      int     `json:"samples"`
+					Unanswered   int     `json:"unanswered"`
+					Confidence   float64 `json:"confidence"`
+					Distribution []struct {
+						Answer string `json:"answer"`
+						Votes  int    `json:"votes"`
+					} `json:"distribution"`
+				} `json:"self_consistency"`
+			}
+			if err := json.Unmarshal(resp["extras"], &extras); err != nil {
+				t.Fatalf("expected extras.self_consistency, got %s", resp["extras"])
+			}
+			sc := extras.SelfConsistency
+			if sc.Votes != tt.wantVotes || sc.Unanswered != tt.wantUnanswered || sc.Samples != len(tt.samples) {
+				t.Errorf("unexpected vote: %+v", sc)
+			}
+			if want := float64(tt.wantVotes) / float64(len(tt.samples)); sc.Confidence != want {
+				t.Errorf("expected confidence %v, got %v", want, sc.Confidence)
+			}
+			if tt.wantAnswer != "" && sc.Answer != tt.wantAnswer {
+				t.Errorf("expected the majority answer %q, got %q", tt.wantAnswer, sc.Answer)
+			}
+			// The answering sample is returned, and a tie goes to the first group
+			if len(sc.Distribution) == 0 || sc.Distribution[0].Answer != sc.Answer {
+				t.Errorf("expected the answer to lead the distribution, got %+v", sc)
+			}
+			if got, _ := extractAnswerSpan(responseText(resp)); got != sc.Answer {
+				t.Errorf("expected a sample carrying %q, got %q", sc.Answer, responseText(resp))
+			}
+			if tt.name == "tie" && len(sc.Distribution) != 2 {
+				t.Errorf("expected both answers in the distribution, got %+v", sc.Distribution)
+			}
+		})
+	}
+}
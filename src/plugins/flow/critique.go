@@ -0,0 +1,236 @@
+package flow
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/plugins"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Critique implements a draft-and-critique chain: the drafter answers, the critic
+// reviews the draft against a rubric and the drafter revises, for a number of rounds.
+// Example: model="openai/gpt-4.1+critique:drafter=openai/gpt-4.1,critic=anthropic/claude-sonnet,rounds=2"
+//
+// Params:
+//   - drafter: model that drafts and revises (default: the requested model)
+//   - critic: model that reviews drafts (default: the drafter)
+//   - rounds: number of critique and revision rounds (default: 1)
+//   - rubric: review criteria, without commas (default: correctness, completeness, clarity)
+//   - artifacts: "true" to attach drafts and critiques in extras.critique (non-streaming only)
+//
+// The final revision is streamed when the request asks for streaming.
+type Critique struct{}
+
+func (c *Critique) Name() string { return "critique" }
+
+// DefaultCritiqueRubric is used when no rubric param is given
+const DefaultCritiqueRubric = "factual correctness; completeness with respect to the request; clarity and concision"
+
+// critiqueArtifact is one intermediate step attached in extras
+type critiqueArtifact struct {
+	Round   int    `json:"round"`
+	Step    string `json:"step"`
+	Model   string `json:"model"`
+	Content string `json:"content"`
+}
+
+// RecursiveHandler runs the draft, critique and revision passes.
+func (c *Critique) RecursiveHandler(
+	params string,
+	invoker plugin.HandlerInvoker,
+	reqJson styles.PartialJSON,
+	w http.ResponseWriter,
+	r *http.Request,
+) (handled bool, err error) {
+	opts := plugins.ParseParams(params)
+
+	drafter := opts["drafter"]
+	if drafter == "" {
+		drafter = withoutPlugin(styles.TryGetFromPartialJSON[string](reqJson, "model"), c.Name())
+	}
+	critic := opts["critic"]
+	if critic == "" {
+		critic = drafter
+	}
+	rounds := 1
+	if v, err := strconv.Atoi(opts["rounds"]); err == nil && v > 0 {
+		rounds = v
+	}
+	rubric := opts["rubric"]
+	if rubric == "" {
+		rubric = DefaultCritiqueRubric
+	}
+	stream := styles.TryGetFromPartialJSON[bool](reqJson, "stream")
+	withArtifacts := opts["artifacts"] == "true" && !stream
+
+	var messages []json.RawMessage
+	if raw, ok := reqJson["messages"]; ok {
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return true, errs.Errorf(errs.ErrInvalidRequest, "critique: invalid messages: %w", err)
+		}
+	}
+	transcript := messagesTranscript(messages)
+
+	var steps []fanOutResult
+	var artifacts []critiqueArtifact
+	capture := func(round int, step string, fields map[string]any) (string, error) {
+		res := fanOut(invoker, r, reqJson, []map[string]any{fields})[0]
+		if res.err == nil && res.response == nil {
+			res.err = errs.Errorf(errs.ErrUpstream, "critique: empty %s response from %s", step, res.model)
+		}
+		if res.err != nil {
+			return "", res.err
+		}
+		steps = append(steps, res)
+		text := responseText(res.response)
+		artifacts = append(artifacts, critiqueArtifact{Round: round, Step: step, Model: res.model, Content: text})
+		plugins.Logger.Debug("critique plugin step done",
+			zap.Int("round", round), zap.String("step", step), zap.String("model", res.model))
+		return text, nil
+	}
+
+	draft, err := capture(0, "draft", map[string]any{"model": drafter})
+	if err != nil {
+		return true, err
+	}
+
+	for round := 1; round <= rounds; round++ {
+		critique, err := capture(round, "critique", map[string]any{
+			"model":           critic,
+			"messages":        critiqueMessages(transcript, draft, rubric),
+			"tools":           nil,
+			"tool_choice":     nil,
+			"response_format": nil,
+		})
+		if err != nil {
+			return true, err
+		}
+
+		revision := map[string]any{
+			"model":    drafter,
+			"messages": revisionMessages(messages, draft, critique),
+		}
+
+		if round < rounds {
+			if draft, err = capture(round, "revision", revision); err != nil {
+				return true, err
+			}
+			continue
+		}
+
+		// Final revision: streamed or written as-is unless artifacts are attached
+		if !withArtifacts {
+			finalReq, err := cloneRequestWith(r, reqJson, revision)
+			if err != nil {
+				return true, err
+			}
+			w.Header().Set("X-Critique-Rounds", strconv.Itoa(rounds))
+			return true, invoker.InvokeHandler(w, finalReq)
+		}
+
+		if _, err := capture(round, "revision", revision); err != nil {
+			return true, err
+		}
+	}
+
+	// Artifacts requested: answer with the last revision plus the chain in extras
+	resp := steps[len(steps)-1].response.Clone()
+	if usage := sumUsage(steps); usage != nil {
+		_ = resp.Set("usage", usage)
+	}
+	_ = resp.Set("extras", map[string]any{
+		"critique": map[string]any{
+			"drafter":   drafter,
+			"critic":    critic,
+			"rounds":    rounds,
+			"artifacts": artifacts[:len(artifacts)-1],
+		},
+	})
+	data, err := resp.Marshal()
+	if err != nil {
+		return true, err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Critique-Rounds", strconv.Itoa(rounds))
+	_, _ = w.Write(data)
+	return true, nil
+}
+
+// critiqueMessages builds the critic's prompt
+func critiqueMessages(transcript, draft, rubric string) []styles.ChatCompletionsMessage {
+	return []styles.ChatCompletionsMessage{
+		{
+			Role: "system",
+			Content: "You are a demanding reviewer. Critique the draft answer to the conversation below against the rubric. " +
+				"List concrete problems and how to fix them. Do not rewrite the answer yourself.",
+		},
+		{
+			Role:    "user",
+			Content: "Conversation:\n" + transcript + "\n\nDraft answer:\n" + draft + "\n\nRubric: " + rubric,
+		},
+	}
+}
+
+// revisionMessages appends the draft and the critique to the original conversation
+func revisionMessages(messages []json.RawMessage, draft, critique string) []any {
+	out := make([]any, 0, len(messages)+2)
+	for _, m := range messages {
+		out = append(out, m)
+	}
+	return append(out,
+		styles.ChatCompletionsMessage{Role: "assistant", Content: draft},
+		styles.ChatCompletionsMessage{
+			Role:    "user",
+			Content: "A reviewer critiqued your answer:\n" + critique + "\n\nRevise your answer accordingly. Reply with the improved answer only.",
+		},
+	)
+}
+
+// messagesTranscript renders the text of a conversation as "role: content" lines
+func messagesTranscript(messages []json.RawMessage) string {
+	var b strings.Builder
+	for _, raw := range messages {
+		var msg styles.ChatCompletionsMessage
+		if json.Unmarshal(raw, &msg) != nil {
+			continue
+		}
+		text := messageText(msg.Content)
+		if text == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(msg.Role + ": " + text)
+	}
+	return b.String()
+}
+
+// messageText returns the text of string or multi-part message content
+func messageText(content any) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []any:
+		var parts []string
+		for _, part := range c {
+			if m, ok := part.(map[string]any); ok {
+				if text, ok := m["text"].(string); ok && text != "" {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+var (
+	_ plugin.RecursiveHandlerPlugin = (*Critique)(nil)
+)
@@ -0,0 +1,170 @@
+package flow
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// scriptedInvoker answers recursive calls with the text answer returns for
+// each request, one call at a time, recording the requests
+type scriptedInvoker struct {
+	answer func(req styles.PartialJSON) (string, error)
+
+	mu    sync.Mutex
+	calls []styles.PartialJSON
+}
+
+func (s *scriptedInvoker) InvokeHandler(w http.ResponseWriter, r *http.Request) error {
+	resp, err := s.InvokeHandlerCapture(r)
+	if err != nil {
+		return err
+	}
+	data, err := resp.Marshal()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+func (s *scriptedInvoker) InvokeHandlerCapture(r *http.Request) (styles.PartialJSON, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := styles.ParsePartialJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.calls = append(s.calls, req)
+	text, err := s.answer(req)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	resp := styles.PartialJSON{}
+	_ = resp.Set("object", "chat.completion")
+	_ = resp.Set("model", styles.TryGetFromPartialJSON[string](req, "model"))
+	_ = resp.Set("choices", []map[string]any{{"index": 0, "message": map[string]any{"role": "assistant", "content": text}, "finish_reason": "stop"}})
+	_ = resp.Set("usage", map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15})
+	return resp, nil
+}
+
+func (s *scriptedInvoker) InvokeHandlerCaptureHeaders(r *http.Request) (styles.PartialJSON, http.Header, error) {
+	resp, err := s.InvokeHandlerCapture(r)
+	return resp, http.Header{}, err
+}
+
+// lastMessage returns the text of a request's last message
+func lastMessage(req styles.PartialJSON) string {
+	messages, _ := styles.GetFromPartialJSON[[]styles.ChatCompletionsMessage](req, "messages")
+	if len(messages) == 0 {
+		return ""
+	}
+	return messageText(messages[len(messages)-1].Content)
+}
+
+func TestCritique(t *testing.T) {
+	tests := []struct {
+		name          string
+		params        string
+		critiqueErr   error
+		wantErr       bool
+		wantArtifacts int
+	}{
+		{"revision streamed through", "critic=judge", nil, false, 0},
+		{"revision with artifacts", "critic=judge,artifacts=true", nil, false, 2},
+		{"critique call fails", "critic=judge", errors.New("judge unavailable"), true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoker := &scriptedInvoker{answer: func(req styles.PartialJSON) (string, error) {
+				switch {
+				case styles.TryGetFromPartialJSON[string](req, "model") == "judge":
+					if tt.critiqueErr != nil {
+						return "", tt.critiqueErr
+					}
+					if !strings.Contains(lastMessage(req), "Draft answer:\n42") {
+						t.Errorf("expected the critic to review the draft, got %q", lastMessage(req))
+					}
+					return "The unit is missing.", nil
+				case strings.Contains(lastMessage(req), "A reviewer critiqued"):
+					return "42 km", nil
+				default:
+					return "42", nil
+				}
+			}}
+
+			reqJson := styles.PartialJSON{}
+			_ = reqJson.Set("model", "writer+critique")
+			_ = reqJson.Set("messages", []styles.ChatCompletionsMessage{{Role: "user", Content: "How far is it?"}})
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			w := httptest.NewRecorder()
+
+			handled, err := (&Critique{}).RecursiveHandler(tt.params, invoker, reqJson, w, r)
+			if !handled {
+				t.Fatal("expected the request to be handled")
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.critiqueErr) {
+					t.Errorf("expected the critique error, got %v", err)
+				}
+				if w.Body.Len() > 0 {
+					t.Errorf("expected nothing written, got %s", w.Body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RecursiveHandler returned error: %v", err)
+			}
+
+			// draft, critique, revision
+			if len(invoker.calls) != 3 {
+				t.Fatalf("expected 3 calls, got %d", len(invoker.calls))
+			}
+			revision := lastMessage(invoker.calls[2])
+			if !strings.Contains(revision, "The unit is missing.") {
+				t.Errorf("expected the critique folded into the revision request, got %q", revision)
+			}
+			if model := styles.TryGetFromPartialJSON[string](invoker.calls[2], "model"); model != "writer" {
+				t.Errorf("expected the drafter to revise, got %s", model)
+			}
+
+			resp, err := styles.ParsePartialJSON(w.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := responseText(resp); got != "42 km" {
+				t.Errorf("expected the revision as the answer, got %q", got)
+			}
+			if w.Header().Get("X-Critique-Rounds") != "1" {
+				t.Errorf("expected X-Critique-Rounds 1, got %q", w.Header().Get("X-Critique-Rounds"))
+			}
+			var extras struct {
+				Critique struct {
+					Artifacts []critiqueArtifact `json:"artifacts"`
+				} `json:"critique"`
+			}
+			if raw, ok := resp["extras"]; ok {
+				_ = json.Unmarshal(raw, &extras)
+			}
+			if got := len(extras.Critique.Artifacts); got != tt.wantArtifacts {
+				t.Errorf("expected %d artifacts, got %d", tt.wantArtifacts, got)
+			}
+			if tt.wantArtifacts > 0 && extras.Critique.Artifacts[1].Content != "The unit is missing." {
+				t.Errorf("expected the critique among the artifacts, got %+v", extras.Critique.Artifacts)
+			}
+		})
+	}
+}
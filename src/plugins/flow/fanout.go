@@ -0,0 +1,82 @@
+package flow
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// fanOutResult is the captured outcome of one fanned-out request
+type fanOutResult struct {
+	model    string
+	response styles.PartialJSON
+	err      error
+}
+
+// fanOut sends one non-streaming copy of the request per entry of overrides
+// concurrently and returns the results in the same order. Each override map
+// replaces top-level request fields (typically "model" and "temperature");
+// nil values remove the field.
+func fanOut(invoker plugin.HandlerInvoker, r *http.Request, reqJson styles.PartialJSON, overrides []map[string]any) []fanOutResult {
+	results := make([]fanOutResult, len(overrides))
+	var wg sync.WaitGroup
+
+	for i, fields := range overrides {
+		fields["stream"] = false
+		fields["stream_options"] = nil
+		model, _ := fields["model"].(string)
+		if model == "" {
+			model = styles.TryGetFromPartialJSON[string](reqJson, "model")
+		}
+		results[i].model = model
+
+		wg.Add(1)
+		go func(i int, fields map[string]any) {
+			defer wg.Done()
+			clonedReq, err := cloneRequestWith(r, reqJson, fields)
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			results[i].response, results[i].err = invoker.InvokeHandlerCapture(clonedReq)
+		}(i, fields)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// sumUsage adds up the usage of all successful responses
+func sumUsage(results []fanOutResult) *styles.ChatCompletionsUsage {
+	var total styles.ChatCompletionsUsage
+	found := false
+	for _, res := range results {
+		if _, ok := res.response["usage"]; res.err != nil || !ok {
+			continue
+		}
+		usage, err := styles.GetFromPartialJSON[styles.ChatCompletionsUsage](res.response, "usage")
+		if err != nil {
+			continue
+		}
+		found = true
+		total.Add(usage)
+	}
+	if !found {
+		return nil
+	}
+	return &total
+}
+
+// splitModels splits a "|"-separated model list from plugin params
+func splitModels(list string) []string {
+	var models []string
+	for _, m := range strings.Split(list, "|") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
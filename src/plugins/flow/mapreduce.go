@@ -0,0 +1,201 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/plugins"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// MapReduce answers requests whose input is too long for the model: the
+// longest user message (the document) is split into overlapping chunks, the
+// request is run on every chunk concurrently (map) and a final call combines
+// the partial answers (reduce).
+// Example: model="openai/gpt-4.1-mini+mapreduce:context=32000,chunk_size=8000,reduce=openai/gpt-4.1"
+//
+// Params:
+//   - context: estimated input tokens above which the request is chunked (default: 16000)
+//   - chunk_size: estimated tokens per chunk (default: 4000)
+//   - overlap: estimated tokens shared by consecutive chunks (default: 200)
+//   - max_chunks: refuse documents needing more chunks (default: 32)
+//   - map: model answering each chunk (default: the requested model)
+//   - reduce: model combining the partial answers (default: the map model)
+//
+// Requests within the context are served normally. The reduce answer is
+// streamed when the request asks for streaming.
+type MapReduce struct{}
+
+func (m *MapReduce) Name() string { return "mapreduce" }
+
+// RecursiveHandler runs the map calls over the document's chunks and the reduce call.
+func (m *MapReduce) RecursiveHandler(
+	params string,
+	invoker plugin.HandlerInvoker,
+	reqJson styles.PartialJSON,
+	w http.ResponseWriter,
+	r *http.Request,
+) (handled bool, err error) {
+	opts := plugins.ParseParams(params)
+	intParam := func(name string, def, lowest int) int {
+		if v, err := strconv.Atoi(opts[name]); err == nil && v >= lowest {
+			return v
+		}
+		return def
+	}
+	contextTokens := intParam("context", 16000, 1)
+	chunkSize := intParam("chunk_size", 4000, 1)
+	overlap := min(intParam("overlap", 200, 0), chunkSize/2)
+	maxChunks := intParam("max_chunks", 32, 1)
+
+	mapModel := opts["map"]
+	if mapModel == "" {
+		mapModel = withoutPlugin(styles.TryGetFromPartialJSON[string](reqJson, "model"), m.Name())
+	}
+	reduceModel := opts["reduce"]
+	if reduceModel == "" {
+		reduceModel = mapModel
+	}
+
+	var messages []json.RawMessage
+	if raw, ok := reqJson["messages"]; ok {
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return true, errs.Errorf(errs.ErrInvalidRequest, "mapreduce: invalid messages: %w", err)
+		}
+	}
+
+	total := 0
+	document, docText := -1, ""
+	for i, raw := range messages {
+		var msg styles.ChatCompletionsMessage
+		if json.Unmarshal(raw, &msg) != nil {
+			continue
+		}
+		text := messageText(msg.Content)
+		total += services.EstimateTokens(text)
+		if msg.Role == "user" && len(text) > len(docText) {
+			document, docText = i, text
+		}
+	}
+	if total <= contextTokens || document < 0 {
+		return false, nil
+	}
+
+	chunks := chunkText(docText, chunkSize, overlap)
+	if len(chunks) > maxChunks {
+		return true, errs.Errorf(errs.ErrInvalidRequest, "mapreduce: document needs %d chunks of %d tokens, at most %d allowed", len(chunks), chunkSize, maxChunks)
+	}
+	plugins.Logger.Debug("mapreduce plugin splitting document",
+		zap.Int("estimated_tokens", total), zap.Int("chunks", len(chunks)),
+		zap.String("map", mapModel), zap.String("reduce", reduceModel))
+
+	overrides := make([]map[string]any, len(chunks))
+	for i, chunk := range chunks {
+		part := fmt.Sprintf("[Part %d of %d of a longer document]\n%s", i+1, len(chunks), chunk)
+		overrides[i] = map[string]any{
+			"model":    mapModel,
+			"messages": withMessage(messages, document, part, mapReduceMapPrompt),
+		}
+	}
+	results := fanOut(invoker, r, reqJson, overrides)
+
+	var notes strings.Builder
+	for i, res := range results {
+		if res.err == nil && res.response == nil {
+			res.err = errs.Errorf(errs.ErrUpstream, "mapreduce: empty response from %s", res.model)
+		}
+		if res.err != nil {
+			return true, res.err
+		}
+		fmt.Fprintf(&notes, "\n\nNotes on part %d of %d:\n%s", i+1, len(chunks), strings.TrimSpace(responseText(res.response)))
+	}
+
+	reduceReq, err := cloneRequestWith(r, reqJson, map[string]any{
+		"model":    reduceModel,
+		"messages": withMessage(messages, document, "[The document was too long to read at once; these are notes taken on each of its parts]"+notes.String(), mapReduceReducePrompt),
+	})
+	if err != nil {
+		return true, err
+	}
+	w.Header().Set("X-MapReduce-Chunks", strconv.Itoa(len(chunks)))
+	return true, invoker.InvokeHandler(w, reduceReq)
+}
+
+const (
+	mapReduceMapPrompt = "You only see one part of a longer document. Answer the request using this part only, " +
+		"quoting the facts the answer relies on. If the part holds nothing relevant, say so in one sentence."
+	mapReduceReducePrompt = "The document was read in parts and you are given notes taken on each part. " +
+		"Combine them into a single answer to the request, resolving overlaps and ignoring parts without relevant content."
+)
+
+// withMessage returns the conversation with the text of message i replaced
+// and an instruction prepended as a system message
+func withMessage(messages []json.RawMessage, i int, text, instruction string) []any {
+	out := make([]any, 0, len(messages)+1)
+	out = append(out, styles.ChatCompletionsMessage{Role: "system", Content: instruction})
+	for j, msg := range messages {
+		if j == i {
+			out = append(out, styles.ChatCompletionsMessage{Role: "user", Content: text})
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// chunkText splits text into chunks of about size estimated tokens, each
+// starting about overlap tokens before the previous one ends. Chunks end at a
+// paragraph, line or word boundary in their last quarter when there is one.
+func chunkText(text string, size, overlap int) []string {
+	runes := []rune(text)
+	width := size * 4
+	shared := min(overlap*4, width/2)
+
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+width, len(runes))
+		if end < len(runes) {
+			end = chunkBoundary(runes, end-width/4, end)
+		}
+		chunks = append(chunks, strings.TrimSpace(string(runes[start:end])))
+		if end == len(runes) {
+			break
+		}
+		next := end - shared
+		for next < end && next > 0 && !unicode.IsSpace(runes[next-1]) {
+			// The overlap starts at a word
+			next++
+		}
+		start = max(next, start+1)
+	}
+	return chunks
+}
+
+// chunkBoundary returns the best place to cut runes within [from, to]:
+// after the last blank line, else the last newline, else the last space
+func chunkBoundary(runes []rune, from, to int) int {
+	for _, isBoundary := range []func(i int) bool{
+		func(i int) bool { return runes[i] == '\n' && runes[i-1] == '\n' },
+		func(i int) bool { return runes[i] == '\n' },
+		func(i int) bool { return unicode.IsSpace(runes[i]) },
+	} {
+		for i := to - 1; i > from && i > 0; i-- {
+			if isBoundary(i) {
+				return i + 1
+			}
+		}
+	}
+	return to
+}
+
+var (
+	_ plugin.RecursiveHandlerPlugin = (*MapReduce)(nil)
+)
@@ -0,0 +1,34 @@
+package flow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	paragraph := strings.Repeat("words ", 25) // 150 characters
+	text := strings.TrimSpace(strings.Repeat(paragraph+"\n\n", 6))
+
+	// 100 tokens are 400 characters: two paragraphs, cut at the blank line
+	chunks := chunkText(text, 100, 10)
+	if len(chunks) < 3 {
+		t.Fatalf("got %d chunks, want at least 3", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len([]rune(chunk)) > 400 {
+			t.Errorf("chunk %d has %d characters, want at most 400", i, len(chunk))
+		}
+		if !strings.HasPrefix(chunk, "words") || !strings.HasSuffix(chunk, "words") {
+			t.Errorf("chunk %d cuts a word: %q", i, chunk)
+		}
+	}
+	// Consecutive chunks overlap
+	tail := chunks[0][len(chunks[0])-20:]
+	if !strings.Contains(chunks[1], tail) {
+		t.Errorf("chunk 1 does not repeat the end of chunk 0 (%q)", tail)
+	}
+
+	if got := chunkText("short", 100, 10); len(got) != 1 || got[0] != "short" {
+		t.Errorf("chunkText(short) = %q", got)
+	}
+}
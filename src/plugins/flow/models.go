@@ -91,31 +91,14 @@ func (m *Models) RecursiveHandler(
 // Returns the list of models (without plugin suffix) and the plugin suffix separately.
 // This ensures recursive calls don't re-parse the models.
 func parseModelListForFallback(model string) ([]string, string) {
-	// First, extract plugin suffix if present
-	plusIdx := strings.IndexByte(model, '+')
-	modelPart := model
-	pluginSuffix := ""
-	if plusIdx >= 0 {
-		modelPart = model[:plusIdx]
-		pluginSuffix = model[plusIdx:]
+	spec := plugin.ParseModelSpec(model)
+	models := spec.Fallback()
+	if models == nil {
+		return []string{model}, spec.Suffix // Return original (may include plugin suffix)
 	}
-
-	if !strings.Contains(modelPart, ",") {
-		return []string{model}, pluginSuffix // Return original (may include plugin suffix)
-	}
-
-	parts := strings.Split(modelPart, ",")
-	var models []string
-	for _, m := range parts {
-		m = strings.TrimSpace(m)
-		if m != "" {
-			// Return individual models WITHOUT plugin suffix
-			// (plugin suffix is already parsed and plugins are in the chain)
-			models = append(models, m)
-		}
-	}
-
-	return models, pluginSuffix
+	// Individual models come WITHOUT plugin suffix
+	// (plugin suffix is already parsed and plugins are in the chain)
+	return models, spec.Suffix
 }
 
 var (
@@ -1,6 +1,7 @@
 package flow
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"strings"
@@ -17,7 +18,13 @@ import (
 // and merge responses (combining choices from all responses).
 //
 // This plugin implements RecursiveHandlerPlugin to fan-out requests to multiple models
-// and aggregate the results.
+// and aggregate the results. Streaming requests stream from every model; the
+// streams are reassembled and the merged response is sent as a single chunk.
+// Merged choices carry the model and provider that produced them.
+//
+// Params:
+//   - mode: "by_model" to answer with every model's response keyed by model
+//     instead of merged choices (always as JSON)
 type Parallel struct{}
 
 func (p *Parallel) Name() string { return "parallel" }
@@ -39,48 +46,38 @@ func (p *Parallel) RecursiveHandler(
 		return false, nil
 	}
 
-	// Check if streaming - parallel doesn't support streaming
 	stream := styles.TryGetFromPartialJSON[bool](reqJson, "stream")
-	if stream {
-		plugins.Logger.Warn("parallel plugin: streaming not supported for parallel requests, using first model only",
-			zap.Strings("models", models))
-		return false, nil
-	}
+	opts := plugins.ParseParams(params)
 
 	plugins.Logger.Debug("parallel plugin starting fan-out",
 		zap.Strings("models", models),
 		zap.String("plugin_suffix", pluginSuffix))
 
-	// Execute all models in parallel
-	type result struct {
-		model    string
-		response styles.PartialJSON
-		err      error
-	}
-
-	results := make(chan result, len(models))
+	// Execute all models in parallel; results keep the order of the models
+	results := make([]parallelResult, len(models))
 	var wg sync.WaitGroup
 
-	for _, currentModel := range models {
+	for i, currentModel := range models {
+		results[i].model = currentModel
 		wg.Add(1)
-		go func(model string) {
+		go func(res *parallelResult) {
 			defer wg.Done()
 
-			clonedJson, err := reqJson.CloneWith("model", model+pluginSuffix)
+			clonedJson, err := reqJson.CloneWith("model", res.model+pluginSuffix)
 			if err != nil {
 				plugins.Logger.Error("parallel plugin: failed to clone request JSON",
-					zap.String("model", model),
+					zap.String("model", res.model),
 					zap.Error(err))
-				results <- result{model: model, err: err}
+				res.err = err
 				return
 			}
 
 			reqData, err := clonedJson.Marshal()
 			if err != nil {
 				plugins.Logger.Error("parallel plugin: failed to marshal request JSON",
-					zap.String("model", model),
+					zap.String("model", res.model),
 					zap.Error(err))
-				results <- result{model: model, err: err}
+				res.err = err
 				return
 			}
 
@@ -89,40 +86,36 @@ func (p *Parallel) RecursiveHandler(
 			clonedReq.Body = io.NopCloser(strings.NewReader(string(reqData)))
 
 			// Invoke and capture the response
-			respJson, err := invoker.InvokeHandlerCapture(clonedReq)
+			respJson, header, err := invoker.InvokeHandlerCaptureHeaders(clonedReq)
 			if err != nil {
 				plugins.Logger.Debug("parallel plugin: model call failed",
-					zap.String("model", model),
+					zap.String("model", res.model),
 					zap.Error(err))
-				results <- result{model: model, err: err}
+				res.err = err
 				return
 			}
 
 			plugins.Logger.Debug("parallel plugin: model call succeeded",
-				zap.String("model", model))
-			results <- result{model: model, response: respJson}
-		}(currentModel)
+				zap.String("model", res.model))
+			res.response = respJson
+			res.provider = header.Get("X-Real-Provider-Id")
+		}(&results[i])
 	}
-
-	// Wait for all goroutines to complete
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+	wg.Wait()
 
 	// Collect results
-	var responses []styles.PartialJSON
+	var succeeded []parallelResult
 	var errors []error
-	for res := range results {
+	for _, res := range results {
 		if res.err != nil {
 			errors = append(errors, res.err)
-		} else {
-			responses = append(responses, res.response)
+		} else if res.response != nil {
+			succeeded = append(succeeded, res)
 		}
 	}
 
 	// If all failed, return the last error
-	if len(responses) == 0 {
+	if len(succeeded) == 0 {
 		plugins.Logger.Error("parallel plugin: all models failed",
 			zap.Strings("models", models),
 			zap.Int("error_count", len(errors)))
@@ -132,8 +125,18 @@ func (p *Parallel) RecursiveHandler(
 		return true, nil
 	}
 
+	if opts["mode"] == "by_model" {
+		keyed, err := keyParallelResponses(results)
+		if err != nil {
+			return true, err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(keyed)
+		return true, err
+	}
+
 	// Merge responses - combine choices from all successful responses
-	mergedResponse, err := mergeParallelResponses(responses)
+	mergedResponse, err := mergeParallelResponses(succeeded)
 	if err != nil {
 		plugins.Logger.Error("parallel plugin: failed to merge responses",
 			zap.Error(err))
@@ -141,112 +144,145 @@ func (p *Parallel) RecursiveHandler(
 	}
 
 	// Write merged response
-	w.Header().Set("Content-Type", "application/json")
-	respData, err := mergedResponse.Marshal()
-	if err != nil {
-		return true, err
+	if stream {
+		if err := writeResponseAsStream(w, mergedResponse); err != nil {
+			return true, err
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		respData, err := mergedResponse.Marshal()
+		if err != nil {
+			return true, err
+		}
+		w.Write(respData)
 	}
-	w.Write(respData)
 
 	plugins.Logger.Debug("parallel plugin completed",
-		zap.Int("successful_models", len(responses)),
+		zap.Int("successful_models", len(succeeded)),
 		zap.Int("failed_models", len(errors)))
 
 	return true, nil
 }
 
+// parallelResult is the outcome of one model of a parallel request
+type parallelResult struct {
+	model    string
+	provider string // provider that answered, from X-Real-Provider-Id
+	response styles.PartialJSON
+	err      error
+}
+
+// parallelChoice is a merged choice with the model and provider that produced it
+type parallelChoice struct {
+	styles.ChatCompletionsChoice
+	Model    string `json:"model,omitempty"`
+	Provider string `json:"provider,omitempty"`
+}
+
 // mergeParallelResponses merges multiple ChatCompletions responses into one.
-// It combines choices from all responses, re-indexing them sequentially.
+// It combines choices from all responses, re-indexing them sequentially and
+// tagging each with the model and provider that produced it, and sums usage.
 // Uses the first response as the base for ID, object, created, model, etc.
-func mergeParallelResponses(responses []styles.PartialJSON) (styles.PartialJSON, error) {
-	if len(responses) == 0 {
+func mergeParallelResponses(results []parallelResult) (styles.PartialJSON, error) {
+	if len(results) == 0 {
 		return nil, nil
 	}
 
-	if len(responses) == 1 {
-		return responses[0], nil
-	}
-
-	// Parse all responses to get choices
-	var allChoices []styles.ChatCompletionsChoice
+	var allChoices []parallelChoice
 	var totalUsage styles.ChatCompletionsUsage
 	hasUsage := false
 
-	for _, respJson := range responses {
-		resp, err := styles.ParseChatCompletionsResponse(respJson)
+	for _, res := range results {
+		resp, err := styles.ParseChatCompletionsResponse(res.response)
 		if err != nil {
 			plugins.Logger.Warn("parallel plugin: failed to parse response for merging",
+				zap.String("model", res.model),
 				zap.Error(err))
 			continue
 		}
 
+		model := resp.Model
+		if model == "" {
+			model = res.model
+		}
 		// Re-index choices and add to collection
 		for _, choice := range resp.Choices {
 			choice.Index = len(allChoices)
-			allChoices = append(allChoices, choice)
+			allChoices = append(allChoices, parallelChoice{ChatCompletionsChoice: choice, Model: model, Provider: res.provider})
 		}
 
 		// Sum up usage if present
 		if resp.Usage != nil {
 			hasUsage = true
-			totalUsage.PromptTokens += resp.Usage.PromptTokens
-			totalUsage.CompletionTokens += resp.Usage.CompletionTokens
-			totalUsage.TotalTokens += resp.Usage.TotalTokens
+			totalUsage.Add(*resp.Usage)
 		}
 	}
 
 	// Use first response as base and update choices
-	baseResp, err := styles.ParseChatCompletionsResponse(responses[0])
-	if err != nil {
+	merged := results[0].response.Clone()
+	if err := merged.Set("choices", allChoices); err != nil {
 		return nil, err
 	}
-
-	baseResp.Choices = allChoices
 	if hasUsage {
-		baseResp.Usage = &totalUsage
+		if err := merged.Set("usage", totalUsage); err != nil {
+			return nil, err
+		}
 	}
-
-	// Convert back to PartialJSON
-	return styles.PartiallyMarshalJSON(baseResp)
+	return merged, nil
 }
 
-// parseModelListForParallel parses a pipe-separated model string into a list.
-// Returns the list of models (without plugin suffix) and the plugin suffix separately.
-func parseModelListForParallel(model string) ([]string, string) {
-	// First, extract plugin suffix if present (after + or :)
-	plusIdx := strings.IndexByte(model, '+')
-	colonIdx := strings.IndexByte(model, ':')
-
-	modelPart := model
-	pluginSuffix := ""
+// keyParallelResponses builds the by_model answer: every model's response, or
+// its error, keyed by model, with usage summed across models
+func keyParallelResponses(results []parallelResult) ([]byte, error) {
+	responses := make(map[string]styles.PartialJSON)
+	errorsByModel := make(map[string]string)
+	var totalUsage styles.ChatCompletionsUsage
+	hasUsage := false
 
-	// Find the first delimiter (+ or :) that indicates plugin suffix
-	suffixIdx := -1
-	if plusIdx >= 0 && (colonIdx < 0 || plusIdx < colonIdx) {
-		suffixIdx = plusIdx
-	} else if colonIdx >= 0 {
-		suffixIdx = colonIdx
+	for _, res := range results {
+		if res.err != nil {
+			errorsByModel[res.model] = res.err.Error()
+			continue
+		}
+		if res.response == nil {
+			continue
+		}
+		response := res.response
+		if res.provider != "" {
+			response = response.Clone()
+			if err := response.Set("provider", res.provider); err != nil {
+				return nil, err
+			}
+		}
+		responses[res.model] = response
+		if usage, err := styles.GetFromPartialJSON[*styles.ChatCompletionsUsage](res.response, "usage"); err == nil && usage != nil {
+			hasUsage = true
+			totalUsage.Add(*usage)
+		}
 	}
 
-	if suffixIdx >= 0 {
-		modelPart = model[:suffixIdx]
-		pluginSuffix = model[suffixIdx:]
+	keyed := map[string]any{
+		"object":    "chat.completion.by_model",
+		"responses": responses,
 	}
-
-	if !strings.Contains(modelPart, "|") {
-		return []string{model}, "" // Return original if no pipe
+	if len(errorsByModel) > 0 {
+		keyed["errors"] = errorsByModel
 	}
-
-	parts := strings.Split(modelPart, "|")
-	var models []string
-	for _, m := range parts {
-		m = strings.TrimSpace(m)
-		if m != "" {
-			models = append(models, m)
-		}
+	if hasUsage {
+		keyed["usage"] = totalUsage
 	}
+	return json.Marshal(keyed)
+}
 
-	return models, pluginSuffix
+// parseModelListForParallel parses a pipe-separated model string into a list.
+// Returns the list of models (without plugin suffix) and the plugin suffix separately.
+func parseModelListForParallel(model string) ([]string, string) {
+	spec := plugin.ParseModelSpec(model)
+	models := spec.Parallel()
+	if models == nil {
+		return []string{model}, "" // Return original if no pipe
+	}
+	return models, spec.Suffix
 }
 
 var (
@@ -0,0 +1,88 @@
+package flow
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func parallelResponse(t *testing.T, model, content string, tokens int) styles.PartialJSON {
+	t.Helper()
+	res, err := styles.PartiallyMarshalJSON(map[string]any{
+		"id":      "res-" + model,
+		"object":  "chat.completion",
+		"model":   model,
+		"choices": []any{map[string]any{"index": 0, "message": map[string]any{"role": "assistant", "content": content}, "finish_reason": "stop"}},
+		"usage":   map[string]any{"prompt_tokens": tokens, "completion_tokens": tokens, "total_tokens": 2 * tokens},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestMergeParallelResponses(t *testing.T) {
+	merged, err := mergeParallelResponses([]parallelResult{
+		{model: "a", provider: "openai", response: parallelResponse(t, "gpt-a", "one", 1)},
+		{model: "b", provider: "groq", response: parallelResponse(t, "gpt-b", "two", 2)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		ID      string `json:"id"`
+		Choices []struct {
+			Index    int    `json:"index"`
+			Model    string `json:"model"`
+			Provider string `json:"provider"`
+			Message  struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage styles.ChatCompletionsUsage `json:"usage"`
+	}
+	data, _ := merged.Marshal()
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "res-gpt-a" || len(got.Choices) != 2 {
+		t.Fatalf("unexpected merged response %s", data)
+	}
+	if c := got.Choices[1]; c.Index != 1 || c.Model != "gpt-b" || c.Provider != "groq" || c.Message.Content != "two" {
+		t.Errorf("unexpected second choice %+v", c)
+	}
+	if got.Usage.TotalTokens != 6 || got.Usage.PromptTokens != 3 {
+		t.Errorf("expected summed usage, got %+v", got.Usage)
+	}
+}
+
+func TestKeyParallelResponses(t *testing.T) {
+	data, err := keyParallelResponses([]parallelResult{
+		{model: "a", provider: "openai", response: parallelResponse(t, "gpt-a", "one", 1)},
+		{model: "b", err: errors.New("boom")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Responses map[string]struct {
+			Model    string `json:"model"`
+			Provider string `json:"provider"`
+		} `json:"responses"`
+		Errors map[string]string           `json:"errors"`
+		Usage  styles.ChatCompletionsUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if r := got.Responses["a"]; r.Model != "gpt-a" || r.Provider != "openai" {
+		t.Errorf("unexpected response for a: %s", data)
+	}
+	if got.Errors["b"] != "boom" || got.Usage.TotalTokens != 2 {
+		t.Errorf("unexpected keyed response %s", data)
+	}
+}
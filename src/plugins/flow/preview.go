@@ -0,0 +1,258 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/plugins"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Preview streams a fast model's answer right away while the requested (premium)
+// model generates in parallel, then sends the premium answer as a final
+// "preview.final" SSE event before [DONE].
+// Example: model="openai/gpt-4.1+preview:groq/llama-8b" or
+// "openai/gpt-4.1+preview:model=groq/llama-8b,final=diff" to receive a line diff
+// against the preview instead of the full premium answer.
+//
+// Non-streaming requests are served by the premium model alone.
+type Preview struct{}
+
+func (p *Preview) Name() string { return "preview" }
+
+// PreviewFinalEvent is the SSE event name of the premium answer
+const PreviewFinalEvent = "preview.final"
+
+// RecursiveHandler streams the preview and appends the premium answer.
+func (p *Preview) RecursiveHandler(
+	params string,
+	invoker plugin.HandlerInvoker,
+	reqJson styles.PartialJSON,
+	w http.ResponseWriter,
+	r *http.Request,
+) (handled bool, err error) {
+	opts := plugins.ParseParams(params)
+	previewModel := opts["model"]
+	if previewModel == "" {
+		previewModel = opts[""]
+	}
+	if previewModel == "" || !styles.TryGetFromPartialJSON[bool](reqJson, "stream") {
+		return false, nil
+	}
+
+	premiumModel := withoutPlugin(styles.TryGetFromPartialJSON[string](reqJson, "model"), p.Name())
+
+	plugins.Logger.Debug("preview plugin starting",
+		zap.String("preview_model", previewModel),
+		zap.String("premium_model", premiumModel))
+
+	// Premium model runs non-streaming in the background
+	type premiumResult struct {
+		resp styles.PartialJSON
+		err  error
+	}
+	premiumDone := make(chan premiumResult, 1)
+	go func() {
+		premiumReq, err := cloneRequestWith(r, reqJson, map[string]any{"model": premiumModel, "stream": false})
+		if err != nil {
+			premiumDone <- premiumResult{err: err}
+			return
+		}
+		resp, err := invoker.InvokeHandlerCapture(premiumReq)
+		premiumDone <- premiumResult{resp: resp, err: err}
+	}()
+
+	// Preview model streams straight to the client, holding back its [DONE]
+	previewReq, err := cloneRequestWith(r, reqJson, map[string]any{"model": previewModel})
+	if err != nil {
+		return true, err
+	}
+	w.Header().Set("X-Preview-Model", previewModel)
+	pw := &previewWriter{ResponseWriter: w}
+	if err := invoker.InvokeHandler(pw, previewReq); err != nil {
+		plugins.Logger.Warn("preview plugin: preview model failed", zap.String("model", previewModel), zap.Error(err))
+	}
+
+	var result premiumResult
+	select {
+	case result = <-premiumDone:
+	case <-r.Context().Done():
+		result.err = r.Context().Err()
+	}
+
+	final := styles.PartialJSON{}
+	_ = final.Set("object", "chat.completion.preview_final")
+	_ = final.Set("model", premiumModel)
+	_ = final.Set("preview_model", previewModel)
+	if result.err == nil && result.resp == nil {
+		result.err = io.ErrUnexpectedEOF
+	}
+	if result.err != nil {
+		plugins.Logger.Warn("preview plugin: premium model failed", zap.String("model", premiumModel), zap.Error(result.err))
+		_ = final.Set("error", result.err.Error())
+	} else {
+		for _, key := range []string{"id", "created", "usage"} {
+			if v, ok := result.resp[key]; ok {
+				final[key] = v
+			}
+		}
+		if opts["final"] == "diff" {
+			_ = final.Set("diff", lineDiff(pw.text.String(), responseText(result.resp)))
+		} else if choices, ok := result.resp["choices"]; ok {
+			final["choices"] = choices
+		}
+	}
+
+	sseWriter := sse.NewWriter(w)
+	data, err := final.Marshal()
+	if err != nil {
+		return true, err
+	}
+	if err := sseWriter.WriteEvent(PreviewFinalEvent, data); err != nil {
+		return true, err
+	}
+	_ = sseWriter.WriteDone()
+	return true, nil
+}
+
+// previewWriter forwards the preview stream, dropping its [DONE] and
+// collecting the streamed text for diffs
+type previewWriter struct {
+	http.ResponseWriter
+	text strings.Builder
+}
+
+var sseDone = []byte("data: [DONE]\n\n")
+
+func (pw *previewWriter) Write(b []byte) (int, error) {
+	if bytes.Equal(b, sseDone) {
+		return len(b), nil
+	}
+	if data, ok := bytes.CutPrefix(b, []byte("data: ")); ok {
+		var chunk styles.ChatCompletionsResponse
+		if json.Unmarshal(bytes.TrimSpace(data), &chunk) == nil && len(chunk.Choices) > 0 && chunk.Choices[0].Delta != nil {
+			if text, ok := chunk.Choices[0].Delta.Content.(string); ok {
+				pw.text.WriteString(text)
+			}
+		}
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+func (pw *previewWriter) Flush() {
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// responseText returns the message content of the first choice of a response
+func responseText(resp styles.PartialJSON) string {
+	parsed, err := styles.ParseChatCompletionsResponse(resp)
+	if err != nil || len(parsed.Choices) == 0 || parsed.Choices[0].Message == nil {
+		return ""
+	}
+	text, _ := parsed.Choices[0].Message.Content.(string)
+	return text
+}
+
+// withoutPlugin removes a plugin (with its params) from a model's plugin suffix,
+// so a recursive call does not trigger the same plugin again
+func withoutPlugin(model, name string) string {
+	base, suffix, ok := services.CutModelSuffix(model)
+	if !ok {
+		return model
+	}
+	kept := []string{base}
+	for _, part := range services.SplitModelList(suffix, '+') {
+		pluginName, _, _ := strings.Cut(services.UnescapeModel(part), ":")
+		if part != "" && pluginName != name {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "+")
+}
+
+// cloneRequestWith clones the request with the given JSON fields replaced;
+// fields set to nil are removed
+func cloneRequestWith(r *http.Request, reqJson styles.PartialJSON, fields map[string]any) (*http.Request, error) {
+	clonedJson := reqJson.Clone()
+	for key, value := range fields {
+		if value == nil {
+			delete(clonedJson, key)
+			continue
+		}
+		if err := clonedJson.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+	data, err := clonedJson.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	clonedReq := r.Clone(r.Context())
+	clonedReq.Body = io.NopCloser(bytes.NewReader(data))
+	clonedReq.ContentLength = int64(len(data))
+	return clonedReq, nil
+}
+
+// lineDiff returns a minimal line diff turning a into b: unchanged lines are
+// prefixed with "  ", removed lines with "- " and added lines with "+ ".
+func lineDiff(a, b string) string {
+	al := strings.Split(a, "\n")
+	bl := strings.Split(b, "\n")
+
+	// Longest common subsequence table, too large inputs fall back to replace-all
+	if len(al)*len(bl) > 4_000_000 {
+		var out strings.Builder
+		for _, l := range al {
+			out.WriteString("- " + l + "\n")
+		}
+		for _, l := range bl {
+			out.WriteString("+ " + l + "\n")
+		}
+		return out.String()
+	}
+
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(al) || j < len(bl) {
+		switch {
+		case i < len(al) && j < len(bl) && al[i] == bl[j]:
+			out.WriteString("  " + al[i] + "\n")
+			i++
+			j++
+		case i < len(al) && (j == len(bl) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + al[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + bl[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
+
+var (
+	_ plugin.RecursiveHandlerPlugin = (*Preview)(nil)
+)
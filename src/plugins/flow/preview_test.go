@@ -0,0 +1,30 @@
+package flow
+
+import (
+	"testing"
+)
+
+func TestWithoutPlugin(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"openai/gpt-4.1+preview:groq/llama-8b", "openai/gpt-4.1"},
+		{"gpt-4+zip+preview:model=fast,final=diff+stools", "gpt-4+zip+stools"},
+		{"gpt-4+previewer", "gpt-4+previewer"},
+		{"gpt-4", "gpt-4"},
+	}
+	for _, tt := range tests {
+		if got := withoutPlugin(tt.model, "preview"); got != tt.want {
+			t.Errorf("withoutPlugin(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	got := lineDiff("a\nb\nc", "a\nx\nc")
+	want := "  a\n- b\n+ x\n  c\n"
+	if got != want {
+		t.Errorf("lineDiff = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,269 @@
+package flow
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/plugins"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"github.com/neutrome-labs/open-ai-router/src/tools"
+	"go.uber.org/zap"
+)
+
+// ToolLoop runs the router's built-in tools (see package tools) server-side:
+// their declarations are added to the request and, while the model calls only
+// built-in tools, the router executes the calls and sends the results back to
+// the model. The final answer is returned to the client.
+// Example: model="openai/gpt-4.1+tools:web" or "openai/gpt-4.1+tools:web,max_steps=8"
+//
+// Params:
+//   - leading value or names: "|"-separated built-in tools to enable (default: all registered)
+//   - max_steps: maximum tool rounds before the model must answer (default: 5)
+//
+// Tools restricted to some keys (tools.KeyScoped) are only offered to those keys.
+// A response calling a client-declared tool ends the loop and is returned as-is.
+// With the web tool enabled, web search tools and web_search_options are
+// removed from the request, the model browsing with the web tool instead.
+// Streaming requests receive the final answer as a single chunk.
+type ToolLoop struct{}
+
+func (t *ToolLoop) Name() string { return "tools" }
+
+// toolLoopCall records one executed tool call for extras
+type toolLoopCall struct {
+	Step  int    `json:"step"`
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// RecursiveHandler runs the model and the built-in tools until the model answers.
+func (t *ToolLoop) RecursiveHandler(
+	params string,
+	invoker plugin.HandlerInvoker,
+	reqJson styles.PartialJSON,
+	w http.ResponseWriter,
+	r *http.Request,
+) (handled bool, err error) {
+	opts := plugins.ParseParams(params)
+	names := splitModels(opts["names"])
+	if len(names) == 0 {
+		names = splitModels(opts[""])
+	}
+	if len(names) == 0 {
+		for name := range tools.Registry {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+	}
+	maxSteps := 5
+	if v, err := strconv.Atoi(opts["max_steps"]); err == nil && v >= 0 {
+		maxSteps = v
+	}
+
+	var declared []json.RawMessage
+	if raw, ok := reqJson["tools"]; ok {
+		if err := json.Unmarshal(raw, &declared); err != nil {
+			return true, errs.Errorf(errs.ErrInvalidRequest, "tools: invalid tools: %w", err)
+		}
+	}
+	clientTools := make(map[string]bool)
+	for _, raw := range declared {
+		var tool styles.ChatCompletionsTool
+		if json.Unmarshal(raw, &tool) == nil {
+			clientTools[tool.Name()] = true
+		}
+	}
+
+	keyID, _ := r.Context().Value(plugin.ContextKeyID()).(string)
+	enabled := make(map[string]tools.Tool)
+	toolList := make([]any, 0, len(declared)+len(names))
+	for _, raw := range declared {
+		toolList = append(toolList, raw)
+	}
+	for _, name := range names {
+		tool, ok := tools.GetTool(name)
+		if !ok {
+			return true, errs.Errorf(errs.ErrInvalidRequest, "tools: unknown built-in tool '%s'", name)
+		}
+		if clientTools[name] {
+			continue // the client implements a tool of the same name
+		}
+		if scoped, ok := tool.(tools.KeyScoped); ok && !scoped.EnabledFor(keyID) {
+			plugins.Logger.Debug("tools plugin: tool not enabled for key", zap.String("tool", name), zap.String("key_id", keyID))
+			continue
+		}
+		enabled[name] = tool
+		toolList = append(toolList, tool.Definition())
+	}
+	if len(enabled) == 0 {
+		return false, nil
+	}
+	_, searchFallback := enabled["web"]
+	if searchFallback {
+		// The web tool stands in for the search tools of providers
+		toolList = slices.DeleteFunc(toolList, isWebSearchTool)
+	}
+
+	var messages []any
+	if raw, ok := reqJson["messages"]; ok {
+		var rawMessages []json.RawMessage
+		if err := json.Unmarshal(raw, &rawMessages); err != nil {
+			return true, errs.Errorf(errs.ErrInvalidRequest, "tools: invalid messages: %w", err)
+		}
+		for _, m := range rawMessages {
+			messages = append(messages, m)
+		}
+	}
+
+	model := withoutPlugin(styles.TryGetFromPartialJSON[string](reqJson, "model"), t.Name())
+	var steps []fanOutResult
+	var calls []toolLoopCall
+
+	for step := 1; ; step++ {
+		fields := map[string]any{"model": model, "messages": messages, "tools": toolList}
+		if searchFallback {
+			fields["web_search_options"] = nil
+		}
+		switch {
+		case step > maxSteps:
+			fields["tool_choice"] = "none" // out of steps: the model must answer
+		case step > 1:
+			fields["tool_choice"] = nil // a forced choice applies to the first call only
+		}
+
+		res := fanOut(invoker, r, reqJson, []map[string]any{fields})[0]
+		if res.err == nil && res.response == nil {
+			res.err = errs.Errorf(errs.ErrUpstream, "tools: empty response from %s", res.model)
+		}
+		if res.err != nil {
+			return true, res.err
+		}
+		steps = append(steps, res)
+
+		parsed, err := styles.ParseChatCompletionsResponse(res.response)
+		if err != nil || len(parsed.Choices) == 0 || parsed.Choices[0].Message == nil {
+			break
+		}
+		message := parsed.Choices[0].Message
+		if len(message.ToolCalls) == 0 || step > maxSteps || !onlyTools(message.ToolCalls, enabled) {
+			break
+		}
+
+		messages = append(messages, rawFirstMessage(res.response))
+		for _, call := range message.ToolCalls {
+			tool := enabled[call.Function.Name]
+			content, err := tool.Call(r.Context(), call.Function.Arguments)
+			record := toolLoopCall{Step: step, Name: tool.Name()}
+			if err != nil {
+				record.Error = err.Error()
+				content = "Error: " + err.Error()
+			}
+			calls = append(calls, record)
+			plugins.Logger.Debug("tools plugin executed tool",
+				zap.Int("step", step), zap.String("tool", tool.Name()), zap.Error(err))
+			messages = append(messages, styles.ChatCompletionsMessage{Role: "tool", ToolCallID: call.ID, Content: content})
+		}
+	}
+
+	resp := steps[len(steps)-1].response.Clone()
+	if len(steps) > 1 {
+		if usage := sumUsage(steps); usage != nil {
+			_ = resp.Set("usage", usage)
+		}
+	}
+	if len(calls) > 0 {
+		_ = resp.Set("extras", map[string]any{
+			"tools": map[string]any{
+				"steps": len(steps),
+				"calls": calls,
+			},
+		})
+	}
+
+	if styles.TryGetFromPartialJSON[bool](reqJson, "stream") {
+		return true, writeResponseAsStream(w, resp)
+	}
+	data, err := resp.Marshal()
+	if err != nil {
+		return true, err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+	return true, nil
+}
+
+// isWebSearchTool reports whether a client-declared tool is a web search tool
+func isWebSearchTool(tool any) bool {
+	raw, ok := tool.(json.RawMessage)
+	if !ok {
+		return false
+	}
+	var declared styles.ChatCompletionsTool
+	return json.Unmarshal(raw, &declared) == nil && styles.IsWebSearchTool(declared.Type)
+}
+
+// rawFirstMessage returns the first choice's message as sent by the provider
+func rawFirstMessage(resp styles.PartialJSON) json.RawMessage {
+	var choices []struct {
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(resp["choices"], &choices); err != nil || len(choices) == 0 {
+		return nil
+	}
+	return choices[0].Message
+}
+
+// onlyTools reports whether every call targets one of the enabled tools
+func onlyTools(calls []styles.ChatCompletionsToolCall, enabled map[string]tools.Tool) bool {
+	for _, call := range calls {
+		if call.Function == nil {
+			return false
+		}
+		if _, ok := enabled[call.Function.Name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// writeResponseAsStream sends a complete response as a single-chunk SSE stream
+func writeResponseAsStream(w http.ResponseWriter, resp styles.PartialJSON) error {
+	parsed, err := styles.ParseChatCompletionsResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	chunk := resp.Clone()
+	_ = chunk.Set("object", "chat.completion.chunk")
+	choices := make([]styles.ChatCompletionsChoice, len(parsed.Choices))
+	for i, choice := range parsed.Choices {
+		choices[i] = styles.ChatCompletionsChoice{Index: choice.Index, Delta: choice.Message, FinishReason: choice.FinishReason}
+		if choice.Message != nil {
+			for k := range choice.Message.ToolCalls {
+				choice.Message.ToolCalls[k].Index = k
+			}
+		}
+	}
+	if err := chunk.Set("choices", choices); err != nil {
+		return err
+	}
+	data, err := chunk.Marshal()
+	if err != nil {
+		return err
+	}
+
+	sseWriter := sse.NewWriter(w)
+	if err := sseWriter.WriteRaw(data); err != nil {
+		return err
+	}
+	return sseWriter.WriteDone()
+}
+
+var (
+	_ plugin.RecursiveHandlerPlugin = (*ToolLoop)(nil)
+)
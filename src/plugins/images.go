@@ -0,0 +1,291 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	_ "image/gif" // decoder registration
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Images shrinks images in multimodal messages to provider limits before upload:
+// oversized images are downscaled and recompressed, and images beyond the
+// allowed count are dropped (oldest first). This prevents upstream 400s and
+// reduces vision token costs.
+// Example: model="anthropic/claude-sonnet+images:max_dim=1568,max_bytes=5000000,max_count=20"
+//
+// Params:
+//   - max_dim: maximum width and height in pixels (default: 2048)
+//   - max_bytes: maximum encoded image size in bytes (default: 5 MB)
+//   - max_count: maximum number of images per request, 0 for no limit (default: 0)
+//   - quality: JPEG quality of recompressed images (default: 85)
+//   - max_pixels: largest image, in width×height pixels, that is decoded; larger images are left unchanged (default: 50000000)
+//   - fetch: "true" to download http(s) images from public hosts and inline them when they exceed the limits (default: false)
+//
+// PNG, JPEG and GIF images are processed; other formats are passed through.
+type Images struct {
+	// Client downloads image URLs; when nil, a client with a 30s timeout that
+	// only connects to public addresses is used
+	Client *http.Client
+}
+
+func (f *Images) Name() string { return "images" }
+
+// imageLimits are the resolved plugin params
+type imageLimits struct {
+	maxDim    int
+	maxBytes  int
+	maxCount  int
+	maxPixels int
+	quality   int
+	fetch     bool
+}
+
+// imageFetchFactor bounds downloads to a multiple of max_bytes, since
+// downloaded images are recompressed
+const imageFetchFactor = 8
+
+func (f *Images) Before(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	opts := ParseParams(params)
+	limits := imageLimits{maxDim: 2048, maxBytes: 5_000_000, maxPixels: 50_000_000, quality: 85, fetch: opts["fetch"] == "true"}
+	if v, err := strconv.Atoi(opts["max_dim"]); err == nil && v > 0 {
+		limits.maxDim = v
+	}
+	if v, err := strconv.Atoi(opts["max_bytes"]); err == nil && v > 0 {
+		limits.maxBytes = v
+	}
+	if v, err := strconv.Atoi(opts["max_count"]); err == nil && v >= 0 {
+		limits.maxCount = v
+	}
+	if v, err := strconv.Atoi(opts["max_pixels"]); err == nil && v > 0 {
+		limits.maxPixels = v
+	}
+	if v, err := strconv.Atoi(opts["quality"]); err == nil && v > 0 && v <= 100 {
+		limits.quality = v
+	}
+
+	messages, err := styles.GetFromPartialJSON[[]styles.ChatCompletionsMessage](reqJson, "messages")
+	if err != nil {
+		return reqJson, err
+	}
+
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+	}
+
+	// Count images to drop the oldest ones beyond max_count
+	total := 0
+	for _, msg := range messages {
+		if parts, ok := msg.Content.([]any); ok {
+			for _, part := range parts {
+				if _, ok := imagePartURL(part); ok {
+					total++
+				}
+			}
+		}
+	}
+	drop := 0
+	if limits.maxCount > 0 && total > limits.maxCount {
+		drop = total - limits.maxCount
+	}
+
+	changed := false
+	for i, msg := range messages {
+		parts, ok := msg.Content.([]any)
+		if !ok {
+			continue
+		}
+		for j, part := range parts {
+			imageURL, ok := imagePartURL(part)
+			if !ok {
+				continue
+			}
+			if drop > 0 {
+				drop--
+				parts[j] = map[string]any{"type": "text", "text": "[image omitted]"}
+				changed = true
+				continue
+			}
+
+			processed, err := f.processImage(ctx, imageURL, limits)
+			if err != nil {
+				Logger.Warn("images plugin: image left unchanged", zap.Error(err))
+				continue
+			}
+			if processed != imageURL {
+				part.(map[string]any)["image_url"].(map[string]any)["url"] = processed
+				changed = true
+			}
+		}
+		messages[i].Content = parts
+	}
+
+	if !changed {
+		return reqJson, nil
+	}
+	return reqJson.CloneWith("messages", messages)
+}
+
+// imagePartURL returns the URL of an image_url content part
+func imagePartURL(part any) (string, bool) {
+	m, ok := part.(map[string]any)
+	if !ok || m["type"] != "image_url" {
+		return "", false
+	}
+	img, ok := m["image_url"].(map[string]any)
+	if !ok {
+		return "", false
+	}
+	u, ok := img["url"].(string)
+	return u, ok && u != ""
+}
+
+// processImage returns the image URL unchanged when the image is within the
+// limits, or a data URL of the shrunk image otherwise
+func (f *Images) processImage(ctx context.Context, imageURL string, limits imageLimits) (string, error) {
+	var data []byte
+	if rest, ok := strings.CutPrefix(imageURL, "data:"); ok {
+		meta, encoded, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(meta, ";base64") {
+			return imageURL, fmt.Errorf("unsupported data URL")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return imageURL, fmt.Errorf("invalid base64 image data")
+		}
+		data = decoded
+	} else {
+		if !limits.fetch {
+			return imageURL, nil
+		}
+		fetched, _, err := fetchURL(ctx, f.Client, imageURL, limits.maxBytes*imageFetchFactor)
+		if err != nil {
+			return imageURL, err
+		}
+		data = fetched
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return imageURL, fmt.Errorf("unsupported image: %w", err)
+	}
+	if len(data) <= limits.maxBytes && cfg.Width <= limits.maxDim && cfg.Height <= limits.maxDim {
+		return imageURL, nil
+	}
+	// Decoding allocates per pixel, whatever the encoded size
+	if int64(cfg.Width)*int64(cfg.Height) > int64(limits.maxPixels) {
+		return imageURL, fmt.Errorf("image of %dx%d pixels exceeds %d pixels", cfg.Width, cfg.Height, limits.maxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return imageURL, err
+	}
+	out, mediaType, err := shrinkImage(img, limits)
+	if err != nil {
+		return imageURL, err
+	}
+
+	Logger.Debug("images plugin shrunk image",
+		zap.String("format", format),
+		zap.Int("width", cfg.Width),
+		zap.Int("height", cfg.Height),
+		zap.Int("bytes_before", len(data)),
+		zap.Int("bytes_after", len(out)))
+
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// shrinkImage fits the image into max_dim and encodes it under max_bytes,
+// lowering the scale until it fits. Opaque images are encoded as JPEG, images
+// with transparency as PNG.
+func shrinkImage(img image.Image, limits imageLimits) ([]byte, string, error) {
+	b := img.Bounds()
+	scale := 1.0
+	if longest := max(b.Dx(), b.Dy()); longest > limits.maxDim {
+		scale = float64(limits.maxDim) / float64(longest)
+	}
+	opaque := isOpaque(img)
+
+	for attempt := 0; attempt < 6; attempt++ {
+		w := max(1, int(float64(b.Dx())*scale))
+		h := max(1, int(float64(b.Dy())*scale))
+		resized := resizeImage(img, w, h)
+
+		var buf bytes.Buffer
+		mediaType := "image/png"
+		if opaque {
+			mediaType = "image/jpeg"
+			if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: limits.quality}); err != nil {
+				return nil, "", err
+			}
+		} else if err := png.Encode(&buf, resized); err != nil {
+			return nil, "", err
+		}
+		if buf.Len() <= limits.maxBytes {
+			return buf.Bytes(), mediaType, nil
+		}
+		scale *= 0.75
+	}
+	return nil, "", fmt.Errorf("image does not fit in %d bytes", limits.maxBytes)
+}
+
+// isOpaque reports whether an image has no transparent pixels
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// resizeImage scales an image to w×h by averaging the source pixels covered
+// by each target pixel (box filter), which is adequate for downscaling
+func resizeImage(img image.Image, w, h int) *image.RGBA {
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max(y0+1, (y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max(x0+1, (x+1)*sw/w)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					px := row[sx*4 : sx*4+4]
+					r += uint32(px[0])
+					g += uint32(px[1])
+					b += uint32(px[2])
+					a += uint32(px[3])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+var (
+	_ plugin.BeforePlugin = (*Images)(nil)
+)
@@ -0,0 +1,135 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// testPNG encodes a w×h PNG, opaque or half transparent
+func testPNG(t *testing.T, w, h int, opaque bool) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := uint8(255)
+			if !opaque && x < w/2 {
+				a = 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: a})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func dataURL(mediaType string, data []byte) string {
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func imageRequest(imageURL string) styles.PartialJSON {
+	reqJson := styles.PartialJSON{}
+	_ = reqJson.Set("model", "test")
+	_ = reqJson.Set("messages", []styles.ChatCompletionsMessage{
+		{Role: "user", Content: []any{
+			map[string]any{"type": "text", "text": "What is this?"},
+			map[string]any{"type": "image_url", "image_url": map[string]any{"url": imageURL}},
+		}},
+	})
+	return reqJson
+}
+
+func imageURLOf(t *testing.T, out styles.PartialJSON) string {
+	t.Helper()
+	messages, err := styles.GetFromPartialJSON[[]styles.ChatCompletionsMessage](out, "messages")
+	if err != nil {
+		t.Fatalf("failed to read messages: %v", err)
+	}
+	u, _ := imagePartURL(messages[0].Content.([]any)[1])
+	return u
+}
+
+func TestImages_Shrink(t *testing.T) {
+	tests := []struct {
+		name      string
+		opaque    bool
+		params    string
+		mediaType string
+		changed   bool
+	}{
+		{"within limits", true, "max_dim=200", "", false},
+		{"opaque resized to jpeg", true, "max_dim=40", "image/jpeg", true},
+		{"transparent resized to png", false, "max_dim=40", "image/png", true},
+		{"too many pixels", true, "max_dim=40,max_pixels=1000", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := dataURL("image/png", testPNG(t, 160, 80, tt.opaque))
+			out, err := (&Images{}).Before(tt.params, nil, nil, imageRequest(in))
+			if err != nil {
+				t.Fatalf("Before returned error: %v", err)
+			}
+			got := imageURLOf(t, out)
+			if !tt.changed {
+				if got != in {
+					t.Error("expected the image to be left unchanged")
+				}
+				return
+			}
+
+			prefix := "data:" + tt.mediaType + ";base64,"
+			if !strings.HasPrefix(got, prefix) {
+				t.Fatalf("expected a %s data URL, got %.40q", tt.mediaType, got)
+			}
+			data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(got, prefix))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("shrunk image does not decode: %v", err)
+			}
+			if cfg.Width != 40 || cfg.Height != 20 {
+				t.Errorf("expected 40x20, got %dx%d", cfg.Width, cfg.Height)
+			}
+		})
+	}
+}
+
+func TestImages_Fetch(t *testing.T) {
+	body := testPNG(t, 160, 80, true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	imageURL := server.URL + "/photo.png"
+
+	// Loopback addresses are refused by the default client
+	out, err := (&Images{}).Before("max_dim=40,fetch=true", nil, nil, imageRequest(imageURL))
+	if err != nil {
+		t.Fatalf("Before returned error: %v", err)
+	}
+	if got := imageURLOf(t, out); got != imageURL {
+		t.Errorf("expected the loopback image to be left to the provider, got %.40q", got)
+	}
+
+	out, err = (&Images{Client: server.Client()}).Before("max_dim=40,fetch=true", nil, nil, imageRequest(imageURL))
+	if err != nil {
+		t.Fatalf("Before returned error: %v", err)
+	}
+	if got := imageURLOf(t, out); !strings.HasPrefix(got, "data:image/jpeg;base64,") {
+		t.Errorf("expected the fetched image inlined, got %.40q", got)
+	}
+}
@@ -0,0 +1,86 @@
+package plugins
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Mask white-labels responses: it rewrites the metadata that tells which
+// upstream vendor served a request, in responses and in every stream chunk.
+//   - model: replaces the response model (kept when not set)
+//   - fingerprint: replaces system_fingerprint (removed when not set)
+//   - id: replaces the vendor prefix of the response ID, e.g. "chatcmpl-",
+//     "gen-" or "msg_" (default "chatcmpl-")
+//
+// The provider field some gateways add to responses is always removed.
+//
+// Example: model="anthropic/claude-sonnet-4+mask:model=acme-large,id=acme-"
+type Mask struct{}
+
+func (m *Mask) Name() string { return "mask" }
+
+func (m *Mask) After(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, resJson styles.PartialJSON) (styles.PartialJSON, error) {
+	return maskResponse(ParseParams(params), resJson)
+}
+
+func (m *Mask) AfterChunk(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, chunk styles.PartialJSON) (styles.PartialJSON, error) {
+	return maskResponse(ParseParams(params), chunk)
+}
+
+// maskResponse rewrites the identifying fields of a response or chunk
+func maskResponse(opts map[string]string, doc styles.PartialJSON) (styles.PartialJSON, error) {
+	if doc == nil {
+		return doc, nil
+	}
+	masked := doc.Clone()
+	delete(masked, "provider")
+
+	if model, ok := opts["model"]; ok && model != "" {
+		if _, present := masked["model"]; present {
+			if err := masked.Set("model", model); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if fingerprint := opts["fingerprint"]; fingerprint != "" {
+		if _, present := masked["system_fingerprint"]; present {
+			if err := masked.Set("system_fingerprint", fingerprint); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		delete(masked, "system_fingerprint")
+	}
+
+	if id := styles.TryGetFromPartialJSON[string](masked, "id"); id != "" {
+		prefix, ok := opts["id"]
+		if !ok {
+			prefix = "chatcmpl-"
+		}
+		if err := masked.Set("id", prefix+stripIDPrefix(id)); err != nil {
+			return nil, err
+		}
+	}
+	return masked, nil
+}
+
+// stripIDPrefix removes a vendor prefix such as "chatcmpl-", "gen-" or "msg_"
+// from a response ID. Only a short leading word counts as a prefix, so IDs
+// without one are kept whole.
+func stripIDPrefix(id string) string {
+	i := strings.IndexAny(id, "-_")
+	if i <= 0 || i > 12 || i == len(id)-1 {
+		return id
+	}
+	return id[i+1:]
+}
+
+var (
+	_ plugin.AfterPlugin       = (*Mask)(nil)
+	_ plugin.StreamChunkPlugin = (*Mask)(nil)
+)
@@ -0,0 +1,56 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestMaskRewritesVendorMetadata(t *testing.T) {
+	res, err := styles.ParsePartialJSON([]byte(`{
+		"id": "gen-1712-abc",
+		"object": "chat.completion",
+		"model": "anthropic/claude-sonnet-4",
+		"provider": "Anthropic",
+		"system_fingerprint": "fp_44709d6fcb",
+		"choices": []
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := (&Mask{}).After("model=acme-large,id=acme-", nil, nil, nil, nil, res)
+	if err != nil {
+		t.Fatalf("After returned error: %v", err)
+	}
+	if got := styles.TryGetFromPartialJSON[string](out, "model"); got != "acme-large" {
+		t.Errorf("model = %q, want acme-large", got)
+	}
+	if got := styles.TryGetFromPartialJSON[string](out, "id"); got != "acme-1712-abc" {
+		t.Errorf("id = %q, want acme-1712-abc", got)
+	}
+	for _, key := range []string{"provider", "system_fingerprint"} {
+		if _, ok := out[key]; ok {
+			t.Errorf("expected %s to be removed", key)
+		}
+	}
+	if styles.TryGetFromPartialJSON[string](res, "provider") != "Anthropic" {
+		t.Error("expected the original response to be left unchanged")
+	}
+
+	// Chunks get the same rewrite; defaults keep the model and use chatcmpl-
+	chunk, _ := styles.ParsePartialJSON([]byte(`{"id": "msg_01XYZ", "model": "claude-sonnet-4", "system_fingerprint": "fp_1"}`))
+	out, err = (&Mask{}).AfterChunk("fingerprint=fp_acme", nil, nil, nil, nil, chunk)
+	if err != nil {
+		t.Fatalf("AfterChunk returned error: %v", err)
+	}
+	if got := styles.TryGetFromPartialJSON[string](out, "id"); got != "chatcmpl-01XYZ" {
+		t.Errorf("id = %q, want chatcmpl-01XYZ", got)
+	}
+	if got := styles.TryGetFromPartialJSON[string](out, "model"); got != "claude-sonnet-4" {
+		t.Errorf("model = %q, want it kept", got)
+	}
+	if got := styles.TryGetFromPartialJSON[string](out, "system_fingerprint"); got != "fp_acme" {
+		t.Errorf("system_fingerprint = %q, want fp_acme", got)
+	}
+}
@@ -0,0 +1,25 @@
+package plugins
+
+import "strings"
+
+// ParseParams parses plugin parameters of the form "key=value,key2=value2".
+// A leading value without a key (e.g. "groq/llama-8b,final=diff") is returned
+// under the empty key.
+func ParseParams(params string) map[string]string {
+	values := make(map[string]string)
+	for i, part := range strings.Split(params, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			if i == 0 {
+				values[""] = part
+			}
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values
+}
@@ -2,146 +2,47 @@ package plugins
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/neutrome-labs/open-ai-router/src/errs"
 	"github.com/neutrome-labs/open-ai-router/src/plugin"
 	"github.com/neutrome-labs/open-ai-router/src/services"
 	"github.com/neutrome-labs/open-ai-router/src/styles"
 )
 
-// streamAccumulator holds accumulated content from streaming chunks
-type streamAccumulator struct {
-	mu       sync.Mutex
-	choices  map[int]*choiceAccum // indexed by choice index
-	model    string
-	systemFP string
-}
+// Event names sent to PostHog besides $ai_generation
+const (
+	posthogErrorEvent    = "ai_error"     // a provider call failed
+	posthogFallbackEvent = "ai_fallback"  // a request succeeded after other providers failed
+	posthogCacheHitEvent = "ai_cache_hit" // the provider served part of the prompt from its cache
+)
 
-type choiceAccum struct {
-	role         string
-	content      strings.Builder
-	toolCalls    []styles.ChatCompletionsToolCall
-	finishReason string
+// posthogAttempts records the providers that failed for a request, across
+// the provider attempts of one request
+type posthogAttempts struct {
+	mu     sync.Mutex
+	failed []string
 }
 
-func newStreamAccumulator() *streamAccumulator {
-	return &streamAccumulator{
-		choices: make(map[int]*choiceAccum),
-	}
+func (a *posthogAttempts) fail(provider string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failed = append(a.failed, provider)
 }
 
-// accumulate merges a streaming chunk into the accumulator
-func (sa *streamAccumulator) accumulate(chunk styles.PartialJSON) {
-	sa.mu.Lock()
-	defer sa.mu.Unlock()
-
-	// Extract model if present
-	model := styles.TryGetFromPartialJSON[string](chunk, "model")
-	if model != "" {
-		sa.model = model
-	}
-
-	// Extract choices
-	choicesRaw, ok := chunk["choices"]
-	if !ok {
-		return
-	}
-
-	var choices []styles.ChatCompletionsChoice
-	if err := json.Unmarshal(choicesRaw, &choices); err != nil {
-		return
-	}
-
-	for _, choice := range choices {
-		idx := choice.Index
-
-		accum, exists := sa.choices[idx]
-		if !exists {
-			accum = &choiceAccum{}
-			sa.choices[idx] = accum
-		}
-
-		if choice.FinishReason != "" {
-			accum.finishReason = choice.FinishReason
-		}
-
-		if choice.Delta != nil {
-			if choice.Delta.Role != "" {
-				accum.role = choice.Delta.Role
-			}
-			if content, ok := choice.Delta.Content.(string); ok {
-				accum.content.WriteString(content)
-			}
-
-			// accumulate tool calls
-			for _, tc := range choice.Delta.ToolCalls {
-				tcIdx := tc.Index
-
-				// extend slice if needed
-				for len(accum.toolCalls) <= tcIdx {
-					accum.toolCalls = append(accum.toolCalls, styles.ChatCompletionsToolCall{})
-				}
-
-				existing := &accum.toolCalls[tcIdx]
-				if tc.ID != "" {
-					existing.ID = tc.ID
-				}
-				if tc.Type != "" {
-					existing.Type = tc.Type
-				}
-				if tc.Function != nil {
-					if existing.Function == nil {
-						existing.Function = &struct {
-							Name      string `json:"name,omitempty"`
-							Arguments string `json:"arguments,omitempty"`
-						}{}
-					}
-					if tc.Function.Name != "" {
-						existing.Function.Name = tc.Function.Name
-					}
-					if tc.Function.Arguments != "" {
-						existing.Function.Arguments += tc.Function.Arguments
-					}
-				}
-			}
-		}
-	}
+func (a *posthogAttempts) failures() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.failed...)
 }
 
-// buildChoices constructs the final choices array for the event
-func (sa *streamAccumulator) buildChoices() []map[string]any {
-	sa.mu.Lock()
-	defer sa.mu.Unlock()
-
-	result := make([]map[string]any, 0, len(sa.choices))
-	for idx := 0; idx < len(sa.choices); idx++ {
-		accum, ok := sa.choices[idx]
-		if !ok {
-			continue
-		}
-
-		message := map[string]any{
-			"role":    accum.role,
-			"content": accum.content.String(),
-		}
-		if len(accum.toolCalls) > 0 {
-			message["tool_calls"] = accum.toolCalls
-		}
-
-		result = append(result, map[string]any{
-			"index":         idx,
-			"message":       message,
-			"finish_reason": accum.finishReason,
-		})
-	}
-	return result
-}
-
-// Posthog provides observability via PostHog
+// Posthog builds the observability events of a request and sends them to the
+// router's sinks (PostHog by default, see services.ObservabilitySink). PostHog
+// events go to the project named in the request context (see
+// plugin.ContextPosthogProject), else the project whose keys match the
+// request's key ID, else the router's posthog_project, else the default project.
 type Posthog struct{}
 
 func (p *Posthog) Name() string { return "posthog" }
@@ -149,7 +50,10 @@ func (p *Posthog) Name() string { return "posthog" }
 func (p *Posthog) Before(params string, provider *services.ProviderService, r *http.Request, reqJson styles.PartialJSON) (styles.PartialJSON, error) {
 	ctx := r.Context()
 	ctx = context.WithValue(ctx, posthogTimeStartKey, time.Now())
-	ctx = context.WithValue(ctx, posthogStreamAccumKey, newStreamAccumulator())
+	ctx = context.WithValue(ctx, posthogStreamAccumKey, services.NewStreamAccumulator())
+	if _, ok := ctx.Value(posthogAttemptsKey).(*posthogAttempts); !ok {
+		ctx = context.WithValue(ctx, posthogAttemptsKey, &posthogAttempts{})
+	}
 	*r = *r.WithContext(ctx)
 	return reqJson, nil
 }
@@ -163,8 +67,8 @@ func (p *Posthog) AfterChunk(params string, provider *services.ProviderService,
 	// Accumulate chunk content for final event
 	ctx := r.Context()
 	if accumVal := ctx.Value(posthogStreamAccumKey); accumVal != nil {
-		if accum, ok := accumVal.(*streamAccumulator); ok {
-			accum.accumulate(chunk)
+		if accum, ok := accumVal.(*services.StreamAccumulator); ok {
+			accum.Accumulate(chunk)
 		}
 	}
 	// Don't fire events for intermediate chunks
@@ -179,22 +83,91 @@ func (p *Posthog) StreamEnd(params string, provider *services.ProviderService, r
 func (p *Posthog) OnError(params string, provider *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, providerErr error) error {
 	isStreaming := styles.TryGetFromPartialJSON[bool](reqJson, "stream")
 	p.fireEvent(provider, r, reqJson, res, nil, isStreaming, providerErr)
+	if attempts, ok := r.Context().Value(posthogAttemptsKey).(*posthogAttempts); ok && provider != nil {
+		attempts.fail(provider.Name)
+	}
 	return nil
 }
 
 func (p *Posthog) fireEvent(provider *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, hres *http.Response, resJson styles.PartialJSON, isStreaming bool, providerErr error) {
 	ctx := r.Context()
 	userId, _ := ctx.Value(plugin.ContextUserID()).(string)
+	project := posthogProjectFor(provider, r)
 
 	// Extract common props
 	props := p.extractCommonProps(provider, r, reqJson, hres, resJson, isStreaming, providerErr)
 
-	if provider.Style == styles.StyleChatCompletions {
+	if providerErr != nil {
+		errProps := posthogSummaryProps(props)
+		errProps["error_class"] = string(services.ClassifyError(providerErr))
+		errProps["error_kind"] = errs.Kind(providerErr)
+		errProps["$ai_error_message"] = providerErr.Error()
+		p.emit(provider, project, userId, posthogErrorEvent, errProps)
+	} else if attempts, ok := ctx.Value(posthogAttemptsKey).(*posthogAttempts); ok {
+		if failed := attempts.failures(); len(failed) > 0 {
+			fallbackProps := posthogSummaryProps(props)
+			fallbackProps["failed_providers"] = failed
+			fallbackProps["attempts"] = len(failed) + 1
+			p.emit(provider, project, userId, posthogFallbackEvent, fallbackProps)
+		}
+	}
+	if cached, ok := props["$ai_cache_read_input_tokens"]; ok {
+		cacheProps := posthogSummaryProps(props)
+		cacheProps["$ai_cache_read_input_tokens"] = cached
+		cacheProps["$ai_input_tokens"] = props["$ai_input_tokens"]
+		p.emit(provider, project, userId, posthogCacheHitEvent, cacheProps)
+	}
+
+	if styles.WireStyle(provider.Style) == styles.StyleChatCompletions {
 		// Extract chat completions specific props
 		p.extractChatCompletionsProps(props, reqJson, resJson, isStreaming, ctx)
 	}
 
-	_ = services.FireObservabilityEvent(userId, "", "$ai_generation", props)
+	p.emit(provider, project, userId, "$ai_generation", props)
+}
+
+// emit sends an event to the sinks of the provider's router
+func (p *Posthog) emit(provider *services.ProviderService, project, userId, name string, props map[string]any) {
+	var router *services.RouterService
+	if provider != nil {
+		router = provider.Router
+	}
+	_ = services.EmitObservabilityEvent(router, services.ObservabilityEvent{
+		Name:       name,
+		DistinctID: userId,
+		Project:    project,
+		Properties: props,
+	})
+}
+
+// posthogSummaryProps copies the props identifying a request, for the events
+// sent alongside $ai_generation
+func posthogSummaryProps(props map[string]any) map[string]any {
+	keys := []string{"$ai_trace_id", "$ai_provider", "$ai_model", "$ai_http_status", "$ai_stream"}
+	out := make(map[string]any, len(keys))
+	for _, key := range keys {
+		if v, ok := props[key]; ok {
+			out[key] = v
+		}
+	}
+	return out
+}
+
+// posthogProjectFor selects the PostHog project receiving a request's events;
+// "" is the default project
+func posthogProjectFor(provider *services.ProviderService, r *http.Request) string {
+	ctx := r.Context()
+	if project, _ := ctx.Value(plugin.ContextPosthogProject()).(string); project != "" {
+		return project
+	}
+	keyID, _ := ctx.Value(plugin.ContextKeyID()).(string)
+	if project, ok := services.PosthogProjectForKey(keyID); ok {
+		return project
+	}
+	if provider != nil && provider.Router != nil {
+		return provider.Router.PosthogProject
+	}
+	return ""
 }
 
 func (p *Posthog) extractCommonProps(provider *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, hres *http.Response, resJson styles.PartialJSON, isStreaming bool, providerErr error) map[string]any {
@@ -202,9 +175,16 @@ func (p *Posthog) extractCommonProps(provider *services.ProviderService, r *http
 	traceId, _ := ctx.Value(plugin.ContextTraceID()).(string)
 	startTime, _ := ctx.Value(posthogTimeStartKey).(time.Time)
 
-	var latency float64
+	var latency, timeToFirstToken float64
 	if !startTime.IsZero() {
 		latency = time.Since(startTime).Seconds()
+		// A complete response arrives at once; a stream from its first chunk
+		timeToFirstToken = latency
+		if accum, ok := ctx.Value(posthogStreamAccumKey).(*services.StreamAccumulator); ok && isStreaming {
+			if first := accum.FirstChunk(); !first.IsZero() {
+				timeToFirstToken = first.Sub(startTime).Seconds()
+			}
+		}
 	}
 
 	// Determine error state
@@ -254,9 +234,26 @@ func (p *Posthog) extractCommonProps(provider *services.ProviderService, r *http
 		"$ai_http_status": httpStatus,
 	}
 
+	// Recursive plugins nest handler invocations under the client request's trace
+	if trace, ok := plugin.TraceFromContext(r.Context()); ok {
+		props["$ai_span_id"] = trace.SpanID
+		if trace.ParentSpanID != "" {
+			props["$ai_parent_id"] = trace.ParentSpanID
+		}
+		props["trace_depth"] = trace.Depth
+	}
+	if attempt, ok := plugin.AttemptFromContext(r.Context()); ok {
+		props["attempt"] = attempt.Number
+		props["attempt_total"] = attempt.Total
+		props["is_fallback"] = attempt.Fallback
+	}
+
 	if errorMessage != "" {
 		props["$ai_error_message"] = errorMessage
 	}
+	if !isError {
+		props["$ai_time_to_first_token"] = timeToFirstToken
+	}
 
 	if temp != nil {
 		props["$ai_temperature"] = *temp
@@ -275,6 +272,27 @@ func (p *Posthog) extractCommonProps(provider *services.ProviderService, r *http
 			if ct, ok := usage["completion_tokens"].(float64); ok {
 				props["$ai_output_tokens"] = int(ct)
 			}
+			if details, ok := usage["prompt_tokens_details"].(map[string]any); ok {
+				if cached, ok := details["cached_tokens"].(float64); ok && cached > 0 {
+					props["$ai_cache_read_input_tokens"] = int(cached)
+				}
+				if created, ok := details["cache_creation_tokens"].(float64); ok && created > 0 {
+					props["$ai_cache_creation_input_tokens"] = int(created)
+				}
+			}
+			if details, ok := usage["completion_tokens_details"].(map[string]any); ok {
+				if reasoning, ok := details["reasoning_tokens"].(float64); ok && reasoning > 0 {
+					props["$ai_reasoning_tokens"] = int(reasoning)
+				}
+			}
+			if price, ok := services.LookupModelPrice(providerName, model); ok {
+				pt, _ := usage["prompt_tokens"].(float64)
+				ct, _ := usage["completion_tokens"].(float64)
+				inputCost, outputCost := price.Cost(int(pt), int(ct))
+				props["$ai_input_cost_usd"] = inputCost
+				props["$ai_output_cost_usd"] = outputCost
+				props["$ai_total_cost_usd"] = inputCost + outputCost
+			}
 		}
 	}
 
@@ -299,8 +317,8 @@ func (p *Posthog) extractChatCompletionsProps(props map[string]any, reqJson styl
 	// Output
 	if isStreaming {
 		if accumVal := ctx.Value(posthogStreamAccumKey); accumVal != nil {
-			if accum, ok := accumVal.(*streamAccumulator); ok {
-				props["$ai_output_choices"] = accum.buildChoices()
+			if accum, ok := accumVal.(*services.StreamAccumulator); ok {
+				props["$ai_output_choices"] = accum.Choices()
 			}
 		}
 	} else if resJson != nil {
@@ -317,6 +335,7 @@ type contextKey string
 const (
 	posthogTimeStartKey   contextKey = "posthog_time_start"
 	posthogStreamAccumKey contextKey = "posthog_stream_accum"
+	posthogAttemptsKey    contextKey = "posthog_attempts"
 )
 
 var (
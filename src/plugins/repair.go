@@ -0,0 +1,317 @@
+package plugins
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"github.com/neutrome-labs/open-ai-router/src/validate"
+	"go.uber.org/zap"
+)
+
+// Repair fixes the arguments of tool calls that are not valid JSON before
+// they reach the client: code fences, trailing commas, unquoted keys,
+// single-quoted strings, Python literals and JSON cut off mid-document are
+// repaired. Arguments are then checked against the parameters schema of the
+// tool they call. Repairs and remaining violations are listed in
+// extras.tool_repairs. Non-streaming responses only.
+// Example: model="groq/llama-3.3-70b+repair"
+type Repair struct{}
+
+func (f *Repair) Name() string { return "repair" }
+
+// toolCallRepair reports what was done to the arguments of one tool call
+type toolCallRepair struct {
+	ToolCallID string   `json:"tool_call_id"`
+	Name       string   `json:"name"`
+	Fixes      []string `json:"fixes,omitempty"`
+	Violations []string `json:"violations,omitempty"`
+	// Unrepaired is set when the arguments are still not valid JSON
+	Unrepaired bool `json:"unrepaired,omitempty"`
+}
+
+func (f *Repair) After(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, resJson styles.PartialJSON) (styles.PartialJSON, error) {
+	var choices []map[string]json.RawMessage
+	if raw, ok := resJson["choices"]; !ok || json.Unmarshal(raw, &choices) != nil {
+		return resJson, nil
+	}
+	schemas := map[string]json.RawMessage{}
+	for _, tool := range styles.TryGetFromPartialJSON[[]styles.ChatCompletionsTool](reqJson, "tools") {
+		if tool.Function != nil && tool.Function.Parameters != nil {
+			schemas[tool.Function.Name], _ = json.Marshal(tool.Function.Parameters)
+		}
+	}
+
+	var repairs []toolCallRepair
+	changed := false
+	for _, choice := range choices {
+		var message map[string]json.RawMessage
+		if json.Unmarshal(choice["message"], &message) != nil {
+			continue
+		}
+		var calls []map[string]json.RawMessage
+		if json.Unmarshal(message["tool_calls"], &calls) != nil || len(calls) == 0 {
+			continue
+		}
+		callsChanged := false
+		for _, call := range calls {
+			var fn struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			}
+			if json.Unmarshal(call["function"], &fn) != nil {
+				continue
+			}
+			var id string
+			_ = json.Unmarshal(call["id"], &id)
+			report := toolCallRepair{ToolCallID: id, Name: fn.Name}
+
+			args := fn.Arguments
+			if !json.Valid([]byte(args)) {
+				repaired, fixes := repairJSON(args)
+				if !json.Valid([]byte(repaired)) {
+					report.Unrepaired = true
+					repairs = append(repairs, report)
+					continue
+				}
+				args, report.Fixes = repaired, fixes
+				var function map[string]json.RawMessage
+				if json.Unmarshal(call["function"], &function) == nil {
+					function["arguments"], _ = json.Marshal(args)
+					call["function"], _ = json.Marshal(function)
+					callsChanged = true
+				}
+			}
+			if schema, ok := schemas[fn.Name]; ok {
+				violations, err := validate.ValidateSchema(schema, []byte(args))
+				if err == nil {
+					for _, violation := range violations[:min(len(violations), maxLoggedViolations)] {
+						report.Violations = append(report.Violations, violation.String())
+					}
+				}
+			}
+			if len(report.Fixes) > 0 || len(report.Violations) > 0 {
+				repairs = append(repairs, report)
+			}
+		}
+		if callsChanged {
+			message["tool_calls"], _ = json.Marshal(calls)
+			choice["message"], _ = json.Marshal(message)
+			changed = true
+		}
+	}
+	if len(repairs) == 0 {
+		return resJson, nil
+	}
+
+	Logger.Debug("repair plugin checked tool call arguments",
+		zap.String("provider", p.Name),
+		zap.Any("repairs", repairs))
+	out := resJson
+	if changed {
+		var err error
+		if out, err = resJson.CloneWith("choices", choices); err != nil {
+			return resJson, nil
+		}
+	}
+	return withExtra(out, "tool_repairs", repairs), nil
+}
+
+// Fixes reported by repairJSON
+const (
+	fixCodeFence      = "code fence removed"
+	fixTrailingComma  = "trailing comma removed"
+	fixUnquotedKey    = "unquoted key quoted"
+	fixSingleQuotes   = "single-quoted string requoted"
+	fixPythonLiteral  = "Python literal converted"
+	fixTruncated      = "truncated JSON completed"
+	fixMissingContent = "empty arguments replaced by {}"
+)
+
+// repairJSON rewrites almost-JSON as a model may emit it into JSON, returning
+// the fixes it applied. The result is not guaranteed to be valid: callers
+// check it.
+func repairJSON(s string) (string, []string) {
+	var fixes []string
+	fixed := func(fix string) {
+		for _, f := range fixes {
+			if f == fix {
+				return
+			}
+		}
+		fixes = append(fixes, fix)
+	}
+
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```")
+		// The fence's language tag, if any
+		if nl := strings.IndexByte(s, '\n'); nl >= 0 && !strings.ContainsAny(s[:nl], "{[") {
+			s = s[nl+1:]
+		}
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+		fixed(fixCodeFence)
+	}
+	if s == "" {
+		fixed(fixMissingContent)
+		return "{}", fixes
+	}
+
+	var out strings.Builder
+	var stack []byte
+	expectKey, afterKey := false, false
+	// trimComma drops a comma ending the output, with the spaces after it
+	trimComma := func() bool {
+		text := strings.TrimRight(out.String(), " \t\r\n")
+		if !strings.HasSuffix(text, ",") {
+			return false
+		}
+		out.Reset()
+		out.WriteString(text[:len(text)-1])
+		return true
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			out.WriteByte(c)
+		case c == '"' || c == '\'':
+			str, n, closed := readQuoted(s[i:])
+			if c == '\'' {
+				fixed(fixSingleQuotes)
+			}
+			if !closed {
+				fixed(fixTruncated)
+			}
+			out.WriteString(str)
+			i += n - 1
+			afterKey, expectKey = expectKey, false
+		case c == '{' || c == '[':
+			stack = append(stack, c)
+			out.WriteByte(c)
+			expectKey = c == '{'
+		case c == '}' || c == ']':
+			if trimComma() {
+				fixed(fixTrailingComma)
+			}
+			if len(stack) == 0 || (stack[len(stack)-1] == '{') != (c == '}') {
+				return s, fixes
+			}
+			stack = stack[:len(stack)-1]
+			out.WriteByte(c)
+			expectKey, afterKey = false, false
+		case c == ',':
+			out.WriteByte(c)
+			expectKey = len(stack) > 0 && stack[len(stack)-1] == '{'
+		case c == ':':
+			out.WriteByte(c)
+			expectKey, afterKey = false, false
+		default:
+			n := 1
+			for i+n < len(s) && isWordByte(s[i+n]) {
+				n++
+			}
+			word := s[i : i+n]
+			i += n - 1
+			atEnd := i == len(s)-1
+			switch {
+			case expectKey:
+				quoted, _ := json.Marshal(word)
+				out.Write(quoted)
+				fixed(fixUnquotedKey)
+				expectKey, afterKey = false, true
+				continue
+			case word == "True" || word == "False" || word == "None":
+				word = map[string]string{"True": "true", "False": "false", "None": "null"}[word]
+				fixed(fixPythonLiteral)
+			case atEnd && word != "true" && word != "false" && word != "null" &&
+				(strings.HasPrefix("true", word) || strings.HasPrefix("false", word) || strings.HasPrefix("null", word)):
+				for _, literal := range []string{"true", "false", "null"} {
+					if strings.HasPrefix(literal, word) {
+						word = literal
+						break
+					}
+				}
+				fixed(fixTruncated)
+			case atEnd && strings.ContainsAny(word[len(word)-1:], ".-+eE") && strings.ContainsAny(word[:1], "-0123456789"):
+				word = strings.TrimRight(word, ".-+eE")
+				if word == "" {
+					word = "null"
+				}
+				fixed(fixTruncated)
+			}
+			out.WriteString(word)
+		}
+	}
+
+	// Cut off mid-document: finish the pending member and close what is open
+	if len(stack) > 0 {
+		fixed(fixTruncated)
+		text := strings.TrimRight(out.String(), " \t\r\n")
+		switch {
+		case strings.HasSuffix(text, ","):
+			text = text[:len(text)-1]
+		case strings.HasSuffix(text, ":"):
+			text += "null"
+		case afterKey:
+			text += ":null"
+		}
+		out.Reset()
+		out.WriteString(text)
+		for j := len(stack) - 1; j >= 0; j-- {
+			if stack[j] == '{' {
+				out.WriteByte('}')
+			} else {
+				out.WriteByte(']')
+			}
+		}
+	}
+	return out.String(), fixes
+}
+
+// readQuoted reads the string starting at s[0], a double or single quote,
+// and returns it as a JSON string, the bytes read, and whether it was closed
+func readQuoted(s string) (string, int, bool) {
+	quote := s[0]
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			if quote == '\'' && s[i+1] == '\'' {
+				b.WriteByte('\'')
+			} else {
+				b.WriteByte(c)
+				b.WriteByte(s[i+1])
+			}
+			i++
+		case c == '\\':
+			// A lone backslash cut off at the end
+		case c == quote:
+			b.WriteByte('"')
+			return b.String(), i + 1, true
+		case c == '"':
+			b.WriteString(`\"`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String(), len(s), false
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '$' || c == '-' || c == '+' || c == '.'
+}
+
+var (
+	_ plugin.AfterPlugin = (*Repair)(nil)
+)
@@ -0,0 +1,69 @@
+package plugins
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestRepairJSON(t *testing.T) {
+	for in, want := range map[string]struct {
+		out string
+		fix string
+	}{
+		`{"a": 1, "b": [1, 2,],}`:  {`{"a": 1, "b": [1, 2]}`, fixTrailingComma},
+		`{city: "Paris", days: 3}`: {`{"city": "Paris", "days": 3}`, fixUnquotedKey},
+		`{'q': 'it\'s "fine"'}`:    {`{"q": "it's \"fine\""}`, fixSingleQuotes},
+		`{"ok": True, "x": None}`:  {`{"ok": true, "x": null}`, fixPythonLiteral},
+		`{"a": {"b": [1, 2`:        {`{"a": {"b": [1, 2]}}`, fixTruncated},
+		`{"a": "unfinished`:        {`{"a": "unfinished"}`, fixTruncated},
+		`{"a": 1, "b"`:             {`{"a": 1, "b":null}`, fixTruncated},
+		`{"a": tr`:                 {`{"a": true}`, fixTruncated},
+		"```json\n{\"a\": 1}\n```": {`{"a": 1}`, fixCodeFence},
+		``:                         {`{}`, fixMissingContent},
+	} {
+		out, fixes := repairJSON(in)
+		if out != want.out || !slices.Contains(fixes, want.fix) {
+			t.Errorf("repairJSON(%s) = %s %v, want %s with %q", in, out, fixes, want.out, want.fix)
+		}
+		if !json.Valid([]byte(out)) {
+			t.Errorf("repairJSON(%s) = %s is not valid JSON", in, out)
+		}
+	}
+}
+
+func TestRepairAfter(t *testing.T) {
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "tools": [{"type": "function", "function": {"name": "weather",
+		"parameters": {"type": "object", "properties": {"days": {"type": "integer"}}, "required": ["city"]}}}]}`))
+	res, _ := styles.ParsePartialJSON([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "tool_calls": [
+		{"id": "call_1", "type": "function", "function": {"name": "weather", "arguments": "{city: 'Paris', days: 3,}"}},
+		{"id": "call_2", "type": "function", "function": {"name": "weather", "arguments": "{\"days\": \"3\"}"}}
+	]}, "finish_reason": "tool_calls"}]}`))
+
+	out, err := (&Repair{}).After("", &services.ProviderService{Name: "p"}, nil, req, nil, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := styles.ParseChatCompletionsResponse(out)
+	if args := parsed.Choices[0].Message.ToolCalls[0].Function.Arguments; args != `{"city": "Paris", "days": 3}` {
+		t.Errorf("repaired arguments = %s", args)
+	}
+
+	var extras struct {
+		ToolRepairs []toolCallRepair `json:"tool_repairs"`
+	}
+	_ = json.Unmarshal(out["extras"], &extras)
+	if len(extras.ToolRepairs) != 2 {
+		t.Fatalf("tool_repairs = %s", out["extras"])
+	}
+	if first := extras.ToolRepairs[0]; first.ToolCallID != "call_1" || len(first.Fixes) != 3 || len(first.Violations) != 0 {
+		t.Errorf("first repair = %+v", first)
+	}
+	// Valid JSON is left alone but still checked against the schema
+	if second := extras.ToolRepairs[1]; len(second.Fixes) != 0 || len(second.Violations) != 2 {
+		t.Errorf("second repair = %+v, want a missing city and a string days", second)
+	}
+}
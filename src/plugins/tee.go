@@ -0,0 +1,165 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Tee copies responses, with the request and its metadata, to the object
+// store configured by the `tee_storage` global option, for training-data
+// collection and incident forensics. Streams are reassembled into the response
+// a non-streaming request would have returned; a stream failing midway is
+// stored with what was received and the error. Objects are JSON keyed
+// <trace id>/<span id>.json and uploaded in the background.
+//
+// Example: model="openai/gpt-4.1+tee"
+type Tee struct {
+	streams sync.Map // *http.Request -> *teeStream
+}
+
+// teeStream collects the chunks of one streamed response
+type teeStream struct {
+	mu     sync.Mutex
+	chunks []styles.PartialJSON
+	// stop unregisters the cleanup run when the request's context ends
+	stop func() bool
+}
+
+// TeeRecord is the object stored for one response
+type TeeRecord struct {
+	TraceID      string             `json:"trace_id"`
+	SpanID       string             `json:"span_id"`
+	ParentSpanID string             `json:"parent_span_id,omitempty"`
+	Timestamp    time.Time          `json:"timestamp"`
+	Provider     string             `json:"provider"`
+	Model        string             `json:"model"`
+	UserID       string             `json:"user_id,omitempty"`
+	KeyID        string             `json:"key_id,omitempty"`
+	Streamed     bool               `json:"streamed"`
+	Request      styles.PartialJSON `json:"request"`
+	Response     styles.PartialJSON `json:"response,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+func (t *Tee) Name() string { return "tee" }
+
+func (t *Tee) After(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, resJson styles.PartialJSON) (styles.PartialJSON, error) {
+	t.store(p, r, reqJson, resJson, false, nil)
+	return resJson, nil
+}
+
+func (t *Tee) AfterChunk(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, chunk styles.PartialJSON) (styles.PartialJSON, error) {
+	if services.TeeStore() == nil || chunk == nil {
+		return chunk, nil
+	}
+	v, loaded := t.streams.LoadOrStore(r, &teeStream{})
+	s := v.(*teeStream)
+	if !loaded {
+		// A request ending without StreamEnd or OnError still gets its
+		// stream stored and dropped
+		stop := context.AfterFunc(r.Context(), func() {
+			t.finishStream(p, r, reqJson, context.Cause(r.Context()))
+		})
+		s.mu.Lock()
+		s.stop = stop
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	s.chunks = append(s.chunks, chunk)
+	s.mu.Unlock()
+	return chunk, nil
+}
+
+func (t *Tee) StreamEnd(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, lastChunk styles.PartialJSON) error {
+	t.finishStream(p, r, reqJson, nil)
+	return nil
+}
+
+func (t *Tee) OnError(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, providerErr error) error {
+	t.finishStream(p, r, reqJson, providerErr)
+	return nil
+}
+
+// finishStream stores a collected stream, if the request streamed
+func (t *Tee) finishStream(p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, streamErr error) {
+	v, ok := t.streams.LoadAndDelete(r)
+	if !ok {
+		return
+	}
+	s := v.(*teeStream)
+	s.mu.Lock()
+	chunks, stop := s.chunks, s.stop
+	s.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+
+	response, err := styles.AssembleChatCompletionsStream(chunks)
+	if err != nil {
+		Logger.Warn("tee plugin: failed to reassemble stream", zap.String("provider", p.Name), zap.Error(err))
+		if streamErr == nil {
+			streamErr = err
+		}
+	}
+	t.store(p, r, reqJson, response, true, streamErr)
+}
+
+// store queues the record of a response for upload
+func (t *Tee) store(p *services.ProviderService, r *http.Request, reqJson, response styles.PartialJSON, streamed bool, respErr error) {
+	store := services.TeeStore()
+	if store == nil {
+		return
+	}
+
+	record := TeeRecord{
+		Timestamp: time.Now().UTC(),
+		Provider:  p.Name,
+		Model:     styles.TryGetFromPartialJSON[string](reqJson, "model"),
+		Streamed:  streamed,
+		Request:   reqJson,
+		Response:  response,
+	}
+	if trace, ok := plugin.TraceFromContext(r.Context()); ok {
+		record.TraceID, record.SpanID, record.ParentSpanID = trace.ID, trace.SpanID, trace.ParentSpanID
+	} else {
+		record.TraceID, record.SpanID = uuid.New().String(), uuid.New().String()
+	}
+	record.UserID, _ = r.Context().Value(plugin.ContextUserID()).(string)
+	record.KeyID, _ = r.Context().Value(plugin.ContextKeyID()).(string)
+	if respErr != nil {
+		record.Error = respErr.Error()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		Logger.Warn("tee plugin: failed to encode record", zap.String("provider", p.Name), zap.Error(err))
+		return
+	}
+	// The tenant selects the key the record is encrypted with, if any
+	tenant, ok := r.Context().Value(plugin.ContextTenantID()).(string)
+	if !ok {
+		tenant, _, _ = strings.Cut(record.KeyID, ":")
+	}
+	key := record.TraceID + "/" + record.SpanID + ".json"
+	if tenant != "" {
+		key = services.TenantObjectPrefix(tenant) + key
+	}
+	store.PutTenantAsync(tenant, key, data)
+}
+
+var (
+	_ plugin.AfterPlugin       = (*Tee)(nil)
+	_ plugin.StreamChunkPlugin = (*Tee)(nil)
+	_ plugin.StreamEndPlugin   = (*Tee)(nil)
+	_ plugin.ErrorPlugin       = (*Tee)(nil)
+)
@@ -0,0 +1,132 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestTeeStoresReassembledStreams(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]TeeRecord{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record TeeRecord
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &record); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		objects[r.URL.Path] = record
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	store, err := services.NewObjectStore(services.ObjectStoreConfig{Endpoint: server.URL, Bucket: "tee"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services.SetTeeStore(store)
+	defer services.ClearTeeStore(store)
+
+	tee := &Tee{}
+	p := &services.ProviderService{Name: "openai"}
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "gpt-4.1", "stream": true}`))
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	r = r.WithContext(plugin.WithTrace(r.Context(), &plugin.Trace{ID: "trace-1", SpanID: "span-1"}))
+	failed := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	failed = failed.WithContext(plugin.WithTrace(failed.Context(), &plugin.Trace{ID: "trace-2", SpanID: "span-2"}))
+
+	for _, data := range []string{
+		`{"id": "c1", "model": "gpt-4.1", "choices": [{"index": 0, "delta": {"role": "assistant", "content": "Hel"}}]}`,
+		`{"id": "c1", "choices": [{"index": 0, "delta": {"content": "lo"}, "finish_reason": "stop"}]}`,
+	} {
+		chunk, _ := styles.ParsePartialJSON([]byte(data))
+		_, _ = tee.AfterChunk("", p, r, req, nil, chunk)
+		_, _ = tee.AfterChunk("", p, failed, req, nil, chunk)
+	}
+	_ = tee.StreamEnd("", p, r, req, nil, nil)
+	_ = tee.OnError("", p, failed, req, nil, errors.New("connection reset"))
+	store.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	record, ok := objects["/tee/trace-1/span-1.json"]
+	if !ok {
+		t.Fatalf("expected the stream to be stored by trace and span, got %v", objects)
+	}
+	if !record.Streamed || record.Provider != "openai" || record.Model != "gpt-4.1" {
+		t.Errorf("unexpected record metadata: %+v", record)
+	}
+	resp, err := styles.ParseChatCompletionsResponse(record.Response)
+	if err != nil || len(resp.Choices) != 1 || resp.Choices[0].Message == nil || resp.Choices[0].Message.Content != "Hello" {
+		t.Errorf("expected the reassembled response, got %s", record.Response)
+	}
+	if partial := objects["/tee/trace-2/span-2.json"]; partial.Error != "connection reset" || partial.Response == nil {
+		t.Errorf("expected the failed stream to be stored with its error, got %+v", partial)
+	}
+}
+
+func TestTeeDropsCancelledStreams(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]TeeRecord{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record TeeRecord
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &record)
+		mu.Lock()
+		objects[r.URL.Path] = record
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	store, err := services.NewObjectStore(services.ObjectStoreConfig{Endpoint: server.URL, Bucket: "tee"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services.SetTeeStore(store)
+	defer services.ClearTeeStore(store)
+
+	tee := &Tee{}
+	p := &services.ProviderService{Name: "openai"}
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "gpt-4.1", "stream": true}`))
+	ctx, cancel := context.WithCancel(plugin.WithTrace(context.Background(), &plugin.Trace{ID: "trace-3", SpanID: "span-3"}))
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(ctx)
+
+	chunk, _ := styles.ParsePartialJSON([]byte(`{"id": "c1", "model": "gpt-4.1", "choices": [{"index": 0, "delta": {"role": "assistant", "content": "Hel"}}]}`))
+	_, _ = tee.AfterChunk("", p, r, req, nil, chunk)
+	cancel()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := tee.streams.Load(r); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the stream of the cancelled request to be dropped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Error plugins running after the cleanup find nothing left to store
+	_ = tee.OnError("", p, r, req, nil, errors.New("client went away"))
+	store.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(objects) != 1 {
+		t.Fatalf("expected one record, got %v", objects)
+	}
+	if record := objects["/tee/trace-3/span-3.json"]; record.Error != context.Canceled.Error() || record.Response == nil {
+		t.Errorf("expected the cancelled stream to be stored with what was received, got %+v", record)
+	}
+}
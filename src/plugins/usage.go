@@ -0,0 +1,183 @@
+package plugins
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Usage reports token usage in a provider-independent form, so billing
+// systems don't need provider-specific parsing. Responses and the stream
+// chunk carrying usage get an extras.usage object with:
+//   - provider: the usage in the provider's native format
+//   - normalized: flat token counts (see NormalizedUsage)
+//   - cost: USD cost from the pricing file, when the model is priced, or
+//     else the cost the upstream reported, as OpenRouter does in usage.cost
+//   - upstream: the x-or-* attribution headers of OpenRouter responses,
+//     keyed by lowercase name without the prefix
+//
+// Example: model="openai/gpt-4.1+usage"
+type Usage struct{}
+
+// NormalizedUsage is token usage with the same meaning for every provider.
+// InputTokens include cached and cache-write tokens, OutputTokens include
+// reasoning tokens.
+type NormalizedUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	TotalTokens              int `json:"total_tokens"`
+	CachedInputTokens        int `json:"cached_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	ReasoningTokens          int `json:"reasoning_tokens"`
+	AudioInputTokens         int `json:"audio_input_tokens"`
+	AudioOutputTokens        int `json:"audio_output_tokens"`
+}
+
+// UsageCost is the USD cost of a response's usage
+type UsageCost struct {
+	Input    float64 `json:"input"`
+	Output   float64 `json:"output"`
+	Total    float64 `json:"total"`
+	Currency string  `json:"currency"`
+}
+
+// NormalizeUsage flattens Chat Completions usage and its token details
+func NormalizeUsage(usage styles.ChatCompletionsUsage) NormalizedUsage {
+	normalized := NormalizedUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.TotalTokens,
+	}
+	if normalized.TotalTokens == 0 {
+		normalized.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if d := usage.PromptTokensDetails; d != nil {
+		normalized.CachedInputTokens = d.CachedTokens
+		normalized.CacheCreationInputTokens = d.CacheCreationTokens
+		normalized.AudioInputTokens = d.AudioTokens
+	}
+	if d := usage.CompletionTokensDetails; d != nil {
+		normalized.ReasoningTokens = d.ReasoningTokens
+		normalized.AudioOutputTokens = d.AudioTokens
+	}
+	return normalized
+}
+
+func (u *Usage) Name() string { return "usage" }
+
+func (u *Usage) After(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, resJson styles.PartialJSON) (styles.PartialJSON, error) {
+	return u.annotate(p, reqJson, res, resJson), nil
+}
+
+func (u *Usage) AfterChunk(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, chunk styles.PartialJSON) (styles.PartialJSON, error) {
+	return u.annotate(p, reqJson, res, chunk), nil
+}
+
+func (u *Usage) StreamEnd(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, lastChunk styles.PartialJSON) error {
+	if !hasUsage(lastChunk) {
+		Logger.Debug("usage plugin: stream ended without usage; clients should set stream_options.include_usage",
+			zap.String("provider", p.Name))
+	}
+	return nil
+}
+
+// annotate adds extras.usage to a response or chunk that carries usage
+func (u *Usage) annotate(p *services.ProviderService, reqJson styles.PartialJSON, res *http.Response, doc styles.PartialJSON) styles.PartialJSON {
+	if !hasUsage(doc) {
+		return doc
+	}
+	usage, err := styles.GetFromPartialJSON[styles.ChatCompletionsUsage](doc, "usage")
+	if err != nil {
+		Logger.Warn("usage plugin: unreadable usage", zap.String("provider", p.Name), zap.Error(err))
+		return doc
+	}
+
+	report := map[string]any{
+		"provider":   providerUsage(p.Style, doc["usage"], usage),
+		"normalized": NormalizeUsage(usage),
+	}
+
+	model := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	if price, ok := services.LookupModelPrice(p.Name, model); ok {
+		inputCost, outputCost := price.UsageCost(usage)
+		report["cost"] = UsageCost{
+			Input:    inputCost,
+			Output:   outputCost,
+			Total:    inputCost + outputCost,
+			Currency: "USD",
+		}
+	} else if cost, ok := upstreamCost(doc["usage"], res); ok {
+		report["cost"] = UsageCost{Total: cost, Currency: "USD"}
+	}
+	if attribution := openRouterHeaders(res); len(attribution) > 0 {
+		report["upstream"] = attribution
+	}
+	return withExtra(doc, "usage", report)
+}
+
+// providerUsage returns usage in the provider's native format. Chat
+// Completions providers' usage passes through untouched, including
+// provider-specific fields; usage converted from another style is mapped back.
+func providerUsage(style styles.Style, raw json.RawMessage, usage styles.ChatCompletionsUsage) any {
+	if style == styles.StyleResponses {
+		return usage.ToResponses()
+	}
+	return raw
+}
+
+// upstreamCost returns the USD cost an upstream gateway reported for a
+// response, from usage.cost or the x-or-cost header
+func upstreamCost(rawUsage json.RawMessage, res *http.Response) (float64, bool) {
+	var usage struct {
+		Cost *float64 `json:"cost"`
+	}
+	if json.Unmarshal(rawUsage, &usage) == nil && usage.Cost != nil {
+		return *usage.Cost, true
+	}
+	if res == nil {
+		return 0, false
+	}
+	if header := res.Header.Get("X-Or-Cost"); header != "" {
+		if cost, err := strconv.ParseFloat(header, 64); err == nil {
+			return cost, true
+		}
+	}
+	return 0, false
+}
+
+// openRouterHeaders collects the x-or-* headers of an upstream response
+func openRouterHeaders(res *http.Response) map[string]string {
+	if res == nil {
+		return nil
+	}
+	var headers map[string]string
+	for name, values := range res.Header {
+		key, ok := strings.CutPrefix(strings.ToLower(name), "x-or-")
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[key] = values[0]
+	}
+	return headers
+}
+
+// hasUsage reports whether a response or chunk carries a usage object
+func hasUsage(doc styles.PartialJSON) bool {
+	raw, ok := doc["usage"]
+	return ok && len(raw) > 0 && string(raw) != "null"
+}
+
+var (
+	_ plugin.AfterPlugin       = (*Usage)(nil)
+	_ plugin.StreamChunkPlugin = (*Usage)(nil)
+	_ plugin.StreamEndPlugin   = (*Usage)(nil)
+)
@@ -0,0 +1,134 @@
+package plugins
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func usageReport(t *testing.T, doc styles.PartialJSON) map[string]any {
+	t.Helper()
+	extras := styles.TryGetFromPartialJSON[map[string]any](doc, "extras")
+	report, ok := extras["usage"].(map[string]any)
+	if !ok {
+		t.Fatalf("extras.usage missing: %s", doc["extras"])
+	}
+	return report
+}
+
+func TestUsageReportsNormalizedUsageAndCost(t *testing.T) {
+	dir := t.TempDir()
+	pricing, empty := filepath.Join(dir, "pricing.json"), filepath.Join(dir, "empty.json")
+	_ = os.WriteFile(empty, []byte(`{}`), 0o600)
+	if err := os.WriteFile(pricing, []byte(`{"usage-test-model": {"input": 2, "output": 8, "cached_input": 0.5}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := services.LoadPricingFile(pricing); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = services.LoadPricingFile(empty) })
+
+	req := styles.PartialJSON{}
+	_ = req.Set("model", "usage-test-model")
+	res := styles.PartialJSON{}
+	_ = res.Set("extras", map[string]any{"timed_out": false})
+	_ = res.Set("usage", map[string]any{
+		"prompt_tokens":             1000,
+		"completion_tokens":         500,
+		"total_tokens":              1500,
+		"prompt_tokens_details":     map[string]any{"cached_tokens": 400},
+		"completion_tokens_details": map[string]any{"reasoning_tokens": 200},
+		"provider_cost":             0.01,
+	})
+
+	p := &services.ProviderService{Name: "openai", Style: styles.StyleChatCompletions}
+	out, err := (&Usage{}).After("", p, nil, req, nil, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extras := styles.TryGetFromPartialJSON[map[string]any](out, "extras")
+	if _, ok := extras["timed_out"]; !ok {
+		t.Error("existing extras were dropped")
+	}
+	report := usageReport(t, out)
+	if native := report["provider"].(map[string]any); native["provider_cost"] != 0.01 {
+		t.Errorf("native usage not passed through: %v", native)
+	}
+	normalized := report["normalized"].(map[string]any)
+	if normalized["input_tokens"] != 1000.0 || normalized["cached_input_tokens"] != 400.0 || normalized["reasoning_tokens"] != 200.0 {
+		t.Errorf("unexpected normalized usage: %v", normalized)
+	}
+	// 600 uncached at $2/M + 400 cached at $0.5/M, 500 output at $8/M
+	cost := report["cost"].(map[string]any)
+	if math.Abs(cost["input"].(float64)-0.0014) > 1e-12 || math.Abs(cost["output"].(float64)-0.004) > 1e-12 || cost["currency"] != "USD" {
+		t.Errorf("unexpected cost: %v", cost)
+	}
+}
+
+func TestUsageMapsBackResponsesUsage(t *testing.T) {
+	chunk := styles.PartialJSON{}
+	_ = chunk.Set("usage", styles.ChatCompletionsUsage{
+		PromptTokens: 10, CompletionTokens: 20, TotalTokens: 30,
+		CompletionTokensDetails: &styles.ChatCompletionsCompletionTokensDetails{ReasoningTokens: 5},
+	})
+
+	p := &services.ProviderService{Name: "openai-responses", Style: styles.StyleResponses}
+	out, _ := (&Usage{}).AfterChunk("", p, nil, styles.PartialJSON{}, nil, chunk)
+	report := usageReport(t, out)
+	native := report["provider"].(map[string]any)
+	details, _ := native["output_tokens_details"].(map[string]any)
+	if native["input_tokens"] != 10.0 || details["reasoning_tokens"] != 5.0 {
+		t.Errorf("unexpected native usage: %v", native)
+	}
+	if _, ok := report["cost"]; ok {
+		t.Error("cost reported for an unpriced model")
+	}
+}
+
+func TestUsageIgnoresChunksWithoutUsage(t *testing.T) {
+	chunk := styles.PartialJSON{}
+	_ = chunk.Set("usage", nil)
+	p := &services.ProviderService{Name: "openai"}
+	out, _ := (&Usage{}).AfterChunk("", p, nil, styles.PartialJSON{}, nil, chunk)
+	if _, ok := out["extras"]; ok {
+		t.Error("extras added to a chunk without usage")
+	}
+}
+
+func TestUsageReportsUpstreamCost(t *testing.T) {
+	res := styles.PartialJSON{}
+	_ = res.Set("usage", map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "cost": 0.00042})
+	upstream := &http.Response{Header: http.Header{}}
+	upstream.Header.Set("X-Or-Provider", "DeepInfra")
+	upstream.Header.Set("X-Or-Cost", "0.5")
+
+	p := &services.ProviderService{Name: "openrouter", Style: styles.StyleChatCompletions}
+	req := styles.PartialJSON{}
+	_ = req.Set("model", "meta-llama/llama-3.3-70b-instruct")
+	out, err := (&Usage{}).After("", p, nil, req, upstream, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := usageReport(t, out)
+	cost, _ := report["cost"].(map[string]any)
+	if cost["total"] != 0.00042 || cost["currency"] != "USD" {
+		t.Errorf("cost = %v, want usage.cost to win over the header", cost)
+	}
+	attribution, _ := report["upstream"].(map[string]any)
+	if attribution["provider"] != "DeepInfra" || attribution["cost"] != "0.5" {
+		t.Errorf("upstream = %v", attribution)
+	}
+
+	// Without usage.cost the header is used
+	_ = res.Set("usage", map[string]any{"prompt_tokens": 10, "completion_tokens": 5})
+	out, _ = (&Usage{}).After("", p, nil, req, upstream, res)
+	if cost, _ := usageReport(t, out)["cost"].(map[string]any); cost["total"] != 0.5 {
+		t.Errorf("cost = %v, want the x-or-cost header", cost)
+	}
+}
@@ -0,0 +1,80 @@
+package plugins
+
+import (
+	"net/http"
+
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/services"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"github.com/neutrome-labs/open-ai-router/src/validate"
+	"go.uber.org/zap"
+)
+
+// maxLoggedViolations caps the violations logged or reported per response
+const maxLoggedViolations = 10
+
+// Validate checks responses and stream chunks sent to the client against the
+// bundled API schemas (see package validate) and logs violations, catching
+// converter and provider bugs before clients do. Meant for debug and staging;
+// it can be enabled for every request with `validate_responses` in the global
+// `ai` options.
+// Example: model="openai/gpt-4.1+validate" or "openai/gpt-4.1+validate:flag"
+//
+// Params:
+//   - leading value: "log" (default) logs violations; "flag" also reports
+//     them to the client in extras.validation
+type Validate struct{}
+
+func (v *Validate) Name() string { return "validate" }
+
+func (v *Validate) After(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, resJson styles.PartialJSON) (styles.PartialJSON, error) {
+	return v.check(params, p, resJson), nil
+}
+
+func (v *Validate) AfterChunk(params string, p *services.ProviderService, r *http.Request, reqJson styles.PartialJSON, res *http.Response, chunk styles.PartialJSON) (styles.PartialJSON, error) {
+	return v.check(params, p, chunk), nil
+}
+
+func (v *Validate) check(params string, p *services.ProviderService, doc styles.PartialJSON) styles.PartialJSON {
+	if doc == nil {
+		return doc
+	}
+	schemaName, ok := validate.SchemaFor(doc)
+	if !ok {
+		Logger.Warn("validate plugin: response matches no known format", zap.String("provider", p.Name))
+		return doc
+	}
+	data, err := doc.Marshal()
+	if err != nil {
+		return doc
+	}
+	violations, err := validate.Validate(schemaName, data)
+	if err != nil || len(violations) == 0 {
+		return doc
+	}
+	if len(violations) > maxLoggedViolations {
+		violations = violations[:maxLoggedViolations]
+	}
+
+	messages := make([]string, len(violations))
+	for i, violation := range violations {
+		messages[i] = violation.String()
+	}
+	Logger.Warn("validate plugin: response violates schema",
+		zap.String("provider", p.Name),
+		zap.String("schema", schemaName),
+		zap.Strings("violations", messages))
+
+	if ParseParams(params)[""] != "flag" {
+		return doc
+	}
+	return withExtra(doc, "validation", map[string]any{
+		"schema":     schemaName,
+		"violations": violations,
+	})
+}
+
+var (
+	_ plugin.AfterPlugin       = (*Validate)(nil)
+	_ plugin.StreamChunkPlugin = (*Validate)(nil)
+)
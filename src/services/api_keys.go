@@ -0,0 +1,302 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// API key roles
+const (
+	// APIKeyRoleMember keys call the AI endpoints
+	APIKeyRoleMember = "member"
+	// APIKeyRoleAdmin keys also manage their tenant's keys
+	APIKeyRoleAdmin = "admin"
+)
+
+// APIKeySecretPrefix starts every issued key secret
+const APIKeySecretPrefix = "sk-air-"
+
+// ErrAPIKeyNotFound is returned for key IDs the tenant doesn't own
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// ErrAPIKeyScope is returned when a caller asks for a key reaching further
+// than its own
+var ErrAPIKeyScope = errors.New("api key exceeds the caller's scope")
+
+// ErrAPIKeyInvalid is returned when authenticating with an unknown or revoked secret
+var ErrAPIKeyInvalid = errors.New("invalid api key")
+
+// apiKeyTTL keeps keys in the state store, whose entries all expire, for as
+// long as the store itself lives
+const apiKeyTTL = 100 * 365 * 24 * time.Hour
+
+// apiKeyTenantPattern restricts tenant names to characters safe in key IDs and store keys
+var apiKeyTenantPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// APIKey describes an issued API key; its secret is only returned when the
+// key is created or rotated, and only its hash is stored
+type APIKey struct {
+	ID     string `json:"id"`
+	Object string `json:"object"` // always "api_key"
+	Tenant string `json:"tenant"`
+	Name   string `json:"name,omitempty"`
+	Role   string `json:"role"`
+	// Hint is the end of the secret, to tell keys apart
+	Hint      string `json:"hint"`
+	CreatedAt int64  `json:"created_at"`
+	RotatedAt int64  `json:"rotated_at,omitempty"`
+	RevokedAt int64  `json:"revoked_at,omitempty"`
+	// Residency lists the regions the key's requests may be processed in
+	Residency []string `json:"residency,omitempty"`
+
+	SecretHash string `json:"secret_hash,omitempty"`
+}
+
+// Public returns the key as shown to clients, without its secret's hash
+func (k *APIKey) Public() *APIKey {
+	public := *k
+	public.SecretHash = ""
+	return &public
+}
+
+// Revoked reports whether the key was revoked
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != 0
+}
+
+// apiKeyRef is stored under a secret's hash and points to its key
+type apiKeyRef struct {
+	Tenant string `json:"tenant"`
+	ID     string `json:"id"`
+}
+
+// APIKeyManager issues, lists, rotates and revokes API keys per tenant and
+// authenticates requests with them. Keys live in a state store, so
+// instances sharing a store share them.
+type APIKeyManager struct {
+	Store  StateStore
+	Prefix string // Prepended to the manager's store keys
+}
+
+// Create issues a key for the tenant and returns it with its secret. A key
+// with residency regions only reaches providers in them.
+func (m *APIKeyManager) Create(tenant, name, role string, residency []string) (*APIKey, string, error) {
+	if !apiKeyTenantPattern.MatchString(tenant) {
+		return nil, "", fmt.Errorf("invalid tenant '%s'", tenant)
+	}
+	if role == "" {
+		role = APIKeyRoleMember
+	}
+	if role != APIKeyRoleMember && role != APIKeyRoleAdmin {
+		return nil, "", fmt.Errorf("unknown role '%s' (supported: member, admin)", role)
+	}
+	for i, region := range residency {
+		residency[i] = strings.ToLower(region)
+		if err := ValidateResidencyRegion(residency[i]); err != nil {
+			return nil, "", err
+		}
+	}
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &APIKey{
+		ID:         "key_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:24],
+		Object:     "api_key",
+		Tenant:     tenant,
+		Name:       name,
+		Role:       role,
+		Residency:  residency,
+		Hint:       secret[len(secret)-4:],
+		CreatedAt:  time.Now().Unix(),
+		SecretHash: HashAPIKeySecret(secret),
+	}
+	err = m.Store.Update([]string{m.tenantKey(tenant), m.secretKey(key.SecretHash)}, apiKeyTTL, func(values [][]byte) ([][]byte, error) {
+		var keys []*APIKey
+		if err := unmarshalStored(values[0], &keys); err != nil {
+			return nil, err
+		}
+		return marshalStored(append(keys, key), apiKeyRef{Tenant: tenant, ID: key.ID})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// List returns the tenant's keys, revoked ones included
+func (m *APIKeyManager) List(tenant string) ([]*APIKey, error) {
+	var keys []*APIKey
+	values, err := ReadState(m.Store, []string{m.tenantKey(tenant)})
+	if err == nil {
+		err = unmarshalStored(values[0], &keys)
+	}
+	if keys == nil {
+		keys = []*APIKey{}
+	}
+	return keys, err
+}
+
+// Get returns one of the tenant's keys
+func (m *APIKeyManager) Get(tenant, id string) (*APIKey, error) {
+	keys, err := m.List(tenant)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %s: %w", id, ErrAPIKeyNotFound)
+}
+
+// Revoke disables one of the tenant's keys for good
+func (m *APIKeyManager) Revoke(tenant, id string) (*APIKey, error) {
+	return m.change(tenant, id, "", func(key *APIKey) error {
+		if !key.Revoked() {
+			key.RevokedAt = time.Now().Unix()
+		}
+		return nil
+	})
+}
+
+// Rotate replaces the secret of one of the tenant's keys, which keeps its ID,
+// name and role; the old secret stops working at once
+func (m *APIKeyManager) Rotate(tenant, id string) (*APIKey, string, error) {
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return nil, "", err
+	}
+	hash := HashAPIKeySecret(secret)
+	key, err := m.change(tenant, id, hash, func(key *APIKey) error {
+		if key.Revoked() {
+			return fmt.Errorf("key %s is revoked", id)
+		}
+		key.SecretHash = hash
+		key.Hint = secret[len(secret)-4:]
+		key.RotatedAt = time.Now().Unix()
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// change applies fn to one of the tenant's keys in a single update, which
+// retires the reference of the key's current secret when fn revokes the key
+// or replaces its secret by the one hashing to newHash
+func (m *APIKeyManager) change(tenant, id, newHash string, fn func(key *APIKey) error) (*APIKey, error) {
+	current, err := m.Get(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	storeKeys := []string{m.tenantKey(tenant), m.secretKey(current.SecretHash)}
+	if newHash != "" {
+		storeKeys = append(storeKeys, m.secretKey(newHash))
+	}
+	var changed *APIKey
+	err = m.Store.Update(storeKeys, apiKeyTTL, func(values [][]byte) ([][]byte, error) {
+		var keys []*APIKey
+		if err := unmarshalStored(values[0], &keys); err != nil {
+			return nil, err
+		}
+		i := slices.IndexFunc(keys, func(key *APIKey) bool { return key.ID == id })
+		if i < 0 {
+			return nil, fmt.Errorf("key %s: %w", id, ErrAPIKeyNotFound)
+		}
+		if keys[i].SecretHash != current.SecretHash {
+			return nil, fmt.Errorf("key %s changed concurrently", id)
+		}
+		if err := fn(keys[i]); err != nil {
+			return nil, err
+		}
+		changed = keys[i]
+		updated, err := marshalStored(keys)
+		if err != nil {
+			return nil, err
+		}
+		if changed.Revoked() || changed.SecretHash != current.SecretHash {
+			// State stores can't remove keys; null reads as an unknown secret
+			updated = append(updated, []byte("null"))
+		} else {
+			updated = append(updated, nil)
+		}
+		if newHash != "" {
+			ref, err := marshalStored(apiKeyRef{Tenant: tenant, ID: id})
+			if err != nil {
+				return nil, err
+			}
+			updated = append(updated, ref[0])
+		}
+		return updated, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// Authenticate returns the live key a secret belongs to
+func (m *APIKeyManager) Authenticate(secret string) (*APIKey, error) {
+	if !strings.HasPrefix(secret, APIKeySecretPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+	hash := HashAPIKeySecret(secret)
+	var ref *apiKeyRef
+	values, err := ReadState(m.Store, []string{m.secretKey(hash)})
+	if err == nil {
+		err = unmarshalStored(values[0], &ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return nil, ErrAPIKeyInvalid
+	}
+	key, err := m.Get(ref.Tenant, ref.ID)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.Revoked() || key.SecretHash != hash {
+		return nil, ErrAPIKeyInvalid
+	}
+	return key, nil
+}
+
+// HashAPIKeySecret returns the stored form of a key secret. Secrets are
+// random, so a fast hash does not make them guessable.
+func HashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKeySecret returns a random key secret
+func newAPIKeySecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return APIKeySecretPrefix + hex.EncodeToString(buf), nil
+}
+
+func (m *APIKeyManager) tenantKey(tenant string) string {
+	return m.Prefix + "tenant:" + tenant
+}
+
+func (m *APIKeyManager) secretKey(hash string) string {
+	return m.Prefix + "secret:" + hash
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAPIKeyManager(t *testing.T) {
+	keys := &APIKeyManager{Store: NewMemoryStateStore(), Prefix: "test:"}
+	key, secret, err := keys.Create("acme", "ci", "", nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if key.Role != APIKeyRoleMember || key.Hint != secret[len(secret)-4:] {
+		t.Errorf("key = %+v", key)
+	}
+	if _, _, err := keys.Create("acme", "", "owner", nil); err == nil {
+		t.Error("expected an unknown role to be rejected")
+	}
+	if got, err := keys.Authenticate(secret); err != nil || got.ID != key.ID || got.Tenant != "acme" {
+		t.Errorf("Authenticate = %+v, %v", got, err)
+	}
+	if _, err := keys.Authenticate(secret + "x"); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Errorf("Authenticate(wrong secret) error = %v", err)
+	}
+
+	// Keys are scoped to their tenant
+	other, _, _ := keys.Create("globex", "", APIKeyRoleAdmin, nil)
+	if _, err := keys.Revoke("acme", other.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Revoke(other tenant's key) error = %v", err)
+	}
+	if list, _ := keys.List("acme"); len(list) != 1 {
+		t.Errorf("List(acme) = %d keys, want 1", len(list))
+	}
+
+	rotated, newSecret, err := keys.Rotate("acme", key.ID)
+	if err != nil || rotated.ID != key.ID || newSecret == secret {
+		t.Fatalf("Rotate = %+v, %v", rotated, err)
+	}
+	if _, err := keys.Authenticate(secret); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Errorf("old secret still valid after rotation: %v", err)
+	}
+	if _, err := keys.Authenticate(newSecret); err != nil {
+		t.Errorf("Authenticate(new secret): %v", err)
+	}
+
+	if revoked, err := keys.Revoke("acme", key.ID); err != nil || !revoked.Revoked() {
+		t.Fatalf("Revoke = %+v, %v", revoked, err)
+	}
+	if _, err := keys.Authenticate(newSecret); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Errorf("revoked key still valid: %v", err)
+	}
+	if _, _, err := keys.Rotate("acme", key.ID); err == nil {
+		t.Error("expected rotating a revoked key to fail")
+	}
+	if public := rotated.Public(); public.SecretHash != "" || rotated.SecretHash == "" {
+		t.Error("Public should only drop the hash of its copy")
+	}
+}
@@ -39,10 +39,18 @@ func RegisterAuthService(name string, m AuthService) {
 
 // GetAuthService retrieves an auth manager by name
 func GetAuthService(name string) AuthService {
+	if m, ok := LookupAuthService(name); ok {
+		return m
+	}
+	return &NopAuthService{}
+}
+
+// LookupAuthService retrieves an auth manager by name, reporting whether it is registered
+func LookupAuthService(name string) (AuthService, bool) {
 	if v, ok := authServiceRegistry.Load(strings.ToLower(name)); ok {
 		if m, ok2 := v.(AuthService); ok2 {
-			return m
+			return m, true
 		}
 	}
-	return &NopAuthService{}
+	return nil, false
 }
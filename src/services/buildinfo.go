@@ -0,0 +1,84 @@
+package services
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// routerModule is the path of the router's module
+const routerModule = "github.com/neutrome-labs/open-ai-router"
+
+// Version is the router's release version, set by release builds with
+// -ldflags "-X github.com/neutrome-labs/open-ai-router/src/services.Version=v1.2.3".
+// Other builds report the version Go recorded for the module.
+var Version string
+
+// BuildInfo describes the running build
+type BuildInfo struct {
+	// Version of the router: the release version, a module version, or
+	// (devel) for local builds
+	Version string `json:"version"`
+	// Module is the path of the router's module
+	Module string `json:"module,omitempty"`
+	// Revision is the VCS commit the binary was built from
+	Revision string `json:"revision,omitempty"`
+	// Time is when that commit was made, RFC 3339
+	Time string `json:"time,omitempty"`
+	// Modified reports uncommitted changes in the built tree
+	Modified bool `json:"modified,omitempty"`
+	// Caddy is the version of Caddy compiled in
+	Caddy string `json:"caddy"`
+	// Go is the version of Go the binary was built with
+	Go string `json:"go"`
+	// Platform is the OS and architecture, e.g. linux/arm64
+	Platform string `json:"platform"`
+}
+
+// ReadBuildInfo returns the build of the running binary
+func ReadBuildInfo() BuildInfo {
+	caddyVersion, _ := caddy.Version()
+	info := BuildInfo{
+		Version:  Version,
+		Caddy:    caddyVersion,
+		Go:       runtime.Version(),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		if info.Version == "" {
+			info.Version = "(devel)"
+		}
+		return info
+	}
+	// Built from this repository, or as a dependency by xcaddy
+	module := &build.Main
+	for _, dep := range build.Deps {
+		if module.Path != routerModule && dep.Path == routerModule {
+			module = dep
+		}
+	}
+	info.Module = module.Path
+	if info.Version == "" {
+		info.Version = module.Version
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	// VCS settings describe the main module only
+	if module != &build.Main {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
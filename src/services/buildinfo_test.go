@@ -0,0 +1,19 @@
+package services
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestReadBuildInfo(t *testing.T) {
+	info := ReadBuildInfo()
+	if info.Version == "" || info.Caddy == "" || info.Go != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Errorf("expected the version, Caddy, Go and platform filled in, got %+v", info)
+	}
+
+	Version = "v1.2.3"
+	defer func() { Version = "" }()
+	if info := ReadBuildInfo(); info.Version != "v1.2.3" {
+		t.Errorf("expected the release version to win, got %q", info.Version)
+	}
+}
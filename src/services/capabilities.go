@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Capability names a feature a model may or may not support
+const (
+	CapabilityTools         = "tools"
+	CapabilityVision        = "vision"
+	CapabilityJSONMode      = "json_mode"
+	CapabilityJSONSchema    = "json_schema"
+	CapabilityReasoning     = "reasoning"
+	CapabilityDeveloperRole = "developer_role"
+	CapabilityComputerUse   = "computer_use"
+	// CapabilityMaxCompletionTokens marks models taking max_completion_tokens;
+	// models lacking it only take max_tokens
+	CapabilityMaxCompletionTokens = "max_completion_tokens"
+)
+
+// Limits of a model, recorded as capabilities named "<limit>:<n>", e.g.
+// "max_batch:2048"
+const (
+	// LimitMaxBatch is the number of inputs an embeddings request may carry
+	LimitMaxBatch = "max_batch"
+	// LimitMaxN is the number of completions (n) a chat request may ask for
+	LimitMaxN = "max_n"
+)
+
+// CapabilityEntry records what the models matching a pattern support
+type CapabilityEntry struct {
+	// Model is a glob of model names, e.g. "grok-3-mini*"; "*" matches any
+	// characters including slashes, so "*" matches all models
+	Model string `json:"model"`
+	// Supports lists capabilities the models have
+	Supports []string `json:"supports,omitempty"`
+	// Lacks lists capabilities the models don't have
+	Lacks []string `json:"lacks,omitempty"`
+}
+
+// Capabilities is a provider's capability registry. Later entries override
+// earlier ones, so configured entries refine the ones of a preset.
+type Capabilities []CapabilityEntry
+
+// Supports reports whether a model has a capability, and whether any entry
+// says so either way
+func (c Capabilities) Supports(model, capability string) (supported, known bool) {
+	for i := len(c) - 1; i >= 0; i-- {
+		entry := c[i]
+		if !matchModel(entry.Model, model) {
+			continue
+		}
+		if slices.Contains(entry.Lacks, capability) {
+			return false, true
+		}
+		if slices.Contains(entry.Supports, capability) {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// Limit returns the value of a limit of a model, 0 when no entry sets it
+func (c Capabilities) Limit(model, limit string) int {
+	for i := len(c) - 1; i >= 0; i-- {
+		entry := c[i]
+		if !matchModel(entry.Model, model) {
+			continue
+		}
+		for _, capability := range entry.Supports {
+			if value, ok := strings.CutPrefix(capability, limit+":"); ok {
+				if n, err := strconv.Atoi(value); err == nil && n > 0 {
+					return n
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// matchModel matches a model name against a glob whose wildcards span the
+// slashes of vendor-prefixed names such as meta-llama/llama-4-scout
+func matchModel(pattern, model string) bool {
+	ok, _ := path.Match(strings.ReplaceAll(pattern, "/", "\x1f"), strings.ReplaceAll(model, "/", "\x1f"))
+	return ok
+}
+
+// RequiredCapabilities lists the capabilities a request can't be served
+// without: CapabilityComputerUse for requests declaring computer use tools,
+// which providers lacking it would reject or, worse, ignore
+func RequiredCapabilities(reqJson styles.PartialJSON) []string {
+	var tools []styles.ChatCompletionsTool
+	_ = json.Unmarshal(reqJson["tools"], &tools)
+	for _, tool := range tools {
+		if styles.IsComputerUseTool(tool.Type) {
+			return []string{CapabilityComputerUse}
+		}
+	}
+	return nil
+}
+
+// CheckRequired fails with errs.ErrCapability when the model lacks one of the
+// capabilities a request requires. Models the registry says nothing about
+// are taken to lack them.
+func (c Capabilities) CheckRequired(model string, required []string) error {
+	for _, capability := range required {
+		if supported, _ := c.Supports(model, capability); !supported {
+			return errs.Errorf(errs.ErrCapability, "model %s does not support %s", model, capability)
+		}
+	}
+	return nil
+}
+
+// MapTokenLimit moves a request's output token limit to the field the model
+// takes: max_completion_tokens for models having CapabilityMaxCompletionTokens,
+// max_tokens for models lacking it. Requests for models the registry says
+// nothing about are returned as is.
+func (c Capabilities) MapTokenLimit(reqJson styles.PartialJSON) styles.PartialJSON {
+	model := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	supported, known := c.Supports(model, CapabilityMaxCompletionTokens)
+	if !known {
+		return reqJson
+	}
+	from, to := "max_completion_tokens", "max_tokens"
+	if supported {
+		from, to = to, from
+	}
+	value, ok := reqJson[from]
+	if !ok {
+		return reqJson
+	}
+	res := reqJson.Clone()
+	delete(res, from)
+	if _, set := res[to]; !set {
+		res[to] = value
+	}
+	return res
+}
+
+// MapRoles rewrites instruction messages to the role the model takes:
+// developer for models having CapabilityDeveloperRole, system for the others,
+// since most OpenAI-compatible servers don't know the developer role
+func (c Capabilities) MapRoles(reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	model := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	if supported, _ := c.Supports(model, CapabilityDeveloperRole); supported {
+		return styles.RenameMessageRole(reqJson, "system", "developer")
+	}
+	return styles.RenameMessageRole(reqJson, "developer", "system")
+}
@@ -1,8 +1,7 @@
 package services
 
 import (
-	"fmt"
-
+	"github.com/neutrome-labs/open-ai-router/src/errs"
 	"github.com/neutrome-labs/open-ai-router/src/styles"
 )
 
@@ -12,39 +11,69 @@ type DefaultConverter struct{}
 
 // ConvertRequest converts a request from one style to another.
 func (c *DefaultConverter) ConvertRequest(reqJson styles.PartialJSON, from, to styles.Style) (styles.PartialJSON, error) {
+	from, to = styles.WireStyle(from), styles.WireStyle(to)
 	if from == to {
 		return reqJson, nil // Passthrough
 	}
 
 	if from == styles.StyleChatCompletions && to == styles.StyleResponses {
-		return styles.ConvertChatCompletionsRequestToResponses(reqJson)
+		converted, err := styles.ConvertChatCompletionsRequestToResponses(reqJson)
+		return converted, errs.Wrap(errs.ErrConversion, err)
+	}
+	if from == styles.StyleChatCompletions && to == styles.StyleGoogleGenAI {
+		converted, err := styles.ConvertChatCompletionsRequestToGemini(reqJson)
+		return converted, errs.Wrap(errs.ErrConversion, err)
+	}
+	if from == styles.StyleChatCompletions && to == styles.StyleAnthropic {
+		converted, err := styles.ConvertChatCompletionsRequestToAnthropic(reqJson)
+		return converted, errs.Wrap(errs.ErrConversion, err)
 	}
 
-	return nil, fmt.Errorf("conversion from %s to %s not yet implemented", from, to)
+	return nil, errs.Errorf(errs.ErrConversion, "conversion from %s to %s not yet implemented", from, to)
 }
 
 // ConvertResponse converts a response from one style to another.
 func (c *DefaultConverter) ConvertResponse(resJson styles.PartialJSON, from, to styles.Style) (styles.PartialJSON, error) {
+	from, to = styles.WireStyle(from), styles.WireStyle(to)
 	if from == to {
 		return resJson, nil // Passthrough
 	}
 
 	if from == styles.StyleResponses && to == styles.StyleChatCompletions {
-		return styles.ConvertResponsesResponseToChatCompletions(resJson)
+		converted, err := styles.ConvertResponsesResponseToChatCompletions(resJson)
+		return converted, errs.Wrap(errs.ErrConversion, err)
+	}
+	if from == styles.StyleGoogleGenAI && to == styles.StyleChatCompletions {
+		converted, err := styles.ConvertGeminiResponseToChatCompletions(resJson)
+		return converted, errs.Wrap(errs.ErrConversion, err)
+	}
+	if from == styles.StyleAnthropic && to == styles.StyleChatCompletions {
+		converted, err := styles.ConvertAnthropicResponseToChatCompletions(resJson)
+		return converted, errs.Wrap(errs.ErrConversion, err)
 	}
 
-	return nil, fmt.Errorf("conversion from %s to %s not yet implemented", from, to)
+	return nil, errs.Errorf(errs.ErrConversion, "conversion from %s to %s not yet implemented", from, to)
 }
 
 // ConvertResponseChunk converts a response chunk from one style to another.
 func (c *DefaultConverter) ConvertResponseChunk(chunkJson styles.PartialJSON, from, to styles.Style) (styles.PartialJSON, error) {
+	from, to = styles.WireStyle(from), styles.WireStyle(to)
 	if from == to {
 		return chunkJson, nil // Passthrough
 	}
 
 	if from == styles.StyleResponses && to == styles.StyleChatCompletions {
-		return styles.ConvertResponsesResponseChunkToChatCompletions(chunkJson)
+		converted, err := styles.ConvertResponsesResponseChunkToChatCompletions(chunkJson)
+		return converted, errs.Wrap(errs.ErrConversion, err)
+	}
+	if from == styles.StyleGoogleGenAI && to == styles.StyleChatCompletions {
+		converted, err := styles.ConvertGeminiResponseChunkToChatCompletions(chunkJson)
+		return converted, errs.Wrap(errs.ErrConversion, err)
+	}
+	if from == styles.StyleAnthropic && to == styles.StyleChatCompletions {
+		converted, err := styles.ConvertAnthropicResponseChunkToChatCompletions(chunkJson)
+		return converted, errs.Wrap(errs.ErrConversion, err)
 	}
 
-	return nil, fmt.Errorf("conversion from %s to %s not yet implemented", from, to)
+	return nil, errs.Errorf(errs.ErrConversion, "conversion from %s to %s not yet implemented", from, to)
 }
@@ -0,0 +1,13 @@
+package services
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+var defaultUpstreamTimeout atomic.Int64
+
+// SetDefaultUpstreamTimeout sets the deadline applied to every upstream request (0 disables it)
+func SetDefaultUpstreamTimeout(d time.Duration) {
+	defaultUpstreamTimeout.Store(int64(d))
+}
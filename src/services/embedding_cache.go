@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// EmbeddingCache keeps embedding vectors in a state store, keyed by the
+// model, the options shaping the vectors and a hash of the input, so
+// inputs already embedded are served without an upstream call
+type EmbeddingCache struct {
+	Store  StateStore
+	Prefix string // Prepended to the cache's store keys
+	TTL    time.Duration
+}
+
+// embeddingKeyOptions are the request fields changing the vectors an input
+// gets, besides the model
+var embeddingKeyOptions = []string{"dimensions", "encoding_format"}
+
+// EmbeddingInputs splits the input of an embeddings request into its items:
+// a string or a token array is one item, an array of them one per element
+func EmbeddingInputs(reqJson styles.PartialJSON) ([]json.RawMessage, error) {
+	raw := bytes.TrimSpace(reqJson["input"])
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("input is required")
+	}
+	if raw[0] != '[' {
+		return []json.RawMessage{raw}, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("input is empty")
+	}
+	if first := bytes.TrimSpace(items[0]); len(first) > 0 && first[0] != '"' && first[0] != '[' {
+		// An array of numbers is a single token array
+		return []json.RawMessage{raw}, nil
+	}
+	return items, nil
+}
+
+// Lookup returns the cached vector of each input, nil for inputs not cached
+func (c *EmbeddingCache) Lookup(reqJson styles.PartialJSON, inputs []json.RawMessage) ([]json.RawMessage, error) {
+	values, err := ReadState(c.Store, c.keys(reqJson, inputs))
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([]json.RawMessage, len(inputs))
+	for i, v := range values {
+		if len(v) > 0 {
+			vectors[i] = v
+		}
+	}
+	return vectors, nil
+}
+
+// Put caches the vectors of inputs; inputs and vectors are parallel
+func (c *EmbeddingCache) Put(reqJson styles.PartialJSON, inputs, vectors []json.RawMessage) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+	values := make([][]byte, len(vectors))
+	for i, v := range vectors {
+		values[i] = v
+	}
+	return c.Store.Update(c.keys(reqJson, inputs), c.TTL, func([][]byte) ([][]byte, error) {
+		return values, nil
+	})
+}
+
+// keys returns the store key of each input
+func (c *EmbeddingCache) keys(reqJson styles.PartialJSON, inputs []json.RawMessage) []string {
+	base := sha256.New()
+	base.Write([]byte(styles.TryGetFromPartialJSON[string](reqJson, "model")))
+	for _, option := range embeddingKeyOptions {
+		base.Write([]byte{0})
+		base.Write(bytes.TrimSpace(reqJson[option]))
+	}
+	scope := base.Sum(nil)
+
+	keys := make([]string, len(inputs))
+	for i, input := range inputs {
+		h := sha256.New()
+		h.Write(scope)
+		h.Write(bytes.TrimSpace(input))
+		keys[i] = c.Prefix + hex.EncodeToString(h.Sum(nil))
+	}
+	return keys
+}
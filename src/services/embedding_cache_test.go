@@ -0,0 +1,52 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestEmbeddingInputs(t *testing.T) {
+	for input, want := range map[string]int{
+		`"one text"`:         1,
+		`["a", "b", "c"]`:    3,
+		`[1, 2, 3]`:          1, // a token array
+		`[[1, 2], [3], [4]]`: 3,
+	} {
+		req, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "input": ` + input + `}`))
+		items, err := EmbeddingInputs(req)
+		if err != nil || len(items) != want {
+			t.Errorf("EmbeddingInputs(%s) = %d items, %v; want %d", input, len(items), err, want)
+		}
+	}
+	if _, err := EmbeddingInputs(styles.PartialJSON{}); err == nil {
+		t.Error("expected an error without input")
+	}
+}
+
+func TestEmbeddingCache_PartialHits(t *testing.T) {
+	cache := &EmbeddingCache{Store: NewMemoryStateStore(), Prefix: "test:", TTL: time.Hour}
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "text-embedding-3-small"}`))
+	raw := func(s string) json.RawMessage { return json.RawMessage(s) }
+
+	if err := cache.Put(req, []json.RawMessage{raw(`"a"`), raw(`"c"`)}, []json.RawMessage{raw(`[0.1]`), raw(`[0.3]`)}); err != nil {
+		t.Fatal(err)
+	}
+	vectors, err := cache.Lookup(req, []json.RawMessage{raw(`"a"`), raw(`"b"`), raw(` "c"`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(vectors[0]) != "[0.1]" || vectors[1] != nil || string(vectors[2]) != "[0.3]" {
+		t.Errorf("Lookup = %s, want hits for a and c only", vectors)
+	}
+
+	// Another model or dimensions gives other vectors
+	for _, other := range []string{`{"model": "text-embedding-3-large"}`, `{"model": "text-embedding-3-small", "dimensions": 256}`} {
+		otherReq, _ := styles.ParsePartialJSON([]byte(other))
+		if vectors, _ := cache.Lookup(otherReq, []json.RawMessage{raw(`"a"`)}); vectors[0] != nil {
+			t.Errorf("Lookup for %s hit the cached vector", other)
+		}
+	}
+}
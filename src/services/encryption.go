@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// EnvelopeAlgorithm is the cipher of envelopes and of the data keys wrapped
+// with key files
+const EnvelopeAlgorithm = "AES-256-GCM"
+
+// EncryptionConfig configures the encryption of conversation data the
+// router stores, such as tee captures. Every object gets its own data key,
+// wrapped with a key encryption key from a key file or a KMS.
+type EncryptionConfig struct {
+	// KeyFile holds key encryption keys, one `<id> <base64 of 32 bytes>` per
+	// line; the last one is the default
+	KeyFile string `json:"key_file,omitempty"`
+	// KMS wraps data keys with AWS KMS instead of a key file
+	KMS *KMSConfig `json:"kms,omitempty"`
+	// DefaultKey is the key (a key file ID, or a KMS key ID, ARN or alias)
+	// used for tenants without their own
+	DefaultKey string `json:"default_key,omitempty"`
+	// TenantKeys selects the key of a tenant
+	TenantKeys map[string]string `json:"tenant_keys,omitempty"`
+}
+
+// KMSConfig configures AWS KMS (credentials may be secret references)
+type KMSConfig struct {
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	// Endpoint overrides https://kms.<region>.amazonaws.com
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// KeyWrapper wraps and unwraps data keys with key encryption keys. The
+// tenant is bound to the wrapped key, so it only unwraps for that tenant.
+type KeyWrapper interface {
+	WrapKey(ctx context.Context, keyID, tenant string, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, keyID, tenant string, wrapped []byte) ([]byte, error)
+}
+
+// Envelope is an encrypted object as stored
+type Envelope struct {
+	Object    string `json:"object"` // always "encrypted"
+	Algorithm string `json:"alg"`
+	Tenant    string `json:"tenant,omitempty"`
+	// KeyID is the key encryption key that wrapped DataKey
+	KeyID      string `json:"key_id"`
+	DataKey    []byte `json:"data_key"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Encryptor seals data in envelopes with per-tenant keys
+type Encryptor struct {
+	Keys       KeyWrapper
+	DefaultKey string
+	TenantKeys map[string]string
+}
+
+// NewEncryptor loads the key file or sets up the KMS client of a
+// configuration, whose secrets must already be resolved
+func NewEncryptor(cfg EncryptionConfig) (*Encryptor, error) {
+	e := &Encryptor{DefaultKey: cfg.DefaultKey, TenantKeys: cfg.TenantKeys}
+	switch {
+	case cfg.KeyFile != "" && cfg.KMS != nil:
+		return nil, errors.New("encryption: key_file and kms are mutually exclusive")
+	case cfg.KeyFile != "":
+		keys, last, err := loadKeyFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: %v", err)
+		}
+		if e.DefaultKey == "" {
+			e.DefaultKey = last
+		}
+		for _, id := range append([]string{e.DefaultKey}, mapValues(e.TenantKeys)...) {
+			if _, ok := keys[id]; !ok {
+				return nil, fmt.Errorf("encryption: key '%s' is not in %s", id, cfg.KeyFile)
+			}
+		}
+		e.Keys = keys
+	case cfg.KMS != nil:
+		if cfg.KMS.Region == "" || e.DefaultKey == "" {
+			return nil, errors.New("encryption: kms needs a region and a default_key")
+		}
+		endpoint := cfg.KMS.Endpoint
+		if endpoint == "" {
+			endpoint = "https://kms." + cfg.KMS.Region + ".amazonaws.com"
+		}
+		e.Keys = &awsKMS{cfg: *cfg.KMS, endpoint: strings.TrimSuffix(endpoint, "/"), client: &http.Client{Timeout: 10 * time.Second}}
+	default:
+		return nil, errors.New("encryption: key_file or kms is required")
+	}
+	return e, nil
+}
+
+// mapValues returns the values of a map
+func mapValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
+// keyFor returns the key encryption key of a tenant
+func (e *Encryptor) keyFor(tenant string) string {
+	if id, ok := e.TenantKeys[tenant]; ok {
+		return id
+	}
+	return e.DefaultKey
+}
+
+// Seal encrypts data of a tenant into a JSON envelope
+func (e *Encryptor) Seal(ctx context.Context, tenant string, data []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := sealGCM(dataKey, data, []byte(tenant))
+	if err != nil {
+		return nil, err
+	}
+	keyID := e.keyFor(tenant)
+	wrapped, err := e.Keys.WrapKey(ctx, keyID, tenant, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: wrapping data key: %v", err)
+	}
+	return json.Marshal(Envelope{
+		Object:     "encrypted",
+		Algorithm:  EnvelopeAlgorithm,
+		Tenant:     tenant,
+		KeyID:      keyID,
+		DataKey:    wrapped,
+		Nonce:      nonce,
+		Ciphertext: ciphertext,
+	})
+}
+
+// Open decrypts a JSON envelope made by Seal
+func (e *Encryptor) Open(ctx context.Context, sealed []byte) ([]byte, error) {
+	var env Envelope
+	if err := json.Unmarshal(sealed, &env); err != nil || env.Object != "encrypted" {
+		return nil, errors.New("encryption: not an encrypted envelope")
+	}
+	if env.Algorithm != EnvelopeAlgorithm {
+		return nil, fmt.Errorf("encryption: unsupported algorithm '%s'", env.Algorithm)
+	}
+	dataKey, err := e.Keys.UnwrapKey(ctx, env.KeyID, env.Tenant, env.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: unwrapping data key: %v", err)
+	}
+	data, err := openGCM(dataKey, env.Nonce, env.Ciphertext, []byte(env.Tenant))
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %v", err)
+	}
+	return data, nil
+}
+
+// sealGCM encrypts with AES-256-GCM under a random nonce
+func sealGCM(key, plaintext, aad []byte) (nonce, ciphertext []byte, err error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+// openGCM decrypts what sealGCM encrypted
+func openGCM(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// fileKeys are key encryption keys from a key file. Each tenant wraps with
+// its own key derived from the configured one, so tenants sharing a key
+// still can't unwrap each other's data keys.
+type fileKeys map[string][]byte
+
+// loadKeyFile reads a key file, returning its keys and the last key's ID
+func loadKeyFile(path string) (fileKeys, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return parseKeyFile(f, path)
+}
+
+// parseKeyFile parses `<id> <base64 key>` lines; blank and # lines are skipped
+func parseKeyFile(r io.Reader, name string) (fileKeys, string, error) {
+	keys := fileKeys{}
+	last := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, "", fmt.Errorf("%s:%d: expected <id> <base64 key>", name, line)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != 32 {
+			return nil, "", fmt.Errorf("%s:%d: key %s must be 32 bytes in base64", name, line, fields[0])
+		}
+		if _, ok := keys[fields[0]]; ok {
+			return nil, "", fmt.Errorf("%s:%d: duplicate key %s", name, line, fields[0])
+		}
+		keys[fields[0]] = key
+		last = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(keys) == 0 {
+		return nil, "", fmt.Errorf("%s: no keys", name)
+	}
+	return keys, last, nil
+}
+
+// tenantKey derives a tenant's key from a key file key
+func (k fileKeys) tenantKey(keyID, tenant string) ([]byte, error) {
+	key, ok := k[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key '%s'", keyID)
+	}
+	return hkdf.Key(sha256.New, key, nil, "open-ai-router tenant "+tenant, 32)
+}
+
+func (k fileKeys) WrapKey(ctx context.Context, keyID, tenant string, dataKey []byte) ([]byte, error) {
+	kek, err := k.tenantKey(keyID, tenant)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := sealGCM(kek, dataKey, []byte(keyID))
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, ciphertext...), nil
+}
+
+func (k fileKeys) UnwrapKey(ctx context.Context, keyID, tenant string, wrapped []byte) ([]byte, error) {
+	kek, err := k.tenantKey(keyID, tenant)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
+
+// awsKMS wraps data keys with AWS KMS Encrypt and Decrypt, binding them to
+// the tenant through the encryption context
+type awsKMS struct {
+	cfg      KMSConfig
+	endpoint string
+	client   *http.Client
+}
+
+// call sends a KMS API request and decodes its response
+func (k *awsKMS) call(ctx context.Context, target string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint+"/", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+target)
+	if k.cfg.AccessKey != "" {
+		signV4(req, data, k.cfg.AccessKey, k.cfg.SecretKey, k.cfg.Region, "kms", time.Now())
+	}
+	res, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("kms %s: %s: %s", target, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// encryptionContext binds a data key to its tenant
+func encryptionContext(tenant string) map[string]string {
+	if tenant == "" {
+		return nil
+	}
+	return map[string]string{"tenant": tenant}
+}
+
+func (k *awsKMS) WrapKey(ctx context.Context, keyID, tenant string, dataKey []byte) ([]byte, error) {
+	var out struct {
+		CiphertextBlob []byte
+	}
+	err := k.call(ctx, "Encrypt", map[string]any{
+		"KeyId":             keyID,
+		"Plaintext":         dataKey,
+		"EncryptionContext": encryptionContext(tenant),
+	}, &out)
+	return out.CiphertextBlob, err
+}
+
+func (k *awsKMS) UnwrapKey(ctx context.Context, keyID, tenant string, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte
+	}
+	err := k.call(ctx, "Decrypt", map[string]any{
+		"KeyId":             keyID,
+		"CiphertextBlob":    wrapped,
+		"EncryptionContext": encryptionContext(tenant),
+	}, &out)
+	return out.Plaintext, err
+}
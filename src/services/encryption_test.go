@@ -0,0 +1,57 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptor_KeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.keys")
+	keys := "# rotated keys, the last one is the default\n" +
+		"k1 " + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)) + "\n" +
+		"k2 " + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)) + "\n"
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEncryptor(EncryptionConfig{KeyFile: path, TenantKeys: map[string]string{"team-a": "k1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	plaintext := []byte(`{"request":{"messages":[{"role":"user","content":"secret"}]}}`)
+
+	for tenant, keyID := range map[string]string{"team-a": "k1", "team-b": "k2", "": "k2"} {
+		sealed, err := e.Seal(ctx, tenant, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(sealed), "secret") {
+			t.Fatalf("sealed object contains the plaintext: %s", sealed)
+		}
+		var env Envelope
+		if err := json.Unmarshal(sealed, &env); err != nil || env.KeyID != keyID || env.Tenant != tenant {
+			t.Fatalf("tenant %q: envelope %+v, want key %s (err %v)", tenant, env, keyID, err)
+		}
+		opened, err := e.Open(ctx, sealed)
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Fatalf("tenant %q: Open = %s, %v", tenant, opened, err)
+		}
+
+		// Claiming another tenant must not unwrap the data key
+		env.Tenant = "intruder"
+		forged, _ := json.Marshal(env)
+		if _, err := e.Open(ctx, forged); err == nil {
+			t.Fatalf("tenant %q: opened an envelope moved to another tenant", tenant)
+		}
+	}
+
+	if _, err := NewEncryptor(EncryptionConfig{KeyFile: path, DefaultKey: "k3"}); err == nil {
+		t.Error("expected an error for a key missing from the key file")
+	}
+}
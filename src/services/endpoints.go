@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// EndpointPolicy limits the upstream endpoints a provider is called on, e.g.
+// to expose only chat and embeddings on a key that could also fine-tune.
+// Endpoints are the standard OpenAI paths relative to the base URL
+// ("/chat/completions", "/responses", "/embeddings", "/models"), whatever
+// path overrides the provider has. Patterns are globs; a trailing "*" also
+// matches deeper paths, e.g. "/fine_tuning/*".
+type EndpointPolicy struct {
+	// Allow lists the endpoints the provider may be called on; empty allows
+	// every endpoint not denied
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists endpoints the provider is never called on
+	Deny []string `json:"deny,omitempty"`
+}
+
+// Validate checks the patterns
+func (e *EndpointPolicy) Validate() error {
+	if e == nil {
+		return nil
+	}
+	for _, pattern := range append(append([]string{}, e.Allow...), e.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf("endpoints: invalid pattern '%s'", pattern)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether the provider may be called on an endpoint
+func (e *EndpointPolicy) Allows(endpoint string) bool {
+	if e == nil {
+		return true
+	}
+	for _, pattern := range e.Deny {
+		if matchEndpoint(pattern, endpoint) {
+			return false
+		}
+	}
+	if len(e.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range e.Allow {
+		if matchEndpoint(pattern, endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchEndpoint matches an endpoint against a pattern, a trailing "*"
+// matching the rest of the path
+func matchEndpoint(pattern, endpoint string) bool {
+	endpoint = "/" + strings.Trim(endpoint, "/")
+	if strings.HasSuffix(pattern, "*") {
+		// Cut the endpoint to as many segments as the pattern has
+		segments := strings.Count(pattern, "/")
+		if parts := strings.SplitN(endpoint, "/", segments+2); len(parts) > segments+1 {
+			endpoint = strings.Join(parts[:segments+1], "/")
+		}
+	}
+	ok, _ := path.Match(pattern, endpoint)
+	return ok
+}
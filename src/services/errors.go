@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+)
+
+// ErrorClass groups provider failures by what they mean for fallback
+type ErrorClass string
+
+// Provider error classes
+const (
+	ErrorClassInvalidRequest ErrorClass = "invalid_request" // 400/413/422 and other 4xx: fails on every provider
+	ErrorClassAuth           ErrorClass = "auth"            // 401/403: the router's upstream credentials
+	ErrorClassNotFound       ErrorClass = "not_found"       // 404: model unknown to this provider
+	ErrorClassRateLimit      ErrorClass = "rate_limit"      // 429, and 529 (overloaded)
+	ErrorClassServer         ErrorClass = "server"          // 5xx
+	ErrorClassTimeout        ErrorClass = "timeout"         // 408 or the upstream deadline expired
+	ErrorClassUnavailable    ErrorClass = "unavailable"     // connection failures
+	ErrorClassLoop           ErrorClass = "loop"            // recursion limit exceeded or virtual model loop: a configuration error
+	ErrorClassUnsupported    ErrorClass = "unsupported"     // the model lacks a capability the request needs; others may have it
+	ErrorClassClient         ErrorClass = "client"          // writing the response to the client failed: too late to fail over
+	ErrorClassUnknown        ErrorClass = "unknown"
+)
+
+// ClassifyStatus returns the class of an upstream HTTP error status
+func ClassifyStatus(status int) ErrorClass {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorClassAuth
+	case status == http.StatusNotFound:
+		return ErrorClassNotFound
+	case status == http.StatusRequestTimeout:
+		return ErrorClassTimeout
+	case status == http.StatusTooManyRequests || status == 529:
+		return ErrorClassRateLimit
+	case status >= 500:
+		return ErrorClassServer
+	case status >= 400:
+		return ErrorClassInvalidRequest
+	}
+	return ErrorClassUnknown
+}
+
+// ClassifyError returns the class of an error returned while calling a provider
+func ClassifyError(err error) ErrorClass {
+	var statusErr *errs.StatusError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ErrorClassUnknown
+	case errors.Is(err, errs.ErrClientWrite):
+		return ErrorClassClient
+	case errors.As(err, &statusErr):
+		return ClassifyStatus(statusErr.Status)
+	case errors.Is(err, errs.ErrInvalidRequest), errors.Is(err, errs.ErrPolicy):
+		return ErrorClassInvalidRequest
+	case errors.Is(err, errs.ErrAuth):
+		return ErrorClassAuth
+	case errors.Is(err, errs.ErrLoop):
+		return ErrorClassLoop
+	case errors.Is(err, errs.ErrCapability):
+		return ErrorClassUnsupported
+	case errors.Is(err, errs.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.As(err, &netErr):
+		return ErrorClassUnavailable
+	case errors.Is(err, errs.ErrUpstream):
+		return ErrorClassServer
+	}
+	return ErrorClassUnknown
+}
+
+// FailOver reports whether a request failing with this class should be tried
+// on the next provider. Invalid requests would fail everywhere, and a
+// response the client was being sent can't be started over.
+func (c ErrorClass) FailOver() bool {
+	return c != ErrorClassInvalidRequest && c != ErrorClassClient
+}
+
+// Status returns the HTTP status reported to clients for the class
+func (c ErrorClass) Status() int {
+	switch c {
+	case ErrorClassInvalidRequest, ErrorClassUnsupported:
+		return http.StatusBadRequest
+	case ErrorClassNotFound:
+		return http.StatusNotFound
+	case ErrorClassRateLimit:
+		return http.StatusTooManyRequests
+	case ErrorClassAuth, ErrorClassServer:
+		return http.StatusBadGateway
+	case ErrorClassUnavailable:
+		return http.StatusServiceUnavailable
+	case ErrorClassTimeout:
+		return http.StatusGatewayTimeout
+	case ErrorClassLoop:
+		return http.StatusLoopDetected
+	}
+	return http.StatusInternalServerError
+}
+
+// relevance ranks classes by how useful they are to the client when every
+// provider failed: a rejected request or a rate limit is actionable, while a
+// misconfigured or unreachable provider is the operator's concern
+func (c ErrorClass) relevance() int {
+	switch c {
+	case ErrorClassInvalidRequest:
+		return 6
+	case ErrorClassRateLimit:
+		return 5
+	case ErrorClassNotFound:
+		return 4
+	case ErrorClassTimeout:
+		return 3
+	case ErrorClassServer:
+		return 2
+	case ErrorClassAuth, ErrorClassUnavailable, ErrorClassLoop, ErrorClassUnsupported:
+		return 1
+	}
+	return 0
+}
+
+// MoreRelevantError returns whichever of two provider errors should be shown
+// to the client, preferring current on ties. Either may be nil.
+func MoreRelevantError(current, candidate error) error {
+	if current == nil {
+		return candidate
+	}
+	if candidate == nil {
+		return current
+	}
+	if ClassifyError(candidate).relevance() > ClassifyError(current).relevance() {
+		return candidate
+	}
+	return current
+}
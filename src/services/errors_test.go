@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := map[error]ErrorClass{
+		&errs.StatusError{Status: 400}:                                 ErrorClassInvalidRequest,
+		&errs.StatusError{Status: 401}:                                 ErrorClassAuth,
+		&errs.StatusError{Status: 404}:                                 ErrorClassNotFound,
+		&errs.StatusError{Status: 429}:                                 ErrorClassRateLimit,
+		&errs.StatusError{Status: 529}:                                 ErrorClassRateLimit,
+		&errs.StatusError{Status: 503}:                                 ErrorClassServer,
+		fmt.Errorf("wrapped: %w", &errs.StatusError{Status: 422}):      ErrorClassInvalidRequest,
+		fmt.Errorf("call: %w", context.DeadlineExceeded):               ErrorClassTimeout,
+		errs.Errorf(errs.ErrInvalidRequest, "tools: invalid messages"): ErrorClassInvalidRequest,
+		errs.Wrap(errs.ErrUpstream, errors.New("bad chunk")):           ErrorClassServer,
+		errs.Errorf(errs.ErrLoop, "loop detected: v/a -> v/a"):         ErrorClassLoop,
+		errors.New("plugin failed"):                                    ErrorClassUnknown,
+		errs.Wrap(errs.ErrClientWrite, errors.New("broken pipe")):      ErrorClassClient,
+	}
+	for err, want := range tests {
+		if got := ClassifyError(err); got != want {
+			t.Errorf("ClassifyError(%v) = %s, want %s", err, got, want)
+		}
+	}
+	if ErrorClassInvalidRequest.FailOver() || ErrorClassClient.FailOver() || !ErrorClassRateLimit.FailOver() || !ErrorClassServer.FailOver() {
+		t.Error("only invalid requests and client write failures should stop fallback")
+	}
+}
+
+func TestMoreRelevantError(t *testing.T) {
+	server := &errs.StatusError{Status: 500, Body: "boom"}
+	rateLimit := &errs.StatusError{Status: 429, Body: "slow down"}
+	auth := &errs.StatusError{Status: 401, Body: "bad key"}
+
+	var shown error
+	for _, err := range []error{server, rateLimit, auth} {
+		shown = MoreRelevantError(shown, err)
+	}
+	if shown != rateLimit {
+		t.Errorf("expected the rate limit to be shown, got %v", shown)
+	}
+	if MoreRelevantError(server, &errs.StatusError{Status: 502}) != server {
+		t.Error("expected ties to keep the first error")
+	}
+}
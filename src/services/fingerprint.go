@@ -0,0 +1,274 @@
+package services
+
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// FingerprintRetention is how far back a FingerprintTracker counts requests
+const FingerprintRetention = time.Hour
+
+// fingerprintMaxEntries caps the fingerprints a tracker keeps, and
+// fingerprintMaxKeys the keys it remembers per fingerprint
+const (
+	fingerprintMaxEntries = 10000
+	fingerprintMaxKeys    = 1000
+)
+
+// SimHash returns a 64-bit fuzzy hash of a text: near-identical texts get
+// hashes differing in few bits. The features are the overlapping word
+// trigrams of the lowercased text, so case, punctuation and spacing don't
+// matter and a changed word only moves the trigrams containing it.
+func SimHash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+	n := min(3, len(words))
+	var weights [64]int
+	for i := 0; i+n <= len(words); i++ {
+		h := fnv.New64a()
+		for _, word := range words[i : i+n] {
+			h.Write([]byte(word))
+			h.Write([]byte{' '})
+		}
+		sum := mix64(h.Sum64())
+		for bit := range weights {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash
+}
+
+// mix64 spreads the bits of a hash (the SplitMix64 finalizer), as FNV
+// leaves the high bits of short inputs poorly mixed
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// FormatFingerprint returns a fingerprint as 16 hex digits
+func FormatFingerprint(fp uint64) string {
+	return fmt.Sprintf("%016x", fp)
+}
+
+// FingerprintTracker counts requests per prompt fingerprint and the keys
+// sending them over the last hour, to spot the same prompt sent at high
+// volume, possibly spread across keys. Fingerprints within the tracker's
+// distance of a tracked one count as that one. Counts are per process.
+type FingerprintTracker struct {
+	mu      sync.Mutex
+	entries map[uint64]*fingerprintEntry
+}
+
+// fingerprintEntry counts the requests of a fingerprint per minute in a ring
+// of the last hour's minutes
+type fingerprintEntry struct {
+	minutes   [60]int64 // Unix minute of each slot
+	counts    [60]int
+	keys      map[string]time.Time // last request per key
+	traces    [8]string            // last traces counted, so retries count once
+	next      int
+	firstSeen time.Time
+	lastSeen  time.Time
+	flagged   int
+	throttled int
+	alerted   time.Time
+}
+
+// FingerprintCount is a fingerprint's traffic within a window
+type FingerprintCount struct {
+	// Fingerprint is the tracked fingerprint the request counted towards
+	Fingerprint uint64
+	Requests    int
+	Keys        int
+}
+
+// FingerprintStats summarizes a tracked fingerprint
+type FingerprintStats struct {
+	Fingerprint string    `json:"fingerprint"`
+	Requests    int       `json:"requests"`
+	Keys        int       `json:"keys"`
+	Flagged     int       `json:"flagged"`
+	Throttled   int       `json:"throttled"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// NewFingerprintTracker returns an empty tracker
+func NewFingerprintTracker() *FingerprintTracker {
+	return &FingerprintTracker{entries: make(map[uint64]*fingerprintEntry)}
+}
+
+// Observe counts a request with a prompt fingerprint and returns its traffic
+// within the window (at most FingerprintRetention). A fingerprint within
+// distance bits of a tracked one counts towards the closest. Requests of a
+// trace already counted, such as retries on other providers, count once.
+func (t *FingerprintTracker) Observe(fp uint64, distance int, keyID, traceID string, window time.Duration, now time.Time) FingerprintCount {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fp, e := t.lookup(fp, distance)
+	if e == nil {
+		t.evict(now)
+		e = &fingerprintEntry{keys: make(map[string]time.Time), firstSeen: now}
+		t.entries[fp] = e
+	}
+	if traceID == "" || !slices.Contains(e.traces[:], traceID) {
+		if traceID != "" {
+			e.traces[e.next] = traceID
+			e.next = (e.next + 1) % len(e.traces)
+		}
+		minute := now.Unix() / 60
+		slot := minute % int64(len(e.minutes))
+		if e.minutes[slot] != minute {
+			e.minutes[slot], e.counts[slot] = minute, 0
+		}
+		e.counts[slot]++
+		e.lastSeen = now
+		if _, ok := e.keys[keyID]; ok || len(e.keys) < fingerprintMaxKeys {
+			e.keys[keyID] = now
+		}
+	}
+	requests, keys := e.count(window, now)
+	return FingerprintCount{Fingerprint: fp, Requests: requests, Keys: keys}
+}
+
+// Flag records that a fingerprint went over a threshold, and whether the
+// request was throttled. It reports whether to raise an alert: the first
+// time, then at most once per window.
+func (t *FingerprintTracker) Flag(fp uint64, throttled bool, window time.Duration, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[fp]
+	if !ok {
+		return false
+	}
+	e.flagged++
+	if throttled {
+		e.throttled++
+	}
+	if !e.alerted.IsZero() && now.Sub(e.alerted) < window {
+		return false
+	}
+	e.alerted = now
+	return true
+}
+
+// Top returns the fingerprints with the most requests within the window,
+// at most n
+func (t *FingerprintTracker) Top(n int, window time.Duration, now time.Time) []FingerprintStats {
+	top := []FingerprintStats{}
+	if t == nil {
+		return top
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for fp, e := range t.entries {
+		requests, keys := e.count(window, now)
+		if requests == 0 {
+			continue
+		}
+		top = append(top, FingerprintStats{
+			Fingerprint: FormatFingerprint(fp),
+			Requests:    requests,
+			Keys:        keys,
+			Flagged:     e.flagged,
+			Throttled:   e.throttled,
+			FirstSeen:   e.firstSeen,
+			LastSeen:    e.lastSeen,
+		})
+	}
+	slices.SortFunc(top, func(a, b FingerprintStats) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Fingerprint, b.Fingerprint))
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// lookup returns the tracked fingerprint closest to fp within distance bits
+func (t *FingerprintTracker) lookup(fp uint64, distance int) (uint64, *fingerprintEntry) {
+	if e, ok := t.entries[fp]; ok || distance <= 0 {
+		return fp, e
+	}
+	best, bestDistance := fp, 0
+	var found *fingerprintEntry
+	for tracked, e := range t.entries {
+		d := bits.OnesCount64(tracked ^ fp)
+		if d > distance {
+			continue
+		}
+		// The closest wins; ties go to the smallest, so lookups are stable
+		if found == nil || d < bestDistance || d == bestDistance && tracked < best {
+			best, bestDistance, found = tracked, d, e
+		}
+	}
+	return best, found
+}
+
+// evict makes room for a new fingerprint: it drops the ones unseen for the
+// retention, and the least recently seen one when the tracker is still full
+func (t *FingerprintTracker) evict(now time.Time) {
+	if len(t.entries) < fingerprintMaxEntries {
+		return
+	}
+	var oldest uint64
+	var oldestSeen time.Time
+	for fp, e := range t.entries {
+		if now.Sub(e.lastSeen) > FingerprintRetention {
+			delete(t.entries, fp)
+			continue
+		}
+		if oldestSeen.IsZero() || e.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = fp, e.lastSeen
+		}
+	}
+	if len(t.entries) >= fingerprintMaxEntries {
+		delete(t.entries, oldest)
+	}
+}
+
+// count returns the requests and distinct keys within the window
+func (e *fingerprintEntry) count(window time.Duration, now time.Time) (requests, keys int) {
+	window = min(max(window, time.Minute), FingerprintRetention)
+	minute := now.Unix() / 60
+	first := minute - int64(window/time.Minute) + 1
+	for i, m := range e.minutes {
+		if m >= first && m <= minute {
+			requests += e.counts[i]
+		}
+	}
+	cutoff := now.Add(-window)
+	for key, seen := range e.keys {
+		if seen.After(cutoff) {
+			keys++
+		} else if now.Sub(seen) > FingerprintRetention {
+			delete(e.keys, key)
+		}
+	}
+	return requests, keys
+}
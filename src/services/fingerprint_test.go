@@ -0,0 +1,52 @@
+package services
+
+import (
+	"math/bits"
+	"testing"
+	"time"
+)
+
+func TestSimHash_NearDuplicates(t *testing.T) {
+	base := SimHash("Write a product review for the Acme 3000 blender, five stars, mention the price and the warranty.")
+	near := SimHash("write a product review for the ACME 3000 blender -- five stars; mention the price and the warranty!")
+	if base != near {
+		t.Errorf("case and punctuation changed the fingerprint: %x vs %x", base, near)
+	}
+	edited := SimHash("Write a product review for the Acme 3000 blender, four stars, mention the price and the warranty.")
+	other := SimHash("Summarize the attached quarterly report in three bullet points for the board meeting tomorrow.")
+	if d, far := bits.OnesCount64(base^edited), bits.OnesCount64(base^other); d >= far || far < 16 {
+		t.Errorf("expected an edited prompt to be closer (%d bits) than an unrelated one (%d bits)", d, far)
+	}
+}
+
+func TestFingerprintTracker_Observe(t *testing.T) {
+	tracker := NewFingerprintTracker()
+	now := time.Date(2026, 3, 1, 12, 0, 30, 0, time.UTC)
+	fp := uint64(0xf0f0)
+
+	tracker.Observe(fp, 3, "acme:1", "trace-1", time.Minute, now)
+	// A retry of the same trace counts once
+	tracker.Observe(fp, 3, "acme:1", "trace-1", time.Minute, now)
+	// A fingerprint two bits away counts towards the tracked one
+	count := tracker.Observe(fp^0b11, 3, "globex:1", "trace-2", time.Minute, now)
+	if count.Fingerprint != fp || count.Requests != 2 || count.Keys != 2 {
+		t.Fatalf("Observe = %+v, want 2 requests from 2 keys of %x", count, fp)
+	}
+	// Far fingerprints are tracked apart
+	if count := tracker.Observe(^fp, 3, "acme:1", "trace-3", time.Minute, now); count.Requests != 1 {
+		t.Errorf("expected a distinct fingerprint to start its own count, got %+v", count)
+	}
+
+	if !tracker.Flag(fp, true, time.Minute, now) || tracker.Flag(fp, true, time.Minute, now.Add(time.Second)) {
+		t.Error("expected one alert per window")
+	}
+
+	later := now.Add(2 * time.Minute)
+	if count := tracker.Observe(fp, 3, "acme:1", "trace-4", time.Minute, later); count.Requests != 1 || count.Keys != 1 {
+		t.Errorf("expected the window to drop older requests, got %+v", count)
+	}
+	top := tracker.Top(1, time.Hour, later)
+	if len(top) != 1 || top[0].Fingerprint != FormatFingerprint(fp) || top[0].Requests != 3 || top[0].Throttled != 2 {
+		t.Errorf("Top = %+v", top)
+	}
+}
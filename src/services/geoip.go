@@ -0,0 +1,139 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+// GeoIP finds the country of clients for policy rules scoped to countries:
+// from a header set by a CDN or proxy in front of the router, such as
+// Cloudflare's CF-IPCountry, or from a database of address ranges.
+type GeoIP struct {
+	// Header carries the client's ISO 3166-1 alpha-2 country; it wins over
+	// the database
+	Header string
+	ranges []geoRange
+}
+
+// geoRange is a range of addresses in a country
+type geoRange struct {
+	first, last netip.Addr
+	country     string
+}
+
+// LoadGeoIP returns a lookup using the header and, when set, the CSV database
+// at path. Database rows are either `<first address>,<last address>,<country>`,
+// as in the free DB-IP and IPLocate country databases, or `<cidr>,<country>`.
+// A header row is skipped.
+func LoadGeoIP(header, path string) (*GeoIP, error) {
+	g := &GeoIP{Header: header}
+	if path == "" {
+		return g, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %v", err)
+	}
+	defer f.Close()
+	if err := g.load(f); err != nil {
+		return nil, fmt.Errorf("geoip: %s: %v", path, err)
+	}
+	return g, nil
+}
+
+// load reads the ranges of a CSV database
+func (g *GeoIP) load(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rng, err := parseGeoRange(record)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		g.ranges = append(g.ranges, rng)
+	}
+	slices.SortFunc(g.ranges, func(a, b geoRange) int { return a.first.Compare(b.first) })
+	return nil
+}
+
+// parseGeoRange parses a database row
+func parseGeoRange(record []string) (geoRange, error) {
+	var rng geoRange
+	switch len(record) {
+	case 2:
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err != nil {
+			return rng, err
+		}
+		prefix = prefix.Masked()
+		rng.first, rng.last = prefix.Addr(), lastAddr(prefix)
+	case 3:
+		var err error
+		if rng.first, err = netip.ParseAddr(strings.TrimSpace(record[0])); err != nil {
+			return rng, err
+		}
+		if rng.last, err = netip.ParseAddr(strings.TrimSpace(record[1])); err != nil {
+			return rng, err
+		}
+		if rng.first.Is4() != rng.last.Is4() || rng.last.Less(rng.first) {
+			return rng, fmt.Errorf("invalid range %s-%s", rng.first, rng.last)
+		}
+	default:
+		return rng, fmt.Errorf("expected 2 or 3 fields, got %d", len(record))
+	}
+	rng.country = strings.ToUpper(strings.TrimSpace(record[len(record)-1]))
+	if len(rng.country) != 2 {
+		return rng, fmt.Errorf("invalid country '%s'", rng.country)
+	}
+	return rng, nil
+}
+
+// lastAddr returns the last address of a prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(b)*8; bit++ {
+		b[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Country returns the country of a client, or "" when unknown
+func (g *GeoIP) Country(r *http.Request, ip netip.Addr) string {
+	if g == nil {
+		return ""
+	}
+	if g.Header != "" {
+		if country := strings.TrimSpace(r.Header.Get(g.Header)); country != "" {
+			return strings.ToUpper(country)
+		}
+	}
+	ip = ip.Unmap()
+	// The last range starting at or before the address
+	i, found := slices.BinarySearchFunc(g.ranges, ip, func(rng geoRange, ip netip.Addr) int { return rng.first.Compare(ip) })
+	if !found {
+		i--
+	}
+	if i < 0 || g.ranges[i].last.Less(ip) {
+		return ""
+	}
+	return g.ranges[i].country
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestGeoIP_Country(t *testing.T) {
+	g := &GeoIP{Header: "CF-IPCountry"}
+	err := g.load(strings.NewReader(`ip_start,ip_end,country
+# comment
+198.51.100.0,198.51.100.255,de
+2001:db8::,2001:db8::ffff,FR
+203.0.113.0/25,US
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for addr, want := range map[string]string{
+		"198.51.100.20":        "DE",
+		"::ffff:198.51.100.20": "DE",
+		"198.51.101.1":         "",
+		"2001:db8::1":          "FR",
+		"203.0.113.127":        "US",
+		"203.0.113.128":        "",
+		"10.0.0.1":             "",
+	} {
+		if got := g.Country(r, netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Country(%s) = %q, want %q", addr, got, want)
+		}
+	}
+	r.Header.Set("CF-IPCountry", "jp")
+	if got := g.Country(r, netip.MustParseAddr("198.51.100.20")); got != "JP" {
+		t.Errorf("Country = %q, want the header's JP", got)
+	}
+
+	if err := (&GeoIP{}).load(strings.NewReader("198.51.100.0/24,DE\nnot,an,address\n")); err == nil {
+		t.Error("expected an invalid row to be rejected")
+	}
+}
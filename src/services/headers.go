@@ -0,0 +1,100 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// DefaultPropagatedHeaders are the upstream response headers passed on to
+// clients when a router configures no header policy: rate-limit signals and
+// upstream timing.
+var DefaultPropagatedHeaders = []string{
+	"x-ratelimit-*",
+	"anthropic-ratelimit-*",
+	"retry-after",
+	"openai-processing-ms",
+}
+
+// unpropagatedHeaders are never copied from upstream: hop-by-hop headers and
+// headers describing the upstream body or session rather than the router's own
+var unpropagatedHeaders = map[string]bool{
+	"connection":                true,
+	"keep-alive":                true,
+	"proxy-authenticate":        true,
+	"proxy-connection":          true,
+	"te":                        true,
+	"trailer":                   true,
+	"transfer-encoding":         true,
+	"upgrade":                   true,
+	"content-length":            true,
+	"content-encoding":          true,
+	"content-type":              true,
+	"set-cookie":                true,
+	"www-authenticate":          true,
+	"strict-transport-security": true,
+}
+
+// HeaderPolicy selects the upstream response headers propagated to clients.
+// A header is propagated when its name matches a Propagate pattern and no
+// Strip pattern. Patterns are case-insensitive globs, e.g. "x-ratelimit-*".
+type HeaderPolicy struct {
+	// Propagate lists the headers passed on (default: DefaultPropagatedHeaders)
+	Propagate []string `json:"propagate,omitempty"`
+	// Strip lists headers removed even when they match Propagate
+	Strip []string `json:"strip,omitempty"`
+}
+
+// Validate checks the patterns
+func (h *HeaderPolicy) Validate() error {
+	if h == nil {
+		return nil
+	}
+	for _, pattern := range append(append([]string{}, h.Propagate...), h.Strip...) {
+		if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+			return fmt.Errorf("upstream_headers: invalid pattern '%s'", pattern)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether the named upstream header is propagated
+func (h *HeaderPolicy) Allows(name string) bool {
+	name = strings.ToLower(name)
+	if unpropagatedHeaders[name] {
+		return false
+	}
+	propagate := DefaultPropagatedHeaders
+	var strip []string
+	if h != nil {
+		if len(h.Propagate) > 0 {
+			propagate = h.Propagate
+		}
+		strip = h.Strip
+	}
+	return matchesHeader(propagate, name) && !matchesHeader(strip, name)
+}
+
+// Copy copies the propagated headers of an upstream response to dst,
+// replacing values already set there
+func (h *HeaderPolicy) Copy(dst http.Header, upstream *http.Response) {
+	if upstream == nil {
+		return
+	}
+	for name, values := range upstream.Header {
+		if h.Allows(name) {
+			dst[name] = append([]string(nil), values...)
+		}
+	}
+}
+
+// matchesHeader reports whether the lowercase header name matches a pattern
+func matchesHeader(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
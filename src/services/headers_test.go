@@ -0,0 +1,45 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHeaderPolicy_Copy(t *testing.T) {
+	upstream := &http.Response{Header: http.Header{
+		"X-Ratelimit-Remaining-Requests": {"99"},
+		"X-Ratelimit-Reset-Tokens":       {"6s"},
+		"Openai-Processing-Ms":           {"120"},
+		"Openai-Organization":            {"org-123"},
+		"Set-Cookie":                     {"session=1"},
+		"Content-Type":                   {"application/json"},
+	}}
+
+	// Defaults: rate-limit and timing headers only
+	dst := http.Header{}
+	(*HeaderPolicy)(nil).Copy(dst, upstream)
+	for _, name := range []string{"X-Ratelimit-Remaining-Requests", "X-Ratelimit-Reset-Tokens", "Openai-Processing-Ms"} {
+		if dst.Get(name) == "" {
+			t.Errorf("expected %s to be propagated by default", name)
+		}
+	}
+	if len(dst) != 3 {
+		t.Errorf("expected 3 propagated headers, got %v", dst)
+	}
+
+	policy := &HeaderPolicy{Propagate: []string{"X-RateLimit-*", "openai-*", "set-cookie"}, Strip: []string{"x-ratelimit-reset-*"}}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	dst = http.Header{"Content-Type": {"text/event-stream"}}
+	policy.Copy(dst, upstream)
+	if dst.Get("X-Ratelimit-Remaining-Requests") != "99" || dst.Get("Openai-Organization") != "org-123" {
+		t.Errorf("expected configured headers to be propagated, got %v", dst)
+	}
+	if dst.Get("X-Ratelimit-Reset-Tokens") != "" {
+		t.Error("expected stripped header to be dropped")
+	}
+	if dst.Get("Set-Cookie") != "" || dst.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("expected hop-by-hop and body headers never to be copied, got %v", dst)
+	}
+}
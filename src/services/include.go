@@ -0,0 +1,78 @@
+package services
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// ResponsesIncludes lists the include values of the OpenAI Responses API,
+// without the "output[*]." prefix some clients put before them
+var ResponsesIncludes = []string{
+	"file_search_call.results",
+	"web_search_call.results",
+	"web_search_call.action.sources",
+	"message.input_image.image_url",
+	"computer_call_output.output.image_url",
+	"code_interpreter_call.outputs",
+	"reasoning.encrypted_content",
+	"message.output_text.logprobs",
+}
+
+// includeLogprobs is the include value Chat Completions providers emulate
+// with logprobs
+const includeLogprobs = "message.output_text.logprobs"
+
+// FilterIncludes keeps the values of a request's include parameter the
+// provider supports and returns the ones it removed. Responses providers
+// support the values of the Responses API; Chat Completions providers none,
+// though they emulate message.output_text.logprobs with logprobs. Capability
+// entries named "include:<value>" override both.
+func (p *ProviderService) FilterIncludes(reqJson styles.PartialJSON) (styles.PartialJSON, []string, error) {
+	raw, ok := reqJson["include"]
+	if !ok {
+		return reqJson, nil, nil
+	}
+	var includes []string
+	if err := json.Unmarshal(raw, &includes); err != nil {
+		return nil, nil, err
+	}
+
+	model := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	responses := styles.WireStyle(p.Style) == styles.StyleResponses
+	var kept, dropped []string
+	emulateLogprobs := false
+	for _, include := range includes {
+		value := strings.TrimPrefix(include, "output[*].")
+		supported, known := p.Capabilities.Supports(model, "include:"+value)
+		if !known {
+			supported = responses && slices.Contains(ResponsesIncludes, value)
+		}
+		switch {
+		case supported:
+			kept = append(kept, include)
+		case !responses && value == includeLogprobs:
+			emulateLogprobs = true
+		default:
+			dropped = append(dropped, include)
+		}
+	}
+	if len(kept) == len(includes) {
+		return reqJson, nil, nil
+	}
+
+	res := reqJson.Clone()
+	if len(kept) == 0 {
+		delete(res, "include")
+	} else if err := res.Set("include", kept); err != nil {
+		return nil, nil, err
+	}
+	if _, set := res["logprobs"]; emulateLogprobs && !set {
+		if err := res.Set("logprobs", true); err != nil {
+			return nil, nil, err
+		}
+	}
+	return res, dropped, nil
+}
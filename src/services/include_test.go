@@ -0,0 +1,46 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestProviderService_FilterIncludes(t *testing.T) {
+	req, _ := styles.ParsePartialJSON([]byte(`{
+		"model": "o4-mini",
+		"include": ["reasoning.encrypted_content", "output[*].file_search_call.results", "message.output_text.logprobs", "vendor.secret_sauce"]
+	}`))
+
+	responses := &ProviderService{Style: styles.StyleResponses}
+	out, dropped, err := responses.FilterIncludes(req)
+	if err != nil {
+		t.Fatalf("FilterIncludes returned error: %v", err)
+	}
+	if got := styles.TryGetFromPartialJSON[[]string](out, "include"); len(got) != 3 || slices.Contains(got, "vendor.secret_sauce") {
+		t.Errorf("include = %v, want the Responses API values", got)
+	}
+	if !slices.Equal(dropped, []string{"vendor.secret_sauce"}) {
+		t.Errorf("dropped = %v", dropped)
+	}
+
+	chat := &ProviderService{Style: styles.StyleChatCompletions}
+	out, dropped, _ = chat.FilterIncludes(req)
+	if _, ok := out["include"]; ok {
+		t.Error("expected include to be removed for a Chat Completions provider")
+	}
+	if !styles.TryGetFromPartialJSON[bool](out, "logprobs") {
+		t.Error("expected output_text logprobs to be emulated with logprobs")
+	}
+	if len(dropped) != 3 {
+		t.Errorf("dropped = %v, want every value but logprobs", dropped)
+	}
+
+	// Capability entries override the defaults
+	chat.Capabilities = Capabilities{{Model: "*", Supports: []string{"include:reasoning.encrypted_content"}}}
+	out, _, _ = chat.FilterIncludes(req)
+	if got := styles.TryGetFromPartialJSON[[]string](out, "include"); !slices.Equal(got, []string{"reasoning.encrypted_content"}) {
+		t.Errorf("include = %v, want the value the capability allows", got)
+	}
+}
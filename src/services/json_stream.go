@@ -0,0 +1,283 @@
+package services
+
+import "fmt"
+
+// JSONStreamValidator checks JSON text as it is generated, one fragment at a
+// time, and reports the first character no valid JSON document can continue
+// with, so broken output is caught without waiting for the end of a stream.
+// It checks syntax only: a document can still violate the requested schema.
+type JSONStreamValidator struct {
+	offset int
+	stack  []byte // open containers, '{' or '['
+	state  jsonState
+	// literal is the rest of the true, false or null being read
+	literal string
+	// number is the part of the number being read
+	number jsonNumberState
+	// hex counts the digits left in a \u escape
+	hex     int
+	escaped bool
+	isKey   bool
+	err     error
+}
+
+type jsonState int
+
+const (
+	jsonValue      jsonState = iota // a value is expected
+	jsonValueOrEnd                  // after '[': a value or ']'
+	jsonKeyOrEnd                    // after '{': a key or '}'
+	jsonKey                         // after ',' in an object
+	jsonColon                       // after a key
+	jsonCommaOrEnd                  // after a value in a container
+	jsonString                      // inside a string
+	jsonLiteral                     // inside true, false or null
+	jsonNumber                      // inside a number
+	jsonDone                        // the document is complete
+)
+
+type jsonNumberState int
+
+const (
+	numSign     jsonNumberState = iota // after '-'
+	numZero                            // a leading 0
+	numInt                             // integer digits
+	numDot                             // after '.'
+	numFrac                            // fraction digits
+	numExp                             // after 'e'
+	numExpSign                         // after the exponent's sign
+	numExpDigit                        // exponent digits
+)
+
+// Feed checks the next fragment of the document. Once it fails, every later
+// call returns the same error.
+func (v *JSONStreamValidator) Feed(text string) error {
+	if v.err != nil {
+		return v.err
+	}
+	for i := 0; i < len(text); i++ {
+		if err := v.step(text[i]); err != nil {
+			v.err = err
+			return err
+		}
+		v.offset++
+	}
+	return nil
+}
+
+// Complete reports whether the text fed so far is a whole JSON document
+func (v *JSONStreamValidator) Complete() bool {
+	if v.err != nil {
+		return false
+	}
+	if v.state == jsonNumber && len(v.stack) == 0 {
+		return v.number == numZero || v.number == numInt || v.number == numFrac || v.number == numExpDigit
+	}
+	return v.state == jsonDone
+}
+
+func (v *JSONStreamValidator) step(c byte) error {
+	switch v.state {
+	case jsonString:
+		return v.stringChar(c)
+	case jsonLiteral:
+		if c != v.literal[0] {
+			return v.invalid(c)
+		}
+		v.literal = v.literal[1:]
+		if v.literal == "" {
+			v.endValue()
+		}
+		return nil
+	case jsonNumber:
+		if v.numberChar(c) {
+			return nil
+		}
+		if v.number != numZero && v.number != numInt && v.number != numFrac && v.number != numExpDigit {
+			return v.invalid(c)
+		}
+		// The number ended: c belongs to what follows
+		v.endValue()
+		return v.step(c)
+	}
+
+	if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+		return nil
+	}
+	switch v.state {
+	case jsonValue, jsonValueOrEnd:
+		if c == ']' && v.state == jsonValueOrEnd {
+			return v.close(c)
+		}
+		return v.startValue(c)
+	case jsonKeyOrEnd, jsonKey:
+		if c == '}' && v.state == jsonKeyOrEnd {
+			return v.close(c)
+		}
+		if c != '"' {
+			return v.invalid(c)
+		}
+		v.state, v.isKey = jsonString, true
+	case jsonColon:
+		if c != ':' {
+			return v.invalid(c)
+		}
+		v.state = jsonValue
+	case jsonCommaOrEnd:
+		switch {
+		case c == ',' && v.stack[len(v.stack)-1] == '{':
+			v.state = jsonKey
+		case c == ',':
+			v.state = jsonValue
+		case c == '}' || c == ']':
+			return v.close(c)
+		default:
+			return v.invalid(c)
+		}
+	case jsonDone:
+		return v.invalid(c)
+	}
+	return nil
+}
+
+func (v *JSONStreamValidator) startValue(c byte) error {
+	switch {
+	case c == '{':
+		v.stack = append(v.stack, '{')
+		v.state = jsonKeyOrEnd
+	case c == '[':
+		v.stack = append(v.stack, '[')
+		v.state = jsonValueOrEnd
+	case c == '"':
+		v.state, v.isKey = jsonString, false
+	case c == 't':
+		v.state, v.literal = jsonLiteral, "rue"
+	case c == 'f':
+		v.state, v.literal = jsonLiteral, "alse"
+	case c == 'n':
+		v.state, v.literal = jsonLiteral, "ull"
+	case c == '-':
+		v.state, v.number = jsonNumber, numSign
+	case c == '0':
+		v.state, v.number = jsonNumber, numZero
+	case c >= '1' && c <= '9':
+		v.state, v.number = jsonNumber, numInt
+	default:
+		return v.invalid(c)
+	}
+	return nil
+}
+
+func (v *JSONStreamValidator) stringChar(c byte) error {
+	switch {
+	case v.hex > 0:
+		if !isHexDigit(c) {
+			return v.invalid(c)
+		}
+		v.hex--
+	case v.escaped:
+		v.escaped = false
+		switch c {
+		case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		case 'u':
+			v.hex = 4
+		default:
+			return v.invalid(c)
+		}
+	case c == '\\':
+		v.escaped = true
+	case c == '"':
+		if v.isKey {
+			v.state = jsonColon
+		} else {
+			v.endValue()
+		}
+	case c < 0x20:
+		return v.invalid(c)
+	}
+	return nil
+}
+
+// numberChar advances the number being read, reporting false when c can't
+// continue it
+func (v *JSONStreamValidator) numberChar(c byte) bool {
+	digit := c >= '0' && c <= '9'
+	switch v.number {
+	case numSign:
+		if c == '0' {
+			v.number = numZero
+			return true
+		}
+		if digit {
+			v.number = numInt
+			return true
+		}
+	case numZero, numInt:
+		if digit && v.number == numInt {
+			return true
+		}
+		if c == '.' {
+			v.number = numDot
+			return true
+		}
+		if c == 'e' || c == 'E' {
+			v.number = numExp
+			return true
+		}
+	case numDot, numFrac:
+		if digit {
+			v.number = numFrac
+			return true
+		}
+		if v.number == numFrac && (c == 'e' || c == 'E') {
+			v.number = numExp
+			return true
+		}
+	case numExp:
+		if c == '+' || c == '-' {
+			v.number = numExpSign
+			return true
+		}
+		if digit {
+			v.number = numExpDigit
+			return true
+		}
+	case numExpSign, numExpDigit:
+		if digit {
+			v.number = numExpDigit
+			return true
+		}
+	}
+	return false
+}
+
+// close ends the innermost container with c, which must match it
+func (v *JSONStreamValidator) close(c byte) error {
+	open := v.stack[len(v.stack)-1]
+	if (open == '{') != (c == '}') {
+		return v.invalid(c)
+	}
+	v.stack = v.stack[:len(v.stack)-1]
+	v.endValue()
+	return nil
+}
+
+// endValue moves past a complete value
+func (v *JSONStreamValidator) endValue() {
+	if len(v.stack) == 0 {
+		v.state = jsonDone
+	} else {
+		v.state = jsonCommaOrEnd
+	}
+}
+
+func (v *JSONStreamValidator) invalid(c byte) error {
+	if v.state == jsonDone {
+		return fmt.Errorf("unexpected %q after the JSON document at offset %d", c, v.offset)
+	}
+	return fmt.Errorf("invalid character %q at offset %d", c, v.offset)
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
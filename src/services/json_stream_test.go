@@ -0,0 +1,64 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONStreamValidator(t *testing.T) {
+	valid := []string{
+		`{"a": [1, -2.5e+3, 0, true, false, null], "b": {"c": "é\n\"x\""}}`,
+		`[]`,
+		` {} `,
+		`"text"`,
+		`42`,
+	}
+	for _, doc := range valid {
+		var v JSONStreamValidator
+		// Fed one byte at a time, as the worst split a stream can produce
+		for i := range len(doc) {
+			if err := v.Feed(doc[i : i+1]); err != nil {
+				t.Fatalf("%s: %v", doc, err)
+			}
+		}
+		if !v.Complete() {
+			t.Errorf("%s: not complete", doc)
+		}
+		if !json.Valid([]byte(doc)) {
+			t.Fatalf("test document %s is invalid", doc)
+		}
+	}
+
+	for doc, complete := range map[string]bool{`{"a": [1, 2`: false, `{"a": tr`: false, `-`: false, `{"a": 1}`: true} {
+		var v JSONStreamValidator
+		if err := v.Feed(doc); err != nil || v.Complete() != complete {
+			t.Errorf("%s: err = %v, complete = %v; want complete = %v", doc, err, v.Complete(), complete)
+		}
+	}
+
+	for doc, offset := range map[string]int{
+		"Sure! {":          0,
+		"```json\n{":       0,
+		`{"a": 1,}`:        8,
+		`{"a" 1}`:          5,
+		`[1, 2}`:           5,
+		`{"a": 01}`:        7,
+		`{"a": "\q"}`:      8,
+		`{"a": tru}`:       9,
+		`{"a": 1} trailer`: 9,
+	} {
+		var v JSONStreamValidator
+		mid := len(doc) / 2
+		err := v.Feed(doc[:mid])
+		if err == nil {
+			err = v.Feed(doc[mid:])
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", doc)
+			continue
+		}
+		if v.offset != offset {
+			t.Errorf("%s: broke at offset %d, want %d (%v)", doc, v.offset, offset, err)
+		}
+	}
+}
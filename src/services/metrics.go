@@ -0,0 +1,268 @@
+package services
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MetricsRetention is how far back Metrics keeps generations
+const MetricsRetention = time.Hour
+
+// StatsRetention is how far back Metrics keeps per-minute aggregates
+const StatsRetention = 24 * time.Hour
+
+// metricsMaxSamples caps the generations kept per provider and model
+const metricsMaxSamples = 10000
+
+// Metrics aggregates a router's $ai_generation events per provider and
+// model over a rolling window, for operators comparing providers at a glance,
+// and per minute over a longer one, for dashboards
+type Metrics struct {
+	mu      sync.Mutex
+	samples map[metricsKey][]metricsSample
+	// minutes maps Unix minutes to the aggregates of each provider and model
+	minutes map[int64]map[metricsKey]*statsBucket
+}
+
+// statsBucket aggregates the generations of a provider and model in a minute
+type statsBucket struct {
+	requests, errors          int
+	inputTokens, outputTokens int
+	cost                      float64
+}
+
+type metricsKey struct {
+	provider, model string
+}
+
+type metricsSample struct {
+	at           time.Time
+	failed       bool
+	stream       bool
+	latency      float64 // seconds
+	ttft         float64 // seconds, 0 when unknown
+	inputTokens  int
+	outputTokens int
+	cost         float64 // USD, negative when the model has no price
+}
+
+// NewMetrics returns empty metrics
+func NewMetrics() *Metrics {
+	return &Metrics{samples: make(map[metricsKey][]metricsSample), minutes: make(map[int64]map[metricsKey]*statsBucket)}
+}
+
+// Record adds a $ai_generation event; other events are ignored
+func (m *Metrics) Record(event ObservabilityEvent) {
+	if m == nil || event.Name != "$ai_generation" {
+		return
+	}
+	props := event.Properties
+	provider, _ := props["$ai_provider"].(string)
+	model, _ := props["$ai_model"].(string)
+	if provider == "" {
+		return
+	}
+	s := metricsSample{at: event.Time, cost: -1}
+	s.failed, _ = props["$ai_is_error"].(bool)
+	s.stream, _ = props["$ai_stream"].(bool)
+	s.latency, _ = props["$ai_latency"].(float64)
+	s.ttft, _ = props["$ai_time_to_first_token"].(float64)
+	s.inputTokens, _ = props["$ai_input_tokens"].(int)
+	s.outputTokens, _ = props["$ai_output_tokens"].(int)
+	if cost, ok := props["$ai_total_cost_usd"].(float64); ok {
+		s.cost = cost
+	}
+
+	key := metricsKey{provider, model}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	samples := append(m.samples[key], s)
+	// Drop what fell out of the retention, and the oldest beyond the cap
+	cutoff := event.Time.Add(-MetricsRetention)
+	drop, _ := slices.BinarySearchFunc(samples, cutoff, func(s metricsSample, t time.Time) int {
+		return s.at.Compare(t)
+	})
+	drop = max(drop, len(samples)-metricsMaxSamples)
+	m.samples[key] = slices.Delete(samples, 0, drop)
+
+	minute := event.Time.Unix() / 60
+	buckets, ok := m.minutes[minute]
+	if !ok {
+		// A new minute: drop the ones past the retention
+		for old := range m.minutes {
+			if old <= minute-int64(StatsRetention/time.Minute) {
+				delete(m.minutes, old)
+			}
+		}
+		buckets = make(map[metricsKey]*statsBucket)
+		m.minutes[minute] = buckets
+	}
+	b, ok := buckets[key]
+	if !ok {
+		b = &statsBucket{}
+		buckets[key] = b
+	}
+	b.requests++
+	if s.failed {
+		b.errors++
+	}
+	b.inputTokens += s.inputTokens
+	b.outputTokens += s.outputTokens
+	b.cost += max(s.cost, 0)
+}
+
+// StatsRow aggregates the generations of a provider and model over one step
+// of a stats series
+type StatsRow struct {
+	// Time is the start of the step, in Unix milliseconds
+	Time         int64   `json:"time"`
+	Provider     string  `json:"provider"`
+	Model        string  `json:"model"`
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Tokens       int     `json:"tokens"`
+	Cost         float64 `json:"cost"` // USD, counting only priced models
+}
+
+// Stats returns the generations between from and to per provider and model,
+// aggregated over steps aligned to multiples of step (at least a minute),
+// ordered by time, provider and model. Steps without generations are left
+// out.
+func (m *Metrics) Stats(from, to time.Time, step time.Duration) []StatsRow {
+	if m == nil {
+		return nil
+	}
+	stepMinutes := max(int64(step/time.Minute), 1)
+	first, last := from.Unix()/60, to.Unix()/60
+	type rowKey struct {
+		step int64
+		key  metricsKey
+	}
+	m.mu.Lock()
+	rows := make(map[rowKey]*StatsRow)
+	for minute, buckets := range m.minutes {
+		if minute < first || minute > last {
+			continue
+		}
+		start := minute - minute%stepMinutes
+		for key, b := range buckets {
+			row, ok := rows[rowKey{start, key}]
+			if !ok {
+				row = &StatsRow{Time: start * 60 * 1000, Provider: key.provider, Model: key.model}
+				rows[rowKey{start, key}] = row
+			}
+			row.Requests += b.requests
+			row.Errors += b.errors
+			row.InputTokens += b.inputTokens
+			row.OutputTokens += b.outputTokens
+			row.Tokens += b.inputTokens + b.outputTokens
+			row.Cost += b.cost
+		}
+	}
+	m.mu.Unlock()
+
+	res := make([]StatsRow, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, *row)
+	}
+	slices.SortFunc(res, func(a, b StatsRow) int {
+		return cmp.Or(cmp.Compare(a.Time, b.Time), cmp.Compare(a.Provider, b.Provider), cmp.Compare(a.Model, b.Model))
+	})
+	return res
+}
+
+// LeaderboardEntry summarizes the generations of one provider and model
+type LeaderboardEntry struct {
+	Provider  string  `json:"provider"`
+	Model     string  `json:"model"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	TTFTP50   float64 `json:"ttft_p50_ms"`
+	TTFTP95   float64 `json:"ttft_p95_ms"`
+	// TokensPerSec is the median output tokens per second, after the first
+	// token for streams
+	TokensPerSec float64 `json:"tokens_per_sec"`
+	// CostPer1K is the cost in USD per 1000 input and output tokens, nil
+	// when no generation had a price
+	CostPer1K *float64 `json:"cost_per_1k_tokens"`
+}
+
+// Leaderboard summarizes the generations of the window before now, one
+// entry per provider and model, fastest median time to first token first
+func (m *Metrics) Leaderboard(window time.Duration, now time.Time) []LeaderboardEntry {
+	if m == nil {
+		return nil
+	}
+	since := now.Add(-min(window, MetricsRetention))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]LeaderboardEntry, 0, len(m.samples))
+	for key, samples := range m.samples {
+		e := LeaderboardEntry{Provider: key.provider, Model: key.model}
+		var ttfts, tps []float64
+		var cost float64
+		var pricedTokens int
+		for _, s := range samples {
+			if s.at.Before(since) || s.at.After(now) {
+				continue
+			}
+			e.Requests++
+			if s.failed {
+				e.Errors++
+				continue
+			}
+			if s.ttft > 0 {
+				ttfts = append(ttfts, s.ttft*1000)
+			}
+			if gen := s.latency - s.ttft; s.stream && s.ttft > 0 && gen > 0 {
+				tps = append(tps, float64(s.outputTokens)/gen)
+			} else if s.latency > 0 {
+				tps = append(tps, float64(s.outputTokens)/s.latency)
+			}
+			if s.cost >= 0 {
+				cost += s.cost
+				pricedTokens += s.inputTokens + s.outputTokens
+			}
+		}
+		if e.Requests == 0 {
+			continue
+		}
+		e.ErrorRate = float64(e.Errors) / float64(e.Requests)
+		e.TTFTP50, e.TTFTP95 = percentile(ttfts, 50), percentile(ttfts, 95)
+		e.TokensPerSec = percentile(tps, 50)
+		if pricedTokens > 0 {
+			per1K := cost / float64(pricedTokens) * 1000
+			e.CostPer1K = &per1K
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b LeaderboardEntry) int {
+		// Entries without a successful generation go last
+		if (a.TTFTP50 == 0) != (b.TTFTP50 == 0) {
+			if a.TTFTP50 == 0 {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Or(cmp.Compare(a.TTFTP50, b.TTFTP50), cmp.Compare(a.Provider, b.Provider), cmp.Compare(a.Model, b.Model))
+	})
+	return entries
+}
+
+// percentile returns the nearest-rank percentile of values, 0 for none
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	idx := int(float64(len(sorted))*p/100+0.5) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return sorted[idx]
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetrics_Leaderboard(t *testing.T) {
+	m := NewMetrics()
+	now := time.Now()
+	generation := func(provider string, ago time.Duration, props map[string]any) {
+		props["$ai_provider"] = provider
+		props["$ai_model"] = "gpt-4o"
+		m.Record(ObservabilityEvent{Name: "$ai_generation", Time: now.Add(-ago), Properties: props})
+	}
+	// fast: a stream with 100 tokens in the 1s after its first token
+	generation("fast", time.Minute, map[string]any{"$ai_stream": true, "$ai_latency": 1.2, "$ai_time_to_first_token": 0.2,
+		"$ai_input_tokens": 400, "$ai_output_tokens": 100, "$ai_total_cost_usd": 0.001})
+	generation("fast", 2*time.Minute, map[string]any{"$ai_is_error": true, "$ai_latency": 0.1})
+	// slow: two complete responses, and one outside the window
+	generation("slow", time.Minute, map[string]any{"$ai_latency": 2.0, "$ai_time_to_first_token": 2.0, "$ai_output_tokens": 100})
+	generation("slow", time.Minute, map[string]any{"$ai_latency": 4.0, "$ai_time_to_first_token": 4.0, "$ai_output_tokens": 100})
+	generation("slow", 30*time.Minute, map[string]any{"$ai_latency": 9.0, "$ai_time_to_first_token": 9.0})
+	m.Record(ObservabilityEvent{Name: "ai_fallback", Time: now, Properties: map[string]any{"$ai_provider": "other"}})
+
+	board := m.Leaderboard(15*time.Minute, now)
+	if len(board) != 2 || board[0].Provider != "fast" || board[1].Provider != "slow" {
+		t.Fatalf("Leaderboard = %+v, want fast then slow", board)
+	}
+	fast, slow := board[0], board[1]
+	if fast.Requests != 2 || fast.Errors != 1 || fast.ErrorRate != 0.5 {
+		t.Errorf("fast requests = %d, errors = %d, rate = %v", fast.Requests, fast.Errors, fast.ErrorRate)
+	}
+	if fast.TTFTP50 != 200 || fast.TokensPerSec != 100 {
+		t.Errorf("fast ttft = %v ms, tokens/s = %v", fast.TTFTP50, fast.TokensPerSec)
+	}
+	if fast.CostPer1K == nil || *fast.CostPer1K < 0.00199 || *fast.CostPer1K > 0.00201 {
+		t.Errorf("fast cost per 1k = %v, want 0.002", fast.CostPer1K)
+	}
+	if slow.Requests != 2 || slow.TTFTP50 != 2000 || slow.TTFTP95 != 4000 || slow.TokensPerSec != 25 || slow.CostPer1K != nil {
+		t.Errorf("slow = %+v", slow)
+	}
+
+	if len(m.Leaderboard(time.Hour, now)) != 2 || m.Leaderboard(time.Hour, now)[1].Requests != 3 {
+		t.Error("expected the hour window to include the older generation")
+	}
+}
+
+func TestMetrics_Stats(t *testing.T) {
+	m := NewMetrics()
+	base := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	generation := func(provider string, at time.Duration, props map[string]any) {
+		props["$ai_provider"] = provider
+		props["$ai_model"] = "gpt-4o"
+		m.Record(ObservabilityEvent{Name: "$ai_generation", Time: base.Add(at), Properties: props})
+	}
+	generation("a", 30*time.Second, map[string]any{"$ai_input_tokens": 10, "$ai_output_tokens": 5, "$ai_total_cost_usd": 0.01})
+	generation("a", 4*time.Minute, map[string]any{"$ai_input_tokens": 20, "$ai_is_error": true})
+	generation("b", 6*time.Minute, map[string]any{"$ai_output_tokens": 7})
+	generation("a", 2*time.Hour, map[string]any{"$ai_input_tokens": 1})
+
+	rows := m.Stats(base, base.Add(time.Hour), 5*time.Minute)
+	if len(rows) != 2 {
+		t.Fatalf("Stats = %+v, want two rows", rows)
+	}
+	a, b := rows[0], rows[1]
+	if a.Time != base.UnixMilli() || a.Provider != "a" || a.Requests != 2 || a.Errors != 1 || a.Tokens != 35 || a.Cost != 0.01 {
+		t.Errorf("first row = %+v", a)
+	}
+	if b.Time != base.Add(5*time.Minute).UnixMilli() || b.Provider != "b" || b.OutputTokens != 7 {
+		t.Errorf("second row = %+v", b)
+	}
+
+	// Minutes past the retention are dropped once a new minute starts
+	generation("a", StatsRetention+3*time.Hour, map[string]any{})
+	if rows := m.Stats(base, base.Add(time.Hour), time.Minute); len(rows) != 0 {
+		t.Errorf("Stats = %+v, want expired minutes dropped", rows)
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import "strings"
+
+// Model fields separate fallback models with ',', parallel models with '|'
+// and plugins with '+'. Model names containing one of these, like
+// quantization tags ("qwen2.5-7b+q4"), escape it with a backslash:
+// "qwen2.5-7b\+q4+fuzz" asks for qwen2.5-7b+q4 with the fuzz plugin.
+const modelEscape = '\\'
+
+// CutModelSuffix splits a model field at its first unescaped '+' into the
+// model part and the plugin suffix without the '+'; both keep their escapes
+func CutModelSuffix(model string) (base, suffix string, found bool) {
+	if i := indexUnescaped(model, '+'); i >= 0 {
+		return model[:i], model[i+1:], true
+	}
+	return model, "", false
+}
+
+// SplitModelList splits a model part at its unescaped separators, keeping
+// the escapes of the parts
+func SplitModelList(model string, sep byte) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(model, sep)
+		if i < 0 {
+			return append(parts, model)
+		}
+		parts = append(parts, model[:i])
+		model = model[i+1:]
+	}
+}
+
+// UnescapeModel returns the model name an escaped model part stands for
+func UnescapeModel(model string) string {
+	if strings.IndexByte(model, modelEscape) < 0 {
+		return model
+	}
+	var b strings.Builder
+	for i := 0; i < len(model); i++ {
+		if model[i] == modelEscape && i+1 < len(model) {
+			i++
+		}
+		b.WriteByte(model[i])
+	}
+	return b.String()
+}
+
+// indexUnescaped returns the index of the first unescaped c in s, or -1
+func indexUnescaped(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case modelEscape:
+			i++
+		case c:
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestModelNames_Escaping(t *testing.T) {
+	model := `ollama/qwen2.5-7b\+q4,gpt-4.1+models:a\+b+fuzz`
+	base, suffix, ok := CutModelSuffix(model)
+	if !ok || base != `ollama/qwen2.5-7b\+q4,gpt-4.1` || suffix != `models:a\+b+fuzz` {
+		t.Fatalf("CutModelSuffix = %q, %q, %v", base, suffix, ok)
+	}
+	if got, want := SplitModelList(base, ','), []string{`ollama/qwen2.5-7b\+q4`, "gpt-4.1"}; !slices.Equal(got, want) {
+		t.Errorf("SplitModelList = %v, want %v", got, want)
+	}
+	if got, want := SplitModelList(suffix, '+'), []string{`models:a\+b`, "fuzz"}; !slices.Equal(got, want) {
+		t.Errorf("SplitModelList = %v, want %v", got, want)
+	}
+	if got := UnescapeModel(`ollama/qwen2.5-7b\+q4`); got != "ollama/qwen2.5-7b+q4" {
+		t.Errorf("UnescapeModel = %q", got)
+	}
+}
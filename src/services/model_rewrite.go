@@ -0,0 +1,119 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Kinds of model rewrite rules
+const (
+	ModelRewriteStripPrefix = "strip_prefix"
+	ModelRewriteAddSuffix   = "add_suffix"
+	ModelRewriteMap         = "map"
+	ModelRewriteRegex       = "regex"
+)
+
+// ModelRewriter rewrites the model of a request as the provider's drivers
+// dispatch it, e.g. to the name of a deployment. Clients, plugins and usage
+// records keep seeing the routed model name.
+type ModelRewriter interface {
+	RewriteModel(model string) string
+}
+
+// ModelRewriteRule is one step of a ModelRewrite
+type ModelRewriteRule struct {
+	// Kind is strip_prefix, add_suffix, map or regex
+	Kind string `json:"kind"`
+	// Match is the prefix to strip, the suffix to add, the model to map or
+	// the regular expression to replace
+	Match string `json:"match"`
+	// Replace is the model a map rule maps to, or the replacement of a regex
+	// rule, which may reference groups as $1
+	Replace string `json:"replace,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// ModelRewrite rewrites models with rules applied in order, each to the
+// result of the previous one
+type ModelRewrite struct {
+	Rules []ModelRewriteRule `json:"rules,omitempty"`
+}
+
+// Compile checks the rules and compiles their regular expressions
+func (m *ModelRewrite) Compile() error {
+	if m == nil {
+		return nil
+	}
+	for i := range m.Rules {
+		rule := &m.Rules[i]
+		switch rule.Kind {
+		case ModelRewriteStripPrefix, ModelRewriteAddSuffix:
+			if rule.Match == "" {
+				return fmt.Errorf("model_rewrite %s: empty argument", rule.Kind)
+			}
+		case ModelRewriteMap:
+			if rule.Match == "" || rule.Replace == "" {
+				return fmt.Errorf("model_rewrite map: expects <from> <to>")
+			}
+		case ModelRewriteRegex:
+			re, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return fmt.Errorf("model_rewrite regex: %v", err)
+			}
+			rule.re = re
+		default:
+			return fmt.Errorf("model_rewrite: unknown rule '%s' (strip_prefix, add_suffix, map, regex)", rule.Kind)
+		}
+	}
+	return nil
+}
+
+// RewriteModel implements ModelRewriter. Suffixes already present aren't
+// added again; regex rules must have been compiled.
+func (m *ModelRewrite) RewriteModel(model string) string {
+	if m == nil {
+		return model
+	}
+	for _, rule := range m.Rules {
+		switch rule.Kind {
+		case ModelRewriteStripPrefix:
+			model = strings.TrimPrefix(model, rule.Match)
+		case ModelRewriteAddSuffix:
+			if !strings.HasSuffix(model, rule.Match) {
+				model += rule.Match
+			}
+		case ModelRewriteMap:
+			if model == rule.Match {
+				model = rule.Replace
+			}
+		case ModelRewriteRegex:
+			if rule.re != nil {
+				model = rule.re.ReplaceAllString(model, rule.Replace)
+			}
+		}
+	}
+	return model
+}
+
+// UpstreamModel returns the model name the provider is called with
+func (p *ProviderService) UpstreamModel(model string) string {
+	if p.ModelRewriter == nil || model == "" {
+		return model
+	}
+	return p.ModelRewriter.RewriteModel(model)
+}
+
+// WithUpstreamModel returns the request with its model rewritten for the
+// provider; requests needing no change are returned as is
+func (p *ProviderService) WithUpstreamModel(reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	model := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	rewritten := p.UpstreamModel(model)
+	if rewritten == model {
+		return reqJson, nil
+	}
+	return reqJson.CloneWith("model", rewritten)
+}
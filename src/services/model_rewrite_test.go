@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestModelRewrite_RewriteModel(t *testing.T) {
+	rewrite := &ModelRewrite{Rules: []ModelRewriteRule{
+		{Kind: ModelRewriteStripPrefix, Match: "openai/"},
+		{Kind: ModelRewriteMap, Match: "gpt-4o-latest", Replace: "gpt-4o-2024-11-20"},
+		{Kind: ModelRewriteRegex, Match: `^claude-(.*)-latest$`, Replace: "claude-$1-20241022"},
+		{Kind: ModelRewriteAddSuffix, Match: "@eu"},
+	}}
+	if err := rewrite.Compile(); err != nil {
+		t.Fatalf("Compile returned error: %v", err)
+	}
+
+	tests := map[string]string{
+		"openai/gpt-4o-latest":    "gpt-4o-2024-11-20@eu",
+		"gpt-4o-mini":             "gpt-4o-mini@eu",
+		"claude-3-5-haiku-latest": "claude-3-5-haiku-20241022@eu",
+		"mistral-large@eu":        "mistral-large@eu",
+	}
+	for model, want := range tests {
+		if got := rewrite.RewriteModel(model); got != want {
+			t.Errorf("RewriteModel(%q) = %q, want %q", model, got, want)
+		}
+	}
+
+	if err := (&ModelRewrite{Rules: []ModelRewriteRule{{Kind: "upper", Match: "x"}}}).Compile(); err == nil {
+		t.Error("expected unknown rule kind to fail")
+	}
+	if err := (&ModelRewrite{Rules: []ModelRewriteRule{{Kind: ModelRewriteRegex, Match: "("}}}).Compile(); err == nil {
+		t.Error("expected invalid regex to fail")
+	}
+}
+
+func TestProviderService_WithUpstreamModel(t *testing.T) {
+	reqJson, err := styles.ParsePartialJSON([]byte(`{"model":"vendor/gpt-4o","stream":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &ProviderService{}
+	if res, _ := p.WithUpstreamModel(reqJson); styles.TryGetFromPartialJSON[string](res, "model") != "vendor/gpt-4o" {
+		t.Error("expected the model to be kept without a rewriter")
+	}
+
+	p.ModelRewriter = &ModelRewrite{Rules: []ModelRewriteRule{{Kind: ModelRewriteStripPrefix, Match: "vendor/"}}}
+	res, err := p.WithUpstreamModel(reqJson)
+	if err != nil {
+		t.Fatalf("WithUpstreamModel returned error: %v", err)
+	}
+	if got := styles.TryGetFromPartialJSON[string](res, "model"); got != "gpt-4o" {
+		t.Errorf("expected rewritten model gpt-4o, got %q", got)
+	}
+	if got := styles.TryGetFromPartialJSON[string](reqJson, "model"); got != "vendor/gpt-4o" {
+		t.Errorf("expected the original request to be untouched, got %q", got)
+	}
+}
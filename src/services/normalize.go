@@ -0,0 +1,90 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// RequestNormalization tunes the final pass over requests sent to a provider,
+// which removes top-level fields strict providers reject: nulls, empty arrays
+// and objects such as "tools": [], and settings only valid with tools
+// (tool_choice, parallel_tool_calls) when there are none
+type RequestNormalization struct {
+	Disabled  bool `json:"disabled,omitempty"`   // Send requests as they are
+	KeepNulls bool `json:"keep_nulls,omitempty"` // Keep fields set to null
+	KeepEmpty bool `json:"keep_empty,omitempty"` // Keep empty arrays, objects and strings
+	// DropZero names numeric fields removed when 0, e.g. temperature for
+	// providers treating 0 differently from leaving it out
+	DropZero []string `json:"drop_zero,omitempty"`
+}
+
+// toolDependentFields are rejected by OpenAI-compatible APIs without tools
+var toolDependentFields = []string{"tool_choice", "parallel_tool_calls"}
+
+// NormalizeRequest applies the provider's normalization to a request about
+// to be sent; requests needing no change are returned as is
+func (p *ProviderService) NormalizeRequest(reqJson styles.PartialJSON) styles.PartialJSON {
+	n := p.Normalize
+	if n != nil && n.Disabled {
+		return reqJson
+	}
+	if n == nil {
+		n = &RequestNormalization{}
+	}
+
+	var res styles.PartialJSON
+	drop := func(key string) {
+		if res == nil {
+			res = reqJson.Clone()
+		}
+		delete(res, key)
+	}
+	for key, raw := range reqJson {
+		value := bytes.TrimSpace(raw)
+		switch {
+		case !n.KeepNulls && string(value) == "null":
+			drop(key)
+		case !n.KeepEmpty && isEmptyJSON(value):
+			drop(key)
+		}
+	}
+	for _, key := range n.DropZero {
+		if raw, ok := reqJson[key]; ok {
+			var number float64
+			if json.Unmarshal(raw, &number) == nil && number == 0 {
+				drop(key)
+			}
+		}
+	}
+
+	current := reqJson
+	if res != nil {
+		current = res
+	}
+	if _, ok := current["tools"]; !ok {
+		for _, key := range toolDependentFields {
+			if _, ok := current[key]; ok {
+				drop(key)
+			}
+		}
+	}
+
+	if res == nil {
+		return reqJson
+	}
+	return res
+}
+
+// isEmptyJSON reports whether a JSON value is an empty array, object or string
+func isEmptyJSON(value []byte) bool {
+	switch string(value) {
+	case `""`, "[]", "{}":
+		return true
+	}
+	if len(value) < 2 || (value[0] != '[' && value[0] != '{') {
+		return false
+	}
+	return len(bytes.TrimSpace(value[1:len(value)-1])) == 0
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestProviderService_NormalizeRequest(t *testing.T) {
+	req, err := styles.ParsePartialJSON([]byte(`{
+		"model": "m",
+		"messages": [{"role": "assistant", "content": null, "tool_calls": []}],
+		"tools": [],
+		"tool_choice": "auto",
+		"parallel_tool_calls": true,
+		"stop": null,
+		"metadata": { },
+		"user": "",
+		"temperature": 0,
+		"top_p": 0.9
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := (&ProviderService{}).NormalizeRequest(req)
+	for _, key := range []string{"tools", "tool_choice", "parallel_tool_calls", "stop", "metadata", "user"} {
+		if _, ok := out[key]; ok {
+			t.Errorf("expected %s to be removed", key)
+		}
+	}
+	for _, key := range []string{"model", "messages", "temperature", "top_p"} {
+		if _, ok := out[key]; !ok {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+	if string(out["messages"]) != string(req["messages"]) {
+		t.Error("expected nested nulls and empty arrays to be left alone")
+	}
+	if _, ok := req["tools"]; !ok {
+		t.Error("expected the original request to be left unchanged")
+	}
+
+	p := &ProviderService{Normalize: &RequestNormalization{KeepNulls: true, DropZero: []string{"temperature"}}}
+	out = p.NormalizeRequest(req)
+	if _, ok := out["stop"]; !ok {
+		t.Error("expected keep_nulls to keep stop: null")
+	}
+	if _, ok := out["temperature"]; ok {
+		t.Error("expected drop_zero to remove temperature: 0")
+	}
+
+	p.Normalize = &RequestNormalization{Disabled: true}
+	if out = p.NormalizeRequest(req); len(out) != len(req) {
+		t.Error("expected a disabled normalization to send the request as is")
+	}
+
+	// Tool settings stay when tools are sent
+	req, _ = styles.ParsePartialJSON([]byte(`{"tools": [{"type": "function", "function": {"name": "f"}}], "tool_choice": "auto"}`))
+	if out := (&ProviderService{}).NormalizeRequest(req); out["tool_choice"] == nil {
+		t.Error("expected tool_choice to be kept alongside tools")
+	}
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ObjectStoreConfig configures an S3-compatible object store: AWS S3, Google
+// Cloud Storage through its XML API with HMAC keys, or MinIO
+type ObjectStoreConfig struct {
+	// Endpoint is the store's base URL, e.g. https://s3.eu-west-1.amazonaws.com,
+	// https://storage.googleapis.com or http://minio:9000
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	// Region signs requests (default us-east-1; "auto" for GCS)
+	Region    string `json:"region,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	// Prefix is prepended to every object key
+	Prefix string `json:"prefix,omitempty"`
+	// QueueSize is the number of uploads waiting before new ones are dropped (default 1000)
+	QueueSize int `json:"queue_size,omitempty"`
+}
+
+// ObjectStore uploads objects to an S3-compatible bucket, signing requests
+// with AWS Signature Version 4. Uploads queued with PutAsync run on a
+// background worker so requests never wait for storage.
+type ObjectStore struct {
+	endpoint *url.URL
+	cfg      ObjectStoreConfig
+	client   *http.Client
+	logger   *zap.Logger
+	// Encryptor, when set, seals objects before they are uploaded
+	Encryptor *Encryptor
+
+	mu      sync.RWMutex // guards closed against queueing on a closed queue
+	closed  bool
+	queue   chan objectPut
+	idle    chan struct{} // closed once the worker drained the queue
+	dropped atomic.Int64
+}
+
+type objectPut struct {
+	tenant string
+	key    string
+	body   []byte
+}
+
+// NewObjectStore validates the configuration and starts the upload worker
+func NewObjectStore(cfg ObjectStoreConfig, logger *zap.Logger) (*ObjectStore, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("object store: endpoint and bucket are required")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("object store: invalid endpoint '%s'", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	s := &ObjectStore{
+		endpoint: endpoint,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		logger:   logger,
+		queue:    make(chan objectPut, cfg.QueueSize),
+		idle:     make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Put uploads an object and waits for the store to accept it
+func (s *ObjectStore) Put(ctx context.Context, key string, body []byte) error {
+	u := *s.endpoint
+	u.Path += "/" + s.cfg.Bucket + "/" + s.cfg.Prefix + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := s.do(req, body); err != nil {
+		return fmt.Errorf("object store: put %s: %v", key, err)
+	}
+	return nil
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	// Key is the object's key without the store's prefix
+	Key          string
+	LastModified time.Time
+}
+
+// List calls fn for every object whose key starts with prefix, stopping at
+// the first error fn returns
+func (s *ObjectStore) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	token := ""
+	for {
+		u := *s.endpoint
+		u.Path += "/" + s.cfg.Bucket
+		query := url.Values{"list-type": {"2"}, "prefix": {s.cfg.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = query.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		data, err := s.do(req, nil)
+		if err != nil {
+			return fmt.Errorf("object store: list %s: %v", prefix, err)
+		}
+		// A ListObjectsV2 result page
+		var page struct {
+			Contents []struct {
+				Key          string
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := xml.Unmarshal(data, &page); err != nil {
+			return fmt.Errorf("object store: list %s: %v", prefix, err)
+		}
+		for _, object := range page.Contents {
+			if err := fn(ObjectInfo{Key: strings.TrimPrefix(object.Key, s.cfg.Prefix), LastModified: object.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// Delete removes an object; removing a missing object succeeds
+func (s *ObjectStore) Delete(ctx context.Context, key string) error {
+	u := *s.endpoint
+	u.Path += "/" + s.cfg.Bucket + "/" + s.cfg.Prefix + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if _, err := s.do(req, nil); err != nil {
+		return fmt.Errorf("object store: delete %s: %v", key, err)
+	}
+	return nil
+}
+
+// DeleteMatching removes the objects under prefix that keep reports false
+// for, returning how many it removed
+func (s *ObjectStore) DeleteMatching(ctx context.Context, prefix string, keep func(ObjectInfo) bool) (int, error) {
+	deleted := 0
+	err := s.List(ctx, prefix, func(object ObjectInfo) error {
+		if keep != nil && keep(object) {
+			return nil
+		}
+		if err := s.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+		deleted++
+		return nil
+	})
+	return deleted, err
+}
+
+// do signs and sends a request to the store, returning the response body
+func (s *ObjectStore) do(req *http.Request, body []byte) ([]byte, error) {
+	if s.cfg.AccessKey != "" {
+		signV4(req, body, s.cfg.AccessKey, s.cfg.SecretKey, s.cfg.Region, "s3", time.Now())
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return io.ReadAll(res.Body)
+}
+
+// PutAsync queues an upload; it reports false and drops the object when the
+// queue is full or the store is closed
+func (s *ObjectStore) PutAsync(key string, body []byte) bool {
+	return s.PutTenantAsync("", key, body)
+}
+
+// PutTenantAsync queues the upload of a tenant's object, sealed with the
+// tenant's key when the store encrypts
+func (s *ObjectStore) PutTenantAsync(tenant, key string, body []byte) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.queue <- objectPut{tenant: tenant, key: key, body: body}:
+		return true
+	default:
+		s.dropped.Add(1)
+		s.logger.Warn("object store queue full, dropping object", zap.String("key", key))
+		return false
+	}
+}
+
+// Dropped returns the number of objects dropped because the queue was full
+func (s *ObjectStore) Dropped() int64 { return s.dropped.Load() }
+
+// Close stops accepting uploads and waits for the queued ones to finish
+func (s *ObjectStore) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.idle
+}
+
+func (s *ObjectStore) run() {
+	defer close(s.idle)
+	for put := range s.queue {
+		// Sealing happens here, so requests never wait for a KMS either
+		if s.Encryptor != nil {
+			sealed, err := s.Encryptor.Seal(context.Background(), put.tenant, put.body)
+			if err != nil {
+				s.logger.Warn("object store encryption failed, dropping object", zap.String("key", put.key), zap.Error(err))
+				continue
+			}
+			put.body = sealed
+		}
+		if err := s.Put(context.Background(), put.key, put.body); err != nil {
+			s.logger.Warn("object store upload failed", zap.String("key", put.key), zap.Error(err))
+		}
+	}
+}
+
+var teeStore atomic.Pointer[ObjectStore]
+
+// SetTeeStore sets the store receiving teed responses; nil disables teeing
+func SetTeeStore(s *ObjectStore) { teeStore.Store(s) }
+
+// TeeStore returns the store receiving teed responses, if configured
+func TeeStore() *ObjectStore { return teeStore.Load() }
+
+// ClearTeeStore disables teeing if s is still the configured store, so a
+// stopping config doesn't clear the store of the config replacing it
+func ClearTeeStore(s *ObjectStore) { teeStore.CompareAndSwap(s, nil) }
+
+// TenantObjectPrefix is the prefix of the objects stored for a tenant, so a
+// tenant's data can be erased without reading every object
+func TenantObjectPrefix(tenant string) string {
+	return "tenants/" + url.PathEscape(tenant) + "/"
+}
+
+// signV4 signs a request to an AWS service with Signature Version 4, signing
+// the host and every header already set on the request
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapeS3Path(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// escapeS3Path URI-encodes every byte of a path except unreserved characters
+// and slashes, as S3 signing requires
+func escapeS3Path(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
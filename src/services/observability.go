@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"time"
+)
+
+// ObservabilityEvent is an event in the router's normalized format, delivered
+// to every sink of the router that produced it. Properties use PostHog's LLM
+// analytics names ($ai_model, $ai_input_tokens, ...), which other sinks map to
+// their own schema. Sinks must not modify the properties.
+type ObservabilityEvent struct {
+	Name       string
+	DistinctID string
+	// Project selects the PostHog project (see PosthogProject); other sinks ignore it
+	Project    string
+	URL        string
+	Time       time.Time
+	Properties map[string]any
+}
+
+// ObservabilitySink receives observability events. Send is called on the
+// request path and must not wait for network I/O.
+type ObservabilitySink interface {
+	Send(event ObservabilityEvent) error
+	// Close flushes pending events and releases the sink
+	Close() error
+}
+
+// EventBatching controls how events are batched before being sent; zero
+// values keep each sink's defaults
+type EventBatching struct {
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// DefaultObservabilitySinks receive the events of routers without their own
+// sinks, and process-wide events
+var DefaultObservabilitySinks = []ObservabilitySink{PosthogSink{}}
+
+// EmitObservabilityEvent sends an event to the sinks of a router, or to the
+// default sinks when router is nil or has no sinks configured
+func EmitObservabilityEvent(router *RouterService, event ObservabilityEvent) error {
+	sinks := DefaultObservabilitySinks
+	if router != nil && router.Sinks != nil {
+		sinks = router.Sinks
+	}
+	if event.DistinctID == "" {
+		event.DistinctID = "anonymous"
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Properties == nil {
+		event.Properties = map[string]any{}
+	}
+	if router != nil {
+		router.Metrics.Record(event)
+	}
+
+	var sendErrs []error
+	for _, sink := range sinks {
+		if err := sink.Send(event); err != nil {
+			sendErrs = append(sendErrs, err)
+		}
+	}
+	return errors.Join(sendErrs...)
+}
+
+// FireObservabilityEvent sends an event to the default sinks
+func FireObservabilityEvent(userId, url, eventName string, properties map[string]any) error {
+	return EmitObservabilityEvent(nil, ObservabilityEvent{
+		Name:       eventName,
+		DistinctID: userId,
+		URL:        url,
+		Properties: properties,
+	})
+}
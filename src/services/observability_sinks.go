@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Defaults of the HTTP sinks
+const (
+	defaultSinkBatchSize     = 100
+	defaultSinkFlushInterval = 5 * time.Second
+	sinkRequestTimeout       = 10 * time.Second
+	defaultLangfuseURL       = "https://cloud.langfuse.com"
+)
+
+// ErrSinkQueueFull is returned when a sink drops an event because its
+// upstream does not keep up
+var ErrSinkQueueFull = errors.New("observability sink queue full, event dropped")
+
+// SinkConfig configures the HTTP observability sinks
+type SinkConfig struct {
+	// URL is the webhook URL, OTLP/HTTP collector URL or Langfuse host
+	URL string
+	// Headers are added to every request, e.g. authorization
+	Headers map[string]string
+	// PublicKey and SecretKey authenticate to Langfuse
+	PublicKey string
+	SecretKey string
+	Batching  EventBatching
+	// Logger reports failed deliveries
+	Logger *zap.Logger
+}
+
+// batchSink queues events and delivers them in batches from a background
+// goroutine, so that sending never blocks a request
+type batchSink struct {
+	name    string
+	events  chan ObservabilityEvent
+	size    int
+	every   time.Duration
+	deliver func(ctx context.Context, batch []ObservabilityEvent) error
+	logger  *zap.Logger
+	closing sync.Once
+	done    chan struct{}
+}
+
+func newBatchSink(name string, cfg SinkConfig, deliver func(ctx context.Context, batch []ObservabilityEvent) error) *batchSink {
+	s := &batchSink{
+		name:    name,
+		size:    cfg.Batching.BatchSize,
+		every:   cfg.Batching.FlushInterval,
+		deliver: deliver,
+		logger:  cfg.Logger,
+		done:    make(chan struct{}),
+	}
+	if s.size <= 0 {
+		s.size = defaultSinkBatchSize
+	}
+	if s.every <= 0 {
+		s.every = defaultSinkFlushInterval
+	}
+	if s.logger == nil {
+		s.logger = zap.NewNop()
+	}
+	s.events = make(chan ObservabilityEvent, 10*s.size)
+	go s.run()
+	return s
+}
+
+func (s *batchSink) Send(event ObservabilityEvent) error {
+	select {
+	case s.events <- event:
+		return nil
+	default:
+		return fmt.Errorf("%s: %w", s.name, ErrSinkQueueFull)
+	}
+}
+
+func (s *batchSink) Close() error {
+	s.closing.Do(func() { close(s.events) })
+	<-s.done
+	return nil
+}
+
+func (s *batchSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.every)
+	defer ticker.Stop()
+
+	batch := make([]ObservabilityEvent, 0, s.size)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), sinkRequestTimeout)
+		defer cancel()
+		if err := s.deliver(ctx, batch); err != nil {
+			s.logger.Warn("observability sink delivery failed",
+				zap.String("sink", s.name),
+				zap.Int("events", len(batch)),
+				zap.Error(err))
+		}
+		batch = make([]ObservabilityEvent, 0, s.size)
+	}
+
+	for {
+		select {
+		case event, ok := <-s.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= s.size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// postJSON sends a JSON body and fails on non-2xx responses
+func postJSON(ctx context.Context, url string, headers map[string]string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: status %d: %s", url, res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// NewWebhookSink posts batches of events as JSON:
+// {"events": [{"event", "distinct_id", "timestamp", "properties"}]}
+func NewWebhookSink(cfg SinkConfig) ObservabilitySink {
+	return newBatchSink("webhook", cfg, func(ctx context.Context, batch []ObservabilityEvent) error {
+		events := make([]map[string]any, len(batch))
+		for i, event := range batch {
+			events[i] = map[string]any{
+				"event":       event.Name,
+				"distinct_id": event.DistinctID,
+				"timestamp":   event.Time.UTC().Format(time.RFC3339Nano),
+				"properties":  event.Properties,
+			}
+		}
+		return postJSON(ctx, cfg.URL, cfg.Headers, map[string]any{"events": events})
+	})
+}
+
+// NewLangfuseSink sends events to the Langfuse ingestion API: generations
+// become traces with a generation, other events become trace events
+func NewLangfuseSink(cfg SinkConfig) ObservabilitySink {
+	host := strings.TrimSuffix(cfg.URL, "/")
+	if host == "" {
+		host = defaultLangfuseURL
+	}
+	headers := map[string]string{
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(cfg.PublicKey+":"+cfg.SecretKey)),
+	}
+	for name, value := range cfg.Headers {
+		headers[name] = value
+	}
+	return newBatchSink("langfuse", cfg, func(ctx context.Context, batch []ObservabilityEvent) error {
+		var ingestion []map[string]any
+		for _, event := range batch {
+			ingestion = append(ingestion, langfuseEvents(event)...)
+		}
+		return postJSON(ctx, host+"/api/public/ingestion", headers, map[string]any{"batch": ingestion})
+	})
+}
+
+// langfuseEvents maps an event to Langfuse ingestion events
+func langfuseEvents(event ObservabilityEvent) []map[string]any {
+	props := event.Properties
+	traceID, _ := props["$ai_trace_id"].(string)
+	if traceID == "" {
+		traceID = uuid.New().String()
+	}
+	timestamp := event.Time.UTC().Format(time.RFC3339Nano)
+	envelope := func(typ string, body map[string]any) map[string]any {
+		return map[string]any{"id": uuid.New().String(), "timestamp": timestamp, "type": typ, "body": body}
+	}
+
+	if event.Name != "$ai_generation" {
+		return []map[string]any{envelope("event-create", map[string]any{
+			"id":        uuid.New().String(),
+			"traceId":   traceID,
+			"name":      event.Name,
+			"startTime": timestamp,
+			"metadata":  props,
+		})}
+	}
+
+	start := event.Time
+	if latency, ok := props["$ai_latency"].(float64); ok {
+		start = start.Add(-time.Duration(latency * float64(time.Second)))
+	}
+	generation := map[string]any{
+		"id":        uuid.New().String(),
+		"traceId":   traceID,
+		"name":      "chat.completions",
+		"model":     props["$ai_model"],
+		"startTime": start.UTC().Format(time.RFC3339Nano),
+		"endTime":   timestamp,
+		"input":     props["$ai_input"],
+		"output":    props["$ai_output_choices"],
+		"metadata":  props,
+		"usage": map[string]any{
+			"input":  props["$ai_input_tokens"],
+			"output": props["$ai_output_tokens"],
+			"unit":   "TOKENS",
+		},
+	}
+	if isError, _ := props["$ai_is_error"].(bool); isError {
+		generation["level"] = "ERROR"
+		generation["statusMessage"] = props["$ai_error_message"]
+	}
+	return []map[string]any{
+		envelope("trace-create", map[string]any{
+			"id":        traceID,
+			"name":      "chat.completions",
+			"userId":    event.DistinctID,
+			"timestamp": start.UTC().Format(time.RFC3339Nano),
+		}),
+		envelope("generation-create", generation),
+	}
+}
+
+// NewOTLPLogsSink exports events as OTLP log records over HTTP/JSON to a
+// collector; the URL is the collector base URL or its /v1/logs endpoint
+func NewOTLPLogsSink(cfg SinkConfig) ObservabilitySink {
+	endpoint := strings.TrimSuffix(cfg.URL, "/")
+	if !strings.HasSuffix(endpoint, "/v1/logs") {
+		endpoint += "/v1/logs"
+	}
+	return newBatchSink("otlp", cfg, func(ctx context.Context, batch []ObservabilityEvent) error {
+		records := make([]map[string]any, len(batch))
+		for i, event := range batch {
+			attributes := []map[string]any{
+				otlpAttribute("event.name", event.Name),
+				otlpAttribute("user.id", event.DistinctID),
+			}
+			for key, value := range event.Properties {
+				attributes = append(attributes, otlpAttribute(key, value))
+			}
+			severity, number := "INFO", 9
+			if isError, _ := event.Properties["$ai_is_error"].(bool); isError {
+				severity, number = "ERROR", 17
+			}
+			records[i] = map[string]any{
+				"timeUnixNano":   strconv.FormatInt(event.Time.UnixNano(), 10),
+				"severityText":   severity,
+				"severityNumber": number,
+				"body":           map[string]any{"stringValue": event.Name},
+				"attributes":     attributes,
+			}
+		}
+		return postJSON(ctx, endpoint, cfg.Headers, map[string]any{
+			"resourceLogs": []map[string]any{{
+				"resource": map[string]any{"attributes": []map[string]any{
+					otlpAttribute("service.name", "open-ai-router"),
+				}},
+				"scopeLogs": []map[string]any{{
+					"scope":      map[string]any{"name": "open-ai-router"},
+					"logRecords": records,
+				}},
+			}},
+		})
+	})
+}
+
+// otlpAttribute encodes a key/value pair as an OTLP JSON attribute
+func otlpAttribute(key string, value any) map[string]any {
+	var encoded map[string]any
+	switch v := value.(type) {
+	case string:
+		encoded = map[string]any{"stringValue": v}
+	case bool:
+		encoded = map[string]any{"boolValue": v}
+	case int:
+		encoded = map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		encoded = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		encoded = map[string]any{"doubleValue": v}
+	default:
+		data, _ := json.Marshal(v)
+		encoded = map[string]any{"stringValue": string(data)}
+	}
+	return map[string]any{"key": key, "value": encoded}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingServer collects the JSON bodies posted to it
+type recordingServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	bodies  []map[string]any
+	headers []http.Header
+}
+
+func newRecordingServer(t *testing.T) *recordingServer {
+	rs := &recordingServer{}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		_ = json.Unmarshal(data, &body)
+		rs.mu.Lock()
+		rs.bodies = append(rs.bodies, body)
+		rs.headers = append(rs.headers, r.Header.Clone())
+		rs.mu.Unlock()
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func (rs *recordingServer) received() ([]map[string]any, []http.Header) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.bodies, rs.headers
+}
+
+func generationEvent() ObservabilityEvent {
+	return ObservabilityEvent{
+		Name:       "$ai_generation",
+		DistinctID: "user-1",
+		Time:       time.Unix(1700000000, 0),
+		Properties: map[string]any{
+			"$ai_trace_id":      "trace-1",
+			"$ai_model":         "gpt-4.1",
+			"$ai_latency":       1.5,
+			"$ai_input_tokens":  10,
+			"$ai_output_tokens": 20,
+			"$ai_is_error":      false,
+		},
+	}
+}
+
+func TestWebhookSinkBatchesAndFlushesOnClose(t *testing.T) {
+	rs := newRecordingServer(t)
+	sink := NewWebhookSink(SinkConfig{
+		URL:      rs.URL,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Batching: EventBatching{BatchSize: 2, FlushInterval: time.Hour},
+	})
+	for range 3 {
+		if err := sink.Send(generationEvent()); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	_ = sink.Close()
+
+	bodies, headers := rs.received()
+	if len(bodies) != 2 {
+		t.Fatalf("got %d batches, want 2 (one full, one flushed on close)", len(bodies))
+	}
+	if events := bodies[0]["events"].([]any); len(events) != 2 {
+		t.Errorf("first batch has %d events", len(events))
+	}
+	event := bodies[0]["events"].([]any)[0].(map[string]any)
+	if event["event"] != "$ai_generation" || event["distinct_id"] != "user-1" {
+		t.Errorf("unexpected event %v", event)
+	}
+	if headers[0].Get("Authorization") != "Bearer token" {
+		t.Errorf("missing configured header")
+	}
+}
+
+func TestLangfuseSinkMapsGenerations(t *testing.T) {
+	rs := newRecordingServer(t)
+	sink := NewLangfuseSink(SinkConfig{URL: rs.URL, PublicKey: "pk", SecretKey: "sk"})
+	_ = sink.Send(generationEvent())
+	_ = sink.Send(ObservabilityEvent{Name: "ai_fallback", Time: time.Now(), Properties: map[string]any{"$ai_trace_id": "trace-1"}})
+	_ = sink.Close()
+
+	bodies, headers := rs.received()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d requests", len(bodies))
+	}
+	if user, pass, ok := (&http.Request{Header: headers[0]}).BasicAuth(); !ok || user != "pk" || pass != "sk" {
+		t.Errorf("unexpected auth %q %q", user, pass)
+	}
+	var types []string
+	for _, item := range bodies[0]["batch"].([]any) {
+		types = append(types, item.(map[string]any)["type"].(string))
+	}
+	if len(types) != 3 || types[0] != "trace-create" || types[1] != "generation-create" || types[2] != "event-create" {
+		t.Fatalf("unexpected ingestion types %v", types)
+	}
+	generation := bodies[0]["batch"].([]any)[1].(map[string]any)["body"].(map[string]any)
+	usage := generation["usage"].(map[string]any)
+	if generation["traceId"] != "trace-1" || generation["model"] != "gpt-4.1" || usage["input"] != 10.0 {
+		t.Errorf("unexpected generation %v", generation)
+	}
+	if generation["startTime"] != "2023-11-14T22:13:18.5Z" {
+		t.Errorf("startTime should account for latency, got %v", generation["startTime"])
+	}
+}
+
+func TestOTLPLogsSinkEncodesAttributes(t *testing.T) {
+	rs := newRecordingServer(t)
+	sink := NewOTLPLogsSink(SinkConfig{URL: rs.URL})
+	_ = sink.Send(generationEvent())
+	_ = sink.Close()
+
+	bodies, _ := rs.received()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d requests", len(bodies))
+	}
+	record := bodies[0]["resourceLogs"].([]any)[0].(map[string]any)["scopeLogs"].([]any)[0].(map[string]any)["logRecords"].([]any)[0].(map[string]any)
+	if record["timeUnixNano"] != "1700000000000000000" || record["body"].(map[string]any)["stringValue"] != "$ai_generation" {
+		t.Errorf("unexpected record %v", record)
+	}
+	attributes := map[string]any{}
+	for _, a := range record["attributes"].([]any) {
+		attr := a.(map[string]any)
+		attributes[attr["key"].(string)] = attr["value"]
+	}
+	if v := attributes["$ai_input_tokens"].(map[string]any); v["intValue"] != "10" {
+		t.Errorf("int attribute = %v", v)
+	}
+	if v := attributes["$ai_latency"].(map[string]any); v["doubleValue"] != 1.5 {
+		t.Errorf("double attribute = %v", v)
+	}
+}
+
+func TestBatchSinkDropsWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	sink := newBatchSink("test", SinkConfig{Batching: EventBatching{BatchSize: 1, FlushInterval: time.Hour}},
+		func(_ context.Context, _ []ObservabilityEvent) error {
+			<-block
+			return nil
+		})
+	var dropped bool
+	for range 100 {
+		if err := sink.Send(generationEvent()); err != nil {
+			dropped = true
+			break
+		}
+	}
+	close(block)
+	_ = sink.Close()
+	if !dropped {
+		t.Error("expected events to be dropped once the queue is full")
+	}
+}
+
+func TestEmitUsesRouterSinks(t *testing.T) {
+	rs := newRecordingServer(t)
+	sink := NewWebhookSink(SinkConfig{URL: rs.URL})
+	router := &RouterService{Sinks: []ObservabilitySink{sink}}
+	if err := EmitObservabilityEvent(router, ObservabilityEvent{Name: "ai_error"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = sink.Close()
+
+	bodies, _ := rs.received()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d requests", len(bodies))
+	}
+	event := bodies[0]["events"].([]any)[0].(map[string]any)
+	if event["distinct_id"] != "anonymous" || event["timestamp"] == "" {
+		t.Errorf("defaults not applied: %v", event)
+	}
+}
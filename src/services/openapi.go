@@ -0,0 +1,332 @@
+package services
+
+import (
+	"slices"
+	"strings"
+)
+
+// Kinds of the router's handlers described by BuildOpenAPI
+const (
+	OpenAPIChatCompletions  = "chat_completions"
+	OpenAPIEmbeddings       = "embeddings"
+	OpenAPIListModels       = "list_models"
+	OpenAPIPartialResponses = "partial_responses"
+	OpenAPIPrompts          = "prompts"
+	OpenAPIAPIKeys          = "api_keys"
+	OpenAPIEvals            = "evals"
+	OpenAPILeaderboard      = "leaderboard"
+	OpenAPIStats            = "stats"
+	OpenAPIData             = "data"
+	OpenAPIDebug            = "debug"
+	OpenAPIVersion          = "version"
+)
+
+// OpenAPIEndpoint is a handler configured on a path
+type OpenAPIEndpoint struct {
+	Kind string
+	Path string
+}
+
+// OpenAPIInfo describes the instance in the generated document
+type OpenAPIInfo struct {
+	Title   string
+	Version string
+	// Plugins are the plugin names a model may carry, listed as the model
+	// field's x-plugins
+	Plugins []string
+}
+
+// openAPIPaths maps a path to its operations by lower-case method
+type openAPIPaths map[string]map[string]any
+
+func (p openAPIPaths) add(path, method string, op map[string]any) {
+	if p[path] == nil {
+		p[path] = map[string]any{}
+	}
+	p[path][method] = op
+}
+
+// BuildOpenAPI returns an OpenAPI 3.1 document describing the endpoints,
+// with the fields the router adds to the OpenAI API. Endpoints of one kind
+// on the same path are described once.
+func BuildOpenAPI(info OpenAPIInfo, endpoints []OpenAPIEndpoint) map[string]any {
+	paths := openAPIPaths{}
+	for _, e := range endpoints {
+		base := strings.TrimSuffix(e.Path, "/")
+		switch e.Kind {
+		case OpenAPIChatCompletions:
+			paths.add(e.Path, "post", openAPIOperation("Create a chat completion", "inference", true,
+				openAPIRef("ChatCompletionRequest"), openAPIChatResponses()))
+		case OpenAPIEmbeddings:
+			paths.add(e.Path, "post", openAPIOperation("Create embeddings", "inference", true,
+				openAPIRef("EmbeddingsRequest"), openAPIJSONResponse("The embeddings", openAPIRef("EmbeddingsResponse"))))
+		case OpenAPIListModels:
+			paths.add(e.Path, "get", openAPIOperation("List the models of every provider", "inference", true,
+				nil, openAPIJSONResponse("The models", openAPIRef("ModelList"))))
+		case OpenAPIPartialResponses:
+			op := openAPIOperation("Get what an aborted stream generated", "inference", true,
+				nil, openAPIJSONResponse("The partial chat completion", openAPIRef("ChatCompletion")))
+			op["parameters"] = []any{openAPIParam("trace_id", "path", "The X-Trace-Id of the stream")}
+			paths.add(base+"/{trace_id}", "get", op)
+		case OpenAPIPrompts:
+			paths.add(base, "get", openAPIAdmin("List the latest version of every prompt", nil))
+			paths.add(base, "post", openAPIAdmin("Create a prompt", openAPIRef("Prompt")))
+			paths.add(base+"/{id}", "get", openAPIAdmin("Get a prompt, or one of its versions with ?version=N", nil, openAPIParam("id", "path", "")))
+			paths.add(base+"/{id}", "post", openAPIAdmin("Save a new version of a prompt", openAPIRef("Prompt"), openAPIParam("id", "path", "")))
+			paths.add(base+"/{id}", "delete", openAPIAdmin("Delete a prompt with its versions", nil, openAPIParam("id", "path", "")))
+			paths.add(base+"/{id}/versions", "get", openAPIAdmin("List every version of a prompt", nil, openAPIParam("id", "path", "")))
+		case OpenAPIAPIKeys:
+			paths.add(base, "get", openAPIAdmin("List the tenant's API keys", nil))
+			paths.add(base, "post", openAPIAdmin("Create an API key, returning its secret", openAPIObject("name", "role")))
+			paths.add(base+"/{id}", "get", openAPIAdmin("Get an API key", nil, openAPIParam("id", "path", "")))
+			paths.add(base+"/{id}", "delete", openAPIAdmin("Revoke an API key", nil, openAPIParam("id", "path", "")))
+			paths.add(base+"/{id}/rotate", "post", openAPIAdmin("Replace an API key's secret, returning the new one", nil, openAPIParam("id", "path", "")))
+		case OpenAPIEvals:
+			paths.add(base, "post", openAPIAdmin("Run an eval dataset against models", openAPIObject("dataset", "cases", "models", "judge_model")))
+			paths.add(base+"/datasets", "get", openAPIAdmin("List the stored datasets", nil))
+			paths.add(base+"/datasets/{name}", "put", openAPIAdmin("Store a dataset", openAPIObject("cases", "judge_model"), openAPIParam("name", "path", "")))
+			paths.add(base+"/datasets/{name}", "get", openAPIAdmin("Get a stored dataset", nil, openAPIParam("name", "path", "")))
+			paths.add(base+"/datasets/{name}", "delete", openAPIAdmin("Delete a stored dataset", nil, openAPIParam("name", "path", "")))
+		case OpenAPILeaderboard:
+			paths.add(e.Path, "get", openAPIAdmin("Rank providers and models by recent performance", nil,
+				openAPIParam("window", "query", "Duration of the ranked window, e.g. 15m")))
+		case OpenAPIStats:
+			paths.add(e.Path, "get", openAPIAdmin("Get request, error, token and cost time series", nil,
+				openAPIParam("from", "query", "Unix milliseconds or RFC 3339 time"),
+				openAPIParam("to", "query", "Unix milliseconds or RFC 3339 time"),
+				openAPIParam("step", "query", "Duration or milliseconds"),
+				openAPIParam("provider", "query", ""),
+				openAPIParam("model", "query", "")))
+		case OpenAPIData:
+			paths.add(e.Path, "delete", openAPIAdmin("Erase what the router stores about a tenant", nil,
+				openAPIParam("tenant", "query", "")))
+		case OpenAPIVersion:
+			paths.add(e.Path, "get", openAPIAdmin("Get the router's version, build and compiled-in modules", nil))
+		case OpenAPIDebug:
+			paths.add(e.Path, "get", openAPIAdmin("Get the streams in flight", nil,
+				openAPIParam("stacks", "query", "1 for the stacks of all goroutines as text")))
+		}
+	}
+
+	version := info.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+	title := info.Title
+	if title == "" {
+		title = "Open AI Router"
+	}
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info":    map[string]any{"title": title, "version": version},
+		"tags": []any{
+			map[string]any{"name": "inference", "description": "OpenAI-compatible endpoints"},
+			map[string]any{"name": "admin", "description": "Administration endpoints, protected outside the router"},
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+			"schemas": openAPISchemas(info.Plugins),
+		},
+	}
+}
+
+// openAPIOperation returns an operation; inference operations take the
+// router's credentials
+func openAPIOperation(summary, tag string, auth bool, body any, responses map[string]any) map[string]any {
+	op := map[string]any{
+		"summary":   summary,
+		"tags":      []string{tag},
+		"responses": responses,
+	}
+	if body != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": body}},
+		}
+	}
+	if auth {
+		op["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+		responses["401"] = openAPIJSONResponse("Missing or invalid credentials", openAPIRef("Error"))["200"]
+	}
+	return op
+}
+
+// openAPIAdmin returns an admin operation answering JSON
+func openAPIAdmin(summary string, body any, params ...map[string]any) map[string]any {
+	op := openAPIOperation(summary, "admin", false, body, openAPIJSONResponse("OK", map[string]any{"type": "object"}))
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	return op
+}
+
+func openAPIJSONResponse(description string, schema any) map[string]any {
+	return map[string]any{"200": map[string]any{
+		"description": description,
+		"content":     map[string]any{"application/json": map[string]any{"schema": schema}},
+	}}
+}
+
+// openAPIChatResponses describes the answers of chat completions, JSON or
+// an SSE stream, with the router's trace header
+func openAPIChatResponses() map[string]any {
+	return map[string]any{
+		"200": map[string]any{
+			"description": "The completion, or a stream of chunks when stream is true",
+			"headers": map[string]any{
+				"X-Trace-Id": map[string]any{
+					"description": "Trace of the request; names the partial response of an aborted stream",
+					"schema":      map[string]any{"type": "string"},
+				},
+			},
+			"content": map[string]any{
+				"application/json":  map[string]any{"schema": openAPIRef("ChatCompletion")},
+				"text/event-stream": map[string]any{"schema": map[string]any{"type": "string", "description": "data: events carrying ChatCompletionChunk objects, then data: [DONE]"}},
+			},
+		},
+		"400": openAPIJSONResponse("Invalid request", openAPIRef("Error"))["200"],
+		"429": openAPIJSONResponse("Rate limit or quota exceeded", openAPIRef("Error"))["200"],
+		"502": openAPIJSONResponse("Every provider failed", openAPIRef("Error"))["200"],
+	}
+}
+
+func openAPIRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func openAPIParam(name, in, description string) map[string]any {
+	param := map[string]any{"name": name, "in": in, "schema": map[string]any{"type": "string"}}
+	if in == "path" {
+		param["required"] = true
+	}
+	if description != "" {
+		param["description"] = description
+	}
+	return param
+}
+
+// openAPIObject returns an object schema naming some of its properties
+func openAPIObject(properties ...string) map[string]any {
+	props := map[string]any{}
+	for _, name := range properties {
+		props[name] = map[string]any{}
+	}
+	return map[string]any{"type": "object", "properties": props}
+}
+
+// openAPISchemas returns the schemas of the OpenAI-compatible endpoints,
+// covering the fields the router adds and leaving the rest open
+func openAPISchemas(plugins []string) map[string]any {
+	model := map[string]any{
+		"type": "string",
+		"description": "provider/model, or a virtual model. Fallbacks are separated with '|', " +
+			"and plugins are appended with '+name:params'.",
+	}
+	if len(plugins) > 0 {
+		model["x-plugins"] = slices.Sorted(slices.Values(plugins))
+	}
+	extras := map[string]any{
+		"type":                 "object",
+		"description":          "Router extensions: prompt_id, prompt_version and prompt_variables in requests; timed_out, notice and tools in responses",
+		"additionalProperties": true,
+	}
+	usage := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"prompt_tokens":     map[string]any{"type": "integer"},
+			"completion_tokens": map[string]any{"type": "integer"},
+			"total_tokens":      map[string]any{"type": "integer"},
+		},
+		"additionalProperties": true,
+	}
+	message := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"role":              map[string]any{"type": "string"},
+			"content":           map[string]any{},
+			"reasoning_content": map[string]any{"type": "string", "description": "Reasoning or thinking of the model, whatever the provider"},
+			"tool_calls":        map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+		},
+		"additionalProperties": true,
+	}
+	return map[string]any{
+		"ChatCompletionRequest": map[string]any{
+			"type":     "object",
+			"required": []string{"model", "messages"},
+			"properties": map[string]any{
+				"model":            model,
+				"messages":         map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+				"stream":           map[string]any{"type": "boolean"},
+				"reasoning_effort": map[string]any{"type": "string"},
+				"thinking":         map[string]any{"type": "object", "description": "Anthropic extended thinking, mapped for each provider"},
+				"extras":           extras,
+			},
+			"additionalProperties": true,
+		},
+		"ChatCompletion": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"id":      map[string]any{"type": "string"},
+				"object":  map[string]any{"type": "string"},
+				"created": map[string]any{"type": "integer"},
+				"model":   map[string]any{"type": "string"},
+				"choices": map[string]any{"type": "array", "items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"index":         map[string]any{"type": "integer"},
+						"message":       message,
+						"finish_reason": map[string]any{"type": []string{"string", "null"}},
+					},
+				}},
+				"usage":  usage,
+				"extras": extras,
+			},
+			"additionalProperties": true,
+		},
+		"EmbeddingsRequest": map[string]any{
+			"type":     "object",
+			"required": []string{"model", "input"},
+			"properties": map[string]any{
+				"model": model,
+				"input": map[string]any{},
+			},
+			"additionalProperties": true,
+		},
+		"EmbeddingsResponse": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"object": map[string]any{"type": "string"},
+				"data":   map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+				"model":  map[string]any{"type": "string"},
+				"usage":  usage,
+			},
+		},
+		"ModelList": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"object": map[string]any{"type": "string"},
+				"data": map[string]any{"type": "array", "items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"id":       map[string]any{"type": "string", "description": "provider/model"},
+						"object":   map[string]any{"type": "string"},
+						"owned_by": map[string]any{"type": "string"},
+					},
+				}},
+			},
+		},
+		"Prompt": openAPIObject("id", "description", "messages"),
+		"Error": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"error": map[string]any{"type": "object", "properties": map[string]any{
+					"message": map[string]any{"type": "string"},
+					"type":    map[string]any{"type": "string"},
+				}},
+			},
+		},
+	}
+}
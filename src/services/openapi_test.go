@@ -0,0 +1,61 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildOpenAPI(t *testing.T) {
+	doc := BuildOpenAPI(OpenAPIInfo{Title: "Gateway", Plugins: []string{"models", "fallback"}}, []OpenAPIEndpoint{
+		{Kind: OpenAPIChatCompletions, Path: "/v1/chat/completions"},
+		{Kind: OpenAPIChatCompletions, Path: "/v1/chat/completions"},
+		{Kind: OpenAPIPrompts, Path: "/v1/prompts/"},
+		{Kind: OpenAPIStats, Path: "/admin/stats.json"},
+	})
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("document does not marshal: %v", err)
+	}
+	var got struct {
+		OpenAPI    string                                `json:"openapi"`
+		Info       struct{ Title string }                `json:"info"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Plugins []string `json:"x-plugins"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.OpenAPI != "3.1.0" || got.Info.Title != "Gateway" {
+		t.Errorf("openapi = %s, title = %s", got.OpenAPI, got.Info.Title)
+	}
+	wantOps := map[string][]string{
+		"/v1/chat/completions":      {"post"},
+		"/v1/prompts":               {"get", "post"},
+		"/v1/prompts/{id}":          {"get", "post", "delete"},
+		"/v1/prompts/{id}/versions": {"get"},
+		"/admin/stats.json":         {"get"},
+	}
+	if len(got.Paths) != len(wantOps) {
+		t.Errorf("paths = %v", got.Paths)
+	}
+	for path, methods := range wantOps {
+		if len(got.Paths[path]) != len(methods) {
+			t.Errorf("%s has operations %v, want %v", path, got.Paths[path], methods)
+		}
+		for _, method := range methods {
+			if _, ok := got.Paths[path][method]; !ok {
+				t.Errorf("missing %s %s", method, path)
+			}
+		}
+	}
+	if plugins := got.Components.Schemas["ChatCompletionRequest"].Properties["model"].Plugins; len(plugins) != 2 || plugins[0] != "fallback" {
+		t.Errorf("x-plugins = %v, want the sorted plugin names", plugins)
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"time"
+)
+
+// defaultPartialTTL is how long partial responses are kept
+const defaultPartialTTL = time.Hour
+
+// ErrPartialNotFound is returned for traces without a kept partial response
+var ErrPartialNotFound = errors.New("partial response not found")
+
+// PartialResponse is what a stream generated before its client went away
+type PartialResponse struct {
+	ID      string           `json:"id"`     // trace ID of the request
+	Object  string           `json:"object"` // always "chat.completion.partial"
+	Created int64            `json:"created"`
+	Model   string           `json:"model,omitempty"`
+	Choices []map[string]any `json:"choices"`
+	// AbortedAt is when the client disconnected
+	AbortedAt int64 `json:"aborted_at"`
+}
+
+// PartialResponses keeps the partial responses of streams whose clients
+// disconnected, so that UIs can recover what was generated. A partial
+// response belongs to the key of its request.
+type PartialResponses struct {
+	Store StateStore
+	// Prefix namespaces the responses in the store, e.g. by router name
+	Prefix string
+	// TTL is how long responses are kept (default: 1 hour)
+	TTL time.Duration
+}
+
+// storedPartial is a partial response with the key it belongs to
+type storedPartial struct {
+	KeyID    string           `json:"key_id,omitempty"`
+	Response *PartialResponse `json:"response"`
+}
+
+// Save keeps the partial response of a trace for the key of its request
+func (p *PartialResponses) Save(keyID string, res *PartialResponse) error {
+	ttl := p.TTL
+	if ttl <= 0 {
+		ttl = defaultPartialTTL
+	}
+	res.Object = "chat.completion.partial"
+	return p.Store.Update([]string{p.Prefix + "partial:" + res.ID}, ttl, func([][]byte) ([][]byte, error) {
+		return marshalStored(storedPartial{KeyID: keyID, Response: res})
+	})
+}
+
+// Get returns the partial response of a trace. Responses saved for a key are
+// only returned to that key; others see ErrPartialNotFound.
+func (p *PartialResponses) Get(traceID, keyID string) (*PartialResponse, error) {
+	var stored *storedPartial
+	values, err := ReadState(p.Store, []string{p.Prefix + "partial:" + traceID})
+	if err == nil {
+		err = unmarshalStored(values[0], &stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.Response == nil || (stored.KeyID != "" && stored.KeyID != keyID) {
+		return nil, ErrPartialNotFound
+	}
+	return stored.Response, nil
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestPartialResponses_SaveGet(t *testing.T) {
+	partials := &PartialResponses{Store: NewMemoryStateStore(), Prefix: "default:"}
+	accum := NewStreamAccumulator()
+	for _, chunk := range []string{
+		`{"model": "gpt-4o", "choices": [{"index": 0, "delta": {"role": "assistant", "content": "Once upon"}}]}`,
+		`{"model": "gpt-4o", "choices": [{"index": 0, "delta": {"content": " a time"}}]}`,
+	} {
+		parsed, _ := styles.ParsePartialJSON([]byte(chunk))
+		accum.Accumulate(parsed)
+	}
+	err := partials.Save("acme:1", &PartialResponse{ID: "trace-1", Model: accum.Model(), Choices: accum.Choices()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := partials.Get("trace-1", "acme:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, _ := res.Choices[0]["message"].(map[string]any)
+	if res.Object != "chat.completion.partial" || res.Model != "gpt-4o" || message["content"] != "Once upon a time" {
+		t.Errorf("Get = %+v", res)
+	}
+	if _, err := partials.Get("trace-1", "globex:1"); !errors.Is(err, ErrPartialNotFound) {
+		t.Errorf("expected another key not to see the response, got %v", err)
+	}
+	if _, err := partials.Get("trace-2", "acme:1"); !errors.Is(err, ErrPartialNotFound) {
+		t.Errorf("expected an unknown trace to be not found, got %v", err)
+	}
+}
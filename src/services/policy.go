@@ -0,0 +1,463 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Tool policy actions
+const (
+	PolicyActionStrip  = "strip"
+	PolicyActionReject = "reject"
+)
+
+// Policy holds the router's request policy rules. Every rule whose scope
+// matches a request applies, in order.
+type Policy struct {
+	Rules []*PolicyRule `json:"rules,omitempty"`
+}
+
+// PolicyRule restricts requests for the keys, models and clients it is
+// scoped to.
+type PolicyRule struct {
+	// Keys limits the rule to these key IDs as set by the auth manager (default: all keys)
+	Keys []string `json:"keys,omitempty"`
+	// Models limits the rule to models matching these glob patterns, e.g. "openai/*" (default: all models)
+	Models []string `json:"models,omitempty"`
+	// IPs limits the rule to clients in these addresses or CIDR ranges (default: all clients)
+	IPs []string `json:"ips,omitempty"`
+	// Countries limits the rule to clients in these ISO 3166-1 alpha-2
+	// countries, as found by the router's GeoIP lookup (default: all clients)
+	Countries []string `json:"countries,omitempty"`
+
+	// Deny rejects the requests the rule applies to
+	Deny bool `json:"deny,omitempty"`
+	// Providers restricts requests to these providers, e.g. those keeping
+	// data in a region (default: all)
+	Providers []string `json:"providers,omitempty"`
+	// RateLimit limits the requests of each client address the rule applies to
+	RateLimit *BucketLimit `json:"rate_limit,omitempty"`
+	// Residency requires providers in one of these regions (see InRegion)
+	Residency []string `json:"residency,omitempty"`
+
+	// AllowTools lists the tool names or types a request may declare (default: all)
+	AllowTools []string `json:"allow_tools,omitempty"`
+	// DenyTools lists tool names or types a request may not declare; glob patterns are accepted
+	DenyTools []string `json:"deny_tools,omitempty"`
+	// DenyComputerUse disallows computer use tools of every dialect
+	DenyComputerUse bool `json:"deny_computer_use,omitempty"`
+	// ToolAction is what happens to violating tools: "strip" (default) or "reject"
+	ToolAction string `json:"tool_action,omitempty"`
+
+	// MaxOutputTokensLimit caps the output tokens of a request (0: no cap)
+	MaxOutputTokensLimit int `json:"max_output_tokens_limit,omitempty"`
+
+	// StreamTokensPerSecond paces streamed output to this rate (0: unpaced)
+	StreamTokensPerSecond float64 `json:"stream_tokens_per_second,omitempty"`
+
+	// Safety is the content safety level passed on to providers in their own
+	// terms: off, relaxed, standard or strict (default: none)
+	Safety string `json:"safety,omitempty"`
+
+	// bucket names the rate limit bucket of the client the rule was
+	// resolved for (see Policy.ForClient)
+	bucket string
+}
+
+// PolicyClient is the network origin of a request
+type PolicyClient struct {
+	IP netip.Addr
+	// Country is an ISO 3166-1 alpha-2 code, "" when unknown
+	Country string
+}
+
+// outputTokenFields are the request fields that limit output tokens
+var outputTokenFields = []string{"max_tokens", "max_completion_tokens", "max_output_tokens"}
+
+// PolicyError is returned when a request violates the policy and must be rejected
+type PolicyError struct {
+	Status  int
+	Message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// Unwrap marks policy errors with errs.ErrPolicy
+func (e *PolicyError) Unwrap() error {
+	return errs.ErrPolicy
+}
+
+// Validate checks the rules for invalid patterns and actions
+func (p *Policy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for i, rule := range p.Rules {
+		if rule.MaxOutputTokensLimit < 0 {
+			return fmt.Errorf("policy rule %d: max_output_tokens_limit must not be negative", i+1)
+		}
+		if rule.StreamTokensPerSecond < 0 {
+			return fmt.Errorf("policy rule %d: stream_tokens_per_second must not be negative", i+1)
+		}
+		if rule.Safety != "" && !ValidSafetyLevel(rule.Safety) {
+			return fmt.Errorf("policy rule %d: unknown safety level '%s' (supported: off, relaxed, standard, strict)", i+1, rule.Safety)
+		}
+		switch rule.ToolAction {
+		case "", PolicyActionStrip, PolicyActionReject:
+		default:
+			return fmt.Errorf("policy rule %d: unknown tool_action '%s' (supported: strip, reject)", i+1, rule.ToolAction)
+		}
+		for _, pattern := range append(append(append([]string{}, rule.Models...), rule.AllowTools...), rule.DenyTools...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("policy rule %d: invalid pattern '%s'", i+1, pattern)
+			}
+		}
+		for _, ip := range rule.IPs {
+			if _, err := parseIPPrefix(ip); err != nil {
+				return fmt.Errorf("policy rule %d: invalid address or CIDR range '%s'", i+1, ip)
+			}
+		}
+		for _, country := range rule.Countries {
+			if len(country) != 2 {
+				return fmt.Errorf("policy rule %d: invalid country '%s', expected an ISO 3166-1 alpha-2 code", i+1, country)
+			}
+		}
+		for _, region := range rule.Residency {
+			if err := ValidateResidencyRegion(region); err != nil {
+				return fmt.Errorf("policy rule %d: %v", i+1, err)
+			}
+		}
+		if l := rule.RateLimit; l != nil && (l.Rate <= 0 || l.Burst < 0 || l.Reserve != 0) {
+			return fmt.Errorf("policy rule %d: rate_limit needs a positive rate and takes no reserve", i+1)
+		}
+	}
+	return nil
+}
+
+// HasClientRateLimits reports rules limiting the rate of clients
+func (p *Policy) HasClientRateLimits() bool {
+	return p != nil && slices.ContainsFunc(p.Rules, func(rule *PolicyRule) bool { return rule.RateLimit != nil })
+}
+
+// parseIPPrefix parses a CIDR range or a single address
+func parseIPPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// clientScoped reports whether the rule is scoped to client addresses or
+// countries, or limits the rate of each client
+func (rule *PolicyRule) clientScoped() bool {
+	return len(rule.IPs) > 0 || len(rule.Countries) > 0 || rule.RateLimit != nil
+}
+
+// matchesClient reports whether the client is in the rule's addresses and
+// countries
+func (rule *PolicyRule) matchesClient(client PolicyClient) bool {
+	if len(rule.IPs) > 0 && !slices.ContainsFunc(rule.IPs, func(ip string) bool {
+		prefix, err := parseIPPrefix(ip)
+		return err == nil && prefix.Contains(client.IP.Unmap())
+	}) {
+		return false
+	}
+	if len(rule.Countries) > 0 && !slices.ContainsFunc(rule.Countries, func(country string) bool {
+		return strings.EqualFold(country, client.Country)
+	}) {
+		return false
+	}
+	return true
+}
+
+// ForClient returns the policy as it applies to a client: rules scoped to
+// other addresses or countries are left out and the client scope of the
+// others is resolved. Rules scoped to clients never apply before, so
+// handlers resolve the policy before evaluating it.
+func (p *Policy) ForClient(client PolicyClient) *Policy {
+	if p == nil || !slices.ContainsFunc(p.Rules, (*PolicyRule).clientScoped) {
+		return p
+	}
+	resolved := &Policy{Rules: make([]*PolicyRule, 0, len(p.Rules))}
+	for i, rule := range p.Rules {
+		if !rule.clientScoped() {
+			resolved.Rules = append(resolved.Rules, rule)
+			continue
+		}
+		if !rule.matchesClient(client) {
+			continue
+		}
+		r := *rule
+		r.IPs, r.Countries = nil, nil
+		if r.RateLimit != nil {
+			r.bucket = fmt.Sprintf("policy:%d:%s", i+1, client.IP.Unmap())
+		}
+		resolved.Rules = append(resolved.Rules, &r)
+	}
+	return resolved
+}
+
+// matchesAny reports whether value matches one of the glob patterns
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo reports whether the rule is scoped to the key and model; rules
+// with an unresolved client scope apply to no request
+func (rule *PolicyRule) appliesTo(keyID, model string) bool {
+	if len(rule.IPs) > 0 || len(rule.Countries) > 0 {
+		return false
+	}
+	if len(rule.Keys) > 0 && !matchesAny(rule.Keys, keyID) {
+		return false
+	}
+	if len(rule.Models) > 0 {
+		_, bareModel, _ := strings.Cut(model, "/")
+		if !matchesAny(rule.Models, model) && !matchesAny(rule.Models, bareModel) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowsTool reports whether the rule permits a tool, matched by name or type
+// (so "function" covers every function tool)
+func (rule *PolicyRule) allowsTool(tool styles.ChatCompletionsTool) bool {
+	name := tool.Name()
+	if rule.DenyComputerUse && styles.IsComputerUseTool(tool.Type) {
+		return false
+	}
+	if matchesAny(rule.DenyTools, name) || matchesAny(rule.DenyTools, tool.Type) {
+		return false
+	}
+	return len(rule.AllowTools) == 0 || matchesAny(rule.AllowTools, name) || matchesAny(rule.AllowTools, tool.Type)
+}
+
+// requestModel returns the request model without its plugin suffix
+func requestModel(reqJson styles.PartialJSON) string {
+	model, _, _ := CutModelSuffix(styles.TryGetFromPartialJSON[string](reqJson, "model"))
+	return UnescapeModel(model)
+}
+
+// Apply enforces the policy on a Chat Completions request for the given key ID,
+// modifying it in place. A *PolicyError is returned when the request is rejected.
+func (p *Policy) Apply(keyID string, reqJson styles.PartialJSON) error {
+	if p == nil || len(p.Rules) == 0 {
+		return nil
+	}
+
+	if err := p.Deny(keyID, reqJson); err != nil {
+		return err
+	}
+	model := requestModel(reqJson)
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(keyID, model) {
+			continue
+		}
+		if err := rule.applyTools(reqJson); err != nil {
+			return err
+		}
+	}
+
+	if limit := p.OutputTokenLimit(keyID, reqJson); limit > 0 {
+		return clampOutputTokens(reqJson, limit)
+	}
+	return nil
+}
+
+// Deny returns a PolicyError when a deny rule applies to the request. It is
+// the part of Apply for endpoints whose requests have no tools or output
+// limits, such as embeddings.
+func (p *Policy) Deny(keyID string, reqJson styles.PartialJSON) error {
+	if p == nil {
+		return nil
+	}
+	model := requestModel(reqJson)
+	for _, rule := range p.Rules {
+		if rule.Deny && rule.appliesTo(keyID, model) {
+			return &PolicyError{Status: http.StatusForbidden, Message: "request denied by policy"}
+		}
+	}
+	return nil
+}
+
+// OutputTokenLimit returns the lowest max_output_tokens_limit of the rules
+// applying to the request, or 0 when output is not capped.
+func (p *Policy) OutputTokenLimit(keyID string, reqJson styles.PartialJSON) int {
+	if p == nil {
+		return 0
+	}
+	model := requestModel(reqJson)
+	limit := 0
+	for _, rule := range p.Rules {
+		if rule.MaxOutputTokensLimit > 0 && rule.appliesTo(keyID, model) {
+			if limit == 0 || rule.MaxOutputTokensLimit < limit {
+				limit = rule.MaxOutputTokensLimit
+			}
+		}
+	}
+	return limit
+}
+
+// StreamRate returns the lowest stream_tokens_per_second of the rules applying
+// to the request, or 0 when streams are not paced.
+func (p *Policy) StreamRate(keyID string, reqJson styles.PartialJSON) float64 {
+	if p == nil {
+		return 0
+	}
+	model := requestModel(reqJson)
+	rate := 0.0
+	for _, rule := range p.Rules {
+		if rule.StreamTokensPerSecond > 0 && rule.appliesTo(keyID, model) {
+			if rate == 0 || rule.StreamTokensPerSecond < rate {
+				rate = rule.StreamTokensPerSecond
+			}
+		}
+	}
+	return rate
+}
+
+// AllowedProviders returns the providers the rules applying to the request
+// restrict it to, or nil when it may use any. Several rules narrow the
+// choice down to the providers they all allow.
+func (p *Policy) AllowedProviders(keyID string, reqJson styles.PartialJSON) []string {
+	if p == nil {
+		return nil
+	}
+	model := requestModel(reqJson)
+	var allowed []string
+	for _, rule := range p.Rules {
+		if len(rule.Providers) == 0 || !rule.appliesTo(keyID, model) {
+			continue
+		}
+		providers := make([]string, 0, len(rule.Providers))
+		for _, name := range rule.Providers {
+			name = strings.ToLower(name)
+			if allowed == nil || slices.Contains(allowed, name) {
+				providers = append(providers, name)
+			}
+		}
+		allowed = providers
+	}
+	return allowed
+}
+
+// Residency returns the residency requirements of the rules applying to the
+// request; providers must meet every one
+func (p *Policy) Residency(keyID string, reqJson styles.PartialJSON) [][]string {
+	if p == nil {
+		return nil
+	}
+	model := requestModel(reqJson)
+	var requirements [][]string
+	for _, rule := range p.Rules {
+		if len(rule.Residency) > 0 && rule.appliesTo(keyID, model) {
+			requirements = append(requirements, rule.Residency)
+		}
+	}
+	return requirements
+}
+
+// ClientRateLimits returns the per-client rate limits of the rules applying
+// to the request by bucket name; only a policy resolved for a client has any
+func (p *Policy) ClientRateLimits(keyID string, reqJson styles.PartialJSON) map[string]*BucketLimit {
+	if p == nil {
+		return nil
+	}
+	model := requestModel(reqJson)
+	var limits map[string]*BucketLimit
+	for _, rule := range p.Rules {
+		if rule.bucket == "" || !rule.appliesTo(keyID, model) {
+			continue
+		}
+		if limits == nil {
+			limits = make(map[string]*BucketLimit)
+		}
+		limits[rule.bucket] = rule.RateLimit
+	}
+	return limits
+}
+
+// clampOutputTokens lowers requested output limits above the cap, and sets
+// max_tokens when the client did not ask for a limit at all.
+func clampOutputTokens(reqJson styles.PartialJSON, limit int) error {
+	found := false
+	for _, field := range outputTokenFields {
+		if _, ok := reqJson[field]; !ok {
+			continue
+		}
+		found = true
+		if requested := styles.TryGetFromPartialJSON[int](reqJson, field); requested > 0 && requested <= limit {
+			continue
+		}
+		if err := reqJson.Set(field, limit); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return reqJson.Set("max_tokens", limit)
+	}
+	return nil
+}
+
+// applyTools strips or rejects tools the rule does not allow
+func (rule *PolicyRule) applyTools(reqJson styles.PartialJSON) error {
+	if len(rule.AllowTools) == 0 && len(rule.DenyTools) == 0 && !rule.DenyComputerUse {
+		return nil
+	}
+	raw, ok := reqJson["tools"]
+	if !ok {
+		return nil
+	}
+
+	var tools []json.RawMessage
+	if err := json.Unmarshal(raw, &tools); err != nil {
+		return &PolicyError{Status: http.StatusBadRequest, Message: "invalid tools"}
+	}
+
+	kept := make([]json.RawMessage, 0, len(tools))
+	for _, rawTool := range tools {
+		var tool styles.ChatCompletionsTool
+		if err := json.Unmarshal(rawTool, &tool); err != nil {
+			return &PolicyError{Status: http.StatusBadRequest, Message: "invalid tools"}
+		}
+		if rule.allowsTool(tool) {
+			kept = append(kept, rawTool)
+			continue
+		}
+		if rule.ToolAction == PolicyActionReject {
+			return &PolicyError{Status: http.StatusForbidden, Message: fmt.Sprintf("tool '%s' is not allowed by policy", tool.Name())}
+		}
+	}
+
+	if len(kept) == len(tools) {
+		return nil
+	}
+	if len(kept) == 0 {
+		delete(reqJson, "tools")
+		delete(reqJson, "tool_choice")
+		delete(reqJson, "parallel_tool_calls")
+		return nil
+	}
+	return reqJson.Set("tools", kept)
+}
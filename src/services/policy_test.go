@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+const policyTestRequest = `{
+	"model": "openai/gpt-4o+zip",
+	"tools": [
+		{"type": "function", "function": {"name": "get_weather"}},
+		{"type": "computer_use"}
+	],
+	"tool_choice": "auto"
+}`
+
+func TestPolicyStripsDeniedTools(t *testing.T) {
+	policy := &Policy{Rules: []*PolicyRule{{DenyTools: []string{"computer_*"}}}}
+	req, _ := styles.ParsePartialJSON([]byte(policyTestRequest))
+
+	if err := policy.Apply("", req); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	tools := styles.TryGetFromPartialJSON[[]styles.ChatCompletionsTool](req, "tools")
+	if len(tools) != 1 || tools[0].Name() != "get_weather" {
+		t.Errorf("tools = %+v, want only get_weather", tools)
+	}
+}
+
+func TestPolicyRejectsForScopedKey(t *testing.T) {
+	policy := &Policy{Rules: []*PolicyRule{{
+		Keys:       []string{"team-a"},
+		Models:     []string{"gpt-4*"},
+		AllowTools: []string{"function"},
+		ToolAction: PolicyActionReject,
+	}}}
+
+	req, _ := styles.ParsePartialJSON([]byte(policyTestRequest))
+	if err := policy.Apply("team-b", req); err != nil {
+		t.Errorf("rule should not apply to other keys: %v", err)
+	}
+
+	err := policy.Apply("team-a", req)
+	var perr *PolicyError
+	if !errors.As(err, &perr) || perr.Status != http.StatusForbidden {
+		t.Fatalf("expected forbidden policy error, got %v", err)
+	}
+}
+
+func TestPolicyRemovesToolChoiceWithLastTool(t *testing.T) {
+	policy := &Policy{Rules: []*PolicyRule{{AllowTools: []string{"web_search"}}}}
+	req, _ := styles.ParsePartialJSON([]byte(policyTestRequest))
+
+	if err := policy.Apply("", req); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if _, ok := req["tools"]; ok {
+		t.Error("tools should be removed")
+	}
+	if _, ok := req["tool_choice"]; ok {
+		t.Error("tool_choice should be removed with the last tool")
+	}
+}
+
+func TestPolicyClampsOutputTokens(t *testing.T) {
+	policy := &Policy{Rules: []*PolicyRule{
+		{MaxOutputTokensLimit: 1000},
+		{Models: []string{"gpt-4o"}, MaxOutputTokensLimit: 200},
+	}}
+
+	tests := []struct {
+		body  string
+		field string
+		want  int
+	}{
+		{`{"model": "openai/gpt-4o", "max_tokens": 5000}`, "max_tokens", 200},
+		{`{"model": "gpt-4.1", "max_completion_tokens": 300}`, "max_completion_tokens", 300},
+		{`{"model": "gpt-4.1"}`, "max_tokens", 1000},
+	}
+	for _, tt := range tests {
+		req, _ := styles.ParsePartialJSON([]byte(tt.body))
+		if err := policy.Apply("", req); err != nil {
+			t.Fatalf("Apply(%s): %v", tt.body, err)
+		}
+		if got := styles.TryGetFromPartialJSON[int](req, tt.field); got != tt.want {
+			t.Errorf("Apply(%s): %s = %d, want %d", tt.body, tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	if err := (&Policy{Rules: []*PolicyRule{{ToolAction: "drop"}}}).Validate(); err == nil {
+		t.Error("expected error for unknown tool_action")
+	}
+	if err := (&Policy{Rules: []*PolicyRule{{DenyTools: []string{"["}}}}).Validate(); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestPolicy_StreamRate(t *testing.T) {
+	p := &Policy{Rules: []*PolicyRule{
+		{StreamTokensPerSecond: 50},
+		{Keys: []string{"demo-*"}, StreamTokensPerSecond: 20},
+		{Models: []string{"local/*"}, StreamTokensPerSecond: 10},
+	}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	req := styles.PartialJSON{}
+	_ = req.Set("model", "openai/gpt-4.1+usage")
+	if got := p.StreamRate("team-a", req); got != 50 {
+		t.Errorf("StreamRate(team-a) = %v, want 50", got)
+	}
+	if got := p.StreamRate("demo-1", req); got != 20 {
+		t.Errorf("StreamRate(demo-1) = %v, want the lowest matching rate 20", got)
+	}
+	_ = req.Set("model", "local/llama")
+	if got := p.StreamRate("demo-1", req); got != 10 {
+		t.Errorf("StreamRate(demo-1, local) = %v, want 10", got)
+	}
+	if got := (*Policy)(nil).StreamRate("demo-1", req); got != 0 {
+		t.Errorf("nil policy StreamRate = %v, want 0", got)
+	}
+	if err := (&Policy{Rules: []*PolicyRule{{StreamTokensPerSecond: -1}}}).Validate(); err == nil {
+		t.Error("expected a negative rate to be rejected")
+	}
+}
+
+func TestPolicyDeniesComputerUse(t *testing.T) {
+	policy := &Policy{Rules: []*PolicyRule{{Keys: []string{"intern"}, DenyComputerUse: true, ToolAction: PolicyActionReject}}}
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "tools": [{"type": "computer_use_preview", "display_width": 1024}]}`))
+
+	if err := policy.Apply("admin", req); err != nil {
+		t.Errorf("Apply(admin) = %v, want other keys unaffected", err)
+	}
+	var policyErr *PolicyError
+	if err := policy.Apply("intern", req); !errors.As(err, &policyErr) || policyErr.Status != http.StatusForbidden {
+		t.Errorf("Apply(intern) = %v, want a 403 policy error", err)
+	}
+}
+
+func TestPolicyForClient(t *testing.T) {
+	policy := &Policy{Rules: []*PolicyRule{
+		{IPs: []string{"203.0.113.0/24"}, Deny: true},
+		{Countries: []string{"DE", "FR"}, Providers: []string{"eu", "local"}},
+		{Providers: []string{"EU", "us"}},
+		{RateLimit: &BucketLimit{Rate: 1}},
+	}}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	req, _ := styles.ParsePartialJSON([]byte(policyTestRequest))
+
+	// Client-scoped rules apply to no request before the policy is resolved
+	if err := policy.Apply("", req); err != nil {
+		t.Errorf("unresolved policy should not deny: %v", err)
+	}
+	blocked := policy.ForClient(PolicyClient{IP: netip.MustParseAddr("203.0.113.7")})
+	var perr *PolicyError
+	if err := blocked.Apply("", req); !errors.As(err, &perr) || perr.Status != http.StatusForbidden {
+		t.Errorf("expected the blocked range to be denied, got %v", err)
+	}
+
+	eu := policy.ForClient(PolicyClient{IP: netip.MustParseAddr("::ffff:198.51.100.1"), Country: "fr"})
+	if err := eu.Apply("", req); err != nil {
+		t.Errorf("Apply: %v", err)
+	}
+	if got := eu.AllowedProviders("", req); len(got) != 1 || got[0] != "eu" {
+		t.Errorf("AllowedProviders = %v, want [eu]", got)
+	}
+	limits := eu.ClientRateLimits("", req)
+	if len(limits) != 1 || limits["policy:4:198.51.100.1"] == nil {
+		t.Errorf("ClientRateLimits = %v, want the client's bucket of rule 4", limits)
+	}
+	if got := policy.ForClient(PolicyClient{Country: "US"}).AllowedProviders("", req); len(got) != 2 {
+		t.Errorf("AllowedProviders = %v, want [eu us]", got)
+	}
+}
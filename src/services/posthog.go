@@ -1,54 +1,179 @@
 package services
 
 import (
+	"fmt"
+	"maps"
 	"os"
+	"path"
+	"sync"
 
 	"github.com/posthog/posthog-go"
 )
 
-var posthogClient posthog.Client
+var (
+	posthogMu       sync.RWMutex
+	posthogClient   posthog.Client
+	posthogProjects = map[string]*posthogProject{}
+	posthogBatching EventBatching
+)
 
 // PosthogIncludeContent controls whether to include message content in observability events
 var PosthogIncludeContent = os.Getenv("POSTHOG_INCLUDE_CONTENT") == "true"
 
+// PosthogProject is an additional PostHog project events can be routed to,
+// e.g. one per tenant. Events go to the default project unless a project is
+// selected for the request.
+type PosthogProject struct {
+	// APIKey is the project API key (may be a secret reference)
+	APIKey string `json:"api_key"`
+	// BaseURL overrides the PostHog endpoint
+	BaseURL string `json:"base_url,omitempty"`
+	// Keys lists the key IDs (glob patterns) whose events go to this project
+	Keys []string `json:"keys,omitempty"`
+}
+
+type posthogProject struct {
+	client posthog.Client
+	keys   []string
+}
+
 // TryInstrumentAppObservability initializes PostHog if configured
 func TryInstrumentAppObservability() bool {
 	key := os.Getenv("POSTHOG_API_KEY")
 	if key == "" {
 		return false
 	}
+	return ConfigureObservability(key, os.Getenv("POSTHOG_BASE_URL")) == nil
+}
+
+// SetPosthogBatching sets the batching of PostHog clients configured
+// afterwards; zero values keep the client defaults (250 events, 5s)
+func SetPosthogBatching(batching EventBatching) {
+	posthogMu.Lock()
+	posthogBatching = batching
+	posthogMu.Unlock()
+}
 
-	baseURL := os.Getenv("POSTHOG_BASE_URL")
+func newPosthogClient(key, baseURL string) (posthog.Client, error) {
 	if baseURL == "" {
 		baseURL = "https://app.posthog.com"
 	}
 
-	client, err := posthog.NewWithConfig(key, posthog.Config{Endpoint: baseURL})
+	posthogMu.RLock()
+	batching := posthogBatching
+	posthogMu.RUnlock()
+
+	return posthog.NewWithConfig(key, posthog.Config{
+		Endpoint:  baseURL,
+		BatchSize: batching.BatchSize,
+		Interval:  batching.FlushInterval,
+	})
+}
+
+// ConfigureObservability (re)initializes the PostHog client, replacing any
+// client configured from environment variables
+func ConfigureObservability(key, baseURL string) error {
+	client, err := newPosthogClient(key, baseURL)
 	if err != nil {
-		return false
+		return err
 	}
 
+	posthogMu.Lock()
+	previous := posthogClient
 	posthogClient = client
-	return true
+	posthogMu.Unlock()
+
+	if previous != nil {
+		_ = previous.Close()
+	}
+	return nil
 }
 
-// FireObservabilityEvent sends an event to PostHog
-func FireObservabilityEvent(userId, url, eventName string, properties map[string]any) error {
-	if posthogClient == nil {
-		return nil
+// ConfigurePosthogProject (re)initializes a named PostHog project
+func ConfigurePosthogProject(name string, project PosthogProject) error {
+	for _, pattern := range project.Keys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("posthog project %s: invalid key pattern '%s'", name, pattern)
+		}
+	}
+	client, err := newPosthogClient(project.APIKey, project.BaseURL)
+	if err != nil {
+		return fmt.Errorf("posthog project %s: %w", name, err)
 	}
 
-	if userId == "" {
-		userId = "anonymous"
+	posthogMu.Lock()
+	previous := posthogProjects[name]
+	posthogProjects[name] = &posthogProject{client: client, keys: project.Keys}
+	posthogMu.Unlock()
+
+	if previous != nil {
+		_ = previous.client.Close()
 	}
+	return nil
+}
+
+// HasPosthogProject reports whether a named PostHog project is configured
+func HasPosthogProject(name string) bool {
+	posthogMu.RLock()
+	defer posthogMu.RUnlock()
+	_, ok := posthogProjects[name]
+	return ok
+}
 
-	if url != "" {
-		properties["$current_url"] = url
+// PosthogProjectForKey returns the project whose key patterns match a key ID.
+// When several match, the alphabetically first project wins.
+func PosthogProjectForKey(keyID string) (string, bool) {
+	if keyID == "" {
+		return "", false
 	}
+	posthogMu.RLock()
+	defer posthogMu.RUnlock()
+
+	match := ""
+	for name, project := range posthogProjects {
+		for _, pattern := range project.keys {
+			if ok, _ := path.Match(pattern, keyID); ok && (match == "" || name < match) {
+				match = name
+			}
+		}
+	}
+	return match, match != ""
+}
+
+// PosthogSink delivers events to PostHog: to the project named by the event,
+// falling back to the default project when the name is empty or unknown
+type PosthogSink struct{}
 
-	return posthogClient.Enqueue(posthog.Capture{
-		DistinctId: userId,
-		Event:      eventName,
+func (PosthogSink) Send(event ObservabilityEvent) error {
+	posthogMu.RLock()
+	client := posthogClient
+	if p, ok := posthogProjects[event.Project]; ok {
+		client = p.client
+	}
+	posthogMu.RUnlock()
+
+	if client == nil {
+		return nil
+	}
+
+	properties := event.Properties
+	if event.URL != "" {
+		// Other sinks share the properties map
+		properties = maps.Clone(event.Properties)
+		if properties == nil {
+			properties = map[string]any{}
+		}
+		properties["$current_url"] = event.URL
+	}
+
+	return client.Enqueue(posthog.Capture{
+		DistinctId: event.DistinctID,
+		Event:      event.Name,
+		Timestamp:  event.Time,
 		Properties: properties,
 	})
 }
+
+// Close is a no-op: PostHog clients are shared by all routers and closed when
+// they are reconfigured
+func (PosthogSink) Close() error { return nil }
@@ -0,0 +1,50 @@
+package services
+
+import "testing"
+
+func TestPosthogProjectForKey(t *testing.T) {
+	for name, keys := range map[string][]string{
+		"team-a":  {"team-a:*"},
+		"team-ab": {"team-a:*", "team-b:*"},
+		"admins":  {"admin"},
+	} {
+		if err := ConfigurePosthogProject(name, PosthogProject{APIKey: "phc_test", BaseURL: "http://127.0.0.1:1", Keys: keys}); err != nil {
+			t.Fatalf("configure %s: %v", name, err)
+		}
+	}
+	t.Cleanup(func() {
+		posthogMu.Lock()
+		defer posthogMu.Unlock()
+		for name, p := range posthogProjects {
+			_ = p.client.Close()
+			delete(posthogProjects, name)
+		}
+	})
+
+	tests := []struct {
+		keyID string
+		want  string
+	}{
+		{"team-a:alice", "team-a"}, // both match: alphabetically first
+		{"team-b:bob", "team-ab"},
+		{"admin", "admins"},
+		{"other", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, ok := PosthogProjectForKey(tt.keyID)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("PosthogProjectForKey(%q) = %q, %v; want %q", tt.keyID, got, ok, tt.want)
+		}
+	}
+
+	if !HasPosthogProject("admins") || HasPosthogProject("missing") {
+		t.Error("HasPosthogProject mismatch")
+	}
+	if err := ConfigurePosthogProject("bad", PosthogProject{APIKey: "phc_test", Keys: []string{"["}}); err == nil {
+		t.Error("expected an invalid key pattern to be rejected")
+	}
+	if err := (PosthogSink{}).Send(ObservabilityEvent{Name: "test", Project: "missing"}); err != nil {
+		t.Errorf("unknown project should fall back to the default project: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"input"`
+	OutputPerMillion float64 `json:"output"`
+	// CachedInputPerMillion prices prompt tokens read from the provider's
+	// cache; when unset they cost as much as other input tokens
+	CachedInputPerMillion float64 `json:"cached_input,omitempty"`
+}
+
+// Cost computes the input and output cost in USD for the given token counts
+func (p ModelPrice) Cost(inputTokens, outputTokens int) (inputCost, outputCost float64) {
+	return float64(inputTokens) * p.InputPerMillion / 1e6, float64(outputTokens) * p.OutputPerMillion / 1e6
+}
+
+// UsageCost computes the input and output cost in USD of a response's usage,
+// pricing cached prompt tokens at the cached input price when one is set
+func (p ModelPrice) UsageCost(usage styles.ChatCompletionsUsage) (inputCost, outputCost float64) {
+	inputCost, outputCost = p.Cost(usage.PromptTokens, usage.CompletionTokens)
+	if d := usage.PromptTokensDetails; d != nil && p.CachedInputPerMillion > 0 {
+		inputCost -= float64(d.CachedTokens) * (p.InputPerMillion - p.CachedInputPerMillion) / 1e6
+	}
+	return inputCost, outputCost
+}
+
+var (
+	pricingMu sync.RWMutex
+	pricing   = map[string]ModelPrice{}
+)
+
+// LoadPricingFile loads model prices from a JSON file of the form
+// {"gpt-4o": {"input": 2.5, "output": 10}, "openai/gpt-4o-mini": {...}}
+func LoadPricingFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading pricing file: %w", err)
+	}
+
+	var prices map[string]ModelPrice
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return fmt.Errorf("parsing pricing file %s: %w", path, err)
+	}
+
+	normalized := make(map[string]ModelPrice, len(prices))
+	for model, price := range prices {
+		normalized[strings.ToLower(model)] = price
+	}
+
+	pricingMu.Lock()
+	pricing = normalized
+	pricingMu.Unlock()
+	return nil
+}
+
+// LookupModelPrice finds the price of a model, preferring a provider-qualified
+// entry ("provider/model") over the bare model name
+func LookupModelPrice(provider, model string) (ModelPrice, bool) {
+	pricingMu.RLock()
+	defer pricingMu.RUnlock()
+
+	model = strings.ToLower(model)
+	if provider != "" {
+		if p, ok := pricing[strings.ToLower(provider)+"/"+model]; ok {
+			return p, true
+		}
+	}
+	p, ok := pricing[model]
+	return p, ok
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Prompt is one version of a prompt stored in the prompt library
+type Prompt struct {
+	ID          string            `json:"id"`
+	Object      string            `json:"object"` // always "prompt"
+	Version     int               `json:"version"`
+	Description string            `json:"description,omitempty"`
+	Messages    []json.RawMessage `json:"messages"`
+	// Variables lists the {{name}} placeholders of the messages, which
+	// requests using the prompt must fill
+	Variables []string `json:"variables,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+// ErrPromptNotFound is returned for prompt IDs or versions the library doesn't hold
+var ErrPromptNotFound = errors.New("prompt not found")
+
+// promptTTL keeps prompts in the state store, whose entries all expire,
+// for as long as the store itself lives
+const promptTTL = 100 * 365 * 24 * time.Hour
+
+// promptIDPattern restricts prompt IDs to characters safe in URL paths and store keys
+var promptIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// promptVariablePattern matches a {{name}} placeholder
+var promptVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// PromptLibrary stores versioned prompts in a state store, so instances
+// sharing a store share the library. Saving a prompt under an existing ID
+// adds a version; earlier versions stay available until the prompt is deleted.
+type PromptLibrary struct {
+	Store  StateStore
+	Prefix string // Prepended to the library's store keys
+}
+
+// Save stores messages as a new version of the prompt with the given ID, or
+// as version 1 of a new prompt with a generated ID when id is empty
+func (l *PromptLibrary) Save(id, description string, messages []json.RawMessage) (*Prompt, error) {
+	if id == "" {
+		id = "prompt_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:24]
+	}
+	if !promptIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid prompt id '%s'", id)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("prompt %s: messages are required", id)
+	}
+	variables, err := promptVariables(messages)
+	if err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", id, err)
+	}
+
+	prompt := &Prompt{
+		ID:          id,
+		Object:      "prompt",
+		Description: description,
+		Messages:    messages,
+		Variables:   variables,
+		CreatedAt:   time.Now().Unix(),
+	}
+	err = l.Store.Update([]string{l.Prefix + "index", l.promptKey(id)}, promptTTL, func(values [][]byte) ([][]byte, error) {
+		var index []string
+		var versions []*Prompt
+		if err := unmarshalStored(values[0], &index); err != nil {
+			return nil, err
+		}
+		if err := unmarshalStored(values[1], &versions); err != nil {
+			return nil, err
+		}
+		if len(versions) > 0 {
+			prompt.Version = versions[len(versions)-1].Version + 1
+		} else {
+			prompt.Version = 1
+			index = append(index, id)
+		}
+		return marshalStored(index, append(versions, prompt))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prompt, nil
+}
+
+// Get returns a version of a prompt, the latest one when version is 0
+func (l *PromptLibrary) Get(id string, version int) (*Prompt, error) {
+	versions, err := l.Versions(id)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, p := range versions {
+		if p.Version == version {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("prompt %s version %d: %w", id, version, ErrPromptNotFound)
+}
+
+// Versions returns every version of a prompt, oldest first
+func (l *PromptLibrary) Versions(id string) ([]*Prompt, error) {
+	var versions []*Prompt
+	values, err := ReadState(l.Store, []string{l.promptKey(id)})
+	if err == nil {
+		err = unmarshalStored(values[0], &versions)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("prompt %s: %w", id, ErrPromptNotFound)
+	}
+	return versions, nil
+}
+
+// List returns the latest version of every prompt, in creation order
+func (l *PromptLibrary) List() ([]*Prompt, error) {
+	var index []string
+	values, err := ReadState(l.Store, []string{l.Prefix + "index"})
+	if err == nil {
+		err = unmarshalStored(values[0], &index)
+	}
+	if err != nil {
+		return nil, err
+	}
+	prompts := make([]*Prompt, 0, len(index))
+	for _, id := range index {
+		p, err := l.Get(id, 0)
+		if errors.Is(err, ErrPromptNotFound) {
+			continue // deleted between reading the index and the prompt
+		}
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, nil
+}
+
+// Delete removes a prompt with all its versions
+func (l *PromptLibrary) Delete(id string) error {
+	found := false
+	err := l.Store.Update([]string{l.Prefix + "index", l.promptKey(id)}, promptTTL, func(values [][]byte) ([][]byte, error) {
+		var index []string
+		if err := unmarshalStored(values[0], &index); err != nil {
+			return nil, err
+		}
+		i := slices.Index(index, id)
+		if i < 0 {
+			return nil, nil
+		}
+		found = true
+		// State stores can't remove keys; an empty version list reads as deleted
+		return marshalStored(slices.Delete(index, i, i+1), []*Prompt{})
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("prompt %s: %w", id, ErrPromptNotFound)
+	}
+	return nil
+}
+
+// promptKey is the store key of a prompt's versions
+func (l *PromptLibrary) promptKey(id string) string {
+	return l.Prefix + "prompt:" + id
+}
+
+// promptReference is how a request names a stored prompt in its extras
+type promptReference struct {
+	ID        string            `json:"prompt_id"`
+	Version   int               `json:"prompt_version"`
+	Variables map[string]string `json:"prompt_variables"`
+}
+
+// promptExtras are the extras fields consumed by Materialize
+var promptExtras = []string{"prompt_id", "prompt_version", "prompt_variables"}
+
+// Materialize replaces a prompt reference in a request's extras
+// (prompt_id, optionally prompt_version and prompt_variables) with the
+// stored prompt's messages, its variables filled in, placed before the
+// request's own messages. Requests without a reference are returned as is.
+func (l *PromptLibrary) Materialize(reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	if l == nil {
+		return reqJson, nil
+	}
+	raw, ok := reqJson["extras"]
+	if !ok {
+		return reqJson, nil
+	}
+	var extras map[string]json.RawMessage
+	if json.Unmarshal(raw, &extras) != nil || extras["prompt_id"] == nil {
+		return reqJson, nil
+	}
+	var ref promptReference
+	if err := json.Unmarshal(raw, &ref); err != nil {
+		return nil, errs.Errorf(errs.ErrInvalidRequest, "invalid prompt reference: %w", err)
+	}
+
+	prompt, err := l.Get(ref.ID, ref.Version)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrInvalidRequest, err)
+	}
+	messages := make([]json.RawMessage, 0, len(prompt.Messages))
+	for _, m := range prompt.Messages {
+		filled, err := fillPromptVariables(m, ref.Variables)
+		if err != nil {
+			return nil, errs.Errorf(errs.ErrInvalidRequest, "prompt %s version %d: %w", prompt.ID, prompt.Version, err)
+		}
+		messages = append(messages, filled)
+	}
+	var own []json.RawMessage
+	if raw, ok := reqJson["messages"]; ok {
+		if err := json.Unmarshal(raw, &own); err != nil {
+			return nil, errs.Errorf(errs.ErrInvalidRequest, "invalid messages: %w", err)
+		}
+	}
+
+	res := reqJson.Clone()
+	if err := res.Set("messages", append(messages, own...)); err != nil {
+		return nil, err
+	}
+	for _, key := range promptExtras {
+		delete(extras, key)
+	}
+	if len(extras) == 0 {
+		delete(res, "extras")
+	} else if err := res.Set("extras", extras); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// promptVariables lists the distinct placeholders of the messages' content
+func promptVariables(messages []json.RawMessage) ([]string, error) {
+	var variables []string
+	for _, m := range messages {
+		var message map[string]any
+		if err := json.Unmarshal(m, &message); err != nil {
+			return nil, fmt.Errorf("invalid message: %w", err)
+		}
+		walkPromptText(message["content"], func(text string) string {
+			for _, match := range promptVariablePattern.FindAllStringSubmatch(text, -1) {
+				if !slices.Contains(variables, match[1]) {
+					variables = append(variables, match[1])
+				}
+			}
+			return text
+		})
+	}
+	return variables, nil
+}
+
+// fillPromptVariables replaces the placeholders of a message's content,
+// failing on variables without a value
+func fillPromptVariables(raw json.RawMessage, values map[string]string) (json.RawMessage, error) {
+	if !promptVariablePattern.Match(raw) {
+		return raw, nil
+	}
+	var message map[string]any
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return nil, err
+	}
+	var missing error
+	message["content"] = walkPromptText(message["content"], func(text string) string {
+		return promptVariablePattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+			name := promptVariablePattern.FindStringSubmatch(placeholder)[1]
+			value, ok := values[name]
+			if !ok && missing == nil {
+				missing = fmt.Errorf("missing prompt variable '%s'", name)
+			}
+			return value
+		})
+	})
+	if missing != nil {
+		return nil, missing
+	}
+	return json.Marshal(message)
+}
+
+// walkPromptText rewrites the text of a message content: a string or the
+// text of its content parts
+func walkPromptText(content any, fn func(string) string) any {
+	switch c := content.(type) {
+	case string:
+		return fn(c)
+	case []any:
+		for _, part := range c {
+			if p, ok := part.(map[string]any); ok {
+				if text, ok := p["text"].(string); ok {
+					p["text"] = fn(text)
+				}
+			}
+		}
+	}
+	return content
+}
+
+// unmarshalStored decodes a state store value, leaving v unchanged for missing values
+func unmarshalStored(value []byte, v any) error {
+	if len(value) == 0 {
+		return nil
+	}
+	return json.Unmarshal(value, v)
+}
+
+// marshalStored encodes values for a state store update
+func marshalStored(values ...any) ([][]byte, error) {
+	res := make([][]byte, len(values))
+	for i, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = data
+	}
+	return res, nil
+}
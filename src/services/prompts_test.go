@@ -0,0 +1,65 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestPromptLibrary(t *testing.T) {
+	library := &PromptLibrary{Store: NewMemoryStateStore(), Prefix: "test:"}
+	v1, err := library.Save("greeter", "", []json.RawMessage{json.RawMessage(`{"role": "system", "content": "Greet {{ name }} briefly."}`)})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if v1.Version != 1 || !slices.Equal(v1.Variables, []string{"name"}) {
+		t.Errorf("v1 = %+v, want version 1 with variable name", v1)
+	}
+	v2, _ := library.Save("greeter", "formal", []json.RawMessage{json.RawMessage(`{"role": "system", "content": [{"type": "text", "text": "Greet {{name}} in {{language}}."}]}`)})
+	if v2.Version != 2 {
+		t.Errorf("v2.Version = %d", v2.Version)
+	}
+	if _, err := library.Save("../etc", "", v1.Messages); err == nil {
+		t.Error("expected an invalid id to be rejected")
+	}
+
+	req, _ := styles.ParsePartialJSON([]byte(`{
+		"model": "m",
+		"messages": [{"role": "user", "content": "Hi"}],
+		"extras": {"prompt_id": "greeter", "prompt_version": 1, "prompt_variables": {"name": "Ada"}, "trace": "t1"}
+	}`))
+	out, err := library.Materialize(req)
+	if err != nil {
+		t.Fatalf("Materialize: %v", err)
+	}
+	messages := styles.TryGetFromPartialJSON[[]styles.ChatCompletionsMessage](out, "messages")
+	if len(messages) != 2 || messages[0].Content != "Greet Ada briefly." || messages[1].Role != "user" {
+		t.Errorf("messages = %+v, want the filled prompt before the request's messages", messages)
+	}
+	if extras := styles.TryGetFromPartialJSON[map[string]any](out, "extras"); len(extras) != 1 || extras["trace"] != "t1" {
+		t.Errorf("extras = %v, want only the unrelated field", extras)
+	}
+
+	// The latest version needs a variable the request doesn't fill
+	req, _ = styles.ParsePartialJSON([]byte(`{"model": "m", "extras": {"prompt_id": "greeter", "prompt_variables": {"name": "Ada"}}}`))
+	if _, err := library.Materialize(req); !errors.Is(err, errs.ErrInvalidRequest) {
+		t.Errorf("Materialize = %v, want an invalid request error", err)
+	}
+
+	if prompts, _ := library.List(); len(prompts) != 1 || prompts[0].Version != 2 {
+		t.Errorf("List = %+v, want the latest version of greeter", prompts)
+	}
+	if err := library.Delete("greeter"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := library.Get("greeter", 1); !errors.Is(err, ErrPromptNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrPromptNotFound", err)
+	}
+	if prompts, _ := library.List(); len(prompts) != 0 {
+		t.Errorf("List after Delete = %+v", prompts)
+	}
+}
@@ -1,8 +1,14 @@
 package services
 
 import (
+	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
+	"sync/atomic"
 
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
 	"github.com/neutrome-labs/open-ai-router/src/styles"
 )
 
@@ -13,4 +19,172 @@ type ProviderService struct {
 	Style     styles.Style
 	Router    *RouterService
 	Commands  map[string]any
+	// APIKey is the provider's static credential, used when the auth manager provides none
+	APIKey string
+	// RequestHeaders are added to every upstream request, e.g. beta feature flags
+	RequestHeaders []HeaderTemplate
+	// ResponseHeaders are added to the responses the provider serves
+	ResponseHeaders []HeaderTemplate
+	// Paths overrides the endpoint path of a command ("inference",
+	// "list_models", "embeddings") for servers that don't use the standard OpenAI paths
+	Paths map[string]string
+	// NativeThinking marks providers taking Anthropic extended thinking
+	// settings; others get them mapped to reasoning_effort
+	NativeThinking bool
+	// Query holds query parameters added to every upstream URL, e.g. api-version
+	Query url.Values
+	// ForwardQuery names the client query parameters passed on to the upstream
+	ForwardQuery []string
+	// Quirks rewrite requests for upstreams deviating from the OpenAI API
+	Quirks *ProviderQuirks
+	// SafetyDialect is how the provider is told a request's safety level
+	// (see SafetyDialectSystem and the others; default: system)
+	SafetyDialect string
+	// Capabilities records what the provider's models support
+	Capabilities Capabilities
+	// Regions are where the provider processes data, for requests with
+	// residency requirements; untagged providers meet none
+	Regions []string
+	// Normalize tunes the removal of fields strict providers reject; nil
+	// applies the defaults
+	Normalize *RequestNormalization
+	// Endpoints limits the upstream endpoints the provider is called on; nil
+	// allows every endpoint
+	Endpoints *EndpointPolicy
+	// ModelRewriter rewrites the model as drivers dispatch requests; nil
+	// sends models as routed
+	ModelRewriter ModelRewriter
+	// Timeouts bounds the provider's upstream calls; nil applies the default
+	// upstream timeout only
+	Timeouts *ProviderTimeouts
+
+	inFlight   atomic.Int64
+	rateLimits rateLimits
+}
+
+// BeginRequest marks a request as in flight; call the returned func when it completes.
+func (p *ProviderService) BeginRequest() (done func()) {
+	p.inFlight.Add(1)
+	return func() { p.inFlight.Add(-1) }
+}
+
+// InFlight returns the number of requests currently being served by the provider
+func (p *ProviderService) InFlight() int64 {
+	return p.inFlight.Load()
+}
+
+// CollectTargetAuth resolves the credential for an outgoing provider request,
+// falling back to the provider's static APIKey when the auth manager has none.
+func (p *ProviderService) CollectTargetAuth(scope string, rIn, rOut *http.Request) (string, error) {
+	var authVal string
+	if p.Router != nil && p.Router.Auth != nil {
+		v, err := p.Router.Auth.CollectTargetAuth(scope, p, rIn, rOut)
+		if err != nil {
+			return "", err
+		}
+		authVal = v
+	}
+	if authVal == "" {
+		authVal = p.APIKey
+	}
+	return authVal, nil
+}
+
+// EndpointURL returns the upstream URL of a command: the base URL joined with
+// the command's path override, or with defaultPath when none is configured.
+// An override may carry a query string, or be an absolute URL replacing the
+// base URL altogether. Endpoints the provider's policy blocks fail with
+// errs.ErrCapability, so the next provider is tried.
+func (p *ProviderService) EndpointURL(command, defaultPath string) (url.URL, error) {
+	if !p.Endpoints.Allows(defaultPath) {
+		return url.URL{}, errs.Errorf(errs.ErrCapability, "provider %s is not allowed to serve %s", p.Name, defaultPath)
+	}
+	target := p.ParsedURL
+	override, ok := p.Paths[command]
+	if !ok {
+		target.Path += defaultPath
+		return target, nil
+	}
+	ref, err := url.Parse(override)
+	if err != nil {
+		return url.URL{}, fmt.Errorf("provider %s: invalid %s path %q: %v", p.Name, command, override, err)
+	}
+	if ref.IsAbs() {
+		return *ref, nil
+	}
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(ref.Path, "/")
+	target.RawPath = ""
+	if ref.RawQuery != "" {
+		if target.RawQuery != "" {
+			target.RawQuery += "&"
+		}
+		target.RawQuery += ref.RawQuery
+	}
+	return target, nil
+}
+
+// ApplyQuery adds the client query parameters the provider forwards, then its
+// configured ones, to an upstream URL. Configured parameters win over client
+// and path override ones of the same name.
+func (p *ProviderService) ApplyQuery(rIn *http.Request, target *url.URL) {
+	if len(p.ForwardQuery) == 0 && len(p.Query) == 0 {
+		return
+	}
+	query := target.Query()
+	if len(p.ForwardQuery) > 0 {
+		client := rIn.URL.Query()
+		for _, name := range p.ForwardQuery {
+			if values, ok := client[name]; ok {
+				query[name] = values
+			}
+		}
+	}
+	for name, values := range p.Query {
+		query[name] = values
+	}
+	target.RawQuery = query.Encode()
+}
+
+// HeaderTemplate is a header added to a provider's requests or responses. The
+// value may hold request placeholders such as {http.request.header.X-Org},
+// expanded per request.
+type HeaderTemplate struct {
+	Name  string
+	Value string
+	// Delete removes the header instead of setting it ("-Name" in the Caddyfile)
+	Delete bool
+}
+
+// applyHeaders sets or deletes the templated headers on h, expanding
+// placeholders against the incoming request. Headers whose value expands to
+// nothing are not sent.
+func applyHeaders(templates []HeaderTemplate, h http.Header, rIn *http.Request) {
+	if len(templates) == 0 {
+		return
+	}
+	repl, ok := rIn.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		repl = caddy.NewReplacer()
+	}
+	for _, t := range templates {
+		if t.Delete {
+			h.Del(t.Name)
+			continue
+		}
+		if value := repl.ReplaceAll(t.Value, ""); value != "" {
+			h.Set(t.Name, value)
+		}
+	}
+}
+
+// ApplyRequestHeaders adds the provider's configured headers to an outgoing
+// request; drivers call it after setting credentials, so configured headers win
+func (p *ProviderService) ApplyRequestHeaders(rIn, rOut *http.Request) {
+	applyHeaders(p.RequestHeaders, rOut.Header, rIn)
+}
+
+// ApplyResponseHeaders adds the provider's configured headers to the response
+// of a request it served
+func (p *ProviderService) ApplyResponseHeaders(h http.Header, rIn *http.Request) {
+	applyHeaders(p.ResponseHeaders, h, rIn)
 }
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestProviderService_ApplyRequestHeaders(t *testing.T) {
+	p := &ProviderService{RequestHeaders: []HeaderTemplate{
+		{Name: "anthropic-beta", Value: "prompt-caching"},
+		{Name: "X-Org-Id", Value: "{http.request.header.X-Org}"},
+		{Name: "X-Empty", Value: "{http.request.header.X-Missing}"},
+		{Name: "User-Agent", Delete: true},
+	}}
+
+	repl := caddy.NewReplacer()
+	repl.Set("http.request.header.X-Org", "acme")
+	rIn := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	rIn = rIn.WithContext(context.WithValue(rIn.Context(), caddy.ReplacerCtxKey, repl))
+
+	rOut, _ := http.NewRequest(http.MethodPost, "https://upstream/v1/chat/completions", nil)
+	rOut.Header.Set("User-Agent", "router")
+	p.ApplyRequestHeaders(rIn, rOut)
+
+	if got := rOut.Header.Get("anthropic-beta"); got != "prompt-caching" {
+		t.Errorf("anthropic-beta = %q", got)
+	}
+	if got := rOut.Header.Get("X-Org-Id"); got != "acme" {
+		t.Errorf("X-Org-Id = %q, want placeholder expanded", got)
+	}
+	if _, ok := rOut.Header["X-Empty"]; ok {
+		t.Error("expected a header expanding to nothing not to be sent")
+	}
+	if rOut.Header.Get("User-Agent") != "" {
+		t.Error("expected User-Agent to be deleted")
+	}
+
+	// Without a replacer in the context, static values still apply
+	h := http.Header{}
+	(&ProviderService{ResponseHeaders: []HeaderTemplate{{Name: "X-Served-By", Value: "anthropic"}}}).
+		ApplyResponseHeaders(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if h.Get("X-Served-By") != "anthropic" {
+		t.Errorf("X-Served-By = %q", h.Get("X-Served-By"))
+	}
+}
+
+func TestProviderService_EndpointURL(t *testing.T) {
+	base, _ := url.Parse("https://example.com/v1")
+	p := &ProviderService{Name: "azure", ParsedURL: *base, Paths: map[string]string{
+		"inference":   "/openai/deployments/gpt/chat/completions?api-version=2024-10-21",
+		"list_models": "https://models.example.com/api/tags",
+	}}
+
+	cases := []struct{ command, defaultPath, want string }{
+		{"inference", "/chat/completions", "https://example.com/v1/openai/deployments/gpt/chat/completions?api-version=2024-10-21"},
+		{"list_models", "/models", "https://models.example.com/api/tags"},
+		{"embeddings", "/embeddings", "https://example.com/v1/embeddings"},
+	}
+	for _, c := range cases {
+		got, err := p.EndpointURL(c.command, c.defaultPath)
+		if err != nil {
+			t.Fatalf("EndpointURL(%s) returned error: %v", c.command, err)
+		}
+		if got.String() != c.want {
+			t.Errorf("EndpointURL(%s) = %s, want %s", c.command, got.String(), c.want)
+		}
+	}
+	if p.ParsedURL.Path != "/v1" {
+		t.Errorf("expected the base URL to be left unchanged, got %s", p.ParsedURL.String())
+	}
+}
+
+func TestProviderService_EndpointPolicy(t *testing.T) {
+	base, _ := url.Parse("https://example.com/v1")
+	p := &ProviderService{Name: "openai", ParsedURL: *base, Endpoints: &EndpointPolicy{
+		Allow: []string{"/chat/completions", "/embeddings", "/fine_tuning/*"},
+		Deny:  []string{"/fine_tuning/jobs/*"},
+	}}
+	if err := p.Endpoints.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for endpoint, allowed := range map[string]bool{
+		"/chat/completions":   true,
+		"/embeddings":         true,
+		"/responses":          false,
+		"/fine_tuning/files":  true,
+		"/fine_tuning/jobs/x": false,
+		"/images/generations": false,
+	} {
+		if got := p.Endpoints.Allows(endpoint); got != allowed {
+			t.Errorf("Allows(%s) = %v, want %v", endpoint, got, allowed)
+		}
+	}
+	if _, err := p.EndpointURL("inference", "/responses"); !errors.Is(err, errs.ErrCapability) {
+		t.Errorf("expected a blocked endpoint to fail as unsupported, got %v", err)
+	}
+}
+
+func TestProviderService_ApplyQuery(t *testing.T) {
+	p := &ProviderService{
+		Query:        url.Values{"api-version": {"2024-10-21"}},
+		ForwardQuery: []string{"user", "api-version"},
+	}
+	rIn := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?user=42&debug=1&api-version=old", nil)
+	target, _ := url.Parse("https://example.com/v1/chat/completions?deployment=gpt")
+
+	p.ApplyQuery(rIn, target)
+	query := target.Query()
+	if query.Get("user") != "42" {
+		t.Errorf("expected forwarded user param, got %q", target.RawQuery)
+	}
+	if query.Has("debug") {
+		t.Errorf("expected debug not to be forwarded, got %q", target.RawQuery)
+	}
+	if query.Get("api-version") != "2024-10-21" {
+		t.Errorf("expected configured api-version to win, got %q", target.RawQuery)
+	}
+	if query.Get("deployment") != "gpt" {
+		t.Errorf("expected the path override query to be kept, got %q", target.RawQuery)
+	}
+}
+
+func TestProviderQuirks(t *testing.T) {
+	req, err := styles.ParsePartialJSON([]byte(`{
+		"model": "mistral-small",
+		"seed": 7,
+		"user": "u-1",
+		"random_seed": 3,
+		"max_completion_tokens": 100,
+		"response_format": {"type": "json_object"},
+		"messages": [{"role": "user", "content": "List three colors."}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quirks := &ProviderQuirks{
+		DropFields:   []string{"user"},
+		RenameFields: map[string]string{"seed": "random_seed", "max_completion_tokens": "max_tokens"},
+		JSONModeHint: true,
+	}
+	out, err := quirks.Apply(req)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	for _, key := range []string{"user", "seed", "max_completion_tokens"} {
+		if _, ok := out[key]; ok {
+			t.Errorf("expected %s to be removed", key)
+		}
+	}
+	if got := styles.TryGetFromPartialJSON[int](out, "random_seed"); got != 3 {
+		t.Errorf("random_seed = %d, want the request's own 3", got)
+	}
+	if got := styles.TryGetFromPartialJSON[int](out, "max_tokens"); got != 100 {
+		t.Errorf("max_tokens = %d, want 100", got)
+	}
+	messages := styles.TryGetFromPartialJSON[[]styles.ChatCompletionsMessage](out, "messages")
+	if len(messages) != 2 || messages[0].Role != "system" || messages[0].Content != jsonModeHint {
+		t.Errorf("messages = %+v, want a JSON hint first", messages)
+	}
+	if _, ok := req["user"]; !ok {
+		t.Error("expected the original request to be left unchanged")
+	}
+
+	// Requests mentioning JSON need no hint, and a nil quirks set changes nothing
+	req, _ = styles.ParsePartialJSON([]byte(`{"response_format": {"type": "json_object"}, "messages": [{"role": "user", "content": "Answer in JSON"}]}`))
+	if out, _ := quirks.Apply(req); len(styles.TryGetFromPartialJSON[[]any](out, "messages")) != 1 {
+		t.Error("expected no hint when the messages mention JSON")
+	}
+	var none *ProviderQuirks
+	if out, _ := none.Apply(req); len(out) != len(req) {
+		t.Error("expected nil quirks to leave the request unchanged")
+	}
+}
+
+func TestProviderQuirksLiftExtras(t *testing.T) {
+	req, _ := styles.ParsePartialJSON([]byte(`{
+		"model": "anthropic/claude-sonnet-4",
+		"extras": {"provider": {"order": ["Anthropic"], "allow_fallbacks": false}, "route": "fallback", "trace": "t-1"}
+	}`))
+	quirks := &ProviderQuirks{LiftExtras: []string{"provider", "transforms", "route"}}
+	out, err := quirks.Apply(req)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if got := styles.TryGetFromPartialJSON[map[string]any](out, "provider"); got["allow_fallbacks"] != false {
+		t.Errorf("provider = %v, want the lifted preferences", got)
+	}
+	if got := styles.TryGetFromPartialJSON[string](out, "route"); got != "fallback" {
+		t.Errorf("route = %q, want fallback", got)
+	}
+	if extras := styles.TryGetFromPartialJSON[map[string]any](out, "extras"); len(extras) != 1 || extras["trace"] != "t-1" {
+		t.Errorf("extras = %v, want only the unlifted fields", extras)
+	}
+
+	req, _ = styles.ParsePartialJSON([]byte(`{"extras": {"transforms": ["middle-out"]}}`))
+	if out, _ := quirks.Apply(req); out["extras"] != nil || out["transforms"] == nil {
+		t.Errorf("expected an emptied extras object to be removed, got %v", out)
+	}
+}
+
+func TestCapabilities_MapTokenLimit(t *testing.T) {
+	caps := Capabilities{
+		{Model: "*", Lacks: []string{CapabilityMaxCompletionTokens}},
+		{Model: "o[1-9]*", Supports: []string{CapabilityMaxCompletionTokens}},
+		{Model: "gpt-4o*", Supports: []string{CapabilityVision}},
+	}
+
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "o3-mini", "max_tokens": 500}`))
+	out := caps.MapTokenLimit(req)
+	if string(out["max_completion_tokens"]) != "500" || out["max_tokens"] != nil {
+		t.Errorf("o3-mini request = %v, want max_completion_tokens", out)
+	}
+	if req["max_tokens"] == nil {
+		t.Error("expected the original request to be left unchanged")
+	}
+
+	// Vendor-prefixed names match "*", and entries not mentioning the field fall through
+	for _, model := range []string{"meta-llama/llama-3.3-70b", "gpt-4o-mini"} {
+		req, _ = styles.ParsePartialJSON([]byte(`{"model": "` + model + `", "max_completion_tokens": 64}`))
+		if out = caps.MapTokenLimit(req); string(out["max_tokens"]) != "64" || out["max_completion_tokens"] != nil {
+			t.Errorf("%s request = %v, want max_tokens", model, out)
+		}
+	}
+
+	req, _ = styles.ParsePartialJSON([]byte(`{"model": "m", "max_tokens": 10}`))
+	if out = (Capabilities{}).MapTokenLimit(req); string(out["max_tokens"]) != "10" {
+		t.Errorf("unknown model request = %v, want it unchanged", out)
+	}
+}
+
+func TestCapabilities_MapRoles(t *testing.T) {
+	caps := Capabilities{{Model: "o[1-9]*", Supports: []string{CapabilityDeveloperRole}}}
+	history := `"messages": [{"role": "system", "content": "Be brief."}, {"role": "developer", "content": "Use metric units.", "name": "ops"}, {"role": "user", "content": "Hi"}]`
+
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "o3", ` + history + `}`))
+	out, err := caps.MapRoles(req)
+	if err != nil {
+		t.Fatalf("MapRoles returned error: %v", err)
+	}
+	messages := styles.TryGetFromPartialJSON[[]styles.ChatCompletionsMessage](out, "messages")
+	if messages[0].Role != "developer" || messages[1].Role != "developer" || messages[2].Role != "user" {
+		t.Errorf("o3 roles = %+v, want developer messages", messages)
+	}
+	if messages[1].Name != "ops" {
+		t.Error("expected other message fields to be kept")
+	}
+
+	req, _ = styles.ParsePartialJSON([]byte(`{"model": "llama-3.3-70b", ` + history + `}`))
+	out, _ = caps.MapRoles(req)
+	messages = styles.TryGetFromPartialJSON[[]styles.ChatCompletionsMessage](out, "messages")
+	if messages[0].Role != "system" || messages[1].Role != "system" {
+		t.Errorf("llama roles = %+v, want system messages", messages)
+	}
+	if original := styles.TryGetFromPartialJSON[[]styles.ChatCompletionsMessage](req, "messages"); original[1].Role != "developer" {
+		t.Error("expected the original request to be left unchanged")
+	}
+}
+
+func TestCapabilities_CheckRequired(t *testing.T) {
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "tools": [{"type": "function", "function": {"name": "f"}}, {"type": "computer_20250124", "name": "computer"}]}`))
+	required := RequiredCapabilities(req)
+	if !slices.Equal(required, []string{CapabilityComputerUse}) {
+		t.Fatalf("RequiredCapabilities = %v, want computer_use", required)
+	}
+
+	caps := Capabilities{{Model: "computer-use-preview*", Supports: []string{CapabilityComputerUse}}}
+	if err := caps.CheckRequired("computer-use-preview", required); err != nil {
+		t.Errorf("CheckRequired(computer-use-preview) = %v", err)
+	}
+	err := caps.CheckRequired("gpt-4o", required)
+	if !errors.Is(err, errs.ErrCapability) || ClassifyError(err) != ErrorClassUnsupported || !ClassifyError(err).FailOver() {
+		t.Errorf("CheckRequired(gpt-4o) = %v, want a capability error other providers may not have", err)
+	}
+
+	plain, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "tools": [{"type": "function", "function": {"name": "f"}}]}`))
+	if required := RequiredCapabilities(plain); required != nil {
+		t.Errorf("RequiredCapabilities = %v, want none", required)
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// ProviderQuirks rewrites Chat Completions requests for upstreams that deviate
+// from the OpenAI API, such as ones rejecting fields they don't know
+type ProviderQuirks struct {
+	// DropFields are removed from requests
+	DropFields []string `json:"drop_fields,omitempty"`
+	// RenameFields moves fields to the name the provider uses, e.g.
+	// seed -> random_seed; a field already set under the new name wins
+	RenameFields map[string]string `json:"rename_fields,omitempty"`
+	// JSONModeHint adds a system message asking for JSON to json_object
+	// requests whose messages never mention JSON, which some providers reject
+	JSONModeHint bool `json:"json_mode_hint,omitempty"`
+	// LiftExtras moves these fields of the request's extras object to the top
+	// level, for gateways such as OpenRouter taking routing preferences there;
+	// extras is removed once empty
+	LiftExtras []string `json:"lift_extras,omitempty"`
+}
+
+// jsonModeHint is the system message added by JSONModeHint
+const jsonModeHint = "Respond in JSON."
+
+// Apply returns the request rewritten for the provider; requests needing no
+// change are returned as is
+func (q *ProviderQuirks) Apply(reqJson styles.PartialJSON) (styles.PartialJSON, error) {
+	if q == nil {
+		return reqJson, nil
+	}
+	res, cloned := reqJson, false
+	clone := func() {
+		if !cloned {
+			res, cloned = reqJson.Clone(), true
+		}
+	}
+
+	for _, field := range q.DropFields {
+		if _, ok := res[field]; ok {
+			clone()
+			delete(res, field)
+		}
+	}
+	for from, to := range q.RenameFields {
+		value, ok := res[from]
+		if !ok {
+			continue
+		}
+		clone()
+		delete(res, from)
+		if _, taken := res[to]; !taken {
+			res[to] = value
+		}
+	}
+
+	if len(q.LiftExtras) > 0 {
+		if raw, ok := res["extras"]; ok {
+			var extras map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &extras); err != nil {
+				return nil, err
+			}
+			lifted := false
+			for _, field := range q.LiftExtras {
+				if value, ok := extras[field]; ok {
+					if !lifted {
+						clone()
+						lifted = true
+					}
+					res[field] = value
+					delete(extras, field)
+				}
+			}
+			if lifted {
+				if len(extras) == 0 {
+					delete(res, "extras")
+				} else if err := res.Set("extras", extras); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if q.JSONModeHint && needsJSONHint(res) {
+		clone()
+		var messages []json.RawMessage
+		if err := json.Unmarshal(res["messages"], &messages); err != nil {
+			return nil, err
+		}
+		hint, err := json.Marshal(styles.ChatCompletionsMessage{Role: "system", Content: jsonModeHint})
+		if err != nil {
+			return nil, err
+		}
+		if err := res.Set("messages", append([]json.RawMessage{hint}, messages...)); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// needsJSONHint reports whether a request asks for a JSON object without
+// mentioning JSON in its messages
+func needsJSONHint(reqJson styles.PartialJSON) bool {
+	format := styles.TryGetFromPartialJSON[map[string]any](reqJson, "response_format")
+	if format["type"] != "json_object" {
+		return false
+	}
+	raw, ok := reqJson["messages"]
+	return ok && !strings.Contains(strings.ToLower(string(raw)), "json")
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Quota response headers
+const (
+	// QuotaRemainingHeader lists what the plan has left this period, e.g.
+	// "requests=41, tokens=120000"; unlimited dimensions are left out
+	QuotaRemainingHeader = "X-Quota-Remaining"
+	// QuotaResetHeader is when the period ends, in Unix seconds
+	QuotaResetHeader = "X-Quota-Reset"
+)
+
+// Plan is what a key or tenant may use per monthly period
+type Plan struct {
+	// Requests caps the requests per period (0: unlimited)
+	Requests int64 `json:"requests,omitempty"`
+	// Tokens caps the input and output tokens per period (0: unlimited)
+	Tokens int64 `json:"tokens,omitempty"`
+	// Tiers lists the model tiers the plan allows (default: every model)
+	Tiers []string `json:"tiers,omitempty"`
+}
+
+// Quotas enforces plans: every key or tenant is assigned a plan whose
+// requests and tokens are counted per calendar month (UTC). Counters live in
+// a StateStore, so instances sharing a store share them; a new month starts
+// from fresh counters.
+type Quotas struct {
+	Store StateStore `json:"-"`
+	// Prefix namespaces the counters in the store, e.g. by router name
+	Prefix string `json:"-"`
+
+	Plans map[string]*Plan `json:"plans,omitempty"`
+	// Tiers maps tier names to model glob patterns, e.g. "openai/gpt-4o*"
+	Tiers map[string][]string `json:"tiers,omitempty"`
+	// Keys assigns plans to key IDs; a key's own plan is counted per key
+	Keys map[string]string `json:"keys,omitempty"`
+	// Tenants assigns plans to tenants; a tenant's plan is counted per
+	// tenant, shared by its keys
+	Tenants map[string]string `json:"tenants,omitempty"`
+	// Default is the plan of tenants without one (default: none, unlimited)
+	Default string `json:"default,omitempty"`
+}
+
+// QuotaStatus is what a plan has left after counting a request
+type QuotaStatus struct {
+	Plan string
+	// Requests and Tokens remain this period; -1 means unlimited
+	Requests, Tokens int64
+	// Reset is when the period ends
+	Reset time.Time
+	// Exceeded names the exhausted dimension, "requests" or "tokens", when
+	// the request was refused
+	Exceeded string
+}
+
+// quotaCounter is a subject's usage in a period as kept in the store
+type quotaCounter struct {
+	Requests int64 `json:"requests"`
+	Tokens   int64 `json:"tokens"`
+}
+
+// Validate checks that every referenced plan and tier exists
+func (q *Quotas) Validate() error {
+	if q == nil {
+		return nil
+	}
+	for name, plan := range q.Plans {
+		if plan.Requests < 0 || plan.Tokens < 0 {
+			return fmt.Errorf("quota plan %s: limits must not be negative", name)
+		}
+		for _, tier := range plan.Tiers {
+			if _, ok := q.Tiers[tier]; !ok {
+				return fmt.Errorf("quota plan %s: unknown tier '%s'", name, tier)
+			}
+		}
+	}
+	for tier, patterns := range q.Tiers {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("quota tier %s: invalid pattern '%s'", tier, pattern)
+			}
+		}
+	}
+	assigned := []string{q.Default}
+	for _, plan := range q.Keys {
+		assigned = append(assigned, plan)
+	}
+	for _, plan := range q.Tenants {
+		assigned = append(assigned, plan)
+	}
+	for _, plan := range assigned {
+		if _, ok := q.Plans[plan]; !ok && plan != "" {
+			return fmt.Errorf("quota: unknown plan '%s'", plan)
+		}
+	}
+	return nil
+}
+
+// planFor returns the plan of a request with the store key counting it, or
+// "" when no plan applies
+func (q *Quotas) planFor(tenant, keyID string, now time.Time) (string, string) {
+	period := now.UTC().Format("2006-01")
+	if plan, ok := q.Keys[keyID]; ok && keyID != "" {
+		return plan, q.Prefix + "quota:" + period + ":key:" + keyID
+	}
+	plan, ok := q.Tenants[tenant]
+	if !ok {
+		plan = q.Default
+	}
+	switch {
+	case plan == "":
+		return "", ""
+	case tenant != "":
+		return plan, q.Prefix + "quota:" + period + ":tenant:" + tenant
+	case keyID != "":
+		return plan, q.Prefix + "quota:" + period + ":key:" + keyID
+	}
+	return "", ""
+}
+
+// Take counts a request against its plan. The status is nil when no plan
+// applies; a request the plan's tiers don't allow fails with a PolicyError,
+// and one past the plan's limits is refused with the status's Exceeded set.
+func (q *Quotas) Take(tenant, keyID string, reqJson styles.PartialJSON, now time.Time) (*QuotaStatus, error) {
+	if q == nil {
+		return nil, nil
+	}
+	name, storeKey := q.planFor(tenant, keyID, now)
+	if name == "" {
+		return nil, nil
+	}
+	plan := q.Plans[name]
+	if model := requestModel(reqJson); !q.allowsModel(plan, model) {
+		return nil, &PolicyError{
+			Status:  http.StatusForbidden,
+			Message: fmt.Sprintf("model %s is not included in plan %s", model, name),
+		}
+	}
+
+	status := &QuotaStatus{Plan: name, Reset: quotaReset(now)}
+	err := q.Store.Update([]string{storeKey}, quotaTTL(now), func(values [][]byte) ([][]byte, error) {
+		var counter quotaCounter
+		if err := unmarshalStored(values[0], &counter); err != nil {
+			return nil, err
+		}
+		switch {
+		case plan.Requests > 0 && counter.Requests >= plan.Requests:
+			status.Exceeded = "requests"
+		case plan.Tokens > 0 && counter.Tokens >= plan.Tokens:
+			status.Exceeded = "tokens"
+		default:
+			counter.Requests++
+		}
+		status.Requests, status.Tokens = plan.remaining(counter)
+		if status.Exceeded != "" {
+			return nil, nil
+		}
+		return marshalStored(counter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// AddTokens counts the tokens a request used against its plan, once known
+func (q *Quotas) AddTokens(tenant, keyID string, tokens int, now time.Time) error {
+	if q == nil || tokens <= 0 {
+		return nil
+	}
+	name, storeKey := q.planFor(tenant, keyID, now)
+	if name == "" || q.Plans[name].Tokens == 0 {
+		return nil
+	}
+	return q.Store.Update([]string{storeKey}, quotaTTL(now), func(values [][]byte) ([][]byte, error) {
+		var counter quotaCounter
+		if err := unmarshalStored(values[0], &counter); err != nil {
+			return nil, err
+		}
+		counter.Tokens += int64(tokens)
+		return marshalStored(counter)
+	})
+}
+
+// allowsModel reports whether one of the plan's tiers covers the model
+func (q *Quotas) allowsModel(plan *Plan, model string) bool {
+	if len(plan.Tiers) == 0 {
+		return true
+	}
+	_, bareModel, _ := strings.Cut(model, "/")
+	return slices.ContainsFunc(plan.Tiers, func(tier string) bool {
+		return matchesAny(q.Tiers[tier], model) || matchesAny(q.Tiers[tier], bareModel)
+	})
+}
+
+// remaining returns what the plan has left after counter; -1 is unlimited
+func (p *Plan) remaining(counter quotaCounter) (requests, tokens int64) {
+	requests, tokens = -1, -1
+	if p.Requests > 0 {
+		requests = max(p.Requests-counter.Requests, 0)
+	}
+	if p.Tokens > 0 {
+		tokens = max(p.Tokens-counter.Tokens, 0)
+	}
+	return requests, tokens
+}
+
+// SetHeaders sets the quota headers of a response
+func (s *QuotaStatus) SetHeaders(h http.Header) {
+	if s == nil {
+		return
+	}
+	var remaining []string
+	if s.Requests >= 0 {
+		remaining = append(remaining, "requests="+strconv.FormatInt(s.Requests, 10))
+	}
+	if s.Tokens >= 0 {
+		remaining = append(remaining, "tokens="+strconv.FormatInt(s.Tokens, 10))
+	}
+	if len(remaining) == 0 {
+		return
+	}
+	h.Set(QuotaRemainingHeader, strings.Join(remaining, ", "))
+	h.Set(QuotaResetHeader, strconv.FormatInt(s.Reset.Unix(), 10))
+}
+
+// quotaReset returns the start of the month after now, in UTC
+func quotaReset(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// quotaTTL keeps a period's counters a day past its end, so clocks of
+// instances sharing a store may disagree a little
+func quotaTTL(now time.Time) time.Duration {
+	return quotaReset(now).Sub(now) + 24*time.Hour
+}
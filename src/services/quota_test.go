@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestQuotas_Take(t *testing.T) {
+	now := time.Date(2026, 10, 31, 23, 0, 0, 0, time.UTC)
+	q := &Quotas{
+		Store:  NewMemoryStateStore(),
+		Prefix: "r:",
+		Plans: map[string]*Plan{
+			"free": {Requests: 2, Tiers: []string{"small"}},
+			"pro":  {Tokens: 100},
+		},
+		Tiers:   map[string][]string{"small": {"gpt-4o-mini"}},
+		Keys:    map[string]string{"acme:vip": "pro"},
+		Default: "free",
+	}
+	if err := q.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	small, _ := styles.ParsePartialJSON([]byte(`{"model": "openai/gpt-4o-mini+usage"}`))
+	large, _ := styles.ParsePartialJSON([]byte(`{"model": "gpt-4o"}`))
+
+	// Keys of a tenant on the default plan share its requests
+	for _, key := range []string{"acme:1", "acme:2"} {
+		if status, err := q.Take("acme", key, small, now); err != nil || status.Exceeded != "" {
+			t.Fatalf("Take(%s) = %+v, %v", key, status, err)
+		}
+	}
+	status, _ := q.Take("acme", "acme:3", small, now)
+	if status.Exceeded != "requests" || status.Requests != 0 {
+		t.Errorf("expected the tenant's requests to be used up, got %+v", status)
+	}
+	h := http.Header{}
+	status.SetHeaders(h)
+	if h.Get(QuotaRemainingHeader) != "requests=0" || h.Get(QuotaResetHeader) != "1793491200" {
+		t.Errorf("headers = %v", h)
+	}
+	var perr *PolicyError
+	if _, err := q.Take("globex", "", large, now); !errors.As(err, &perr) || perr.Status != http.StatusForbidden {
+		t.Errorf("expected a model outside the plan's tiers to be refused, got %v", err)
+	}
+
+	// A key's own plan counts tokens once they are known
+	if err := q.AddTokens("acme", "acme:vip", 100, now); err != nil {
+		t.Fatalf("AddTokens returned error: %v", err)
+	}
+	if status, _ := q.Take("acme", "acme:vip", large, now); status.Exceeded != "tokens" || status.Requests != -1 {
+		t.Errorf("expected the key's tokens to be used up, got %+v", status)
+	}
+
+	// The next month starts afresh
+	now = now.Add(time.Hour)
+	if status, _ := q.Take("acme", "acme:3", small, now); status.Exceeded != "" || status.Requests != 1 {
+		t.Errorf("expected the quota to reset with the month, got %+v", status)
+	}
+
+	q.Default = "missing"
+	if err := q.Validate(); err == nil {
+		t.Error("expected an unknown default plan to be rejected")
+	}
+}
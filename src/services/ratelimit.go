@@ -0,0 +1,168 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRateLimitWindow is assumed when an upstream reports an exhausted
+// quota or a 429 without saying when it resets
+const defaultRateLimitWindow = time.Minute
+
+// rateLimits tracks the upstream quota of a provider per credential, as
+// reported by rate-limit response headers
+type rateLimits struct {
+	mu sync.Mutex
+	// exhaustedUntil maps a credential fingerprint to the time its quota resets;
+	// the zero time means quota was left at the last response
+	exhaustedUntil map[string]time.Time
+}
+
+// ObserveRateLimit records the rate-limit state reported by an upstream
+// response for the credential used in the request. Drivers call it for every
+// upstream response, successful or not.
+func (p *ProviderService) ObserveRateLimit(credential string, res *http.Response) {
+	if res == nil {
+		return
+	}
+	until, ok := parseRateLimit(res, time.Now())
+	if !ok {
+		return
+	}
+	p.rateLimits.mu.Lock()
+	defer p.rateLimits.mu.Unlock()
+	if p.rateLimits.exhaustedUntil == nil {
+		p.rateLimits.exhaustedUntil = make(map[string]time.Time)
+	}
+	p.rateLimits.exhaustedUntil[credentialFingerprint(credential)] = until
+}
+
+// RateLimitedUntil returns when the quota of a credential resets, or the zero
+// time when it is not known to be exhausted
+func (p *ProviderService) RateLimitedUntil(credential string, now time.Time) time.Time {
+	p.rateLimits.mu.Lock()
+	defer p.rateLimits.mu.Unlock()
+	until := p.rateLimits.exhaustedUntil[credentialFingerprint(credential)]
+	if !until.After(now) {
+		return time.Time{}
+	}
+	return until
+}
+
+// RateLimited reports whether every credential seen for the provider has
+// exhausted its quota, so that a request sent now is expected to get a 429
+func (p *ProviderService) RateLimited(now time.Time) bool {
+	p.rateLimits.mu.Lock()
+	defer p.rateLimits.mu.Unlock()
+	if len(p.rateLimits.exhaustedUntil) == 0 {
+		return false
+	}
+	for _, until := range p.rateLimits.exhaustedUntil {
+		if !until.After(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// credentialFingerprint identifies a credential without keeping it in memory
+func credentialFingerprint(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:8])
+}
+
+// parseRateLimit derives when the upstream quota resets from a response: a
+// 429 is exhausted until Retry-After, otherwise any bucket reporting zero
+// remaining is exhausted until its reset. ok is false when the response
+// carries no rate-limit information.
+//
+// Understood headers: x-ratelimit-remaining[-<bucket>] with
+// x-ratelimit-reset[-<bucket>] (duration like "6m0s", seconds, or epoch
+// seconds/milliseconds) and anthropic-ratelimit-<bucket>-remaining with
+// anthropic-ratelimit-<bucket>-reset (RFC 3339).
+func parseRateLimit(res *http.Response, now time.Time) (until time.Time, ok bool) {
+	if res.StatusCode == http.StatusTooManyRequests {
+		if wait, found := parseRetryAfter(res.Header.Get("Retry-After"), now); found {
+			return now.Add(wait), true
+		}
+		until = now.Add(defaultRateLimitWindow)
+		ok = true
+	}
+
+	for name, values := range res.Header {
+		if len(values) == 0 {
+			continue
+		}
+		name = strings.ToLower(name)
+		var resetHeader string
+		switch {
+		case strings.HasPrefix(name, "x-ratelimit-remaining"):
+			resetHeader = "x-ratelimit-reset" + strings.TrimPrefix(name, "x-ratelimit-remaining")
+		case strings.HasPrefix(name, "anthropic-ratelimit-") && strings.HasSuffix(name, "-remaining"):
+			resetHeader = strings.TrimSuffix(name, "-remaining") + "-reset"
+		default:
+			continue
+		}
+		remaining, err := strconv.ParseFloat(strings.TrimSpace(values[0]), 64)
+		if err != nil {
+			continue
+		}
+		ok = true
+		if remaining > 0 {
+			continue
+		}
+		reset, found := parseRateLimitReset(res.Header.Get(resetHeader), now)
+		if !found {
+			reset = now.Add(defaultRateLimitWindow)
+		}
+		if reset.After(until) {
+			until = reset
+		}
+	}
+	return until, ok
+}
+
+// parseRateLimitReset parses a reset header value into an absolute time
+func parseRateLimitReset(value string, now time.Time) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		switch {
+		case n > 1e12: // epoch milliseconds
+			return time.UnixMilli(int64(n)), true
+		case n > 1e9: // epoch seconds
+			return time.Unix(int64(n), 0), true
+		default: // seconds from now
+			return now.Add(time.Duration(n * float64(time.Second))), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseRetryAfter parses a Retry-After value: delay seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func rateLimitResponse(status int, headers map[string]string) *http.Response {
+	res := &http.Response{StatusCode: status, Header: http.Header{}}
+	for k, v := range headers {
+		res.Header.Set(k, v)
+	}
+	return res
+}
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		res     *http.Response
+		ok      bool
+		resetIn time.Duration // zero: not exhausted
+	}{
+		{"no headers", rateLimitResponse(200, nil), false, 0},
+		{"quota left", rateLimitResponse(200, map[string]string{
+			"x-ratelimit-remaining-requests": "12",
+			"x-ratelimit-remaining-tokens":   "4000",
+		}), true, 0},
+		{"openai tokens exhausted", rateLimitResponse(200, map[string]string{
+			"x-ratelimit-remaining-requests": "12",
+			"x-ratelimit-remaining-tokens":   "0",
+			"x-ratelimit-reset-tokens":       "6m0s",
+		}), true, 6 * time.Minute},
+		{"epoch milliseconds reset", rateLimitResponse(200, map[string]string{
+			"x-ratelimit-remaining": "0",
+			"x-ratelimit-reset":     "1767323105000", // now + 60s
+		}), true, time.Minute},
+		{"anthropic", rateLimitResponse(200, map[string]string{
+			"anthropic-ratelimit-requests-remaining": "0",
+			"anthropic-ratelimit-requests-reset":     "2026-01-02T03:04:35Z",
+		}), true, 30 * time.Second},
+		{"429 with retry-after", rateLimitResponse(429, map[string]string{
+			"retry-after":                    "20",
+			"x-ratelimit-remaining-requests": "0",
+			"x-ratelimit-reset-requests":     "1s",
+		}), true, 20 * time.Second},
+		{"429 without hints", rateLimitResponse(429, nil), true, defaultRateLimitWindow},
+	}
+	for _, tt := range tests {
+		until, ok := parseRateLimit(tt.res, now)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+		var want time.Time
+		if tt.resetIn > 0 {
+			want = now.Add(tt.resetIn)
+		}
+		if !until.Equal(want) {
+			t.Errorf("%s: until = %v, want %v", tt.name, until, want)
+		}
+	}
+}
+
+func TestProviderService_RateLimited(t *testing.T) {
+	p := &ProviderService{Name: "test"}
+	exhausted := rateLimitResponse(429, map[string]string{"retry-after": "30"})
+	available := rateLimitResponse(200, map[string]string{"x-ratelimit-remaining-requests": "5"})
+
+	if p.RateLimited(time.Now()) {
+		t.Error("a provider without observations must not be rate limited")
+	}
+
+	p.ObserveRateLimit("Bearer key-a", exhausted)
+	if !p.RateLimited(time.Now()) {
+		t.Error("expected the provider to be rate limited after a 429 on its only key")
+	}
+	if p.RateLimitedUntil("Bearer key-a", time.Now()).IsZero() || !p.RateLimitedUntil("Bearer key-b", time.Now()).IsZero() {
+		t.Error("expected rate-limit state to be tracked per credential")
+	}
+	if p.RateLimited(time.Now().Add(time.Minute)) {
+		t.Error("expected the limit to expire after Retry-After")
+	}
+
+	p.ObserveRateLimit("Bearer key-b", available)
+	if p.RateLimited(time.Now()) {
+		t.Error("a provider with a key that has quota left must not be rate limited")
+	}
+}
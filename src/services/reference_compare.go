@@ -0,0 +1,222 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// ReferenceCompare replays a sample of production requests against a
+// reference model and compares the answers, so silent regressions of a
+// provider show up in the observability sinks
+type ReferenceCompare struct {
+	// Model is the reference model the sampled requests are replayed against
+	Model string `json:"model"`
+	// Rate is the fraction of requests sampled, between 0 and 1
+	Rate float64 `json:"rate"`
+	// Models restricts sampling to requested models matching these patterns
+	Models []string `json:"models,omitempty"`
+}
+
+// Validate checks the reference model and the sample rate
+func (c *ReferenceCompare) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Model == "" {
+		return fmt.Errorf("compare: reference model is required")
+	}
+	if c.Rate <= 0 || c.Rate > 1 {
+		return fmt.Errorf("compare: rate must be above 0 and at most 1, got %v", c.Rate)
+	}
+	return nil
+}
+
+// Sample reports whether a request is replayed against the reference model.
+// Requests for the reference model itself never are.
+func (c *ReferenceCompare) Sample(reqJson styles.PartialJSON) bool {
+	if c == nil {
+		return false
+	}
+	model := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	if model == "" || model == c.Model {
+		return false
+	}
+	if len(c.Models) > 0 && !matchesAny(c.Models, model) {
+		return false
+	}
+	return rand.Float64() < c.Rate
+}
+
+// ResponseDiff is how a reference answer differs from the production one
+type ResponseDiff struct {
+	// Similarity is the cosine similarity, 0 to 1, of the answers' word counts
+	Similarity float64
+	// LengthDelta is the reference answer's length minus the production
+	// answer's, in characters
+	LengthDelta int
+	// MissingToolCalls are functions only the reference answer calls
+	MissingToolCalls []string
+	// ExtraToolCalls are functions only the production answer calls
+	ExtraToolCalls []string
+	// ArgumentMismatches are functions both answers call with different arguments
+	ArgumentMismatches    []string
+	FinishReason          string
+	ReferenceFinishReason string
+}
+
+// ToolCallsMatch reports whether both answers call the same functions with
+// the same arguments
+func (d *ResponseDiff) ToolCallsMatch() bool {
+	return len(d.MissingToolCalls) == 0 && len(d.ExtraToolCalls) == 0 && len(d.ArgumentMismatches) == 0
+}
+
+// Properties returns the diff as observability event properties
+func (d *ResponseDiff) Properties() map[string]any {
+	return map[string]any{
+		"similarity":              d.Similarity,
+		"length_delta":            d.LengthDelta,
+		"tool_calls_match":        d.ToolCallsMatch(),
+		"missing_tool_calls":      d.MissingToolCalls,
+		"extra_tool_calls":        d.ExtraToolCalls,
+		"argument_mismatches":     d.ArgumentMismatches,
+		"finish_reason":           d.FinishReason,
+		"reference_finish_reason": d.ReferenceFinishReason,
+	}
+}
+
+// CompareResponses compares the first choice of a production and a
+// reference Chat Completions response
+func CompareResponses(production, reference styles.PartialJSON) (*ResponseDiff, error) {
+	prod, err := firstChoice(production)
+	if err != nil {
+		return nil, fmt.Errorf("production response: %w", err)
+	}
+	ref, err := firstChoice(reference)
+	if err != nil {
+		return nil, fmt.Errorf("reference response: %w", err)
+	}
+
+	prodText, refText := messageText(prod.Message), messageText(ref.Message)
+	diff := &ResponseDiff{
+		Similarity:            textSimilarity(prodText, refText),
+		LengthDelta:           len([]rune(refText)) - len([]rune(prodText)),
+		FinishReason:          prod.FinishReason,
+		ReferenceFinishReason: ref.FinishReason,
+	}
+
+	prodCalls, refCalls := toolCallArguments(prod.Message), toolCallArguments(ref.Message)
+	for name, args := range refCalls {
+		prodArgs, ok := prodCalls[name]
+		switch {
+		case !ok:
+			diff.MissingToolCalls = append(diff.MissingToolCalls, name)
+		case !sameArguments(prodArgs, args):
+			diff.ArgumentMismatches = append(diff.ArgumentMismatches, name)
+		}
+	}
+	for name := range prodCalls {
+		if _, ok := refCalls[name]; !ok {
+			diff.ExtraToolCalls = append(diff.ExtraToolCalls, name)
+		}
+	}
+	for _, names := range [][]string{diff.MissingToolCalls, diff.ExtraToolCalls, diff.ArgumentMismatches} {
+		slices.Sort(names)
+	}
+	return diff, nil
+}
+
+func firstChoice(resJson styles.PartialJSON) (*styles.ChatCompletionsChoice, error) {
+	res, err := styles.ParseChatCompletionsResponse(resJson)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Choices) == 0 {
+		return nil, fmt.Errorf("no choices")
+	}
+	choice := res.Choices[0]
+	if choice.Message == nil {
+		choice.Message = &styles.ChatCompletionsMessage{}
+	}
+	return &choice, nil
+}
+
+// messageText returns the text of a message's string or multi-part content
+func messageText(m *styles.ChatCompletionsMessage) string {
+	switch c := m.Content.(type) {
+	case string:
+		return c
+	case []any:
+		var parts []string
+		for _, part := range c {
+			if p, ok := part.(map[string]any); ok {
+				if text, ok := p["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// toolCallArguments maps the functions a message calls to their arguments;
+// of repeated calls to one function the last is kept
+func toolCallArguments(m *styles.ChatCompletionsMessage) map[string]string {
+	calls := make(map[string]string, len(m.ToolCalls))
+	for _, call := range m.ToolCalls {
+		if call.Function != nil && call.Function.Name != "" {
+			calls[call.Function.Name] = call.Function.Arguments
+		}
+	}
+	return calls
+}
+
+// sameArguments compares tool call arguments as JSON, ignoring formatting
+// and key order, and as text when they aren't valid JSON
+func sameArguments(a, b string) bool {
+	var av, bv any
+	if json.Unmarshal([]byte(a), &av) != nil || json.Unmarshal([]byte(b), &bv) != nil {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// textSimilarity is the cosine similarity of the texts' lowercased word
+// counts: 1 for the same words, 0 for none in common. Two empty texts are
+// the same.
+func textSimilarity(a, b string) float64 {
+	aw, bw := wordCounts(a), wordCounts(b)
+	if len(aw) == 0 && len(bw) == 0 {
+		return 1
+	}
+	var dot, an, bn float64
+	for word, n := range aw {
+		dot += n * bw[word]
+		an += n * n
+	}
+	for _, n := range bw {
+		bn += n * n
+	}
+	if an == 0 || bn == 0 {
+		return 0
+	}
+	return min(dot/(math.Sqrt(an)*math.Sqrt(bn)), 1)
+}
+
+func wordCounts(text string) map[string]float64 {
+	counts := map[string]float64{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		counts[word]++
+	}
+	return counts
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestCompareResponses(t *testing.T) {
+	production, _ := styles.ParsePartialJSON([]byte(`{"choices": [{"message": {"role": "assistant",
+		"content": "The weather in Berlin is sunny.",
+		"tool_calls": [
+			{"id": "a", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\": \"Berlin\", \"unit\": \"c\"}"}},
+			{"id": "b", "type": "function", "function": {"name": "log", "arguments": "{}"}}
+		]}, "finish_reason": "tool_calls"}]}`))
+	reference, _ := styles.ParsePartialJSON([]byte(`{"choices": [{"message": {"role": "assistant",
+		"content": "The weather in Berlin is sunny today!",
+		"tool_calls": [
+			{"id": "c", "type": "function", "function": {"name": "get_weather", "arguments": "{\"unit\":\"c\",\"city\":\"Berlin\"}"}},
+			{"id": "d", "type": "function", "function": {"name": "get_time", "arguments": "{}"}}
+		]}, "finish_reason": "tool_calls"}]}`))
+
+	diff, err := CompareResponses(production, reference)
+	if err != nil {
+		t.Fatalf("CompareResponses: %v", err)
+	}
+	// 6 shared words of 6 and 7: 6 / sqrt(6 * 7)
+	if want := 6 / math.Sqrt(42); math.Abs(diff.Similarity-want) > 1e-9 {
+		t.Errorf("Similarity = %v, want %v", diff.Similarity, want)
+	}
+	if diff.LengthDelta != 6 {
+		t.Errorf("LengthDelta = %d, want 6", diff.LengthDelta)
+	}
+	// Arguments differing only in key order and spacing are the same
+	if !slices.Equal(diff.MissingToolCalls, []string{"get_time"}) || !slices.Equal(diff.ExtraToolCalls, []string{"log"}) ||
+		len(diff.ArgumentMismatches) != 0 || diff.ToolCallsMatch() {
+		t.Errorf("tool call differences = %+v", diff)
+	}
+
+	same, _ := CompareResponses(production, production)
+	if same.Similarity != 1 || same.LengthDelta != 0 || !same.ToolCallsMatch() {
+		t.Errorf("identical responses differ: %+v", same)
+	}
+
+	if _, err := CompareResponses(production, styles.PartialJSON{}); err == nil {
+		t.Error("expected an error for a reference response without choices")
+	}
+}
+
+func TestReferenceCompare_Sample(t *testing.T) {
+	c := &ReferenceCompare{Model: "openai/gpt-4.1", Rate: 1, Models: []string{"gpt-4o*"}}
+	for model, want := range map[string]bool{
+		"gpt-4o-mini":    true,
+		"claude-3-haiku": false, // not matching the models patterns
+		"openai/gpt-4.1": false, // the reference model itself
+	} {
+		req, _ := styles.ParsePartialJSON([]byte(`{"model": "` + model + `"}`))
+		if got := c.Sample(req); got != want {
+			t.Errorf("Sample(%s) = %v, want %v", model, got, want)
+		}
+	}
+	if (&ReferenceCompare{Model: "x", Rate: 1.5}).Validate() == nil {
+		t.Error("expected a rate above 1 to be rejected")
+	}
+}
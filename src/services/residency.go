@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ResidencyHeader lets clients require the regions their request may be
+// processed in, e.g. "eu" or "eu, ch"; it can only narrow down other
+// requirements
+const ResidencyHeader = "X-Data-Residency"
+
+// residencyRegionPattern matches region names such as eu, us-east or de-fra-1
+var residencyRegionPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ParseResidency parses a comma-separated list of regions; regions are
+// case-insensitive
+func ParseResidency(value string) ([]string, error) {
+	var regions []string
+	for _, region := range strings.Split(value, ",") {
+		region = strings.ToLower(strings.TrimSpace(region))
+		if region == "" {
+			continue
+		}
+		if err := ValidateResidencyRegion(region); err != nil {
+			return nil, err
+		}
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// ValidateResidencyRegion checks a region name
+func ValidateResidencyRegion(region string) error {
+	if !residencyRegionPattern.MatchString(region) {
+		return fmt.Errorf("invalid residency region '%s', expected lowercase words joined by '-', e.g. eu-west", region)
+	}
+	return nil
+}
+
+// InRegion reports whether a region is one of the required regions or lies
+// within one: "eu-west" lies within "eu", but not within "eu-north"
+func InRegion(region string, required []string) bool {
+	return slices.ContainsFunc(required, func(r string) bool {
+		return region == r || strings.HasPrefix(region, r+"-")
+	})
+}
+
+// MeetsResidency reports whether the provider may process requests with the
+// residency requirements: for each requirement, one of its regions must be
+// in the required ones. Untagged providers meet no requirement.
+func (p *ProviderService) MeetsResidency(requirements [][]string) bool {
+	for _, required := range requirements {
+		if !slices.ContainsFunc(p.Regions, func(region string) bool { return InRegion(region, required) }) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestProviderService_MeetsResidency(t *testing.T) {
+	required, err := ParseResidency(" EU, ch ,")
+	if err != nil || len(required) != 2 || required[0] != "eu" || required[1] != "ch" {
+		t.Fatalf("ParseResidency = %v, %v", required, err)
+	}
+	if _, err := ParseResidency("eu west"); err == nil {
+		t.Error("expected an invalid region to be rejected")
+	}
+
+	for _, tc := range []struct {
+		regions      []string
+		requirements [][]string
+		want         bool
+	}{
+		{[]string{"eu-west-1"}, [][]string{required}, true},
+		{[]string{"ch"}, [][]string{required}, true},
+		{[]string{"europe"}, [][]string{required}, false},
+		{[]string{"us", "eu-north"}, [][]string{required, {"eu-west"}}, false},
+		{[]string{"eu-west-2"}, [][]string{required, {"eu-west"}}, true},
+		{nil, [][]string{required}, false},
+		{nil, nil, true},
+	} {
+		p := &ProviderService{Regions: tc.regions}
+		if got := p.MeetsResidency(tc.requirements); got != tc.want {
+			t.Errorf("regions %v, requirements %v: MeetsResidency = %v, want %v", tc.regions, tc.requirements, got, tc.want)
+		}
+	}
+}
@@ -1,11 +1,23 @@
 package services
 
-import "net/http"
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
 
-// ResponseCaptureWriter captures response instead of writing to HTTP
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// ResponseCaptureWriter captures response instead of writing to HTTP.
+// It keeps the status, headers and the full body, including every event of a
+// streamed response.
 type ResponseCaptureWriter struct {
 	Response []byte
 	Headers  http.Header
+	Status   int // 0 until WriteHeader or Write is called
 }
 
 func (w *ResponseCaptureWriter) Header() http.Header {
@@ -16,10 +28,64 @@ func (w *ResponseCaptureWriter) Header() http.Header {
 }
 
 func (w *ResponseCaptureWriter) Write(data []byte) (int, error) {
-	w.Response = data
+	if w.Status == 0 {
+		w.Status = http.StatusOK
+	}
+	w.Response = append(w.Response, data...)
 	return len(data), nil
 }
 
 func (w *ResponseCaptureWriter) WriteHeader(statusCode int) {
-	// Ignore for capture
+	if w.Status == 0 {
+		w.Status = statusCode
+	}
 }
+
+// Flush lets streaming handlers write to the capture; the body is kept in memory
+func (w *ResponseCaptureWriter) Flush() {}
+
+// Streamed reports whether the handler answered with an event stream
+func (w *ResponseCaptureWriter) Streamed() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+// JSON returns the captured response as JSON. A streamed chat completion is
+// reassembled into the response a non-streaming request would have returned;
+// an error event in the stream is returned as an error.
+func (w *ResponseCaptureWriter) JSON() (styles.PartialJSON, error) {
+	if !w.Streamed() {
+		if w.Response == nil {
+			return nil, nil
+		}
+		return styles.ParsePartialJSON(w.Response)
+	}
+
+	var chunks []styles.PartialJSON
+	for event := range sse.NewDefaultReader(bytes.NewReader(w.Response)).ReadEvents() {
+		if event.Error != nil {
+			return nil, errs.Wrap(errs.ErrUpstream, event.Error)
+		}
+		if event.Done || event.Name != "" {
+			// Named events are router side channels, not completion chunks
+			continue
+		}
+		chunk, err := styles.ParsePartialJSON(event.Data)
+		if err != nil {
+			return nil, errs.Wrap(errs.ErrUpstream, err)
+		}
+		if raw, ok := chunk["error"]; ok && len(chunk) == 1 {
+			var message string
+			if json.Unmarshal(raw, &message) != nil {
+				message = string(raw)
+			}
+			return nil, errs.Errorf(errs.ErrUpstream, "stream error: %s", message)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+	return styles.AssembleChatCompletionsStream(chunks)
+}
+
+var _ http.Flusher = (*ResponseCaptureWriter)(nil)
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/sse"
+)
+
+func TestResponseCaptureWriter_KeepsStatusAndFullBody(t *testing.T) {
+	w := &ResponseCaptureWriter{}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTeapot)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(`{"id":`))
+	_, _ = w.Write([]byte(`"x"}`))
+
+	if w.Status != http.StatusTeapot {
+		t.Errorf("expected first status to win, got %d", w.Status)
+	}
+	res, err := w.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res["id"]) != `"x"` {
+		t.Errorf("expected body written in two parts, got %s", w.Response)
+	}
+
+	implicit := &ResponseCaptureWriter{}
+	_, _ = implicit.Write([]byte("{}"))
+	if implicit.Status != http.StatusOK {
+		t.Errorf("expected implicit 200, got %d", implicit.Status)
+	}
+}
+
+func TestResponseCaptureWriter_ReassemblesStream(t *testing.T) {
+	w := &ResponseCaptureWriter{}
+	sw := sse.NewWriter(w)
+	chunks := []string{
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{"content":"lo","reasoning_content":"think"}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":1,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get","arguments":"{\"a\""}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":1,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":1}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+	}
+	for _, c := range chunks {
+		_ = sw.WriteRaw([]byte(c))
+	}
+	_ = sw.WriteEvent("router.progress", []byte(`{"step":1}`))
+	_ = sw.WriteDone()
+
+	if !w.Streamed() {
+		t.Fatal("expected stream to be detected")
+	}
+	res, err := w.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Choices []struct {
+			Index   int `json:"index"`
+			Message struct {
+				Role             string  `json:"role"`
+				Content          *string `json:"content"`
+				ReasoningContent string  `json:"reasoning_content"`
+				ToolCalls        []struct {
+					ID       string `json:"id"`
+					Type     string `json:"type"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	data, _ := res.Marshal()
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != "c1" || got.Object != "chat.completion" || got.Usage.TotalTokens != 5 || len(got.Choices) != 2 {
+		t.Fatalf("unexpected response %s", data)
+	}
+	first := got.Choices[0]
+	if first.Message.Content == nil || *first.Message.Content != "Hello" || first.Message.ReasoningContent != "think" || first.FinishReason != "stop" {
+		t.Errorf("unexpected first choice %s", data)
+	}
+	second := got.Choices[1]
+	if second.Message.Content != nil || second.Message.Role != "assistant" || second.FinishReason != "tool_calls" {
+		t.Errorf("unexpected second choice %s", data)
+	}
+	if len(second.Message.ToolCalls) != 1 {
+		t.Fatalf("expected one tool call, got %s", data)
+	}
+	call := second.Message.ToolCalls[0]
+	if call.ID != "call_1" || call.Type != "function" || call.Function.Name != "get" || call.Function.Arguments != `{"a":1}` {
+		t.Errorf("unexpected tool call %+v", call)
+	}
+}
+
+func TestResponseCaptureWriter_StreamErrorEvent(t *testing.T) {
+	w := &ResponseCaptureWriter{}
+	sw := sse.NewWriter(w)
+	_ = sw.WriteRaw([]byte(`{"id":"c1","choices":[{"index":0,"delta":{"content":"partial"}}]}`))
+	_ = sw.WriteError("upstream reset")
+
+	_, err := w.JSON()
+	if !errors.Is(err, errs.ErrUpstream) {
+		t.Fatalf("expected upstream error, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Retention is how long the router keeps the data it stores
+type Retention struct {
+	// Captures is how long objects in the tee store are kept; zero keeps
+	// them until the bucket's own lifecycle rules remove them
+	Captures time.Duration
+	// Usage is how long usage ledger hours are kept (default: 35 days)
+	Usage time.Duration
+}
+
+var retention atomic.Pointer[Retention]
+
+// SetRetention sets the process-wide retention; nil restores the defaults
+func SetRetention(r *Retention) { retention.Store(r) }
+
+// ClearRetention restores the defaults if r is still the configured
+// retention, so a stopping config doesn't clear the one replacing it
+func ClearRetention(r *Retention) { retention.CompareAndSwap(r, nil) }
+
+// UsageRetention returns how long usage ledger hours are kept
+func UsageRetention() time.Duration {
+	if r := retention.Load(); r != nil && r.Usage > 0 {
+		return r.Usage
+	}
+	return defaultUsageRetention
+}
+
+// PurgeCaptures removes the objects of a store older than the retention,
+// returning how many it removed
+func PurgeCaptures(ctx context.Context, store *ObjectStore, retention time.Duration, now time.Time) (int, error) {
+	cutoff := now.Add(-retention)
+	return store.DeleteMatching(ctx, "", func(object ObjectInfo) bool {
+		return !object.LastModified.Before(cutoff)
+	})
+}
+
+// RunCapturePurge purges captures older than the retention every interval
+// until ctx is done
+func RunCapturePurge(ctx context.Context, store *ObjectStore, retention, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := PurgeCaptures(ctx, store, retention, time.Now())
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("capture purge failed", zap.Int("deleted", deleted), zap.Error(err))
+		} else if deleted > 0 {
+			logger.Info("purged expired captures", zap.Int("deleted", deleted))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
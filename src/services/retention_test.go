@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPurgeCaptures(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	objects := map[string]time.Time{
+		"router/old/span.json":                now.Add(-48 * time.Hour),
+		"router/tenants/acme/trace/span.json": now.Add(-72 * time.Hour),
+		"router/new/span.json":                now.Add(-time.Hour),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/traces" && r.URL.Query().Get("list-type") == "2":
+			// One object per page, to follow continuation tokens
+			var keys []string
+			for key := range objects {
+				if strings.HasPrefix(key, r.URL.Query().Get("prefix")) && key > r.URL.Query().Get("continuation-token") {
+					keys = append(keys, key)
+				}
+			}
+			slices.Sort(keys)
+			fmt.Fprint(w, `<ListBucketResult>`)
+			if len(keys) > 0 {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><LastModified>%s</LastModified></Contents>`, keys[0], objects[keys[0]].Format(time.RFC3339))
+			}
+			if len(keys) > 1 {
+				fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>`, keys[0])
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+		case r.Method == http.MethodDelete:
+			delete(objects, strings.TrimPrefix(r.URL.Path, "/traces/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewObjectStore(ObjectStoreConfig{Endpoint: server.URL, Bucket: "traces", Prefix: "router/"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	deleted, err := store.DeleteMatching(context.Background(), TenantObjectPrefix("acme"), nil)
+	if err != nil || deleted != 1 {
+		t.Fatalf("tenant erasure deleted %d objects (%v), want 1", deleted, err)
+	}
+	deleted, err = PurgeCaptures(context.Background(), store, 24*time.Hour, now)
+	if err != nil || deleted != 1 {
+		t.Fatalf("purge deleted %d objects (%v), want 1", deleted, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := objects["router/new/span.json"]; !ok || len(objects) != 1 {
+		t.Errorf("expected only the recent capture to remain, got %v", objects)
+	}
+}
+
+func TestUsageLedger_Erase(t *testing.T) {
+	now := time.Now()
+	ledger := &UsageLedger{Store: NewMemoryStateStore(), Prefix: "r:"}
+	for _, tenant := range []string{"acme", "globex"} {
+		for _, at := range []time.Time{now, now.Add(-30 * 24 * time.Hour)} {
+			if err := ledger.Record(tenant, UsageTotals{Requests: 1, InputTokens: 10}, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	erased, err := ledger.Erase("acme", now)
+	if err != nil || erased != 2 {
+		t.Fatalf("Erase = %d, %v; want 2 hours", erased, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if totals, _ := ledger.Hour("acme", now.Truncate(time.Hour)); totals.Requests != 0 {
+		t.Errorf("expected acme's usage to be erased, got %+v", totals)
+	}
+	if totals, _ := ledger.Hour("globex", now.Truncate(time.Hour)); totals.Requests != 1 {
+		t.Errorf("expected globex's usage to be kept, got %+v", totals)
+	}
+}
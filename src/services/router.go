@@ -12,4 +12,40 @@ type RouterService struct {
 	Auth   AuthService
 	Mu     sync.RWMutex
 	Logger *zap.Logger
+	// Policy is enforced on every request before provider dispatch
+	Policy *Policy
+	// Headers selects the upstream response headers passed on to clients
+	Headers *HeaderPolicy
+	// PosthogProject names the PostHog project receiving the router's events
+	// when no project is selected by the request's key
+	PosthogProject string
+	// Sinks receive the router's observability events; nil means the
+	// default sinks
+	Sinks []ObservabilitySink
+	// StageLimits guards plugin and conversion stages; nil disables them
+	StageLimits *StageLimits
+	// GeoIP finds the country of clients for the policy; nil leaves it unknown
+	GeoIP *GeoIP
+	// RateLimits limits incoming requests; nil disables rate limiting
+	RateLimits *TokenBuckets
+	// Quotas enforces plans; nil disables quotas
+	Quotas *Quotas
+	// Usage aggregates usage per tenant for billing; nil disables it
+	Usage *UsageLedger
+	// Prompts is the router's prompt library
+	Prompts *PromptLibrary
+	// Compare replays sampled requests against a reference model; nil
+	// disables it
+	Compare *ReferenceCompare
+	// Metrics aggregates the router's generations for the leaderboard
+	Metrics *Metrics
+	// Fingerprints counts the router's requests per prompt fingerprint for
+	// the fingerprint plugin
+	Fingerprints *FingerprintTracker
+	// Resume issues and redeems resume tokens of failed streams; nil
+	// disables them
+	Resume *StreamResume
+	// Partials keeps the partial responses of streams whose clients
+	// disconnected; nil disables them
+	Partials *PartialResponses
 }
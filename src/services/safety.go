@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// Safety levels, from the most permissive to the strictest
+const (
+	SafetyOff      = "off"
+	SafetyRelaxed  = "relaxed"
+	SafetyStandard = "standard"
+	SafetyStrict   = "strict"
+)
+
+var safetyLevels = []string{SafetyOff, SafetyRelaxed, SafetyStandard, SafetyStrict}
+
+// Safety dialects: how a provider is told the safety level of a request
+const (
+	// SafetyDialectSystem adds a system message with the level's guidance
+	// (default; suits Anthropic models and any OpenAI-compatible server)
+	SafetyDialectSystem = "system"
+	// SafetyDialectOpenAI sets safety_identifier to a hash of the caller,
+	// besides the guidance, as OpenAI has no per-request level
+	SafetyDialectOpenAI = "openai"
+	// SafetyDialectGemini sets safety_settings thresholds on Gemini's
+	// OpenAI-compatible endpoint
+	SafetyDialectGemini = "gemini"
+	// SafetyDialectMistral sets safe_prompt
+	SafetyDialectMistral = "mistral"
+	// SafetyDialectNone passes nothing on
+	SafetyDialectNone = "none"
+)
+
+// SafetyHeader lets clients ask for a stricter safety level than their policy
+const SafetyHeader = "X-Safety-Level"
+
+// safetyGuidance is the system message sent for a level; permissive levels send none
+var safetyGuidance = map[string]string{
+	SafetyStandard: "Follow standard content safety rules: decline requests for content that is hateful, harassing, " +
+		"sexually explicit or that helps cause serious harm.",
+	SafetyStrict: "Follow strict content safety rules: decline requests for content that is hateful, harassing, " +
+		"sexual, violent or dangerous, and keep every answer suitable for all audiences.",
+}
+
+// geminiHarmCategories are the categories Gemini's safety_settings configure
+var geminiHarmCategories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+}
+
+// geminiThresholds maps levels to Gemini block thresholds
+var geminiThresholds = map[string]string{
+	SafetyOff:      "BLOCK_NONE",
+	SafetyRelaxed:  "BLOCK_ONLY_HIGH",
+	SafetyStandard: "BLOCK_MEDIUM_AND_ABOVE",
+	SafetyStrict:   "BLOCK_LOW_AND_ABOVE",
+}
+
+// ValidSafetyLevel reports whether level is a known safety level
+func ValidSafetyLevel(level string) bool {
+	return slices.Contains(safetyLevels, level)
+}
+
+// ValidSafetyDialect reports whether dialect is a known safety dialect
+func ValidSafetyDialect(dialect string) bool {
+	switch dialect {
+	case "", SafetyDialectSystem, SafetyDialectOpenAI, SafetyDialectGemini, SafetyDialectMistral, SafetyDialectNone:
+		return true
+	}
+	return false
+}
+
+// StricterSafety returns the stricter of two levels; "" is no level
+func StricterSafety(a, b string) string {
+	if slices.Index(safetyLevels, b) > slices.Index(safetyLevels, a) {
+		return b
+	}
+	return a
+}
+
+// SafetyLevel returns the strictest safety level of the rules applying to the
+// request, or "" when no rule sets one
+func (p *Policy) SafetyLevel(keyID string, reqJson styles.PartialJSON) string {
+	if p == nil {
+		return ""
+	}
+	model := requestModel(reqJson)
+	level := ""
+	for _, rule := range p.Rules {
+		if rule.Safety != "" && rule.appliesTo(keyID, model) {
+			level = StricterSafety(level, rule.Safety)
+		}
+	}
+	return level
+}
+
+// ApplySafety returns the request carrying the safety level in the provider's
+// dialect. caller identifies the end user or key for providers tracking
+// abuse per user; it is only sent hashed. Fields the client set are kept.
+func (p *ProviderService) ApplySafety(reqJson styles.PartialJSON, level, caller string) (styles.PartialJSON, error) {
+	if level == "" || p.SafetyDialect == SafetyDialectNone {
+		return reqJson, nil
+	}
+	res := reqJson.Clone()
+
+	switch p.SafetyDialect {
+	case SafetyDialectGemini:
+		extraBody := map[string]json.RawMessage{}
+		if raw, ok := res["extra_body"]; ok {
+			if err := json.Unmarshal(raw, &extraBody); err != nil {
+				return nil, fmt.Errorf("invalid extra_body: %w", err)
+			}
+		}
+		google := map[string]any{}
+		if raw, ok := extraBody["google"]; ok {
+			if err := json.Unmarshal(raw, &google); err != nil {
+				return nil, fmt.Errorf("invalid extra_body.google: %w", err)
+			}
+		}
+		if _, ok := google["safety_settings"]; ok {
+			return reqJson, nil
+		}
+		settings := make([]map[string]string, len(geminiHarmCategories))
+		for i, category := range geminiHarmCategories {
+			settings[i] = map[string]string{"category": category, "threshold": geminiThresholds[level]}
+		}
+		google["safety_settings"] = settings
+		extraBody["google"], _ = json.Marshal(google)
+		return res, res.Set("extra_body", extraBody)
+	case SafetyDialectMistral:
+		if _, ok := res["safe_prompt"]; !ok {
+			if err := res.Set("safe_prompt", level == SafetyStandard || level == SafetyStrict); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case SafetyDialectOpenAI:
+		if _, ok := res["safety_identifier"]; !ok && caller != "" {
+			sum := sha256.Sum256([]byte(caller))
+			if err := res.Set("safety_identifier", hex.EncodeToString(sum[:16])); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	guidance, ok := safetyGuidance[level]
+	if !ok {
+		return res, nil
+	}
+	var messages []json.RawMessage
+	if raw, ok := res["messages"]; ok {
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return nil, fmt.Errorf("invalid messages: %w", err)
+		}
+	}
+	system, err := json.Marshal(styles.ChatCompletionsMessage{Role: "system", Content: guidance})
+	if err != nil {
+		return nil, err
+	}
+	return res, res.Set("messages", append([]json.RawMessage{system}, messages...))
+}
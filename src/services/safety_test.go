@@ -0,0 +1,66 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestPolicy_SafetyLevel(t *testing.T) {
+	policy := &Policy{Rules: []*PolicyRule{
+		{Safety: SafetyStandard},
+		{Keys: []string{"kids-*"}, Safety: SafetyStrict},
+		{Keys: []string{"research"}, Safety: SafetyRelaxed},
+	}}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "openai/gpt-4.1"}`))
+	for key, want := range map[string]string{"kids-app": SafetyStrict, "research": SafetyStandard, "other": SafetyStandard} {
+		if got := policy.SafetyLevel(key, req); got != want {
+			t.Errorf("SafetyLevel(%s) = %q, want %q", key, got, want)
+		}
+	}
+	if err := (&Policy{Rules: []*PolicyRule{{Safety: "paranoid"}}}).Validate(); err == nil {
+		t.Error("expected an unknown level to be rejected")
+	}
+}
+
+func TestProviderService_ApplySafety(t *testing.T) {
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "messages": [{"role": "user", "content": "hi"}]}`))
+
+	// Default dialect: guidance as a leading system message
+	out, err := (&ProviderService{}).ApplySafety(req, SafetyStrict, "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []styles.ChatCompletionsMessage
+	_ = json.Unmarshal(out["messages"], &messages)
+	if len(messages) != 2 || messages[0].Role != "system" || !strings.Contains(messages[0].Content.(string), "strict") {
+		t.Errorf("messages = %s", out["messages"])
+	}
+	if _, ok := req["safety_identifier"]; ok || len(req["messages"]) != len(`[{"role": "user", "content": "hi"}]`) {
+		t.Error("expected the original request to be left unchanged")
+	}
+
+	out, _ = (&ProviderService{SafetyDialect: SafetyDialectOpenAI}).ApplySafety(req, SafetyStandard, "key-1")
+	if id := styles.TryGetFromPartialJSON[string](out, "safety_identifier"); len(id) != 32 || strings.Contains(id, "key-1") {
+		t.Errorf("safety_identifier = %q, want a hash of the caller", id)
+	}
+
+	out, _ = (&ProviderService{SafetyDialect: SafetyDialectGemini}).ApplySafety(req, SafetyRelaxed, "")
+	if !strings.Contains(string(out["extra_body"]), `"threshold":"BLOCK_ONLY_HIGH"`) || len(out["messages"]) != len(req["messages"]) {
+		t.Errorf("gemini extra_body = %s", out["extra_body"])
+	}
+
+	out, _ = (&ProviderService{SafetyDialect: SafetyDialectMistral}).ApplySafety(req, SafetyStandard, "")
+	if !styles.TryGetFromPartialJSON[bool](out, "safe_prompt") {
+		t.Error("expected safe_prompt for mistral")
+	}
+
+	if out, _ := (&ProviderService{SafetyDialect: SafetyDialectNone}).ApplySafety(req, SafetyStrict, "k"); len(out) != len(req) {
+		t.Error("expected the none dialect to pass nothing on")
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var envPlaceholder = regexp.MustCompile(`\{env\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// secretHTTPClient is used for secret-store lookups at provision time
+var secretHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// ResolveSecret expands a configuration value at provision time.
+//
+// Supported forms:
+//   - "{env.NAME}" placeholders anywhere in the value
+//   - "file:///path/to/secret" reads the file (surrounding whitespace trimmed)
+//   - "vault://<path>#<field>" reads a field from HashiCorp Vault using VAULT_ADDR
+//     and VAULT_TOKEN (KV v2 and v1 responses are supported)
+//
+// Values without any of these forms are returned unchanged.
+func ResolveSecret(value string) (string, error) {
+	var missing []string
+	value = envPlaceholder.ReplaceAllStringFunc(value, func(m string) string {
+		name := envPlaceholder.FindStringSubmatch(m)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable(s) not set: %s", strings.Join(missing, ", "))
+	}
+
+	switch {
+	case strings.HasPrefix(value, "file://"):
+		data, err := os.ReadFile(strings.TrimPrefix(value, "file://"))
+		if err != nil {
+			return "", fmt.Errorf("reading secret file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(value, "vault://"):
+		return resolveVaultSecret(strings.TrimPrefix(value, "vault://"))
+	}
+
+	return value, nil
+}
+
+// IsSecretReference reports whether the value is resolved by ResolveSecret
+func IsSecretReference(value string) bool {
+	return envPlaceholder.MatchString(value) ||
+		strings.HasPrefix(value, "file://") ||
+		strings.HasPrefix(value, "vault://")
+}
+
+// RedactSecret masks a secret for logging, keeping only a short suffix
+func RedactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 8 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+func resolveVaultSecret(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault reference must be vault://<path>#<field>")
+	}
+
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set to resolve vault references")
+	}
+
+	req, err := http.NewRequest("GET", addr+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	res, err := secretHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d for %s", res.StatusCode, path)
+	}
+
+	var payload struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", fmt.Errorf("vault response: %w", err)
+	}
+
+	// KV v2 nests the secret under data.data
+	data := payload.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %s", path, field)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s field %s is not a string", path, field)
+	}
+	return s, nil
+}
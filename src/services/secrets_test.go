@@ -0,0 +1,62 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("ROUTER_TEST_KEY", "sk-test-123")
+
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(secretFile, []byte("sk-from-file\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain value", input: "https://api.openai.com/v1", want: "https://api.openai.com/v1"},
+		{name: "env placeholder", input: "{env.ROUTER_TEST_KEY}", want: "sk-test-123"},
+		{name: "env inside value", input: "https://host/{env.ROUTER_TEST_KEY}/v1", want: "https://host/sk-test-123/v1"},
+		{name: "missing env", input: "{env.ROUTER_TEST_MISSING}", wantErr: true},
+		{name: "file reference", input: "file://" + secretFile, want: "sk-from-file"},
+		{name: "missing file", input: "file://" + filepath.Join(dir, "nope"), wantErr: true},
+		{name: "malformed vault reference", input: "vault://secret/data/openai", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveSecret(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ResolveSecret(%q) expected error, got %q", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveSecret(%q) failed: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveSecret(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactSecret(t *testing.T) {
+	if got := RedactSecret("sk-1234567890abcd"); got != "****abcd" {
+		t.Errorf("RedactSecret = %q, want ****abcd", got)
+	}
+	if got := RedactSecret("short"); got != "****" {
+		t.Errorf("RedactSecret = %q, want ****", got)
+	}
+	if got := RedactSecret(""); got != "" {
+		t.Errorf("RedactSecret = %q, want empty", got)
+	}
+}
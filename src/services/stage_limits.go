@@ -0,0 +1,92 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Request stages guarded by StageLimits
+const (
+	StageBefore     = "before"     // a Before plugin rewrote the request
+	StageAfter      = "after"      // an After plugin rewrote the response
+	StageChunk      = "chunk"      // a stream chunk plugin rewrote a chunk
+	StageConversion = "conversion" // a request or response changed API style
+)
+
+// StageLimits caps the size and duration of the stages of a request, to catch
+// pathological plugins such as a summarizer ballooning the request. Zero
+// values disable a limit.
+type StageLimits struct {
+	// MaxRequestBytes caps the request after each Before plugin
+	MaxRequestBytes int
+	// MaxResponseBytes caps the response, or stream chunk, after each plugin
+	MaxResponseBytes int
+	// MaxPluginTime caps the time a single plugin hook may take
+	MaxPluginTime time.Duration
+	// MaxConversionTime caps converting a request or response between styles
+	MaxConversionTime time.Duration
+}
+
+// stageViolations counts stage limit violations per stage, see StageLimitViolations
+var stageViolations sync.Map // stage -> *atomic.Int64
+
+// StageLimitViolations returns how many requests failed each stage limit so
+// far, process-wide
+func StageLimitViolations() map[string]int64 {
+	counts := map[string]int64{}
+	stageViolations.Range(func(stage, n any) bool {
+		counts[stage.(string)] = n.(*atomic.Int64).Load()
+		return true
+	})
+	return counts
+}
+
+// CheckStage fails with errs.ErrStageLimit when a stage took longer or left a
+// larger body than the router's stage limits allow. name identifies what ran
+// (a plugin name, or "request"/"response" for conversions); body may be nil
+// when only the duration is guarded. Violations are logged, counted and sent
+// to the router's observability sinks as ai_stage_limit events.
+func (r *RouterService) CheckStage(stage, name string, elapsed time.Duration, body styles.PartialJSON) error {
+	if r == nil || r.StageLimits == nil {
+		return nil
+	}
+	l := r.StageLimits
+
+	maxTime, maxBytes := l.MaxPluginTime, 0
+	switch stage {
+	case StageBefore:
+		maxBytes = l.MaxRequestBytes
+	case StageAfter, StageChunk:
+		maxBytes = l.MaxResponseBytes
+	case StageConversion:
+		maxTime = l.MaxConversionTime
+	}
+
+	var err error
+	props := map[string]any{"stage": stage, "name": name}
+	if maxTime > 0 && elapsed > maxTime {
+		props["limit_ms"], props["elapsed_ms"] = maxTime.Milliseconds(), elapsed.Milliseconds()
+		err = errs.Errorf(errs.ErrStageLimit, "%s stage %s took %s (limit %s)", stage, name, elapsed.Round(time.Millisecond), maxTime)
+	} else if maxBytes > 0 && body != nil {
+		if size := body.Size(); size > maxBytes {
+			props["limit_bytes"], props["bytes"] = maxBytes, size
+			err = errs.Errorf(errs.ErrStageLimit, "%s stage %s produced %d bytes (limit %d)", stage, name, size, maxBytes)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	n, _ := stageViolations.LoadOrStore(stage, &atomic.Int64{})
+	n.(*atomic.Int64).Add(1)
+	if r.Logger != nil {
+		r.Logger.Warn("stage limit exceeded", zap.String("stage", stage), zap.String("name", name), zap.Error(err))
+	}
+	_ = EmitObservabilityEvent(r, ObservabilityEvent{Name: "ai_stage_limit", Project: r.PosthogProject, Properties: props})
+	return err
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// memorySink keeps the events it receives
+type memorySink struct {
+	mu     sync.Mutex
+	events []ObservabilityEvent
+}
+
+func (s *memorySink) Send(event ObservabilityEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestCheckStage(t *testing.T) {
+	sink := &memorySink{}
+	router := &RouterService{
+		Sinks: []ObservabilitySink{sink},
+		StageLimits: &StageLimits{
+			MaxRequestBytes:   64,
+			MaxPluginTime:     time.Second,
+			MaxConversionTime: 10 * time.Millisecond,
+		},
+	}
+	small := styles.PartialJSON{"model": []byte(`"gpt"`)}
+	large := styles.PartialJSON{"messages": []byte(`"` + strings.Repeat("x", 100) + `"`)}
+
+	if err := router.CheckStage(StageBefore, "summarize", time.Millisecond, small); err != nil {
+		t.Errorf("unexpected error for a small request: %v", err)
+	}
+	// The response size is not limited
+	if err := router.CheckStage(StageAfter, "summarize", time.Millisecond, large); err != nil {
+		t.Errorf("unexpected error for an unlimited stage: %v", err)
+	}
+
+	before := StageLimitViolations()[StageBefore]
+	err := router.CheckStage(StageBefore, "summarize", time.Millisecond, large)
+	if !errors.Is(err, errs.ErrStageLimit) || !strings.Contains(err.Error(), "summarize") {
+		t.Fatalf("expected stage limit error naming the plugin, got %v", err)
+	}
+	if got := StageLimitViolations()[StageBefore]; got != before+1 {
+		t.Errorf("expected violation count %d, got %d", before+1, got)
+	}
+
+	// Conversions use their own time limit
+	if err := router.CheckStage(StageConversion, "request", 50*time.Millisecond, nil); !errors.Is(err, errs.ErrStageLimit) {
+		t.Errorf("expected conversion time violation, got %v", err)
+	}
+	if err := router.CheckStage(StageChunk, "fuzz", 50*time.Millisecond, nil); err != nil {
+		t.Errorf("unexpected error under the plugin time limit: %v", err)
+	}
+
+	if len(sink.events) != 2 || sink.events[0].Name != "ai_stage_limit" || sink.events[0].Properties["bytes"] != large.Size() {
+		t.Errorf("unexpected events %+v", sink.events)
+	}
+
+	var unlimited *RouterService
+	if err := unlimited.CheckStage(StageBefore, "summarize", time.Hour, large); err != nil {
+		t.Errorf("expected no limits on a nil router, got %v", err)
+	}
+}
+
+func TestPartialJSONSize(t *testing.T) {
+	for _, pj := range []styles.PartialJSON{
+		{},
+		{"a": []byte("1")},
+		{"model": []byte(`"gpt"`), "messages": []byte(`[{"role":"user","content":"hi"}]`)},
+	} {
+		data, _ := pj.Marshal()
+		if pj.Size() != len(data) {
+			t.Errorf("Size() = %d, marshaled %d bytes (%s)", pj.Size(), len(data), data)
+		}
+	}
+}
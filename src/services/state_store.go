@@ -0,0 +1,145 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+var stateStoreRegistry sync.Map
+
+// StateStore holds state shared by the router instances serving the same
+// clients, such as rate-limit buckets. The in-memory store only shares state
+// within a process. The `state_store` option of the `ai` app names stores
+// opened from a DSN, such as a bolt file surviving restarts; multi-instance
+// deployments register a store backed by a shared database under a name.
+// Modules select a store by name with their store option.
+type StateStore interface {
+	// Update atomically reads the values of keys (nil when missing or
+	// expired), passes them to fn and stores the values fn returns, which
+	// expire after ttl. Nothing is stored when fn returns an error.
+	Update(keys []string, ttl time.Duration, fn func(values [][]byte) ([][]byte, error)) error
+}
+
+// StateReader is implemented by state stores reading more cheaply than
+// through Update, e.g. without taking a write transaction
+type StateReader interface {
+	// Read returns the values of keys, nil when missing or expired
+	Read(keys []string) ([][]byte, error)
+}
+
+// ReadState returns the values of keys in a store, nil when missing or
+// expired, through the store's Read when it has one
+func ReadState(s StateStore, keys []string) ([][]byte, error) {
+	if r, ok := s.(StateReader); ok {
+		return r.Read(keys)
+	}
+	var values [][]byte
+	err := s.Update(keys, 0, func(read [][]byte) ([][]byte, error) {
+		values = read
+		return nil, nil
+	})
+	return values, err
+}
+
+// RegisterStateStore registers a state store by name
+func RegisterStateStore(name string, s StateStore) {
+	stateStoreRegistry.Store(strings.ToLower(name), s)
+}
+
+// UnregisterStateStore removes the state store registered by name, if it is
+// still s, so a stopping config doesn't remove the store of the config
+// replacing it
+func UnregisterStateStore(name string, s StateStore) {
+	stateStoreRegistry.CompareAndDelete(strings.ToLower(name), s)
+}
+
+// LookupStateStore retrieves a state store by name, reporting whether it is
+// registered; "" and "memory" name the process-wide in-memory store
+func LookupStateStore(name string) (StateStore, bool) {
+	if name == "" || strings.EqualFold(name, "memory") {
+		return defaultStateStore, true
+	}
+	v, ok := stateStoreRegistry.Load(strings.ToLower(name))
+	if !ok {
+		return nil, false
+	}
+	s, ok := v.(StateStore)
+	return s, ok
+}
+
+var defaultStateStore = NewMemoryStateStore()
+
+// IsPersistentStateStore reports whether a store keeps its state across
+// restarts, i.e. isn't an in-memory store
+func IsPersistentStateStore(s StateStore) bool {
+	_, memory := s.(*MemoryStateStore)
+	return !memory
+}
+
+// MemoryStateStore is a StateStore local to the process
+type MemoryStateStore struct {
+	mu      sync.Mutex
+	entries map[string]stateEntry
+	updates int // expired entries are swept every few thousand updates
+}
+
+type stateEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryStateStore returns an empty in-memory state store
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{entries: make(map[string]stateEntry)}
+}
+
+func (s *MemoryStateStore) Update(keys []string, ttl time.Duration, fn func(values [][]byte) ([][]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+			values[i] = e.value
+		}
+	}
+	updated, err := fn(values)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if i < len(updated) && updated[i] != nil {
+			s.entries[key] = stateEntry{value: updated[i], expires: now.Add(ttl)}
+		}
+	}
+
+	if s.updates++; s.updates%4096 == 0 {
+		for key, e := range s.entries {
+			if !now.Before(e.expires) {
+				delete(s.entries, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStateStore) Read(keys []string) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+			values[i] = e.value
+		}
+	}
+	return values, nil
+}
+
+var (
+	_ StateStore  = (*MemoryStateStore)(nil)
+	_ StateReader = (*MemoryStateStore)(nil)
+)
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// stateBucket is the bucket of a bolt database holding state entries
+var stateBucket = []byte("state")
+
+// BoltStateStore is a StateStore kept in a bolt database file, so state such
+// as API keys and quota counters survives restarts. The file is locked by
+// one process at a time: instances on several hosts need a store backed by a
+// shared database instead.
+type BoltStateStore struct {
+	file   *boltFile
+	closed sync.Once
+}
+
+// boltFile is a bolt database open in the process, shared by its stores
+type boltFile struct {
+	db      *bolt.DB
+	path    string
+	refs    int // guarded by openBoltFilesMu
+	updates int // guarded by the write transaction; expired entries are swept every few thousand updates
+}
+
+// openBoltFiles are the bolt databases open in the process by path; a config
+// reload opens the file again before the old config closes it
+var (
+	openBoltFilesMu sync.Mutex
+	openBoltFiles   = map[string]*boltFile{}
+)
+
+// OpenBoltStateStore opens the bolt database at path, creating it if needed.
+// Each store returned must be closed.
+func OpenBoltStateStore(path string) (*BoltStateStore, error) {
+	openBoltFilesMu.Lock()
+	defer openBoltFilesMu.Unlock()
+	if f, ok := openBoltFiles[path]; ok {
+		f.refs++
+		return &BoltStateStore{file: f}, nil
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening state store %s: %w", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(stateBucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("opening state store %s: %w", path, err)
+	}
+	f := &boltFile{db: db, path: path, refs: 1}
+	openBoltFiles[path] = f
+	return &BoltStateStore{file: f}, nil
+}
+
+// Close releases the store, closing the file with the last store using it
+func (s *BoltStateStore) Close() error {
+	var err error
+	s.closed.Do(func() {
+		openBoltFilesMu.Lock()
+		defer openBoltFilesMu.Unlock()
+		if s.file.refs--; s.file.refs > 0 {
+			return
+		}
+		delete(openBoltFiles, s.file.path)
+		err = s.file.db.Close()
+	})
+	return err
+}
+
+// Entries are stored as their expiry in Unix nanoseconds followed by the value
+func (s *BoltStateStore) Update(keys []string, ttl time.Duration, fn func(values [][]byte) ([][]byte, error)) error {
+	f := s.file
+	return f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(stateBucket)
+		now := time.Now()
+		values := make([][]byte, len(keys))
+		for i, key := range keys {
+			if value, ok := decodeBoltEntry(b.Get([]byte(key)), now); ok {
+				values[i] = value
+			}
+		}
+		updated, err := fn(values)
+		if err != nil {
+			return err
+		}
+		expires := uint64(now.Add(ttl).UnixNano())
+		for i, key := range keys {
+			if i < len(updated) && updated[i] != nil {
+				entry := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(updated[i])), expires)
+				if err := b.Put([]byte(key), append(entry, updated[i]...)); err != nil {
+					return err
+				}
+			}
+		}
+
+		if f.updates++; f.updates%4096 != 0 {
+			return nil
+		}
+		var expired [][]byte
+		_ = b.ForEach(func(k, v []byte) error {
+			if _, ok := decodeBoltEntry(v, now); !ok {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Read takes a read-only transaction, which bolt runs concurrently with
+// others and without syncing the file
+func (s *BoltStateStore) Read(keys []string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	err := s.file.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(stateBucket)
+		now := time.Now()
+		for i, key := range keys {
+			if value, ok := decodeBoltEntry(b.Get([]byte(key)), now); ok {
+				values[i] = value
+			}
+		}
+		return nil
+	})
+	return values, err
+}
+
+// decodeBoltEntry returns a copy of an entry's value, reporting false for
+// missing and expired entries
+func decodeBoltEntry(entry []byte, now time.Time) ([]byte, bool) {
+	if len(entry) < 8 || int64(binary.BigEndian.Uint64(entry)) <= now.UnixNano() {
+		return nil, false
+	}
+	return append([]byte(nil), entry[8:]...), true
+}
+
+// OpenStateStore opens the state store a DSN names: "memory" for the
+// process-wide in-memory store, or "bolt:<path>" for a bolt database file.
+// The returned close func releases the store.
+func OpenStateStore(dsn string) (StateStore, func() error, error) {
+	scheme, rest, _ := strings.Cut(dsn, ":")
+	switch strings.ToLower(scheme) {
+	case "memory":
+		return defaultStateStore, func() error { return nil }, nil
+	case "bolt":
+		path := strings.TrimPrefix(rest, "//")
+		if path == "" {
+			return nil, nil, fmt.Errorf("state store '%s': missing file path", dsn)
+		}
+		s, err := OpenBoltStateStore(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("state store '%s': unsupported backend (supported: memory, bolt:<path>)", dsn)
+	}
+}
+
+var (
+	_ StateStore  = (*BoltStateStore)(nil)
+	_ StateReader = (*BoltStateStore)(nil)
+)
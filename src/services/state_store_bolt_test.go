@@ -0,0 +1,139 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func boltGet(t *testing.T, s StateStore, key string) []byte {
+	t.Helper()
+	var got []byte
+	if err := s.Update([]string{key}, time.Hour, func(values [][]byte) ([][]byte, error) {
+		got = values[0]
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	return got
+}
+
+func TestBoltStateStore_SurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, closeStore, err := OpenStateStore("bolt:" + path)
+	if err != nil {
+		t.Fatalf("OpenStateStore returned error: %v", err)
+	}
+	if err := s.Update([]string{"kept", "expired"}, time.Hour, func(values [][]byte) ([][]byte, error) {
+		return [][]byte{[]byte("value"), nil}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update([]string{"expired"}, -time.Second, func(values [][]byte) ([][]byte, error) {
+		return [][]byte{[]byte("gone")}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reload opens the file again before the old config closes it
+	again, closeAgain, err := OpenStateStore("bolt://" + path)
+	if err != nil {
+		t.Fatalf("reopening the open file returned error: %v", err)
+	}
+	if err := closeStore(); err != nil {
+		t.Fatal(err)
+	}
+	if got := boltGet(t, again, "kept"); string(got) != "value" {
+		t.Errorf("expected the store to stay open for the new config, got %q", got)
+	}
+	if err := closeAgain(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, closeStore, err = OpenStateStore("bolt:" + path)
+	if err != nil {
+		t.Fatalf("OpenStateStore returned error: %v", err)
+	}
+	defer closeStore()
+	if got := boltGet(t, s, "kept"); string(got) != "value" {
+		t.Errorf("expected the value to survive a restart, got %q", got)
+	}
+	if got := boltGet(t, s, "expired"); got != nil {
+		t.Errorf("expected the expired value to be gone, got %q", got)
+	}
+}
+
+func TestOpenStateStore_DSN(t *testing.T) {
+	if s, _, err := OpenStateStore("memory"); err != nil || s != defaultStateStore {
+		t.Errorf("expected memory to open the in-memory store, got %v, %v", s, err)
+	}
+	for _, dsn := range []string{"bolt:", "redis://localhost:6379", ""} {
+		if _, _, err := OpenStateStore(dsn); err == nil {
+			t.Errorf("expected %q to be refused", dsn)
+		}
+	}
+}
+
+func TestBoltStateStore_ReadsWithoutWriteTransaction(t *testing.T) {
+	s, err := OpenBoltStateStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Update([]string{"kept", "expired"}, time.Hour, func(values [][]byte) ([][]byte, error) {
+		return [][]byte{[]byte("value"), []byte("gone")}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update([]string{"expired"}, -time.Second, func(values [][]byte) ([][]byte, error) {
+		return [][]byte{[]byte("gone")}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reads go on while a write transaction is open
+	writing, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Update([]string{"other"}, time.Hour, func(values [][]byte) ([][]byte, error) {
+			close(writing)
+			<-release
+			return nil, nil
+		})
+	}()
+	<-writing
+	values, err := ReadState(s, []string{"kept", "expired", "missing"})
+	close(release)
+	if err != nil {
+		t.Fatalf("ReadState returned error: %v", err)
+	}
+	if string(values[0]) != "value" || values[1] != nil || values[2] != nil {
+		t.Errorf("expected the live value only, got %q", values)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// updateOnlyStore is a StateStore without a read path of its own
+type updateOnlyStore struct {
+	StateStore
+}
+
+func TestReadState_FallsBackToUpdate(t *testing.T) {
+	memory := NewMemoryStateStore()
+	if err := memory.Update([]string{"key"}, time.Hour, func(values [][]byte) ([][]byte, error) {
+		return [][]byte{[]byte("value")}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []StateStore{memory, updateOnlyStore{memory}} {
+		values, err := ReadState(s, []string{"key", "missing"})
+		if err != nil {
+			t.Fatalf("ReadState returned error: %v", err)
+		}
+		if len(values) != 2 || string(values[0]) != "value" || values[1] != nil {
+			t.Errorf("%T: expected the stored value, got %q", s, values)
+		}
+	}
+}
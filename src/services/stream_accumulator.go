@@ -0,0 +1,159 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// StreamAccumulator merges the chunks of a Chat Completions stream into the
+// choices of the complete response
+type StreamAccumulator struct {
+	mu      sync.Mutex
+	choices map[int]*choiceAccum // indexed by choice index
+	model   string
+	// firstChunk is when the first chunk arrived, for the time to first token
+	firstChunk time.Time
+}
+
+type choiceAccum struct {
+	role         string
+	content      strings.Builder
+	toolCalls    []styles.ChatCompletionsToolCall
+	finishReason string
+}
+
+// NewStreamAccumulator returns an empty accumulator
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{
+		choices: make(map[int]*choiceAccum),
+	}
+}
+
+// Accumulate merges a streaming chunk into the accumulator
+func (sa *StreamAccumulator) Accumulate(chunk styles.PartialJSON) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	if sa.firstChunk.IsZero() {
+		sa.firstChunk = time.Now()
+	}
+
+	// Extract model if present
+	model := styles.TryGetFromPartialJSON[string](chunk, "model")
+	if model != "" {
+		sa.model = model
+	}
+
+	// Extract choices
+	choicesRaw, ok := chunk["choices"]
+	if !ok {
+		return
+	}
+
+	var choices []styles.ChatCompletionsChoice
+	if err := json.Unmarshal(choicesRaw, &choices); err != nil {
+		return
+	}
+
+	for _, choice := range choices {
+		idx := choice.Index
+
+		accum, exists := sa.choices[idx]
+		if !exists {
+			accum = &choiceAccum{}
+			sa.choices[idx] = accum
+		}
+
+		if choice.FinishReason != "" {
+			accum.finishReason = choice.FinishReason
+		}
+
+		if choice.Delta != nil {
+			if choice.Delta.Role != "" {
+				accum.role = choice.Delta.Role
+			}
+			if content, ok := choice.Delta.Content.(string); ok {
+				accum.content.WriteString(content)
+			}
+
+			// accumulate tool calls
+			for _, tc := range choice.Delta.ToolCalls {
+				tcIdx := tc.Index
+
+				// extend slice if needed
+				for len(accum.toolCalls) <= tcIdx {
+					accum.toolCalls = append(accum.toolCalls, styles.ChatCompletionsToolCall{})
+				}
+
+				existing := &accum.toolCalls[tcIdx]
+				if tc.ID != "" {
+					existing.ID = tc.ID
+				}
+				if tc.Type != "" {
+					existing.Type = tc.Type
+				}
+				if tc.Function != nil {
+					if existing.Function == nil {
+						existing.Function = &struct {
+							Name      string `json:"name,omitempty"`
+							Arguments string `json:"arguments,omitempty"`
+						}{}
+					}
+					if tc.Function.Name != "" {
+						existing.Function.Name = tc.Function.Name
+					}
+					if tc.Function.Arguments != "" {
+						existing.Function.Arguments += tc.Function.Arguments
+					}
+				}
+			}
+		}
+	}
+}
+
+// Choices returns the choices accumulated so far, as in a complete response
+func (sa *StreamAccumulator) Choices() []map[string]any {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	result := make([]map[string]any, 0, len(sa.choices))
+	for idx := 0; idx < len(sa.choices); idx++ {
+		accum, ok := sa.choices[idx]
+		if !ok {
+			continue
+		}
+
+		message := map[string]any{
+			"role":    accum.role,
+			"content": accum.content.String(),
+		}
+		if len(accum.toolCalls) > 0 {
+			message["tool_calls"] = accum.toolCalls
+		}
+
+		result = append(result, map[string]any{
+			"index":         idx,
+			"message":       message,
+			"finish_reason": accum.finishReason,
+		})
+	}
+	return result
+}
+
+// Model returns the model the chunks named
+func (sa *StreamAccumulator) Model() string {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	return sa.model
+}
+
+// FirstChunk returns when the first chunk arrived, zero before any did
+func (sa *StreamAccumulator) FirstChunk() time.Time {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	return sa.firstChunk
+}
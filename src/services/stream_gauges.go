@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Process-wide counts of streams in flight, see ReadStreamGauges. A count
+// that keeps growing while traffic doesn't is a leak: an upstream body never
+// closed, or a stream goroutine blocked on a consumer that went away.
+var (
+	openUpstreamStreams atomic.Int64
+	activeSSEWriters    atomic.Int64
+	streamGoroutines    atomic.Int64
+)
+
+// StreamGauges is a snapshot of the streams in flight
+type StreamGauges struct {
+	// UpstreamStreams are upstream stream bodies not closed yet
+	UpstreamStreams int64 `json:"upstream_streams"`
+	// SSEWriters are client streams being written
+	SSEWriters int64 `json:"sse_writers"`
+	// StreamGoroutines are goroutines producing stream chunks
+	StreamGoroutines int64 `json:"stream_goroutines"`
+	// Goroutines is the total number of goroutines of the process
+	Goroutines int `json:"goroutines"`
+}
+
+// ReadStreamGauges returns the streams in flight
+func ReadStreamGauges() StreamGauges {
+	return StreamGauges{
+		UpstreamStreams:  openUpstreamStreams.Load(),
+		SSEWriters:       activeSSEWriters.Load(),
+		StreamGoroutines: streamGoroutines.Load(),
+		Goroutines:       runtime.NumGoroutine(),
+	}
+}
+
+// track counts one in g until the returned func is first called
+func track(g *atomic.Int64) (done func()) {
+	g.Add(1)
+	var once sync.Once
+	return func() { once.Do(func() { g.Add(-1) }) }
+}
+
+// TrackSSEWriter counts a client stream until the returned func is called
+func TrackSSEWriter() (done func()) {
+	return track(&activeSSEWriters)
+}
+
+// TrackStreamGoroutine counts a goroutine producing stream chunks until the
+// returned func is called
+func TrackStreamGoroutine() (done func()) {
+	return track(&streamGoroutines)
+}
+
+// TrackUpstreamStream counts the body of an upstream stream until it is
+// closed
+func TrackUpstreamStream(res *http.Response) {
+	if res == nil || res.Body == nil {
+		return
+	}
+	res.Body = &trackedBody{ReadCloser: res.Body, done: track(&openUpstreamStreams)}
+}
+
+// trackedBody is a response body counted in the stream gauges
+type trackedBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *trackedBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
+// RegisterStreamGauges exposes the stream gauges as metrics of reg; gauges
+// already registered are left as they are
+func RegisterStreamGauges(reg prometheus.Registerer) error {
+	for _, g := range []struct {
+		name, help string
+		value      *atomic.Int64
+	}{
+		{"ai_router_upstream_streams_open", "Upstream stream bodies not closed yet", &openUpstreamStreams},
+		{"ai_router_sse_writers_active", "Client streams being written", &activeSSEWriters},
+		{"ai_router_stream_goroutines", "Goroutines producing stream chunks", &streamGoroutines},
+	} {
+		gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: g.name, Help: g.help}, func() float64 {
+			return float64(g.value.Load())
+		})
+		if err := reg.Register(gauge); err != nil {
+			var registered prometheus.AlreadyRegisteredError
+			if !errors.As(err, &registered) {
+				return err
+			}
+		}
+	}
+	return nil
+}
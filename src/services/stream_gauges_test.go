@@ -0,0 +1,33 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStreamGauges_CountUntilDone(t *testing.T) {
+	before := ReadStreamGauges()
+
+	done := TrackSSEWriter()
+	if g := ReadStreamGauges(); g.SSEWriters != before.SSEWriters+1 {
+		t.Errorf("expected the writer counted, got %+v", g)
+	}
+	done()
+	done()
+	if g := ReadStreamGauges(); g.SSEWriters != before.SSEWriters {
+		t.Errorf("expected the writer uncounted once, got %+v", g)
+	}
+
+	res := &http.Response{Body: io.NopCloser(strings.NewReader("data: {}\n\n"))}
+	TrackUpstreamStream(res)
+	if g := ReadStreamGauges(); g.UpstreamStreams != before.UpstreamStreams+1 {
+		t.Errorf("expected the upstream body counted, got %+v", g)
+	}
+	_ = res.Body.Close()
+	_ = res.Body.Close()
+	if g := ReadStreamGauges(); g.UpstreamStreams != before.UpstreamStreams {
+		t.Errorf("expected the closed body uncounted once, got %+v", g)
+	}
+}
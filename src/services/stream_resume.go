@@ -0,0 +1,154 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// ResumeTokenField is the request field carrying a resume token
+const ResumeTokenField = "resume_token"
+
+// defaultResumeTTL is how long a failed stream can be resumed
+const defaultResumeTTL = 10 * time.Minute
+
+// ErrResumeExpired is returned for resume tokens whose stream can no longer
+// be resumed
+var ErrResumeExpired = errors.New("resume token expired")
+
+// StreamResume lets clients resume a stream that failed midway instead of
+// starting over. The error event of the stream carries an opaque token
+// naming the trace, pinned to the request with a hash of its body and to the
+// content streamed so far with a hash of it; the content itself is kept in a
+// state store. Re-posting the request with the token continues the answer.
+type StreamResume struct {
+	Store StateStore
+	// Prefix namespaces the content in the store, e.g. by router name
+	Prefix string
+	// Secret signs tokens; instances sharing a store must share it
+	Secret []byte
+	// TTL is how long a stream can be resumed (default: 10 minutes)
+	TTL time.Duration
+}
+
+// resumeClaims is the signed payload of a resume token
+type resumeClaims struct {
+	TraceID     string `json:"t"`
+	RequestHash string `json:"r"`
+	ContentHash string `json:"h"`
+	Expires     int64  `json:"e"`
+}
+
+// NewResumeSecret returns a random secret, for routers without a configured
+// one; their tokens only work on the instance that issued them
+func NewResumeSecret() []byte {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return secret
+}
+
+// ResumeRequestHash returns the hash pinning a token to a request: its body
+// without the resume token
+func ResumeRequestHash(reqJson styles.PartialJSON) string {
+	body := reqJson.Clone()
+	delete(body, ResumeTokenField)
+	data, _ := json.Marshal(body)
+	return sha256Hex(data)[:32]
+}
+
+func (s *StreamResume) ttl() time.Duration {
+	if s.TTL > 0 {
+		return s.TTL
+	}
+	return defaultResumeTTL
+}
+
+// Issue keeps the content streamed for a request and returns the token
+// resuming it
+func (s *StreamResume) Issue(traceID, requestHash, content string, now time.Time) (string, error) {
+	claims := resumeClaims{
+		TraceID:     traceID,
+		RequestHash: requestHash,
+		ContentHash: sha256Hex([]byte(content)),
+		Expires:     now.Add(s.ttl()).Unix(),
+	}
+	err := s.Store.Update([]string{s.Prefix + "resume:" + traceID}, s.ttl(), func([][]byte) ([][]byte, error) {
+		return marshalStored(content)
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.sign(encoded), nil
+}
+
+// Redeem checks a token against the request re-posted with it and returns
+// the content streamed before the failure. Tampered tokens and tokens of
+// other requests are invalid requests; expired ones are ErrResumeExpired.
+func (s *StreamResume) Redeem(token, requestHash string, now time.Time) (string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(encoded))) {
+		return "", errs.Errorf(errs.ErrInvalidRequest, "invalid resume token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	var claims resumeClaims
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return "", errs.Errorf(errs.ErrInvalidRequest, "invalid resume token")
+	}
+	if claims.RequestHash != requestHash {
+		return "", errs.Errorf(errs.ErrInvalidRequest, "resume token was issued for a different request")
+	}
+	if now.Unix() > claims.Expires {
+		return "", ErrResumeExpired
+	}
+	var content *string
+	values, err := ReadState(s.Store, []string{s.Prefix + "resume:" + claims.TraceID})
+	if err == nil {
+		err = unmarshalStored(values[0], &content)
+	}
+	if err != nil {
+		return "", err
+	}
+	if content == nil || sha256Hex([]byte(*content)) != claims.ContentHash {
+		return "", ErrResumeExpired
+	}
+	return *content, nil
+}
+
+func (s *StreamResume) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ResumeRequest returns the request continuing an answer: the content
+// already streamed is appended as a trailing assistant message, which
+// providers supporting prefill continue, and the token is removed
+func ResumeRequest(reqJson styles.PartialJSON, content string) (styles.PartialJSON, error) {
+	resumed := reqJson.Clone()
+	delete(resumed, ResumeTokenField)
+	var messages []json.RawMessage
+	if err := json.Unmarshal(resumed["messages"], &messages); err != nil {
+		return nil, errs.Wrap(errs.ErrInvalidRequest, err)
+	}
+	prefill, err := json.Marshal(map[string]string{"role": "assistant", "content": content})
+	if err != nil {
+		return nil, err
+	}
+	if err := resumed.Set("messages", append(messages, prefill)); err != nil {
+		return nil, err
+	}
+	return resumed, nil
+}
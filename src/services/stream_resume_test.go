@@ -0,0 +1,55 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestStreamResume_Redeem(t *testing.T) {
+	resume := &StreamResume{Store: NewMemoryStateStore(), Prefix: "default:", Secret: []byte("secret"), TTL: time.Minute}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	req, _ := styles.ParsePartialJSON([]byte(`{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "Count to ten"}]}`))
+	hash := ResumeRequestHash(req)
+
+	token, err := resume.Issue("trace-1", hash, "1, 2, 3,", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The token does not change what the request hashes to
+	_ = req.Set(ResumeTokenField, token)
+	if ResumeRequestHash(req) != hash {
+		t.Fatal("expected the request hash to ignore the resume token")
+	}
+	content, err := resume.Redeem(token, hash, now.Add(30*time.Second))
+	if err != nil || content != "1, 2, 3," {
+		t.Fatalf("Redeem = %q, %v", content, err)
+	}
+
+	resumed, err := ResumeRequest(req, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []map[string]string
+	_ = json.Unmarshal(resumed["messages"], &messages)
+	if _, ok := resumed[ResumeTokenField]; ok || len(messages) != 2 || messages[1]["role"] != "assistant" || messages[1]["content"] != content {
+		t.Errorf("ResumeRequest = %s", resumed["messages"])
+	}
+
+	other, _ := styles.ParsePartialJSON([]byte(`{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "Count to twenty"}]}`))
+	if _, err := resume.Redeem(token, ResumeRequestHash(other), now); !errors.Is(err, errs.ErrInvalidRequest) {
+		t.Errorf("expected a token of another request to be invalid, got %v", err)
+	}
+	encoded, _, _ := strings.Cut(token, ".")
+	if _, err := resume.Redeem(encoded+".forged", hash, now); !errors.Is(err, errs.ErrInvalidRequest) {
+		t.Errorf("expected a forged token to be invalid, got %v", err)
+	}
+	if _, err := resume.Redeem(token, hash, now.Add(2*time.Minute)); !errors.Is(err, ErrResumeExpired) {
+		t.Errorf("expected an expired token, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Stripe billing metrics
+const (
+	BillingMetricTokens = "tokens"
+	BillingMetricCost   = "cost"
+)
+
+// Defaults of the Stripe exporter
+const (
+	defaultStripeURL       = "https://api.stripe.com"
+	defaultBillingEvery    = time.Hour
+	defaultBillingLookback = 24 * time.Hour
+	defaultCostUnit        = 100 // cents
+)
+
+// StripeExporter reports the usage of tenants to the usage records of their
+// metered Stripe subscription items, one record per tenant and hour. Every
+// run reconciles the closed hours of the lookback window with the ledger: an
+// hour is reported with action=set whenever its quantity differs from the
+// one last reported, so usage recorded late or a failed report is corrected
+// on a later run. Reports carry an idempotency key derived from the tenant,
+// hour and quantity, so instances exporting the same ledger don't count
+// usage twice.
+type StripeExporter struct {
+	APIKey string
+	// BaseURL is the Stripe API URL (default: https://api.stripe.com)
+	BaseURL string
+	// Metric is what is reported: "tokens" (default) or "cost"
+	Metric string
+	// CostUnit is the number of reported units per USD of cost (default: 100)
+	CostUnit float64
+	// Items maps tenants to their metered subscription item IDs; other
+	// tenants are not reported
+	Items map[string]string
+	// Interval is the time between runs (default: 1h)
+	Interval time.Duration
+	// Lookback is how far back closed hours are reconciled (default: 24h)
+	Lookback time.Duration
+
+	Ledger *UsageLedger
+	// State keeps the reported quantities, under Prefix
+	State  StateStore
+	Prefix string
+	Logger *zap.Logger
+
+	closing sync.Once
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// stripeReport is an hour's report as kept in the state store
+type stripeReport struct {
+	Quantity int64 `json:"quantity"`
+}
+
+// Validate checks the exporter's settings
+func (e *StripeExporter) Validate() error {
+	if e.APIKey == "" {
+		return fmt.Errorf("stripe billing requires an api_key")
+	}
+	switch e.Metric {
+	case "", BillingMetricTokens, BillingMetricCost:
+	default:
+		return fmt.Errorf("stripe billing: unknown metric '%s' (supported: tokens, cost)", e.Metric)
+	}
+	if e.CostUnit < 0 || e.Interval < 0 || e.Lookback < 0 {
+		return fmt.Errorf("stripe billing: cost_unit, interval and lookback must not be negative")
+	}
+	if len(e.Items) == 0 {
+		return fmt.Errorf("stripe billing: no subscription item configured")
+	}
+	return nil
+}
+
+// Start runs the exporter in the background until Close
+func (e *StripeExporter) Start() {
+	e.stop, e.done = make(chan struct{}), make(chan struct{})
+	every := e.Interval
+	if every <= 0 {
+		every = defaultBillingEvery
+	}
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), every)
+				if err := e.Export(ctx, time.Now()); err != nil {
+					e.logger().Warn("stripe usage export failed", zap.Error(err))
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Close stops the exporter, waiting for a running export to end
+func (e *StripeExporter) Close() error {
+	if e.stop == nil {
+		return nil
+	}
+	e.closing.Do(func() { close(e.stop) })
+	<-e.done
+	return nil
+}
+
+// Export reconciles the closed hours of the lookback window before now with
+// Stripe, returning the errors of the reports that failed
+func (e *StripeExporter) Export(ctx context.Context, now time.Time) error {
+	lookback := e.Lookback
+	if lookback <= 0 {
+		lookback = defaultBillingLookback
+	}
+	current := now.UTC().Truncate(time.Hour)
+	var failed []string
+	for tenant, item := range e.Items {
+		for hour := current.Add(-lookback); hour.Before(current); hour = hour.Add(time.Hour) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := e.reconcile(ctx, tenant, item, hour); err != nil {
+				failed = append(failed, fmt.Sprintf("%s at %s: %v", tenant, hour.Format(time.RFC3339), err))
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d usage reports failed: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// reconcile reports a tenant's hour when the ledger differs from what Stripe was told
+func (e *StripeExporter) reconcile(ctx context.Context, tenant, item string, hour time.Time) error {
+	totals, err := e.Ledger.Hour(tenant, hour)
+	if err != nil {
+		return err
+	}
+	quantity := e.quantity(totals)
+	stateKey := e.Prefix + "stripe:" + tenant + ":" + strconv.FormatInt(hour.Unix(), 10)
+	var reported stripeReport
+	values, err := ReadState(e.State, []string{stateKey})
+	if err == nil {
+		err = unmarshalStored(values[0], &reported)
+	}
+	if err != nil || reported.Quantity == quantity {
+		return err
+	}
+
+	if err := e.report(ctx, item, hour, quantity, tenant); err != nil {
+		return err
+	}
+	e.logger().Debug("reported usage to stripe",
+		zap.String("tenant", tenant),
+		zap.Time("hour", hour),
+		zap.Int64("quantity", quantity),
+		zap.Int64("previous", reported.Quantity))
+	// Kept as long as the ledger, past the lookback window
+	return e.State.Update([]string{stateKey}, defaultUsageRetention, func([][]byte) ([][]byte, error) {
+		return marshalStored(stripeReport{Quantity: quantity})
+	})
+}
+
+// quantity converts an hour's usage to the reported metric
+func (e *StripeExporter) quantity(totals UsageTotals) int64 {
+	if e.Metric != BillingMetricCost {
+		return totals.Tokens()
+	}
+	unit := e.CostUnit
+	if unit <= 0 {
+		unit = defaultCostUnit
+	}
+	return int64(math.Round(totals.Cost * unit))
+}
+
+// report sets the usage record of an hour
+func (e *StripeExporter) report(ctx context.Context, item string, hour time.Time, quantity int64, tenant string) error {
+	base := e.BaseURL
+	if base == "" {
+		base = defaultStripeURL
+	}
+	form := url.Values{
+		"quantity":  {strconv.FormatInt(quantity, 10)},
+		"timestamp": {strconv.FormatInt(hour.Unix(), 10)},
+		"action":    {"set"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(base, "/")+"/v1/subscription_items/"+url.PathEscape(item)+"/usage_records",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Idempotency-Key", fmt.Sprintf("%s-%s-%d-%d", e.Prefix+"usage", tenant, hour.Unix(), quantity))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("stripe: status %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (e *StripeExporter) logger() *zap.Logger {
+	if e.Logger == nil {
+		return zap.NewNop()
+	}
+	return e.Logger
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStripeExporter_Export(t *testing.T) {
+	var mu sync.Mutex
+	var reports []string
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			http.Error(w, `{"error": {"message": "unavailable"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		_ = r.ParseForm()
+		if r.URL.Path != "/v1/subscription_items/si_acme/usage_records" || r.Form.Get("action") != "set" ||
+			r.Header.Get("Authorization") != "Bearer sk_test" || r.Header.Get("Idempotency-Key") == "" {
+			t.Errorf("unexpected report %s %v %v", r.URL.Path, r.Form, r.Header)
+		}
+		reports = append(reports, r.Form.Get("timestamp")+"="+r.Form.Get("quantity"))
+	}))
+	defer server.Close()
+
+	store := NewMemoryStateStore()
+	ledger := &UsageLedger{Store: store, Prefix: "r:"}
+	e := &StripeExporter{
+		APIKey:  "sk_test",
+		BaseURL: server.URL,
+		Items:   map[string]string{"acme": "si_acme"},
+		Ledger:  ledger,
+		State:   store,
+		Prefix:  "r:",
+	}
+	if err := e.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	hour := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	_ = ledger.Record("acme", UsageTotals{Requests: 1, InputTokens: 100, OutputTokens: 20}, hour.Add(10*time.Minute))
+	_ = ledger.Record("acme", UsageTotals{Requests: 1, InputTokens: 30}, hour.Add(50*time.Minute))
+	_ = ledger.Record("globex", UsageTotals{Requests: 1, InputTokens: 5}, hour)
+
+	// The open hour is not reported, and failed reports are retried
+	now := hour.Add(90 * time.Minute)
+	if err := e.Export(context.Background(), now); err == nil {
+		t.Error("expected the failed report to be returned")
+	}
+	failing = false
+	if err := e.Export(context.Background(), now); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	if err := e.Export(context.Background(), now); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	ts := "1792141200"
+	if len(reports) != 1 || reports[0] != ts+"=150" {
+		t.Fatalf("reports = %v, want one report of 150 tokens", reports)
+	}
+
+	// Usage recorded late is reconciled
+	_ = ledger.Record("acme", UsageTotals{Requests: 1, OutputTokens: 50}, hour.Add(59*time.Minute))
+	if err := e.Export(context.Background(), now.Add(time.Hour)); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	if len(reports) != 2 || reports[1] != ts+"=200" {
+		t.Errorf("reports = %v, want the hour set to 200 tokens", reports)
+	}
+}
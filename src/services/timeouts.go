@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+)
+
+// ProviderTimeouts bounds the upstream calls of a provider
+type ProviderTimeouts struct {
+	// Connect bounds dialing the upstream and the TLS handshake
+	Connect caddy.Duration `json:"connect,omitempty"`
+	// Total bounds a whole call, reading the response included, in place of
+	// the router's default upstream timeout
+	Total caddy.Duration `json:"total,omitempty"`
+	// FirstToken bounds the wait for the first event of a stream
+	FirstToken caddy.Duration `json:"first_token,omitempty"`
+}
+
+// ErrFirstTokenTimeout ends streams whose first event took longer than the
+// provider's first_token timeout
+var ErrFirstTokenTimeout = errs.Errorf(errs.ErrTimeout, "no first token within the provider's first_token timeout")
+
+// Set sets the timeout of a kind: connect, total or first_token
+func (t *ProviderTimeouts) Set(kind string, d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("timeout %s: negative duration", kind)
+	}
+	switch kind {
+	case "connect":
+		t.Connect = caddy.Duration(d)
+	case "total":
+		t.Total = caddy.Duration(d)
+	case "first_token":
+		t.FirstToken = caddy.Duration(d)
+	default:
+		return fmt.Errorf("unknown timeout '%s' (connect, total, first_token)", kind)
+	}
+	return nil
+}
+
+// upstreamCancelKey holds the cancel func of an upstream call's context
+type upstreamCancelKey struct{}
+
+// WithUpstreamTimeout derives the context for an upstream request to the
+// provider, bounded by its total timeout or else the default upstream
+// timeout. The returned cancel func must be called once the upstream response
+// body is fully consumed.
+func (p *ProviderService) WithUpstreamTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	var total time.Duration
+	if p.Timeouts != nil {
+		total = time.Duration(p.Timeouts.Total)
+	}
+	if total <= 0 {
+		total = time.Duration(defaultUpstreamTimeout.Load())
+	}
+	ctx, cancelCause := context.WithCancelCause(ctx)
+	ctx = context.WithValue(ctx, upstreamCancelKey{}, cancelCause)
+	if total <= 0 {
+		return ctx, func() { cancelCause(context.Canceled) }
+	}
+	ctx, cancel := context.WithTimeout(ctx, total)
+	return ctx, func() {
+		cancel()
+		cancelCause(context.Canceled)
+	}
+}
+
+// AwaitFirstToken cancels the upstream call of ctx with ErrFirstTokenTimeout
+// unless the returned func is called within the provider's first_token
+// timeout. ctx must come from WithUpstreamTimeout.
+func (p *ProviderService) AwaitFirstToken(ctx context.Context) (received func()) {
+	cancel, ok := ctx.Value(upstreamCancelKey{}).(context.CancelCauseFunc)
+	if !ok || p.Timeouts == nil || p.Timeouts.FirstToken <= 0 {
+		return func() {}
+	}
+	timer := time.AfterFunc(time.Duration(p.Timeouts.FirstToken), func() { cancel(ErrFirstTokenTimeout) })
+	context.AfterFunc(ctx, func() { timer.Stop() })
+	return func() { timer.Stop() }
+}
+
+// UpstreamError marks an error calling or reading from the upstream of an
+// upstream call's context: errs.ErrTimeout when the call ran out of time,
+// ErrFirstTokenTimeout when its stream didn't start in time, errs.ErrUpstream
+// otherwise
+func UpstreamError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrFirstTokenTimeout) {
+		return cause
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return errs.Wrap(errs.ErrTimeout, err)
+	}
+	return errs.Wrap(errs.ErrUpstream, err)
+}
+
+// providerClients holds the HTTP clients of providers with a connect timeout,
+// by timeout, so providers with the same one share connections
+var providerClients sync.Map
+
+// HTTPClient returns the client for the provider's upstream calls: the
+// default client, or one dialing within the provider's connect timeout
+func (p *ProviderService) HTTPClient() *http.Client {
+	if p.Timeouts == nil || p.Timeouts.Connect <= 0 {
+		return http.DefaultClient
+	}
+	connect := time.Duration(p.Timeouts.Connect)
+	if client, ok := providerClients.Load(connect); ok {
+		return client.(*http.Client)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = connect
+	client, _ := providerClients.LoadOrStore(connect, &http.Client{Transport: transport})
+	return client.(*http.Client)
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/errs"
+)
+
+func TestProviderTimeouts_TotalOverridesDefault(t *testing.T) {
+	SetDefaultUpstreamTimeout(time.Hour)
+	defer SetDefaultUpstreamTimeout(0)
+
+	p := &ProviderService{Timeouts: &ProviderTimeouts{Total: caddy.Duration(time.Minute)}}
+	ctx, cancel := p.WithUpstreamTimeout(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("expected the provider's total timeout as deadline, got %v", time.Until(deadline))
+	}
+
+	ctx, cancel = (&ProviderService{}).WithUpstreamTimeout(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) < 59*time.Minute {
+		t.Errorf("expected the default timeout as deadline, got %v", time.Until(deadline))
+	}
+}
+
+func TestProviderTimeouts_FirstToken(t *testing.T) {
+	p := &ProviderService{Timeouts: &ProviderTimeouts{FirstToken: caddy.Duration(20 * time.Millisecond)}}
+
+	ctx, cancel := p.WithUpstreamTimeout(context.Background())
+	defer cancel()
+	p.AwaitFirstToken(ctx)
+	<-ctx.Done()
+	err := UpstreamError(ctx, ctx.Err())
+	if !errors.Is(err, ErrFirstTokenTimeout) || !errors.Is(err, errs.ErrTimeout) {
+		t.Errorf("expected a first token timeout, got %v", err)
+	}
+
+	ctx, cancel = p.WithUpstreamTimeout(context.Background())
+	defer cancel()
+	p.AwaitFirstToken(ctx)()
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Errorf("expected a stream with a first token to go on, got %v", ctx.Err())
+	}
+	if err := UpstreamError(ctx, errors.New("connection reset")); !errors.Is(err, errs.ErrUpstream) {
+		t.Errorf("expected other errors to be upstream errors, got %v", err)
+	}
+}
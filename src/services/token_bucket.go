@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"path"
+	"slices"
+	"time"
+)
+
+// Rate-limit bucket levels, from the widest to the narrowest
+const (
+	BucketGlobal = "global"
+	BucketTenant = "tenant"
+	BucketKey    = "key"
+)
+
+// BucketLimit is the refill rate and capacity of a token bucket
+type BucketLimit struct {
+	// Rate is the number of requests the bucket refills per second
+	Rate float64 `json:"rate"`
+	// Burst is the bucket capacity (default: one second of Rate, at least 1)
+	Burst float64 `json:"burst,omitempty"`
+	// Reserve is the share of the bucket only priority keys may use, so they
+	// keep being served when other traffic drains it (0 to 1)
+	Reserve float64 `json:"reserve,omitempty"`
+}
+
+func (l *BucketLimit) burst() float64 {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return math.Max(l.Rate, 1)
+}
+
+// TokenBuckets limits requests with hierarchical token buckets: a global
+// bucket, one per tenant and one per key. A request takes a token from every
+// level at once and is refused when any level is empty, so limits compose:
+// keys share their tenant's limit and tenants share the global one. Buckets
+// live in a StateStore, so instances sharing a store share the limits.
+type TokenBuckets struct {
+	Store StateStore
+	// Prefix namespaces the buckets in the store, e.g. by router name
+	Prefix string
+	// Limits by level (BucketGlobal, BucketTenant, BucketKey); levels without
+	// a limit are not checked
+	Limits map[string]*BucketLimit
+	// PriorityKeys are the key IDs (glob patterns) allowed into the reserve
+	PriorityKeys []string
+}
+
+// bucketState is a bucket as kept in the store
+type bucketState struct {
+	Tokens float64 `json:"tokens"`
+	At     int64   `json:"at"` // unix nanoseconds of the last refill
+}
+
+// Validate checks the limits
+func (b *TokenBuckets) Validate() error {
+	for level, l := range b.Limits {
+		switch level {
+		case BucketGlobal, BucketTenant, BucketKey:
+		default:
+			return fmt.Errorf("rate_limit: unknown level '%s' (supported: global, tenant, key)", level)
+		}
+		if l.Rate <= 0 {
+			return fmt.Errorf("rate_limit %s: rate must be positive", level)
+		}
+		if l.Burst < 0 || l.Reserve < 0 || l.Reserve >= 1 {
+			return fmt.Errorf("rate_limit %s: burst must not be negative and reserve must be in [0, 1)", level)
+		}
+	}
+	for _, pattern := range b.PriorityKeys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("rate_limit: invalid priority key pattern '%s'", pattern)
+		}
+	}
+	return nil
+}
+
+// Take takes one token from the global, tenant and key buckets of a request.
+// When a bucket is empty nothing is taken and Take returns false with the time
+// until the request would be allowed. Priority requests may use the reserved
+// share of the buckets.
+func (b *TokenBuckets) Take(tenant, key string, now time.Time) (bool, time.Duration, error) {
+	if b == nil || len(b.Limits) == 0 {
+		return true, 0, nil
+	}
+	priority := key != "" && matchesAny(b.PriorityKeys, key)
+
+	var keys []string
+	var limits []*BucketLimit
+	for _, level := range []struct{ name, id string }{{BucketGlobal, ""}, {BucketTenant, tenant}, {BucketKey, key}} {
+		l, ok := b.Limits[level.name]
+		if !ok || (level.name != BucketGlobal && level.id == "") {
+			continue
+		}
+		keys = append(keys, b.Prefix+"ratelimit:"+level.name+":"+level.id)
+		limits = append(limits, l)
+	}
+	return b.take(keys, limits, priority, now)
+}
+
+// TakeLimits takes one token from each of the named buckets, such as the
+// per-client buckets of policy rules, as Take does for its levels
+func (b *TokenBuckets) TakeLimits(limits map[string]*BucketLimit, now time.Time) (bool, time.Duration, error) {
+	if b == nil || len(limits) == 0 {
+		return true, 0, nil
+	}
+	names := slices.Sorted(maps.Keys(limits))
+	keys := make([]string, len(names))
+	bucketLimits := make([]*BucketLimit, len(names))
+	for i, name := range names {
+		keys[i] = b.Prefix + "ratelimit:" + name
+		bucketLimits[i] = limits[name]
+	}
+	return b.take(keys, bucketLimits, false, now)
+}
+
+// take takes one token from every bucket, or none when one of them is empty
+func (b *TokenBuckets) take(keys []string, limits []*BucketLimit, priority bool, now time.Time) (bool, time.Duration, error) {
+	if len(keys) == 0 {
+		return true, 0, nil
+	}
+
+	// Buckets expire once they would have refilled completely
+	var ttl time.Duration
+	for _, l := range limits {
+		ttl = max(ttl, time.Duration(l.burst()/l.Rate*float64(time.Second))+time.Second)
+	}
+
+	allowed, wait := true, time.Duration(0)
+	err := b.Store.Update(keys, ttl, func(values [][]byte) ([][]byte, error) {
+		states := make([]bucketState, len(keys))
+		for i, l := range limits {
+			states[i] = bucketState{Tokens: l.burst(), At: now.UnixNano()}
+			if values[i] != nil {
+				if err := json.Unmarshal(values[i], &states[i]); err != nil {
+					return nil, err
+				}
+				elapsed := now.Sub(time.Unix(0, states[i].At)).Seconds()
+				states[i].Tokens = math.Min(l.burst(), states[i].Tokens+math.Max(elapsed, 0)*l.Rate)
+				states[i].At = now.UnixNano()
+			}
+
+			floor := 1.0
+			if !priority {
+				floor += l.Reserve * l.burst()
+			}
+			if states[i].Tokens < floor {
+				allowed = false
+				wait = max(wait, time.Duration((floor-states[i].Tokens)/l.Rate*float64(time.Second)))
+			}
+		}
+
+		updated := make([][]byte, len(keys))
+		for i := range states {
+			if allowed {
+				states[i].Tokens--
+			}
+			data, err := json.Marshal(states[i])
+			if err != nil {
+				return nil, err
+			}
+			updated[i] = data
+		}
+		return updated, nil
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed, wait, nil
+}
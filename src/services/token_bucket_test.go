@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBuckets_Take(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStateStore()
+	limits := map[string]*BucketLimit{
+		BucketGlobal: {Rate: 10, Burst: 10, Reserve: 0.2},
+		BucketTenant: {Rate: 1, Burst: 4},
+		BucketKey:    {Rate: 1, Burst: 2},
+	}
+	// Two instances sharing the store share the buckets
+	a := &TokenBuckets{Store: store, Prefix: "r:", Limits: limits, PriorityKeys: []string{"admin"}}
+	b := &TokenBuckets{Store: store, Prefix: "r:", Limits: limits, PriorityKeys: []string{"admin"}}
+	if err := a.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	take := func(tb *TokenBuckets, tenant, key string) bool {
+		t.Helper()
+		ok, _, err := tb.Take(tenant, key, now)
+		if err != nil {
+			t.Fatalf("Take returned error: %v", err)
+		}
+		return ok
+	}
+
+	// The key bucket runs out first...
+	if !take(a, "acme", "acme:1") || !take(b, "acme", "acme:1") {
+		t.Fatal("expected the key's burst to be allowed")
+	}
+	ok, wait, _ := a.Take("acme", "acme:1", now)
+	if ok || wait != time.Second {
+		t.Errorf("expected the key to be limited for 1s, got ok=%v wait=%s", ok, wait)
+	}
+	// ...then the tenant bucket shared by its keys
+	if !take(a, "acme", "acme:2") || !take(a, "acme", "acme:2") {
+		t.Fatal("expected the tenant to have tokens left")
+	}
+	if take(a, "acme", "acme:3") {
+		t.Error("expected the tenant bucket to be empty")
+	}
+
+	// Other tenants use the global bucket down to its reserve, which is left to priority keys
+	for i := 0; i < 4; i++ {
+		take(a, "other", "")
+	}
+	if take(a, "other", "") {
+		t.Error("expected the global reserve to be kept from regular keys")
+	}
+	if !take(a, "", "admin") {
+		t.Error("expected priority keys to use the reserve")
+	}
+
+	// Buckets refill over time
+	now = now.Add(2 * time.Second)
+	if !take(a, "acme", "acme:1") {
+		t.Error("expected the buckets to have refilled")
+	}
+
+	if err := (&TokenBuckets{Limits: map[string]*BucketLimit{"route": {Rate: 1}}}).Validate(); err == nil {
+		t.Error("expected an unknown level to be rejected")
+	}
+}
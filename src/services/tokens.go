@@ -0,0 +1,29 @@
+package services
+
+import "unicode/utf8"
+
+// EstimateTokens returns a rough token count for text (about four characters per token).
+// It is meant for limits and budgets where a tokenizer would be too costly.
+func EstimateTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	if n == 0 {
+		return 0
+	}
+	return (n + 3) / 4
+}
+
+// TruncateToTokens cuts text to roughly the given number of estimated tokens
+func TruncateToTokens(text string, tokens int) string {
+	if tokens <= 0 {
+		return ""
+	}
+	limit := tokens * 4
+	i := 0
+	for pos := range text {
+		if i == limit {
+			return text[:pos]
+		}
+		i++
+	}
+	return text
+}
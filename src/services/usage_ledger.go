@@ -0,0 +1,102 @@
+package services
+
+import (
+	"strconv"
+	"time"
+)
+
+// defaultUsageRetention is how long the ledger keeps an hour's usage
+const defaultUsageRetention = 35 * 24 * time.Hour
+
+// UsageTotals is the usage aggregated in a ledger hour
+type UsageTotals struct {
+	Requests     int64 `json:"requests"`
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	// Cost is in USD, counting only priced models
+	Cost float64 `json:"cost"`
+}
+
+// Tokens returns the input and output tokens
+func (u UsageTotals) Tokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// UsageLedger aggregates the usage of every request per tenant and UTC hour,
+// the source of truth billing exporters report from. It lives in a
+// StateStore, so instances sharing a store share it.
+type UsageLedger struct {
+	Store StateStore
+	// Prefix namespaces the ledger in the store, e.g. by router name
+	Prefix string
+	// Retention is how long hours are kept (default: the retention option's,
+	// else 35 days)
+	Retention time.Duration
+}
+
+// Record adds a request's usage to the tenant's hour
+func (l *UsageLedger) Record(tenant string, usage UsageTotals, at time.Time) error {
+	if l == nil || tenant == "" {
+		return nil
+	}
+	return l.Store.Update([]string{l.hourKey(tenant, at)}, l.retention(), func(values [][]byte) ([][]byte, error) {
+		var totals UsageTotals
+		if err := unmarshalStored(values[0], &totals); err != nil {
+			return nil, err
+		}
+		totals.Requests += usage.Requests
+		totals.InputTokens += usage.InputTokens
+		totals.OutputTokens += usage.OutputTokens
+		totals.Cost += usage.Cost
+		return marshalStored(totals)
+	})
+}
+
+// Hour returns the tenant's usage in the hour starting at hour
+func (l *UsageLedger) Hour(tenant string, hour time.Time) (UsageTotals, error) {
+	var totals UsageTotals
+	values, err := ReadState(l.Store, []string{l.hourKey(tenant, hour)})
+	if err == nil {
+		err = unmarshalStored(values[0], &totals)
+	}
+	return totals, err
+}
+
+// Erase removes the tenant's hours kept as of now, returning how many held
+// usage
+func (l *UsageLedger) Erase(tenant string, now time.Time) (int, error) {
+	if l == nil || tenant == "" {
+		return 0, nil
+	}
+	// Hours are only ever recorded up to now, so the retention bounds them
+	var keys []string
+	last := now.UTC().Truncate(time.Hour)
+	for hour := last.Add(-l.retention()); !hour.After(last); hour = hour.Add(time.Hour) {
+		keys = append(keys, l.hourKey(tenant, hour))
+	}
+	erased := 0
+	// State stores can't remove keys; empty hours expiring at once read as missing
+	err := l.Store.Update(keys, time.Millisecond, func(values [][]byte) ([][]byte, error) {
+		updated := make([][]byte, len(values))
+		for i, value := range values {
+			if value != nil {
+				updated[i] = []byte("{}")
+				erased++
+			}
+		}
+		return updated, nil
+	})
+	return erased, err
+}
+
+// retention returns how long hours are kept
+func (l *UsageLedger) retention() time.Duration {
+	if l.Retention > 0 {
+		return l.Retention
+	}
+	return UsageRetention()
+}
+
+func (l *UsageLedger) hourKey(tenant string, at time.Time) string {
+	return l.Prefix + "usage:" + tenant + ":" + strconv.FormatInt(at.UTC().Truncate(time.Hour).Unix(), 10)
+}
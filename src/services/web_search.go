@@ -0,0 +1,183 @@
+package services
+
+import (
+	"encoding/json"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+// CapabilityWebSearch marks models searching the web natively. Responses
+// providers are assumed to have it; Chat Completions providers having it take
+// web_search_options.
+const CapabilityWebSearch = "web_search"
+
+// webSearch is a request's web search settings, whatever dialect they came in
+type webSearch struct {
+	ContextSize string
+	// UserLocation holds the approximate location fields: city, country,
+	// region and timezone
+	UserLocation   map[string]json.RawMessage
+	AllowedDomains []string
+}
+
+// webSearchTool covers the fields of OpenAI's and Anthropic's search tools
+type webSearchTool struct {
+	Type              string                     `json:"type"`
+	SearchContextSize string                     `json:"search_context_size"`
+	UserLocation      map[string]json.RawMessage `json:"user_location"`
+	AllowedDomains    []string                   `json:"allowed_domains"` // Anthropic
+	Filters           struct {
+		AllowedDomains []string `json:"allowed_domains"`
+	} `json:"filters"` // OpenAI
+}
+
+// HasWebSearch reports whether a request asks for web search, with a search
+// tool of any dialect or Chat Completions' web_search_options
+func HasWebSearch(reqJson styles.PartialJSON) bool {
+	if _, ok := reqJson["web_search_options"]; ok {
+		return true
+	}
+	var tools []webSearchTool
+	_ = json.Unmarshal(reqJson["tools"], &tools)
+	for _, tool := range tools {
+		if styles.IsWebSearchTool(tool.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsWebSearch reports whether the provider searches the web natively
+// for a model
+func (p *ProviderService) SupportsWebSearch(model string) bool {
+	supported, known := p.Capabilities.Supports(model, CapabilityWebSearch)
+	if known {
+		return supported
+	}
+	return styles.WireStyle(p.Style) == styles.StyleResponses || p.Style == styles.StyleGoogleGenAI || p.Style == styles.StyleAnthropic
+}
+
+// TranslateWebSearch rewrites a request's web search into the provider's
+// dialect: a web_search tool for Responses, Gemini and Anthropic providers
+// (turned into their own search tools on conversion), web_search_options for Chat
+// Completions providers having CapabilityWebSearch. For other providers
+// the search is removed and reported, as the router's own web tool only
+// stands in for it through the tools plugin.
+func (p *ProviderService) TranslateWebSearch(reqJson styles.PartialJSON) (styles.PartialJSON, bool, error) {
+	if !HasWebSearch(reqJson) {
+		return reqJson, false, nil
+	}
+	res := reqJson.Clone()
+	search, err := takeWebSearch(res)
+	if err != nil {
+		return nil, false, err
+	}
+
+	model := styles.TryGetFromPartialJSON[string](reqJson, "model")
+	switch {
+	case !p.SupportsWebSearch(model):
+		return res, true, nil
+	case styles.WireStyle(p.Style) == styles.StyleResponses || p.Style == styles.StyleGoogleGenAI || p.Style == styles.StyleAnthropic:
+		tool := map[string]any{"type": "web_search"}
+		if search.ContextSize != "" {
+			tool["search_context_size"] = search.ContextSize
+		}
+		if search.UserLocation != nil {
+			tool["user_location"] = withLocationType(search.UserLocation)
+		}
+		if search.AllowedDomains != nil {
+			tool["filters"] = map[string]any{"allowed_domains": search.AllowedDomains}
+		}
+		var tools []json.RawMessage
+		_ = json.Unmarshal(res["tools"], &tools)
+		if err := res.Set("tools", append([]any{tool}, anySlice(tools)...)); err != nil {
+			return nil, false, err
+		}
+	default:
+		options := map[string]any{}
+		if search.ContextSize != "" {
+			options["search_context_size"] = search.ContextSize
+		}
+		if search.UserLocation != nil {
+			options["user_location"] = map[string]any{"type": "approximate", "approximate": search.UserLocation}
+		}
+		if err := res.Set("web_search_options", options); err != nil {
+			return nil, false, err
+		}
+	}
+	return res, false, nil
+}
+
+// takeWebSearch removes the search tools and web_search_options from a
+// request, returning the settings of the first one
+func takeWebSearch(res styles.PartialJSON) (*webSearch, error) {
+	var search *webSearch
+	if raw, ok := res["web_search_options"]; ok {
+		var options struct {
+			SearchContextSize string `json:"search_context_size"`
+			UserLocation      struct {
+				Approximate map[string]json.RawMessage `json:"approximate"`
+			} `json:"user_location"`
+		}
+		if err := json.Unmarshal(raw, &options); err != nil {
+			return nil, err
+		}
+		search = &webSearch{ContextSize: options.SearchContextSize, UserLocation: options.UserLocation.Approximate}
+		delete(res, "web_search_options")
+	}
+
+	raw, ok := res["tools"]
+	if !ok {
+		return search, nil
+	}
+	var tools []json.RawMessage
+	if err := json.Unmarshal(raw, &tools); err != nil {
+		return nil, err
+	}
+	kept := make([]json.RawMessage, 0, len(tools))
+	for _, rawTool := range tools {
+		var tool webSearchTool
+		if json.Unmarshal(rawTool, &tool) != nil || !styles.IsWebSearchTool(tool.Type) {
+			kept = append(kept, rawTool)
+			continue
+		}
+		if search != nil {
+			continue
+		}
+		search = &webSearch{ContextSize: tool.SearchContextSize, AllowedDomains: tool.Filters.AllowedDomains}
+		if tool.AllowedDomains != nil {
+			search.AllowedDomains = tool.AllowedDomains
+		}
+		if tool.UserLocation != nil {
+			search.UserLocation = tool.UserLocation
+			delete(search.UserLocation, "type")
+		}
+	}
+	if len(kept) == 0 {
+		delete(res, "tools")
+	} else if err := res.Set("tools", kept); err != nil {
+		return nil, err
+	}
+	if search == nil {
+		search = &webSearch{}
+	}
+	return search, nil
+}
+
+// withLocationType returns an approximate location in the flat form of the
+// Responses API
+func withLocationType(location map[string]json.RawMessage) map[string]any {
+	res := map[string]any{"type": "approximate"}
+	for key, value := range location {
+		res[key] = value
+	}
+	return res
+}
+
+func anySlice(values []json.RawMessage) []any {
+	res := make([]any, len(values))
+	for i, v := range values {
+		res[i] = v
+	}
+	return res
+}
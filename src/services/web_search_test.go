@@ -0,0 +1,62 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+)
+
+func TestProviderService_TranslateWebSearch(t *testing.T) {
+	// An Anthropic search tool next to a function tool
+	req, _ := styles.ParsePartialJSON([]byte(`{
+		"model": "gpt-4o-search-preview",
+		"tools": [
+			{"type": "web_search_20250305", "name": "web_search", "max_uses": 3, "allowed_domains": ["go.dev"], "user_location": {"type": "approximate", "city": "Berlin"}},
+			{"type": "function", "function": {"name": "lookup"}}
+		]
+	}`))
+
+	responses := &ProviderService{Style: styles.StyleResponses}
+	out, dropped, err := responses.TranslateWebSearch(req)
+	if err != nil || dropped {
+		t.Fatalf("TranslateWebSearch = %v, %v", dropped, err)
+	}
+	var tools []map[string]any
+	_ = json.Unmarshal(out["tools"], &tools)
+	if len(tools) != 2 || tools[0]["type"] != "web_search" || tools[1]["type"] != "function" {
+		t.Fatalf("tools = %v, want web_search and the function tool", tools)
+	}
+	if filters, _ := tools[0]["filters"].(map[string]any); filters == nil || len(filters["allowed_domains"].([]any)) != 1 {
+		t.Errorf("filters = %v, want the allowed domains", tools[0]["filters"])
+	}
+	if location, _ := tools[0]["user_location"].(map[string]any); location["city"] != "Berlin" || location["type"] != "approximate" {
+		t.Errorf("user_location = %v", tools[0]["user_location"])
+	}
+
+	chat := &ProviderService{Style: styles.StyleChatCompletions,
+		Capabilities: Capabilities{{Model: "*-search-preview", Supports: []string{CapabilityWebSearch}}}}
+	out, dropped, _ = chat.TranslateWebSearch(req)
+	var options struct {
+		UserLocation struct {
+			Approximate map[string]string `json:"approximate"`
+		} `json:"user_location"`
+	}
+	if err := json.Unmarshal(out["web_search_options"], &options); dropped || err != nil || options.UserLocation.Approximate["city"] != "Berlin" {
+		t.Errorf("web_search_options = %s, want the user location", out["web_search_options"])
+	}
+	if tools := styles.TryGetFromPartialJSON[[]any](out, "tools"); len(tools) != 1 {
+		t.Errorf("tools = %v, want only the function tool", tools)
+	}
+
+	// Providers without search lose it
+	plain := &ProviderService{Style: styles.StyleChatCompletions}
+	if plain.SupportsWebSearch("gpt-4o-search-preview") {
+		t.Error("expected a plain Chat Completions provider not to search")
+	}
+	opts, _ := styles.ParsePartialJSON([]byte(`{"model": "m", "web_search_options": {}}`))
+	out, dropped, _ = plain.TranslateWebSearch(opts)
+	if _, ok := out["web_search_options"]; !dropped || ok {
+		t.Errorf("TranslateWebSearch = %v, %v, want the search removed", out, dropped)
+	}
+}
@@ -4,35 +4,71 @@ package sse
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// ErrEventTooLarge is reported when a line or an event exceeds the reader's max size
+var ErrEventTooLarge = errors.New("sse: event exceeds maximum size")
+
+var defaultMaxEventSize atomic.Int64
+
+func init() {
+	defaultMaxEventSize.Store(1024 * 1024)
+}
+
+// SetDefaultMaxEventSize sets the max event size of readers created with
+// NewDefaultReader (values <= 0 restore the 1MB default)
+func SetDefaultMaxEventSize(n int) {
+	if n <= 0 {
+		n = 1024 * 1024
+	}
+	defaultMaxEventSize.Store(int64(n))
+}
+
 // Event represents a single SSE event
 type Event struct {
-	Data  []byte // Raw JSON bytes for passthrough
+	Name  string        // Event type from the "event:" field; empty for unnamed (message) events
+	ID    string        // Last event ID seen on the stream ("id:" field)
+	Retry time.Duration // Reconnection time last announced by the server ("retry:" field)
+	Data  []byte        // Raw JSON bytes for passthrough
 	Error error
 	Done  bool
 }
 
-// Reader provides a streaming SSE parser
+// Reader provides a streaming SSE parser following the WHATWG event stream
+// format: lines may end in LF, CRLF or CR, a leading BOM is skipped, and
+// multiple data lines of one event are joined with newlines.
 type Reader struct {
-	scanner   *bufio.Scanner
-	eventData bytes.Buffer
+	scanner *bufio.Scanner
+	maxSize int
+
+	eventData   bytes.Buffer
+	eventName   string
+	lastEventID string
+	retry       time.Duration
 }
 
 // NewReader creates a new SSE reader from an io.Reader
 // bufSize is the initial buffer size, maxSize is the maximum event size
 func NewReader(r io.Reader, bufSize, maxSize int) *Reader {
 	scanner := bufio.NewScanner(r)
-	buf := make([]byte, bufSize)
-	scanner.Buffer(buf, maxSize)
-	return &Reader{scanner: scanner}
+	buf := make([]byte, min(bufSize, maxSize))
+	// One byte of slack so that a line ending in CR can be completed
+	scanner.Buffer(buf, maxSize+1)
+	scanner.Split(scanLines)
+	return &Reader{scanner: scanner, maxSize: maxSize}
 }
 
-// NewDefaultReader creates a reader with sensible defaults (64KB initial, 1MB max)
+// NewDefaultReader creates a reader with sensible defaults (64KB initial,
+// 1MB max unless changed with SetDefaultMaxEventSize)
 func NewDefaultReader(r io.Reader) *Reader {
-	return NewReader(r, 64*1024, 1024*1024)
+	return NewReader(r, 64*1024, int(defaultMaxEventSize.Load()))
 }
 
 // ReadEvents returns a channel that emits SSE events
@@ -43,66 +79,113 @@ func (r *Reader) ReadEvents() <-chan Event {
 	go func() {
 		defer close(events)
 
+		first := true
 		for r.scanner.Scan() {
 			line := r.scanner.Text()
-			line = strings.TrimRight(line, "\r") // Handle Windows-style newlines
-
-			// Comment/heartbeat line per SSE spec; ignore
-			if strings.HasPrefix(line, ":") {
-				continue
+			if first {
+				line = strings.TrimPrefix(line, "\uFEFF")
+				first = false
 			}
 
-			// Data field
-			if strings.HasPrefix(line, "data:") {
-				val := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
-				if r.eventData.Len() > 0 {
-					r.eventData.WriteByte('\n')
+			// Blank line dispatches the pending event
+			if line == "" {
+				if event, ok := r.dispatch(); ok {
+					events <- event
+					if event.Done {
+						return
+					}
 				}
-				r.eventData.WriteString(val)
 				continue
 			}
 
-			// Other SSE fields (event, id, retry) - not used by OpenAI; ignore
-			if strings.HasPrefix(line, "event:") ||
-				strings.HasPrefix(line, "id:") ||
-				strings.HasPrefix(line, "retry:") {
+			// Comment/heartbeat line per SSE spec; ignore
+			if strings.HasPrefix(line, ":") {
 				continue
 			}
 
-			// Blank line indicates end of an event
-			if strings.TrimSpace(line) == "" {
-				if r.eventData.Len() > 0 {
-					event := r.parseEvent(r.eventData.String())
-					r.eventData.Reset()
-					events <- event
-					if event.Done || event.Error != nil {
-						return
-					}
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "data":
+				if r.eventData.Len()+len(value) > r.maxSize {
+					events <- Event{Error: fmt.Errorf("%w (%d bytes)", ErrEventTooLarge, r.maxSize)}
+					return
+				}
+				r.eventData.WriteString(value)
+				r.eventData.WriteByte('\n')
+			case "event":
+				r.eventName = value
+			case "id":
+				if !strings.ContainsRune(value, 0) {
+					r.lastEventID = value
+				}
+			case "retry":
+				if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+					r.retry = time.Duration(ms) * time.Millisecond
 				}
-				continue
 			}
-			// Unknown line content; ignore
+			// Unknown fields are ignored
 		}
 
-		// Flush last event if stream ended without trailing blank line
-		if r.eventData.Len() > 0 {
-			events <- r.parseEvent(r.eventData.String())
+		if err := r.scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				err = fmt.Errorf("%w (%d bytes)", ErrEventTooLarge, r.maxSize)
+			}
+			events <- Event{Error: err}
+			return
 		}
 
-		if err := r.scanner.Err(); err != nil && err != io.EOF {
-			events <- Event{Error: err}
+		// Flush last event if stream ended without trailing blank line
+		if event, ok := r.dispatch(); ok {
+			events <- event
 		}
 	}()
 
 	return events
 }
 
-func (r *Reader) parseEvent(payload string) Event {
-	if payload == "" {
-		return Event{}
+// dispatch builds the pending event and resets the per-event state.
+// Nothing is dispatched when no data was received.
+func (r *Reader) dispatch() (Event, bool) {
+	name := r.eventName
+	r.eventName = ""
+	if r.eventData.Len() == 0 {
+		return Event{}, false
+	}
+	payload := bytes.TrimSuffix(r.eventData.Bytes(), []byte("\n"))
+	event := Event{Name: name, ID: r.lastEventID, Retry: r.retry}
+	if string(payload) == "[DONE]" {
+		event.Done = true
+	} else if len(payload) > 0 {
+		event.Data = bytes.Clone(payload)
+	}
+	r.eventData.Reset()
+	return event, event.Done || event.Data != nil
+}
+
+// scanLines is a bufio.SplitFunc for lines ending in LF, CRLF or CR
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// A trailing CR may be followed by LF; wait for more data
+		return 0, nil, nil
 	}
-	if payload == "[DONE]" {
-		return Event{Done: true}
+	if atEOF {
+		return len(data), data, nil
 	}
-	return Event{Data: []byte(payload)}
+	return 0, nil, nil
 }
@@ -0,0 +1,76 @@
+package sse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func collect(r *Reader) []Event {
+	var events []Event
+	for event := range r.ReadEvents() {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestReader_ParsesFields(t *testing.T) {
+	stream := "\uFEFF: keep-alive\r\n" +
+		"event: response.output_text.delta\r\n" +
+		"id: 7\r\n" +
+		"retry: 1500\r\n" +
+		"data: {\"a\":\r\n" +
+		"data:1}\r\n" +
+		"\r\n" +
+		"data: {\"b\":2}\r\r" + // CR-only line endings
+		"event: ignored-without-data\n\n" +
+		"data: [DONE]\n\n" +
+		"data: {\"after\":\"done\"}\n\n"
+
+	events := collect(NewDefaultReader(strings.NewReader(stream)))
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d: %+v", len(events), events)
+	}
+
+	first := events[0]
+	if first.Name != "response.output_text.delta" || first.ID != "7" || first.Retry != 1500*time.Millisecond {
+		t.Errorf("unexpected fields: %+v", first)
+	}
+	if string(first.Data) != "{\"a\":\n1}" {
+		t.Errorf("expected data lines joined with a newline, got %q", first.Data)
+	}
+
+	second := events[1]
+	if second.Name != "" || second.ID != "7" || string(second.Data) != `{"b":2}` {
+		t.Errorf("unexpected second event: %+v", second)
+	}
+	if !events[2].Done {
+		t.Errorf("expected the [DONE] sentinel to end the stream, got %+v", events[2])
+	}
+}
+
+func TestReader_FlushesUnterminatedEvent(t *testing.T) {
+	events := collect(NewDefaultReader(strings.NewReader("data: {\"x\":1}\r")))
+	if len(events) != 1 || string(events[0].Data) != `{"x":1}` {
+		t.Errorf("expected the trailing event to be flushed, got %+v", events)
+	}
+}
+
+func TestReader_RejectsOversizedEvents(t *testing.T) {
+	streams := map[string]string{
+		"long line":  "data: " + strings.Repeat("x", 200) + "\n\n",
+		"many lines": strings.Repeat("data: "+strings.Repeat("x", 30)+"\n", 10) + "\n",
+	}
+	for name, stream := range streams {
+		events := collect(NewReader(strings.NewReader(stream), 16, 100))
+		if len(events) != 1 || !errors.Is(events[0].Error, ErrEventTooLarge) {
+			t.Errorf("%s: expected ErrEventTooLarge, got %+v", name, events)
+		}
+	}
+
+	events := collect(NewReader(strings.NewReader("data: "+strings.Repeat("x", 90)+"\n\n"), 16, 100))
+	if len(events) != 1 || len(events[0].Data) != 90 {
+		t.Errorf("expected an event within the limit to be read, got %+v", events)
+	}
+}
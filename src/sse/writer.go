@@ -1,14 +1,35 @@
 package sse
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"net"
 	"net/http"
+	"syscall"
+	"time"
 )
 
+// IsClientGone reports whether a write error means the client closed the
+// connection, as opposed to a failure on the server's side
+func IsClientGone(err error) bool {
+	return errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, context.Canceled)
+}
+
 // Writer provides SSE response writing utilities
 type Writer struct {
 	w       http.ResponseWriter
 	flusher http.Flusher
+
+	// pacing, see SetPace
+	pace    float64
+	paceCtx context.Context
+	next    time.Time
 }
 
 // NewWriter creates a new SSE writer and sets appropriate headers
@@ -43,18 +64,64 @@ func (sw *Writer) WriteData(data any) error {
 	return sw.WriteRaw(jsonData)
 }
 
-// WriteRaw writes raw bytes as an SSE data event
+// WriteRaw writes raw bytes as an SSE data event.
+// The event is written in a single Write so wrapping writers see whole events.
 func (sw *Writer) WriteRaw(data []byte) error {
-	if _, err := sw.w.Write([]byte("data: ")); err != nil {
-		return err
+	return sw.WriteEvent("", data)
+}
+
+// WriteEvent writes raw bytes as an SSE event with the given event name
+// (omitted when empty). Clients that only read unnamed events ignore it.
+func (sw *Writer) WriteEvent(event string, data []byte) error {
+	buf := make([]byte, 0, len(event)+len(data)+16)
+	if event != "" {
+		buf = append(buf, "event: "...)
+		buf = append(buf, event...)
+		buf = append(buf, '\n')
 	}
-	if _, err := sw.w.Write(data); err != nil {
+	buf = append(buf, "data: "...)
+	buf = append(buf, data...)
+	buf = append(buf, "\n\n"...)
+	if _, err := sw.w.Write(buf); err != nil {
 		return err
 	}
-	if _, err := sw.w.Write([]byte("\n\n")); err != nil {
+	sw.Flush()
+	return nil
+}
+
+// SetPace limits WritePaced to tokensPerSecond; 0 disables pacing. Waiting
+// for the pace ends when ctx is done.
+func (sw *Writer) SetPace(ctx context.Context, tokensPerSecond float64) {
+	sw.pace = tokensPerSecond
+	sw.paceCtx = ctx
+	sw.next = time.Time{}
+}
+
+// WritePaced writes a data event carrying the given number of tokens. With a
+// pace set, each event waits until the tokens of the previous ones have been
+// paid for, so events are spread evenly instead of arriving in bursts; time a
+// slow upstream leaves unused is not saved up for later bursts.
+func (sw *Writer) WritePaced(data []byte, tokens int) error {
+	if sw.pace <= 0 {
+		return sw.WriteRaw(data)
+	}
+	if wait := time.Until(sw.next); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-sw.paceCtx.Done():
+			timer.Stop()
+			return sw.paceCtx.Err()
+		}
+	}
+	if err := sw.WriteRaw(data); err != nil {
 		return err
 	}
-	sw.Flush()
+	now := time.Now()
+	if sw.next.Before(now) {
+		sw.next = now
+	}
+	sw.next = sw.next.Add(time.Duration(float64(tokens) / sw.pace * float64(time.Second)))
 	return nil
 }
 
@@ -0,0 +1,63 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWriter_WritePaced(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw := NewWriter(rec)
+	sw.SetPace(context.Background(), 200) // 10 tokens every 50ms
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := sw.WritePaced([]byte(`{"n":1}`), 10); err != nil {
+			t.Fatalf("WritePaced returned error: %v", err)
+		}
+	}
+	// The first event goes out right away, the next two wait for the tokens before them
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected about 100ms of pacing, took %s", elapsed)
+	}
+	if n := strings.Count(rec.Body.String(), "data: "); n != 3 {
+		t.Errorf("expected 3 events, got %d", n)
+	}
+
+	// Waiting ends with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	sw.SetPace(ctx, 1)
+	_ = sw.WritePaced([]byte(`{}`), 60)
+	cancel()
+	if err := sw.WritePaced([]byte(`{}`), 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// Without a pace events are written immediately
+	sw.SetPace(context.Background(), 0)
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		_ = sw.WritePaced([]byte(`{}`), 1000)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected unpaced writes, took %s", elapsed)
+	}
+}
+
+func TestIsClientGone(t *testing.T) {
+	brokenPipe := &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+	if !IsClientGone(brokenPipe) || !IsClientGone(fmt.Errorf("flush: %w", syscall.ECONNRESET)) {
+		t.Error("expected broken pipes and connection resets to mean the client went away")
+	}
+	if IsClientGone(errors.New("response writer hijacked")) || IsClientGone(nil) {
+		t.Error("expected other write errors to be the server's")
+	}
+}
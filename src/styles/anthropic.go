@@ -0,0 +1,525 @@
+package styles
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ================================================================================
+// Anthropic Messages API Types
+// ================================================================================
+
+// AnthropicUsage represents token usage in the Anthropic Messages API.
+// InputTokens excludes the tokens read from or written to the prompt cache.
+type AnthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// ToChatCompletions converts Anthropic usage to Chat Completions usage, where
+// prompt tokens include cache reads and writes as OpenAI counts them
+func (u AnthropicUsage) ToChatCompletions() ChatCompletionsUsage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	usage := ChatCompletionsUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+	}
+	if u.CacheCreationInputTokens > 0 || u.CacheReadInputTokens > 0 {
+		usage.PromptTokensDetails = &ChatCompletionsPromptTokensDetails{
+			CachedTokens:        u.CacheReadInputTokens,
+			CacheCreationTokens: u.CacheCreationInputTokens,
+		}
+	}
+	return usage
+}
+
+// AnthropicSource is the source of an image: base64 data or a URL
+type AnthropicSource struct {
+	Type      string `json:"type"` // base64 or url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicContentBlock is a block of a message: text, an image, a tool call
+// or result, or a thinking block
+type AnthropicContentBlock struct {
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Source    *AnthropicSource `json:"source,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   string           `json:"content,omitempty"` // Result of a tool_result block
+	Thinking  string           `json:"thinking,omitempty"`
+	Signature string           `json:"signature,omitempty"`
+}
+
+// AnthropicMessage is a turn of the conversation; Role is "user" or
+// "assistant"
+type AnthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []AnthropicContentBlock `json:"content"`
+}
+
+// AnthropicTool declares a tool the model may call
+type AnthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+// AnthropicToolChoice controls tool use: Type is auto, any, tool or none
+type AnthropicToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+// AnthropicRequest represents a Messages API request
+type AnthropicRequest struct {
+	Model         string                  `json:"model"`
+	Messages      []AnthropicMessage      `json:"messages"`
+	System        []AnthropicContentBlock `json:"system,omitempty"`
+	MaxTokens     int                     `json:"max_tokens"`
+	Temperature   *float64                `json:"temperature,omitempty"`
+	TopP          *float64                `json:"top_p,omitempty"`
+	StopSequences []string                `json:"stop_sequences,omitempty"`
+	Stream        bool                    `json:"stream,omitempty"`
+	Tools         []json.RawMessage       `json:"tools,omitempty"` // AnthropicTool or a server tool
+	ToolChoice    *AnthropicToolChoice    `json:"tool_choice,omitempty"`
+	Thinking      json.RawMessage         `json:"thinking,omitempty"`
+	Metadata      *struct {
+		UserID string `json:"user_id,omitempty"`
+	} `json:"metadata,omitempty"`
+}
+
+// AnthropicResponse represents a Messages API response
+type AnthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []AnthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason,omitempty"`
+	Usage      *AnthropicUsage         `json:"usage,omitempty"`
+}
+
+// AnthropicStreamEvent is an event of a Messages API stream. Only
+// message_start carries the message's id and model, so drivers copy them
+// onto the other events.
+type AnthropicStreamEvent struct {
+	Type         string                 `json:"type"`
+	ID           string                 `json:"id,omitempty"`
+	Model        string                 `json:"model,omitempty"`
+	Message      *AnthropicResponse     `json:"message,omitempty"`       // message_start
+	Index        int                    `json:"index"`                   // content_block_*
+	ContentBlock *AnthropicContentBlock `json:"content_block,omitempty"` // content_block_start
+	Delta        *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text,omitempty"`
+		PartialJSON string `json:"partial_json,omitempty"`
+		Thinking    string `json:"thinking,omitempty"`
+		StopReason  string `json:"stop_reason,omitempty"` // message_delta
+	} `json:"delta,omitempty"`
+	Usage *AnthropicUsage `json:"usage,omitempty"` // message_delta
+}
+
+// AnthropicDefaultMaxTokens is the max_tokens of requests setting none, as
+// the Messages API requires one
+const AnthropicDefaultMaxTokens = 4096
+
+// ================================================================================
+// Conversion Functions between Chat Completions and Anthropic Messages APIs
+// ================================================================================
+
+// ConvertChatCompletionsRequestToAnthropic converts a Chat Completions request
+// to a Messages API request. Extended thinking settings are passed through,
+// and a reasoning_effort becomes a thinking budget.
+func ConvertChatCompletionsRequestToAnthropic(reqJson PartialJSON) (PartialJSON, error) {
+	req, err := ParseChatCompletionsRequest(reqJson)
+	if err != nil {
+		return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: %w", err)
+	}
+	var messages []sourceMessage
+	if err := json.Unmarshal(reqJson["messages"], &messages); err != nil {
+		return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: failed to unmarshal messages: %w", err)
+	}
+	if req.N > 1 {
+		return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: n > 1 is not supported")
+	}
+
+	out := AnthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+	for _, msg := range messages {
+		var turn AnthropicMessage
+		switch msg.Role {
+		case "system", "developer":
+			text, err := messageText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: %s message: %w", msg.Role, err)
+			}
+			out.System = append(out.System, AnthropicContentBlock{Type: "text", Text: text})
+			continue
+		case "user":
+			blocks, err := anthropicUserBlocks(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: user message: %w", err)
+			}
+			turn = AnthropicMessage{Role: "user", Content: blocks}
+		case "assistant":
+			text, err := messageText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: assistant message: %w", err)
+			}
+			turn.Role = "assistant"
+			if text != "" {
+				turn.Content = append(turn.Content, AnthropicContentBlock{Type: "text", Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				if call.Function == nil {
+					continue
+				}
+				input := json.RawMessage(call.Function.Arguments)
+				if strings.TrimSpace(call.Function.Arguments) == "" {
+					input = json.RawMessage("{}")
+				} else if !json.Valid(input) {
+					return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: tool call %s: arguments are not JSON", call.ID)
+				}
+				turn.Content = append(turn.Content, AnthropicContentBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+		case "tool":
+			text, err := messageText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: tool message: %w", err)
+			}
+			turn = AnthropicMessage{Role: "user", Content: []AnthropicContentBlock{{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: text}}}
+		default:
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: unsupported message role %s", msg.Role)
+		}
+		if len(turn.Content) == 0 {
+			continue
+		}
+		// Turns must alternate, and the results of parallel calls share one
+		if last := len(out.Messages) - 1; last >= 0 && out.Messages[last].Role == turn.Role {
+			out.Messages[last].Content = append(out.Messages[last].Content, turn.Content...)
+		} else {
+			out.Messages = append(out.Messages, turn)
+		}
+	}
+
+	if req.MaxCompletionTokens > 0 {
+		out.MaxTokens = req.MaxCompletionTokens
+	}
+	switch stop := req.Stop.(type) {
+	case string:
+		out.StopSequences = []string{stop}
+	case []any:
+		for _, s := range stop {
+			if s, ok := s.(string); ok {
+				out.StopSequences = append(out.StopSequences, s)
+			}
+		}
+	}
+	if req.User != "" {
+		out.Metadata = &struct {
+			UserID string `json:"user_id,omitempty"`
+		}{UserID: req.User}
+	}
+	if rf := req.ResponseFormat; rf != nil && rf.Type == "json_schema" {
+		return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: unsupported response_format %s", rf.Type)
+	}
+
+	budget := 0
+	if thinking, ok := reqJson["thinking"]; ok {
+		out.Thinking = thinking
+		var settings AnthropicThinking
+		if json.Unmarshal(thinking, &settings) == nil && settings.Type == "enabled" {
+			budget = settings.BudgetTokens
+		}
+	} else if effort := TryGetFromPartialJSON[string](reqJson, "reasoning_effort"); effort != "" && effort != "none" {
+		budget = EffortToThinkingBudget(effort)
+		if out.Thinking, err = json.Marshal(AnthropicThinking{Type: "enabled", BudgetTokens: budget}); err != nil {
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: %w", err)
+		}
+	}
+	// max_tokens covers the thinking budget
+	if out.MaxTokens == 0 {
+		out.MaxTokens = AnthropicDefaultMaxTokens
+	}
+	if out.MaxTokens <= budget {
+		out.MaxTokens = budget + AnthropicDefaultMaxTokens
+	}
+
+	var tools []json.RawMessage
+	_ = json.Unmarshal(reqJson["tools"], &tools)
+	for i, tool := range req.Tools {
+		switch {
+		case tool.Function != nil:
+			schema := tool.Function.Parameters
+			if schema == nil {
+				schema = map[string]string{"type": "object"}
+			}
+			raw, err := json.Marshal(AnthropicTool{Name: tool.Function.Name, Description: tool.Function.Description, InputSchema: schema})
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: %w", err)
+			}
+			out.Tools = append(out.Tools, raw)
+		case anthropicWebSearchType.MatchString(tool.Type):
+			out.Tools = append(out.Tools, tools[i])
+		case IsWebSearchTool(tool.Type):
+			raw, err := anthropicWebSearchTool(tools[i])
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: %w", err)
+			}
+			out.Tools = append(out.Tools, raw)
+		default:
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: unsupported tool type %s", tool.Type)
+		}
+	}
+	if req.ToolChoice != nil {
+		choice := &AnthropicToolChoice{}
+		switch c := req.ToolChoice.(type) {
+		case string:
+			choice.Type = map[string]string{"none": "none", "auto": "auto", "required": "any"}[c]
+		case map[string]any:
+			if function, ok := c["function"].(map[string]any); ok {
+				if name, ok := function["name"].(string); ok {
+					choice.Type, choice.Name = "tool", name
+				}
+			}
+		}
+		if choice.Type == "" {
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: unsupported tool_choice")
+		}
+		out.ToolChoice = choice
+	}
+	if req.ParallelToolCall != nil && !*req.ParallelToolCall && len(out.Tools) > 0 {
+		if out.ToolChoice == nil {
+			out.ToolChoice = &AnthropicToolChoice{Type: "auto"}
+		}
+		if out.ToolChoice.Type != "none" {
+			out.ToolChoice.DisableParallelToolUse = true
+		}
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("ConvertChatCompletionsRequestToAnthropic: %w", err)
+	}
+	return ParsePartialJSON(data)
+}
+
+// anthropicUserBlocks converts the content of a user message, with its images
+func anthropicUserBlocks(raw json.RawMessage) ([]AnthropicContentBlock, error) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return []AnthropicContentBlock{{Type: "text", Text: text}}, nil
+	}
+	var parts []ChatCompletionsContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, err
+	}
+	var out []AnthropicContentBlock
+	for _, part := range parts {
+		switch {
+		case part.Type == "text":
+			out = append(out, AnthropicContentBlock{Type: "text", Text: part.Text})
+		case part.Type == "image_url" && part.ImageURL != nil:
+			source := &AnthropicSource{Type: "url", URL: part.ImageURL.URL}
+			if mediaType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				source = &AnthropicSource{Type: "base64", MediaType: mediaType, Data: data}
+			}
+			out = append(out, AnthropicContentBlock{Type: "image", Source: source})
+		default:
+			return nil, fmt.Errorf("unsupported content part %s", part.Type)
+		}
+	}
+	return out, nil
+}
+
+// anthropicWebSearchTool converts a web_search tool in the Responses form to
+// Anthropic's web search server tool
+func anthropicWebSearchTool(raw json.RawMessage) (json.RawMessage, error) {
+	var tool struct {
+		UserLocation map[string]json.RawMessage `json:"user_location"`
+		Filters      struct {
+			AllowedDomains []string `json:"allowed_domains"`
+		} `json:"filters"`
+	}
+	if err := json.Unmarshal(raw, &tool); err != nil {
+		return nil, err
+	}
+	res := map[string]any{"type": "web_search_20250305", "name": "web_search"}
+	if len(tool.Filters.AllowedDomains) > 0 {
+		res["allowed_domains"] = tool.Filters.AllowedDomains
+	}
+	if tool.UserLocation != nil {
+		res["user_location"] = tool.UserLocation
+	}
+	return json.Marshal(res)
+}
+
+// ConvertAnthropicResponseToChatCompletions converts a Messages API response
+// to Chat Completions format
+func ConvertAnthropicResponseToChatCompletions(respJson PartialJSON) (PartialJSON, error) {
+	data, err := respJson.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("ConvertAnthropicResponseToChatCompletions: %w", err)
+	}
+	var ares AnthropicResponse
+	if err := json.Unmarshal(data, &ares); err != nil {
+		return nil, fmt.Errorf("ConvertAnthropicResponseToChatCompletions: %w", err)
+	}
+
+	message := map[string]any{"role": "assistant"}
+	var text, thinking strings.Builder
+	var toolCalls []map[string]any
+	for _, block := range ares.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "thinking":
+			thinking.WriteString(block.Thinking)
+		case "tool_use":
+			args := string(block.Input)
+			if args == "" {
+				args = "{}"
+			}
+			toolCalls = append(toolCalls, map[string]any{
+				"index":    len(toolCalls),
+				"id":       block.ID,
+				"type":     "function",
+				"function": map[string]string{"name": block.Name, "arguments": args},
+			})
+		}
+	}
+	message["content"] = text.String()
+	if thinking.Len() > 0 {
+		message["reasoning_content"] = thinking.String()
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+
+	res := map[string]any{
+		"id":      ares.ID,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   ares.Model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       message,
+			"finish_reason": anthropicFinishReason(ares.StopReason),
+		}},
+	}
+	if ares.Usage != nil {
+		res["usage"] = ares.Usage.ToChatCompletions()
+	}
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("ConvertAnthropicResponseToChatCompletions: %w", err)
+	}
+	return ParsePartialJSON(out)
+}
+
+// ConvertAnthropicResponseChunkToChatCompletions converts an event of a
+// Messages API stream to a Chat Completions chunk. Events carrying nothing
+// for the client, like pings and block ends, convert to nil.
+func ConvertAnthropicResponseChunkToChatCompletions(chunkJson PartialJSON) (PartialJSON, error) {
+	data, err := chunkJson.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("ConvertAnthropicResponseChunkToChatCompletions: %w", err)
+	}
+	var event AnthropicStreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("ConvertAnthropicResponseChunkToChatCompletions: %w", err)
+	}
+
+	delta := map[string]any{}
+	choice := map[string]any{"index": 0, "delta": delta, "finish_reason": nil}
+	res := map[string]any{
+		"id":      event.ID,
+		"object":  "chat.completion.chunk",
+		"created": time.Now().Unix(),
+		"model":   event.Model,
+		"choices": []map[string]any{choice},
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			res["id"], res["model"] = event.Message.ID, event.Message.Model
+		}
+		delta["role"], delta["content"] = "assistant", ""
+	case "content_block_start":
+		block := event.ContentBlock
+		if block == nil || block.Type != "tool_use" {
+			return nil, nil
+		}
+		// Block indexes stand in for tool call indexes; the stream's tool
+		// call normalizer renumbers them
+		delta["tool_calls"] = []map[string]any{{
+			"index":    event.Index,
+			"id":       block.ID,
+			"type":     "function",
+			"function": map[string]string{"name": block.Name, "arguments": ""},
+		}}
+	case "content_block_delta":
+		if event.Delta == nil {
+			return nil, nil
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			delta["content"] = event.Delta.Text
+		case "thinking_delta":
+			delta["reasoning_content"] = event.Delta.Thinking
+		case "input_json_delta":
+			delta["tool_calls"] = []map[string]any{{
+				"index":    event.Index,
+				"function": map[string]string{"arguments": event.Delta.PartialJSON},
+			}}
+		default:
+			return nil, nil
+		}
+	case "message_delta":
+		if event.Delta != nil && event.Delta.StopReason != "" {
+			choice["finish_reason"] = anthropicFinishReason(event.Delta.StopReason)
+		}
+		if event.Usage != nil {
+			res["usage"] = event.Usage.ToChatCompletions()
+		}
+	default:
+		return nil, nil
+	}
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("ConvertAnthropicResponseChunkToChatCompletions: %w", err)
+	}
+	return ParsePartialJSON(out)
+}
+
+// anthropicFinishReason maps a Messages API stop reason to Chat Completions
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
@@ -0,0 +1,115 @@
+package styles
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestConvertChatCompletionsRequestToAnthropic(t *testing.T) {
+	req, _ := ParsePartialJSON([]byte(`{
+		"model": "claude-sonnet-4-5",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "Weather?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBO"}}]},
+			{"role": "assistant", "tool_calls": [
+				{"id": "toolu_1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\": \"Paris\"}"}},
+				{"id": "toolu_2", "type": "function", "function": {"name": "weather", "arguments": "{\"city\": \"Rome\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "toolu_1", "content": "sunny"},
+			{"role": "tool", "tool_call_id": "toolu_2", "content": "rainy"}
+		],
+		"stop": ["END"],
+		"reasoning_effort": "medium",
+		"tools": [{"type": "function", "function": {"name": "weather", "parameters": {"type": "object"}}}],
+		"tool_choice": "required",
+		"parallel_tool_calls": false
+	}`))
+	converted, err := ConvertChatCompletionsRequestToAnthropic(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := converted.Marshal()
+	var got AnthropicRequest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != "claude-sonnet-4-5" || len(got.System) != 1 || got.System[0].Text != "Be brief." {
+		t.Errorf("model = %s, system = %+v", got.Model, got.System)
+	}
+	if len(got.Messages) != 3 {
+		t.Fatalf("messages = %+v", got.Messages)
+	}
+	user, assistant, results := got.Messages[0], got.Messages[1], got.Messages[2]
+	if user.Role != "user" || len(user.Content) != 2 || user.Content[1].Source == nil || user.Content[1].Source.MediaType != "image/png" {
+		t.Errorf("user message = %+v", user)
+	}
+	if assistant.Role != "assistant" || len(assistant.Content) != 2 || assistant.Content[0].Type != "tool_use" || string(assistant.Content[0].Input) != `{"city":"Paris"}` {
+		t.Errorf("assistant message = %+v", assistant)
+	}
+	if results.Role != "user" || len(results.Content) != 2 || results.Content[1].ToolUseID != "toolu_2" {
+		t.Errorf("tool results should share one user message, got %+v", results)
+	}
+	var thinking AnthropicThinking
+	_ = json.Unmarshal(got.Thinking, &thinking)
+	if thinking.Type != "enabled" || thinking.BudgetTokens != 8192 || got.MaxTokens <= thinking.BudgetTokens {
+		t.Errorf("thinking = %+v with max_tokens %d", thinking, got.MaxTokens)
+	}
+	if len(got.StopSequences) != 1 || got.ToolChoice == nil || got.ToolChoice.Type != "any" || !got.ToolChoice.DisableParallelToolUse {
+		t.Errorf("stop_sequences = %v, tool_choice = %+v", got.StopSequences, got.ToolChoice)
+	}
+}
+
+func TestConvertAnthropicResponseToChatCompletions(t *testing.T) {
+	res, _ := ParsePartialJSON([]byte(`{
+		"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4-5",
+		"content": [
+			{"type": "thinking", "thinking": "Checking.", "signature": "sig"},
+			{"type": "text", "text": "Let me look."},
+			{"type": "tool_use", "id": "toolu_1", "name": "weather", "input": {"city": "Paris"}}
+		],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 10, "output_tokens": 5, "cache_read_input_tokens": 90}
+	}`))
+	converted, err := ConvertAnthropicResponseToChatCompletions(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseChatCompletionsResponse(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := got.Choices[0]
+	if choice.FinishReason != "tool_calls" || choice.Message.Content != "Let me look." || choice.Message.ReasoningContent != "Checking." {
+		t.Errorf("choice = %+v", choice)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("tool calls = %+v", choice.Message.ToolCalls)
+	}
+	if got.Usage == nil || got.Usage.PromptTokens != 100 || got.Usage.PromptTokensDetails.CachedTokens != 90 {
+		t.Errorf("usage = %+v", got.Usage)
+	}
+
+	// Stream events convert on their own, given the id and model the driver adds
+	for event, want := range map[string]string{
+		`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hi"}}`:                 `"content":"Hi"`,
+		`{"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "{\"c"}}`: `"arguments":"{\"c"`,
+		`{"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 7}}`:             `"finish_reason":"stop"`,
+	} {
+		chunk, _ := ParsePartialJSON([]byte(event))
+		chunk["id"] = json.RawMessage(`"msg_1"`)
+		converted, err := ConvertAnthropicResponseChunkToChatCompletions(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := converted.Marshal()
+		if !json.Valid(data) || !strings.Contains(string(data), want) || !strings.Contains(string(data), `"id":"msg_1"`) {
+			t.Errorf("chunk of %s = %s, want %s", event, data, want)
+		}
+	}
+	start, _ := ParsePartialJSON([]byte(`{"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}`))
+	if converted, err := ConvertAnthropicResponseChunkToChatCompletions(start); err != nil || converted != nil {
+		t.Errorf("expected text block start to convert to nil, got %s, %v", converted, err)
+	}
+}
@@ -0,0 +1,32 @@
+package styles
+
+import (
+	"regexp"
+	"strings"
+)
+
+// anthropicWebSearchType matches the versioned type of Anthropic's web search
+// server tool, e.g. web_search_20250305
+var anthropicWebSearchType = regexp.MustCompile(`^web_search_\d{8}$`)
+
+// anthropicComputerType matches the versioned type of Anthropic's computer
+// use tool, e.g. computer_20250124
+var anthropicComputerType = regexp.MustCompile(`^computer_\d{8}$`)
+
+// IsWebSearchTool reports whether a tool type is a built-in web search tool
+// of any dialect: OpenAI's web_search and web_search_preview, or Anthropic's
+// web_search_20250305
+func IsWebSearchTool(toolType string) bool {
+	return toolType == "web_search" ||
+		strings.HasPrefix(toolType, "web_search_preview") ||
+		anthropicWebSearchType.MatchString(toolType)
+}
+
+// IsComputerUseTool reports whether a tool type lets the model operate a
+// computer or browser: OpenAI's computer_use_preview or Anthropic's
+// computer_20250124
+func IsComputerUseTool(toolType string) bool {
+	return toolType == "computer_use" ||
+		strings.HasPrefix(toolType, "computer_use_preview") ||
+		anthropicComputerType.MatchString(toolType)
+}
@@ -26,6 +26,15 @@ type ChatCompletionsTool struct {
 	Function *ChatCompletionsToolFunction `json:"function,omitempty"`
 }
 
+// Name returns the function name for function tools and the tool type otherwise
+// (e.g., "web_search", "computer_use")
+func (t ChatCompletionsTool) Name() string {
+	if t.Function != nil && t.Function.Name != "" {
+		return t.Function.Name
+	}
+	return t.Type
+}
+
 // ChatCompletionsToolFunction defines a function for tool calling
 type ChatCompletionsToolFunction struct {
 	Name        string `json:"name"`
@@ -72,6 +81,9 @@ type ChatCompletionsMessage struct {
 	ToolCallID string                    `json:"tool_call_id,omitempty"`
 	Refusal    string                    `json:"refusal,omitempty"`
 	ToolCalls  []ChatCompletionsToolCall `json:"tool_calls,omitempty"`
+	// ReasoningContent carries the model's reasoning, as streamed by
+	// reasoning models of OpenAI-compatible providers; not part of the OpenAI API
+	ReasoningContent string `json:"reasoning_content,omitempty"`
 }
 
 // ChatCompletionsRequest represents a full Chat Completions API request
@@ -113,9 +125,85 @@ type ChatCompletionsRequest struct {
 
 // ChatCompletionsUsage represents token usage statistics
 type ChatCompletionsUsage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                                     `json:"prompt_tokens"`
+	CompletionTokens        int                                     `json:"completion_tokens"`
+	TotalTokens             int                                     `json:"total_tokens"`
+	PromptTokensDetails     *ChatCompletionsPromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *ChatCompletionsCompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// ChatCompletionsPromptTokensDetails breaks down prompt tokens; all counts are
+// included in PromptTokens
+type ChatCompletionsPromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens,omitempty"`
+	// CacheCreationTokens were written to the provider's prompt cache
+	// (Anthropic cache_creation_input_tokens); not part of the OpenAI API
+	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"`
+	AudioTokens         int `json:"audio_tokens,omitempty"`
+	TextTokens          int `json:"text_tokens,omitempty"`
+	ImageTokens         int `json:"image_tokens,omitempty"`
+}
+
+// ChatCompletionsCompletionTokensDetails breaks down completion tokens; all
+// counts are included in CompletionTokens
+type ChatCompletionsCompletionTokensDetails struct {
+	ReasoningTokens          int `json:"reasoning_tokens,omitempty"`
+	AudioTokens              int `json:"audio_tokens,omitempty"`
+	TextTokens               int `json:"text_tokens,omitempty"`
+	AcceptedPredictionTokens int `json:"accepted_prediction_tokens,omitempty"`
+	RejectedPredictionTokens int `json:"rejected_prediction_tokens,omitempty"`
+}
+
+// ToResponses converts Chat Completions usage to Responses API usage
+func (u ChatCompletionsUsage) ToResponses() ResponsesUsage {
+	usage := ResponsesUsage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+		TotalTokens:  u.TotalTokens,
+	}
+	if d := u.PromptTokensDetails; d != nil {
+		usage.InputTokensDetails = &ResponsesInputTokensDetails{
+			CachedTokens: d.CachedTokens,
+			AudioTokens:  d.AudioTokens,
+			TextTokens:   d.TextTokens,
+			ImageTokens:  d.ImageTokens,
+		}
+	}
+	if d := u.CompletionTokensDetails; d != nil {
+		usage.OutputTokensDetails = &ResponsesOutputTokensDetails{
+			ReasoningTokens: d.ReasoningTokens,
+			AudioTokens:     d.AudioTokens,
+			TextTokens:      d.TextTokens,
+		}
+	}
+	return usage
+}
+
+// Add accumulates other into u, including token details
+func (u *ChatCompletionsUsage) Add(other ChatCompletionsUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	if d := other.PromptTokensDetails; d != nil {
+		if u.PromptTokensDetails == nil {
+			u.PromptTokensDetails = &ChatCompletionsPromptTokensDetails{}
+		}
+		u.PromptTokensDetails.CachedTokens += d.CachedTokens
+		u.PromptTokensDetails.CacheCreationTokens += d.CacheCreationTokens
+		u.PromptTokensDetails.AudioTokens += d.AudioTokens
+		u.PromptTokensDetails.TextTokens += d.TextTokens
+		u.PromptTokensDetails.ImageTokens += d.ImageTokens
+	}
+	if d := other.CompletionTokensDetails; d != nil {
+		if u.CompletionTokensDetails == nil {
+			u.CompletionTokensDetails = &ChatCompletionsCompletionTokensDetails{}
+		}
+		u.CompletionTokensDetails.ReasoningTokens += d.ReasoningTokens
+		u.CompletionTokensDetails.AudioTokens += d.AudioTokens
+		u.CompletionTokensDetails.TextTokens += d.TextTokens
+		u.CompletionTokensDetails.AcceptedPredictionTokens += d.AcceptedPredictionTokens
+		u.CompletionTokensDetails.RejectedPredictionTokens += d.RejectedPredictionTokens
+	}
 }
 
 // ChatCompletionsChoice represents a completion choice
@@ -173,3 +261,36 @@ func ParseChatCompletionsResponse(resJson PartialJSON) (*ChatCompletionsResponse
 	}
 	return &res, nil
 }
+
+// RenameMessageRole returns a copy of a request whose messages of role from
+// have role to, keeping every other message field; requests without such
+// messages are returned as is
+func RenameMessageRole(reqJson PartialJSON, from, to string) (PartialJSON, error) {
+	raw, ok := reqJson["messages"]
+	if !ok {
+		return reqJson, nil
+	}
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &messages); err != nil {
+		return nil, err
+	}
+	fromRole, err := json.Marshal(from)
+	if err != nil {
+		return nil, err
+	}
+	toRole, err := json.Marshal(to)
+	if err != nil {
+		return nil, err
+	}
+	renamed := false
+	for _, message := range messages {
+		if string(message["role"]) == string(fromRole) {
+			message["role"] = toRole
+			renamed = true
+		}
+	}
+	if !renamed {
+		return reqJson, nil
+	}
+	return reqJson.CloneWith("messages", messages)
+}
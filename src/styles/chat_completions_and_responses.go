@@ -17,23 +17,53 @@ func ConvertChatCompletionsRequestToResponses(reqJson PartialJSON) (PartialJSON,
 	if messages, ok := res["messages"]; ok {
 		res["input"] = messages
 		delete(res, "messages")
+		if err := dropReasoningContent(res, "input"); err != nil {
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToResponses: %w", err)
+		}
+	}
+
+	// 2. Rename max_completion_tokens or max_tokens -> max_output_tokens,
+	// preferring the newer field when both are set
+	for _, field := range []string{"max_tokens", "max_completion_tokens"} {
+		if maxTokens, ok := res[field]; ok {
+			res["max_output_tokens"] = maxTokens
+			delete(res, field)
+		}
 	}
 
-	// 2. Rename max_tokens -> max_output_tokens
-	if maxTokens, ok := res["max_tokens"]; ok {
-		res["max_output_tokens"] = maxTokens
-		delete(res, "max_tokens")
+	// 3. Move reasoning_effort -> reasoning.effort
+	if effort, ok := res["reasoning_effort"]; ok {
+		reasoning := map[string]json.RawMessage{}
+		if raw, ok := res["reasoning"]; ok {
+			if err := json.Unmarshal(raw, &reasoning); err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToResponses: failed to unmarshal reasoning: %w", err)
+			}
+		}
+		reasoning["effort"] = effort
+		if err := res.Set("reasoning", reasoning); err != nil {
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToResponses: failed to set reasoning: %w", err)
+		}
+		delete(res, "reasoning_effort")
 	}
 
-	// 3. Convert tools if present
+	// 4. Convert tools if present
 	if toolsRaw, ok := res["tools"]; ok {
-		var chatTools []ChatCompletionsTool
-		if err := json.Unmarshal(toolsRaw, &chatTools); err != nil {
+		var rawTools []json.RawMessage
+		if err := json.Unmarshal(toolsRaw, &rawTools); err != nil {
 			return nil, fmt.Errorf("ConvertChatCompletionsRequestToResponses: failed to unmarshal tools: %w", err)
 		}
 
-		var respTools []ResponsesTool
-		for _, tool := range chatTools {
+		var respTools []any
+		for _, raw := range rawTools {
+			var tool ChatCompletionsTool
+			if err := json.Unmarshal(raw, &tool); err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToResponses: failed to unmarshal tool: %w", err)
+			}
+			if tool.Type != "function" && tool.Function == nil {
+				// Built-in tools such as web_search take the same form in both APIs
+				respTools = append(respTools, raw)
+				continue
+			}
 			respTool := ResponsesTool{
 				Type: tool.Type,
 			}
@@ -54,6 +84,28 @@ func ConvertChatCompletionsRequestToResponses(reqJson PartialJSON) (PartialJSON,
 	return res, nil
 }
 
+// dropReasoningContent removes the reasoning_content that DeepSeek-style
+// assistant messages carry from the messages under key. The Responses API only
+// takes back reasoning items it produced itself, so reasoning from other
+// providers can't be replayed.
+func dropReasoningContent(res PartialJSON, key string) error {
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(res[key], &messages); err != nil {
+		return nil // not a message list, e.g. a plain string input
+	}
+	dropped := false
+	for _, msg := range messages {
+		if _, ok := msg["reasoning_content"]; ok {
+			delete(msg, "reasoning_content")
+			dropped = true
+		}
+	}
+	if !dropped {
+		return nil
+	}
+	return res.Set(key, messages)
+}
+
 // ConvertResponsesResponseToChatCompletions converts a Responses API response to Chat Completions format
 func ConvertResponsesResponseToChatCompletions(respJson PartialJSON) (PartialJSON, error) {
 	res := respJson.Clone()
@@ -72,16 +124,26 @@ func ConvertResponsesResponseToChatCompletions(respJson PartialJSON) (PartialJSO
 		}
 
 		var choices []ChatCompletionsChoice
-		for i, item := range outputItems {
+		reasoning := ""
+		for _, item := range outputItems {
+			if item.Type == "reasoning" {
+				// Reasoning summaries go with the message that follows them
+				for _, part := range item.Summary {
+					reasoning += part.Text
+				}
+				continue
+			}
 			if item.Type == "message" {
 				choice := ChatCompletionsChoice{
-					Index: i,
+					Index: len(choices),
 					Message: &ChatCompletionsMessage{
-						Role:    item.Role,
-						Content: item.Content,
+						Role:             item.Role,
+						Content:          item.Content,
+						ReasoningContent: reasoning,
 					},
 					FinishReason: "stop", // Default
 				}
+				reasoning = ""
 				choices = append(choices, choice)
 			}
 			// TODO: handle function calls
@@ -100,13 +162,7 @@ func ConvertResponsesResponseToChatCompletions(respJson PartialJSON) (PartialJSO
 			return nil, fmt.Errorf("ConvertResponsesResponseToChatCompletions: failed to unmarshal usage: %w", err)
 		}
 
-		chatUsage := ChatCompletionsUsage{
-			PromptTokens:     respUsage.InputTokens,
-			CompletionTokens: respUsage.OutputTokens,
-			TotalTokens:      respUsage.TotalTokens,
-		}
-
-		if err := res.Set("usage", chatUsage); err != nil {
+		if err := res.Set("usage", respUsage.ToChatCompletions()); err != nil {
 			return nil, fmt.Errorf("ConvertResponsesResponseToChatCompletions: failed to set usage: %w", err)
 		}
 	}
@@ -134,6 +190,13 @@ func ConvertResponsesResponseChunkToChatCompletions(chunkJson PartialJSON) (Part
 			Content: delta,
 		}, "")
 
+	case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+		// Reasoning delta, streamed as reasoning_content like other reasoning models
+		delta := TryGetFromPartialJSON[string](chunkJson, "delta")
+		return buildChatCompletionsChunk(chunkJson, &ChatCompletionsMessage{
+			ReasoningContent: delta,
+		}, "")
+
 	case "response.function_call_arguments.delta":
 		// Tool call arguments delta
 		delta := TryGetFromPartialJSON[string](chunkJson, "delta")
@@ -209,11 +272,7 @@ func ConvertResponsesResponseChunkToChatCompletions(chunkJson PartialJSON) (Part
 			if err := json.Unmarshal(id, &resp); err == nil {
 				res.Set("id", resp.ID)
 				res.Set("model", resp.Model)
-				res.Set("usage", ChatCompletionsUsage{
-					PromptTokens:     resp.Usage.InputTokens,
-					CompletionTokens: resp.Usage.OutputTokens,
-					TotalTokens:      resp.Usage.TotalTokens,
-				})
+				res.Set("usage", resp.Usage.ToChatCompletions())
 			}
 		}
 
@@ -0,0 +1,180 @@
+package styles
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// streamChoice collects the deltas of one choice of a streamed completion
+type streamChoice struct {
+	role string
+	// text holds the concatenated string fields of the deltas (content,
+	// refusal, reasoning_content, ...) in order of first appearance
+	text      map[string]*strings.Builder
+	fields    []string
+	toolCalls map[int]*ChatCompletionsToolCall
+	finish    string
+}
+
+// AssembleChatCompletionsStream reassembles the chunks of a streamed chat
+// completion into the response a non-streaming request would have returned:
+// string delta fields are concatenated, tool calls are merged by index and the
+// usage of the last chunk carrying one is kept.
+func AssembleChatCompletionsStream(chunks []PartialJSON) (PartialJSON, error) {
+	res := PartialJSON{}
+	choices := map[int]*streamChoice{}
+
+	for _, chunk := range chunks {
+		for _, key := range []string{"id", "created", "model", "system_fingerprint", "service_tier"} {
+			if _, ok := res[key]; !ok && !isNullJSON(chunk[key]) {
+				res[key] = chunk[key]
+			}
+		}
+		for _, key := range []string{"usage", "extras"} {
+			if !isNullJSON(chunk[key]) {
+				res[key] = chunk[key]
+			}
+		}
+
+		var chunkChoices []struct {
+			Index        int                        `json:"index"`
+			Delta        map[string]json.RawMessage `json:"delta"`
+			FinishReason string                     `json:"finish_reason"`
+		}
+		if raw, ok := chunk["choices"]; ok {
+			if err := json.Unmarshal(raw, &chunkChoices); err != nil {
+				return nil, err
+			}
+		}
+		for _, cc := range chunkChoices {
+			c := choices[cc.Index]
+			if c == nil {
+				c = &streamChoice{text: map[string]*strings.Builder{}, toolCalls: map[int]*ChatCompletionsToolCall{}}
+				choices[cc.Index] = c
+			}
+			if cc.FinishReason != "" {
+				c.finish = cc.FinishReason
+			}
+			if err := c.add(cc.Delta); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	indexes := make([]int, 0, len(choices))
+	for i := range choices {
+		indexes = append(indexes, i)
+	}
+	slices.Sort(indexes)
+
+	out := make([]map[string]any, len(indexes))
+	for i, index := range indexes {
+		c := choices[index]
+		var finish any
+		if c.finish != "" {
+			finish = c.finish
+		}
+		out[i] = map[string]any{
+			"index":         index,
+			"message":       c.message(),
+			"finish_reason": finish,
+		}
+	}
+	if err := res.Set("object", "chat.completion"); err != nil {
+		return nil, err
+	}
+	if err := res.Set("choices", out); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// add merges one delta into the choice
+func (c *streamChoice) add(delta map[string]json.RawMessage) error {
+	for key, raw := range delta {
+		switch key {
+		case "role":
+			if err := json.Unmarshal(raw, &c.role); err != nil {
+				return err
+			}
+		case "tool_calls":
+			var calls []ChatCompletionsToolCall
+			if err := json.Unmarshal(raw, &calls); err != nil {
+				return err
+			}
+			for _, call := range calls {
+				c.addToolCall(call)
+			}
+		default:
+			var s string
+			if json.Unmarshal(raw, &s) != nil {
+				continue // null or non-string fields carry nothing to concatenate
+			}
+			b := c.text[key]
+			if b == nil {
+				b = &strings.Builder{}
+				c.text[key] = b
+				c.fields = append(c.fields, key)
+			}
+			b.WriteString(s)
+		}
+	}
+	return nil
+}
+
+// addToolCall merges a tool call fragment: the first fragment of an index
+// carries the ID and name, later ones append to the arguments
+func (c *streamChoice) addToolCall(call ChatCompletionsToolCall) {
+	tc := c.toolCalls[call.Index]
+	if tc == nil {
+		tc = &ChatCompletionsToolCall{Index: call.Index}
+		tc.Function = &struct {
+			Name      string `json:"name,omitempty"`
+			Arguments string `json:"arguments,omitempty"`
+		}{}
+		c.toolCalls[call.Index] = tc
+	}
+	if call.ID != "" {
+		tc.ID = call.ID
+	}
+	if call.Type != "" {
+		tc.Type = call.Type
+	}
+	if call.Function != nil {
+		tc.Function.Name += call.Function.Name
+		tc.Function.Arguments += call.Function.Arguments
+	}
+}
+
+// message builds the assembled message of the choice
+func (c *streamChoice) message() map[string]any {
+	role := c.role
+	if role == "" {
+		role = "assistant"
+	}
+	msg := map[string]any{"role": role, "content": nil}
+	for _, field := range c.fields {
+		msg[field] = c.text[field].String()
+	}
+	if len(c.toolCalls) > 0 {
+		indexes := make([]int, 0, len(c.toolCalls))
+		for i := range c.toolCalls {
+			indexes = append(indexes, i)
+		}
+		slices.Sort(indexes)
+		calls := make([]*ChatCompletionsToolCall, len(indexes))
+		for i, index := range indexes {
+			calls[i] = c.toolCalls[index]
+			if calls[i].Type == "" {
+				calls[i].Type = "function"
+			}
+		}
+		msg["tool_calls"] = calls
+	}
+	return msg
+}
+
+func isNullJSON(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
@@ -0,0 +1,578 @@
+package styles
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ================================================================================
+// Google Gemini API Types (generateContent / streamGenerateContent)
+// ================================================================================
+
+// GeminiBlob is inline media data
+type GeminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // base64
+}
+
+// GeminiFileData references media by URI
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// GeminiFunctionCall is a function call predicted by the model
+type GeminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// GeminiFunctionResponse is the result of a function call sent back to the model
+type GeminiFunctionResponse struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Response any    `json:"response"` // a JSON object
+}
+
+// GeminiPart is one part of a content: text, media or a function call or result
+type GeminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"` // Text is a thought summary
+	InlineData       *GeminiBlob             `json:"inlineData,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// GeminiContent is a turn of the conversation; Role is "user" or "model"
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+// GeminiFunctionDeclaration declares a function the model may call
+type GeminiFunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parametersJsonSchema,omitempty"`
+}
+
+// GeminiTool is a set of function declarations or a built-in tool
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations,omitempty"`
+	GoogleSearch         *struct{}                   `json:"googleSearch,omitempty"`
+}
+
+// GeminiFunctionCallingConfig controls function calling: Mode is AUTO, ANY
+// or NONE
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+// GeminiToolConfig configures the tools of a request
+type GeminiToolConfig struct {
+	FunctionCallingConfig *GeminiFunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+// GeminiThinkingConfig configures the reasoning of thinking models
+type GeminiThinkingConfig struct {
+	ThinkingBudget  *int `json:"thinkingBudget,omitempty"`
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
+}
+
+// GeminiGenerationConfig holds the generation controls of a request
+type GeminiGenerationConfig struct {
+	Temperature        *float64              `json:"temperature,omitempty"`
+	TopP               *float64              `json:"topP,omitempty"`
+	MaxOutputTokens    int                   `json:"maxOutputTokens,omitempty"`
+	StopSequences      []string              `json:"stopSequences,omitempty"`
+	CandidateCount     int                   `json:"candidateCount,omitempty"`
+	Seed               *int                  `json:"seed,omitempty"`
+	PresencePenalty    *float64              `json:"presencePenalty,omitempty"`
+	FrequencyPenalty   *float64              `json:"frequencyPenalty,omitempty"`
+	ResponseMimeType   string                `json:"responseMimeType,omitempty"`
+	ResponseJSONSchema any                   `json:"responseJsonSchema,omitempty"`
+	ThinkingConfig     *GeminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// GeminiRequest represents a generateContent request. The model is part of
+// the URL, not the body.
+type GeminiRequest struct {
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+	ToolConfig        *GeminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	SafetySettings    json.RawMessage         `json:"safetySettings,omitempty"`
+}
+
+// GeminiUsageMetadata represents token usage in the Gemini API.
+// CandidatesTokenCount excludes the thinking tokens.
+type GeminiUsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount,omitempty"`
+}
+
+// ToChatCompletions converts Gemini usage to Chat Completions usage, where
+// completion tokens include the reasoning tokens
+func (u GeminiUsageMetadata) ToChatCompletions() ChatCompletionsUsage {
+	usage := ChatCompletionsUsage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if u.CachedContentTokenCount > 0 {
+		usage.PromptTokensDetails = &ChatCompletionsPromptTokensDetails{CachedTokens: u.CachedContentTokenCount}
+	}
+	if u.ThoughtsTokenCount > 0 {
+		usage.CompletionTokensDetails = &ChatCompletionsCompletionTokensDetails{ReasoningTokens: u.ThoughtsTokenCount}
+	}
+	return usage
+}
+
+// GeminiCandidate is one generated answer
+type GeminiCandidate struct {
+	Index        int           `json:"index"`
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+}
+
+// GeminiResponse represents a generateContent response, or one chunk of a
+// streamGenerateContent stream
+type GeminiResponse struct {
+	Candidates     []GeminiCandidate    `json:"candidates"`
+	UsageMetadata  *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion   string               `json:"modelVersion,omitempty"`
+	ResponseID     string               `json:"responseId,omitempty"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason,omitempty"`
+	} `json:"promptFeedback,omitempty"`
+}
+
+// geminiThinkingBudgets maps reasoning efforts to thinking budgets in tokens
+var geminiThinkingBudgets = map[string]int{
+	"none":    0,
+	"minimal": 0,
+	"low":     1024,
+	"medium":  8192,
+	"high":    24576,
+}
+
+// ================================================================================
+// Conversion Functions between Chat Completions and Gemini APIs
+// ================================================================================
+
+// sourceMessage is a Chat Completions message with its content unparsed
+type sourceMessage struct {
+	Role       string                    `json:"role"`
+	Content    json.RawMessage           `json:"content"`
+	ToolCallID string                    `json:"tool_call_id"`
+	ToolCalls  []ChatCompletionsToolCall `json:"tool_calls"`
+}
+
+// ConvertChatCompletionsRequestToGemini converts a Chat Completions request to
+// a Gemini generateContent body. The result keeps "model" for the driver,
+// which puts it in the URL.
+func ConvertChatCompletionsRequestToGemini(reqJson PartialJSON) (PartialJSON, error) {
+	req, err := ParseChatCompletionsRequest(reqJson)
+	if err != nil {
+		return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: %w", err)
+	}
+	var messages []sourceMessage
+	if err := json.Unmarshal(reqJson["messages"], &messages); err != nil {
+		return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: failed to unmarshal messages: %w", err)
+	}
+
+	var out GeminiRequest
+	// Function results name their function, which Chat Completions only
+	// gives with the call
+	callNames := map[string]string{}
+	for _, msg := range messages {
+		var content GeminiContent
+		switch msg.Role {
+		case "system", "developer":
+			text, err := messageText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: %s message: %w", msg.Role, err)
+			}
+			if out.SystemInstruction == nil {
+				out.SystemInstruction = &GeminiContent{}
+			}
+			out.SystemInstruction.Parts = append(out.SystemInstruction.Parts, GeminiPart{Text: text})
+			continue
+		case "user":
+			parts, err := geminiUserParts(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: user message: %w", err)
+			}
+			content = GeminiContent{Role: "user", Parts: parts}
+		case "assistant":
+			text, err := messageText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: assistant message: %w", err)
+			}
+			content.Role = "model"
+			if text != "" {
+				content.Parts = append(content.Parts, GeminiPart{Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				if call.Function == nil {
+					continue
+				}
+				callNames[call.ID] = call.Function.Name
+				args := json.RawMessage(call.Function.Arguments)
+				if strings.TrimSpace(call.Function.Arguments) == "" {
+					args = json.RawMessage("{}")
+				} else if !json.Valid(args) {
+					return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: tool call %s: arguments are not JSON", call.ID)
+				}
+				content.Parts = append(content.Parts, GeminiPart{FunctionCall: &GeminiFunctionCall{Name: call.Function.Name, Args: args}})
+			}
+		case "tool":
+			text, err := messageText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: tool message: %w", err)
+			}
+			name, ok := callNames[msg.ToolCallID]
+			if !ok {
+				return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: tool message for unknown call %s", msg.ToolCallID)
+			}
+			// The response must be an object
+			var response any = map[string]string{"content": text}
+			var object map[string]any
+			if json.Unmarshal([]byte(text), &object) == nil && object != nil {
+				response = object
+			}
+			content = GeminiContent{Role: "user", Parts: []GeminiPart{{FunctionResponse: &GeminiFunctionResponse{Name: name, Response: response}}}}
+		default:
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: unsupported message role %s", msg.Role)
+		}
+		if len(content.Parts) == 0 {
+			continue
+		}
+		// Gemini expects turns to alternate, so consecutive ones are merged
+		if last := len(out.Contents) - 1; last >= 0 && out.Contents[last].Role == content.Role {
+			out.Contents[last].Parts = append(out.Contents[last].Parts, content.Parts...)
+		} else {
+			out.Contents = append(out.Contents, content)
+		}
+	}
+
+	config := &GeminiGenerationConfig{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		MaxOutputTokens:  req.MaxTokens,
+		Seed:             req.Seed,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+	}
+	if req.MaxCompletionTokens > 0 {
+		config.MaxOutputTokens = req.MaxCompletionTokens
+	}
+	if req.N > 1 {
+		config.CandidateCount = req.N
+	}
+	switch stop := req.Stop.(type) {
+	case string:
+		config.StopSequences = []string{stop}
+	case []any:
+		for _, s := range stop {
+			if s, ok := s.(string); ok {
+				config.StopSequences = append(config.StopSequences, s)
+			}
+		}
+	}
+	if rf := req.ResponseFormat; rf != nil {
+		switch rf.Type {
+		case "json_object":
+			config.ResponseMimeType = "application/json"
+		case "json_schema":
+			config.ResponseMimeType = "application/json"
+			if rf.JSONSchema != nil {
+				config.ResponseJSONSchema = rf.JSONSchema.Schema
+			}
+		}
+	}
+	if effort := TryGetFromPartialJSON[string](reqJson, "reasoning_effort"); effort != "" {
+		budget, ok := geminiThinkingBudgets[effort]
+		if !ok {
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: unsupported reasoning_effort %s", effort)
+		}
+		config.ThinkingConfig = &GeminiThinkingConfig{ThinkingBudget: &budget, IncludeThoughts: budget > 0}
+	}
+	out.GenerationConfig = config
+
+	var declarations []GeminiFunctionDeclaration
+	for _, tool := range req.Tools {
+		switch {
+		case tool.Function != nil:
+			declarations = append(declarations, GeminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			})
+		case IsWebSearchTool(tool.Type):
+			out.Tools = append(out.Tools, GeminiTool{GoogleSearch: &struct{}{}})
+		default:
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: unsupported tool type %s", tool.Type)
+		}
+	}
+	if len(declarations) > 0 {
+		out.Tools = append(out.Tools, GeminiTool{FunctionDeclarations: declarations})
+	}
+	if req.ToolChoice != nil {
+		calling := &GeminiFunctionCallingConfig{}
+		switch choice := req.ToolChoice.(type) {
+		case string:
+			calling.Mode = map[string]string{"none": "NONE", "auto": "AUTO", "required": "ANY"}[choice]
+		case map[string]any:
+			if function, ok := choice["function"].(map[string]any); ok {
+				if name, ok := function["name"].(string); ok {
+					calling.Mode = "ANY"
+					calling.AllowedFunctionNames = []string{name}
+				}
+			}
+		}
+		if calling.Mode == "" {
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: unsupported tool_choice")
+		}
+		out.ToolConfig = &GeminiToolConfig{FunctionCallingConfig: calling}
+	}
+
+	// Safety settings in the OpenAI-compatible form of Gemini's endpoint
+	var extraBody struct {
+		Google struct {
+			SafetySettings json.RawMessage `json:"safety_settings"`
+		} `json:"google"`
+	}
+	if raw, ok := reqJson["extra_body"]; ok {
+		if err := json.Unmarshal(raw, &extraBody); err != nil {
+			return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: invalid extra_body: %w", err)
+		}
+		out.SafetySettings = extraBody.Google.SafetySettings
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: %w", err)
+	}
+	res, err := ParsePartialJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("ConvertChatCompletionsRequestToGemini: %w", err)
+	}
+	if model, ok := reqJson["model"]; ok {
+		res["model"] = model
+	}
+	return res, nil
+}
+
+// messageText returns the text of a message content, a string or text parts
+func messageText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text, nil
+	}
+	var parts []ChatCompletionsContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("unsupported content part %s", part.Type)
+		}
+		b.WriteString(part.Text)
+	}
+	return b.String(), nil
+}
+
+// geminiUserParts converts the content of a user message, with its images
+// and audio
+func geminiUserParts(raw json.RawMessage) ([]GeminiPart, error) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return []GeminiPart{{Text: text}}, nil
+	}
+	var parts []ChatCompletionsContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, err
+	}
+	var out []GeminiPart
+	for _, part := range parts {
+		switch {
+		case part.Type == "text":
+			out = append(out, GeminiPart{Text: part.Text})
+		case part.Type == "image_url" && part.ImageURL != nil:
+			if mimeType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				out = append(out, GeminiPart{InlineData: &GeminiBlob{MimeType: mimeType, Data: data}})
+			} else {
+				out = append(out, GeminiPart{FileData: &GeminiFileData{FileURI: part.ImageURL.URL}})
+			}
+		case part.Type == "input_audio" && part.InputAudio != nil:
+			out = append(out, GeminiPart{InlineData: &GeminiBlob{MimeType: "audio/" + part.InputAudio.Format, Data: part.InputAudio.Data}})
+		default:
+			return nil, fmt.Errorf("unsupported content part %s", part.Type)
+		}
+	}
+	return out, nil
+}
+
+// parseDataURL splits a base64 data URL into its media type and data
+func parseDataURL(url string) (mimeType, data string, ok bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mimeType, ok = strings.CutSuffix(meta, ";base64")
+	return mimeType, data, ok
+}
+
+// ConvertGeminiResponseToChatCompletions converts a Gemini generateContent
+// response to Chat Completions format
+func ConvertGeminiResponseToChatCompletions(respJson PartialJSON) (PartialJSON, error) {
+	return convertGeminiResponse(respJson, false)
+}
+
+// ConvertGeminiResponseChunkToChatCompletions converts a chunk of a Gemini
+// stream to a Chat Completions chunk. Gemini reports usage so far with every
+// chunk; it is passed on with the chunks that finish a candidate.
+func ConvertGeminiResponseChunkToChatCompletions(chunkJson PartialJSON) (PartialJSON, error) {
+	return convertGeminiResponse(chunkJson, true)
+}
+
+func convertGeminiResponse(respJson PartialJSON, chunk bool) (PartialJSON, error) {
+	data, err := respJson.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("ConvertGeminiResponseToChatCompletions: %w", err)
+	}
+	var gres GeminiResponse
+	if err := json.Unmarshal(data, &gres); err != nil {
+		return nil, fmt.Errorf("ConvertGeminiResponseToChatCompletions: %w", err)
+	}
+
+	res := map[string]any{
+		"id":      "chatcmpl-" + gres.ResponseID,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   gres.ModelVersion,
+	}
+	if chunk {
+		res["object"] = "chat.completion.chunk"
+	}
+
+	finished := false
+	choices := make([]map[string]any, 0, len(gres.Candidates))
+	for _, candidate := range gres.Candidates {
+		message := map[string]any{"role": "assistant"}
+		var text, thoughts strings.Builder
+		var toolCalls []map[string]any
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				id := part.FunctionCall.ID
+				if id == "" {
+					id = "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:24]
+				}
+				args := string(part.FunctionCall.Args)
+				if args == "" {
+					args = "{}"
+				}
+				toolCalls = append(toolCalls, map[string]any{
+					"index":    len(toolCalls),
+					"id":       id,
+					"type":     "function",
+					"function": map[string]string{"name": part.FunctionCall.Name, "arguments": args},
+				})
+			case part.Thought:
+				thoughts.WriteString(part.Text)
+			default:
+				text.WriteString(part.Text)
+			}
+		}
+		if text.Len() > 0 || !chunk {
+			message["content"] = text.String()
+		}
+		if thoughts.Len() > 0 {
+			message["reasoning_content"] = thoughts.String()
+		}
+		if len(toolCalls) > 0 {
+			message["tool_calls"] = toolCalls
+		}
+
+		choice := map[string]any{"index": candidate.Index}
+		if chunk {
+			choice["delta"] = message
+		} else {
+			choice["message"] = message
+		}
+		if reason := geminiFinishReason(candidate.FinishReason, len(toolCalls) > 0); reason != "" {
+			choice["finish_reason"] = reason
+			finished = true
+		} else {
+			choice["finish_reason"] = nil
+		}
+		choices = append(choices, choice)
+	}
+	// A blocked prompt gets no candidates
+	if len(choices) == 0 && gres.PromptFeedback != nil && gres.PromptFeedback.BlockReason != "" {
+		message := map[string]any{"role": "assistant", "content": ""}
+		choice := map[string]any{"index": 0, "finish_reason": "content_filter"}
+		if chunk {
+			choice["delta"] = message
+		} else {
+			choice["message"] = message
+		}
+		choices = append(choices, choice)
+		finished = true
+	}
+	res["choices"] = choices
+
+	if gres.UsageMetadata != nil && (finished || !chunk) {
+		res["usage"] = gres.UsageMetadata.ToChatCompletions()
+	}
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("ConvertGeminiResponseToChatCompletions: %w", err)
+	}
+	return ParsePartialJSON(out)
+}
+
+// geminiFinishReason maps a Gemini finish reason to Chat Completions; empty
+// while the candidate is not finished
+func geminiFinishReason(reason string, toolCalls bool) string {
+	switch reason {
+	case "":
+		return ""
+	case "STOP":
+		if toolCalls {
+			return "tool_calls"
+		}
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
@@ -0,0 +1,99 @@
+package styles
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConvertChatCompletionsRequestToGemini(t *testing.T) {
+	req, _ := ParsePartialJSON([]byte(`{
+		"model": "gemini-1.5-pro",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "Weather?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBO"}}]},
+			{"role": "assistant", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\": \"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "sunny"}
+		],
+		"max_completion_tokens": 100,
+		"stop": "END",
+		"tools": [{"type": "function", "function": {"name": "weather", "parameters": {"type": "object"}}}],
+		"tool_choice": "required",
+		"response_format": {"type": "json_object"}
+	}`))
+	converted, err := ConvertChatCompletionsRequestToGemini(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if TryGetFromPartialJSON[string](converted, "model") != "gemini-1.5-pro" {
+		t.Errorf("expected the model to be kept for the driver, got %s", converted["model"])
+	}
+	data, _ := converted.Marshal()
+	var got GeminiRequest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.SystemInstruction == nil || got.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("systemInstruction = %+v", got.SystemInstruction)
+	}
+	if len(got.Contents) != 3 {
+		t.Fatalf("contents = %+v", got.Contents)
+	}
+	user, model, result := got.Contents[0], got.Contents[1], got.Contents[2]
+	if user.Role != "user" || len(user.Parts) != 2 || user.Parts[1].InlineData == nil || user.Parts[1].InlineData.MimeType != "image/png" {
+		t.Errorf("user content = %+v", user)
+	}
+	if model.Role != "model" || model.Parts[0].FunctionCall == nil || string(model.Parts[0].FunctionCall.Args) != `{"city":"Paris"}` {
+		t.Errorf("model content = %+v", model)
+	}
+	if fr := result.Parts[0].FunctionResponse; result.Role != "user" || fr == nil || fr.Name != "weather" {
+		t.Errorf("function response = %+v", result)
+	}
+	config := got.GenerationConfig
+	if config.MaxOutputTokens != 100 || len(config.StopSequences) != 1 || config.ResponseMimeType != "application/json" {
+		t.Errorf("generationConfig = %+v", config)
+	}
+	if got.ToolConfig.FunctionCallingConfig.Mode != "ANY" || got.Tools[0].FunctionDeclarations[0].Name != "weather" {
+		t.Errorf("tools = %+v, toolConfig = %+v", got.Tools, got.ToolConfig)
+	}
+}
+
+func TestConvertGeminiResponseToChatCompletions(t *testing.T) {
+	res, _ := ParsePartialJSON([]byte(`{
+		"responseId": "r1",
+		"modelVersion": "gemini-1.5-pro-002",
+		"candidates": [{"index": 0, "finishReason": "STOP", "content": {"role": "model", "parts": [
+			{"text": "Let me check.", "thought": true},
+			{"functionCall": {"name": "weather", "args": {"city": "Paris"}}}
+		]}}],
+		"usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5, "thoughtsTokenCount": 3, "totalTokenCount": 18}
+	}`))
+	converted, err := ConvertGeminiResponseToChatCompletions(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseChatCompletionsResponse(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := parsed.Choices[0]
+	if parsed.ID != "chatcmpl-r1" || parsed.Model != "gemini-1.5-pro-002" || choice.FinishReason != "tool_calls" {
+		t.Errorf("response = %+v", parsed)
+	}
+	if choice.Message.ReasoningContent != "Let me check." || len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("message = %+v", choice.Message)
+	}
+	if u := parsed.Usage; u == nil || u.CompletionTokens != 8 || u.TotalTokens != 18 || u.CompletionTokensDetails.ReasoningTokens != 3 {
+		t.Errorf("usage = %+v", parsed.Usage)
+	}
+
+	// Stream chunks only carry usage once a candidate finishes
+	chunk, _ := ParsePartialJSON([]byte(`{"responseId": "r2", "candidates": [{"content": {"parts": [{"text": "Hel"}]}}], "usageMetadata": {"promptTokenCount": 10}}`))
+	converted, err = ConvertGeminiResponseChunkToChatCompletions(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := converted["usage"]; ok || TryGetFromPartialJSON[string](converted, "object") != "chat.completion.chunk" {
+		t.Errorf("chunk = %v", converted)
+	}
+}
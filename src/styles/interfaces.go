@@ -17,8 +17,12 @@ type Style string
 const (
 	StyleUnknown         Style = ""
 	StyleVirtual         Style = "virtual"
+	StyleMock            Style = "mock"
 	StyleChatCompletions Style = "openai-chat-completions"
 	StyleResponses       Style = "openai-responses"
+	StyleVLLM            Style = "vllm" // Chat Completions as served by vLLM
+	StyleTGI             Style = "tgi"  // Chat Completions as served by Hugging Face TGI
+	StyleAuto            Style = "auto" // Detected by probing the provider when provisioned
 	StyleAnthropic       Style = "anthropic-messages"
 	StyleGoogleGenAI     Style = "google-genai"
 	StyleCfAiGateway     Style = "cloudflare-ai-gateway"
@@ -32,15 +36,23 @@ func ParseStyle(s string) (Style, error) {
 	switch s {
 	case "virtual":
 		return StyleVirtual, nil
+	case "mock":
+		return StyleMock, nil
 	case "openai-chat-completions", "openai", "":
 		return StyleChatCompletions, nil
 	case "openai-responses", "responses":
 		return StyleResponses, nil
-	/*case "anthropic-messages", "anthropic":
-		return StyleAnthropic, nil
-	case "google-genai", "google":
+	case "vllm":
+		return StyleVLLM, nil
+	case "tgi":
+		return StyleTGI, nil
+	case "auto":
+		return StyleAuto, nil
+	case "google-genai", "google", "gemini":
 		return StyleGoogleGenAI, nil
-	case "cloudflare-ai-gateway":
+	case "anthropic-messages", "anthropic":
+		return StyleAnthropic, nil
+	/*case "cloudflare-ai-gateway":
 		return StyleCfAiGateway, nil
 	case "cloudflare-workers-ai", "cloudflare", "cf":
 		return StyleCfWorkersAi, nil*/
@@ -49,6 +61,20 @@ func ParseStyle(s string) (Style, error) {
 	}
 }
 
+// SupportedStyleNames lists the style names accepted by ParseStyle
+func SupportedStyleNames() []string {
+	return []string{"openai", "openai-chat-completions", "responses", "openai-responses", "vllm", "tgi", "gemini", "google-genai", "anthropic", "anthropic-messages", "auto", "virtual", "mock"}
+}
+
+// WireStyle maps styles that share another style's wire format onto it
+func WireStyle(s Style) Style {
+	switch s {
+	case StyleMock, StyleVLLM, StyleTGI:
+		return StyleChatCompletions
+	}
+	return s
+}
+
 func ParsePartialJSON(data []byte) (PartialJSON, error) {
 	var pj PartialJSON
 	err := json.Unmarshal(data, &pj)
@@ -119,3 +145,16 @@ func (pj PartialJSON) CloneWith(key string, value any) (PartialJSON, error) {
 func (pj PartialJSON) Marshal() ([]byte, error) {
 	return json.Marshal(pj)
 }
+
+// Size returns the length of the marshaled object without marshaling it
+// (exact for keys that need no escaping)
+func (pj PartialJSON) Size() int {
+	size := 2 // braces
+	for key, value := range pj {
+		size += len(key) + len(value) + 4 // quotes, colon and comma
+	}
+	if len(pj) > 0 {
+		size-- // no comma after the last field
+	}
+	return size
+}
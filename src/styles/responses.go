@@ -84,13 +84,62 @@ type ResponsesOutputItem struct {
 	Name      string `json:"name,omitempty"`
 	Arguments string `json:"arguments,omitempty"`
 	Output    string `json:"output,omitempty"`
+
+	// For reasoning items
+	Summary []struct {
+		Type string `json:"type,omitempty"`
+		Text string `json:"text,omitempty"`
+	} `json:"summary,omitempty"`
 }
 
 // ResponsesUsage represents token usage in Responses API
 type ResponsesUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
-	TotalTokens  int `json:"total_tokens"`
+	InputTokens         int                           `json:"input_tokens"`
+	OutputTokens        int                           `json:"output_tokens"`
+	TotalTokens         int                           `json:"total_tokens"`
+	InputTokensDetails  *ResponsesInputTokensDetails  `json:"input_tokens_details,omitempty"`
+	OutputTokensDetails *ResponsesOutputTokensDetails `json:"output_tokens_details,omitempty"`
+}
+
+// ResponsesInputTokensDetails breaks down input tokens in Responses API
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	AudioTokens  int `json:"audio_tokens,omitempty"`
+	TextTokens   int `json:"text_tokens,omitempty"`
+	ImageTokens  int `json:"image_tokens,omitempty"`
+}
+
+// ResponsesOutputTokensDetails breaks down output tokens in Responses API
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+	AudioTokens     int `json:"audio_tokens,omitempty"`
+	TextTokens      int `json:"text_tokens,omitempty"`
+}
+
+// ToChatCompletions converts Responses API usage to Chat Completions usage,
+// keeping cached, reasoning and per-modality token details
+func (u ResponsesUsage) ToChatCompletions() ChatCompletionsUsage {
+	usage := ChatCompletionsUsage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if d := u.InputTokensDetails; d != nil && *d != (ResponsesInputTokensDetails{}) {
+		usage.PromptTokensDetails = &ChatCompletionsPromptTokensDetails{
+			CachedTokens: d.CachedTokens,
+			AudioTokens:  d.AudioTokens,
+			TextTokens:   d.TextTokens,
+			ImageTokens:  d.ImageTokens,
+		}
+	}
+	if d := u.OutputTokensDetails; d != nil && *d != (ResponsesOutputTokensDetails{}) {
+		usage.CompletionTokensDetails = &ChatCompletionsCompletionTokensDetails{
+			ReasoningTokens: d.ReasoningTokens,
+			AudioTokens:     d.AudioTokens,
+			TextTokens:      d.TextTokens,
+		}
+	}
+	return usage
 }
 
 // ResponsesResponse represents a full Responses API response
@@ -0,0 +1,76 @@
+package styles
+
+import "encoding/json"
+
+// AnthropicThinking is the extended thinking setting of a request:
+// {"type": "enabled", "budget_tokens": 8000} or {"type": "disabled"}
+type AnthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+// ThinkingBudgetToEffort maps an extended thinking budget to the closest
+// reasoning_effort of OpenAI-style models
+func ThinkingBudgetToEffort(budget int) string {
+	switch {
+	case budget < 4096:
+		return "low"
+	case budget < 16384:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// EffortToThinkingBudget maps a reasoning_effort to an extended thinking
+// budget; mapping the budget back gives the same effort
+func EffortToThinkingBudget(effort string) int {
+	switch effort {
+	case "minimal":
+		return 1024
+	case "low":
+		return 2048
+	case "high":
+		return 24576
+	default:
+		return 8192
+	}
+}
+
+// MapThinking converts between the two ways a Chat Completions request can ask
+// for reasoning. For providers taking extended thinking natively, a
+// reasoning_effort becomes a thinking budget; for the others, thinking
+// becomes a reasoning_effort unless the request already sets one. Requests
+// carrying the form the provider expects are returned unchanged.
+func MapThinking(reqJson PartialJSON, native bool) (PartialJSON, error) {
+	_, hasThinking := reqJson["thinking"]
+	effort := TryGetFromPartialJSON[string](reqJson, "reasoning_effort")
+
+	if native {
+		if hasThinking || effort == "" {
+			return reqJson, nil
+		}
+		res := reqJson.Clone()
+		delete(res, "reasoning_effort")
+		if effort == "none" {
+			return res, res.Set("thinking", AnthropicThinking{Type: "disabled"})
+		}
+		return res, res.Set("thinking", AnthropicThinking{Type: "enabled", BudgetTokens: EffortToThinkingBudget(effort)})
+	}
+
+	if !hasThinking {
+		return reqJson, nil
+	}
+	var thinking AnthropicThinking
+	if err := json.Unmarshal(reqJson["thinking"], &thinking); err != nil {
+		return nil, err
+	}
+	res := reqJson.Clone()
+	delete(res, "thinking")
+	if thinking.Type == "enabled" && effort == "" {
+		if err := res.Set("reasoning_effort", ThinkingBudgetToEffort(thinking.BudgetTokens)); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
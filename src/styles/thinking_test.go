@@ -0,0 +1,136 @@
+package styles
+
+import "testing"
+
+func TestMapThinking(t *testing.T) {
+	req, _ := ParsePartialJSON([]byte(`{"model": "o4-mini", "thinking": {"type": "enabled", "budget_tokens": 10000}}`))
+
+	// OpenAI-style providers get a reasoning_effort
+	mapped, err := MapThinking(req, false)
+	if err != nil {
+		t.Fatalf("MapThinking returned error: %v", err)
+	}
+	if _, ok := mapped["thinking"]; ok {
+		t.Error("expected thinking to be removed")
+	}
+	if got := TryGetFromPartialJSON[string](mapped, "reasoning_effort"); got != "medium" {
+		t.Errorf("reasoning_effort = %q, want medium", got)
+	}
+	if _, ok := req["reasoning_effort"]; ok {
+		t.Error("expected the original request to be left unchanged")
+	}
+
+	// Native providers get thinking through untouched
+	if same, _ := MapThinking(req, true); string(same["thinking"]) != string(req["thinking"]) {
+		t.Errorf("expected thinking to pass through, got %s", same["thinking"])
+	}
+
+	// ...and reasoning_effort mapped to a budget that maps back to the same effort
+	for _, effort := range []string{"low", "medium", "high"} {
+		req, _ := ParsePartialJSON([]byte(`{"model": "claude-sonnet-4", "reasoning_effort": "` + effort + `"}`))
+		mapped, err := MapThinking(req, true)
+		if err != nil {
+			t.Fatalf("MapThinking returned error: %v", err)
+		}
+		thinking, err := GetFromPartialJSON[AnthropicThinking](mapped, "thinking")
+		if err != nil || thinking.Type != "enabled" {
+			t.Fatalf("expected thinking to be enabled, got %s", mapped["thinking"])
+		}
+		if got := ThinkingBudgetToEffort(thinking.BudgetTokens); got != effort {
+			t.Errorf("effort %s mapped to budget %d, which maps back to %s", effort, thinking.BudgetTokens, got)
+		}
+		if _, ok := mapped["reasoning_effort"]; ok {
+			t.Error("expected reasoning_effort to be removed")
+		}
+	}
+
+	// Disabled thinking is dropped for OpenAI-style providers
+	req, _ = ParsePartialJSON([]byte(`{"thinking": {"type": "disabled"}}`))
+	if mapped, _ := MapThinking(req, false); len(mapped) != 0 {
+		t.Errorf("expected disabled thinking to be dropped, got %v", mapped)
+	}
+}
+
+func TestResponsesReasoningConversion(t *testing.T) {
+	req, _ := ParsePartialJSON([]byte(`{"model": "o4-mini", "messages": [], "reasoning_effort": "high"}`))
+	converted, err := ConvertChatCompletionsRequestToResponses(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasoning := TryGetFromPartialJSON[map[string]string](converted, "reasoning")
+	if reasoning["effort"] != "high" {
+		t.Errorf("expected reasoning.effort high, got %s", converted["reasoning"])
+	}
+
+	res, _ := ParsePartialJSON([]byte(`{"output": [
+		{"type": "reasoning", "summary": [{"type": "summary_text", "text": "Think."}]},
+		{"type": "message", "role": "assistant", "content": "Done."}
+	]}`))
+	out, err := ConvertResponsesResponseToChatCompletions(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ParseChatCompletionsResponse(out)
+	if err != nil || len(resp.Choices) != 1 {
+		t.Fatalf("expected one choice, got %s", out["choices"])
+	}
+	if c := resp.Choices[0]; c.Index != 0 || c.Message.ReasoningContent != "Think." {
+		t.Errorf("expected reasoning on choice 0, got %+v", c)
+	}
+
+	chunk, _ := ParsePartialJSON([]byte(`{"type": "response.reasoning_summary_text.delta", "delta": "Hmm"}`))
+	converted, err = ConvertResponsesResponseChunkToChatCompletions(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	choices := TryGetFromPartialJSON[[]ChatCompletionsChoice](converted, "choices")
+	if len(choices) != 1 || choices[0].Delta == nil || choices[0].Delta.ReasoningContent != "Hmm" {
+		t.Errorf("expected a reasoning_content delta, got %s", converted["choices"])
+	}
+}
+
+type messageChoice struct {
+	Message map[string]any `json:"message"`
+}
+
+func TestReasoningContent(t *testing.T) {
+	// DeepSeek-style responses keep their reasoning through typed round trips
+	res, _ := ParsePartialJSON([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "4", "reasoning_content": "2+2"}}]}`))
+	resp, err := ParseChatCompletionsResponse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := PartialJSON{}
+	if err := out.Set("choices", resp.Choices); err != nil {
+		t.Fatal(err)
+	}
+	if choices := TryGetFromPartialJSON[[]messageChoice](out, "choices"); len(choices) != 1 || choices[0].Message["reasoning_content"] != "2+2" {
+		t.Errorf("expected reasoning_content to be kept, got %s", out["choices"])
+	}
+
+	// ...and stream reassembly
+	chunk, _ := ParsePartialJSON([]byte(`{"choices": [{"index": 0, "delta": {"reasoning_content": "2+2"}}]}`))
+	assembled, err := AssembleChatCompletionsStream([]PartialJSON{chunk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if choices := TryGetFromPartialJSON[[]messageChoice](assembled, "choices"); len(choices) != 1 || choices[0].Message["reasoning_content"] != "2+2" {
+		t.Errorf("expected reasoning_content to be reassembled, got %s", assembled["choices"])
+	}
+
+	// Replayed reasoning can't be sent to Responses providers
+	req, _ := ParsePartialJSON([]byte(`{"messages": [
+		{"role": "user", "content": "2+2?"},
+		{"role": "assistant", "content": "4", "reasoning_content": "2+2"},
+		{"role": "user", "content": "and 3+3?"}
+	]}`))
+	converted, err := ConvertChatCompletionsRequestToResponses(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range TryGetFromPartialJSON[[]map[string]any](converted, "input") {
+		if _, ok := msg["reasoning_content"]; ok {
+			t.Errorf("expected reasoning_content to be dropped from input, got %s", converted["input"])
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package styles
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ToolCallDeltaNormalizer rewrites the tool call deltas of a streamed chat
+// completion into the form the OpenAI API sends, whatever the upstream's
+// quirks: every delta carries the call's index, the first delta of a call
+// carries its id, type and function name, and later ones only arguments.
+//
+// Upstreams deviate by leaving out indexes, repeating ids and names on every
+// delta, sending each parallel call complete under index 0, or sending
+// arguments as a JSON object. Use one normalizer per stream.
+type ToolCallDeltaNormalizer struct {
+	choices map[int]*toolCallState
+}
+
+// toolCallState tracks the calls of one choice
+type toolCallState struct {
+	byID       map[string]int // upstream id -> index
+	byUpstream map[int]int    // upstream index -> index of its latest call
+	started    map[int]bool   // indexes whose first delta was sent
+	named      map[int]bool   // indexes whose function name was sent
+	next       int
+	last       int
+}
+
+// toolCallDelta is a tool call delta as upstreams send it
+type toolCallDelta struct {
+	Index    *int   `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// normalizedToolCallDelta is a tool call delta in OpenAI's form
+type normalizedToolCallDelta struct {
+	Index    int                        `json:"index"`
+	ID       string                     `json:"id,omitempty"`
+	Type     string                     `json:"type,omitempty"`
+	Function normalizedToolCallFunction `json:"function"`
+}
+
+type normalizedToolCallFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// NewToolCallDeltaNormalizer returns a normalizer for one stream
+func NewToolCallDeltaNormalizer() *ToolCallDeltaNormalizer {
+	return &ToolCallDeltaNormalizer{choices: map[int]*toolCallState{}}
+}
+
+// Normalize returns the chunk with its tool call deltas normalized; chunks
+// without tool calls are returned as is
+func (n *ToolCallDeltaNormalizer) Normalize(chunk PartialJSON) (PartialJSON, error) {
+	raw, ok := chunk["choices"]
+	if !ok || !strings.Contains(string(raw), `"tool_calls"`) {
+		return chunk, nil
+	}
+	var choices []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &choices); err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for i, choice := range choices {
+		var delta map[string]json.RawMessage
+		if err := json.Unmarshal(choice["delta"], &delta); err != nil || isNullJSON(delta["tool_calls"]) {
+			continue
+		}
+		var calls []toolCallDelta
+		if err := json.Unmarshal(delta["tool_calls"], &calls); err != nil {
+			return nil, err
+		}
+
+		var choiceIndex int
+		_ = json.Unmarshal(choice["index"], &choiceIndex)
+		state := n.choices[choiceIndex]
+		if state == nil {
+			state = &toolCallState{byID: map[string]int{}, byUpstream: map[int]int{}, started: map[int]bool{}, named: map[int]bool{}}
+			n.choices[choiceIndex] = state
+		}
+
+		normalized := make([]normalizedToolCallDelta, 0, len(calls))
+		for _, call := range calls {
+			normalized = append(normalized, state.normalize(call))
+		}
+		if err := setRaw(delta, "tool_calls", normalized); err != nil {
+			return nil, err
+		}
+		if err := setRaw(choices[i], "delta", delta); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if !changed {
+		return chunk, nil
+	}
+	return chunk.CloneWith("choices", choices)
+}
+
+// normalize assigns a call delta its index and keeps the fields OpenAI sends
+// for the call's first or a later delta
+func (s *toolCallState) normalize(call toolCallDelta) normalizedToolCallDelta {
+	index, known := -1, false
+	switch {
+	case call.ID != "":
+		index, known = s.byID[call.ID]
+		if !known {
+			// A new id is a new call, even when it reuses an upstream index
+			index = s.next
+			s.next++
+			s.byID[call.ID] = index
+		}
+	case call.Index != nil:
+		index, known = s.byUpstream[*call.Index]
+		if !known {
+			index = s.next
+			s.next++
+		}
+	case s.next > 0:
+		index = s.last
+	default:
+		index = 0
+		s.next = 1
+	}
+	if call.Index != nil {
+		s.byUpstream[*call.Index] = index
+	}
+	s.last = index
+
+	out := normalizedToolCallDelta{Index: index, Function: normalizedToolCallFunction{Arguments: toolCallArguments(call.Function.Arguments)}}
+	if !s.started[index] {
+		s.started[index] = true
+		out.ID = call.ID
+		if out.ID == "" {
+			out.ID = "call_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:24]
+		}
+		out.Type = "function"
+	}
+	// Some upstreams name the call after its first delta
+	if !s.named[index] && call.Function.Name != "" {
+		s.named[index] = true
+		out.Function.Name = call.Function.Name
+	}
+	return out
+}
+
+// toolCallArguments returns streamed arguments as the string fragment OpenAI
+// sends, encoding arguments sent as a JSON object
+func toolCallArguments(raw json.RawMessage) string {
+	if isNullJSON(raw) {
+		return ""
+	}
+	var fragment string
+	if json.Unmarshal(raw, &fragment) == nil {
+		return fragment
+	}
+	return string(raw)
+}
+
+// setRaw marshals a value into a raw JSON map
+func setRaw(m map[string]json.RawMessage, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m[key] = data
+	return nil
+}
@@ -0,0 +1,88 @@
+package styles
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToolCallDeltaNormalizer_Fixtures(t *testing.T) {
+	fixtures, err := filepath.Glob("testdata/tool_call_deltas/*.json")
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("no fixtures found: %v", err)
+	}
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var f struct {
+				Chunks []PartialJSON `json:"chunks"`
+				Want   []struct {
+					ID        string `json:"id"`
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"want"`
+			}
+			if err := json.Unmarshal(data, &f); err != nil {
+				t.Fatal(err)
+			}
+
+			n := NewToolCallDeltaNormalizer()
+			seen := map[int]bool{}
+			var normalized []PartialJSON
+			for _, chunk := range f.Chunks {
+				out, err := n.Normalize(chunk)
+				if err != nil {
+					t.Fatalf("Normalize returned error: %v", err)
+				}
+				normalized = append(normalized, out)
+
+				var choices []struct {
+					Delta struct {
+						ToolCalls []map[string]json.RawMessage `json:"tool_calls"`
+					} `json:"delta"`
+				}
+				_ = json.Unmarshal(out["choices"], &choices)
+				for _, choice := range choices {
+					for _, call := range choice.Delta.ToolCalls {
+						var index int
+						if err := json.Unmarshal(call["index"], &index); err != nil {
+							t.Fatalf("delta without index: %v", call)
+						}
+						_, hasID := call["id"]
+						_, hasType := call["type"]
+						if first := !seen[index]; hasID != first || hasType != first {
+							t.Errorf("call %d: id and type must come with the first delta only, got %v", index, call)
+						}
+						seen[index] = true
+					}
+				}
+			}
+
+			assembled, err := AssembleChatCompletionsStream(normalized)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var res ChatCompletionsResponse
+			raw, _ := assembled.Marshal()
+			_ = json.Unmarshal(raw, &res)
+			calls := res.Choices[0].Message.ToolCalls
+			if len(calls) != len(f.Want) {
+				t.Fatalf("assembled %d tool calls, want %d: %+v", len(calls), len(f.Want), calls)
+			}
+			for i, want := range f.Want {
+				got := calls[i]
+				if (want.ID != "" && got.ID != want.ID) || (want.ID == "" && !strings.HasPrefix(got.ID, "call_")) {
+					t.Errorf("call %d id = %q, want %q", i, got.ID, want.ID)
+				}
+				if got.Function.Name != want.Name || got.Function.Arguments != want.Arguments {
+					t.Errorf("call %d = %s(%s), want %s(%s)", i, got.Function.Name, got.Function.Arguments, want.Name, want.Arguments)
+				}
+			}
+		})
+	}
+}
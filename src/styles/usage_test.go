@@ -0,0 +1,101 @@
+package styles
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResponsesUsageKeepsDetails(t *testing.T) {
+	resp := PartialJSON{}
+	_ = resp.Set("object", "response")
+	_ = resp.Set("created_at", 1)
+	_ = resp.Set("usage", map[string]any{
+		"input_tokens":          100,
+		"output_tokens":         40,
+		"total_tokens":          140,
+		"input_tokens_details":  map[string]any{"cached_tokens": 64},
+		"output_tokens_details": map[string]any{"reasoning_tokens": 30},
+	})
+
+	converted, err := ConvertResponsesResponseToChatCompletions(resp)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	usage, err := GetFromPartialJSON[ChatCompletionsUsage](converted, "usage")
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if usage.PromptTokens != 100 || usage.CompletionTokens != 40 || usage.TotalTokens != 140 {
+		t.Errorf("unexpected totals: %+v", usage)
+	}
+	if usage.PromptTokensDetails == nil || usage.PromptTokensDetails.CachedTokens != 64 {
+		t.Errorf("cached tokens lost: %+v", usage.PromptTokensDetails)
+	}
+	if usage.CompletionTokensDetails == nil || usage.CompletionTokensDetails.ReasoningTokens != 30 {
+		t.Errorf("reasoning tokens lost: %+v", usage.CompletionTokensDetails)
+	}
+}
+
+func TestResponsesCompletedChunkKeepsDetails(t *testing.T) {
+	chunk := PartialJSON{}
+	_ = chunk.Set("type", "response.completed")
+	_ = chunk.Set("response", map[string]any{
+		"id":    "resp_1",
+		"model": "o4-mini",
+		"usage": map[string]any{
+			"input_tokens":          10,
+			"output_tokens":         20,
+			"total_tokens":          30,
+			"input_tokens_details":  map[string]any{"cached_tokens": 0},
+			"output_tokens_details": map[string]any{"reasoning_tokens": 12},
+		},
+	})
+
+	converted, err := ConvertResponsesResponseChunkToChatCompletions(chunk)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	usage := TryGetFromPartialJSON[ChatCompletionsUsage](converted, "usage")
+	if usage.PromptTokensDetails != nil {
+		t.Errorf("empty prompt details should be omitted: %+v", usage.PromptTokensDetails)
+	}
+	if usage.CompletionTokensDetails == nil || usage.CompletionTokensDetails.ReasoningTokens != 12 {
+		t.Errorf("reasoning tokens lost: %+v", usage.CompletionTokensDetails)
+	}
+}
+
+func TestAnthropicUsageToChatCompletions(t *testing.T) {
+	var usage AnthropicUsage
+	_ = json.Unmarshal([]byte(`{"input_tokens":5,"output_tokens":7,"cache_creation_input_tokens":100,"cache_read_input_tokens":900}`), &usage)
+
+	chat := usage.ToChatCompletions()
+	if chat.PromptTokens != 1005 || chat.TotalTokens != 1012 {
+		t.Errorf("unexpected totals: %+v", chat)
+	}
+	if chat.PromptTokensDetails == nil || chat.PromptTokensDetails.CachedTokens != 900 || chat.PromptTokensDetails.CacheCreationTokens != 100 {
+		t.Errorf("cache fields lost: %+v", chat.PromptTokensDetails)
+	}
+}
+
+func TestUsageAdd(t *testing.T) {
+	var total ChatCompletionsUsage
+	total.Add(ChatCompletionsUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	total.Add(ChatCompletionsUsage{
+		PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30,
+		PromptTokensDetails:     &ChatCompletionsPromptTokensDetails{CachedTokens: 8, AudioTokens: 2},
+		CompletionTokensDetails: &ChatCompletionsCompletionTokensDetails{ReasoningTokens: 4},
+	})
+	total.Add(ChatCompletionsUsage{
+		PromptTokensDetails: &ChatCompletionsPromptTokensDetails{CachedTokens: 1},
+	})
+
+	if total.PromptTokens != 30 || total.CompletionTokens != 15 || total.TotalTokens != 45 {
+		t.Errorf("unexpected totals: %+v", total)
+	}
+	if total.PromptTokensDetails.CachedTokens != 9 || total.PromptTokensDetails.AudioTokens != 2 {
+		t.Errorf("unexpected prompt details: %+v", total.PromptTokensDetails)
+	}
+	if total.CompletionTokensDetails.ReasoningTokens != 4 {
+		t.Errorf("unexpected completion details: %+v", total.CompletionTokensDetails)
+	}
+}
@@ -0,0 +1,324 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/google/uuid"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Code sandbox backends
+const (
+	CodeBackendProcess = "process"
+	CodeBackendDocker  = "docker"
+)
+
+// codeInterpreters are the commands reading a program from stdin, per language
+var codeInterpreters = map[string][]string{
+	"python":     {"python3", "-I", "-"},
+	"javascript": {"node", "-"},
+	"bash":       {"bash", "-s"},
+}
+
+// codeImages are the default docker images providing each interpreter
+var codeImages = map[string]string{
+	"python":     "python:3.12-slim",
+	"javascript": "node:22-slim",
+	"bash":       "python:3.12-slim",
+}
+
+// CodeConfig configures the built-in code execution tool
+type CodeConfig struct {
+	// Backend runs programs in throwaway containers without network
+	// ("docker", default) or as local subprocesses with rlimits ("process")
+	Backend string `json:"backend,omitempty"`
+	// AllowUnsafeProcess permits the process backend. Its programs run as
+	// the router's user with its network and filesystem access, so they can
+	// read its configuration and secrets; only for trusted keys.
+	AllowUnsafeProcess bool `json:"allow_unsafe_process,omitempty"`
+	// Keys lists the key IDs (glob patterns) allowed to run code; no keys disables the tool
+	Keys []string `json:"keys,omitempty"`
+	// Languages enables languages among python, javascript and bash (default: python)
+	Languages []string `json:"languages,omitempty"`
+	// Timeout bounds each run, wall clock and CPU time (default: 10s)
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+	// MemoryMB caps the memory of each run (default: 256)
+	MemoryMB int `json:"memory_mb,omitempty"`
+	// MaxOutputBytes caps stdout and stderr each (default: 65536)
+	MaxOutputBytes int `json:"max_output_bytes,omitempty"`
+	// MaxConcurrent caps simultaneous runs; extra calls wait (default: 4)
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+	// Image is the container image of the docker backend, for every language
+	// (default: python:3.12-slim for python and bash, node:22-slim for javascript)
+	Image string `json:"image,omitempty"`
+}
+
+// Code runs short programs for models with resource limits, in a container
+// or, when explicitly allowed, as an unisolated subprocess. It is only
+// available to the keys listed in its config.
+type Code struct {
+	config CodeConfig
+	slots  chan struct{}
+}
+
+// NewCode creates a code execution tool, applying defaults to the config
+func NewCode(config CodeConfig) (*Code, error) {
+	if config.Backend == "" {
+		config.Backend = CodeBackendDocker
+	}
+	if config.Backend != CodeBackendProcess && config.Backend != CodeBackendDocker {
+		return nil, fmt.Errorf("code tool: unknown backend '%s' (supported: docker, process)", config.Backend)
+	}
+	if config.Backend == CodeBackendProcess && !config.AllowUnsafeProcess {
+		return nil, fmt.Errorf("code tool: the process backend is not isolated from the router; set allow_unsafe_process to use it")
+	}
+	if len(config.Languages) == 0 {
+		config.Languages = []string{"python"}
+	}
+	for _, lang := range config.Languages {
+		if _, ok := codeInterpreters[lang]; !ok {
+			return nil, fmt.Errorf("code tool: unsupported language '%s' (supported: python, javascript, bash)", lang)
+		}
+	}
+	for _, pattern := range config.Keys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("code tool: invalid key pattern '%s'", pattern)
+		}
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = caddy.Duration(10 * time.Second)
+	}
+	if config.MemoryMB <= 0 {
+		config.MemoryMB = 256
+	}
+	if config.MaxOutputBytes <= 0 {
+		config.MaxOutputBytes = 64 << 10
+	}
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 4
+	}
+	return &Code{config: config, slots: make(chan struct{}, config.MaxConcurrent)}, nil
+}
+
+func (c *Code) Name() string { return "code" }
+
+func (c *Code) Definition() styles.ChatCompletionsTool {
+	where := "in an isolated container without network access"
+	if c.config.Backend == CodeBackendProcess {
+		where = "as a local process with resource limits only; it is not isolated from the host"
+	}
+	return styles.ChatCompletionsTool{
+		Type: "function",
+		Function: &styles.ChatCompletionsToolFunction{
+			Name: "code",
+			Description: fmt.Sprintf("Run a short program %s and return its exit code, stdout and stderr. "+
+				"Languages: %s. Limits: %s, %d MB of memory, no persistent files.",
+				where, strings.Join(c.config.Languages, ", "), time.Duration(c.config.Timeout), c.config.MemoryMB),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"language": map[string]any{
+						"type": "string",
+						"enum": c.config.Languages,
+					},
+					"code": map[string]any{
+						"type":        "string",
+						"description": "The complete program; print results to stdout",
+					},
+				},
+				"required": []string{"language", "code"},
+			},
+		},
+	}
+}
+
+// EnabledFor reports whether the key may run code
+func (c *Code) EnabledFor(keyID string) bool {
+	for _, pattern := range c.config.Keys {
+		if ok, _ := path.Match(pattern, keyID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Call runs the program given in the arguments
+func (c *Code) Call(ctx context.Context, arguments string) (string, error) {
+	keyID, _ := ctx.Value(plugin.ContextKeyID()).(string)
+	if !c.EnabledFor(keyID) {
+		return "", fmt.Errorf("code: code execution is not enabled for this key")
+	}
+
+	var args struct {
+		Language string `json:"language"`
+		Code     string `json:"code"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args.Code == "" {
+		return "", fmt.Errorf("code: expected arguments {\"language\": \"...\", \"code\": \"...\"}")
+	}
+	if args.Language == "" {
+		args.Language = c.config.Languages[0]
+	}
+	if !slices.Contains(c.config.Languages, args.Language) {
+		return "", fmt.Errorf("code: language '%s' is not enabled", args.Language)
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+		defer func() { <-c.slots }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	timeout := time.Duration(c.config.Timeout)
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	workDir, err := os.MkdirTemp("", "ai-router-code-")
+	if err != nil {
+		return "", fmt.Errorf("code: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	cmd := c.command(runCtx, args.Language, workDir)
+	stdout := &cappedBuffer{limit: c.config.MaxOutputBytes}
+	stderr := &cappedBuffer{limit: c.config.MaxOutputBytes}
+	cmd.Stdin = strings.NewReader(args.Code)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+
+	started := time.Now()
+	err = cmd.Run()
+	elapsed := time.Since(started)
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		return formatCodeResult(-1, stdout, stderr, fmt.Sprintf("timed out after %s", timeout)), nil
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		return "", fmt.Errorf("code: sandbox failed: %w", err)
+	}
+
+	Logger.Debug("code tool run finished",
+		zap.String("backend", c.config.Backend),
+		zap.String("language", args.Language),
+		zap.Int("exit_code", exitCode),
+		zap.Duration("elapsed", elapsed))
+	return formatCodeResult(exitCode, stdout, stderr, ""), nil
+}
+
+// command builds the sandboxed command for the backend
+func (c *Code) command(ctx context.Context, language, workDir string) *exec.Cmd {
+	interpreter := codeInterpreters[language]
+	seconds := int(time.Duration(c.config.Timeout).Seconds()) + 1
+
+	if c.config.Backend == CodeBackendDocker {
+		image := c.config.Image
+		if image == "" {
+			image = codeImages[language]
+		}
+		name := "ai-router-code-" + uuid.NewString()
+		args := []string{
+			"run", "--rm", "-i",
+			"--name", name,
+			"--network", "none",
+			"--memory", strconv.Itoa(c.config.MemoryMB) + "m",
+			"--cpus", "1",
+			"--pids-limit", "64",
+			"--read-only",
+			"--tmpfs", "/tmp:rw,size=64m",
+			"--workdir", "/tmp",
+			"--user", "65534:65534",
+			"--cap-drop", "ALL",
+			"--security-opt", "no-new-privileges",
+			image,
+		}
+		cmd := exec.CommandContext(ctx, "docker", append(args, interpreter...)...)
+		cmd.Cancel = func() error {
+			// Killing the client alone would leave the container running
+			_ = exec.Command("docker", "kill", name).Run()
+			return cmd.Process.Kill()
+		}
+		return cmd
+	}
+
+	// Subprocess: limits are applied by the shell before exec'ing the interpreter
+	limits := fmt.Sprintf("ulimit -t %d && ulimit -v %d && ulimit -f %d && exec \"$@\"",
+		seconds, c.config.MemoryMB*1024, 64*1024)
+	cmd := exec.CommandContext(ctx, "sh", append([]string{"-c", limits, "sh"}, interpreter...)...)
+	cmd.Dir = workDir
+	cmd.Env = []string{
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+		"LANG=C.UTF-8",
+	}
+	isolateProcess(cmd)
+	return cmd
+}
+
+// formatCodeResult renders a run for the model
+func formatCodeResult(exitCode int, stdout, stderr *cappedBuffer, note string) string {
+	var b strings.Builder
+	if note != "" {
+		b.WriteString("error: " + note + "\n")
+	} else {
+		fmt.Fprintf(&b, "exit_code: %d\n", exitCode)
+	}
+	b.WriteString("stdout:\n" + stdout.String() + "\n")
+	if stderr.Len() > 0 {
+		b.WriteString("stderr:\n" + stderr.String() + "\n")
+	}
+	return b.String()
+}
+
+// cappedBuffer keeps the first limit bytes written to it. The buffer is not
+// embedded so that io.Copy cannot bypass Write through ReadFrom.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) Len() int { return b.buf.Len() }
+
+func (b *cappedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
+
+var (
+	_ Tool      = (*Code)(nil)
+	_ KeyScoped = (*Code)(nil)
+)
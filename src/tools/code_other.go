@@ -0,0 +1,9 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+// isolateProcess is a no-op where process groups are unavailable; the process
+// backend's shell limits require a Unix system anyway
+func isolateProcess(cmd *exec.Cmd) {}
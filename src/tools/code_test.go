@@ -0,0 +1,123 @@
+//go:build unix
+
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/plugin"
+)
+
+func newTestCode(t *testing.T, config CodeConfig) *Code {
+	t.Helper()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	config.Languages = []string{"bash"}
+	config.Backend = CodeBackendProcess
+	config.AllowUnsafeProcess = true
+	code, err := NewCode(config)
+	if err != nil {
+		t.Fatalf("NewCode returned error: %v", err)
+	}
+	return code
+}
+
+func keyContext(keyID string) context.Context {
+	return context.WithValue(context.Background(), plugin.ContextKeyID(), keyID)
+}
+
+func TestCode_RunsProgram(t *testing.T) {
+	code := newTestCode(t, CodeConfig{Keys: []string{"team-*"}})
+
+	out, err := code.Call(keyContext("team-a"), `{"language": "bash", "code": "echo hello; echo oops >&2; exit 3"}`)
+	if err != nil {
+		t.Fatalf("Call returned error: %v", err)
+	}
+	for _, want := range []string{"exit_code: 3", "stdout:\nhello", "stderr:\noops"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q does not contain %q", out, want)
+		}
+	}
+}
+
+func TestCode_KeyEnablement(t *testing.T) {
+	code := newTestCode(t, CodeConfig{Keys: []string{"team-*"}})
+
+	if code.EnabledFor("other") || !code.EnabledFor("team-b") {
+		t.Error("EnabledFor does not follow the key patterns")
+	}
+	if _, err := code.Call(keyContext("other"), `{"language": "bash", "code": "echo hi"}`); err == nil {
+		t.Error("expected a key without access to be refused")
+	}
+	if _, err := code.Call(keyContext("team-a"), `{"language": "python", "code": "print(1)"}`); err == nil {
+		t.Error("expected a disabled language to be refused")
+	}
+}
+
+func TestCode_Limits(t *testing.T) {
+	code := newTestCode(t, CodeConfig{
+		Keys:           []string{"*"},
+		Timeout:        caddy.Duration(500 * time.Millisecond),
+		MaxOutputBytes: 10,
+	})
+
+	started := time.Now()
+	out, err := code.Call(keyContext("k"), `{"language": "bash", "code": "sleep 5 & wait"}`)
+	if err != nil {
+		t.Fatalf("Call returned error: %v", err)
+	}
+	if !strings.Contains(out, "timed out") || time.Since(started) > 3*time.Second {
+		t.Errorf("expected a timeout after 500ms, got %q after %s", out, time.Since(started))
+	}
+
+	out, err = code.Call(keyContext("k"), `{"language": "bash", "code": "printf '%.0sx' {1..100}"}`)
+	if err != nil {
+		t.Fatalf("Call returned error: %v", err)
+	}
+	if !strings.Contains(out, "xxxxxxxxxx\n[output truncated]") {
+		t.Errorf("expected output capped at 10 bytes, got %q", out)
+	}
+}
+
+func TestNewCode_Backends(t *testing.T) {
+	code, err := NewCode(CodeConfig{})
+	if err != nil {
+		t.Fatalf("NewCode returned error: %v", err)
+	}
+	if code.config.Backend != CodeBackendDocker {
+		t.Errorf("expected the docker backend by default, got %s", code.config.Backend)
+	}
+	if desc := code.Definition().Function.Description; !strings.Contains(desc, "isolated container") {
+		t.Errorf("unexpected description %q", desc)
+	}
+	for lang, image := range map[string]string{"python": "python:3.12-slim", "javascript": "node:22-slim"} {
+		if args := code.command(context.Background(), lang, t.TempDir()).Args; !slices.Contains(args, image) {
+			t.Errorf("expected %s to run in %s, got %v", lang, image, args)
+		}
+	}
+	code, err = NewCode(CodeConfig{Languages: []string{"javascript"}, Image: "sandbox:latest"})
+	if err != nil {
+		t.Fatalf("NewCode returned error: %v", err)
+	}
+	if args := code.command(context.Background(), "javascript", t.TempDir()).Args; !slices.Contains(args, "sandbox:latest") {
+		t.Errorf("expected the configured image, got %v", args)
+	}
+
+	if _, err := NewCode(CodeConfig{Backend: CodeBackendProcess}); err == nil {
+		t.Error("expected the process backend to need allow_unsafe_process")
+	}
+	code, err = NewCode(CodeConfig{Backend: CodeBackendProcess, AllowUnsafeProcess: true})
+	if err != nil {
+		t.Fatalf("NewCode returned error: %v", err)
+	}
+	if desc := code.Definition().Function.Description; !strings.Contains(desc, "not isolated") {
+		t.Errorf("expected the description to say the process is not isolated, got %q", desc)
+	}
+}
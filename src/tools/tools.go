@@ -0,0 +1,44 @@
+// Package tools provides the router's built-in server-side tools, executed by
+// the "tools" plugin's tool loop instead of being returned to the client.
+package tools
+
+import (
+	"context"
+
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// Logger for built-in tools - can be set by modules
+var Logger *zap.Logger = zap.NewNop()
+
+// Tool is a function tool executed by the router
+type Tool interface {
+	// Name returns the tool's function name
+	Name() string
+	// Definition returns the function tool declaration sent to the model
+	Definition() styles.ChatCompletionsTool
+	// Call runs the tool with the model's JSON arguments and returns the tool
+	// message content. Errors are reported back to the model as the result.
+	Call(ctx context.Context, arguments string) (string, error)
+}
+
+// KeyScoped is implemented by tools that only some keys may use. Tools that
+// are not enabled for the request's key are not offered to the model.
+type KeyScoped interface {
+	EnabledFor(keyID string) bool
+}
+
+// Registry holds all available built-in tools
+var Registry = map[string]Tool{}
+
+// GetTool returns a tool by name
+func GetTool(name string) (Tool, bool) {
+	t, ok := Registry[name]
+	return t, ok
+}
+
+// RegisterTool registers a tool, replacing any tool of the same name
+func RegisterTool(t Tool) {
+	Registry[t.Name()] = t
+}
@@ -0,0 +1,326 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/neutrome-labs/open-ai-router/src/extract"
+	"github.com/neutrome-labs/open-ai-router/src/styles"
+	"go.uber.org/zap"
+)
+
+// WebConfig configures the built-in web tool
+type WebConfig struct {
+	// AllowDomains restricts fetching to these domains and their subdomains (default: any public host)
+	AllowDomains []string `json:"allow_domains,omitempty"`
+	// DenyDomains blocks these domains and their subdomains
+	DenyDomains []string `json:"deny_domains,omitempty"`
+	// MaxBytes caps the downloaded body size; larger bodies are cut (default: 2 MiB)
+	MaxBytes int `json:"max_bytes,omitempty"`
+	// MaxChars caps the text returned to the model (default: 20000)
+	MaxChars int `json:"max_chars,omitempty"`
+	// CacheTTL is how long fetched pages are cached (default: 5m, negative disables caching)
+	CacheTTL caddy.Duration `json:"cache_ttl,omitempty"`
+	// Timeout bounds each fetch (default: 15s)
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+}
+
+// Web fetches URLs for models: only public http(s) hosts allowed by the
+// config are reachable, HTML is reduced to readable text and results are
+// cached and size-capped.
+type Web struct {
+	config WebConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]webCacheEntry
+
+	// allowPrivate lifts the private address guard (tests only)
+	allowPrivate bool
+}
+
+type webCacheEntry struct {
+	text    string
+	expires time.Time
+}
+
+// maxWebCacheEntries bounds the page cache
+const maxWebCacheEntries = 256
+
+// ErrDomainNotAllowed is returned for URLs outside the allowed domains
+var ErrDomainNotAllowed = errors.New("domain not allowed")
+
+// NewWeb creates a web tool, applying defaults to the config
+func NewWeb(config WebConfig) *Web {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = 2 << 20
+	}
+	if config.MaxChars <= 0 {
+		config.MaxChars = 20000
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = caddy.Duration(5 * time.Minute)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = caddy.Duration(15 * time.Second)
+	}
+
+	w := &Web{config: config, cache: make(map[string]webCacheEntry)}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: w.checkAddress}
+	w.client = &http.Client{
+		Timeout: time.Duration(config.Timeout),
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return w.checkURL(req.URL)
+		},
+	}
+	return w
+}
+
+// NewPublicClient returns an HTTP client that only connects to public
+// addresses and only follows http(s) redirects, for fetching URLs given by
+// clients or models
+func NewPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: CheckPublicAddress}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported URL scheme '%s'", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+func (w *Web) Name() string { return "web" }
+
+func (w *Web) Definition() styles.ChatCompletionsTool {
+	return styles.ChatCompletionsTool{
+		Type: "function",
+		Function: &styles.ChatCompletionsToolFunction{
+			Name:        "web",
+			Description: "Fetch a web page or document by URL and return its readable text.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"url": map[string]any{
+						"type":        "string",
+						"description": "The http or https URL to fetch",
+					},
+				},
+				"required": []string{"url"},
+			},
+		},
+	}
+}
+
+// Call fetches the URL given in the arguments
+func (w *Web) Call(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args.URL == "" {
+		return "", fmt.Errorf("web: expected arguments {\"url\": \"...\"}")
+	}
+	u, err := url.Parse(args.URL)
+	if err != nil {
+		return "", fmt.Errorf("web: invalid URL: %w", err)
+	}
+	if err := w.checkURL(u); err != nil {
+		return "", fmt.Errorf("web: %w", err)
+	}
+
+	key := u.String()
+	if text, ok := w.cached(key); ok {
+		Logger.Debug("web tool cache hit", zap.String("url", key))
+		return text, nil
+	}
+
+	text, err := w.fetch(ctx, u)
+	if err != nil {
+		return "", fmt.Errorf("web: %w", err)
+	}
+	w.store(key, text)
+	return text, nil
+}
+
+// checkURL validates the scheme and the domain lists
+func (w *Web) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme '%s'", u.Scheme)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if matchesDomain(w.config.DenyDomains, host) {
+		return fmt.Errorf("%w: %s", ErrDomainNotAllowed, host)
+	}
+	if len(w.config.AllowDomains) > 0 && !matchesDomain(w.config.AllowDomains, host) {
+		return fmt.Errorf("%w: %s", ErrDomainNotAllowed, host)
+	}
+	return nil
+}
+
+// matchesDomain reports whether host is one of the domains or a subdomain of one
+func matchesDomain(domains []string, host string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "*."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddress refuses connections to non-public addresses unless the
+// guard is lifted
+func (w *Web) checkAddress(network, address string, conn syscall.RawConn) error {
+	if w.allowPrivate {
+		return nil
+	}
+	return CheckPublicAddress(network, address, conn)
+}
+
+// CheckPublicAddress is a net.Dialer Control refusing connections to
+// loopback, private, link-local and other non-public addresses, whatever
+// the host name resolved to
+func CheckPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return fmt.Errorf("address %s is not public", ip)
+	}
+	return nil
+}
+
+// fetch downloads the page and converts it to text
+func (w *Web) fetch(ctx context.Context, u *url.URL) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "open-ai-router-web-tool")
+	req.Header.Set("Accept", "text/html,text/plain,application/pdf;q=0.9,*/*;q=0.5")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d", res.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, int64(w.config.MaxBytes)))
+	if err != nil {
+		return "", err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	var text string
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		text = string(data)
+	default:
+		text, err = extract.Text(data, mediaType, u.Path)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if runes := []rune(text); len(runes) > w.config.MaxChars {
+		text = string(runes[:w.config.MaxChars]) + "\n[truncated]"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "URL: %s\n\n%s", res.Request.URL, text)
+	Logger.Debug("web tool fetched page",
+		zap.String("url", res.Request.URL.String()),
+		zap.String("content_type", mediaType),
+		zap.Int("bytes", len(data)))
+	return b.String(), nil
+}
+
+func (w *Web) cached(key string) (string, bool) {
+	if w.config.CacheTTL < 0 {
+		return "", false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entry, ok := w.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.text, true
+}
+
+func (w *Web) store(key, text string) {
+	if w.config.CacheTTL < 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	if len(w.cache) >= maxWebCacheEntries {
+		for k, entry := range w.cache {
+			if now.After(entry.expires) {
+				delete(w.cache, k)
+			}
+		}
+		// Still full: drop an arbitrary entry
+		for k := range w.cache {
+			if len(w.cache) < maxWebCacheEntries {
+				break
+			}
+			delete(w.cache, k)
+		}
+	}
+	w.cache[key] = webCacheEntry{text: text, expires: now.Add(time.Duration(w.config.CacheTTL))}
+}
+
+var (
+	_ Tool = (*Web)(nil)
+)
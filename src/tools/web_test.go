@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWeb_FetchesTextAndCaches(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><script>track()</script></head><body><p>Hello from the page</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	web := NewWeb(WebConfig{})
+	web.allowPrivate = true
+
+	for range 2 {
+		text, err := web.Call(context.Background(), `{"url": "`+srv.URL+`/page"}`)
+		if err != nil {
+			t.Fatalf("Call returned error: %v", err)
+		}
+		if !strings.Contains(text, "Hello from the page") || strings.Contains(text, "track()") {
+			t.Errorf("unexpected page text: %q", text)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected the second call to be cached, server was hit %d times", hits.Load())
+	}
+}
+
+func TestWeb_TruncatesText(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(strings.Repeat("a", 500)))
+	}))
+	defer srv.Close()
+
+	web := NewWeb(WebConfig{MaxChars: 100})
+	web.allowPrivate = true
+
+	text, err := web.Call(context.Background(), `{"url": "`+srv.URL+`"}`)
+	if err != nil {
+		t.Fatalf("Call returned error: %v", err)
+	}
+	if !strings.HasSuffix(text, strings.Repeat("a", 100)+"\n[truncated]") {
+		t.Errorf("expected text truncated at 100 chars, got %q", text)
+	}
+}
+
+func TestWeb_RefusesDisallowedTargets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not reach the server")
+	}))
+	defer srv.Close()
+
+	web := NewWeb(WebConfig{AllowDomains: []string{"example.com"}, DenyDomains: []string{"private.example.com"}})
+	for _, target := range []string{"https://other.org/", "https://a.private.example.com/"} {
+		_, err := web.Call(context.Background(), `{"url": "`+target+`"}`)
+		if !errors.Is(err, ErrDomainNotAllowed) {
+			t.Errorf("%s: expected ErrDomainNotAllowed, got %v", target, err)
+		}
+	}
+
+	// Loopback addresses are refused even without a domain allowlist
+	if _, err := NewWeb(WebConfig{}).Call(context.Background(), `{"url": "`+srv.URL+`"}`); err == nil {
+		t.Error("expected loopback address to be refused")
+	}
+
+	if _, err := web.Call(context.Background(), `{"url": "file:///etc/passwd"}`); err == nil {
+		t.Error("expected non-http scheme to be refused")
+	}
+}
+
+func TestMatchesDomain(t *testing.T) {
+	domains := []string{"example.com", "*.docs.org"}
+	tests := map[string]bool{
+		"example.com":     true,
+		"api.example.com": true,
+		"badexample.com":  false,
+		"docs.org":        true,
+		"www.docs.org":    true,
+		"other.org":       false,
+	}
+	for host, want := range tests {
+		if got := matchesDomain(domains, host); got != want {
+			t.Errorf("matchesDomain(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Package validate checks API payloads against bundled schemas for the
+// response formats the router produces (OpenAI Chat Completions and
+// Responses, Anthropic Messages). The schemas are trimmed from the providers'
+// OpenAPI specifications to the fields clients depend on, and the validator
+// understands the subset of JSON Schema they use: type, nullable, enum,
+// required, properties, items, anyOf/oneOf and local $ref.
+package validate
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Bundled schema names
+const (
+	SchemaChatCompletion      = "chat_completion"
+	SchemaChatCompletionChunk = "chat_completion_chunk"
+	SchemaResponse            = "response"
+	SchemaAnthropicMessage    = "anthropic_message"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// schema is a node of a bundled JSON Schema
+type schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+	Enum       []any              `json:"enum,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Properties map[string]*schema `json:"properties,omitempty"`
+	Items      *schema            `json:"items,omitempty"`
+	AnyOf      []*schema          `json:"anyOf,omitempty"`
+	OneOf      []*schema          `json:"oneOf,omitempty"`
+	Defs       map[string]*schema `json:"$defs,omitempty"`
+}
+
+var schemas = loadSchemas()
+
+func loadSchemas() map[string]*schema {
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]*schema, len(entries))
+	for _, entry := range entries {
+		data, err := schemaFiles.ReadFile("schemas/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		var s schema
+		if err := json.Unmarshal(data, &s); err != nil {
+			panic(fmt.Sprintf("validate: invalid bundled schema %s: %v", entry.Name(), err))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))] = &s
+	}
+	return loaded
+}
+
+// Violation is one place where a document does not match its schema
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// SchemaFor picks the bundled schema matching a response document by its
+// object/type discriminator; ok is false for unknown documents
+func SchemaFor(doc map[string]json.RawMessage) (name string, ok bool) {
+	var object, typ string
+	_ = json.Unmarshal(doc["object"], &object)
+	_ = json.Unmarshal(doc["type"], &typ)
+	switch {
+	case object == "chat.completion":
+		return SchemaChatCompletion, true
+	case object == "chat.completion.chunk":
+		return SchemaChatCompletionChunk, true
+	case object == "response":
+		return SchemaResponse, true
+	case typ == "message":
+		return SchemaAnthropicMessage, true
+	}
+	return "", false
+}
+
+// Validate checks a JSON document against a bundled schema
+func Validate(schemaName string, data []byte) ([]Violation, error) {
+	root, ok := schemas[schemaName]
+	if !ok {
+		return nil, fmt.Errorf("validate: unknown schema '%s'", schemaName)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []Violation{{Path: "$", Message: "invalid JSON: " + err.Error()}}, nil
+	}
+	v := &validator{root: root}
+	v.check(root, doc, "$")
+	return v.violations, nil
+}
+
+// ValidateSchema checks a JSON document against a caller's JSON Schema,
+// understanding the same subset as the bundled schemas
+func ValidateSchema(schemaJSON, data []byte) ([]Violation, error) {
+	var root schema
+	if err := json.Unmarshal(schemaJSON, &root); err != nil {
+		return nil, fmt.Errorf("validate: invalid schema: %w", err)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []Violation{{Path: "$", Message: "invalid JSON: " + err.Error()}}, nil
+	}
+	v := &validator{root: &root}
+	v.check(&root, doc, "$")
+	return v.violations, nil
+}
+
+type validator struct {
+	root       *schema
+	violations []Violation
+}
+
+func (v *validator) fail(at, format string, args ...any) {
+	v.violations = append(v.violations, Violation{Path: at, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) resolve(s *schema) *schema {
+	for s != nil && s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		if !ok {
+			return nil
+		}
+		s = v.root.Defs[name]
+	}
+	return s
+}
+
+func (v *validator) check(s *schema, value any, at string) {
+	if s = v.resolve(s); s == nil {
+		return
+	}
+	if value == nil {
+		if !s.Nullable && s.Type != "" && s.Type != "null" {
+			v.fail(at, "must not be null")
+		}
+		return
+	}
+
+	if alternatives := append(append([]*schema{}, s.AnyOf...), s.OneOf...); len(alternatives) > 0 {
+		matched := false
+		for _, alt := range alternatives {
+			sub := &validator{root: v.root}
+			sub.check(alt, value, at)
+			if len(sub.violations) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(at, "matches none of the allowed shapes")
+			return
+		}
+	}
+
+	if s.Type != "" && !hasType(value, s.Type) {
+		v.fail(at, "expected %s, got %s", s.Type, typeName(value))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, value) {
+		v.fail(at, "unexpected value %v", value)
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				v.fail(at, "missing required field '%s'", name)
+			}
+		}
+		for name, prop := range s.Properties {
+			if field, ok := value[name]; ok {
+				v.check(prop, field, at+"."+name)
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range value {
+				v.check(s.Items, item, at+"["+strconv.Itoa(i)+"]")
+			}
+		}
+	}
+}
+
+func hasType(value any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return true
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	}
+	return "null"
+}
@@ -0,0 +1,128 @@
+package validate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const validCompletion = `{
+	"id": "chatcmpl-1",
+	"object": "chat.completion",
+	"created": 1700000000,
+	"model": "gpt-4.1",
+	"choices": [{
+		"index": 0,
+		"message": {"role": "assistant", "content": "hi"},
+		"finish_reason": "stop",
+		"logprobs": null
+	}],
+	"usage": {"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4}
+}`
+
+func mustValidate(t *testing.T, schemaName, doc string) []Violation {
+	t.Helper()
+	violations, err := Validate(schemaName, []byte(doc))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	return violations
+}
+
+func hasViolation(violations []Violation, path, fragment string) bool {
+	for _, v := range violations {
+		if v.Path == path && strings.Contains(v.Message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidChatCompletion(t *testing.T) {
+	if violations := mustValidate(t, SchemaChatCompletion, validCompletion); len(violations) > 0 {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+}
+
+func TestChatCompletionViolations(t *testing.T) {
+	var doc map[string]any
+	_ = json.Unmarshal([]byte(validCompletion), &doc)
+	delete(doc, "model")
+	doc["created"] = "yesterday"
+	choice := doc["choices"].([]any)[0].(map[string]any)
+	choice["finish_reason"] = "done"
+	choice["index"] = nil
+	data, _ := json.Marshal(doc)
+
+	violations := mustValidate(t, SchemaChatCompletion, string(data))
+	for _, want := range []struct{ path, fragment string }{
+		{"$", "missing required field 'model'"},
+		{"$.created", "expected integer, got string"},
+		{"$.choices[0].finish_reason", "unexpected value"},
+		{"$.choices[0].index", "must not be null"},
+	} {
+		if !hasViolation(violations, want.path, want.fragment) {
+			t.Errorf("missing violation %s: %s in %v", want.path, want.fragment, violations)
+		}
+	}
+}
+
+func TestChunkSchema(t *testing.T) {
+	chunk := `{"id":"c","object":"chat.completion.chunk","created":1,"model":"m",
+		"choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":null}]}`
+	if violations := mustValidate(t, SchemaChatCompletionChunk, chunk); len(violations) > 0 {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+
+	broken := `{"id":"c","object":"chat.completion.chunk","created":1,"model":"m",
+		"choices":[{"index":0,"delta":{"tool_calls":[{"function":{"arguments":{}}}]}}]}`
+	violations := mustValidate(t, SchemaChatCompletionChunk, broken)
+	if !hasViolation(violations, "$.choices[0].delta.tool_calls[0]", "missing required field 'index'") ||
+		!hasViolation(violations, "$.choices[0].delta.tool_calls[0].function.arguments", "expected string") {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+}
+
+func TestSchemaFor(t *testing.T) {
+	for doc, want := range map[string]string{
+		`{"object":"chat.completion"}`:       SchemaChatCompletion,
+		`{"object":"chat.completion.chunk"}`: SchemaChatCompletionChunk,
+		`{"object":"response"}`:              SchemaResponse,
+		`{"type":"message"}`:                 SchemaAnthropicMessage,
+	} {
+		var parsed map[string]json.RawMessage
+		_ = json.Unmarshal([]byte(doc), &parsed)
+		if got, ok := SchemaFor(parsed); !ok || got != want {
+			t.Errorf("SchemaFor(%s) = %q, %v; want %q", doc, got, ok, want)
+		}
+	}
+	if _, ok := SchemaFor(map[string]json.RawMessage{"object": json.RawMessage(`"list"`)}); ok {
+		t.Error("SchemaFor matched an unknown document")
+	}
+}
+
+func TestBundledSchemasResolve(t *testing.T) {
+	for name, root := range schemas {
+		v := &validator{root: root}
+		var walk func(s *schema, seen map[*schema]bool)
+		walk = func(s *schema, seen map[*schema]bool) {
+			if s == nil || seen[s] {
+				return
+			}
+			seen[s] = true
+			if s.Ref != "" && v.resolve(s) == nil {
+				t.Errorf("%s: unresolved $ref %s", name, s.Ref)
+			}
+			for _, sub := range s.Properties {
+				walk(sub, seen)
+			}
+			for _, sub := range append(append([]*schema{s.Items}, s.AnyOf...), s.OneOf...) {
+				walk(sub, seen)
+			}
+			for _, sub := range s.Defs {
+				walk(sub, seen)
+			}
+		}
+		walk(root, map[*schema]bool{})
+	}
+}